@@ -30,6 +30,8 @@ import (
 // - regular: for unified accounts
 // - split: for the individual accounts split from a unified account, if the keystore does not support unified accounts, such as the BitBox01.
 // - erc20: for ERC20 token accounts
+// - watchonly: for accounts added from an extended public key, without a keystore
+// - multisig: for multisig accounts, based on the keystore which created the account
 
 // regularAccountCode returns an account code based on a keystore root fingerprint, a coin code and
 // an account number.
@@ -37,6 +39,18 @@ func regularAccountCode(rootFingerprint []byte, coinCode coin.Code, accountNumbe
 	return accounts.Code(fmt.Sprintf("v0-%x-%s-%d", rootFingerprint, coinCode, accountNumber))
 }
 
+// watchOnlyAccountCode returns the account code of a watch-only account, based on the fingerprint of
+// the watched extended public key.
+func watchOnlyAccountCode(keyFingerprint []byte, coinCode coin.Code, scriptType signing.ScriptType) accounts.Code {
+	return accounts.Code(fmt.Sprintf("v0-watchonly-%x-%s-%s", keyFingerprint, coinCode, scriptType))
+}
+
+// multisigAccountCode returns the account code of a multisig account, based on the root fingerprint
+// of the keystore which created it and its BIP48 account number.
+func multisigAccountCode(rootFingerprint []byte, coinCode coin.Code, accountNumber uint16) accounts.Code {
+	return accounts.Code(fmt.Sprintf("v0-%x-%s-multisig-%d", rootFingerprint, coinCode, accountNumber))
+}
+
 // splitAccountCode returns an account code for split accounts, made by exploding a unified account
 // into one account per signing configuration. This only applies to BTC/LTC.
 func splitAccountCode(parentCode accounts.Code, scriptType signing.ScriptType) accounts.Code {
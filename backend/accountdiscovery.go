@@ -0,0 +1,221 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DiscoveredAccount is an account of the registered keystore which has on-chain history, but has
+// not been added yet.
+type DiscoveredAccount struct {
+	CoinCode      coinpkg.Code `json:"coinCode"`
+	AccountNumber uint16       `json:"accountNumber"`
+	Name          string       `json:"name"`
+}
+
+// AccountDiscovery holds the state of the account discovery, which scans the account numbers
+// following the existing accounts for on-chain history after a new keystore was registered, so the
+// user can add accounts used previously, e.g. with another wallet.
+type AccountDiscovery struct {
+	// Running is true while the accounts are being scanned.
+	Running bool `json:"running"`
+	// Accounts are the used accounts found, which can be added using AddDiscoveredAccounts().
+	Accounts []DiscoveredAccount `json:"accounts"`
+}
+
+// accountHasHistory returns true if any address of the account described by the signing
+// configurations has on-chain history.
+func (backend *Backend) accountHasHistory(
+	coin coinpkg.Coin, configurations signing.Configurations) (bool, error) {
+	switch specificCoin := coin.(type) {
+	case *btc.Coin:
+		return specificCoin.HasHistory(configurations, backend.arguments.GapLimits())
+	case *eth.Coin:
+		for _, configuration := range configurations {
+			address := crypto.PubkeyToAddress(*configuration.PublicKey().ToECDSA())
+			used, err := specificCoin.AddressHasHistory(context.TODO(), address)
+			if err != nil || used {
+				return used, err
+			}
+		}
+		return false, nil
+	default:
+		return false, errp.Newf("account discovery not supported for %s", coin.Code())
+	}
+}
+
+// accountConfigurations returns the signing configurations the account with the given coin and
+// account number would have if it was added.
+func (backend *Backend) accountConfigurations(
+	coinCode coinpkg.Code, accountNumber uint16, keystore keystore.Keystore) (signing.Configurations, error) {
+	// Persist into a throwaway config to reuse the keypath and script type logic.
+	accountsConfig := &config.AccountsConfig{}
+	if _, err := backend.createAndPersistAccountConfig(
+		coinCode, accountNumber, "", keystore, nil, accountsConfig); err != nil {
+		return nil, err
+	}
+	var configurations signing.Configurations
+	for _, account := range accountsConfig.Accounts {
+		configurations = append(configurations, account.Configurations...)
+	}
+	return configurations, nil
+}
+
+// discoverAccounts scans the accounts following the last existing account of each supported coin
+// for on-chain history, stopping at the first unused account of a coin, similar to BIP-44 account
+// discovery. The used accounts are offered to the user, see AccountDiscovery().
+//
+// It is run in a goroutine after a keystore is registered for the first time, with the state set
+// to running. The accountsAndKeystoreLock must not be held when calling this function.
+func (backend *Backend) discoverAccounts(keystore keystore.Keystore) {
+	// keystoreRegistered returns false if the keystore was deregistered in the meantime, in which
+	// case the discovery is aborted.
+	keystoreRegistered := func() bool {
+		defer backend.accountsAndKeystoreLock.RLock()()
+		return backend.keystore == keystore
+	}
+	setState := func(state AccountDiscovery) {
+		defer backend.accountsAndKeystoreLock.Lock()()
+		backend.accountDiscovery = state
+		backend.notifyAccountDiscovery()
+	}
+
+	if !keystore.SupportsMultipleAccounts() {
+		setState(AccountDiscovery{})
+		return
+	}
+	discovered := []DiscoveredAccount{}
+	for _, coinCode := range backend.SupportedCoins(keystore) {
+		coin, err := backend.Coin(coinCode)
+		if err != nil {
+			backend.log.WithError(err).Error("account discovery: could not get coin")
+			continue
+		}
+		accountsConfig := backend.config.AccountsConfig()
+		firstAccountNumber, err := nextAccountNumber(coinCode, keystore, &accountsConfig)
+		if err != nil {
+			continue
+		}
+		for accountNumber := firstAccountNumber; accountNumber < accountsHardLimit; accountNumber++ {
+			if !keystoreRegistered() {
+				setState(AccountDiscovery{})
+				return
+			}
+			log := backend.log.WithField("coinCode", coinCode).WithField("accountNumber", accountNumber)
+			configurations, err := backend.accountConfigurations(coinCode, accountNumber, keystore)
+			if err != nil {
+				log.WithError(err).Error("account discovery: could not get account configurations")
+				break
+			}
+			if len(configurations) == 0 {
+				break
+			}
+			used, err := backend.checkAccountHistory(coin, configurations)
+			if err != nil {
+				log.WithError(err).Error("account discovery: could not check account history")
+				break
+			}
+			if !used {
+				break
+			}
+			log.Info("account discovery: found used account")
+			discovered = append(discovered, DiscoveredAccount{
+				CoinCode:      coinCode,
+				AccountNumber: accountNumber,
+				Name:          defaultAccountName(coin, accountNumber),
+			})
+		}
+	}
+	if !keystoreRegistered() {
+		setState(AccountDiscovery{})
+		return
+	}
+	setState(AccountDiscovery{Accounts: discovered})
+}
+
+// notifyAccountDiscovery sends the account discovery state to the frontend.
+// `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) notifyAccountDiscovery() {
+	backend.Notify(observable.Event{
+		Subject: "account-discovery",
+		Action:  action.Replace,
+		Object:  backend.accountDiscovery,
+	})
+}
+
+// AccountDiscovery returns the current account discovery state.
+func (backend *Backend) AccountDiscovery() AccountDiscovery {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	return backend.accountDiscovery
+}
+
+// AddDiscoveredAccounts adds all accounts found by the account discovery and resets the account
+// discovery state.
+func (backend *Backend) AddDiscoveredAccounts() error {
+	unlock := backend.accountsAndKeystoreLock.Lock()
+	keystore := backend.keystore
+	state := backend.accountDiscovery
+	if state.Running {
+		unlock()
+		return errp.New("account discovery is still running")
+	}
+	backend.accountDiscovery = AccountDiscovery{}
+	backend.notifyAccountDiscovery()
+	unlock()
+
+	if len(state.Accounts) == 0 {
+		return nil
+	}
+	if keystore == nil {
+		return errp.New("no keystore registered")
+	}
+	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		for _, account := range state.Accounts {
+			_, err := backend.createAndPersistAccountConfig(
+				account.CoinCode, account.AccountNumber, "", keystore, nil, accountsConfig)
+			if errp.Cause(err) == ErrAccountAlreadyExists {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	backend.ReinitializeAccounts()
+	return nil
+}
+
+// DismissDiscoveredAccounts resets the account discovery state without adding any accounts.
+func (backend *Backend) DismissDiscoveredAccounts() {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	backend.accountDiscovery = AccountDiscovery{}
+	backend.notifyAccountDiscovery()
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDiscovery(t *testing.T) {
+	// From mnemonic: wisdom minute home employ west tail liquid mad deal catalog narrow mistake
+	rootKey := mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB")
+	keystoreHelper := software.NewKeystore(rootKey)
+	ks := &keystoremock.KeystoreMock{
+		RootFingerprintFunc: func() ([]byte, error) {
+			return []byte{0x55, 0x55, 0x55, 0x55}, nil
+		},
+		SupportsCoinFunc: func(coin coinpkg.Coin) bool {
+			return true
+		},
+		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
+			switch coin.(type) {
+			case *btc.Coin:
+				scriptType := meta.(signing.ScriptType)
+				return scriptType != signing.ScriptTypeP2PKH
+			default:
+				return true
+			}
+		},
+		SupportsMultipleAccountsFunc: func() bool {
+			return true
+		},
+		SupportsUnifiedAccountsFunc: func() bool {
+			return true
+		},
+		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
+	}
+
+	// Used accounts by coin. The account numbers are contiguous, except for ETH, where account 3
+	// must not be found as account 2 is unused.
+	usedAccounts := map[coinpkg.Code][]uint16{
+		coinpkg.CodeBTC: {0, 1, 2},
+		coinpkg.CodeETH: {0, 1, 3},
+	}
+
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+	b.checkAccountHistory = func(coin coinpkg.Coin, configurations signing.Configurations) (bool, error) {
+		accountNumber, err := configurations[0].AccountNumber()
+		require.NoError(t, err)
+		for _, used := range usedAccounts[coin.Code()] {
+			if used == accountNumber {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	b.registerKeystore(ks)
+	require.Eventually(t, func() bool { return !b.AccountDiscovery().Running }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t,
+		[]DiscoveredAccount{
+			{CoinCode: coinpkg.CodeBTC, AccountNumber: 1, Name: "Bitcoin 2"},
+			{CoinCode: coinpkg.CodeBTC, AccountNumber: 2, Name: "Bitcoin 3"},
+			{CoinCode: coinpkg.CodeETH, AccountNumber: 1, Name: "Ethereum 2"},
+		},
+		b.AccountDiscovery().Accounts,
+	)
+	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
+
+	require.NoError(t, b.AddDiscoveredAccounts())
+	require.Empty(t, b.AccountDiscovery().Accounts)
+	require.Len(t, b.Config().AccountsConfig().Accounts, 6)
+	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-55555555-btc-1"))
+	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-55555555-btc-2"))
+	require.NotNil(t, b.Config().AccountsConfig().Lookup("v0-55555555-eth-1"))
+	require.NotNil(t, lookup(b.Accounts(), "v0-55555555-eth-1"))
+
+	// Re-registering the keystore does not run the discovery again.
+	b.DeregisterKeystore()
+	b.registerKeystore(ks)
+	require.Equal(t, AccountDiscovery{}, b.AccountDiscovery())
+}
+
+func TestDismissDiscoveredAccounts(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+	b.accountDiscovery = AccountDiscovery{
+		Accounts: []DiscoveredAccount{{CoinCode: coinpkg.CodeBTC, AccountNumber: 1, Name: "Bitcoin 2"}},
+	}
+	b.DismissDiscoveredAccounts()
+	require.Equal(t, AccountDiscovery{}, b.AccountDiscovery())
+	require.NoError(t, b.AddDiscoveredAccounts())
+	require.Empty(t, b.Config().AccountsConfig().Accounts)
+}
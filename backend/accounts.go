@@ -19,17 +19,22 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/watchonly"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // hardenedKeystart is the BIP44 offset to make a keypath element hardened.
@@ -47,11 +52,12 @@ func sortAccounts(accounts []*config.Account) {
 		order := map[coinpkg.Code]int{
 			coinpkg.CodeBTC:  0,
 			coinpkg.CodeTBTC: 1,
-			coinpkg.CodeLTC:  2,
-			coinpkg.CodeTLTC: 3,
-			coinpkg.CodeETH:  4,
-			coinpkg.CodeTETH: 5,
-			coinpkg.CodeRETH: 6,
+			coinpkg.CodeSBTC: 2,
+			coinpkg.CodeLTC:  3,
+			coinpkg.CodeTLTC: 4,
+			coinpkg.CodeETH:  5,
+			coinpkg.CodeTETH: 6,
+			coinpkg.CodeRETH: 7,
 		}
 		order1, ok1 := order[coin1]
 		order2, ok2 := order[coin2]
@@ -114,10 +120,11 @@ func (backend *Backend) filterAccounts(accountsConfig *config.AccountsConfig, fi
 // SupportedCoins returns the list of coins that can be used with the given keystore.
 func (backend *Backend) SupportedCoins(keystore keystore.Keystore) []coinpkg.Code {
 	allCoins := []coinpkg.Code{
-		coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC,
+		coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC, coinpkg.CodeSBTC,
 		coinpkg.CodeLTC, coinpkg.CodeTLTC,
 		coinpkg.CodeETH, coinpkg.CodeTETH, coinpkg.CodeRETH,
 	}
+	allCoins = append(allCoins, backend.evmNetworkCodes(allCoins)...)
 	var availableCoins []coinpkg.Code
 	for _, coinCode := range allCoins {
 		if _, isTestnet := coinpkg.TestnetCoins[coinCode]; !backend.arguments.Regtest() && isTestnet != backend.Testing() {
@@ -191,7 +198,7 @@ func (backend *Backend) createAndPersistAccountConfig(
 	accountNumberHardened := uint32(accountNumber) + hardenedKeystart
 
 	switch coinCode {
-	case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC:
+	case coinpkg.CodeBTC, coinpkg.CodeTBTC, coinpkg.CodeRBTC, coinpkg.CodeSBTC:
 		bip44Coin := 1 + hardenedKeystart
 		if coinCode == coinpkg.CodeBTC {
 			bip44Coin = hardenedKeystart
@@ -203,6 +210,7 @@ func (backend *Backend) createAndPersistAccountConfig(
 				{signing.ScriptTypeP2WPKH, signing.NewAbsoluteKeypathFromUint32(84+hardenedKeystart, bip44Coin, accountNumberHardened)},
 				{signing.ScriptTypeP2WPKHP2SH, signing.NewAbsoluteKeypathFromUint32(49+hardenedKeystart, bip44Coin, accountNumberHardened)},
 				{signing.ScriptTypeP2PKH, signing.NewAbsoluteKeypathFromUint32(44+hardenedKeystart, bip44Coin, accountNumberHardened)},
+				{signing.ScriptTypeP2TR, signing.NewAbsoluteKeypathFromUint32(86+hardenedKeystart, bip44Coin, accountNumberHardened)},
 			},
 			accountsConfig,
 		)
@@ -233,6 +241,15 @@ func (backend *Backend) createAndPersistAccountConfig(
 			activeTokens,
 			accountsConfig)
 	default:
+		if _, isETH := coin.(*eth.Coin); isETH && backend.config.AppConfig().Backend.EVMNetwork(coinCode) != nil {
+			// EVM networks use the Ethereum keypath, so the addresses are the same as on Ethereum.
+			return accountCode, backend.persistETHAccountConfig(
+				keystore, coin, accountCode,
+				fmt.Sprintf("m/44'/60'/0'/0/%d", accountNumber),
+				name,
+				nil,
+				accountsConfig)
+		}
 		return "", errp.Newf("Unrecognized coin code: %s", coinCode)
 	}
 }
@@ -255,6 +272,10 @@ func nextAccountNumber(coinCode coinpkg.Code, keystore keystore.Keystore, accoun
 		if len(account.Configurations) == 0 {
 			continue
 		}
+		if account.Configurations[0].IsMultisig() {
+			// Multisig accounts are numbered separately, see nextMultisigAccountNumber().
+			continue
+		}
 		accountNumber, err := account.Configurations[0].AccountNumber()
 		if err != nil {
 			continue
@@ -345,6 +366,60 @@ func (backend *Backend) SetTokenActive(accountCode accounts.Code, tokenCode stri
 	return nil
 }
 
+// AddCustomERC20Token adds the ERC20 token deployed at `contractAddress` to an ETH account and
+// activates it. The token name, symbol and decimals are fetched from the contract. If the token is
+// one of the builtin tokens, the builtin token is activated instead. Returns the token code.
+func (backend *Backend) AddCustomERC20Token(accountCode accounts.Code, contractAddress string) (string, error) {
+	if !common.IsHexAddress(contractAddress) {
+		return "", errp.WithStack(errors.ErrInvalidAddress)
+	}
+	address := common.HexToAddress(contractAddress)
+	if token := erc20TokenByContractAddress(address); token != nil {
+		if err := backend.SetTokenActive(accountCode, string(token.code), true); err != nil {
+			return "", err
+		}
+		return string(token.code), nil
+	}
+	ethCoin, err := backend.Coin(coinpkg.CodeETH)
+	if err != nil {
+		return "", err
+	}
+	tokenInfo, err := ethCoin.(*eth.Coin).ERC20TokenInfo(address)
+	if err != nil {
+		return "", err
+	}
+	return backend.addCustomERC20Token(accountCode, address, tokenInfo)
+}
+
+// addCustomERC20Token persists a user-defined token in the account config and reinitializes the
+// accounts, which creates the token account. Tokens using the symbol of ETH or of a builtin token
+// are rejected, so they can't be mistaken for it. Returns the token code.
+func (backend *Backend) addCustomERC20Token(
+	accountCode accounts.Code, contractAddress common.Address, tokenInfo *erc20.TokenInfo) (string, error) {
+	if strings.EqualFold(tokenInfo.Symbol, "ETH") || erc20TokenByUnit(tokenInfo.Symbol) != nil {
+		return "", errp.Newf("The token symbol %s is already used by another coin", tokenInfo.Symbol)
+	}
+	tokenCode := customERC20TokenCode(contractAddress)
+	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		acct := accountsConfig.Lookup(accountCode)
+		if acct == nil {
+			return errp.Newf("Could not find account %s", accountCode)
+		}
+		return acct.AddCustomToken(config.CustomToken{
+			Code:            string(tokenCode),
+			ContractAddress: contractAddress.Hex(),
+			Name:            tokenInfo.Name,
+			Symbol:          tokenInfo.Symbol,
+			Decimals:        tokenInfo.Decimals,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	backend.ReinitializeAccounts()
+	return string(tokenCode), nil
+}
+
 // RenameAccount renames an account in the accounts database.
 func (backend *Backend) RenameAccount(accountCode accounts.Code, name string) error {
 	if name == "" {
@@ -377,6 +452,7 @@ func (backend *Backend) addAccount(account accounts.Interface) {
 
 // The accountsAndKeystoreLock must be held when calling this function.
 func (backend *Backend) createAndAddAccount(
+	keystore keystore.Keystore,
 	coin coinpkg.Coin,
 	code accounts.Code,
 	name string,
@@ -391,7 +467,7 @@ func (backend *Backend) createAndAddAccount(
 		Name:        name,
 		DBFolder:    backend.arguments.CacheDirectoryPath(),
 		NotesFolder: backend.arguments.NotesDirectoryPath(),
-		Keystore:    backend.keystore,
+		Keystore:    keystore,
 		OnEvent: func(event accounts.Event) {
 			backend.events <- AccountEvent{Type: "account", Code: code, Data: string(event)}
 			if account != nil && event == accounts.EventSyncDone {
@@ -435,7 +511,7 @@ func (backend *Backend) createAndAddAccount(
 			} else if accountNumber > 0 {
 				tokenName = fmt.Sprintf("%s %d", tokenName, accountNumber+1)
 			}
-			backend.createAndAddAccount(token, erc20AccountCode, tokenName, signingConfigurations, active, nil)
+			backend.createAndAddAccount(keystore, token, erc20AccountCode, tokenName, signingConfigurations, active, nil)
 		}
 	default:
 		panic("unknown coin type")
@@ -466,6 +542,13 @@ func (backend *Backend) persistAccount(account config.Account, accountsConfig *c
 			// configurations is already present.
 			for _, config := range account.Configurations {
 				for _, config2 := range account2.Configurations {
+					if config.IsMultisig() || config2.IsMultisig() {
+						// Multisig accounts are duplicates only if all cosigners match.
+						if config.String() == config2.String() {
+							return errp.WithStack(ErrAccountAlreadyExists)
+						}
+						continue
+					}
 					if config.ExtendedPublicKey().String() == config2.ExtendedPublicKey().String() {
 						return errp.WithStack(ErrAccountAlreadyExists)
 					}
@@ -545,6 +628,8 @@ func (backend *Backend) persistBTCAccountConfig(
 			suffixedName += ": legacy"
 		case signing.ScriptTypeP2WPKH:
 			suffixedName += ": bech32"
+		case signing.ScriptTypeP2TR:
+			suffixedName += ": taproot"
 		}
 
 		err := backend.persistAccount(config.Account{
@@ -612,9 +697,17 @@ func (backend *Backend) persistETHAccountConfig(
 
 // The accountsAndKeystoreLock must be held when calling this function.
 func (backend *Backend) initPersistedAccounts() {
-	if backend.keystore == nil {
-		return
+	persistedAccounts := backend.config.AccountsConfig()
+	backend.loadCustomERC20Tokens(&persistedAccounts)
+	if backend.keystore != nil {
+		backend.initKeystoreAccounts(&persistedAccounts)
 	}
+	backend.initWatchOnlyAccounts(&persistedAccounts)
+}
+
+// initKeystoreAccounts loads the persisted accounts belonging to the connected keystore.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) initKeystoreAccounts(persistedAccounts *config.AccountsConfig) {
 	// Only load accounts which belong to connected keystores.
 	rootFingerprint, err := backend.keystore.RootFingerprint()
 	if err != nil {
@@ -622,12 +715,11 @@ func (backend *Backend) initPersistedAccounts() {
 		return
 	}
 	keystoreConnected := func(account *config.Account) bool {
-		return account.Configurations.ContainsRootFingerprint(rootFingerprint)
+		return !account.WatchOnly && account.Configurations.ContainsRootFingerprint(rootFingerprint)
 	}
 
-	persistedAccounts := backend.config.AccountsConfig()
 outer:
-	for _, account := range backend.filterAccounts(&persistedAccounts, keystoreConnected) {
+	for _, account := range backend.filterAccounts(persistedAccounts, keystoreConnected) {
 		coin, err := backend.Coin(account.CoinCode)
 		if err != nil {
 			backend.log.Errorf("skipping persisted account %s/%s, could not find coin",
@@ -647,11 +739,90 @@ outer:
 			}
 		}
 
-		backend.createAndAddAccount(
+		backend.createAndAddAccount(backend.keystore,
 			coin, account.Code, account.Name, account.Configurations, !account.Inactive, account.ActiveTokens)
 	}
 }
 
+// initWatchOnlyAccounts loads the persisted watch-only accounts. They do not depend on a connected
+// keystore, each of them gets its own watch-only keystore.
+// The accountsAndKeystoreLock must be held when calling this function.
+func (backend *Backend) initWatchOnlyAccounts(persistedAccounts *config.AccountsConfig) {
+	isWatchOnly := func(account *config.Account) bool {
+		return account.WatchOnly
+	}
+	for _, account := range backend.filterAccounts(persistedAccounts, isWatchOnly) {
+		coin, err := backend.Coin(account.CoinCode)
+		if err != nil {
+			backend.log.Errorf("skipping persisted account %s/%s, could not find coin",
+				account.CoinCode, account.Code)
+			continue
+		}
+		if len(account.Configurations) != 1 {
+			backend.log.Errorf("skipping watch-only account %s, expected exactly one configuration",
+				account.Code)
+			continue
+		}
+		backend.createAndAddAccount(watchonly.NewKeystore(account.Configurations[0]),
+			coin, account.Code, account.Name, account.Configurations, !account.Inactive, nil)
+	}
+}
+
+// AddWatchOnlyAccount persists a watch-only account for the given extended public key (xpub, ypub,
+// zpub, ...), optionally prefixed by its key origin, and script type, and loads it. The script type can be empty if it is implied by the
+// extended public key format. `name` is the account name, shown to the user. If empty, a default
+// name will be set.
+//
+// The account code of the newly created account is returned.
+func (backend *Backend) AddWatchOnlyAccount(
+	coinCode coinpkg.Code,
+	name string,
+	extendedPublicKey string,
+	scriptType signing.ScriptType,
+) (accounts.Code, error) {
+	coin, err := backend.Coin(coinCode)
+	if err != nil {
+		return "", err
+	}
+	btcCoin, ok := coin.(*btc.Coin)
+	if !ok {
+		return "", errp.Newf("Watch-only accounts are not supported for %s", coinCode)
+	}
+	signingConfiguration, err := watchonly.NewConfiguration(extendedPublicKey, scriptType, btcCoin.Net())
+	if err != nil {
+		return "", err
+	}
+	// Accounts of the same wallet share the root fingerprint of their key origin, so the account is
+	// identified by the fingerprint of the extended public key itself.
+	publicKey, err := signingConfiguration.ExtendedPublicKey().ECPubKey()
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s (watch-only)", coin.Name())
+	}
+	accountCode := watchOnlyAccountCode(
+		btcutil.Hash160(publicKey.SerializeCompressed())[:4], coinCode, signingConfiguration.ScriptType())
+	backend.log.
+		WithField("accountCode", accountCode).
+		WithField("coinCode", coinCode).
+		Info("Persisting new watch-only account config")
+	err = backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		return backend.persistAccount(config.Account{
+			CoinCode:       coinCode,
+			Name:           name,
+			Code:           accountCode,
+			Configurations: signing.Configurations{signingConfiguration},
+			WatchOnly:      true,
+		}, accountsConfig)
+	})
+	if err != nil {
+		return "", err
+	}
+	backend.ReinitializeAccounts()
+	return accountCode, nil
+}
+
 // persistDefaultAccountConfigs persists a bunch of default accounts for the connected keystore (not
 // manually user-added). Currently the first bip44 account of BTC/LTC/ETH. ERC20 tokens are added if
 // they were configured to be active by the user in the past, when they could still configure them
@@ -27,14 +27,28 @@ import (
 // AddressList is a list of addresses.
 type AddressList []Address
 
+// TxRecipient is an output of a new transaction.
+type TxRecipient struct {
+	Address string
+	// Amount is the amount to be sent to the address. If it is "send all", the funds remaining
+	// after paying all other recipients and the fee are sent to the address.
+	Amount coin.SendAmount
+}
+
 // TxProposalArgs are the arguments needed when creating a tx proposal.
 type TxProposalArgs struct {
 	RecipientAddress string
 	Amount           coin.SendAmount
-	FeeTargetCode    FeeTargetCode
+	// Recipients, if not empty, are used instead of RecipientAddress and Amount to pay multiple
+	// recipients in one transaction. Only supported by UTXO based coins.
+	Recipients    []TxRecipient
+	FeeTargetCode FeeTargetCode
 	// Only applies if FeeTargetCode == Custom. It is provided in sat/vB for BTC/LTC and Gwei for ETH.
 	CustomFee     string
 	SelectedUTXOs map[wire.OutPoint]struct{}
+	// CoinSelection is the strategy to select the coins to spend. Only applies to UTXO based coins.
+	// The zero value means the default strategy.
+	CoinSelection CoinSelectionStrategy
 	Data          []byte
 	Note          string
 }
@@ -256,6 +256,46 @@ func (account *BaseAccount) TxNote(txID string) string {
 	return ""
 }
 
+// SetUTXOLabel stores a label for an unspent output, identified by its outpoint (txID:index). An
+// empty label deletes the label.
+func (account *BaseAccount) SetUTXOLabel(outPoint string, label string) error {
+	if err := account.notes[0].SetUTXOLabel(outPoint, label); err != nil {
+		return err
+	}
+	// Prompt refresh.
+	account.config.OnEvent(EventStatusChanged)
+	return nil
+}
+
+// UTXOLabel fetches the label of an unspent output. Returns the empty string if no label was found.
+func (account *BaseAccount) UTXOLabel(outPoint string) string {
+	if len(account.notes) == 0 {
+		return ""
+	}
+	return account.notes[0].UTXOLabel(outPoint)
+}
+
+// SetUTXOFrozen freezes or unfreezes an unspent output. Frozen outputs are excluded from the
+// spendable balance and from automatic coin selection.
+func (account *BaseAccount) SetUTXOFrozen(outPoint string, frozen bool) error {
+	if err := account.notes[0].SetUTXOFrozen(outPoint, frozen); err != nil {
+		return err
+	}
+	// Prompt refresh, the balance changes.
+	account.config.OnEvent(EventStatusChanged)
+	return nil
+}
+
+// UTXOFrozen returns true if the unspent output was frozen.
+func (account *BaseAccount) UTXOFrozen(outPoint string) bool {
+	// The notes are loaded at the end of the account initialization, but the balance can already
+	// be computed while the account is still initializing.
+	if len(account.notes) == 0 {
+		return false
+	}
+	return account.notes[0].UTXOFrozen(outPoint)
+}
+
 // ExportCSV implements accounts.Account.
 func (account *BaseAccount) ExportCSV(w io.Writer, transactions []*TransactionData) error {
 	writer := csv.NewWriter(w)
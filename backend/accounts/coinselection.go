@@ -0,0 +1,58 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// CoinSelectionStrategy models the strategy used to select the coins spent in a new transaction
+// (UTXO based coins only). See the constants below.
+type CoinSelectionStrategy string
+
+// NewCoinSelectionStrategy checks if the strategy is valid and returns a CoinSelectionStrategy in
+// that case.
+func NewCoinSelectionStrategy(strategy string) (CoinSelectionStrategy, error) {
+	switch strategy {
+	case "":
+		return DefaultCoinSelectionStrategy, nil
+	case string(CoinSelectionStrategyLargestFirst):
+	case string(CoinSelectionStrategyBranchAndBound):
+	case string(CoinSelectionStrategyKnapsack):
+	case string(CoinSelectionStrategyOldestFirst):
+	default:
+		return "", errp.WithStack(errp.Newf("Unrecognized coin selection strategy %s", strategy))
+	}
+	return CoinSelectionStrategy(strategy), nil
+}
+
+const (
+	// CoinSelectionStrategyLargestFirst spends the largest coins first.
+	CoinSelectionStrategyLargestFirst CoinSelectionStrategy = "largestFirst"
+
+	// CoinSelectionStrategyBranchAndBound looks for a set of coins matching the amount and fee
+	// exactly, so that no change output is needed, falling back to
+	// CoinSelectionStrategyKnapsack.
+	CoinSelectionStrategyBranchAndBound CoinSelectionStrategy = "branchAndBound"
+
+	// CoinSelectionStrategyKnapsack looks for the set of coins closest to the needed amount.
+	CoinSelectionStrategyKnapsack CoinSelectionStrategy = "knapsack"
+
+	// CoinSelectionStrategyOldestFirst spends the coins with the most confirmations first.
+	CoinSelectionStrategyOldestFirst CoinSelectionStrategy = "oldestFirst"
+
+	// DefaultCoinSelectionStrategy is the default coin selection strategy.
+	DefaultCoinSelectionStrategy = CoinSelectionStrategyLargestFirst
+)
@@ -31,6 +31,9 @@ var (
 	// ErrInvalidAddress is used when the recipient address is invalid or does not match the correct
 	// network.
 	ErrInvalidAddress = TxValidationError("invalidAddress")
+	// ErrENSNameNotFound is used when the recipient is an ENS name which does not resolve to an
+	// address.
+	ErrENSNameNotFound = TxValidationError("ensNameNotFound")
 	// ErrInvalidAmount is used when the user entered amount is malformatted or not positive.
 	ErrInvalidAmount = TxValidationError("invalidAmount")
 	// ErrInvalidData is used when the user entered data is not hexadecimal.
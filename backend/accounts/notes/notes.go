@@ -28,10 +28,14 @@ const maxNoteLen = 1024
 
 // NotesData is the notes JSON data serialized to disk.
 type notesData struct {
-	// More fields to be added when we can label more stuff, e.g. receive addresses, utxos, etc.
+	// More fields to be added when we can label more stuff, e.g. receive addresses, etc.
 
 	// a map of transaction ID to transaction note.
 	TransactionNotes map[string]string `json:"transactions"`
+	// a map of outpoint (txID:index) to utxo label.
+	UTXOLabels map[string]string `json:"utxoLabels,omitempty"`
+	// a set of outpoints (txID:index) that are frozen, i.e. excluded from coin selection.
+	FrozenUTXOs map[string]bool `json:"frozenUTXOs,omitempty"`
 }
 
 // read deserializes the json files into notes. If the file does not exist yet, no error is
@@ -116,3 +120,58 @@ func (notes *Notes) TxNote(txID string) string {
 
 	return notes.data.TransactionNotes[txID]
 }
+
+// SetUTXOLabel stores a label for an unspent output, identified by its outpoint string
+// (txID:index). An empty label will result in the entry being deleted.
+func (notes *Notes) SetUTXOLabel(outPoint string, label string) error {
+	notes.dataMu.Lock()
+	defer notes.dataMu.Unlock()
+
+	if len(label) > maxNoteLen {
+		return errp.Newf("Length of label must be smaller than %d. Got %d", maxNoteLen, len(label))
+	}
+
+	if notes.data.UTXOLabels == nil {
+		notes.data.UTXOLabels = map[string]string{}
+	}
+	if label == "" {
+		delete(notes.data.UTXOLabels, outPoint)
+	} else {
+		notes.data.UTXOLabels[outPoint] = label
+	}
+	return write(notes.data, notes.filename)
+}
+
+// UTXOLabel fetches the label of an unspent output. Returns the empty string if no label was
+// found.
+func (notes *Notes) UTXOLabel(outPoint string) string {
+	notes.dataMu.RLock()
+	defer notes.dataMu.RUnlock()
+
+	return notes.data.UTXOLabels[outPoint]
+}
+
+// SetUTXOFrozen marks an unspent output as frozen or unfrozen. Frozen outputs are not spent unless
+// explicitly selected.
+func (notes *Notes) SetUTXOFrozen(outPoint string, frozen bool) error {
+	notes.dataMu.Lock()
+	defer notes.dataMu.Unlock()
+
+	if notes.data.FrozenUTXOs == nil {
+		notes.data.FrozenUTXOs = map[string]bool{}
+	}
+	if frozen {
+		notes.data.FrozenUTXOs[outPoint] = true
+	} else {
+		delete(notes.data.FrozenUTXOs, outPoint)
+	}
+	return write(notes.data, notes.filename)
+}
+
+// UTXOFrozen returns true if the unspent output was marked as frozen.
+func (notes *Notes) UTXOFrozen(outPoint string) bool {
+	notes.dataMu.RLock()
+	defer notes.dataMu.RUnlock()
+
+	return notes.data.FrozenUTXOs[outPoint]
+}
@@ -68,3 +68,44 @@ func TestMaxLen(t *testing.T) {
 	require.NoError(t, notes.SetTxNote("tx-id", strings.Repeat("x", 1024)))
 	require.Error(t, notes.SetTxNote("tx-id", strings.Repeat("x", 1025)))
 }
+
+func TestUTXOLabels(t *testing.T) {
+	filename := test.TstTempFile("account-notes")
+	notes, err := LoadNotes(filename)
+	require.NoError(t, err)
+
+	const outPoint = "tx-id-1:0"
+	require.Equal(t, "", notes.UTXOLabel(outPoint))
+	require.NoError(t, notes.SetUTXOLabel(outPoint, "KYC"))
+	require.Equal(t, "KYC", notes.UTXOLabel(outPoint))
+	require.Equal(t, "", notes.UTXOLabel("tx-id-1:1"))
+	require.Error(t, notes.SetUTXOLabel(outPoint, strings.Repeat("x", 1025)))
+
+	// Reload notes.
+	notes, err = LoadNotes(filename)
+	require.NoError(t, err)
+	require.Equal(t, "KYC", notes.UTXOLabel(outPoint))
+
+	require.NoError(t, notes.SetUTXOLabel(outPoint, ""))
+	require.Equal(t, "", notes.UTXOLabel(outPoint))
+}
+
+func TestFrozenUTXOs(t *testing.T) {
+	filename := test.TstTempFile("account-notes")
+	notes, err := LoadNotes(filename)
+	require.NoError(t, err)
+
+	const outPoint = "tx-id-1:0"
+	require.False(t, notes.UTXOFrozen(outPoint))
+	require.NoError(t, notes.SetUTXOFrozen(outPoint, true))
+	require.True(t, notes.UTXOFrozen(outPoint))
+	require.False(t, notes.UTXOFrozen("tx-id-1:1"))
+
+	// Reload notes.
+	notes, err = LoadNotes(filename)
+	require.NoError(t, err)
+	require.True(t, notes.UTXOFrozen(outPoint))
+
+	require.NoError(t, notes.SetUTXOFrozen(outPoint, false))
+	require.False(t, notes.UTXOFrozen(outPoint))
+}
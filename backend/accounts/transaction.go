@@ -58,6 +58,9 @@ type AddressAndAmount struct {
 	Amount coin.Amount
 	// Ours is true if the address is one of our receive addresses.
 	Ours bool
+	// Name is a verified human readable name of the address, e.g. its ENS name. Empty if there is
+	// none.
+	Name string
 }
 
 // TransactionData holds transaction data to be shown to the user. It is as coin-agnostic as
@@ -16,6 +16,8 @@ package backend
 
 import (
 	"errors"
+	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/btcsuite/btcd/chaincfg"
@@ -27,12 +29,16 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/watchonly"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -214,6 +220,8 @@ func newBackend(t *testing.T, testing, regtest bool) *Backend {
 	)
 	b.ratesUpdater.SetCoingeckoURL("unused") // avoid hitting real API
 	require.NoError(t, err)
+	// Avoid hitting the network with the account discovery. Tests can enable it by setting it.
+	b.checkAccountHistory = nil
 	return b
 }
 
@@ -235,7 +243,7 @@ func TestSupportedCoins(t *testing.T) {
 		b := newBackend(t, testnetEnabled, regtestDisabled)
 		defer b.Close()
 		require.Equal(t,
-			[]coinpkg.Code{coinpkg.CodeTBTC, coinpkg.CodeTLTC, coinpkg.CodeTETH, coinpkg.CodeRETH},
+			[]coinpkg.Code{coinpkg.CodeTBTC, coinpkg.CodeSBTC, coinpkg.CodeTLTC, coinpkg.CodeTETH, coinpkg.CodeRETH},
 			b.SupportedCoins(&keystoremock.KeystoreMock{
 				SupportsCoinFunc: func(coin coinpkg.Coin) bool {
 					return true
@@ -300,7 +308,7 @@ func TestCreateAndPersistAccountConfig(t *testing.T) {
 			switch coin.(type) {
 			case *btc.Coin:
 				scriptType := meta.(signing.ScriptType)
-				return scriptType != signing.ScriptTypeP2PKH
+				return scriptType != signing.ScriptTypeP2PKH && scriptType != signing.ScriptTypeP2TR
 			default:
 				return true
 			}
@@ -314,6 +322,25 @@ func TestCreateAndPersistAccountConfig(t *testing.T) {
 		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
 	}
 
+	// A keystore with a similar config to the software keystore - supporting unified and multiple
+	// accounts and all script types, including taproot.
+	softwareLikeKeystore := &keystoremock.KeystoreMock{
+		RootFingerprintFunc: func() ([]byte, error) {
+			return fingerprint, nil
+		},
+		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
+			_, ok := coin.(*btc.Coin)
+			return ok
+		},
+		SupportsMultipleAccountsFunc: func() bool {
+			return true
+		},
+		SupportsUnifiedAccountsFunc: func() bool {
+			return true
+		},
+		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
+	}
+
 	// A keystore with a similar config to a BitBox01 - supports legacy P2PKH, but no unified
 	// accounts or multiple accounts. Ethereum is also not supported.
 	bitbox01LikeKeystore := &keystoremock.KeystoreMock{
@@ -323,7 +350,7 @@ func TestCreateAndPersistAccountConfig(t *testing.T) {
 		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
 			switch coin.(type) {
 			case *btc.Coin:
-				return true
+				return meta.(signing.ScriptType) != signing.ScriptTypeP2TR
 			default:
 				return false
 			}
@@ -468,6 +495,43 @@ func TestCreateAndPersistAccountConfig(t *testing.T) {
 		)
 	})
 
+	// Add a Bitcoin account including a taproot subaccount.
+	t.Run("softwareLike", func(t *testing.T) {
+		b := newBackend(t, testnetDisabled, regtestDisabled)
+		defer b.Close()
+
+		acctCode, err := b.CreateAndPersistAccountConfig(
+			coinpkg.CodeBTC,
+			"bitcoin 1",
+			softwareLikeKeystore,
+		)
+		require.NoError(t, err)
+		require.Equal(t, "v0-55555555-btc-0", string(acctCode))
+		require.Equal(t,
+			&config.Account{
+				CoinCode: "btc",
+				Name:     "bitcoin 1",
+				Code:     "v0-55555555-btc-0",
+				Configurations: signing.Configurations{
+					signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKH, fingerprint, mustKeypath("m/84'/0'/0'"), mustXKey("xpub6Cxa67Bfe1Aw5VvLM1Ppua9x28CXH1zUYoAuBzFRjR6hWnA6aUcny84KYkeVcZWnWXxKSkxCEyMA8xic54ydBPWm5oziXpsXq6nX8FELMQn")),
+					signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKHP2SH, fingerprint, mustKeypath("m/49'/0'/0'"), mustXKey("xpub6CUmEcJb7juvnw7fFYybCwvCJuPSEdhTWZCep9X1DBznwB8RRKTYBUidbEPJ9L7ExjrXhem9S759cX3BpzSUSoP2rWh9vqumJ9MPSAbi98F")),
+					signing.NewBitcoinConfiguration(signing.ScriptTypeP2PKH, fingerprint, mustKeypath("m/44'/0'/0'"), mustXKey("xpub6D7KuxJsw7N2LtWPQKy6Tqs8vFyKudiDqcx6mtsFXT6FDb8oLcUYRjf7G4Qx8CK4DAQ4kN98n7uDCKmazxaHYLNjwDbJ1nKmDm6QEQCwkGC")),
+					signing.NewBitcoinConfiguration(signing.ScriptTypeP2TR, fingerprint, mustKeypath("m/86'/0'/0'"), mustXKey("xpub6CC9Tsi4eJvmRsGuXwKBfHDWUWN66voNeZFmXRJhYZS6yYgXKZmtz5qnxK9WL2FZP8uF3abyFZ29d7RfMks4FjCCu4LMh3edyeCoyEFuZLZ")),
+				},
+			},
+			b.Config().AccountsConfig().Lookup("v0-55555555-btc-0"),
+		)
+
+		// No taproot for Litecoin.
+		acctCode, err = b.CreateAndPersistAccountConfig(
+			coinpkg.CodeLTC,
+			"litecoin 1",
+			softwareLikeKeystore,
+		)
+		require.NoError(t, err)
+		require.Len(t, b.Config().AccountsConfig().Lookup(acctCode).Configurations, 2)
+	})
+
 	// Add a few accounts with BB01.
 	t.Run("bitbox01Like", func(t *testing.T) {
 		b := newBackend(t, testnetDisabled, regtestDisabled)
@@ -627,7 +691,7 @@ func TestCreateAndAddAccount(t *testing.T) {
 	// Add a Bitcoin account.
 	coin, err := b.Coin(coinpkg.CodeBTC)
 	require.NoError(t, err)
-	b.createAndAddAccount(coin, "test-btc-account-code", "Bitcoin account name",
+	b.createAndAddAccount(nil, coin, "test-btc-account-code", "Bitcoin account name",
 		signing.Configurations{
 			signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKH, fingerprint, mustKeypath("m/84'/0'/0'"), mustXKey("xpub6Cxa67Bfe1Aw5VvLM1Ppua9x28CXH1zUYoAuBzFRjR6hWnA6aUcny84KYkeVcZWnWXxKSkxCEyMA8xic54ydBPWm5oziXpsXq6nX8FELMQn")),
 		},
@@ -646,7 +710,7 @@ func TestCreateAndAddAccount(t *testing.T) {
 	// Add a Litecoin account.
 	coin, err = b.Coin(coinpkg.CodeLTC)
 	require.NoError(t, err)
-	b.createAndAddAccount(coin, "test-ltc-account-code", "Litecoin account name",
+	b.createAndAddAccount(nil, coin, "test-ltc-account-code", "Litecoin account name",
 		signing.Configurations{
 			signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKH, fingerprint, mustKeypath("m/84'/2'/0'"), mustXKey("xpub6DReBHtKxgeZGBKTaaF1GjeBHa8dZwQpRfgYr3kxt782s8KKqio2pR6piBsiqHEPF7Rg3onMkwt9XrSxNTuW4N1VBjVbn6DQ3GPCBEUgtgP")),
 		},
@@ -665,7 +729,7 @@ func TestCreateAndAddAccount(t *testing.T) {
 	// Add an Ethereum account with some active ERC20 tokens..
 	coin, err = b.Coin(coinpkg.CodeETH)
 	require.NoError(t, err)
-	b.createAndAddAccount(coin, "test-eth-account-code", "Ethereum account name",
+	b.createAndAddAccount(nil, coin, "test-eth-account-code", "Ethereum account name",
 		signing.Configurations{
 			signing.NewEthereumConfiguration(fingerprint, mustKeypath("m/44'/60'/0'/0/0"), mustXKey("xpub6GP83vJASH1kS7dQPWXFjVHDfYajopbG8U3j8peBH67CRCnb8QmDxZJfWpbgCQNHAzCDJ4MyVYjoh7Yv9yo7PQuZ9YyktgrtD9vmeo67Y4E")),
 		},
@@ -692,7 +756,7 @@ func TestCreateAndAddAccount(t *testing.T) {
 	// Add another Ethereum account with some active ERC20 tokens.
 	coin, err = b.Coin(coinpkg.CodeETH)
 	require.NoError(t, err)
-	b.createAndAddAccount(coin, "test-eth-account-code-2", "Ethereum account name 2",
+	b.createAndAddAccount(nil, coin, "test-eth-account-code-2", "Ethereum account name 2",
 		signing.Configurations{
 			signing.NewEthereumConfiguration(fingerprint, mustKeypath("m/44'/60'/0'/0/1"), mustXKey("xpub6GP83vJASH1kUpndXSe3e942omyTYSPKaav6shfic7Lc3rFJR9ctA3AXaTf7rX7PuSZNUnaqj4hiqgnRXr26jitBz4jLhmFURtVxDykHbQm")),
 		},
@@ -886,3 +950,271 @@ func TestInactiveAccount(t *testing.T) {
 	require.Len(t, b.Accounts(), 5)
 	require.Len(t, b.Config().AccountsConfig().Accounts, 3)
 }
+
+func TestAddCustomERC20Token(t *testing.T) {
+	// From mnemonic: wisdom minute home employ west tail liquid mad deal catalog narrow mistake
+	rootKey := mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB")
+	keystoreHelper := software.NewKeystore(rootKey)
+	fingerprint := []byte{0x55, 0x055, 0x55, 0x55}
+
+	ks := &keystoremock.KeystoreMock{
+		RootFingerprintFunc: func() ([]byte, error) {
+			return fingerprint, nil
+		},
+		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
+			return true
+		},
+		SupportsMultipleAccountsFunc: func() bool {
+			return true
+		},
+		SupportsUnifiedAccountsFunc: func() bool {
+			return true
+		},
+		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
+	}
+
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+	b.registerKeystore(ks)
+	require.Len(t, b.Accounts(), 3)
+
+	_, err := b.AddCustomERC20Token("v0-55555555-eth-0", "0x1234")
+	require.Error(t, err)
+
+	// Builtin tokens are activated instead of added.
+	tokenCode, err := b.AddCustomERC20Token("v0-55555555-eth-0", "0xDAC17F958D2EE523A2206206994597C13D831EC7")
+	require.NoError(t, err)
+	require.Equal(t, "eth-erc20-usdt", tokenCode)
+	require.Empty(t, b.Config().AccountsConfig().Lookup("v0-55555555-eth-0").CustomTokens)
+	require.NotNil(t, lookup(b.Accounts(), "v0-55555555-eth-0-eth-erc20-usdt"))
+
+	contractAddress := common.HexToAddress("0x1f9840a85d5af5bf1d1762f925bdaddc4201f984")
+	// Symbols of builtin coins and tokens are rejected.
+	for _, symbol := range []string{"ETH", "usdt"} {
+		_, err = b.addCustomERC20Token("v0-55555555-eth-0", contractAddress,
+			&erc20.TokenInfo{Name: "Fake", Symbol: symbol, Decimals: 6})
+		require.Error(t, err)
+	}
+	require.Empty(t, b.Config().AccountsConfig().Lookup("v0-55555555-eth-0").CustomTokens)
+
+	tokenInfo := &erc20.TokenInfo{Name: "Uniswap", Symbol: "UNI", Decimals: 18}
+	_, err = b.addCustomERC20Token("v0-55555555-btc-0", contractAddress, tokenInfo)
+	require.Error(t, err)
+	tokenCode, err = b.addCustomERC20Token("v0-55555555-eth-0", contractAddress, tokenInfo)
+	require.NoError(t, err)
+	require.Equal(t, "eth-erc20-0x1f9840a85d5af5bf1d1762f925bdaddc4201f984", tokenCode)
+	require.Equal(t,
+		[]string{"eth-erc20-usdt", tokenCode},
+		b.Config().AccountsConfig().Lookup("v0-55555555-eth-0").ActiveTokens,
+	)
+	require.Len(t, b.Accounts(), 5)
+	tokenAccount := lookup(b.Accounts(), Erc20AccountCode("v0-55555555-eth-0", tokenCode))
+	require.NotNil(t, tokenAccount)
+	require.Equal(t, "Uniswap", tokenAccount.Coin().Name())
+	require.Equal(t, "UNI", tokenAccount.Coin().Unit(false))
+	erc20Token := tokenAccount.Coin().(*eth.Coin).ERC20Token()
+	require.Equal(t, contractAddress, erc20Token.ContractAddress())
+	require.Equal(t, uint(18), erc20Token.Decimals())
+}
+
+func TestEVMNetwork(t *testing.T) {
+	// From mnemonic: wisdom minute home employ west tail liquid mad deal catalog narrow mistake
+	rootKey := mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB")
+	keystoreHelper := software.NewKeystore(rootKey)
+	fingerprint := []byte{0x55, 0x055, 0x55, 0x55}
+
+	ks := &keystoremock.KeystoreMock{
+		RootFingerprintFunc: func() ([]byte, error) {
+			return fingerprint, nil
+		},
+		SupportsCoinFunc: func(coin coinpkg.Coin) bool {
+			return true
+		},
+		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
+			return true
+		},
+		SupportsMultipleAccountsFunc: func() bool {
+			return true
+		},
+		SupportsUnifiedAccountsFunc: func() bool {
+			return true
+		},
+		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
+	}
+
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	appConfig := b.Config().AppConfig()
+	appConfig.Backend.EVMNetworks = []config.EVMNetwork{
+		{
+			Code:                  "matic",
+			Name:                  "Polygon",
+			Unit:                  "MATIC",
+			ChainID:               137,
+			BlockExplorerTxPrefix: "https://polygonscan.com/tx/",
+			EtherScanURL:          "https://api.polygonscan.com/api",
+		},
+		// Collides with a builtin coin and is ignored.
+		{
+			Code:         "eth",
+			Name:         "Not Ethereum",
+			ChainID:      1234,
+			EtherScanURL: "https://example.com/api",
+		},
+		// Neither EtherScan nor a node configured.
+		{
+			Code:    "nothing",
+			ChainID: 4321,
+		},
+	}
+	require.NoError(t, b.Config().SetAppConfig(appConfig))
+
+	maticCoin, err := b.Coin("matic")
+	require.NoError(t, err)
+	require.Equal(t, "Polygon", maticCoin.Name())
+	require.Equal(t, "MATIC", maticCoin.Unit(false))
+	require.Equal(t, "MATIC", maticCoin.Unit(true))
+	require.Equal(t, "https://polygonscan.com/tx/", maticCoin.BlockExplorerTransactionURLPrefix())
+	require.Equal(t, big.NewInt(137), maticCoin.(*eth.Coin).Net().ChainID)
+	require.True(t, maticCoin.(*eth.Coin).Net().IsEIP155(big.NewInt(0)))
+
+	ethCoin, err := b.Coin(coinpkg.CodeETH)
+	require.NoError(t, err)
+	require.Equal(t, "Ethereum", ethCoin.Name())
+
+	_, err = b.Coin("nothing")
+	require.Error(t, err)
+
+	require.Equal(t,
+		[]coinpkg.Code{coinpkg.CodeBTC, coinpkg.CodeLTC, coinpkg.CodeETH, "matic"},
+		b.SupportedCoins(ks),
+	)
+
+	b.registerKeystore(ks)
+	require.Len(t, b.Accounts(), 3)
+	acctCode, err := b.CreateAndPersistAccountConfig("matic", "", ks)
+	require.NoError(t, err)
+	require.Equal(t, accounts.Code("v0-55555555-matic-0"), acctCode)
+	require.Len(t, b.Accounts(), 4)
+	require.Equal(t, "Polygon", lookup(b.Accounts(), acctCode).Config().Name)
+	persistedAccount := b.Config().AccountsConfig().Lookup(acctCode)
+	require.NotNil(t, persistedAccount)
+	require.Equal(t,
+		"m/44'/60'/0'/0/0",
+		persistedAccount.Configurations[0].AbsoluteKeypath().Encode(),
+	)
+}
+
+func TestWatchOnlyAccount(t *testing.T) {
+	// BIP84 test vector account xpub.
+	zpub := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	_, err := b.AddWatchOnlyAccount(coinpkg.CodeETH, "", zpub, "")
+	require.Error(t, err)
+	_, err = b.AddWatchOnlyAccount(coinpkg.CodeBTC, "", zpub, signing.ScriptTypeP2PKH)
+	require.Error(t, err)
+	// A testnet key is rejected for a mainnet coin.
+	tpub := mustXKey(zpub)
+	tpub.SetNet(&chaincfg.TestNet3Params)
+	_, err = b.AddWatchOnlyAccount(coinpkg.CodeBTC, "", tpub.String(), signing.ScriptTypeP2WPKH)
+	require.Error(t, err)
+
+	// No keystore is registered, but the watch-only account is loaded.
+	accountCode, err := b.AddWatchOnlyAccount(coinpkg.CodeBTC, "", zpub, "")
+	require.NoError(t, err)
+	require.Nil(t, b.Keystore())
+	require.Len(t, b.Accounts(), 1)
+	persistedAccount := b.Config().AccountsConfig().Lookup(accountCode)
+	require.NotNil(t, persistedAccount)
+	require.True(t, persistedAccount.WatchOnly)
+	require.Equal(t, "Bitcoin (watch-only)", persistedAccount.Name)
+	require.Equal(t, signing.ScriptTypeP2WPKH, persistedAccount.Configurations[0].ScriptType())
+	acct := lookup(b.Accounts(), accountCode)
+	require.NotNil(t, acct)
+	require.Equal(t, keystore.TypeWatchOnly, acct.Config().Keystore.Type())
+	require.Equal(t, watchonly.ErrWatchOnly, errp.Cause(acct.Config().Keystore.SignTransaction(nil)))
+
+	// Adding the same key again fails.
+	_, err = b.AddWatchOnlyAccount(coinpkg.CodeBTC, "other name", zpub, "")
+	require.Equal(t, ErrAccountAlreadyExists, errp.Cause(err))
+	// The account is identified by the key, not by the root fingerprint of its origin.
+	_, err = b.AddWatchOnlyAccount(coinpkg.CodeBTC, "", "[73c5da0a/84'/0'/0']"+zpub, "")
+	require.Equal(t, ErrAccountAlreadyExists, errp.Cause(err))
+
+	// Registering and deregistering a keystore keeps the watch-only account loaded.
+	rootKey := mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB")
+	b.registerKeystore(software.NewKeystore(rootKey))
+	require.NotNil(t, lookup(b.Accounts(), accountCode))
+	b.DeregisterKeystore()
+	require.Len(t, b.Accounts(), 1)
+	require.NotNil(t, lookup(b.Accounts(), accountCode))
+}
+
+func TestMultisigAccount(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	ks := software.NewKeystore(mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB"))
+	cosignerKeystore := software.NewKeystore(mustXKey("xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U"))
+	cosignerFingerprint, err := cosignerKeystore.RootFingerprint()
+	require.NoError(t, err)
+	cosignerKeypath := mustKeypath("m/48'/0'/0'/2'")
+	cosignerXPub, err := cosignerKeystore.ExtendedPublicKey(nil, cosignerKeypath)
+	require.NoError(t, err)
+	cosigner := fmt.Sprintf("[%x/48h/0h/0h/2h]%s", cosignerFingerprint, cosignerXPub)
+
+	rootFingerprint, err := ks.RootFingerprint()
+	require.NoError(t, err)
+
+	b.registerKeystore(ks)
+	numAccounts := len(b.Config().AccountsConfig().Accounts)
+
+	_, err = b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeLTC, "", 1, []string{cosigner}, ks)
+	require.Error(t, err)
+	_, err = b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeBTC, "", 3, []string{cosigner}, ks)
+	require.Error(t, err)
+	_, err = b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeBTC, "", 1, []string{"[1234]" + cosignerXPub.String()}, ks)
+	require.Error(t, err)
+	// The key origin of the cosigner is required.
+	_, err = b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeBTC, "", 1, []string{cosignerXPub.String()}, ks)
+	require.Error(t, err)
+
+	accountCode, err := b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeBTC, "", 2, []string{cosigner}, ks)
+	require.NoError(t, err)
+	require.Equal(t, accounts.Code(fmt.Sprintf("v0-%x-btc-multisig-0", rootFingerprint)), accountCode)
+	require.Len(t, b.Config().AccountsConfig().Accounts, numAccounts+1)
+	persistedAccount := b.Config().AccountsConfig().Lookup(accountCode)
+	require.NotNil(t, persistedAccount)
+	require.Equal(t, "Bitcoin 2-of-2 multisig", persistedAccount.Name)
+	require.Len(t, persistedAccount.Configurations, 1)
+	configuration := persistedAccount.Configurations[0]
+	require.True(t, configuration.IsMultisig())
+	require.Equal(t, signing.ScriptTypeP2WSH, configuration.ScriptType())
+	require.Equal(t, uint32(2), configuration.BitcoinMultisig.Threshold)
+	require.Equal(t, "m/48'/0'/0'/2'", configuration.KeyInfo(rootFingerprint).AbsoluteKeypath.Encode())
+	cosignerKeyInfo := configuration.KeyInfo(cosignerFingerprint)
+	require.NotNil(t, cosignerKeyInfo)
+	require.Equal(t, cosignerKeypath, cosignerKeyInfo.AbsoluteKeypath)
+	require.Equal(t, cosignerXPub.String(), cosignerKeyInfo.ExtendedPublicKey.String())
+	require.NotNil(t, lookup(b.Accounts(), accountCode))
+
+	// The regular accounts are not affected by the multisig account numbering.
+	_, ok := b.CanAddAccount(coinpkg.CodeBTC, ks)
+	require.True(t, ok)
+
+	// The next multisig account uses the next BIP48 account number.
+	accountCode, err = b.CreateAndPersistMultisigAccountConfig(coinpkg.CodeBTC, "", 1, []string{cosigner}, ks)
+	require.NoError(t, err)
+	require.Equal(t, accounts.Code(fmt.Sprintf("v0-%x-btc-multisig-1", rootFingerprint)), accountCode)
+	persistedAccount = b.Config().AccountsConfig().Lookup(accountCode)
+	require.Equal(t, "Bitcoin 1-of-2 multisig 2", persistedAccount.Name)
+
+	// The multisig accounts are loaded when the cosigner keystore is connected.
+	b.DeregisterKeystore()
+	b.registerKeystore(cosignerKeystore)
+	require.NotNil(t, lookup(b.Accounts(), accountCode))
+}
@@ -16,14 +16,18 @@ package backend
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
 	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
@@ -137,6 +141,14 @@ func (backend *Backend) aoppSetError(err ErrorCode) {
 	backend.notifyAOPP()
 }
 
+// aoppCanSignBIP322 returns true if the keystore can sign the requested message using BIP-322
+// instead of the legacy message signing format. This is only done for p2wpkh addresses.
+func (backend *Backend) aoppCanSignBIP322() bool {
+	return backend.aopp.coinCode == coinpkg.CodeBTC &&
+		(backend.aopp.format == "p2wpkh" || backend.aopp.format == "any") &&
+		backend.keystore.CanSignBIP322Message(backend.aopp.coinCode)
+}
+
 // aoppKeystoreRegistered must be called after a keystore is available, to display a list of
 // accounts to choose from. It is called when a keystore is registered, or right away in
 // `handleAOPP()` if a keystore is already registered. `accountsAndKeystoreLock` must be held when
@@ -145,10 +157,14 @@ func (backend *Backend) aoppKeystoreRegistered() {
 	if backend.aopp.State != aoppStateAwaitingKeystore {
 		return
 	}
-	if !backend.keystore.CanSignMessage(backend.aopp.coinCode) {
+	if !backend.keystore.CanSignMessage(backend.aopp.coinCode) && !backend.aoppCanSignBIP322() {
 		backend.aoppSetError(errAOPPUnsupportedKeystore)
 		return
 	}
+	if backend.aopp.format == "any" && !backend.keystore.CanSignMessage(backend.aopp.coinCode) {
+		// Only p2wpkh addresses can be signed using BIP-322.
+		backend.aopp.format = "p2wpkh"
+	}
 	var accounts []account
 	var filteredDueToScriptType bool
 	for _, acct := range backend.accounts {
@@ -321,12 +337,32 @@ func (backend *Backend) aoppChooseAccount(code accounts.Code) {
 	backend.notifyAOPP()
 
 	var signature []byte
-	switch account.Coin().Code() {
-	case coinpkg.CodeBTC:
+	scriptType := account.Config().SigningConfigurations[signingConfigIdx].ScriptType()
+	btcAccount, isBTCAccount := account.(*btc.Account)
+	switch {
+	case isBTCAccount && scriptType == signing.ScriptTypeP2WPKH && btcAccount.CanSignMessageBIP322():
+		sig, err := btcAccount.SignMessageBIP322(addr.ID(), []byte(backend.aopp.Message))
+		if err != nil {
+			if errp.Cause(err) == keystore.ErrSigningAborted {
+				log.WithError(err).Error("user aborted msg signing")
+				backend.aoppSetError(errAOPPSigningAborted)
+				return
+			}
+			log.WithError(err).Error("signing error")
+			backend.aoppSetError(errAOPPUnknown)
+			return
+		}
+		signature, err = base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			log.WithError(err).Error("signing error")
+			backend.aoppSetError(errAOPPUnknown)
+			return
+		}
+	case account.Coin().Code() == coinpkg.CodeBTC:
 		sig, err := backend.keystore.SignBTCMessage(
 			[]byte(backend.aopp.Message),
 			addr.AbsoluteKeypath(),
-			account.Config().SigningConfigurations[signingConfigIdx].ScriptType(),
+			scriptType,
 		)
 		if err != nil {
 			if firmware.IsErrorAbort(err) {
@@ -339,7 +375,7 @@ func (backend *Backend) aoppChooseAccount(code accounts.Code) {
 			return
 		}
 		signature = sig
-	case coinpkg.CodeETH:
+	case account.Coin().Code() == coinpkg.CodeETH:
 		sig, err := backend.keystore.SignETHMessage(
 			[]byte(backend.aopp.Message),
 			addr.AbsoluteKeypath(),
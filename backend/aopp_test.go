@@ -69,6 +69,9 @@ func TestAOPPSuccess(t *testing.T) {
 		SupportsMultipleAccountsFunc: func() bool {
 			return true
 		},
+		CanSignBIP322MessageFunc: func(coinpkg.Code) bool {
+			return false
+		},
 		CanSignMessageFunc: func(coinpkg.Code) bool {
 			return true
 		},
@@ -309,6 +312,9 @@ func TestAOPPFailures(t *testing.T) {
 		SupportsMultipleAccountsFunc: func() bool {
 			return true
 		},
+		CanSignBIP322MessageFunc: func(coinpkg.Code) bool {
+			return false
+		},
 		CanSignMessageFunc: func(coinpkg.Code) bool {
 			return true
 		},
@@ -16,6 +16,8 @@
 package backend
 
 import (
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
@@ -28,11 +30,17 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/arguments"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/banners"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bitcoind"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/cfilters"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	ethdb "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/db"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/etherscan"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/nodesource"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/devices/bitbox"
@@ -42,6 +50,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/rates"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	utilConfig "github.com/digitalbitbox/bitbox-wallet-app/util/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
@@ -156,14 +165,23 @@ type Backend struct {
 	accounts []accounts.Interface
 	keystore keystore.Keystore
 	aopp     AOPP
+	// walletConnect is the state of the dapp connections, see walletconnect.go.
+	walletConnect walletConnect
+	// accountDiscovery is the state of the account discovery, see accountdiscovery.go.
+	accountDiscovery AccountDiscovery
+	// checkAccountHistory is used by the account discovery. Defaults to accountHasHistory() and
+	// can be replaced in unit tests. If nil, the account discovery is disabled.
+	checkAccountHistory func(coinpkg.Coin, signing.Configurations) (bool, error)
 
 	onAccountInit   func(accounts.Interface)
 	onAccountUninit func(accounts.Interface)
 	onDeviceInit    func(device.Interface)
 	onDeviceUninit  func(string)
 
-	coins     map[coinpkg.Code]coinpkg.Coin
-	coinsLock locker.Locker
+	coins map[coinpkg.Code]coinpkg.Coin
+	// customERC20Tokens are the user-defined tokens of all persisted accounts, by token code.
+	customERC20Tokens map[coinpkg.Code]*erc20Token
+	coinsLock         locker.Locker
 
 	log *logrus.Entry
 
@@ -195,7 +213,10 @@ func NewBackend(arguments *arguments.Arguments, environment Environment) (*Backe
 		accounts: []accounts.Interface{},
 		aopp:     AOPP{State: aoppStateInactive},
 		log:      log,
+
+		walletConnect: newWalletConnect(),
 	}
+	backend.checkAccountHistory = backend.accountHasHistory
 	notifier, err := NewNotifier(filepath.Join(arguments.MainDirectoryPath(), "notifier.db"))
 	if err != nil {
 		return nil, err
@@ -279,6 +300,8 @@ func (backend *Backend) defaultProdServers(code coinpkg.Code) []*config.ServerIn
 		return backend.config.AppConfig().Backend.TBTC.ElectrumServers
 	case coinpkg.CodeRBTC:
 		return backend.config.AppConfig().Backend.RBTC.ElectrumServers
+	case coinpkg.CodeSBTC:
+		return backend.config.AppConfig().Backend.SBTC.ElectrumServers
 	case coinpkg.CodeLTC:
 		return backend.config.AppConfig().Backend.LTC.ElectrumServers
 	case coinpkg.CodeTLTC:
@@ -313,6 +336,8 @@ mCMuGBNHsbrs6rI1hbI4Qq6GYazLaDRqdCufTA==
 		}
 	case coinpkg.CodeRBTC:
 		return []*config.ServerInfo{{Server: "127.0.0.1:52001", TLS: false, PEMCert: ""}}
+	case coinpkg.CodeSBTC:
+		return []*config.ServerInfo{{Server: "127.0.0.1:60601", TLS: false, PEMCert: ""}}
 	case coinpkg.CodeLTC:
 		return []*config.ServerInfo{{Server: "ltc1.shiftcrypto.dev:50011", TLS: true, PEMCert: devShiftCA}}
 	case coinpkg.CodeTLTC:
@@ -337,61 +362,89 @@ func (backend *Backend) Coin(code coinpkg.Code) (coinpkg.Coin, error) {
 	if ok {
 		return coin, nil
 	}
-	dbFolder := backend.arguments.CacheDirectoryPath()
 
 	erc20Token := erc20TokenByCode(code)
+	if erc20Token == nil {
+		erc20Token = backend.customERC20Tokens[code]
+	}
+	backendConfig := backend.config.AppConfig().Backend
+	evmNetwork := backendConfig.EVMNetwork(code)
 	switch {
 	case code == coinpkg.CodeRBTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeRBTC, "Bitcoin Regtest", "RBTC", &chaincfg.RegressionNetParams, dbFolder, servers, "", backend.socksProxy)
+		coin = backend.btcCoin(coinpkg.CodeRBTC, "Bitcoin Regtest", "RBTC", &chaincfg.RegressionNetParams, "")
+	case code == coinpkg.CodeSBTC:
+		coin = backend.btcCoin(coinpkg.CodeSBTC, "Bitcoin Signet", "SBTC", &chaincfg.SigNetParams,
+			"https://mempool.space/signet/tx/")
 	case code == coinpkg.CodeTBTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", &chaincfg.TestNet3Params, dbFolder, servers,
-			"https://blockstream.info/testnet/tx/", backend.socksProxy)
+		coin = backend.btcCoin(coinpkg.CodeTBTC, "Bitcoin Testnet", "TBTC", &chaincfg.TestNet3Params,
+			"https://blockstream.info/testnet/tx/")
 	case code == coinpkg.CodeBTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeBTC, "Bitcoin", "BTC", &chaincfg.MainNetParams, dbFolder, servers,
-			"https://blockstream.info/tx/", backend.socksProxy)
+		coin = backend.btcCoin(coinpkg.CodeBTC, "Bitcoin", "BTC", &chaincfg.MainNetParams,
+			"https://blockstream.info/tx/")
 	case code == coinpkg.CodeTLTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeTLTC, "Litecoin Testnet", "TLTC", &ltc.TestNet4Params, dbFolder, servers,
-			"http://explorer.litecointools.com/tx/", backend.socksProxy)
+		coin = backend.btcCoin(coinpkg.CodeTLTC, "Litecoin Testnet", "TLTC", &ltc.TestNet4Params,
+			"http://explorer.litecointools.com/tx/")
 	case code == coinpkg.CodeLTC:
-		servers := backend.defaultElectrumXServers(code)
-		coin = btc.NewCoin(coinpkg.CodeLTC, "Litecoin", "LTC", &ltc.MainNetParams, dbFolder, servers,
-			"https://insight.litecore.io/tx/", backend.socksProxy)
+		coin = backend.btcCoin(coinpkg.CodeLTC, "Litecoin", "LTC", &ltc.MainNetParams,
+			"https://insight.litecore.io/tx/")
 	case code == coinpkg.CodeETH:
-		etherScan := etherscan.NewEtherScan("https://api.etherscan.io/api", backend.etherScanHTTPClient)
-		coin = eth.NewCoin(etherScan, code, "Ethereum", "ETH", "ETH", params.MainnetChainConfig,
+		client, transactionsSource, err := backend.ethClient(code, "https://api.etherscan.io/api", backendConfig.ETH.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, code, "Ethereum", "ETH", "ETH", params.MainnetChainConfig,
 			"https://etherscan.io/tx/",
-			etherScan,
+			transactionsSource,
 			nil)
 	case code == coinpkg.CodeRETH:
-		etherScan := etherscan.NewEtherScan("https://api-rinkeby.etherscan.io/api", backend.etherScanHTTPClient)
-		coin = eth.NewCoin(etherScan, code, "Ethereum Rinkeby", "RETH", "RETH", params.RinkebyChainConfig,
+		client, transactionsSource, err := backend.ethClient(code, "https://api-rinkeby.etherscan.io/api", backendConfig.RETH.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, code, "Ethereum Rinkeby", "RETH", "RETH", params.RinkebyChainConfig,
 			"https://rinkeby.etherscan.io/tx/",
-			etherScan,
+			transactionsSource,
 			nil)
 	case code == coinpkg.CodeTETH:
-		etherScan := etherscan.NewEtherScan("https://api-ropsten.etherscan.io/api", backend.etherScanHTTPClient)
-		coin = eth.NewCoin(etherScan, code, "Ethereum Ropsten", "TETH", "TETH", params.TestnetChainConfig,
+		client, transactionsSource, err := backend.ethClient(code, "https://api-ropsten.etherscan.io/api", backendConfig.TETH.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, code, "Ethereum Ropsten", "TETH", "TETH", params.TestnetChainConfig,
 			"https://ropsten.etherscan.io/tx/",
-			etherScan,
+			transactionsSource,
 			nil)
 	case code == coinpkg.CodeERC20TEST:
-		etherScan := etherscan.NewEtherScan("https://api-ropsten.etherscan.io/api", backend.etherScanHTTPClient)
-		coin = eth.NewCoin(etherScan, code, "ERC20 TEST", "TEST", "TETH", params.TestnetChainConfig,
+		client, transactionsSource, err := backend.ethClient(code, "https://api-ropsten.etherscan.io/api", backendConfig.TETH.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, code, "ERC20 TEST", "TEST", "TETH", params.TestnetChainConfig,
 			"https://ropsten.etherscan.io/tx/",
-			etherScan,
+			transactionsSource,
 			erc20.NewToken("0x2f45b6fb2f28a73f110400386da31044b2e953d4", 18),
 		)
 	case erc20Token != nil:
-		etherScan := etherscan.NewEtherScan("https://api.etherscan.io/api", backend.etherScanHTTPClient)
-		coin = eth.NewCoin(etherScan, erc20Token.code, erc20Token.name, erc20Token.unit, "ETH", params.MainnetChainConfig,
+		client, transactionsSource, err := backend.ethClient(code, "https://api.etherscan.io/api", backendConfig.ETH.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, erc20Token.code, erc20Token.name, erc20Token.unit, "ETH", params.MainnetChainConfig,
 			"https://etherscan.io/tx/",
-			etherScan,
+			transactionsSource,
 			erc20Token.token,
 		)
+	case evmNetwork != nil:
+		client, transactionsSource, err := backend.ethClient(
+			code, evmNetwork.EtherScanURL, evmNetwork.ETHNodeConfig)
+		if err != nil {
+			return nil, err
+		}
+		coin = eth.NewCoin(client, code, evmNetwork.Name, evmNetwork.Unit, evmNetwork.Unit,
+			evmChainConfig(evmNetwork.ChainID),
+			evmNetwork.BlockExplorerTxPrefix,
+			transactionsSource,
+			nil)
 	default:
 		return nil, errp.Newf("unknown coin code %s", code)
 	}
@@ -400,6 +453,103 @@ func (backend *Backend) Coin(code coinpkg.Code) (coinpkg.Coin, error) {
 	return coin, nil
 }
 
+// btcCoin creates a Bitcoin based coin with its configured blockchain backend and headers snapshot.
+func (backend *Backend) btcCoin(
+	code coinpkg.Code, name string, unit string, net *chaincfg.Params, blockExplorerTxPrefix string) *btc.Coin {
+	coin := backend.newBTCCoin(code, name, unit, net, blockExplorerTxPrefix)
+	if snapshot := backend.config.AppConfig().Backend.HeadersSnapshot(code); snapshot != nil {
+		trustedKeys := [][]byte{}
+		for _, key := range snapshot.TrustedKeys {
+			keyBytes, err := hex.DecodeString(key)
+			if err != nil {
+				backend.log.WithError(err).Errorf("Invalid headers snapshot key %s", key)
+				continue
+			}
+			trustedKeys = append(trustedKeys, keyBytes)
+		}
+		coin.SetHeadersSnapshotFile(snapshot.File, trustedKeys)
+	}
+	return coin
+}
+
+// newBTCCoin creates a Bitcoin based coin, which connects to the Bitcoin Core node configured for
+// it, or to the Electrum servers otherwise. If compact filters are configured, the transactions are
+// found using the compact block filters of the configured P2P peers instead of the Electrum servers.
+// The answers of the Electrum servers are cross-checked against a second server if configured.
+func (backend *Backend) newBTCCoin(
+	code coinpkg.Code, name string, unit string, net *chaincfg.Params, blockExplorerTxPrefix string) *btc.Coin {
+	dbFolder := backend.arguments.CacheDirectoryPath()
+	if bitcoinCore := backend.config.AppConfig().Backend.BitcoinCore(code); bitcoinCore != nil {
+		return btc.NewCoinWithBlockchain(code, name, unit, net, dbFolder,
+			func(log *logrus.Entry) blockchain.Interface {
+				return bitcoind.NewClient(*bitcoinCore, backend.httpClient, log)
+			},
+			blockExplorerTxPrefix)
+	}
+	if compactFilters := backend.config.AppConfig().Backend.CompactFilters(code); compactFilters != nil {
+		return btc.NewCoinWithBlockchain(code, name, unit, net, dbFolder,
+			func(log *logrus.Entry) blockchain.Interface {
+				dialer := backend.socksProxy.GetTCPProxyDialer()
+				return cfilters.NewClient(
+					electrum.NewElectrumConnection(backend.defaultElectrumXServers(code), log, dialer),
+					*compactFilters, net, dialer, log)
+			},
+			blockExplorerTxPrefix)
+	}
+	if backend.config.AppConfig().Backend.CrossCheckElectrumServers(code) {
+		return btc.NewCoinWithBlockchain(code, name, unit, net, dbFolder,
+			func(log *logrus.Entry) blockchain.Interface {
+				return electrum.NewCrossCheckingElectrumConnection(
+					backend.defaultElectrumXServers(code), log, backend.socksProxy.GetTCPProxyDialer())
+			},
+			blockExplorerTxPrefix)
+	}
+	return btc.NewCoin(code, name, unit, net, dbFolder, backend.defaultElectrumXServers(code),
+		blockExplorerTxPrefix, backend.socksProxy)
+}
+
+// ethClient returns the RPC client and transactions source of an Ethereum based coin. EtherScan is
+// used unless the user configured their own node. etherScanURL can be empty if the node is used for
+// everything.
+func (backend *Backend) ethClient(code coinpkg.Code, etherScanURL string, nodeConfig config.ETHNodeConfig) (
+	rpcclient.Interface, eth.TransactionsSource, error) {
+	usesEtherScan := nodeConfig.NodeURL == "" || (nodeConfig.TransactionsSource != config.ETHTransactionsSourceNone &&
+		nodeConfig.TransactionsSource != config.ETHTransactionsSourceNode)
+	if usesEtherScan && etherScanURL == "" {
+		return nil, nil, errp.Newf("%s: no EtherScan URL configured", code)
+	}
+	etherScan := etherscan.NewEtherScan(etherScanURL, backend.etherScanHTTPClient)
+	var client rpcclient.Interface = etherScan
+	if nodeConfig.NodeURL != "" {
+		nodeClient, err := rpcclient.RPCDialHTTP(nodeConfig.NodeURL, backend.httpClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		client = nodeClient
+	}
+
+	switch nodeConfig.TransactionsSource {
+	case config.ETHTransactionsSourceNone:
+		return client, nil, nil
+	case config.ETHTransactionsSourceNode:
+		if nodeConfig.NodeURL == "" {
+			return nil, nil, errp.Newf("%s: a node URL is needed to get transactions from a node", code)
+		}
+		if nodeConfig.NodeStartBlock == 0 {
+			// Scanning from the genesis block would take days.
+			return nil, nil, errp.Newf("%s: a start block is needed to get transactions from a node", code)
+		}
+		indexDB, err := ethdb.NewDB(filepath.Join(
+			backend.arguments.CacheDirectoryPath(), fmt.Sprintf("%s-node-index.db", code)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, nodesource.NewNodeSource(client, indexDB, nodeConfig.NodeStartBlock), nil
+	default:
+		return client, etherScan, nil
+	}
+}
+
 // Testing returns whether this backend is for testing only.
 func (backend *Backend) Testing() bool {
 	return backend.arguments.Testing()
@@ -491,10 +641,12 @@ func (backend *Backend) registerKeystore(keystore keystore.Keystore) {
 		}
 		return account.Configurations.ContainsRootFingerprint(fingerprint)
 	}
+	newKeystore := false
 	err := backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
 		if len(backend.filterAccounts(accountsConfig, belongsToKeystore)) != 0 {
 			return nil
 		}
+		newKeystore = true
 		return backend.persistDefaultAccountConfigs(keystore, accountsConfig)
 	})
 	if err != nil {
@@ -503,6 +655,14 @@ func (backend *Backend) registerKeystore(keystore keystore.Keystore) {
 
 	backend.initAccounts()
 
+	if newKeystore && backend.checkAccountHistory != nil {
+		// The wallet might have been used before, e.g. restored from a seed, so we look for more
+		// used accounts.
+		backend.accountDiscovery = AccountDiscovery{Running: true}
+		backend.notifyAccountDiscovery()
+		go backend.discoverAccounts(keystore)
+	}
+
 	backend.aoppKeystoreRegistered()
 }
 
@@ -522,6 +682,9 @@ func (backend *Backend) DeregisterKeystore() {
 		Subject: "keystores",
 		Action:  action.Reload,
 	})
+	backend.walletConnectDisconnectAll()
+	backend.accountDiscovery = AccountDiscovery{}
+	backend.notifyAccountDiscovery()
 
 	backend.uninitAccounts()
 	// TODO: classify accounts by keystore, remove only the ones belonging to the deregistered
@@ -668,6 +831,7 @@ func (backend *Backend) Close() error {
 
 	backend.ratesUpdater.Stop()
 
+	backend.walletConnectDisconnectAll()
 	backend.uninitAccounts()
 
 	for _, coin := range backend.coins {
@@ -689,9 +853,9 @@ func (backend *Backend) Banners() *banners.Banners {
 	return backend.banners
 }
 
-// HandleURI handles an external URI click for registered protocols, e.g. 'aopp:?...' URIs.  The uri
-// param can be any string, as it is potentially passed without any validation from the calling
-// platform.
+// HandleURI handles an external URI click for registered protocols, e.g. 'aopp:?...' or 'wc:...'
+// URIs. The uri param can be any string, as it is potentially passed without any validation from
+// the calling platform.
 func (backend *Backend) HandleURI(uri string) {
 	u, err := url.Parse(uri)
 	if err != nil {
@@ -701,6 +865,8 @@ func (backend *Backend) HandleURI(uri string) {
 	switch u.Scheme {
 	case "aopp":
 		backend.handleAOPP(*u)
+	case "wc":
+		backend.handleWalletConnect(uri)
 	default:
 		backend.log.Warningf("Unknown URI scheme: %s", uri)
 	}
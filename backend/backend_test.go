@@ -20,6 +20,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
 	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -212,3 +213,21 @@ func TestAccounts(t *testing.T) {
 	require.Equal(t, "My ETH Renamed", b.Config().AccountsConfig().Lookup("v0-55555555-eth-0").Name)
 	require.Equal(t, "My ETH Renamed", lookup(b.Accounts(), "v0-55555555-eth-0").Config().Name)
 }
+
+func TestETHClientNodeSource(t *testing.T) {
+	b := newBackend(t, testnetDisabled, regtestDisabled)
+	defer b.Close()
+
+	nodeConfig := config.ETHNodeConfig{
+		TransactionsSource: config.ETHTransactionsSourceNode,
+		NodeURL:            "http://127.0.0.1:8545",
+	}
+	// The node is not scanned from the genesis block.
+	_, _, err := b.ethClient(coinpkg.CodeETH, "", nodeConfig)
+	require.Error(t, err)
+
+	nodeConfig.NodeStartBlock = 13000000
+	_, transactionsSource, err := b.ethClient(coinpkg.CodeETH, "", nodeConfig)
+	require.NoError(t, err)
+	require.NotNil(t, transactionsSource)
+}
@@ -60,6 +60,9 @@ type subaccount struct {
 	signingConfiguration *signing.Configuration
 	receiveAddresses     *addresses.AddressChain
 	changeAddresses      *addresses.AddressChain
+	// descriptorCounts is the number of receive and change addresses covered by the output
+	// descriptors passed to the blockchain.ScriptWatcher, if the backend is one.
+	descriptorCounts [2]int
 }
 
 // Account is a account whose addresses are derived from an xpub.
@@ -85,9 +88,16 @@ type Account struct {
 
 	transactions *transactions.Transactions
 
-	// if not nil, SendTx() will sign and send this transaction. Set by TxProposal().
-	activeTxProposal     *maketx.TxProposal
-	activeTxProposalLock locker.Locker
+	// if not nil, SendTx() will sign and send this transaction. Set by TxProposal() and
+	// CPFPTxProposal().
+	activeTxProposal *maketx.TxProposal
+	// activeTxProposalPrevOutputs contains the outputs spent by activeTxProposal, which are needed
+	// to sign it.
+	activeTxProposalPrevOutputs map[wire.OutPoint]*transactions.SpendableOutput
+	activeTxProposalLock        locker.Locker
+
+	// Guards the pending multisig transaction stored in the account folder, see multisig.go.
+	pendingMultisigTxLock locker.Locker
 
 	feeTargets []*FeeTarget
 	// Access this only via getMinRelayFeeRate(). sat/kB.
@@ -149,8 +159,8 @@ func (account *Account) FilesFolder() string {
 	return account.dbSubfolder
 }
 
-// defaultGapLimits returns the default gap limits for this account.
-func (account *Account) defaultGapLimits(signingConfiguration *signing.Configuration) types.GapLimits {
+// defaultGapLimits returns the default gap limits for the given signing configuration.
+func defaultGapLimits(signingConfiguration *signing.Configuration) types.GapLimits {
 	limits := types.GapLimits{
 		Receive: 20,
 		Change:  6,
@@ -164,12 +174,19 @@ func (account *Account) defaultGapLimits(signingConfiguration *signing.Configura
 		// Usually 20, but BWS used to not have any limit. We put it fairly high to cover most
 		// outliers.
 		limits.Receive = 60
-		account.log.Warning("increased change gap limit to 20 and gap limit to 60 for BWS compatibility")
 	}
 
 	return limits
 }
 
+// defaultGapLimits returns the default gap limits for this account.
+func (account *Account) defaultGapLimits(signingConfiguration *signing.Configuration) types.GapLimits {
+	if signingConfiguration.ScriptType() == signing.ScriptTypeP2PKH {
+		account.log.Warning("increased change gap limit to 20 and gap limit to 60 for BWS compatibility")
+	}
+	return defaultGapLimits(signingConfiguration)
+}
+
 // gapLimits gets the gap limits as stored in the account configuration, and defaults to
 // `defaultGapLimits()` if there is no configuration or the configuration limits are smaller than
 // the default limits.
@@ -306,6 +323,11 @@ func (account *Account) Initialize() error {
 	account.coin.Initialize()
 	account.SetOffline(account.coin.Blockchain().ConnectionError())
 	account.coin.Blockchain().RegisterOnConnectionErrorChangedEvent(onConnectionStatusChanged)
+	if reporter, ok := account.coin.Blockchain().(blockchain.DiscrepancyReporter); ok {
+		reporter.RegisterOnDiscrepanciesChangedEvent(func() {
+			account.Config().OnEvent(accounts.EventStatusChanged)
+		})
+	}
 
 	theHeaders := account.coin.Headers()
 	theHeaders.SubscribeEvent(func(event headers.Event) {
@@ -315,13 +337,20 @@ func (account *Account) Initialize() error {
 	})
 	account.transactions = transactions.NewTransactions(
 		account.coin.Net(), account.db, theHeaders, account.Synchronizer,
-		account.coin.Blockchain(), account.notifier, account.log)
+		account.coin.Blockchain(), account.notifier, account.isUTXOFrozen, account.log)
 
+	watcher, _ := account.coin.Blockchain().(blockchain.ScriptWatcher)
 	for _, signingConfiguration := range signingConfigurations {
 		signingConfiguration := signingConfiguration
 
 		var subacc subaccount
 		subacc.signingConfiguration = signingConfiguration
+		if watcher != nil {
+			if err := watchDescriptors(watcher, signingConfiguration, account.coin.Net(), account.log); err != nil {
+				return err
+			}
+			subacc.descriptorCounts = [2]int{descriptorRange, descriptorRange}
+		}
 		gapLimits, err := account.gapLimits(signingConfiguration)
 		if err != nil {
 			return err
@@ -355,7 +384,7 @@ func XPubVersionForScriptType(coin *Coin, scriptType signing.ScriptType) [4]byte
 			return versions[signing.ScriptTypeP2PKH]
 		}
 		return version
-	case chaincfg.TestNet3Params.Net:
+	case chaincfg.TestNet3Params.Net, chaincfg.SigNetParams.Net:
 		return chaincfg.TestNet3Params.HDPublicKeyID
 	case ltc.TestNet4Params.Net:
 		return ltc.TestNet4Params.HDPublicKeyID
@@ -370,6 +399,11 @@ func (account *Account) Info() *accounts.Info {
 	// convert it here to the account-specific version (zpub, ypub, tpub, ...).
 	signingConfigurations := make([]*signing.Configuration, len(account.subaccounts))
 	for idx, subacc := range account.subaccounts {
+		if subacc.signingConfiguration.IsMultisig() {
+			// The cosigner keys of multisig accounts are shown as plain xpubs.
+			signingConfigurations[idx] = subacc.signingConfiguration
+			continue
+		}
 		xpub := subacc.signingConfiguration.ExtendedPublicKey()
 		if xpub.IsPrivate() {
 			panic("xpub can't be private")
@@ -589,12 +623,27 @@ func (account *Account) ensureAddresses() {
 	}
 	defer dbTx.Rollback()
 
-	syncSequence := func(addressChain *addresses.AddressChain) error {
+	watcher, _ := account.coin.Blockchain().(blockchain.ScriptWatcher)
+	syncSequence := func(subacc *subaccount, change uint32) error {
+		addressChain := subacc.receiveAddresses
+		if change == 1 {
+			addressChain = subacc.changeAddresses
+		}
 		for {
 			newAddresses := addressChain.EnsureAddresses()
 			if len(newAddresses) == 0 {
 				break
 			}
+			// Extend the descriptor before watching addresses beyond it, so the backend finds
+			// their history.
+			if watcher != nil && addressChain.Count() > subacc.descriptorCounts[change] {
+				count, err := watchDescriptor(watcher, subacc.signingConfiguration,
+					account.coin.Net(), change, addressChain.Count(), account.log)
+				if err != nil {
+					return err
+				}
+				subacc.descriptorCounts[change] = count
+			}
 			for _, address := range newAddresses {
 				if err := account.subscribeAddress(dbTx, address); err != nil {
 					return errp.Wrap(err, "Failed to subscribe to address")
@@ -603,13 +652,14 @@ func (account *Account) ensureAddresses() {
 		}
 		return nil
 	}
-	for _, subacc := range account.subaccounts {
-		if err := syncSequence(subacc.receiveAddresses); err != nil {
+	for i := range account.subaccounts {
+		subacc := &account.subaccounts[i]
+		if err := syncSequence(subacc, 0); err != nil {
 			account.log.WithError(err).Panic(err)
 			// TODO
 			panic(err)
 		}
-		if err := syncSequence(subacc.changeAddresses); err != nil {
+		if err := syncSequence(subacc, 1); err != nil {
 			account.log.WithError(err).Panic(err)
 			// TODO
 			panic(err)
@@ -625,6 +675,9 @@ func (account *Account) subscribeAddress(
 	}
 	address.HistoryStatus = addressHistory.Status()
 
+	if watcher, ok := account.coin.Blockchain().(blockchain.ScriptWatcher); ok {
+		watcher.WatchScript(address.PubkeyScript())
+	}
 	account.coin.Blockchain().ScriptHashSubscribe(
 		func() func(error) {
 			done := account.Synchronizer.IncRequestsCounter()
@@ -679,6 +732,44 @@ func (account *Account) GetUnusedReceiveAddresses() []accounts.AddressList {
 	return addresses
 }
 
+// BlockchainDiscrepancy is a disagreement between the blockchain servers affecting the account,
+// see blockchain.Discrepancy.
+type BlockchainDiscrepancy struct {
+	Kind blockchain.DiscrepancyKind `json:"kind"`
+	// Address is the address with different histories, only set for history discrepancies.
+	Address string   `json:"address,omitempty"`
+	Servers []string `json:"servers"`
+}
+
+// BlockchainDiscrepancies returns the unresolved disagreements between the blockchain servers,
+// found if cross-checking the servers is enabled. History discrepancies are only returned for the
+// addresses of this account.
+func (account *Account) BlockchainDiscrepancies() []BlockchainDiscrepancy {
+	reporter, ok := account.coin.Blockchain().(blockchain.DiscrepancyReporter)
+	if !ok {
+		return nil
+	}
+	discrepancies := reporter.Discrepancies()
+	defer account.RLock()()
+	result := []BlockchainDiscrepancy{}
+	for _, discrepancy := range discrepancies {
+		var address string
+		if discrepancy.Kind == blockchain.DiscrepancyKindHistory {
+			accountAddress := account.lookupAddress(discrepancy.ScriptHashHex)
+			if accountAddress == nil {
+				continue
+			}
+			address = accountAddress.EncodeForHumans()
+		}
+		result = append(result, BlockchainDiscrepancy{
+			Kind:    discrepancy.Kind,
+			Address: address,
+			Servers: discrepancy.Servers,
+		})
+	}
+	return result
+}
+
 // VerifyAddress verifies a receive address on a keystore. Returns false, nil if no secure output
 // exists.
 func (account *Account) VerifyAddress(addressID string) (bool, error) {
@@ -748,6 +839,10 @@ func (account *Account) SpendableOutputs() []*SpendableOutput {
 	return result
 }
 
+func (account *Account) isUTXOFrozen(outPoint wire.OutPoint) bool {
+	return account.UTXOFrozen(outPoint.String())
+}
+
 // VerifyExtendedPublicKey verifies an account's public key. Returns false, nil if no secure output
 // exists.
 //
@@ -15,7 +15,10 @@
 package addresses
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"sort"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -23,7 +26,9 @@ import (
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/sirupsen/logrus"
 )
 
@@ -43,6 +48,9 @@ type AccountAddress struct {
 	// redeemScript stores the redeem script of a BIP16 P2SH output or nil if address type is P2PKH.
 	redeemScript []byte
 
+	// witnessScript stores the multisig script of a P2WSH output, nil for all other address types.
+	witnessScript []byte
+
 	log *logrus.Entry
 }
 
@@ -56,6 +64,7 @@ func NewAccountAddress(
 
 	var address btcutil.Address
 	var redeemScript []byte
+	var witnessScript []byte
 	configuration, err := accountConfiguration.Derive(keyPath)
 	if err != nil {
 		log.WithError(err).Panic("Failed to derive the configuration.")
@@ -66,6 +75,22 @@ func NewAccountAddress(
 	})
 	log.Debug("Creating new account address")
 
+	if configuration.IsMultisig() {
+		witnessScript = multisigScript(configuration, net, log)
+		witnessScriptHash := sha256.Sum256(witnessScript)
+		address, err = btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], net)
+		if err != nil {
+			log.WithError(err).Panic("Failed to get p2wsh addr. from witness script.")
+		}
+		return &AccountAddress{
+			Address:       address,
+			Configuration: configuration,
+			HistoryStatus: "",
+			witnessScript: witnessScript,
+			log:           log,
+		}
+	}
+
 	publicKeyHash := btcutil.Hash160(configuration.PublicKey().SerializeCompressed())
 	switch configuration.ScriptType() {
 	case signing.ScriptTypeP2PKH:
@@ -92,6 +117,12 @@ func NewAccountAddress(
 		if err != nil {
 			log.WithError(err).Panic("Failed to get p2wpkh addr. from publ. key hash.")
 		}
+	case signing.ScriptTypeP2TR:
+		outputKey := taproot.OutputKey(configuration.PublicKey())
+		address, err = btcutil.NewAddressTaproot(taproot.SerializePubKey(outputKey), net)
+		if err != nil {
+			log.WithError(err).Panic("Failed to get p2tr addr. from publ. key.")
+		}
 	default:
 		log.Panic(fmt.Sprintf("Unrecognized script type: %s", configuration.ScriptType()))
 	}
@@ -105,6 +136,41 @@ func NewAccountAddress(
 	}
 }
 
+// sortedPublicKeys returns the public keys of a multisig configuration, sorted lexicographically by
+// their compressed serialization (BIP67).
+func sortedPublicKeys(configuration *signing.Configuration) [][]byte {
+	publicKeys := make([][]byte, len(configuration.PublicKeys()))
+	for i, publicKey := range configuration.PublicKeys() {
+		publicKeys[i] = publicKey.SerializeCompressed()
+	}
+	sort.Slice(publicKeys, func(i, j int) bool {
+		return bytes.Compare(publicKeys[i], publicKeys[j]) < 0
+	})
+	return publicKeys
+}
+
+// multisigScript returns the m-of-n OP_CHECKMULTISIG script of a multisig configuration.
+func multisigScript(configuration *signing.Configuration, net *chaincfg.Params, log *logrus.Entry) []byte {
+	if configuration.ScriptType() != signing.ScriptTypeP2WSH {
+		log.Panic(fmt.Sprintf("Unrecognized multisig script type: %s", configuration.ScriptType()))
+	}
+	publicKeys := sortedPublicKeys(configuration)
+	addressPubKeys := make([]*btcutil.AddressPubKey, len(publicKeys))
+	for i, publicKey := range publicKeys {
+		addressPubKey, err := btcutil.NewAddressPubKey(publicKey, net)
+		if err != nil {
+			log.WithError(err).Panic("Failed to convert the public key.")
+		}
+		addressPubKeys[i] = addressPubKey
+	}
+	script, err := txscript.MultiSigScript(
+		addressPubKeys, int(configuration.BitcoinMultisig.Threshold))
+	if err != nil {
+		log.WithError(err).Panic("Failed to build the multisig script.")
+	}
+	return script
+}
+
 // ID implements accounts.Address.
 func (address *AccountAddress) ID() string {
 	return string(address.PubkeyScriptHashHex())
@@ -126,7 +192,7 @@ func (address *AccountAddress) isUsed() bool {
 
 // PubkeyScript returns the pubkey script of this address. Use this in a tx output to receive funds.
 func (address *AccountAddress) PubkeyScript() []byte {
-	script, err := txscript.PayToAddrScript(address.Address)
+	script, err := taproot.PayToAddrScript(address.Address)
 	if err != nil {
 		address.log.WithError(err).Panic("Failed to get the pubkey script for an address.")
 	}
@@ -148,14 +214,64 @@ func (address *AccountAddress) ScriptForHashToSign() (bool, []byte) {
 		return false, address.PubkeyScript()
 	case signing.ScriptTypeP2WPKHP2SH:
 		return true, address.redeemScript
-	case signing.ScriptTypeP2WPKH:
+	case signing.ScriptTypeP2WPKH, signing.ScriptTypeP2TR:
 		return true, address.PubkeyScript()
+	case signing.ScriptTypeP2WSH:
+		return true, address.witnessScript
 	default:
 		address.log.Panic("Unrecognized address type.")
 	}
 	panic("The end of the function cannot be reached.")
 }
 
+// WitnessScript returns the witness script of a multisig address, or nil for single-sig addresses.
+func (address *AccountAddress) WitnessScript() []byte {
+	return address.witnessScript
+}
+
+// MultisigPublicKeys returns the public keys of the multisig address in the order of the witness
+// script, i.e. sorted lexicographically.
+func (address *AccountAddress) MultisigPublicKeys() [][]byte {
+	if !address.Configuration.IsMultisig() {
+		address.log.Panic("Not a multisig address.")
+	}
+	return sortedPublicKeys(address.Configuration)
+}
+
+// MultisigWitness returns the witness needed to spend from this multisig address. signatures maps
+// the compressed public keys to their signatures. Exactly threshold signatures are used, in the
+// order of the public keys in the witness script.
+func (address *AccountAddress) MultisigWitness(
+	signatures map[string]*btcec.Signature,
+) (wire.TxWitness, error) {
+	threshold := int(address.Configuration.BitcoinMultisig.Threshold)
+	// The first element is a dummy element consumed by the off-by-one bug of OP_CHECKMULTISIG.
+	witness := wire.TxWitness{nil}
+	for _, publicKey := range address.MultisigPublicKeys() {
+		if len(witness)-1 == threshold {
+			break
+		}
+		signature, ok := signatures[string(publicKey)]
+		if !ok {
+			continue
+		}
+		witness = append(witness, append(signature.Serialize(), byte(txscript.SigHashAll)))
+	}
+	if len(witness)-1 < threshold {
+		return nil, errp.Newf("Only %d of %d required signatures present", len(witness)-1, threshold)
+	}
+	return append(witness, address.witnessScript), nil
+}
+
+// TaprootWitness returns the witness needed to spend from this P2TR address via the key path,
+// given a BIP340 signature using SIGHASH_DEFAULT, or SIGHASH_ALL with the sighash type byte appended.
+func (address *AccountAddress) TaprootWitness(signature []byte) wire.TxWitness {
+	if address.Configuration.ScriptType() != signing.ScriptTypeP2TR {
+		address.log.Panic("Not a taproot address.")
+	}
+	return wire.TxWitness{signature}
+}
+
 // SignatureScript returns the signature script (and witness) needed to spend from this address.
 // The signatures have to be provided in the order of the configuration (and some can be nil).
 func (address *AccountAddress) SignatureScript(
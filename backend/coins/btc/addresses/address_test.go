@@ -15,9 +15,14 @@
 package addresses_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
@@ -61,3 +66,54 @@ func (s *addressTestSuite) TestScriptHashHex() {
 		blockchain.ScriptHashHex("0466d0029406f583feadaccb91c7b5b855eb5d6782316cafa4f390b7c784436b"),
 		s.address.PubkeyScriptHashHex())
 }
+
+func TestNewAddressP2TR(t *testing.T) {
+	address := test.GetAddress(signing.ScriptTypeP2TR)
+	require.Equal(t,
+		"tb1pjztz7uh0yla5f4ts7pq3en7k8xa98wnfnxt25tl6mpc33jl5av8sjrfnpf",
+		address.EncodeAddress())
+	isSegwit, subScript := address.ScriptForHashToSign()
+	require.True(t, isSegwit)
+	require.Equal(t, address.PubkeyScript(), subScript)
+	require.Len(t, address.PubkeyScript(), 34)
+}
+
+func TestNewAddressP2WSH(t *testing.T) {
+	address := test.GetMultisigAddress()
+	isSegwit, witnessScript := address.ScriptForHashToSign()
+	require.True(t, isSegwit)
+	require.Equal(t, address.WitnessScript(), witnessScript)
+	witnessScriptHash := sha256.Sum256(witnessScript)
+	require.Equal(t, append([]byte{txscript.OP_0, txscript.OP_DATA_32}, witnessScriptHash[:]...),
+		address.PubkeyScript())
+
+	class, publicKeys, threshold, err := txscript.ExtractPkScriptAddrs(witnessScript, &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	require.Equal(t, txscript.MultiSigTy, class)
+	require.Equal(t, 2, threshold)
+	require.Len(t, publicKeys, 3)
+	// The public keys are sorted (BIP67).
+	sortedPublicKeys := address.MultisigPublicKeys()
+	for i, publicKey := range publicKeys {
+		require.Equal(t, sortedPublicKeys[i], publicKey.ScriptAddress())
+	}
+	require.True(t, bytes.Compare(sortedPublicKeys[0], sortedPublicKeys[1]) < 0)
+	require.True(t, bytes.Compare(sortedPublicKeys[1], sortedPublicKeys[2]) < 0)
+
+	// Not enough signatures.
+	signature := &btcec.Signature{R: big.NewInt(1), S: big.NewInt(1)}
+	_, err = address.MultisigWitness(map[string]*btcec.Signature{
+		string(sortedPublicKeys[2]): signature,
+	})
+	require.Error(t, err)
+	// Only threshold signatures are used.
+	witness, err := address.MultisigWitness(map[string]*btcec.Signature{
+		string(sortedPublicKeys[0]): signature,
+		string(sortedPublicKeys[1]): signature,
+		string(sortedPublicKeys[2]): signature,
+	})
+	require.NoError(t, err)
+	require.Len(t, witness, 4)
+	require.Empty(t, witness[0])
+	require.Equal(t, witnessScript, witness[3])
+}
@@ -88,6 +88,11 @@ func (addresses *AddressChain) unusedTailCount() int {
 	return count
 }
 
+// Count returns the number of addresses in the chain.
+func (addresses *AddressChain) Count() int {
+	return len(addresses.addresses)
+}
+
 // LookupByScriptHashHex returns the address which matches the provided scriptHashHex. Returns nil
 // if not found.
 func (addresses *AddressChain) LookupByScriptHashHex(hashHex blockchain.ScriptHashHex) *AccountAddress {
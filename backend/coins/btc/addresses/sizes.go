@@ -31,7 +31,7 @@ func SigScriptWitnessSize(configuration *signing.Configuration) (int, bool) {
 		const redeemScriptSize = 1 + 1 + 20
 		// OP_DATA_22 (1 Byte) redeemScript (22 bytes)
 		return 1 + redeemScriptSize, true
-	case signing.ScriptTypeP2WPKH:
+	case signing.ScriptTypeP2WPKH, signing.ScriptTypeP2TR, signing.ScriptTypeP2WSH:
 		return 0, true // hooray
 	default:
 		panic("unknown address type")
@@ -50,8 +50,41 @@ func NewAddressChain() (*signing.Configuration, *addresses.AddressChain) {
 	return configuration, addresses.NewAddressChain(configuration, net, 20, 0, log)
 }
 
-// GetAddress returns a dummy address for a given address type.
+// GetMultisigAddress returns a dummy 2-of-3 P2WSH multisig address.
+func GetMultisigAddress() *addresses.AccountAddress {
+	keyInfos := make([]signing.KeyInfo, 3)
+	for i := range keyInfos {
+		seed := make([]byte, hdkeychain.RecommendedSeedLen)
+		seed[0] = byte(i)
+		xprv, err := hdkeychain.NewMaster(seed, net)
+		if err != nil {
+			panic(err)
+		}
+		extendedPublicKey, err := xprv.Neuter()
+		if err != nil {
+			panic(err)
+		}
+		keyInfos[i] = signing.KeyInfo{
+			RootFingerprint:   []byte{1, 2, 3, byte(i)},
+			AbsoluteKeypath:   absoluteKeypath,
+			ExtendedPublicKey: extendedPublicKey,
+		}
+	}
+	configuration := signing.NewBitcoinMultisigConfiguration(2, signing.ScriptTypeP2WSH, keyInfos)
+	return addresses.NewAccountAddress(
+		configuration,
+		signing.NewEmptyRelativeKeypath(),
+		net,
+		logging.Get().WithGroup("addresses_test"),
+	)
+}
+
+// GetAddress returns a dummy address for a given address type. For P2WSH, a 2-of-3 multisig
+// address is returned.
 func GetAddress(scriptType signing.ScriptType) *addresses.AccountAddress {
+	if scriptType == signing.ScriptTypeP2WSH {
+		return GetMultisigAddress()
+	}
 	extendedPublicKey, err := hdkeychain.NewKeyFromString(xpub)
 	if err != nil {
 		panic(err)
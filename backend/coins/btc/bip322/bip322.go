@@ -0,0 +1,273 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bip322 implements generic message signing and verification as defined in BIP-322. A
+// message is signed by spending a virtual output locked by the address' pkScript, so that any script
+// type can be used to sign messages, not only P2PKH as with legacy signed messages.
+package bip322
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const tagSignedMessage = "BIP0322-signed-message"
+
+// legacyMessageMagic is prepended to messages signed in the legacy format (BIP-137).
+const legacyMessageMagic = "Bitcoin Signed Message:\n"
+
+// maxWitnessItemSize limits the size of witness stack items when decoding signatures.
+const maxWitnessItemSize = 10000
+
+// ErrInvalidSignature is returned if a signature does not sign the message for the address.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// MessageHash computes the tagged hash of the message which is committed to in the to_spend
+// transaction.
+func MessageHash(message []byte) []byte {
+	return taproot.TaggedHash(tagSignedMessage, message)
+}
+
+// ToSpend returns the virtual to_spend transaction, which has a single output locked by pkScript
+// and commits to the message.
+func ToSpend(pkScript []byte, message []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	scriptSig, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).
+		AddData(MessageHash(message)).
+		Script()
+	if err != nil {
+		panic(err)
+	}
+	txIn := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xFFFFFFFF), scriptSig, nil)
+	txIn.Sequence = 0
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return tx
+}
+
+// ToSign returns the unsigned virtual to_sign transaction, which spends the output of toSpend. A
+// signature is valid if the completed to_sign transaction passes script verification.
+func ToSign(toSpend *wire.MsgTx) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	toSpendHash := toSpend.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&toSpendHash, 0), nil, nil)
+	txIn.Sequence = 0
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// EncodeSimple encodes the witness of the signed to_sign transaction in the "simple" signature
+// format. The simple format can only be used if the to_sign input has no signature script.
+func EncodeSimple(witness wire.TxWitness) (string, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(witness))); err != nil {
+		return "", errp.WithStack(err)
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&buf, 0, item); err != nil {
+			return "", errp.WithStack(err)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// EncodeFull encodes the signed to_sign transaction in the "full" signature format.
+func EncodeFull(toSign *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := toSign.Serialize(&buf); err != nil {
+		return "", errp.WithStack(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Encode encodes the signed to_sign transaction in the simple format if possible, and in the full
+// format otherwise.
+func Encode(toSign *wire.MsgTx) (string, error) {
+	if len(toSign.TxIn[0].SignatureScript) == 0 {
+		return EncodeSimple(toSign.TxIn[0].Witness)
+	}
+	return EncodeFull(toSign)
+}
+
+func decodeSimple(signature []byte) (wire.TxWitness, error) {
+	reader := bytes.NewReader(signature)
+	count, err := wire.ReadVarInt(reader, 0)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if count > uint64(len(signature)) {
+		return nil, errp.New("invalid witness item count")
+	}
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(reader, 0, maxWitnessItemSize, "witness item")
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, errp.New("unexpected trailing bytes")
+	}
+	return witness, nil
+}
+
+func decodeFull(signature []byte, toSpend *wire.MsgTx) (*wire.MsgTx, error) {
+	reader := bytes.NewReader(signature)
+	toSign := &wire.MsgTx{}
+	if err := toSign.Deserialize(reader); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if reader.Len() != 0 {
+		return nil, errp.New("unexpected trailing bytes")
+	}
+	expected := ToSign(toSpend)
+	if toSign.Version != expected.Version || toSign.LockTime != expected.LockTime ||
+		len(toSign.TxIn) != 1 || len(toSign.TxOut) != 1 ||
+		toSign.TxIn[0].PreviousOutPoint != expected.TxIn[0].PreviousOutPoint ||
+		toSign.TxIn[0].Sequence != expected.TxIn[0].Sequence ||
+		toSign.TxOut[0].Value != 0 ||
+		!bytes.Equal(toSign.TxOut[0].PkScript, expected.TxOut[0].PkScript) {
+		return nil, errp.New("not a to_sign transaction")
+	}
+	return toSign, nil
+}
+
+// verifyScript checks that the input of toSign validly spends the output of toSpend.
+func verifyScript(toSpend *wire.MsgTx, toSign *wire.MsgTx) error {
+	prevOut := toSpend.TxOut[0]
+	if taproot.IsPayToTaproot(prevOut.PkScript) {
+		// The script engine of our btcd version does not support taproot yet.
+		return taproot.VerifyKeySpend(toSign, 0, prevOut.PkScript, []*wire.TxOut{prevOut})
+	}
+	engine, err := txscript.NewEngine(prevOut.PkScript, toSign, 0,
+		txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(toSign), prevOut.Value)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(engine.Execute())
+}
+
+// legacyMessageHash computes the hash signed by legacy message signatures.
+func legacyMessageHash(message []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarString(&buf, 0, legacyMessageMagic); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := wire.WriteVarBytes(&buf, 0, message); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return chainhash.DoubleHashB(buf.Bytes()), nil
+}
+
+// verifyLegacy verifies a 65 byte legacy signature in the BIP-137/Electrum format, where the
+// header byte encodes the recovery ID, whether the public key is compressed and (optionally) the
+// script type. The script type is derived from the address instead of the header byte.
+func verifyLegacy(pkScript []byte, message []byte, signature []byte, net *chaincfg.Params) error {
+	if len(signature) != 65 || signature[0] < 27 || signature[0] > 42 {
+		return errp.New("not a legacy signature")
+	}
+	recID := (signature[0] - 27) & 3
+	compressed := signature[0] >= 31
+	compactSignature := append([]byte{27 + recID}, signature[1:]...)
+	if compressed {
+		compactSignature[0] += 4
+	}
+	hash, err := legacyMessageHash(message)
+	if err != nil {
+		return err
+	}
+	publicKey, _, err := btcec.RecoverCompact(btcec.S256(), compactSignature, hash)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	var serializedPublicKey []byte
+	if compressed {
+		serializedPublicKey = publicKey.SerializeCompressed()
+	} else {
+		serializedPublicKey = publicKey.SerializeUncompressed()
+	}
+	publicKeyHash := btcutil.Hash160(serializedPublicKey)
+	candidates := []btcutil.Address{}
+	if address, err := btcutil.NewAddressPubKeyHash(publicKeyHash, net); err == nil {
+		candidates = append(candidates, address)
+	}
+	if compressed {
+		witnessAddress, err := btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, net)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		candidates = append(candidates, witnessAddress)
+		redeemScript, err := txscript.PayToAddrScript(witnessAddress)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if address, err := btcutil.NewAddressScriptHash(redeemScript, net); err == nil {
+			candidates = append(candidates, address)
+		}
+	}
+	for _, candidate := range candidates {
+		candidatePkScript, err := txscript.PayToAddrScript(candidate)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if bytes.Equal(candidatePkScript, pkScript) {
+			return nil
+		}
+	}
+	return errp.New("public key does not match the address")
+}
+
+// Verify checks that signature is a valid signature of the message by the address. The signature
+// is base64 encoded and can be in the BIP-322 "simple" or "full" format. Legacy signatures of
+// P2PKH, P2WPKH-P2SH and P2WPKH addresses (BIP-137 or Electrum format) are also accepted. Returns
+// ErrInvalidSignature if the signature is not valid.
+func Verify(address btcutil.Address, message []byte, signature string, net *chaincfg.Params) error {
+	pkScript, err := taproot.PayToAddrScript(address)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errp.WithMessage(ErrInvalidSignature, "signature is not base64 encoded")
+	}
+	if verifyLegacy(pkScript, message, decoded, net) == nil {
+		return nil
+	}
+	toSpend := ToSpend(pkScript, message)
+	if witness, err := decodeSimple(decoded); err == nil {
+		toSign := ToSign(toSpend)
+		toSign.TxIn[0].Witness = witness
+		if verifyScript(toSpend, toSign) == nil {
+			return nil
+		}
+	}
+	if toSign, err := decodeFull(decoded, toSpend); err == nil {
+		if verifyScript(toSpend, toSign) == nil {
+			return nil
+		}
+	}
+	return errp.WithStack(ErrInvalidSignature)
+}
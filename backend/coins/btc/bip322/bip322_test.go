@@ -0,0 +1,202 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bip322_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip322"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from https://github.com/bitcoin/bips/blob/master/bip-0322.mediawiki.
+const (
+	testWIF     = "L3VFeEujGtevx9w18HD1fhRbCH67Az2dpCymeRE1SoPK6XQtaN2k"
+	testAddress = "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l"
+)
+
+var net = &chaincfg.MainNetParams
+
+func privateKey(t *testing.T) *btcec.PrivateKey {
+	t.Helper()
+	wif, err := btcutil.DecodeWIF(testWIF)
+	require.NoError(t, err)
+	return wif.PrivKey
+}
+
+func decodeAddress(t *testing.T, address string) btcutil.Address {
+	t.Helper()
+	decoded, err := btcutil.DecodeAddress(address, net)
+	require.NoError(t, err)
+	return decoded
+}
+
+func TestMessageHash(t *testing.T) {
+	require.Equal(t,
+		"c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1",
+		hex.EncodeToString(bip322.MessageHash([]byte(""))))
+	require.Equal(t,
+		"f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a",
+		hex.EncodeToString(bip322.MessageHash([]byte("Hello World"))))
+}
+
+func TestTransactions(t *testing.T) {
+	pkScript, err := txscript.PayToAddrScript(decodeAddress(t, testAddress))
+	require.NoError(t, err)
+
+	toSpend := bip322.ToSpend(pkScript, []byte(""))
+	require.Equal(t,
+		"c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7",
+		toSpend.TxHash().String())
+	require.Equal(t,
+		"1e9654e951a5ba44c8604c4de6c67fd78a27e81dcadcfe1edf638ba3aaebaed6",
+		bip322.ToSign(toSpend).TxHash().String())
+
+	toSpend = bip322.ToSpend(pkScript, []byte("Hello World"))
+	require.Equal(t,
+		"b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b",
+		toSpend.TxHash().String())
+	require.Equal(t,
+		"88737ae86f2077145f93cc4b153ae9a1cb8d56afa511988c149c5c8c9d93bddf",
+		bip322.ToSign(toSpend).TxHash().String())
+}
+
+func TestVerifyVectors(t *testing.T) {
+	address := decodeAddress(t, testAddress)
+	require.NoError(t, bip322.Verify(address, []byte(""),
+		"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net))
+	require.NoError(t, bip322.Verify(address, []byte("Hello World"),
+		"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net))
+	// Signature of a different message.
+	err := bip322.Verify(address, []byte("Hello World"),
+		"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+		net)
+	require.Equal(t, bip322.ErrInvalidSignature, errp.Cause(err))
+	// Garbage.
+	require.Error(t, bip322.Verify(address, []byte(""), "not base64", net))
+	require.Error(t, bip322.Verify(address, []byte(""), "AAAA", net))
+}
+
+// sign signs the to_sign transaction for the given pkScript, similar to what a keystore does.
+func sign(t *testing.T, address btcutil.Address, message []byte) string {
+	t.Helper()
+	privateKey := privateKey(t)
+	pkScript, err := taproot.PayToAddrScript(address)
+	require.NoError(t, err)
+	toSpend := bip322.ToSpend(pkScript, message)
+	toSign := bip322.ToSign(toSpend)
+	switch address.(type) {
+	case *btcutil.AddressTaproot:
+		sigHash, err := taproot.CalcSigHash(toSign, 0, toSpend.TxOut)
+		require.NoError(t, err)
+		signature, err := taproot.Sign(
+			taproot.TweakPrivateKey(privateKey), sigHash, make([]byte, 32))
+		require.NoError(t, err)
+		toSign.TxIn[0].Witness = wire.TxWitness{signature}
+	case *btcutil.AddressWitnessPubKeyHash:
+		witness, err := txscript.WitnessSignature(toSign, txscript.NewTxSigHashes(toSign), 0, 0,
+			pkScript, txscript.SigHashAll, privateKey, true)
+		require.NoError(t, err)
+		toSign.TxIn[0].Witness = witness
+	case *btcutil.AddressScriptHash:
+		// P2WPKH-P2SH
+		witnessAddress, err := btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(privateKey.PubKey().SerializeCompressed()), net)
+		require.NoError(t, err)
+		redeemScript, err := txscript.PayToAddrScript(witnessAddress)
+		require.NoError(t, err)
+		witness, err := txscript.WitnessSignature(toSign, txscript.NewTxSigHashes(toSign), 0, 0,
+			redeemScript, txscript.SigHashAll, privateKey, true)
+		require.NoError(t, err)
+		toSign.TxIn[0].Witness = witness
+		toSign.TxIn[0].SignatureScript, err = txscript.NewScriptBuilder().
+			AddData(redeemScript).Script()
+		require.NoError(t, err)
+	default:
+		t.Fatal("unsupported address")
+	}
+	signature, err := bip322.Encode(toSign)
+	require.NoError(t, err)
+	return signature
+}
+
+func TestSignVerify(t *testing.T) {
+	publicKey := privateKey(t).PubKey()
+	publicKeyHash := btcutil.Hash160(publicKey.SerializeCompressed())
+
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, net)
+	require.NoError(t, err)
+	redeemScript, err := txscript.PayToAddrScript(p2wpkh)
+	require.NoError(t, err)
+	p2wpkhP2SH, err := btcutil.NewAddressScriptHash(redeemScript, net)
+	require.NoError(t, err)
+	p2tr, err := btcutil.NewAddressTaproot(
+		taproot.SerializePubKey(taproot.OutputKey(publicKey)), net)
+	require.NoError(t, err)
+
+	message := []byte("I own this address")
+	for _, address := range []btcutil.Address{p2wpkh, p2wpkhP2SH, p2tr} {
+		address := address
+		t.Run(address.EncodeAddress(), func(t *testing.T) {
+			signature := sign(t, address, message)
+			require.NoError(t, bip322.Verify(address, message, signature, net))
+			require.Error(t, bip322.Verify(address, []byte("other message"), signature, net))
+		})
+	}
+	// Simple signatures can't be used for wrapped segwit, which needs a signature script.
+	decoded, err := base64.StdEncoding.DecodeString(sign(t, p2wpkhP2SH, message))
+	require.NoError(t, err)
+	tx := &wire.MsgTx{}
+	require.NoError(t, tx.Deserialize(bytes.NewReader(decoded)))
+	require.NotEmpty(t, tx.TxIn[0].SignatureScript)
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	privateKey := privateKey(t)
+	var buf []byte
+	buf = append(buf, byte(len("Bitcoin Signed Message:\n")))
+	buf = append(buf, "Bitcoin Signed Message:\n"...)
+	message := []byte("legacy message")
+	buf = append(buf, byte(len(message)))
+	buf = append(buf, message...)
+	signature, err := btcec.SignCompact(btcec.S256(), privateKey, chainhash.DoubleHashB(buf), true)
+	require.NoError(t, err)
+
+	publicKeyHash := btcutil.Hash160(privateKey.PubKey().SerializeCompressed())
+	p2pkh, err := btcutil.NewAddressPubKeyHash(publicKeyHash, net)
+	require.NoError(t, err)
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, net)
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(signature)
+	require.NoError(t, bip322.Verify(p2pkh, message, encoded, net))
+	require.NoError(t, bip322.Verify(p2wpkh, message, encoded, net))
+	require.Error(t, bip322.Verify(p2pkh, []byte("other message"), encoded, net))
+	require.Error(t, bip322.Verify(decodeAddress(t, "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3"),
+		message, encoded, net))
+}
@@ -0,0 +1,892 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bitcoind implements blockchain.Interface using the JSON-RPC API of a Bitcoin Core node.
+// See Client for more details.
+package bitcoind
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWalletName   = "bitboxapp"
+	defaultPollInterval = 10 * time.Second
+	// maxHeadersPerBatch is the maximum number of headers returned by Headers(), the same as for
+	// ElectrumX.
+	maxHeadersPerBatch = 2016
+)
+
+// errClosed is returned by retry() if the client was closed.
+var errClosed = errp.New("client closed")
+
+var _ blockchain.Interface = &Client{}
+var _ blockchain.ScriptWatcher = &Client{}
+
+// Client is a blockchain.Interface backed by a Bitcoin Core node.
+//
+// Bitcoin Core has no index of script hashes, so the pubkey script of each script hash must be
+// passed to WatchScript() (see blockchain.ScriptWatcher) before subscribing to it. The ranged
+// output descriptors passed to WatchDescriptor() are imported into a watch-only descriptor wallet
+// on the node once, which rescans the blockchain from the configured rescan timestamp for their
+// transactions. When a descriptor is watched with a larger range, it is imported again with the
+// larger range and rescanned from the same timestamp. Scripts not covered by a descriptor are
+// imported individually and rescanned from the same timestamp. The history of each script hash is built from the wallet transactions, and the
+// node is polled for new blocks and wallet transactions to notify subscribers of changes.
+//
+// Fetching transactions which do not belong to the wallet, e.g. the previous transactions of the
+// inputs of a transaction, requires the node to run with -txindex.
+type Client struct {
+	config     config.BitcoinCoreConfig
+	httpClient *http.Client
+
+	// importLock serializes importing scripts into the wallet and updating the histories.
+	importLock sync.Mutex
+
+	lock         locker.Locker
+	walletLoaded bool
+	// scripts are all scripts passed to WatchScript().
+	scripts map[blockchain.ScriptHashHex][]byte
+	// descriptors maps all descriptors passed to WatchDescriptor() to the number of addresses
+	// they cover.
+	descriptors map[string]int
+	// covered contains the hex of all scripts covered by a watched descriptor.
+	covered map[string]bool
+	// imported contains the hex of all scripts which are imported into the wallet.
+	imported map[string]bool
+	// importedDescriptors maps all ranged descriptors (without checksum) which are imported into
+	// the wallet to the number of addresses they cover.
+	importedDescriptors map[string]int
+	indexed             bool
+	histories           map[blockchain.ScriptHashHex]blockchain.TxHistory
+	// transactions caches all wallet transactions.
+	transactions  map[chainhash.Hash]*wire.MsgTx
+	walletTxCount int
+	bestBlockHash string
+
+	scriptHashCallbacks map[blockchain.ScriptHashHex][]func(string)
+	// statuses contains the last status passed to the callbacks of each subscribed script hash.
+	statuses         map[blockchain.ScriptHashHex]string
+	headersCallbacks []func(*blockchain.Header)
+
+	connectionError          error
+	connectionErrorCallbacks []func(error)
+
+	closed   bool
+	quitChan chan struct{}
+
+	log *logrus.Entry
+}
+
+// NewClient creates a new client for the Bitcoin Core node configured in conf and starts polling
+// it.
+func NewClient(conf config.BitcoinCoreConfig, httpClient *http.Client, log *logrus.Entry) *Client {
+	client := &Client{
+		config:              conf,
+		httpClient:          httpClient,
+		scripts:             map[blockchain.ScriptHashHex][]byte{},
+		descriptors:         map[string]int{},
+		covered:             map[string]bool{},
+		imported:            map[string]bool{},
+		importedDescriptors: map[string]int{},
+		histories:           map[blockchain.ScriptHashHex]blockchain.TxHistory{},
+		transactions:        map[chainhash.Hash]*wire.MsgTx{},
+		scriptHashCallbacks: map[blockchain.ScriptHashHex][]func(string){},
+		statuses:            map[blockchain.ScriptHashHex]string{},
+		quitChan:            make(chan struct{}),
+		log: log.WithFields(logrus.Fields{
+			"group": "bitcoind", "server-type": "bitcoind", "servers": conf.RPCURL}),
+	}
+	go client.poll()
+	return client
+}
+
+func (client *Client) walletName() string {
+	if client.config.Wallet == "" {
+		return defaultWalletName
+	}
+	return client.config.Wallet
+}
+
+func (client *Client) pollInterval() time.Duration {
+	if client.config.PollIntervalSeconds <= 0 {
+		return defaultPollInterval
+	}
+	return time.Duration(client.config.PollIntervalSeconds) * time.Second
+}
+
+func rpcErrorCode(err error) (int, bool) {
+	rpcErr, ok := errp.Cause(err).(*rpcError)
+	if !ok {
+		return 0, false
+	}
+	return rpcErr.Code, true
+}
+
+// setConnectionError updates the connection status after a request. Errors which are not
+// connection errors don't change the connection status.
+func (client *Client) setConnectionError(err error) {
+	if err != nil && !isConnectionError(err) {
+		return
+	}
+	unlock := client.lock.Lock()
+	changed := (client.connectionError == nil) != (err == nil)
+	client.connectionError = err
+	callbacks := client.connectionErrorCallbacks
+	unlock()
+	if changed {
+		for _, callback := range callbacks {
+			callback(err)
+		}
+	}
+}
+
+// retry calls f until it does not fail with a connection error. errClosed is returned if the
+// client is closed in the meantime.
+func (client *Client) retry(f func() error) error {
+	for {
+		err := f()
+		if err == nil || !isConnectionError(err) {
+			return err
+		}
+		client.log.WithError(err).Debug("Retrying after connection error")
+		select {
+		case <-client.quitChan:
+			return errClosed
+		case <-time.After(client.pollInterval()):
+		}
+	}
+}
+
+// async runs f in a goroutine, retrying it on connection errors, and passes the result to cleanup.
+// cleanup is not called if the client is closed before f succeeded, the same as with the pending
+// requests of the Electrum client.
+func (client *Client) async(cleanup func(error), f func() error) {
+	go func() {
+		err := client.retry(f)
+		if err == errClosed {
+			return
+		}
+		cleanup(err)
+	}()
+}
+
+func setup(setupAndTeardown func() func(error)) func(error) {
+	var cleanup func(error)
+	if setupAndTeardown != nil {
+		cleanup = setupAndTeardown()
+	}
+	if cleanup == nil {
+		cleanup = func(error) {}
+	}
+	return cleanup
+}
+
+// stripChecksum returns the descriptor without the "#<checksum>" suffix.
+func stripChecksum(descriptor string) string {
+	return strings.SplitN(descriptor, "#", 2)[0]
+}
+
+// rawDescriptorScript returns the script hex of a raw(<hex>) descriptor.
+func rawDescriptorScript(descriptor string) (string, bool) {
+	descriptor = stripChecksum(descriptor)
+	if !strings.HasPrefix(descriptor, "raw(") || !strings.HasSuffix(descriptor, ")") {
+		return "", false
+	}
+	return strings.ToLower(descriptor[len("raw(") : len(descriptor)-1]), true
+}
+
+// ensureWallet loads the watch-only wallet, creating it if it does not exist yet.
+func (client *Client) ensureWallet() error {
+	unlock := client.lock.RLock()
+	walletLoaded := client.walletLoaded
+	unlock()
+	if walletLoaded {
+		return nil
+	}
+	err := client.call(false, nil, "loadwallet", client.walletName())
+	if code, ok := rpcErrorCode(err); ok && code == rpcErrWalletNotFound {
+		client.log.WithField("wallet", client.walletName()).Info("Creating watch-only wallet")
+		// Params: wallet_name, disable_private_keys, blank, passphrase, avoid_reuse, descriptors,
+		// load_on_startup.
+		err = client.call(false, nil, "createwallet", client.walletName(), true, true, "", false, true, true)
+	} else if ok && code == rpcErrWalletAlreadyLoaded {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Descriptors []struct {
+			Desc  string `json:"desc"`
+			Range []int  `json:"range"`
+		} `json:"descriptors"`
+	}
+	if err := client.call(true, &response, "listdescriptors"); err != nil {
+		return err
+	}
+	defer client.lock.Lock()()
+	for _, descriptor := range response.Descriptors {
+		if scriptHex, ok := rawDescriptorScript(descriptor.Desc); ok {
+			client.imported[scriptHex] = true
+		} else if len(descriptor.Range) == 2 {
+			client.importedDescriptors[stripChecksum(descriptor.Desc)] = descriptor.Range[1] + 1
+		}
+	}
+	client.walletLoaded = true
+	return nil
+}
+
+// importScripts imports all watched descriptors and scripts which are not in the wallet yet, and
+// descriptors whose range was extended. The node rescans the blockchain from the configured rescan
+// timestamp for them, which can take a while. Returns true if descriptors or scripts were imported.
+func (client *Client) importScripts() (bool, error) {
+	if err := client.ensureWallet(); err != nil {
+		return false, err
+	}
+	type importRequest struct {
+		descriptor string
+		// rangeEnd is the last index of a ranged descriptor, -1 for raw() descriptors.
+		rangeEnd  int
+		scriptHex string
+	}
+	unlock := client.lock.RLock()
+	imports := []importRequest{}
+	for descriptor, count := range client.descriptors {
+		if client.importedDescriptors[descriptor] < count {
+			imports = append(imports, importRequest{descriptor: descriptor, rangeEnd: count - 1})
+		}
+	}
+	for _, script := range client.scripts {
+		scriptHex := hex.EncodeToString(script)
+		if !client.imported[scriptHex] && !client.covered[scriptHex] {
+			imports = append(imports, importRequest{
+				descriptor: "raw(" + scriptHex + ")",
+				rangeEnd:   -1,
+				scriptHex:  scriptHex,
+			})
+		}
+	}
+	unlock()
+	if len(imports) == 0 {
+		return false, nil
+	}
+
+	// The descriptor checksums are computed by the node.
+	infos := make([]struct {
+		Descriptor string `json:"descriptor"`
+	}, len(imports))
+	calls := make([]rpcCall, len(imports))
+	for i, request := range imports {
+		calls[i] = rpcCall{
+			method: "getdescriptorinfo",
+			params: []interface{}{request.descriptor},
+			result: &infos[i],
+		}
+	}
+	if err := client.batch(false, calls); err != nil {
+		return false, err
+	}
+	requests := make([]map[string]interface{}, len(infos))
+	for i, info := range infos {
+		if imports[i].rangeEnd < 0 {
+			requests[i] = map[string]interface{}{
+				"desc":      info.Descriptor,
+				"timestamp": client.config.RescanTimestamp,
+			}
+			continue
+		}
+		requests[i] = map[string]interface{}{
+			"desc":      info.Descriptor,
+			"timestamp": client.config.RescanTimestamp,
+			"range":     []int{0, imports[i].rangeEnd},
+		}
+	}
+	client.log.WithField("count", len(requests)).Info("Importing descriptors")
+	var results []struct {
+		Success bool      `json:"success"`
+		Error   *rpcError `json:"error"`
+	}
+	if err := client.call(true, &results, "importdescriptors", requests); err != nil {
+		return false, err
+	}
+	for _, result := range results {
+		if !result.Success {
+			if result.Error != nil {
+				return false, errp.WithMessage(result.Error, "importdescriptors")
+			}
+			return false, errp.New("importdescriptors failed")
+		}
+	}
+	defer client.lock.Lock()()
+	for _, request := range imports {
+		if request.rangeEnd < 0 {
+			client.imported[request.scriptHex] = true
+		} else {
+			client.importedDescriptors[request.descriptor] = request.rangeEnd + 1
+		}
+	}
+	return true, nil
+}
+
+// update imports new scripts and updates the histories of all script hashes if scripts were
+// imported, if they were never computed, or if refresh is true.
+func (client *Client) update(refresh bool) error {
+	client.importLock.Lock()
+	defer client.importLock.Unlock()
+	imported, err := client.importScripts()
+	if err != nil {
+		return err
+	}
+	unlock := client.lock.RLock()
+	indexed := client.indexed
+	unlock()
+	if !imported && indexed && !refresh {
+		return nil
+	}
+	return client.refreshHistories()
+}
+
+// refreshHistories computes the histories of all watched script hashes from the wallet
+// transactions and notifies the subscribers of changed script hashes.
+func (client *Client) refreshHistories() error {
+	var sinceBlock struct {
+		Transactions []struct {
+			TxID          string `json:"txid"`
+			Confirmations int    `json:"confirmations"`
+			BlockHeight   int    `json:"blockheight"`
+		} `json:"transactions"`
+	}
+	// Params: blockhash (all transactions if empty), target_confirmations, include_watchonly.
+	if err := client.call(true, &sinceBlock, "listsinceblock", "", 1, true); err != nil {
+		return err
+	}
+	heights := map[chainhash.Hash]int{}
+	for _, tx := range sinceBlock.Transactions {
+		if tx.Confirmations < 0 {
+			// Conflicts with a confirmed transaction.
+			continue
+		}
+		txHash, err := chainhash.NewHashFromStr(tx.TxID)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		height := 0
+		if tx.Confirmations > 0 {
+			height = tx.BlockHeight
+		}
+		heights[*txHash] = height
+	}
+
+	unlock := client.lock.RLock()
+	missing := []chainhash.Hash{}
+	for txHash := range heights {
+		if _, ok := client.transactions[txHash]; !ok {
+			missing = append(missing, txHash)
+		}
+	}
+	unlock()
+	results := make([]struct {
+		Hex string `json:"hex"`
+	}, len(missing))
+	calls := make([]rpcCall, len(missing))
+	for i, txHash := range missing {
+		calls[i] = rpcCall{
+			method: "gettransaction",
+			params: []interface{}{txHash.String(), true},
+			result: &results[i],
+		}
+	}
+	if err := client.batch(true, calls); err != nil {
+		return err
+	}
+	fetched := make([]*wire.MsgTx, len(missing))
+	for i, result := range results {
+		tx, err := parseTx(result.Hex)
+		if err != nil {
+			return err
+		}
+		fetched[i] = tx
+	}
+
+	unlock = client.lock.Lock()
+	for i, txHash := range missing {
+		client.transactions[txHash] = fetched[i]
+	}
+	txHashes := map[blockchain.ScriptHashHex]map[chainhash.Hash]struct{}{}
+	add := func(scriptHashHex blockchain.ScriptHashHex, txHash chainhash.Hash) {
+		if _, ok := txHashes[scriptHashHex]; !ok {
+			txHashes[scriptHashHex] = map[chainhash.Hash]struct{}{}
+		}
+		txHashes[scriptHashHex][txHash] = struct{}{}
+	}
+	// Outputs paying to a watched script, and inputs spending them.
+	outpoints := map[wire.OutPoint]blockchain.ScriptHashHex{}
+	for txHash := range heights {
+		for index, txOut := range client.transactions[txHash].TxOut {
+			scriptHashHex := blockchain.NewScriptHashHex(txOut.PkScript)
+			if _, ok := client.scripts[scriptHashHex]; ok {
+				outpoints[*wire.NewOutPoint(&txHash, uint32(index))] = scriptHashHex
+				add(scriptHashHex, txHash)
+			}
+		}
+	}
+	for txHash := range heights {
+		for _, txIn := range client.transactions[txHash].TxIn {
+			if scriptHashHex, ok := outpoints[txIn.PreviousOutPoint]; ok {
+				add(scriptHashHex, txHash)
+			}
+		}
+	}
+	// -1 for unconfirmed transactions with an unconfirmed parent, see blockchain.TxInfo.
+	height := func(txHash chainhash.Hash) int {
+		if heights[txHash] > 0 {
+			return heights[txHash]
+		}
+		for _, txIn := range client.transactions[txHash].TxIn {
+			if parentHeight, ok := heights[txIn.PreviousOutPoint.Hash]; ok && parentHeight <= 0 {
+				return -1
+			}
+		}
+		return 0
+	}
+	histories := map[blockchain.ScriptHashHex]blockchain.TxHistory{}
+	for scriptHashHex, hashes := range txHashes {
+		history := blockchain.TxHistory{}
+		for txHash := range hashes {
+			history = append(history, &blockchain.TxInfo{
+				Height: height(txHash),
+				TXHash: blockchain.TXHash(txHash),
+			})
+		}
+		history.Sort()
+		histories[scriptHashHex] = history
+	}
+	client.histories = histories
+	client.indexed = true
+
+	type notification struct {
+		callbacks []func(string)
+		status    string
+	}
+	notifications := []notification{}
+	for scriptHashHex, callbacks := range client.scriptHashCallbacks {
+		previousStatus, ok := client.statuses[scriptHashHex]
+		if !ok {
+			// The initial status was not delivered yet.
+			continue
+		}
+		status := histories[scriptHashHex].Status()
+		if status != previousStatus {
+			client.statuses[scriptHashHex] = status
+			notifications = append(notifications, notification{callbacks, status})
+		}
+	}
+	unlock()
+	for _, notification := range notifications {
+		for _, callback := range notification.callbacks {
+			callback(notification.status)
+		}
+	}
+	return nil
+}
+
+func (client *Client) poll() {
+	ticker := time.NewTicker(client.pollInterval())
+	defer ticker.Stop()
+	for {
+		if err := client.pollOnce(); err != nil {
+			if isConnectionError(err) {
+				client.log.WithError(err).Debug("Could not poll the node")
+			} else {
+				client.log.WithError(err).Error("Could not poll the node")
+			}
+		}
+		select {
+		case <-client.quitChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollOnce notifies the headers subscribers of a new tip and updates the histories if there is a
+// new block or new wallet transaction.
+func (client *Client) pollOnce() error {
+	var tipHeight int
+	var bestBlockHash string
+	if err := client.batch(false, []rpcCall{
+		{method: "getblockcount", result: &tipHeight},
+		{method: "getbestblockhash", result: &bestBlockHash},
+	}); err != nil {
+		return err
+	}
+	if err := client.ensureWallet(); err != nil {
+		return err
+	}
+	var walletInfo struct {
+		TxCount int `json:"txcount"`
+	}
+	if err := client.call(true, &walletInfo, "getwalletinfo"); err != nil {
+		return err
+	}
+	unlock := client.lock.Lock()
+	newTip := bestBlockHash != client.bestBlockHash
+	changed := newTip || walletInfo.TxCount != client.walletTxCount
+	client.bestBlockHash = bestBlockHash
+	client.walletTxCount = walletInfo.TxCount
+	headersCallbacks := client.headersCallbacks
+	unlock()
+	if newTip {
+		for _, callback := range headersCallbacks {
+			callback(&blockchain.Header{BlockHeight: tipHeight})
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return client.update(true)
+}
+
+// WatchScript implements blockchain.ScriptWatcher.
+func (client *Client) WatchScript(pkScript []byte) {
+	defer client.lock.Lock()()
+	client.scripts[blockchain.NewScriptHashHex(pkScript)] = append([]byte(nil), pkScript...)
+}
+
+// WatchDescriptor implements blockchain.ScriptWatcher.
+func (client *Client) WatchDescriptor(descriptor string, pkScripts [][]byte) {
+	defer client.lock.Lock()()
+	if len(pkScripts) > client.descriptors[descriptor] {
+		client.descriptors[descriptor] = len(pkScripts)
+	}
+	for _, pkScript := range pkScripts {
+		client.covered[hex.EncodeToString(pkScript)] = true
+	}
+}
+
+// history returns the history of a watched script hash.
+func (client *Client) history(scriptHashHex blockchain.ScriptHashHex) (blockchain.TxHistory, error) {
+	if err := client.update(false); err != nil {
+		return nil, err
+	}
+	defer client.lock.RLock()()
+	if _, ok := client.scripts[scriptHashHex]; !ok {
+		return nil, errp.Newf("script hash %s is not watched", scriptHashHex)
+	}
+	history := blockchain.TxHistory{}
+	for _, txInfo := range client.histories[scriptHashHex] {
+		txInfoCopy := *txInfo
+		history = append(history, &txInfoCopy)
+	}
+	return history, nil
+}
+
+// ScriptHashGetHistory implements blockchain.Interface.
+func (client *Client) ScriptHashGetHistory(
+	scriptHashHex blockchain.ScriptHashHex,
+	success func(blockchain.TxHistory),
+	cleanup func(error),
+) {
+	client.async(cleanup, func() error {
+		history, err := client.history(scriptHashHex)
+		if err != nil {
+			return err
+		}
+		success(history)
+		return nil
+	})
+}
+
+// ScriptHashSubscribe implements blockchain.Interface.
+func (client *Client) ScriptHashSubscribe(
+	setupAndTeardown func() func(error),
+	scriptHashHex blockchain.ScriptHashHex,
+	success func(string),
+) {
+	cleanup := setup(setupAndTeardown)
+	unlock := client.lock.Lock()
+	client.scriptHashCallbacks[scriptHashHex] = append(client.scriptHashCallbacks[scriptHashHex], success)
+	unlock()
+	client.async(cleanup, func() error {
+		history, err := client.history(scriptHashHex)
+		if err != nil {
+			return err
+		}
+		status := history.Status()
+		unlock := client.lock.Lock()
+		client.statuses[scriptHashHex] = status
+		unlock()
+		success(status)
+		return nil
+	})
+}
+
+func parseTx(rawTxHex string) (*wire.MsgTx, error) {
+	rawTx, err := hex.DecodeString(rawTxHex)
+	if err != nil {
+		return nil, errp.Wrap(err, "Failed to decode transaction hex")
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.BtcDecode(bytes.NewReader(rawTx), 0, wire.WitnessEncoding); err != nil {
+		return nil, errp.Wrap(err, "Failed to decode BTC transaction")
+	}
+	return tx, nil
+}
+
+// TransactionGet implements blockchain.Interface.
+func (client *Client) TransactionGet(
+	txHash chainhash.Hash,
+	success func(*wire.MsgTx),
+	cleanup func(error),
+) {
+	client.async(cleanup, func() error {
+		unlock := client.lock.RLock()
+		tx, ok := client.transactions[txHash]
+		unlock()
+		if ok {
+			success(tx.Copy())
+			return nil
+		}
+		var rawTxHex string
+		if err := client.call(false, &rawTxHex, "getrawtransaction", txHash.String()); err != nil {
+			return err
+		}
+		tx, err := parseTx(rawTxHex)
+		if err != nil {
+			return err
+		}
+		success(tx)
+		return nil
+	})
+}
+
+// HeadersSubscribe implements blockchain.Interface.
+func (client *Client) HeadersSubscribe(
+	setupAndTeardown func() func(error),
+	success func(*blockchain.Header),
+) {
+	cleanup := setup(setupAndTeardown)
+	unlock := client.lock.Lock()
+	client.headersCallbacks = append(client.headersCallbacks, success)
+	unlock()
+	client.async(cleanup, func() error {
+		var tipHeight int
+		if err := client.call(false, &tipHeight, "getblockcount"); err != nil {
+			return err
+		}
+		success(&blockchain.Header{BlockHeight: tipHeight})
+		return nil
+	})
+}
+
+// TransactionBroadcast implements blockchain.Interface.
+func (client *Client) TransactionBroadcast(transaction *wire.MsgTx) error {
+	rawTx := &bytes.Buffer{}
+	_ = transaction.BtcEncode(rawTx, 0, wire.WitnessEncoding)
+	var txID string
+	if err := client.call(false, &txID, "sendrawtransaction", hex.EncodeToString(rawTx.Bytes())); err != nil {
+		return errp.Wrap(err, "Failed to broadcast transaction")
+	}
+	if txID != transaction.TxHash().String() {
+		return errp.WithContext(errp.New("Response is unexpected (expected TX hash)"),
+			errp.Context{"response": txID})
+	}
+	return nil
+}
+
+// RelayFee implements blockchain.Interface.
+func (client *Client) RelayFee(
+	success func(btcutil.Amount),
+	cleanup func(error),
+) {
+	client.async(cleanup, func() error {
+		var networkInfo struct {
+			RelayFee float64 `json:"relayfee"`
+		}
+		if err := client.call(false, &networkInfo, "getnetworkinfo"); err != nil {
+			return err
+		}
+		amount, err := btcutil.NewAmount(networkInfo.RelayFee)
+		if err != nil {
+			return errp.Wrap(err, "Failed to construct BTC amount")
+		}
+		success(amount)
+		return nil
+	})
+}
+
+// EstimateFee implements blockchain.Interface. If the node can't estimate the fee rate, nil is
+// passed to the success callback.
+func (client *Client) EstimateFee(
+	number int,
+	success func(*btcutil.Amount),
+	cleanup func(error),
+) {
+	client.async(cleanup, func() error {
+		var estimate struct {
+			FeeRate *float64 `json:"feerate"`
+		}
+		if err := client.call(false, &estimate, "estimatesmartfee", number); err != nil {
+			return err
+		}
+		if estimate.FeeRate == nil {
+			success(nil)
+			return nil
+		}
+		amount, err := btcutil.NewAmount(*estimate.FeeRate)
+		if err != nil {
+			return errp.Wrap(err, "Failed to construct BTC amount")
+		}
+		success(&amount)
+		return nil
+	})
+}
+
+// Headers implements blockchain.Interface. At most maxHeadersPerBatch headers are returned.
+func (client *Client) Headers(
+	startHeight int, count int,
+	success func(headers []*wire.BlockHeader, max int),
+) {
+	go func() {
+		err := client.retry(func() error {
+			var tipHeight int
+			if err := client.call(false, &tipHeight, "getblockcount"); err != nil {
+				return err
+			}
+			batchSize := count
+			if batchSize > maxHeadersPerBatch {
+				batchSize = maxHeadersPerBatch
+			}
+			if tipHeight-startHeight+1 < batchSize {
+				batchSize = tipHeight - startHeight + 1
+			}
+			if batchSize < 0 {
+				batchSize = 0
+			}
+			blockHashes := make([]string, batchSize)
+			calls := make([]rpcCall, batchSize)
+			for i := range calls {
+				calls[i] = rpcCall{
+					method: "getblockhash",
+					params: []interface{}{startHeight + i},
+					result: &blockHashes[i],
+				}
+			}
+			if err := client.batch(false, calls); err != nil {
+				return err
+			}
+			headerHexes := make([]string, batchSize)
+			for i := range calls {
+				calls[i] = rpcCall{
+					method: "getblockheader",
+					params: []interface{}{blockHashes[i], false},
+					result: &headerHexes[i],
+				}
+			}
+			if err := client.batch(false, calls); err != nil {
+				return err
+			}
+			headers := make([]*wire.BlockHeader, batchSize)
+			for i, headerHex := range headerHexes {
+				headerBytes, err := hex.DecodeString(headerHex)
+				if err != nil {
+					return errp.WithStack(err)
+				}
+				headers[i] = &wire.BlockHeader{}
+				if err := headers[i].Deserialize(bytes.NewReader(headerBytes)); err != nil {
+					return errp.WithStack(err)
+				}
+			}
+			success(headers, maxHeadersPerBatch)
+			return nil
+		})
+		if err != nil && err != errClosed {
+			client.log.WithError(err).Error("Could not get headers")
+		}
+	}()
+}
+
+// GetMerkle implements blockchain.Interface.
+func (client *Client) GetMerkle(
+	txHash chainhash.Hash, height int,
+	success func(merkle []blockchain.TXHash, pos int),
+	cleanup func(error),
+) {
+	client.async(cleanup, func() error {
+		var blockHash string
+		if err := client.call(false, &blockHash, "getblockhash", height); err != nil {
+			return err
+		}
+		var block struct {
+			Tx []string `json:"tx"`
+		}
+		if err := client.call(false, &block, "getblock", blockHash, 1); err != nil {
+			return err
+		}
+		txHashes := make([]chainhash.Hash, len(block.Tx))
+		pos := -1
+		for i, txID := range block.Tx {
+			blockTxHash, err := chainhash.NewHashFromStr(txID)
+			if err != nil {
+				return errp.WithStack(err)
+			}
+			txHashes[i] = *blockTxHash
+			if *blockTxHash == txHash {
+				pos = i
+			}
+		}
+		if pos == -1 {
+			return errp.Newf("transaction %s is not in the block at height %d", txHash, height)
+		}
+		success(blockchain.MerkleBranch(txHashes, pos), pos)
+		return nil
+	})
+}
+
+// Close implements blockchain.Interface.
+func (client *Client) Close() {
+	defer client.lock.Lock()()
+	if client.closed {
+		return
+	}
+	client.closed = true
+	close(client.quitChan)
+}
+
+// ConnectionError implements blockchain.Interface.
+func (client *Client) ConnectionError() error {
+	defer client.lock.RLock()()
+	return client.connectionError
+}
+
+// RegisterOnConnectionErrorChangedEvent implements blockchain.Interface.
+func (client *Client) RegisterOnConnectionErrorChangedEvent(f func(error)) {
+	defer client.lock.Lock()()
+	client.connectionErrorCallbacks = append(client.connectionErrorCallbacks, f)
+}
@@ -0,0 +1,367 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitcoind
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode is a minimal Bitcoin Core JSON-RPC server. handlers maps method names to handlers
+// returning the result or an error.
+type fakeNode struct {
+	lock     sync.Mutex
+	handlers map[string]func(params []json.RawMessage) (interface{}, *rpcError)
+	calls    []string
+}
+
+func (node *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+	type request struct {
+		ID     int               `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	var requests []request
+	if err := json.Unmarshal(body, &requests); err != nil {
+		panic(err)
+	}
+	responses := make([]map[string]interface{}, len(requests))
+	for i, req := range requests {
+		node.lock.Lock()
+		node.calls = append(node.calls, req.Method)
+		handler, ok := node.handlers[req.Method]
+		node.lock.Unlock()
+		var result interface{}
+		var rpcErr *rpcError
+		if ok {
+			result, rpcErr = handler(req.Params)
+		} else {
+			rpcErr = &rpcError{Code: -32601, Message: "Method not found"}
+		}
+		responses[i] = map[string]interface{}{"id": req.ID, "result": result, "error": rpcErr}
+	}
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		panic(err)
+	}
+}
+
+func (node *fakeNode) called(method string) bool {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	for _, call := range node.calls {
+		if call == method {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestClient(t *testing.T, node *fakeNode) *Client {
+	t.Helper()
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+	client := NewClient(
+		config.BitcoinCoreConfig{
+			RPCURL:              server.URL,
+			RescanTimestamp:     1600000000,
+			PollIntervalSeconds: 3600,
+		},
+		server.Client(),
+		logging.Get().WithGroup("bitcoind_test"),
+	)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func txHex(tx *wire.MsgTx) string {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestScriptHashGetHistory(t *testing.T) {
+	script1 := append([]byte{0x00, 0x14}, bytes.Repeat([]byte{1}, 20)...)
+	script2 := append([]byte{0x00, 0x14}, bytes.Repeat([]byte{2}, 20)...)
+	unwatchedScript := append([]byte{0x00, 0x14}, bytes.Repeat([]byte{3}, 20)...)
+
+	// tx1 pays to script1 and is confirmed, tx2 spends it and pays to script2 and is unconfirmed.
+	tx1 := wire.NewMsgTx(2)
+	tx1.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{9}, 0), nil, nil))
+	tx1.AddTxOut(wire.NewTxOut(1000, unwatchedScript))
+	tx1.AddTxOut(wire.NewTxOut(2000, script1))
+	tx1Hash := tx1.TxHash()
+	tx2 := wire.NewMsgTx(2)
+	tx2.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&tx1Hash, 1), nil, nil))
+	tx2.AddTxOut(wire.NewTxOut(1500, script2))
+	tx2Hash := tx2.TxHash()
+	walletTxs := map[string]*wire.MsgTx{tx1Hash.String(): tx1, tx2Hash.String(): tx2}
+
+	type importRequest struct {
+		Desc      string      `json:"desc"`
+		Timestamp interface{} `json:"timestamp"`
+		Range     []int       `json:"range"`
+	}
+	var importRequests []importRequest
+	node := &fakeNode{handlers: map[string]func([]json.RawMessage) (interface{}, *rpcError){
+		"loadwallet": func([]json.RawMessage) (interface{}, *rpcError) {
+			return nil, &rpcError{Code: rpcErrWalletNotFound, Message: "not found"}
+		},
+		"createwallet": func(params []json.RawMessage) (interface{}, *rpcError) {
+			require.Equal(t, `"bitboxapp"`, string(params[0]))
+			// Watch-only.
+			require.Equal(t, "true", string(params[1]))
+			return map[string]interface{}{"name": "bitboxapp"}, nil
+		},
+		"listdescriptors": func([]json.RawMessage) (interface{}, *rpcError) {
+			return map[string]interface{}{"descriptors": []interface{}{}}, nil
+		},
+		"getdescriptorinfo": func(params []json.RawMessage) (interface{}, *rpcError) {
+			var descriptor string
+			require.NoError(t, json.Unmarshal(params[0], &descriptor))
+			return map[string]interface{}{"descriptor": descriptor + "#checksum"}, nil
+		},
+		"importdescriptors": func(params []json.RawMessage) (interface{}, *rpcError) {
+			var requests []importRequest
+			require.NoError(t, json.Unmarshal(params[0], &requests))
+			results := []interface{}{}
+			for _, request := range requests {
+				importRequests = append(importRequests, request)
+				results = append(results, map[string]interface{}{"success": true})
+			}
+			return results, nil
+		},
+		"listsinceblock": func([]json.RawMessage) (interface{}, *rpcError) {
+			return map[string]interface{}{"transactions": []interface{}{
+				map[string]interface{}{"txid": tx1Hash.String(), "confirmations": 10, "blockheight": 100},
+				map[string]interface{}{"txid": tx2Hash.String(), "confirmations": 0},
+				map[string]interface{}{"txid": tx2Hash.String(), "confirmations": 0},
+			}}, nil
+		},
+		"gettransaction": func(params []json.RawMessage) (interface{}, *rpcError) {
+			var txID string
+			require.NoError(t, json.Unmarshal(params[0], &txID))
+			return map[string]interface{}{"hex": txHex(walletTxs[txID])}, nil
+		},
+	}}
+	client := newTestClient(t, node)
+
+	getHistory := func(scriptHashHex blockchain.ScriptHashHex) (blockchain.TxHistory, error) {
+		historyChan := make(chan blockchain.TxHistory, 1)
+		errChan := make(chan error, 1)
+		client.ScriptHashGetHistory(scriptHashHex,
+			func(history blockchain.TxHistory) { historyChan <- history },
+			func(err error) { errChan <- err },
+		)
+		err := <-errChan
+		if err != nil {
+			return nil, err
+		}
+		return <-historyChan, nil
+	}
+
+	_, err := getHistory(blockchain.NewScriptHashHex(script1))
+	require.Error(t, err, "script must be watched first")
+
+	// script1 is the first script of a watched descriptor, script2 is not covered by one.
+	const descriptor = "wpkh(xpub/0/*)"
+	client.WatchDescriptor(descriptor, [][]byte{script1})
+	client.WatchScript(script1)
+	client.WatchScript(script2)
+
+	history1, err := getHistory(blockchain.NewScriptHashHex(script1))
+	require.NoError(t, err)
+	require.Equal(t, blockchain.TxHistory{
+		{Height: 100, TXHash: blockchain.TXHash(tx1Hash)},
+		{Height: 0, TXHash: blockchain.TXHash(tx2Hash)},
+	}, history1)
+	// The descriptor is rescanned from the rescan timestamp, the uncovered script is new.
+	require.ElementsMatch(t,
+		[]importRequest{
+			{Desc: descriptor + "#checksum", Timestamp: float64(1600000000), Range: []int{0, 0}},
+			{Desc: "raw(" + hex.EncodeToString(script2) + ")#checksum", Timestamp: float64(1600000000)},
+		},
+		importRequests)
+
+	history2, err := getHistory(blockchain.NewScriptHashHex(script2))
+	require.NoError(t, err)
+	require.Equal(t, blockchain.TxHistory{{Height: 0, TXHash: blockchain.TXHash(tx2Hash)}}, history2)
+
+	statusChan := make(chan string, 1)
+	client.ScriptHashSubscribe(nil, blockchain.NewScriptHashHex(script1),
+		func(status string) { statusChan <- status })
+	require.Equal(t, history1.Status(), <-statusChan)
+
+	// Only new scripts are imported.
+	importRequests = nil
+	client.WatchScript(unwatchedScript)
+	_, err = getHistory(blockchain.NewScriptHashHex(unwatchedScript))
+	require.NoError(t, err)
+	require.Equal(t,
+		[]importRequest{{
+			Desc:      "raw(" + hex.EncodeToString(unwatchedScript) + ")#checksum",
+			Timestamp: float64(1600000000),
+		}},
+		importRequests)
+
+	// Extending the range of a watched descriptor re-imports it with the rescan timestamp.
+	importRequests = nil
+	client.WatchDescriptor(descriptor, [][]byte{script1, script2})
+	_, err = getHistory(blockchain.NewScriptHashHex(script1))
+	require.NoError(t, err)
+	require.Equal(t,
+		[]importRequest{{Desc: descriptor + "#checksum", Timestamp: float64(1600000000), Range: []int{0, 1}}},
+		importRequests)
+	require.Equal(t, map[string]int{descriptor: 2}, client.importedDescriptors)
+
+	// Wallet transactions are cached.
+	txChan := make(chan *wire.MsgTx, 1)
+	client.TransactionGet(tx2Hash, func(tx *wire.MsgTx) { txChan <- tx }, func(error) {})
+	require.Equal(t, tx2Hash, (<-txChan).TxHash())
+	require.False(t, node.called("getrawtransaction"))
+}
+
+func TestEnsureWalletAlreadyLoaded(t *testing.T) {
+	node := &fakeNode{handlers: map[string]func([]json.RawMessage) (interface{}, *rpcError){
+		"loadwallet": func([]json.RawMessage) (interface{}, *rpcError) {
+			return nil, &rpcError{Code: rpcErrWalletAlreadyLoaded, Message: "already loaded"}
+		},
+		"listdescriptors": func([]json.RawMessage) (interface{}, *rpcError) {
+			return map[string]interface{}{"descriptors": []interface{}{
+				map[string]interface{}{"desc": "raw(0014AA)#checksum"},
+				map[string]interface{}{
+					"desc":  "wpkh([d34db33f/84h/0h/0h]xpub/0/*)#checksum",
+					"range": []int{0, 999},
+				},
+			}}, nil
+		},
+	}}
+	client := newTestClient(t, node)
+	require.NoError(t, client.ensureWallet())
+	require.Equal(t, map[string]bool{"0014aa": true}, client.imported)
+	require.Equal(t, map[string]int{"wpkh([d34db33f/84h/0h/0h]xpub/0/*)": 1000}, client.importedDescriptors)
+	require.False(t, node.called("createwallet"))
+}
+
+func TestEstimateFee(t *testing.T) {
+	feeRate := 0.0001
+	node := &fakeNode{handlers: map[string]func([]json.RawMessage) (interface{}, *rpcError){
+		"estimatesmartfee": func(params []json.RawMessage) (interface{}, *rpcError) {
+			if string(params[0]) == "2" {
+				return map[string]interface{}{"feerate": feeRate, "blocks": 2}, nil
+			}
+			return map[string]interface{}{"errors": []string{"Insufficient data"}, "blocks": 0}, nil
+		},
+	}}
+	client := newTestClient(t, node)
+
+	estimate := func(blocks int) *btcutil.Amount {
+		resultChan := make(chan *btcutil.Amount, 1)
+		errChan := make(chan error, 1)
+		client.EstimateFee(blocks,
+			func(amount *btcutil.Amount) { resultChan <- amount },
+			func(err error) { errChan <- err })
+		require.NoError(t, <-errChan)
+		return <-resultChan
+	}
+	amount := estimate(2)
+	require.NotNil(t, amount)
+	require.Equal(t, btcutil.Amount(10000), *amount)
+	require.Nil(t, estimate(25))
+}
+
+func TestGetMerkle(t *testing.T) {
+	txHashes := []chainhash.Hash{{1}, {2}, {3}, {4}, {5}}
+	txIDs := make([]string, len(txHashes))
+	for i, txHash := range txHashes {
+		txIDs[i] = txHash.String()
+	}
+	node := &fakeNode{handlers: map[string]func([]json.RawMessage) (interface{}, *rpcError){
+		"getblockhash": func(params []json.RawMessage) (interface{}, *rpcError) {
+			require.Equal(t, "100", string(params[0]))
+			return strings.Repeat("ab", 32), nil
+		},
+		"getblock": func(params []json.RawMessage) (interface{}, *rpcError) {
+			return map[string]interface{}{"tx": txIDs}, nil
+		},
+	}}
+	client := newTestClient(t, node)
+
+	// Merkle root of the block, computed level by level.
+	level := append([]chainhash.Hash(nil), txHashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := []chainhash.Hash{}
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, chainhash.DoubleHashH(append(level[i][:], level[i+1][:]...)))
+		}
+		level = next
+	}
+	merkleRoot := level[0]
+
+	for expectedPos, txHash := range txHashes {
+		type result struct {
+			merkle []blockchain.TXHash
+			pos    int
+		}
+		resultChan := make(chan result, 1)
+		errChan := make(chan error, 1)
+		client.GetMerkle(txHash, 100,
+			func(merkle []blockchain.TXHash, pos int) { resultChan <- result{merkle, pos} },
+			func(err error) { errChan <- err })
+		require.NoError(t, <-errChan)
+		res := <-resultChan
+		require.Equal(t, expectedPos, res.pos)
+
+		// Same as the verification in the transactions package.
+		root := txHash
+		for i, sibling := range res.merkle {
+			if (res.pos>>uint(i))&1 == 0 {
+				root = chainhash.DoubleHashH(append(root[:], sibling[:]...))
+			} else {
+				root = chainhash.DoubleHashH(append(sibling[:], root[:]...))
+			}
+		}
+		require.Equal(t, merkleRoot, root)
+	}
+
+	errChan := make(chan error, 1)
+	client.GetMerkle(chainhash.Hash{6}, 100,
+		func([]blockchain.TXHash, int) {},
+		func(err error) { errChan <- err })
+	require.Error(t, <-errChan)
+}
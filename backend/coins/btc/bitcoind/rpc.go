@@ -0,0 +1,160 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitcoind
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+const (
+	// rpcErrWalletNotFound is returned by loadwallet if the wallet does not exist.
+	rpcErrWalletNotFound = -18
+	// rpcErrWalletAlreadyLoaded is returned by loadwallet if the wallet is already loaded.
+	rpcErrWalletAlreadyLoaded = -35
+)
+
+// rpcError is an error returned by the node in response to a call.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error.
+func (err *rpcError) Error() string {
+	return fmt.Sprintf("bitcoind error %d: %s", err.Code, err.Message)
+}
+
+// connectionError is returned if the node could not be reached or did not respond with a valid
+// JSON-RPC response. Calls which failed with a connection error are retried.
+type connectionError struct {
+	error
+}
+
+func isConnectionError(err error) bool {
+	_, ok := errp.Cause(err).(connectionError)
+	return ok
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// rpcCall is one call of a batch. The result of the call is json-deserialized into result, which
+// can be nil if the result is not needed.
+type rpcCall struct {
+	method string
+	params []interface{}
+	result interface{}
+}
+
+func (client *Client) endpoint(wallet bool) string {
+	if !wallet {
+		return client.config.RPCURL
+	}
+	return client.config.RPCURL + "/wallet/" + url.PathEscape(client.walletName())
+}
+
+// post sends the JSON-RPC request body to the node and json-deserializes the response into
+// response.
+func (client *Client) post(wallet bool, body interface{}, response interface{}) error {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	request, err := http.NewRequest(http.MethodPost, client.endpoint(wallet), bytes.NewReader(requestBody))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.SetBasicAuth(client.config.RPCUser, client.config.RPCPassword)
+	httpResponse, err := client.httpClient.Do(request)
+	if err != nil {
+		return connectionError{errp.WithStack(err)}
+	}
+	defer func() { _ = httpResponse.Body.Close() }()
+	responseBody, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return connectionError{errp.WithStack(err)}
+	}
+	// Bitcoin Core responds with an error status code and a JSON-RPC error in the body if a call
+	// fails, so the status code is only checked if the body can't be decoded.
+	if err := json.Unmarshal(responseBody, response); err != nil {
+		return connectionError{errp.Newf("unexpected response from the node (status %d)", httpResponse.StatusCode)}
+	}
+	return nil
+}
+
+// call performs a single JSON-RPC call. If wallet is true, the call is sent to the wallet
+// endpoint of the node.
+func (client *Client) call(wallet bool, result interface{}, method string, params ...interface{}) error {
+	return client.batch(wallet, []rpcCall{{method: method, params: params, result: result}})
+}
+
+// batch performs all calls in a single JSON-RPC batch request. The first error returned by the
+// node is returned.
+func (client *Client) batch(wallet bool, calls []rpcCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	requests := make([]rpcRequest, len(calls))
+	for i, call := range calls {
+		params := call.params
+		if params == nil {
+			params = []interface{}{}
+		}
+		requests[i] = rpcRequest{JSONRPC: "1.0", ID: i, Method: call.method, Params: params}
+	}
+	var responses []rpcResponse
+	err := client.post(wallet, requests, &responses)
+	client.setConnectionError(err)
+	if err != nil {
+		return err
+	}
+	if len(responses) != len(calls) {
+		return errp.Newf("expected %d responses, got %d", len(calls), len(responses))
+	}
+	for _, response := range responses {
+		if response.ID < 0 || response.ID >= len(calls) {
+			return errp.Newf("unexpected response id %d", response.ID)
+		}
+		call := calls[response.ID]
+		if response.Error != nil {
+			return errp.WithMessage(response.Error, call.method)
+		}
+		if call.result == nil {
+			continue
+		}
+		if err := json.Unmarshal(response.Result, call.result); err != nil {
+			return errp.Wrap(err, call.method)
+		}
+	}
+	return nil
+}
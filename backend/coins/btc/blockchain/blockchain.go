@@ -19,6 +19,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
@@ -79,6 +80,49 @@ func (history TxHistory) Status() string {
 	return hex.EncodeToString(chainhash.HashB(status.Bytes()))
 }
 
+// Sort sorts the history in the order of the Electrum protocol: confirmed transactions by height,
+// followed by the unconfirmed transactions. Transactions with the same height are sorted by hash.
+func (history TxHistory) Sort() {
+	key := func(txInfo *TxInfo) int {
+		if txInfo.Height <= 0 {
+			// Unconfirmed transactions with unconfirmed parents (-1) come last.
+			return int(^uint(0)>>1) - 1 - txInfo.Height
+		}
+		return txInfo.Height
+	}
+	sort.Slice(history, func(i, j int) bool {
+		keyI, keyJ := key(history[i]), key(history[j])
+		if keyI != keyJ {
+			return keyI < keyJ
+		}
+		hashI, hashJ := history[i].TXHash.Hash(), history[j].TXHash.Hash()
+		return hashI.String() < hashJ.String()
+	})
+}
+
+// MerkleBranch returns the merkle branch of the transaction at position pos of a block with the
+// given transactions, in the format returned by GetMerkle().
+func MerkleBranch(txHashes []chainhash.Hash, pos int) []TXHash {
+	branch := []TXHash{}
+	level := append([]chainhash.Hash(nil), txHashes...)
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, TXHash(level[pos^1]))
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			var concatenated [chainhash.HashSize * 2]byte
+			copy(concatenated[:chainhash.HashSize], level[2*i][:])
+			copy(concatenated[chainhash.HashSize:], level[2*i+1][:])
+			next[i] = chainhash.DoubleHashH(concatenated[:])
+		}
+		level = next
+		pos /= 2
+	}
+	return branch
+}
+
 // ScriptHashHex is the hash of a pkScript in reverse hex format. Always 64 chars.
 type ScriptHashHex string
 
@@ -109,3 +153,48 @@ type Interface interface {
 	ConnectionError() error
 	RegisterOnConnectionErrorChangedEvent(func(error))
 }
+
+// ScriptWatcher is implemented by backends which can't look up the history of arbitrary script
+// hashes, like a Bitcoin Core node. The pubkey script of a script hash must be passed to
+// WatchScript() before subscribing to the script hash or fetching its history.
+//
+// WatchDescriptor() passes the ranged output descriptor of an address chain, e.g.
+// "wpkh(xpub.../0/*)", along with the pubkey scripts of its first addresses. It should be called
+// before watching the scripts of the chain, so the backend can look up the history of all
+// addresses of the chain at once. Scripts which are not covered by a watched descriptor are
+// assumed to be new and have no history before they were watched.
+type ScriptWatcher interface {
+	WatchScript(pkScript []byte)
+	WatchDescriptor(descriptor string, pkScripts [][]byte)
+}
+
+// DiscrepancyKind is the kind of answer two servers disagree on. See the list of consts below.
+type DiscrepancyKind string
+
+const (
+	// DiscrepancyKindHistory means the servers returned different confirmed transactions for the
+	// history of a script hash.
+	DiscrepancyKindHistory DiscrepancyKind = "history"
+	// DiscrepancyKindFee means the fee estimates of the servers differ substantially.
+	DiscrepancyKindFee DiscrepancyKind = "fee"
+)
+
+// Discrepancy is a disagreement between two servers found by cross-checking their answers. It
+// indicates that one of them is lying or omitting data.
+type Discrepancy struct {
+	Kind DiscrepancyKind `json:"kind"`
+	// ScriptHashHex is the script hash with different histories, only set for
+	// DiscrepancyKindHistory.
+	ScriptHashHex ScriptHashHex `json:"scriptHashHex,omitempty"`
+	// Servers are the names of the two servers which disagree.
+	Servers []string `json:"servers"`
+}
+
+// DiscrepancyReporter is implemented by backends which cross-check the answers of multiple servers.
+type DiscrepancyReporter interface {
+	// Discrepancies returns the unresolved discrepancies.
+	Discrepancies() []Discrepancy
+	// RegisterOnDiscrepanciesChangedEvent registers a callback which is called when a discrepancy is
+	// found or resolved.
+	RegisterOnDiscrepanciesChangedEvent(func())
+}
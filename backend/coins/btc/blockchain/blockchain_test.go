@@ -0,0 +1,50 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxHistorySort(t *testing.T) {
+	txInfo := func(hash byte, height int) *blockchain.TxInfo {
+		return &blockchain.TxInfo{TXHash: blockchain.TXHash(chainhash.Hash{hash}), Height: height}
+	}
+	history := blockchain.TxHistory{
+		txInfo(1, -1),
+		txInfo(2, 0),
+		txInfo(3, 5),
+		txInfo(4, 0),
+		txInfo(5, 3),
+		txInfo(6, 3),
+	}
+	history.Sort()
+	// Confirmed by height, then unconfirmed, then unconfirmed with unconfirmed parents. Ties are
+	// broken by the hash.
+	require.Equal(t,
+		blockchain.TxHistory{
+			txInfo(5, 3),
+			txInfo(6, 3),
+			txInfo(3, 5),
+			txInfo(2, 0),
+			txInfo(4, 0),
+			txInfo(1, -1),
+		},
+		history)
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// lookupChangeAddress returns the change address with the given script hash, or nil if it is not
+// a change address of this account.
+func (account *Account) lookupChangeAddress(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+	for _, subacc := range account.subaccounts {
+		if address := subacc.changeAddresses.LookupByScriptHashHex(scriptHashHex); address != nil {
+			return address
+		}
+	}
+	return nil
+}
+
+// toUTXOs converts the outputs to the inputs for maketx.
+func (account *Account) toUTXOs(
+	outputs map[wire.OutPoint]*transactions.SpendableOutput) map[wire.OutPoint]maketx.UTXO {
+	utxos := make(map[wire.OutPoint]maketx.UTXO, len(outputs))
+	for outPoint, txOut := range outputs {
+		utxos[outPoint] = maketx.UTXO{
+			TxOut:         txOut.TxOut,
+			Configuration: account.getAddress(txOut.ScriptHashHex()).Configuration,
+			Height:        txOut.Height,
+		}
+	}
+	return utxos
+}
+
+// BumpFee replaces the unconfirmed outgoing transaction with the given ID by a transaction paying
+// the higher fee rate feeRatePerKb (BIP-125 replace-by-fee). The recipients are kept. The fee
+// increase is deducted from the change; if that is not enough, more coins are added. The
+// replacement is signed by the keystore and broadcast, and its transaction ID is returned.
+// Transactions whose outputs we already spent can't be replaced, see
+// transactions.ReplaceableTx().
+//
+// For multisig accounts, the replacement becomes the pending multisig transaction and
+// ErrMultisigSignaturesMissing is returned if more cosigners need to sign.
+func (account *Account) BumpFee(txID string, feeRatePerKb btcutil.Amount) (string, error) {
+	txHash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return "", errp.WithStack(err)
+	}
+	minRelayFeeRate := account.getMinRelayFeeRate()
+	if feeRatePerKb < minRelayFeeRate {
+		return "", errp.WithStack(errors.ErrFeeTooLow)
+	}
+	tx, previousOutputs, err := account.transactions.ReplaceableTx(*txHash)
+	if err != nil {
+		return "", err
+	}
+	var changeAddress *addresses.AccountAddress
+	for _, txOut := range tx.TxOut {
+		if address := account.lookupChangeAddress(blockchain.NewScriptHashHex(txOut.PkScript)); address != nil {
+			changeAddress = address
+			break
+		}
+	}
+	// New inputs must be confirmed, as required by BIP-125. Frozen coins are not spent.
+	spendableOutputs := account.transactions.ConfirmedSpendableOutputs()
+	for outPoint := range spendableOutputs {
+		if account.isUTXOFrozen(outPoint) {
+			delete(spendableOutputs, outPoint)
+		}
+	}
+
+	account.log.WithField("fee-rate", feeRatePerKb).Info("Bumping the fee of a transaction")
+	txProposal, err := maketx.NewTxBumpFee(
+		account.coin,
+		tx,
+		account.toUTXOs(previousOutputs),
+		changeAddress,
+		account.toUTXOs(spendableOutputs),
+		// Change address is of the first subaccount, always.
+		account.subaccounts[0].changeAddresses.GetUnused()[0],
+		feeRatePerKb,
+		minRelayFeeRate,
+		account.log,
+	)
+	if err != nil {
+		return "", err
+	}
+	for outPoint, spendableOutput := range spendableOutputs {
+		previousOutputs[outPoint] = spendableOutput
+	}
+	note := account.TxNote(txID)
+	newTxID := txProposal.Transaction.TxHash().String()
+
+	if account.IsMultisig() {
+		if err := account.sendMultisigTx(txProposal, previousOutputs, note); err != nil {
+			return "", err
+		}
+		return newTxID, nil
+	}
+	if err := account.signTransaction(txProposal, previousOutputs, account.getPrevTx); err != nil {
+		return "", errp.WithMessage(err, "Failed to sign transaction")
+	}
+	account.log.Info("Signed replacement transaction is broadcasted")
+	if err := account.coin.Blockchain().TransactionBroadcast(txProposal.Transaction); err != nil {
+		return "", err
+	}
+	if err := account.SetTxNote(newTxID, note); err != nil {
+		// Not critical.
+		account.log.WithError(err).Error("Failed to save transaction note when bumping the fee")
+	}
+	return newTxID, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	accountErrors "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	keystoreMock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBumpFeeFrozen checks that frozen coins are not added to a replacement transaction.
+func TestBumpFeeFrozen(t *testing.T) {
+	txs := map[chainhash.Hash]*wire.MsgTx{}
+	histories := map[blockchain.ScriptHashHex]blockchain.TxHistory{}
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	var subscriptionsMu sync.Mutex
+	subscriptions := map[blockchain.ScriptHashHex]func(string){}
+	blockchainMock.MockScriptHashSubscribe = func(
+		setupAndTeardown func() func(error), scriptHash blockchain.ScriptHashHex, success func(string)) {
+		subscriptionsMu.Lock()
+		defer subscriptionsMu.Unlock()
+		subscriptions[scriptHash] = success
+		setupAndTeardown()(nil)
+	}
+	blockchainMock.MockScriptHashGetHistory = func(
+		scriptHash blockchain.ScriptHashHex, success func(blockchain.TxHistory), cleanup func(error)) {
+		go func() {
+			success(histories[scriptHash])
+			cleanup(nil)
+		}()
+	}
+	blockchainMock.MockTransactionGet = func(
+		txHash chainhash.Hash, success func(*wire.MsgTx), cleanup func(error)) {
+		go func() {
+			success(txs[txHash])
+			cleanup(nil)
+		}()
+	}
+	signErr := errors.New("signing is not needed in this test")
+	keystore := &keystoreMock.KeystoreMock{
+		SignTransactionFunc: func(interface{}) error { return signErr },
+	}
+	account, cleanup := newTestAccount(t, blockchainMock, keystore)
+	defer cleanup()
+
+	receiveAddresses := account.GetUnusedReceiveAddresses()[0]
+	address := func(index int) *addresses.AccountAddress {
+		return receiveAddresses[index].(*addresses.AccountAddress)
+	}
+	// A confirmed transaction funding two of our addresses.
+	fundingTx := wire.NewMsgTx(wire.TxVersion)
+	fundingTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	fundingTx.AddTxOut(wire.NewTxOut(100000, address(0).PubkeyScript()))
+	fundingTx.AddTxOut(wire.NewTxOut(50000, address(1).PubkeyScript()))
+	// An unconfirmed transaction spending the first output, without change.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0), nil, nil))
+	tx.TxIn[0].PreviousOutPoint.Hash = fundingTx.TxHash()
+	tx.TxIn[0].Sequence = wire.MaxTxInSequenceNum - 2
+	tx.AddTxOut(wire.NewTxOut(99000, []byte{txscript.OP_0, txscript.OP_DATA_20,
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	for _, tx := range []*wire.MsgTx{fundingTx, tx} {
+		txs[tx.TxHash()] = tx
+	}
+	histories[address(0).PubkeyScriptHashHex()] = blockchain.TxHistory{
+		{TXHash: blockchain.TXHash(fundingTx.TxHash()), Height: 10},
+		{TXHash: blockchain.TXHash(tx.TxHash()), Height: 0},
+	}
+	histories[address(1).PubkeyScriptHashHex()] = blockchain.TxHistory{
+		{TXHash: blockchain.TXHash(fundingTx.TxHash()), Height: 10},
+	}
+	// Notify the account about the new history of the addresses.
+	for scriptHash, history := range histories {
+		subscriptionsMu.Lock()
+		notify := subscriptions[scriptHash]
+		subscriptionsMu.Unlock()
+		notify(history.Status())
+	}
+
+	// The fee increase can only be paid by adding the second output, which is frozen.
+	frozenOutPoint := wire.OutPoint{Hash: fundingTx.TxHash(), Index: 1}
+	require.NoError(t, account.SetUTXOFrozen(frozenOutPoint.String(), true))
+	_, err := account.BumpFee(tx.TxHash().String(), 50000)
+	require.Equal(t, accountErrors.ErrInsufficientFunds, errp.Cause(err))
+
+	// Once unfrozen, the output is added and the replacement goes to signing.
+	require.NoError(t, account.SetUTXOFrozen(frozenOutPoint.String(), false))
+	_, err = account.BumpFee(tx.TxHash().String(), 50000)
+	require.Equal(t, signErr, errp.Cause(err))
+}
@@ -0,0 +1,888 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cfilters implements finding the transactions of a wallet using BIP-158 compact block
+// filters downloaded from P2P peers (BIP-157). See Client for more details.
+package cfilters
+
+import (
+	"sync"
+	"time"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/gcs"
+	"github.com/btcsuite/btcutil/gcs/builder"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// maxFiltersPerRequest is the maximum number of filters which can be requested at once, see
+	// BIP-157.
+	maxFiltersPerRequest = 1000
+	// scanDelay is how long to wait for more scripts to be watched before starting a scan, as new
+	// scripts require a rescan.
+	scanDelay = 200 * time.Millisecond
+	// retryInterval is how long to wait before retrying a failed scan.
+	retryInterval = 30 * time.Second
+)
+
+type relevantTx struct {
+	tx     *wire.MsgTx
+	height int
+}
+
+// scanState is the result of scanning the blocks from the configured start height for a set of
+// scripts.
+type scanState struct {
+	scripts map[blockchain.ScriptHashHex]struct{}
+	// height is the height of the last scanned block, or the start height minus one if no block was
+	// scanned yet.
+	height    int
+	blockHash chainhash.Hash
+	// filterHeader is the filter header of the last scanned block, nil if no block was scanned yet.
+	filterHeader *chainhash.Hash
+	// transactions are all transactions paying to or spending from one of the scripts.
+	transactions map[chainhash.Hash]*relevantTx
+	outpoints    map[wire.OutPoint]struct{}
+	// blockTxHashes contains the transaction hashes of each block with relevant transactions, by
+	// height, to compute merkle branches.
+	blockTxHashes map[int][]chainhash.Hash
+}
+
+func newScanState(scripts map[blockchain.ScriptHashHex][]byte, height int) *scanState {
+	state := &scanState{
+		scripts:       map[blockchain.ScriptHashHex]struct{}{},
+		height:        height,
+		transactions:  map[chainhash.Hash]*relevantTx{},
+		outpoints:     map[wire.OutPoint]struct{}{},
+		blockTxHashes: map[int][]chainhash.Hash{},
+	}
+	for scriptHashHex := range scripts {
+		state.scripts[scriptHashHex] = struct{}{}
+	}
+	return state
+}
+
+// copy returns a copy of the state which can be modified while the original is in use.
+func (state *scanState) copy() *scanState {
+	stateCopy := *state
+	stateCopy.scripts = make(map[blockchain.ScriptHashHex]struct{}, len(state.scripts))
+	for scriptHashHex := range state.scripts {
+		stateCopy.scripts[scriptHashHex] = struct{}{}
+	}
+	stateCopy.transactions = make(map[chainhash.Hash]*relevantTx, len(state.transactions))
+	for txHash, tx := range state.transactions {
+		stateCopy.transactions[txHash] = tx
+	}
+	stateCopy.outpoints = make(map[wire.OutPoint]struct{}, len(state.outpoints))
+	for outpoint := range state.outpoints {
+		stateCopy.outpoints[outpoint] = struct{}{}
+	}
+	stateCopy.blockTxHashes = make(map[int][]chainhash.Hash, len(state.blockTxHashes))
+	for height, txHashes := range state.blockTxHashes {
+		stateCopy.blockTxHashes[height] = txHashes
+	}
+	return &stateCopy
+}
+
+// merge adds the scripts and transactions of other, which is the result of scanning the same
+// blocks for other scripts.
+func (state *scanState) merge(other *scanState) {
+	for scriptHashHex := range other.scripts {
+		state.scripts[scriptHashHex] = struct{}{}
+	}
+	for txHash, tx := range other.transactions {
+		state.transactions[txHash] = tx
+	}
+	for outpoint := range other.outpoints {
+		state.outpoints[outpoint] = struct{}{}
+	}
+	for height, txHashes := range other.blockTxHashes {
+		state.blockTxHashes[height] = txHashes
+	}
+}
+
+// processBlock adds the transactions of a block which pay to or spend from one of the scripts.
+func (state *scanState) processBlock(block *wire.MsgBlock, height int) {
+	txHashes := make([]chainhash.Hash, len(block.Transactions))
+	relevantBlock := false
+	for i, tx := range block.Transactions {
+		txHash := tx.TxHash()
+		txHashes[i] = txHash
+		relevant := false
+		for _, txIn := range tx.TxIn {
+			if _, ok := state.outpoints[txIn.PreviousOutPoint]; ok {
+				relevant = true
+			}
+		}
+		for index, txOut := range tx.TxOut {
+			if _, ok := state.scripts[blockchain.NewScriptHashHex(txOut.PkScript)]; ok {
+				state.outpoints[*wire.NewOutPoint(&txHash, uint32(index))] = struct{}{}
+				relevant = true
+			}
+		}
+		if relevant {
+			state.transactions[txHash] = &relevantTx{tx: tx, height: height}
+			relevantBlock = true
+		}
+	}
+	if relevantBlock {
+		state.blockTxHashes[height] = txHashes
+	}
+}
+
+// verifiedFilter is the filter hash of a block, which all peers agreed on, and its filter header.
+type verifiedFilter struct {
+	hash   chainhash.Hash
+	header chainhash.Hash
+}
+
+type historyRequest struct {
+	scriptHashHex blockchain.ScriptHashHex
+	// subscribe is true if the status of the script hash is delivered to the subscribers from now
+	// on.
+	subscribe bool
+	respond   func(blockchain.TxHistory)
+}
+
+// Client is a blockchain.Interface which finds the transactions of the watched scripts by matching
+// them against the BIP-158 compact block filters of all blocks since the configured start height.
+// The filters are downloaded from P2P peers (BIP-157) and checked against the filter headers of all
+// peers, and only the matching blocks are downloaded, so the scripts are never revealed.
+//
+// The headers come from the headers package (see SetHeaders()). All other requests, like fee
+// estimates and broadcasting, are forwarded to the wrapped backend, which also serves the
+// transactions which are not part of the history of a watched script, e.g. the previous
+// transactions of inputs.
+//
+// Unconfirmed incoming transactions can't be found using block filters. Only unconfirmed
+// transactions broadcast using this client appear in the histories until they are confirmed.
+//
+// New scripts, added by WatchScript(), require a rescan from the start height for the new scripts
+// only. The verified filter hashes are cached, so they are not fetched from all peers again. Reorgs
+// require a rescan for all scripts.
+type Client struct {
+	blockchain.Interface
+
+	config config.CompactFiltersConfig
+	net    *chaincfg.Params
+	dialer proxy.Dialer
+
+	// scanLock serializes scans.
+	scanLock sync.Mutex
+	// verifiedFilters caches the verified filters by block hash. Guarded by scanLock.
+	verifiedFilters map[chainhash.Hash]verifiedFilter
+
+	peersLock sync.Mutex
+	peers     []*peer
+
+	lock    locker.Locker
+	headers headers.Interface
+	scripts map[blockchain.ScriptHashHex][]byte
+	state   *scanState
+	// unconfirmed contains the transactions broadcast by this client which are not confirmed yet.
+	unconfirmed     map[chainhash.Hash]*wire.MsgTx
+	histories       map[blockchain.ScriptHashHex]blockchain.TxHistory
+	pendingRequests []*historyRequest
+
+	scriptHashCallbacks map[blockchain.ScriptHashHex][]func(string)
+	// statuses contains the last status passed to the callbacks of each subscribed script hash.
+	statuses map[blockchain.ScriptHashHex]string
+
+	p2pError                 error
+	connectionErrorCallbacks []func(error)
+
+	closed   bool
+	kickChan chan struct{}
+	quitChan chan struct{}
+
+	log *logrus.Entry
+}
+
+var _ blockchain.Interface = &Client{}
+var _ blockchain.ScriptWatcher = &Client{}
+
+// NewClient creates a new client, which forwards all requests except for the script hash
+// histories to backend.
+func NewClient(
+	backend blockchain.Interface,
+	conf config.CompactFiltersConfig,
+	net *chaincfg.Params,
+	dialer proxy.Dialer,
+	log *logrus.Entry,
+) *Client {
+	client := &Client{
+		Interface:           backend,
+		config:              conf,
+		net:                 net,
+		dialer:              dialer,
+		verifiedFilters:     map[chainhash.Hash]verifiedFilter{},
+		scripts:             map[blockchain.ScriptHashHex][]byte{},
+		unconfirmed:         map[chainhash.Hash]*wire.MsgTx{},
+		histories:           map[blockchain.ScriptHashHex]blockchain.TxHistory{},
+		scriptHashCallbacks: map[blockchain.ScriptHashHex][]func(string){},
+		statuses:            map[blockchain.ScriptHashHex]string{},
+		kickChan:            make(chan struct{}, 1),
+		quitChan:            make(chan struct{}),
+		log:                 log.WithField("group", "cfilters"),
+	}
+	go client.scanLoop()
+	return client
+}
+
+// SetHeaders sets the verified headers, which must be synced by the wrapped backend. Blocks are
+// scanned up to the verified tip.
+func (client *Client) SetHeaders(theHeaders headers.Interface) {
+	unlock := client.lock.Lock()
+	client.headers = theHeaders
+	unlock()
+	theHeaders.SubscribeEvent(func(event headers.Event) {
+		if event == headers.EventSynced {
+			client.kick()
+		}
+	})
+	client.kick()
+}
+
+func (client *Client) kick() {
+	select {
+	case client.kickChan <- struct{}{}:
+	default:
+	}
+}
+
+func (client *Client) scanLoop() {
+	for {
+		select {
+		case <-client.quitChan:
+			return
+		case <-client.kickChan:
+		}
+		select {
+		case <-client.quitChan:
+			return
+		case <-time.After(scanDelay):
+		}
+		for {
+			err := client.scan()
+			client.setP2PError(err)
+			if err == nil {
+				break
+			}
+			client.log.WithError(err).Error("Scanning the compact block filters failed")
+			client.closePeers()
+			select {
+			case <-client.quitChan:
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+}
+
+func (client *Client) setP2PError(err error) {
+	unlock := client.lock.Lock()
+	changed := (client.p2pError == nil) != (err == nil)
+	client.p2pError = err
+	callbacks := client.connectionErrorCallbacks
+	unlock()
+	if changed {
+		for _, callback := range callbacks {
+			callback(err)
+		}
+	}
+}
+
+// connectedPeers returns the connected peers, connecting to the configured peers if there are
+// none. Peers which can't be reached are skipped.
+func (client *Client) connectedPeers() ([]*peer, error) {
+	client.peersLock.Lock()
+	defer client.peersLock.Unlock()
+	if len(client.peers) > 0 {
+		return client.peers, nil
+	}
+	if len(client.config.Peers) == 0 {
+		return nil, errp.New("No compact block filters peers configured")
+	}
+	var lastErr error
+	for _, address := range client.config.Peers {
+		p, err := connectPeer(address, client.net, client.dialer)
+		if err != nil {
+			client.log.WithError(err).WithField("peer", address).Warning("Could not connect to peer")
+			lastErr = err
+			continue
+		}
+		client.peers = append(client.peers, p)
+	}
+	if len(client.peers) == 0 {
+		return nil, lastErr
+	}
+	return client.peers, nil
+}
+
+func (client *Client) closePeers() {
+	client.peersLock.Lock()
+	defer client.peersLock.Unlock()
+	for _, p := range client.peers {
+		p.close()
+	}
+	client.peers = nil
+}
+
+// filterHashes fetches the filter hashes of the count blocks from startHeight up to the block with
+// the hash stopHash from all peers, and returns them if all peers agree. The filter header of the
+// block before startHeight is returned as well.
+func (client *Client) filterHashes(peers []*peer, startHeight int, stopHash chainhash.Hash, count int) (
+	[]chainhash.Hash, chainhash.Hash, error) {
+	var result *wire.MsgCFHeaders
+	var resultPeer *peer
+	for _, p := range peers {
+		cfHeaders, err := p.getCFHeaders(startHeight, stopHash)
+		if err != nil {
+			return nil, chainhash.Hash{}, err
+		}
+		if len(cfHeaders.FilterHashes) != count {
+			return nil, chainhash.Hash{}, errp.Newf(
+				"Peer %s returned %d filter hashes, expected %d", p.address, len(cfHeaders.FilterHashes), count)
+		}
+		if result == nil {
+			result, resultPeer = cfHeaders, p
+			continue
+		}
+		agree := cfHeaders.PrevFilterHeader == result.PrevFilterHeader
+		for i := range cfHeaders.FilterHashes {
+			agree = agree && *cfHeaders.FilterHashes[i] == *result.FilterHashes[i]
+		}
+		if !agree {
+			return nil, chainhash.Hash{}, errp.Newf(
+				"Peers %s and %s disagree on the filter headers", resultPeer.address, p.address)
+		}
+	}
+	filterHashes := make([]chainhash.Hash, count)
+	for i, filterHash := range result.FilterHashes {
+		filterHashes[i] = *filterHash
+	}
+	return filterHashes, result.PrevFilterHeader, nil
+}
+
+func matchFilter(data []byte, blockHash chainhash.Hash, scripts [][]byte) (bool, error) {
+	filter, err := gcs.FromNBytes(builder.DefaultP, builder.DefaultM, data)
+	if err != nil {
+		return false, errp.WithStack(err)
+	}
+	if filter.N() == 0 {
+		return false, nil
+	}
+	matched, err := filter.MatchAny(builder.DeriveKey(&blockHash), scripts)
+	return matched, errp.WithStack(err)
+}
+
+// checkMerkleRoot checks that the transactions of the block match the merkle root of the header.
+func checkMerkleRoot(block *wire.MsgBlock, header *wire.BlockHeader) error {
+	txs := make([]*btcutil.Tx, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txs[i] = btcutil.NewTx(tx)
+	}
+	merkles := btcdBlockchain.BuildMerkleTreeStore(txs, false)
+	if len(merkles) == 0 || *merkles[len(merkles)-1] != header.MerkleRoot {
+		return errp.Newf("Block %s does not match the merkle root of its header", header.BlockHash())
+	}
+	return nil
+}
+
+// scan scans the blocks up to the verified tip for the transactions of the watched scripts. If new
+// scripts were added since the last scan, the scanned blocks are rescanned for the new scripts. If
+// the chain was reorganized, all blocks are rescanned.
+func (client *Client) scan() error {
+	client.scanLock.Lock()
+	defer client.scanLock.Unlock()
+
+	unlock := client.lock.RLock()
+	theHeaders := client.headers
+	scripts := make(map[blockchain.ScriptHashHex][]byte, len(client.scripts))
+	for scriptHashHex, script := range client.scripts {
+		scripts[scriptHashHex] = script
+	}
+	previous := client.state
+	unlock()
+	if theHeaders == nil || len(scripts) == 0 {
+		return nil
+	}
+	status, err := theHeaders.Status()
+	if err != nil {
+		return err
+	}
+
+	rescan := previous == nil
+	if !rescan && previous.filterHeader != nil {
+		header, err := theHeaders.VerifiedHeaderByHeight(previous.height)
+		if err != nil {
+			return err
+		}
+		if header == nil || header.BlockHash() != previous.blockHash {
+			client.log.Info("Chain reorganized, rescanning")
+			rescan = true
+		}
+	}
+	var state *scanState
+	if rescan {
+		state = newScanState(scripts, client.config.StartHeight-1)
+	} else {
+		state = previous.copy()
+		newScripts := map[blockchain.ScriptHashHex][]byte{}
+		for scriptHashHex, script := range scripts {
+			if _, ok := previous.scripts[scriptHashHex]; !ok {
+				newScripts[scriptHashHex] = script
+			}
+		}
+		if len(newScripts) > 0 {
+			newState := newScanState(newScripts, client.config.StartHeight-1)
+			if err := client.scanBlocks(theHeaders, newState, newScripts, previous.height); err != nil {
+				return err
+			}
+			state.merge(newState)
+		}
+	}
+	if err := client.scanBlocks(theHeaders, state, scripts, status.Tip); err != nil {
+		return err
+	}
+
+	unlock = client.lock.Lock()
+	client.state = state
+	for txHash := range client.unconfirmed {
+		if _, ok := state.transactions[txHash]; ok {
+			delete(client.unconfirmed, txHash)
+		}
+	}
+	notify := client.updateHistories()
+	unlock()
+	notify()
+	return nil
+}
+
+// scanBlocks scans the blocks after the height of the state up to stopHeight for the transactions
+// of the scripts and adds them to the state. Requires scanLock.
+func (client *Client) scanBlocks(
+	theHeaders headers.Interface,
+	state *scanState,
+	scripts map[blockchain.ScriptHashHex][]byte,
+	stopHeight int,
+) error {
+	scriptList := make([][]byte, 0, len(scripts))
+	for _, script := range scripts {
+		scriptList = append(scriptList, script)
+	}
+	for state.height < stopHeight {
+		startHeight := state.height + 1
+		batchStopHeight := startHeight + maxFiltersPerRequest - 1
+		if batchStopHeight > stopHeight {
+			batchStopHeight = stopHeight
+		}
+		blockHeaders := []*wire.BlockHeader{}
+		for height := startHeight; height <= batchStopHeight; height++ {
+			header, err := theHeaders.VerifiedHeaderByHeight(height)
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				break
+			}
+			blockHeaders = append(blockHeaders, header)
+		}
+		if len(blockHeaders) == 0 {
+			break
+		}
+		stopHash := blockHeaders[len(blockHeaders)-1].BlockHash()
+
+		peers, err := client.connectedPeers()
+		if err != nil {
+			return err
+		}
+		filterHashes, filterHeader, err := client.verifiedFilterHashes(
+			peers, state, startHeight, blockHeaders)
+		if err != nil {
+			return err
+		}
+		filters, err := peers[0].getCFilters(startHeight, stopHash, len(blockHeaders))
+		if err != nil {
+			return err
+		}
+		for i, filter := range filters {
+			blockHash := blockHeaders[i].BlockHash()
+			if filter.FilterType != wire.GCSFilterRegular || filter.BlockHash != blockHash {
+				return errp.Newf("Unexpected filter for block %s", filter.BlockHash)
+			}
+			if chainhash.DoubleHashH(filter.Data) != filterHashes[i] {
+				return errp.Newf("The filter of block %s does not match the filter header", blockHash)
+			}
+			matched, err := matchFilter(filter.Data, blockHash, scriptList)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				continue
+			}
+			block, err := peers[0].getBlock(blockHash)
+			if err != nil {
+				return err
+			}
+			if err := checkMerkleRoot(block, blockHeaders[i]); err != nil {
+				return err
+			}
+			state.processBlock(block, startHeight+i)
+		}
+
+		state.filterHeader = &filterHeader
+		state.height = startHeight + len(blockHeaders) - 1
+		state.blockHash = stopHash
+		client.log.Debugf("Scanned compact block filters up to height %d", state.height)
+	}
+	return nil
+}
+
+// verifiedFilterHashes returns the filter hashes of the blocks from startHeight, which all peers
+// agree on, and the filter header of the last block. They are served from the cache if all blocks
+// were verified before. Requires scanLock.
+func (client *Client) verifiedFilterHashes(
+	peers []*peer,
+	state *scanState,
+	startHeight int,
+	blockHeaders []*wire.BlockHeader,
+) ([]chainhash.Hash, chainhash.Hash, error) {
+	filterHashes := make([]chainhash.Hash, len(blockHeaders))
+	var filterHeader chainhash.Hash
+	cached := true
+	for i, header := range blockHeaders {
+		filter, ok := client.verifiedFilters[header.BlockHash()]
+		if !ok {
+			cached = false
+			break
+		}
+		filterHashes[i] = filter.hash
+		filterHeader = filter.header
+	}
+	if cached {
+		return filterHashes, filterHeader, nil
+	}
+
+	stopHash := blockHeaders[len(blockHeaders)-1].BlockHash()
+	filterHashes, prevFilterHeader, err := client.filterHashes(
+		peers, startHeight, stopHash, len(blockHeaders))
+	if err != nil {
+		return nil, chainhash.Hash{}, err
+	}
+	if state.filterHeader != nil && *state.filterHeader != prevFilterHeader {
+		return nil, chainhash.Hash{}, errp.New("The filter headers do not connect to the previous filter header")
+	}
+	filterHeader = prevFilterHeader
+	for i, filterHash := range filterHashes {
+		filterHeader = chainhash.DoubleHashH(append(filterHash[:], filterHeader[:]...))
+		client.verifiedFilters[blockHeaders[i].BlockHash()] = verifiedFilter{
+			hash:   filterHash,
+			header: filterHeader,
+		}
+	}
+	return filterHashes, filterHeader, nil
+}
+
+// updateHistories computes the histories of the scanned scripts, answers the pending requests for
+// them and collects the notifications of the subscribers. The returned function delivers the
+// responses and notifications and must be called without holding the lock. Requires the lock.
+func (client *Client) updateHistories() func() {
+	if client.state == nil {
+		return func() {}
+	}
+	state := client.state
+	heights := map[chainhash.Hash]int{}
+	txs := map[chainhash.Hash]*wire.MsgTx{}
+	for txHash, relevantTx := range state.transactions {
+		heights[txHash] = relevantTx.height
+		txs[txHash] = relevantTx.tx
+	}
+	for txHash, tx := range client.unconfirmed {
+		heights[txHash] = 0
+		txs[txHash] = tx
+	}
+
+	txHashes := map[blockchain.ScriptHashHex]map[chainhash.Hash]struct{}{}
+	add := func(scriptHashHex blockchain.ScriptHashHex, txHash chainhash.Hash) {
+		if _, ok := txHashes[scriptHashHex]; !ok {
+			txHashes[scriptHashHex] = map[chainhash.Hash]struct{}{}
+		}
+		txHashes[scriptHashHex][txHash] = struct{}{}
+	}
+	outpoints := map[wire.OutPoint]blockchain.ScriptHashHex{}
+	for txHash, tx := range txs {
+		for index, txOut := range tx.TxOut {
+			scriptHashHex := blockchain.NewScriptHashHex(txOut.PkScript)
+			if _, ok := state.scripts[scriptHashHex]; ok {
+				outpoints[*wire.NewOutPoint(&txHash, uint32(index))] = scriptHashHex
+				add(scriptHashHex, txHash)
+			}
+		}
+	}
+	for txHash, tx := range txs {
+		for _, txIn := range tx.TxIn {
+			if scriptHashHex, ok := outpoints[txIn.PreviousOutPoint]; ok {
+				add(scriptHashHex, txHash)
+			}
+		}
+	}
+	// -1 for unconfirmed transactions with an unconfirmed parent, see blockchain.TxInfo.
+	height := func(txHash chainhash.Hash) int {
+		if heights[txHash] > 0 {
+			return heights[txHash]
+		}
+		for _, txIn := range txs[txHash].TxIn {
+			if parentHeight, ok := heights[txIn.PreviousOutPoint.Hash]; ok && parentHeight <= 0 {
+				return -1
+			}
+		}
+		return 0
+	}
+	histories := map[blockchain.ScriptHashHex]blockchain.TxHistory{}
+	for scriptHashHex, hashes := range txHashes {
+		history := blockchain.TxHistory{}
+		for txHash := range hashes {
+			history = append(history, &blockchain.TxInfo{
+				Height: height(txHash),
+				TXHash: blockchain.TXHash(txHash),
+			})
+		}
+		history.Sort()
+		histories[scriptHashHex] = history
+	}
+	client.histories = histories
+
+	var callbacks []func()
+	pendingRequests := []*historyRequest{}
+	for _, request := range client.pendingRequests {
+		if _, ok := state.scripts[request.scriptHashHex]; !ok {
+			pendingRequests = append(pendingRequests, request)
+			continue
+		}
+		history := client.history(request.scriptHashHex)
+		if request.subscribe {
+			client.statuses[request.scriptHashHex] = history.Status()
+		}
+		respond := request.respond
+		callbacks = append(callbacks, func() { respond(history) })
+	}
+	client.pendingRequests = pendingRequests
+	for scriptHashHex, subscribers := range client.scriptHashCallbacks {
+		previousStatus, ok := client.statuses[scriptHashHex]
+		if !ok {
+			// The initial status was not delivered yet.
+			continue
+		}
+		status := histories[scriptHashHex].Status()
+		if status == previousStatus {
+			continue
+		}
+		client.statuses[scriptHashHex] = status
+		for _, subscriber := range subscribers {
+			subscriber := subscriber
+			callbacks = append(callbacks, func() { subscriber(status) })
+		}
+	}
+	return func() {
+		for _, callback := range callbacks {
+			callback()
+		}
+	}
+}
+
+// history returns a copy of the history of a script hash. Requires the lock.
+func (client *Client) history(scriptHashHex blockchain.ScriptHashHex) blockchain.TxHistory {
+	history := blockchain.TxHistory{}
+	for _, txInfo := range client.histories[scriptHashHex] {
+		txInfoCopy := *txInfo
+		history = append(history, &txInfoCopy)
+	}
+	return history
+}
+
+// request answers the request once the script hash was scanned.
+func (client *Client) request(request *historyRequest, cleanup func(error)) {
+	unlock := client.lock.Lock()
+	if _, ok := client.scripts[request.scriptHashHex]; !ok {
+		unlock()
+		go cleanup(errp.Newf("Script hash %s is not watched", request.scriptHashHex))
+		return
+	}
+	client.pendingRequests = append(client.pendingRequests, request)
+	notify := client.updateHistories()
+	unlock()
+	go notify()
+	client.kick()
+}
+
+// WatchScript implements blockchain.ScriptWatcher.
+func (client *Client) WatchScript(pkScript []byte) {
+	unlock := client.lock.Lock()
+	client.scripts[blockchain.NewScriptHashHex(pkScript)] = append([]byte(nil), pkScript...)
+	unlock()
+	client.kick()
+}
+
+// WatchDescriptor implements blockchain.ScriptWatcher. Filters are matched against individual
+// scripts, so descriptors are not used.
+func (client *Client) WatchDescriptor(string, [][]byte) {}
+
+// ScriptHashGetHistory implements blockchain.Interface.
+func (client *Client) ScriptHashGetHistory(
+	scriptHashHex blockchain.ScriptHashHex,
+	success func(blockchain.TxHistory),
+	cleanup func(error),
+) {
+	client.request(&historyRequest{
+		scriptHashHex: scriptHashHex,
+		respond: func(history blockchain.TxHistory) {
+			success(history)
+			cleanup(nil)
+		},
+	}, cleanup)
+}
+
+// ScriptHashSubscribe implements blockchain.Interface.
+func (client *Client) ScriptHashSubscribe(
+	setupAndTeardown func() func(error),
+	scriptHashHex blockchain.ScriptHashHex,
+	success func(string),
+) {
+	var cleanup func(error)
+	if setupAndTeardown != nil {
+		cleanup = setupAndTeardown()
+	}
+	if cleanup == nil {
+		cleanup = func(error) {}
+	}
+	unlock := client.lock.Lock()
+	client.scriptHashCallbacks[scriptHashHex] = append(client.scriptHashCallbacks[scriptHashHex], success)
+	unlock()
+	client.request(&historyRequest{
+		scriptHashHex: scriptHashHex,
+		subscribe:     true,
+		respond: func(history blockchain.TxHistory) {
+			success(history.Status())
+			cleanup(nil)
+		},
+	}, cleanup)
+}
+
+// TransactionGet implements blockchain.Interface. Transactions found in the scanned blocks are
+// returned without a request to the wrapped backend.
+func (client *Client) TransactionGet(
+	txHash chainhash.Hash,
+	success func(*wire.MsgTx),
+	cleanup func(error),
+) {
+	unlock := client.lock.RLock()
+	tx, ok := client.unconfirmed[txHash]
+	if !ok && client.state != nil {
+		if relevantTx, found := client.state.transactions[txHash]; found {
+			tx, ok = relevantTx.tx, true
+		}
+	}
+	unlock()
+	if !ok {
+		client.Interface.TransactionGet(txHash, success, cleanup)
+		return
+	}
+	txCopy := tx.Copy()
+	go func() {
+		success(txCopy)
+		cleanup(nil)
+	}()
+}
+
+// TransactionBroadcast implements blockchain.Interface. The transaction is added to the histories
+// as an unconfirmed transaction.
+func (client *Client) TransactionBroadcast(transaction *wire.MsgTx) error {
+	if err := client.Interface.TransactionBroadcast(transaction); err != nil {
+		return err
+	}
+	unlock := client.lock.Lock()
+	client.unconfirmed[transaction.TxHash()] = transaction.Copy()
+	notify := client.updateHistories()
+	unlock()
+	go notify()
+	return nil
+}
+
+// GetMerkle implements blockchain.Interface. The merkle branches of transactions found in the
+// scanned blocks are computed without a request to the wrapped backend.
+func (client *Client) GetMerkle(
+	txHash chainhash.Hash, height int,
+	success func(merkle []blockchain.TXHash, pos int),
+	cleanup func(error),
+) {
+	unlock := client.lock.RLock()
+	var txHashes []chainhash.Hash
+	if client.state != nil {
+		txHashes = client.state.blockTxHashes[height]
+	}
+	unlock()
+	for pos, blockTxHash := range txHashes {
+		if blockTxHash == txHash {
+			merkle := blockchain.MerkleBranch(txHashes, pos)
+			go func() {
+				success(merkle, pos)
+				cleanup(nil)
+			}()
+			return
+		}
+	}
+	client.Interface.GetMerkle(txHash, height, success, cleanup)
+}
+
+// ConnectionError implements blockchain.Interface.
+func (client *Client) ConnectionError() error {
+	if err := client.Interface.ConnectionError(); err != nil {
+		return err
+	}
+	defer client.lock.RLock()()
+	return client.p2pError
+}
+
+// RegisterOnConnectionErrorChangedEvent implements blockchain.Interface.
+func (client *Client) RegisterOnConnectionErrorChangedEvent(f func(error)) {
+	client.Interface.RegisterOnConnectionErrorChangedEvent(f)
+	defer client.lock.Lock()()
+	client.connectionErrorCallbacks = append(client.connectionErrorCallbacks, f)
+}
+
+// Close implements blockchain.Interface.
+func (client *Client) Close() {
+	unlock := client.lock.Lock()
+	if client.closed {
+		unlock()
+		return
+	}
+	client.closed = true
+	close(client.quitChan)
+	unlock()
+	client.closePeers()
+	client.Interface.Close()
+}
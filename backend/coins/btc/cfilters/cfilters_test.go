@@ -0,0 +1,380 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfilters
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/gcs/builder"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+var netParams = &chaincfg.RegressionNetParams
+
+// regtestChain is a chain of blocks with their basic filters.
+type regtestChain struct {
+	blocks        []*wire.MsgBlock
+	filters       [][]byte
+	filterHeaders []chainhash.Hash
+}
+
+// newRegtestChain creates a chain with one block per height containing a coinbase and the given
+// transactions.
+func newRegtestChain(t *testing.T, txsByHeight [][]*wire.MsgTx) *regtestChain {
+	t.Helper()
+	chain := &regtestChain{}
+	prevOutScripts := map[wire.OutPoint][]byte{}
+	var prevBlockHash, prevFilterHeader chainhash.Hash
+	for height, txs := range txsByHeight {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+			SignatureScript:  []byte{byte(height), 0x00},
+		})
+		coinbase.AddTxOut(wire.NewTxOut(50e8, []byte{0x00, 0x14, 0xff, byte(height)}))
+		block := wire.NewMsgBlock(wire.NewBlockHeader(1, &prevBlockHash, &chainhash.Hash{}, 0, 0))
+		require.NoError(t, block.AddTransaction(coinbase))
+		for _, tx := range txs {
+			require.NoError(t, block.AddTransaction(tx))
+		}
+		txHashes := make([]chainhash.Hash, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txHashes[i] = tx.TxHash()
+		}
+		block.Header.MerkleRoot = merkleRoot(txHashes)
+
+		var scripts [][]byte
+		for _, tx := range block.Transactions[1:] {
+			for _, txIn := range tx.TxIn {
+				if script, ok := prevOutScripts[txIn.PreviousOutPoint]; ok {
+					scripts = append(scripts, script)
+				}
+			}
+		}
+		for _, tx := range block.Transactions {
+			txHash := tx.TxHash()
+			for index, txOut := range tx.TxOut {
+				prevOutScripts[*wire.NewOutPoint(&txHash, uint32(index))] = txOut.PkScript
+			}
+		}
+		filter, err := builder.BuildBasicFilter(block, scripts)
+		require.NoError(t, err)
+		filterData, err := filter.NBytes()
+		require.NoError(t, err)
+		filterHeader, err := builder.MakeHeaderForFilter(filter, prevFilterHeader)
+		require.NoError(t, err)
+
+		chain.blocks = append(chain.blocks, block)
+		chain.filters = append(chain.filters, filterData)
+		chain.filterHeaders = append(chain.filterHeaders, filterHeader)
+		prevBlockHash, prevFilterHeader = block.BlockHash(), filterHeader
+	}
+	return chain
+}
+
+func merkleRoot(txHashes []chainhash.Hash) chainhash.Hash {
+	root := txHashes[0]
+	for _, hash := range blockchain.MerkleBranch(txHashes, 0) {
+		hash := chainhash.Hash(hash)
+		root = chainhash.DoubleHashH(append(root[:], hash[:]...))
+	}
+	return root
+}
+
+func (chain *regtestChain) height(blockHash chainhash.Hash) int {
+	for height, block := range chain.blocks {
+		if block.BlockHash() == blockHash {
+			return height
+		}
+	}
+	return -1
+}
+
+// fakeHeaders serves the headers of a regtest chain as verified headers.
+type fakeHeaders struct {
+	chain *regtestChain
+}
+
+func (h *fakeHeaders) Initialize()                                 {}
+func (h *fakeHeaders) SubscribeEvent(f func(headers.Event)) func() { return func() {} }
+func (h *fakeHeaders) TipHeight() int                              { return len(h.chain.blocks) - 1 }
+
+func (h *fakeHeaders) VerifiedHeaderByHeight(height int) (*wire.BlockHeader, error) {
+	if height < 0 || height >= len(h.chain.blocks) {
+		return nil, nil
+	}
+	header := h.chain.blocks[height].Header
+	return &header, nil
+}
+
+func (h *fakeHeaders) Status() (*headers.Status, error) {
+	return &headers.Status{Tip: h.TipHeight(), TargetHeight: h.TipHeight()}, nil
+}
+
+// fakePeer is a P2P node serving the compact block filters and blocks of a regtest chain.
+type fakePeer struct {
+	t        *testing.T
+	chain    *regtestChain
+	listener net.Listener
+	// filterHashes is used instead of the filter hashes of the chain if not nil.
+	filterHashes []chainhash.Hash
+
+	lock              sync.Mutex
+	requestedBlocks   []int
+	cfHeadersRequests int
+}
+
+func newFakePeer(t *testing.T, chain *regtestChain) *fakePeer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &fakePeer{t: t, chain: chain, listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+	return p
+}
+
+func (p *fakePeer) address() string {
+	return p.listener.Addr().String()
+}
+
+func (p *fakePeer) blocks() []int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]int(nil), p.requestedBlocks...)
+}
+
+func (p *fakePeer) numCFHeadersRequests() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.cfHeadersRequests
+}
+
+func (p *fakePeer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	write := func(msg wire.Message) {
+		_, _ = wire.WriteMessageWithEncodingN(conn, msg, wire.ProtocolVersion, netParams.Net, wire.WitnessEncoding)
+	}
+	for {
+		_, msg, _, err := wire.ReadMessageWithEncodingN(conn, wire.ProtocolVersion, netParams.Net, wire.WitnessEncoding)
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgVersion:
+			address := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+			version := wire.NewMsgVersion(address, address, 1, int32(len(p.chain.blocks)-1))
+			version.Services = wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeCF
+			write(version)
+			write(wire.NewMsgVerAck())
+			// Unrelated messages are skipped by the client.
+			write(wire.NewMsgPing(1))
+			write(wire.NewMsgSendHeaders())
+		case *wire.MsgGetCFHeaders:
+			p.lock.Lock()
+			p.cfHeadersRequests++
+			p.lock.Unlock()
+			stopHeight := p.chain.height(msg.StopHash)
+			cfHeaders := wire.NewMsgCFHeaders()
+			cfHeaders.FilterType = msg.FilterType
+			cfHeaders.StopHash = msg.StopHash
+			if msg.StartHeight > 0 {
+				cfHeaders.PrevFilterHeader = p.chain.filterHeaders[msg.StartHeight-1]
+			}
+			for height := int(msg.StartHeight); height <= stopHeight; height++ {
+				filterHash := chainhash.DoubleHashH(p.chain.filters[height])
+				if p.filterHashes != nil {
+					filterHash = p.filterHashes[height]
+				}
+				require.NoError(p.t, cfHeaders.AddCFHash(&filterHash))
+			}
+			write(cfHeaders)
+		case *wire.MsgGetCFilters:
+			stopHeight := p.chain.height(msg.StopHash)
+			for height := int(msg.StartHeight); height <= stopHeight; height++ {
+				blockHash := p.chain.blocks[height].BlockHash()
+				write(wire.NewMsgCFilter(msg.FilterType, &blockHash, p.chain.filters[height]))
+			}
+		case *wire.MsgGetData:
+			for _, inv := range msg.InvList {
+				height := p.chain.height(inv.Hash)
+				p.lock.Lock()
+				p.requestedBlocks = append(p.requestedBlocks, height)
+				p.lock.Unlock()
+				write(p.chain.blocks[height])
+			}
+		}
+	}
+}
+
+func newClient(t *testing.T, chain *regtestChain, peers ...*fakePeer) *Client {
+	t.Helper()
+	conf := config.CompactFiltersConfig{StartHeight: 1}
+	for _, p := range peers {
+		conf.Peers = append(conf.Peers, p.address())
+	}
+	client := NewClient(
+		&blockchainMock.BlockchainMock{
+			MockConnectionError:                       func() error { return nil },
+			MockRegisterOnConnectionErrorChangedEvent: func(func(error)) {},
+		},
+		conf, netParams, proxy.Direct, logging.Get().WithGroup("cfilters_test"))
+	t.Cleanup(client.Close)
+	client.SetHeaders(&fakeHeaders{chain: chain})
+	return client
+}
+
+func getHistory(t *testing.T, client *Client, script []byte) blockchain.TxHistory {
+	t.Helper()
+	result := make(chan blockchain.TxHistory, 1)
+	client.ScriptHashGetHistory(blockchain.NewScriptHashHex(script),
+		func(history blockchain.TxHistory) { result <- history },
+		func(err error) { require.NoError(t, err) })
+	select {
+	case history := <-result:
+		return history
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timeout")
+		return nil
+	}
+}
+
+func TestScan(t *testing.T) {
+	watchedScript := []byte{0x00, 0x14, 0x01, 0x02, 0x03}
+	changeScript := []byte{0x00, 0x14, 0x04, 0x05, 0x06}
+	otherScript := []byte{0x00, 0x14, 0x07, 0x08, 0x09}
+
+	receive := wire.NewMsgTx(wire.TxVersion)
+	receive.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	receive.AddTxOut(wire.NewTxOut(1e8, watchedScript))
+	receiveHash := receive.TxHash()
+	unrelated := wire.NewMsgTx(wire.TxVersion)
+	unrelated.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	unrelated.AddTxOut(wire.NewTxOut(1e8, otherScript))
+	unrelated2 := wire.NewMsgTx(wire.TxVersion)
+	unrelated2.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{3}, 0), nil, nil))
+	unrelated2.AddTxOut(wire.NewTxOut(1e8, otherScript))
+	send := wire.NewMsgTx(wire.TxVersion)
+	send.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&receiveHash, 0), nil, nil))
+	send.AddTxOut(wire.NewTxOut(5e7, otherScript))
+	send.AddTxOut(wire.NewTxOut(4e7, changeScript))
+
+	chain := newRegtestChain(t, [][]*wire.MsgTx{
+		0: nil, 1: nil, 2: nil,
+		3: {receive},
+		4: nil,
+		5: {unrelated},
+		6: {unrelated2, send},
+		7: nil,
+	})
+
+	peer1, peer2 := newFakePeer(t, chain), newFakePeer(t, chain)
+	client := newClient(t, chain, peer1, peer2)
+	client.WatchScript(watchedScript)
+
+	require.Equal(t,
+		blockchain.TxHistory{
+			{Height: 3, TXHash: blockchain.TXHash(receiveHash)},
+			{Height: 6, TXHash: blockchain.TXHash(send.TxHash())},
+		},
+		getHistory(t, client, watchedScript))
+	// Only the matching blocks were downloaded.
+	require.ElementsMatch(t, []int{3, 6}, append(peer1.blocks(), peer2.blocks()...))
+	require.NoError(t, client.ConnectionError())
+
+	// Found transactions and their merkle branches are served locally.
+	txChan := make(chan *wire.MsgTx, 1)
+	client.TransactionGet(receiveHash,
+		func(tx *wire.MsgTx) { txChan <- tx },
+		func(err error) { require.NoError(t, err) })
+	require.Equal(t, receiveHash, (<-txChan).TxHash())
+	type merkleResult struct {
+		merkle []blockchain.TXHash
+		pos    int
+	}
+	merkleChan := make(chan merkleResult, 1)
+	client.GetMerkle(send.TxHash(), 6,
+		func(merkle []blockchain.TXHash, pos int) { merkleChan <- merkleResult{merkle, pos} },
+		func(err error) { require.NoError(t, err) })
+	result := <-merkleChan
+	require.Equal(t, 2, result.pos)
+	root := send.TxHash()
+	for i, hash := range result.merkle {
+		hash := chainhash.Hash(hash)
+		if (result.pos>>uint(i))&1 == 0 {
+			root = chainhash.DoubleHashH(append(root[:], hash[:]...))
+		} else {
+			root = chainhash.DoubleHashH(append(hash[:], root[:]...))
+		}
+	}
+	require.Equal(t, chain.blocks[6].Header.MerkleRoot, root)
+
+	// A newly watched script triggers a rescan for the new script only, using the cached filter
+	// hashes.
+	cfHeadersRequests := peer1.numCFHeadersRequests() + peer2.numCFHeadersRequests()
+	client.WatchScript(changeScript)
+	require.Equal(t,
+		blockchain.TxHistory{{Height: 6, TXHash: blockchain.TXHash(send.TxHash())}},
+		getHistory(t, client, changeScript))
+	require.ElementsMatch(t, []int{3, 6, 6}, append(peer1.blocks(), peer2.blocks()...))
+	require.Equal(t, cfHeadersRequests, peer1.numCFHeadersRequests()+peer2.numCFHeadersRequests())
+	// The transactions of the previously watched scripts are kept.
+	require.Equal(t,
+		blockchain.TxHistory{
+			{Height: 3, TXHash: blockchain.TXHash(receiveHash)},
+			{Height: 6, TXHash: blockchain.TXHash(send.TxHash())},
+		},
+		getHistory(t, client, watchedScript))
+}
+
+func TestScanPeersDisagree(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01, 0x02, 0x03}
+	chain := newRegtestChain(t, make([][]*wire.MsgTx, 5))
+	honestPeer, lyingPeer := newFakePeer(t, chain), newFakePeer(t, chain)
+	lyingPeer.filterHashes = make([]chainhash.Hash, len(chain.blocks))
+
+	client := newClient(t, chain, honestPeer, lyingPeer)
+	errChan := make(chan error, 1)
+	client.RegisterOnConnectionErrorChangedEvent(func(err error) { errChan <- err })
+	client.WatchScript(script)
+	select {
+	case err := <-errChan:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "disagree")
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timeout")
+	}
+	require.Error(t, client.ConnectionError())
+}
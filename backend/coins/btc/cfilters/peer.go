@@ -0,0 +1,189 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfilters
+
+import (
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"golang.org/x/net/proxy"
+)
+
+// peerTimeout is the maximum time to wait for a message from a peer.
+const peerTimeout = 30 * time.Second
+
+// peer is a minimal Bitcoin P2P client which can fetch compact block filters (BIP-157) and blocks.
+// Requests are serialized.
+type peer struct {
+	address string
+	net     *chaincfg.Params
+	conn    net.Conn
+	lock    sync.Mutex
+}
+
+// connectPeer connects to a P2P node and performs the version handshake. An error is returned if
+// the node does not serve compact block filters.
+func connectPeer(address string, net *chaincfg.Params, dialer proxy.Dialer) (*peer, error) {
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	p := &peer{address: address, net: net, conn: conn}
+	if err := p.handshake(); err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *peer) close() {
+	_ = p.conn.Close()
+}
+
+func (p *peer) write(msg wire.Message) error {
+	_ = p.conn.SetWriteDeadline(time.Now().Add(peerTimeout))
+	_, err := wire.WriteMessageWithEncodingN(
+		p.conn, msg, wire.ProtocolVersion, p.net.Net, wire.WitnessEncoding)
+	return errp.WithStack(err)
+}
+
+// read returns the next message from the peer. Pings are answered and unknown messages are
+// skipped.
+func (p *peer) read() (wire.Message, error) {
+	for {
+		_ = p.conn.SetReadDeadline(time.Now().Add(peerTimeout))
+		_, msg, _, err := wire.ReadMessageWithEncodingN(
+			p.conn, wire.ProtocolVersion, p.net.Net, wire.WitnessEncoding)
+		if msgErr, ok := err.(*wire.MessageError); ok && strings.Contains(msgErr.Description, "unhandled command") {
+			continue
+		}
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		if ping, ok := msg.(*wire.MsgPing); ok {
+			if err := p.write(wire.NewMsgPong(ping.Nonce)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+func (p *peer) handshake() error {
+	address := wire.NewNetAddressIPPort(net.IPv4zero, 0, 0)
+	version := wire.NewMsgVersion(address, address, rand.Uint64(), 0)
+	// We don't want unconfirmed transactions to be announced.
+	version.DisableRelayTx = true
+	if err := p.write(version); err != nil {
+		return err
+	}
+	var gotVersion, gotVerAck bool
+	for !gotVersion || !gotVerAck {
+		msg, err := p.read()
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgVersion:
+			if msg.Services&wire.SFNodeCF == 0 {
+				return errp.Newf("Peer %s does not serve compact block filters", p.address)
+			}
+			gotVersion = true
+			if err := p.write(wire.NewMsgVerAck()); err != nil {
+				return err
+			}
+		case *wire.MsgVerAck:
+			gotVerAck = true
+		}
+	}
+	return nil
+}
+
+// getCFHeaders fetches the hashes of the basic filters of the blocks from startHeight up to the
+// block with the hash stopHash, and the filter header of the block before startHeight.
+func (p *peer) getCFHeaders(startHeight int, stopHash chainhash.Hash) (*wire.MsgCFHeaders, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.write(wire.NewMsgGetCFHeaders(
+		wire.GCSFilterRegular, uint32(startHeight), &stopHash)); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		if cfHeaders, ok := msg.(*wire.MsgCFHeaders); ok && cfHeaders.StopHash == stopHash {
+			return cfHeaders, nil
+		}
+	}
+}
+
+// getCFilters fetches the basic filters of the count blocks from startHeight up to the block with
+// the hash stopHash.
+func (p *peer) getCFilters(startHeight int, stopHash chainhash.Hash, count int) ([]*wire.MsgCFilter, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.write(wire.NewMsgGetCFilters(
+		wire.GCSFilterRegular, uint32(startHeight), &stopHash)); err != nil {
+		return nil, err
+	}
+	filters := make([]*wire.MsgCFilter, 0, count)
+	for len(filters) < count {
+		msg, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		if filter, ok := msg.(*wire.MsgCFilter); ok {
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
+
+// getBlock fetches a block including the witness data.
+func (p *peer) getBlock(blockHash chainhash.Hash) (*wire.MsgBlock, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	getData := wire.NewMsgGetData()
+	if err := getData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock, &blockHash)); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if err := p.write(getData); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgBlock:
+			if msg.BlockHash() == blockHash {
+				return msg, nil
+			}
+		case *wire.MsgNotFound:
+			return nil, errp.Newf("Peer %s does not have block %s", p.address, blockHash)
+		}
+	}
+}
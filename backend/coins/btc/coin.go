@@ -50,6 +50,10 @@ type Coin struct {
 	dbFolder              string
 	makeBlockchain        func() blockchain.Interface
 	blockExplorerTxPrefix string
+	// headersSnapshotFile is a headers snapshot signed by one of headersSnapshotKeys, see
+	// SetHeadersSnapshotFile().
+	headersSnapshotFile string
+	headersSnapshotKeys [][]byte
 
 	observable.Implementation
 
@@ -59,7 +63,7 @@ type Coin struct {
 	log *logrus.Entry
 }
 
-// NewCoin creates a new coin with the given parameters.
+// NewCoin creates a new coin with the given parameters, connecting to the given Electrum servers.
 func NewCoin(
 	code coin.Code,
 	name string,
@@ -69,6 +73,29 @@ func NewCoin(
 	servers []*config.ServerInfo,
 	blockExplorerTxPrefix string,
 	socksProxy socksproxy.SocksProxy,
+) *Coin {
+	return NewCoinWithBlockchain(code, name, unit, net, dbFolder,
+		func(log *logrus.Entry) blockchain.Interface {
+			return electrum.NewElectrumConnection(
+				servers,
+				log,
+				socksProxy.GetTCPProxyDialer(),
+			)
+		},
+		blockExplorerTxPrefix,
+	)
+}
+
+// NewCoinWithBlockchain creates a new coin with the given parameters. makeBlockchain is called
+// once when the coin is initialized to create the blockchain backend.
+func NewCoinWithBlockchain(
+	code coin.Code,
+	name string,
+	unit string,
+	net *chaincfg.Params,
+	dbFolder string,
+	makeBlockchain func(*logrus.Entry) blockchain.Interface,
+	blockExplorerTxPrefix string,
 ) *Coin {
 	log := logging.Get().WithGroup("coin").WithField("code", code)
 	coin := &Coin{
@@ -79,17 +106,19 @@ func NewCoin(
 		dbFolder:              dbFolder,
 		blockExplorerTxPrefix: blockExplorerTxPrefix,
 		makeBlockchain: func() blockchain.Interface {
-			return electrum.NewElectrumConnection(
-				servers,
-				log,
-				socksProxy.GetTCPProxyDialer(),
-			)
+			return makeBlockchain(log)
 		},
 		log: log,
 	}
 	return coin
 }
 
+// headersUser is implemented by blockchain backends which need the verified headers of the coin,
+// e.g. to scan blocks.
+type headersUser interface {
+	SetHeaders(headers.Interface)
+}
+
 // Initialize implements coin.Coin.
 func (coin *Coin) Initialize() {
 	coin.initOnce.Do(func() {
@@ -114,6 +143,10 @@ func (coin *Coin) Initialize() {
 			db,
 			coin.blockchain,
 			coin.log)
+		coin.loadHeadersSnapshots()
+		if headersUser, ok := coin.blockchain.(headersUser); ok {
+			headersUser.SetHeaders(coin.headers)
+		}
 		coin.headers.Initialize()
 		coin.headers.SubscribeEvent(func(event headers.Event) {
 			if event == headers.EventSyncing || event == headers.EventSynced {
@@ -131,6 +164,32 @@ func (coin *Coin) Initialize() {
 	})
 }
 
+// SetHeadersSnapshotFile configures a headers snapshot file (see headers.WriteSnapshot()), which is
+// loaded when the coin is initialized if it is ahead of the headers database. The snapshot must be
+// signed by one of the given compressed public keys. Must be called before Initialize().
+func (coin *Coin) SetHeadersSnapshotFile(filename string, trustedKeys [][]byte) {
+	coin.headersSnapshotFile = filename
+	coin.headersSnapshotKeys = trustedKeys
+}
+
+// loadHeadersSnapshots loads the configured headers snapshot file, so that only the headers after
+// it need to be downloaded.
+func (coin *Coin) loadHeadersSnapshots() {
+	if coin.headersSnapshotFile == "" {
+		return
+	}
+	file, err := os.Open(coin.headersSnapshotFile)
+	if err != nil {
+		coin.log.WithError(err).Error("Could not open the headers snapshot")
+		return
+	}
+	defer func() { _ = file.Close() }()
+	_, err = coin.headers.LoadSnapshot(file, headers.TrustedSigners(coin.headersSnapshotKeys))
+	if err != nil {
+		coin.log.WithError(err).Error("Could not load the headers snapshot")
+	}
+}
+
 // Name implements coin.Coin.
 func (coin *Coin) Name() string {
 	return coin.name
@@ -207,9 +266,6 @@ func (coin *Coin) DecodeAddress(address string) (btcutil.Address, error) {
 	if !btcAddress.IsForNet(coin.Net()) {
 		return nil, errp.WithStack(errors.ErrInvalidAddress)
 	}
-	if _, ok := btcAddress.(*btcutil.AddressTaproot); ok {
-		return nil, errp.WithStack(errors.ErrInvalidAddress)
-	}
 	return btcAddress, nil
 }
 
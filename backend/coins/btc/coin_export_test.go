@@ -14,8 +14,21 @@
 
 package btc
 
-import "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+import (
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+)
 
 func (coin *Coin) TstSetMakeBlockchain(f func() blockchain.Interface) {
 	coin.makeBlockchain = f
 }
+
+func (account *Account) TstSignMultisigPSBT(packet *psbt.Packet) error {
+	return account.signMultisigPSBT(packet)
+}
+
+func (account *Account) TstFeeRatePerKb(tx *wire.MsgTx, vsize int64) (btcutil.Amount, error) {
+	return account.feeRatePerKb(tx, vsize)
+}
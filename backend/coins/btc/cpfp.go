@@ -0,0 +1,115 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// feeRatePerKb computes the fee rate of a transaction not funded by us, by fetching the
+// transactions it spends from.
+func (account *Account) feeRatePerKb(tx *wire.MsgTx, vsize int64) (btcutil.Amount, error) {
+	var fee btcutil.Amount
+	for _, txIn := range tx.TxIn {
+		prevTx, err := account.fetchPrevTx(txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			return 0, err
+		}
+		if int(txIn.PreviousOutPoint.Index) >= len(prevTx.TxOut) {
+			return 0, errp.New("Invalid previous output")
+		}
+		fee += btcutil.Amount(prevTx.TxOut[txIn.PreviousOutPoint.Index].Value)
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= btcutil.Amount(txOut.Value)
+	}
+	if fee < 0 || vsize <= 0 {
+		return 0, errp.New("Invalid transaction fee")
+	}
+	return fee * 1000 / btcutil.Amount(vsize), nil
+}
+
+// CPFPTxProposal creates a transaction accelerating the unconfirmed transaction with the given ID
+// (child-pays-for-parent), e.g. an incoming transaction paying a low fee. The new transaction
+// spends our outputs of it to one of our change addresses, paying a fee such that both
+// transactions together reach the fee rate of the given fee target. Transactions spending
+// unconfirmed outputs are not accelerated, see transactions.AcceleratableTx().
+//
+// Like TxProposal(), it returns the amount, fee and total, and the proposal is stored internally
+// to be signed and sent with SendTx().
+func (account *Account) CPFPTxProposal(
+	txID string,
+	feeTargetCode accounts.FeeTargetCode,
+	customFee string,
+) (coin.Amount, coin.Amount, coin.Amount, error) {
+	defer account.activeTxProposalLock.Lock()()
+
+	txHash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return coin.Amount{}, coin.Amount{}, coin.Amount{}, errp.WithStack(err)
+	}
+	feeRatePerKb, err := account.getFeePerKb(&accounts.TxProposalArgs{
+		FeeTargetCode: feeTargetCode,
+		CustomFee:     customFee,
+	})
+	if err != nil {
+		return coin.Amount{}, coin.Amount{}, coin.Amount{}, err
+	}
+	parentTx, parentTxData, parentOutputs, err := account.transactions.AcceleratableTx(*txHash)
+	if err != nil {
+		return coin.Amount{}, coin.Amount{}, coin.Amount{}, err
+	}
+	var parentFeeRatePerKb btcutil.Amount
+	if parentTxData.FeeRatePerKb != nil {
+		parentFeeRatePerKb = *parentTxData.FeeRatePerKb
+	} else {
+		// The fee is only known to the transactions if all inputs are ours.
+		parentFeeRatePerKb, err = account.feeRatePerKb(parentTx, parentTxData.VSize)
+		if err != nil {
+			return coin.Amount{}, coin.Amount{}, coin.Amount{}, err
+		}
+	}
+
+	account.log.
+		WithField("fee-rate", feeRatePerKb).
+		WithField("parent-fee-rate", parentFeeRatePerKb).
+		Debug("Proposing CPFP transaction")
+	txProposal, err := maketx.NewTxCPFP(
+		account.coin,
+		account.toUTXOs(parentOutputs),
+		parentTxData.VSize,
+		parentFeeRatePerKb,
+		// Change address is of the first subaccount, always.
+		account.subaccounts[0].changeAddresses.GetUnused()[0],
+		feeRatePerKb,
+		account.log,
+	)
+	if err != nil {
+		return coin.Amount{}, coin.Amount{}, coin.Amount{}, err
+	}
+
+	account.activeTxProposal = txProposal
+	account.activeTxProposalPrevOutputs = parentOutputs
+
+	return coin.NewAmountFromInt64(int64(txProposal.Amount)),
+		coin.NewAmountFromInt64(int64(txProposal.Fee)),
+		coin.NewAmountFromInt64(int64(txProposal.Total())), nil
+}
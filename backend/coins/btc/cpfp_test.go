@@ -0,0 +1,60 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeRatePerKb(t *testing.T) {
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxOut(wire.NewTxOut(3000, nil))
+	prevTx.AddTxOut(wire.NewTxOut(7000, nil))
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	blockchainMock.MockTransactionGet = func(
+		txHash chainhash.Hash, success func(*wire.MsgTx), cleanup func(error)) {
+		go func() {
+			if txHash != prevTx.TxHash() {
+				cleanup(errors.New("transaction not found"))
+				return
+			}
+			success(prevTx)
+			cleanup(nil)
+		}()
+	}
+	account, cleanup := newTestAccount(t, blockchainMock, nil)
+	defer cleanup()
+
+	prevTxHash := prevTx.TxHash()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevTxHash, 0), nil, nil))
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevTxHash, 1), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(9000, nil))
+	feeRatePerKb, err := account.TstFeeRatePerKb(tx, 200)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5000), feeRatePerKb)
+
+	// Failing to fetch a previous transaction is an error, not a panic.
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	_, err = account.TstFeeRatePerKb(tx, 200)
+	require.Error(t, err)
+}
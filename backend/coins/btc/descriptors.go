@@ -0,0 +1,118 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+// descriptorRange is the number of addresses per chain which are passed along with the output
+// descriptors to blockchain.ScriptWatcher.WatchDescriptor(). The range is extended by this many
+// addresses whenever the account derives an address beyond it, see watchDescriptor().
+const descriptorRange = 100
+
+// outputDescriptor returns the ranged output descriptor of the receive (change=0) or change
+// (change=1) addresses of the signing configuration, e.g. "wpkh(xpub.../0/*)".
+func outputDescriptor(
+	configuration *signing.Configuration, net *chaincfg.Params, change uint32) (string, error) {
+	keys := make([]string, len(configuration.KeyInfos()))
+	for i, keyInfo := range configuration.KeyInfos() {
+		// The node only accepts xpubs with the version of its network, e.g. tpub for testnet.
+		xpub, err := keyInfo.ExtendedPublicKey.CloneWithVersion(net.HDPublicKeyID[:])
+		if err != nil {
+			return "", errp.WithStack(err)
+		}
+		keys[i] = fmt.Sprintf("%s/%d/*", xpub, change)
+	}
+	if configuration.IsMultisig() {
+		if configuration.ScriptType() != signing.ScriptTypeP2WSH {
+			return "", errp.Newf("unsupported multisig script type %s", configuration.ScriptType())
+		}
+		return fmt.Sprintf("wsh(sortedmulti(%d,%s))",
+			configuration.BitcoinMultisig.Threshold, strings.Join(keys, ",")), nil
+	}
+	switch configuration.ScriptType() {
+	case signing.ScriptTypeP2PKH:
+		return fmt.Sprintf("pkh(%s)", keys[0]), nil
+	case signing.ScriptTypeP2WPKHP2SH:
+		return fmt.Sprintf("sh(wpkh(%s))", keys[0]), nil
+	case signing.ScriptTypeP2WPKH:
+		return fmt.Sprintf("wpkh(%s)", keys[0]), nil
+	case signing.ScriptTypeP2TR:
+		return fmt.Sprintf("tr(%s)", keys[0]), nil
+	default:
+		return "", errp.Newf("unsupported script type %s", configuration.ScriptType())
+	}
+}
+
+// descriptorCount returns the number of addresses the descriptor of a chain with count addresses
+// covers, which is count rounded up to a multiple of descriptorRange, at least descriptorRange.
+func descriptorCount(count int) int {
+	if count <= 0 {
+		return descriptorRange
+	}
+	return (count + descriptorRange - 1) / descriptorRange * descriptorRange
+}
+
+// watchDescriptor passes the output descriptor of the receive (change=0) or change (change=1)
+// addresses of the signing configuration to the watcher, covering at least the first count
+// addresses, so the backend can rescan the blockchain once for all addresses of the chain instead
+// of once per address. Returns the number of covered addresses.
+func watchDescriptor(
+	watcher blockchain.ScriptWatcher,
+	configuration *signing.Configuration,
+	net *chaincfg.Params,
+	change uint32,
+	count int,
+	log *logrus.Entry,
+) (int, error) {
+	descriptor, err := outputDescriptor(configuration, net, change)
+	if err != nil {
+		return 0, err
+	}
+	pkScripts := make([][]byte, descriptorCount(count))
+	for index := range pkScripts {
+		keypath := signing.NewEmptyRelativeKeypath().
+			Child(change, signing.NonHardened).
+			Child(uint32(index), signing.NonHardened)
+		pkScripts[index] = addresses.NewAccountAddress(configuration, keypath, net, log).PubkeyScript()
+	}
+	watcher.WatchDescriptor(descriptor, pkScripts)
+	return len(pkScripts), nil
+}
+
+// watchDescriptors passes the output descriptors of the first descriptorRange receive and change
+// addresses of the signing configuration to the watcher, see watchDescriptor().
+func watchDescriptors(
+	watcher blockchain.ScriptWatcher,
+	configuration *signing.Configuration,
+	net *chaincfg.Params,
+	log *logrus.Entry,
+) error {
+	for change := uint32(0); change < 2; change++ {
+		if _, err := watchDescriptor(watcher, configuration, net, change, descriptorRange, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// BIP32 test vector 1, chain m.
+const (
+	testXpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	testTpub = "tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp"
+)
+
+type testWatcher struct {
+	descriptors map[string][][]byte
+}
+
+func (watcher *testWatcher) WatchScript([]byte) {}
+
+func (watcher *testWatcher) WatchDescriptor(descriptor string, pkScripts [][]byte) {
+	watcher.descriptors[descriptor] = pkScripts
+}
+
+func TestOutputDescriptor(t *testing.T) {
+	xpub, err := hdkeychain.NewKeyFromString(testXpub)
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/0'/0'")
+	require.NoError(t, err)
+	fingerprint := []byte{1, 2, 3, 4}
+
+	for scriptType, expected := range map[signing.ScriptType]string{
+		signing.ScriptTypeP2PKH:      "pkh(" + testXpub + "/0/*)",
+		signing.ScriptTypeP2WPKHP2SH: "sh(wpkh(" + testXpub + "/0/*))",
+		signing.ScriptTypeP2WPKH:     "wpkh(" + testXpub + "/0/*)",
+		signing.ScriptTypeP2TR:       "tr(" + testXpub + "/0/*)",
+	} {
+		configuration := signing.NewBitcoinConfiguration(scriptType, fingerprint, keypath, xpub)
+		descriptor, err := outputDescriptor(configuration, &chaincfg.MainNetParams, 0)
+		require.NoError(t, err)
+		require.Equal(t, expected, descriptor)
+	}
+
+	// Testnet xpubs are converted to tpubs.
+	configuration := signing.NewBitcoinConfiguration(signing.ScriptTypeP2WPKH, fingerprint, keypath, xpub)
+	descriptor, err := outputDescriptor(configuration, &chaincfg.TestNet3Params, 1)
+	require.NoError(t, err)
+	require.Equal(t, "wpkh("+testTpub+"/1/*)", descriptor)
+
+	keyInfo := signing.KeyInfo{RootFingerprint: fingerprint, AbsoluteKeypath: keypath, ExtendedPublicKey: xpub}
+	multisig := signing.NewBitcoinMultisigConfiguration(
+		1, signing.ScriptTypeP2WSH, []signing.KeyInfo{keyInfo, keyInfo})
+	descriptor, err = outputDescriptor(multisig, &chaincfg.MainNetParams, 0)
+	require.NoError(t, err)
+	require.Equal(t, "wsh(sortedmulti(1,"+testXpub+"/0/*,"+testXpub+"/0/*))", descriptor)
+}
+
+func TestWatchDescriptors(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	log := logging.Get().WithGroup("descriptors_test")
+	xpub, err := hdkeychain.NewKeyFromString(testTpub)
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	configuration := signing.NewBitcoinConfiguration(
+		signing.ScriptTypeP2WPKH, []byte{1, 2, 3, 4}, keypath, xpub)
+
+	watcher := &testWatcher{descriptors: map[string][][]byte{}}
+	require.NoError(t, watchDescriptors(watcher, configuration, net, log))
+	require.Len(t, watcher.descriptors, 2)
+	for change, descriptor := range []string{"wpkh(" + testTpub + "/0/*)", "wpkh(" + testTpub + "/1/*)"} {
+		pkScripts := watcher.descriptors[descriptor]
+		require.Len(t, pkScripts, descriptorRange)
+		for _, index := range []uint32{0, descriptorRange - 1} {
+			address := addresses.NewAccountAddress(configuration,
+				signing.NewEmptyRelativeKeypath().
+					Child(uint32(change), signing.NonHardened).
+					Child(index, signing.NonHardened),
+				net, log)
+			require.Equal(t, address.PubkeyScript(), pkScripts[index])
+		}
+	}
+}
+
+func TestDescriptorCount(t *testing.T) {
+	require.Equal(t, descriptorRange, descriptorCount(0))
+	require.Equal(t, descriptorRange, descriptorCount(1))
+	require.Equal(t, descriptorRange, descriptorCount(descriptorRange))
+	require.Equal(t, 2*descriptorRange, descriptorCount(descriptorRange+1))
+}
+
+func TestWatchDescriptorExtendsRange(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	log := logging.Get().WithGroup("descriptors_test")
+	xpub, err := hdkeychain.NewKeyFromString(testTpub)
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	configuration := signing.NewBitcoinConfiguration(
+		signing.ScriptTypeP2WPKH, []byte{1, 2, 3, 4}, keypath, xpub)
+
+	watcher := &testWatcher{descriptors: map[string][][]byte{}}
+	// The account derived address 0/101, which is beyond the initial range.
+	count, err := watchDescriptor(watcher, configuration, net, 0, 102, log)
+	require.NoError(t, err)
+	require.Equal(t, 2*descriptorRange, count)
+	pkScripts := watcher.descriptors["wpkh("+testTpub+"/0/*)"]
+	require.Len(t, pkScripts, 2*descriptorRange)
+	address := addresses.NewAccountAddress(configuration,
+		signing.NewEmptyRelativeKeypath().
+			Child(0, signing.NonHardened).
+			Child(101, signing.NonHardened),
+		net, log)
+	require.Equal(t, address.PubkeyScript(), pkScripts[101])
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// historyTimeout is the maximum time HasHistory() waits for the blockchain backend.
+const historyTimeout = time.Minute
+
+// HasHistory returns true if any of the first receive or change addresses of the given account
+// configurations, up to the gap limits, has a transaction history. It is used to discover
+// accounts which were used before, e.g. when restoring a wallet from a seed. The default gap
+// limits of each configuration are used, or forcedGapLimits if they are higher, like for accounts.
+func (coin *Coin) HasHistory(
+	configurations signing.Configurations, forcedGapLimits *types.GapLimits) (bool, error) {
+	coin.Initialize()
+
+	watcher, _ := coin.Blockchain().(blockchain.ScriptWatcher)
+	var scriptHashes []blockchain.ScriptHashHex
+	for _, configuration := range configurations {
+		gapLimits := defaultGapLimits(configuration)
+		if forcedGapLimits != nil {
+			if forcedGapLimits.Receive > gapLimits.Receive {
+				gapLimits.Receive = forcedGapLimits.Receive
+			}
+			if forcedGapLimits.Change > gapLimits.Change {
+				gapLimits.Change = forcedGapLimits.Change
+			}
+		}
+		if watcher != nil {
+			if err := watchDescriptors(watcher, configuration, coin.net, coin.log); err != nil {
+				return false, err
+			}
+		}
+		for change, gapLimit := range []uint16{gapLimits.Receive, gapLimits.Change} {
+			for index := uint32(0); index < uint32(gapLimit); index++ {
+				keypath := signing.NewEmptyRelativeKeypath().
+					Child(uint32(change), signing.NonHardened).
+					Child(index, signing.NonHardened)
+				address := addresses.NewAccountAddress(configuration, keypath, coin.net, coin.log)
+				if watcher != nil {
+					watcher.WatchScript(address.PubkeyScript())
+				}
+				scriptHashes = append(scriptHashes, address.PubkeyScriptHashHex())
+			}
+		}
+	}
+
+	type result struct {
+		used bool
+		err  error
+	}
+	// Buffered so the callbacks never block if we return early.
+	results := make(chan result, len(scriptHashes))
+	for _, scriptHash := range scriptHashes {
+		coin.Blockchain().ScriptHashGetHistory(
+			scriptHash,
+			func(history blockchain.TxHistory) {
+				results <- result{used: len(history) > 0}
+			},
+			func(err error) {
+				results <- result{err: err}
+			},
+		)
+	}
+	timeout := time.After(historyTimeout)
+	for range scriptHashes {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				return false, result.err
+			}
+			if result.used {
+				return true, nil
+			}
+		case <-timeout:
+			return false, errp.New("timeout while fetching the address history")
+		}
+	}
+	return false, nil
+}
@@ -304,6 +304,7 @@ func (client *ElectrumClient) HeadersSubscribe(
 			client.log.WithError(err).Error("could not handle header notification")
 			return
 		}
+		client.rpc.SetTipHeight(h.Height)
 		success(&blockchain.Header{BlockHeight: h.Height})
 	})
 	client.rpc.Method(
@@ -312,6 +313,7 @@ func (client *ElectrumClient) HeadersSubscribe(
 			if err := json.Unmarshal(responseBytes, &h); err != nil {
 				return errp.WithStack(err)
 			}
+			client.rpc.SetTipHeight(h.Height)
 			success(&blockchain.Header{BlockHeight: h.Height})
 			return nil
 		},
@@ -0,0 +1,299 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package electrum
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/electrum/client"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// recheckDelay is how long to wait before fetching a history from both servers again if they
+	// disagree, to give a server which is behind a chance to catch up.
+	recheckDelay = 15 * time.Second
+	// feeDiscrepancyFactor is the factor by which the fee estimates of two servers can differ
+	// before it is considered a discrepancy.
+	feeDiscrepancyFactor = 2
+)
+
+type discrepancyKey struct {
+	kind          blockchain.DiscrepancyKind
+	scriptHashHex blockchain.ScriptHashHex
+}
+
+// crossCheckingClient is an Electrum client which verifies the histories and fee estimates returned
+// by the server against a second server. The answers of the first server are passed on
+// immediately, and disagreements are reported as discrepancies (see
+// blockchain.DiscrepancyReporter).
+type crossCheckingClient struct {
+	*client.ElectrumClient
+	rpc          *jsonrpc.RPCClient
+	secondary    *client.ElectrumClient
+	secondaryRPC *jsonrpc.RPCClient
+
+	subscribeSecondaryOnce sync.Once
+	recheckDelay           time.Duration
+
+	lock          locker.Locker
+	discrepancies map[discrepancyKey]blockchain.Discrepancy
+	callbacks     []func()
+
+	log *logrus.Entry
+}
+
+var _ blockchain.Interface = &crossCheckingClient{}
+var _ blockchain.DiscrepancyReporter = &crossCheckingClient{}
+
+// NewCrossCheckingElectrumConnection is like NewElectrumConnection, but additionally connects to a
+// second of the given servers to cross-check the histories and fee estimates. If there are less
+// than two servers, there is nothing to cross-check against and a regular connection is returned.
+func NewCrossCheckingElectrumConnection(
+	servers []*config.ServerInfo, log *logrus.Entry, dialer proxy.Dialer) blockchain.Interface {
+	if len(servers) < 2 {
+		return NewElectrumConnection(servers, log, dialer)
+	}
+	log = electrumLog(servers, log)
+	log.Debug("Connecting to two Electrum servers to cross-check them")
+	return newCrossCheckingClient(newBackends(servers, dialer), log)
+}
+
+func newCrossCheckingClient(backends []*jsonrpc.Backend, log *logrus.Entry) *crossCheckingClient {
+	rpc := jsonrpc.NewRPCClient(backends, nil, log)
+	secondaryLog := log.WithField("cross-check", true)
+	secondaryRPC := jsonrpc.NewRPCClient(backends, nil, secondaryLog)
+	// Whichever client connects second connects to a different server.
+	rpc.AvoidBackendOf(secondaryRPC)
+	secondaryRPC.AvoidBackendOf(rpc)
+	return &crossCheckingClient{
+		ElectrumClient: client.NewElectrumClient(rpc, log),
+		rpc:            rpc,
+		secondary:      client.NewElectrumClient(secondaryRPC, secondaryLog),
+		secondaryRPC:   secondaryRPC,
+		recheckDelay:   recheckDelay,
+		discrepancies:  map[discrepancyKey]blockchain.Discrepancy{},
+		log:            log,
+	}
+}
+
+// servers returns the names of the two servers, or nil if they are not connected to two different
+// servers, in which case there is nothing to cross-check.
+func (c *crossCheckingClient) servers() []string {
+	primary, secondary := c.rpc.ConnectedBackend(), c.secondaryRPC.ConnectedBackend()
+	if primary == "" || secondary == "" || primary == secondary {
+		return nil
+	}
+	return []string{primary, secondary}
+}
+
+// setDiscrepancy records a discrepancy, or resolves it if discrepancy is nil.
+func (c *crossCheckingClient) setDiscrepancy(key discrepancyKey, discrepancy *blockchain.Discrepancy) {
+	unlock := c.lock.Lock()
+	_, existed := c.discrepancies[key]
+	if discrepancy != nil {
+		c.discrepancies[key] = *discrepancy
+	} else {
+		delete(c.discrepancies, key)
+	}
+	callbacks := c.callbacks
+	unlock()
+	if existed != (discrepancy != nil) {
+		for _, callback := range callbacks {
+			callback()
+		}
+	}
+}
+
+// Discrepancies implements blockchain.DiscrepancyReporter.
+func (c *crossCheckingClient) Discrepancies() []blockchain.Discrepancy {
+	defer c.lock.RLock()()
+	result := []blockchain.Discrepancy{}
+	for _, discrepancy := range c.discrepancies {
+		result = append(result, discrepancy)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].ScriptHashHex < result[j].ScriptHashHex
+	})
+	return result
+}
+
+// RegisterOnDiscrepanciesChangedEvent implements blockchain.DiscrepancyReporter.
+func (c *crossCheckingClient) RegisterOnDiscrepanciesChangedEvent(f func()) {
+	defer c.lock.Lock()()
+	c.callbacks = append(c.callbacks, f)
+}
+
+// confirmedTxs returns the heights of the confirmed transactions of a history. Unconfirmed
+// transactions are not compared, as they propagate to the servers at different times.
+func confirmedTxs(history blockchain.TxHistory) map[blockchain.TXHash]int {
+	result := map[blockchain.TXHash]int{}
+	for _, txInfo := range history {
+		if txInfo.Height > 0 {
+			result[txInfo.TXHash] = txInfo.Height
+		}
+	}
+	return result
+}
+
+func sameConfirmedTxs(history1, history2 blockchain.TxHistory) bool {
+	txs1, txs2 := confirmedTxs(history1), confirmedTxs(history2)
+	if len(txs1) != len(txs2) {
+		return false
+	}
+	for txHash, height := range txs1 {
+		if otherHeight, ok := txs2[txHash]; !ok || otherHeight != height {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHistory fetches the history from the second server and compares it to the history returned
+// by the first server. If recheck is true, a disagreement is only reported if it persists after
+// recheckDelay.
+func (c *crossCheckingClient) checkHistory(
+	scriptHashHex blockchain.ScriptHashHex, history blockchain.TxHistory, recheck bool) {
+	key := discrepancyKey{kind: blockchain.DiscrepancyKindHistory, scriptHashHex: scriptHashHex}
+	c.secondary.ScriptHashGetHistory(
+		scriptHashHex,
+		func(otherHistory blockchain.TxHistory) {
+			servers := c.servers()
+			if servers == nil {
+				return
+			}
+			if sameConfirmedTxs(history, otherHistory) {
+				c.setDiscrepancy(key, nil)
+				return
+			}
+			if recheck {
+				time.AfterFunc(c.recheckDelay, func() {
+					c.ElectrumClient.ScriptHashGetHistory(
+						scriptHashHex,
+						func(history blockchain.TxHistory) { c.checkHistory(scriptHashHex, history, false) },
+						func(error) {})
+				})
+				return
+			}
+			c.log.WithField("servers", servers).Warningf(
+				"The servers returned different histories for script hash %s", scriptHashHex)
+			c.setDiscrepancy(key, &blockchain.Discrepancy{
+				Kind:          blockchain.DiscrepancyKindHistory,
+				ScriptHashHex: scriptHashHex,
+				Servers:       servers,
+			})
+		},
+		func(err error) {
+			if err != nil {
+				c.log.WithError(err).Debug("Could not fetch the history to cross-check")
+			}
+		})
+}
+
+// checkFee fetches the fee estimate from the second server and compares it to the estimate of the
+// first server.
+func (c *crossCheckingClient) checkFee(number int, fee btcutil.Amount) {
+	key := discrepancyKey{kind: blockchain.DiscrepancyKindFee}
+	c.secondary.EstimateFee(
+		number,
+		func(otherFee *btcutil.Amount) {
+			servers := c.servers()
+			if servers == nil || otherFee == nil {
+				return
+			}
+			low, high := fee, *otherFee
+			if low > high {
+				low, high = high, low
+			}
+			if low <= 0 || high <= low*feeDiscrepancyFactor {
+				c.setDiscrepancy(key, nil)
+				return
+			}
+			c.log.WithField("servers", servers).Warningf(
+				"The servers returned different fee estimates for %d blocks: %s and %s", number, fee, *otherFee)
+			c.setDiscrepancy(key, &blockchain.Discrepancy{
+				Kind:    blockchain.DiscrepancyKindFee,
+				Servers: servers,
+			})
+		},
+		func(err error) {
+			if err != nil {
+				c.log.WithError(err).Debug("Could not fetch the fee estimate to cross-check")
+			}
+		})
+}
+
+// ScriptHashGetHistory implements blockchain.Interface.
+func (c *crossCheckingClient) ScriptHashGetHistory(
+	scriptHashHex blockchain.ScriptHashHex,
+	success func(blockchain.TxHistory),
+	cleanup func(error),
+) {
+	c.ElectrumClient.ScriptHashGetHistory(
+		scriptHashHex,
+		func(history blockchain.TxHistory) {
+			success(history)
+			go c.checkHistory(scriptHashHex, history, true)
+		},
+		cleanup)
+}
+
+// EstimateFee implements blockchain.Interface.
+func (c *crossCheckingClient) EstimateFee(
+	number int,
+	success func(*btcutil.Amount),
+	cleanup func(error),
+) {
+	c.ElectrumClient.EstimateFee(
+		number,
+		func(fee *btcutil.Amount) {
+			success(fee)
+			if fee != nil {
+				go c.checkFee(number, *fee)
+			}
+		},
+		cleanup)
+}
+
+// HeadersSubscribe implements blockchain.Interface. The second server is subscribed to the headers
+// as well once the first server is connected, so that the tip heights of both are tracked.
+func (c *crossCheckingClient) HeadersSubscribe(
+	setupAndTeardown func() func(error),
+	success func(*blockchain.Header),
+) {
+	c.ElectrumClient.HeadersSubscribe(setupAndTeardown, func(header *blockchain.Header) {
+		c.subscribeSecondaryOnce.Do(func() {
+			c.secondary.HeadersSubscribe(nil, func(*blockchain.Header) {})
+		})
+		success(header)
+	})
+}
+
+// Close implements blockchain.Interface.
+func (c *crossCheckingClient) Close() {
+	c.ElectrumClient.Close()
+	c.secondary.Close()
+}
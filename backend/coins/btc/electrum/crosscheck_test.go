@@ -0,0 +1,180 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package electrum
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonrpc"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer is an in-memory Electrum server answering the methods used in the cross-checks.
+type fakeServer struct {
+	lock    sync.Mutex
+	history blockchain.TxHistory
+	fee     float64
+}
+
+func (server *fakeServer) setHistory(history blockchain.TxHistory) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.history = history
+}
+
+func (server *fakeServer) result(method string) interface{} {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	switch method {
+	case "server.version":
+		return []string{"fake", "1.4"}
+	case "blockchain.headers.subscribe":
+		return map[string]int{"height": 100}
+	case "blockchain.scripthash.get_history":
+		return server.history
+	case "blockchain.estimatefee":
+		return server.fee
+	}
+	return nil
+}
+
+func (server *fakeServer) backend(name string) *jsonrpc.Backend {
+	return &jsonrpc.Backend{
+		Name: name,
+		EstablishConnection: func() (io.ReadWriteCloser, error) {
+			clientConn, serverConn := net.Pipe()
+			go func() {
+				reader := bufio.NewReader(serverConn)
+				for {
+					line, err := reader.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					var request struct {
+						ID     int    `json:"id"`
+						Method string `json:"method"`
+					}
+					if err := json.Unmarshal(line, &request); err != nil {
+						return
+					}
+					response, _ := json.Marshal(map[string]interface{}{
+						"jsonrpc": "2.0",
+						"id":      request.ID,
+						"result":  server.result(request.Method),
+					})
+					if _, err := serverConn.Write(append(response, '\n')); err != nil {
+						return
+					}
+				}
+			}()
+			return clientConn, nil
+		},
+	}
+}
+
+func TestCrossCheckingClient(t *testing.T) {
+	tx1 := blockchain.TXHash(chainhash.HashH([]byte("tx1")))
+	tx2 := blockchain.TXHash(chainhash.HashH([]byte("tx2")))
+	server1 := &fakeServer{history: blockchain.TxHistory{{Height: 10, TXHash: tx1}}, fee: 0.0001}
+	server2 := &fakeServer{history: blockchain.TxHistory{{Height: 10, TXHash: tx1}}, fee: 0.0001}
+
+	c := newCrossCheckingClient(
+		[]*jsonrpc.Backend{server1.backend("server1"), server2.backend("server2")},
+		logging.Get().WithGroup("crosscheck_test"))
+	defer c.Close()
+	c.recheckDelay = 50 * time.Millisecond
+	changed := make(chan struct{}, 10)
+	c.RegisterOnDiscrepanciesChangedEvent(func() { changed <- struct{}{} })
+	waitChanged := func() {
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timeout")
+		}
+	}
+	getHistory := func() blockchain.TxHistory {
+		result := make(chan blockchain.TxHistory, 1)
+		c.ScriptHashGetHistory("scripthash",
+			func(history blockchain.TxHistory) { result <- history },
+			func(err error) { require.NoError(t, err) })
+		return <-result
+	}
+
+	headers := make(chan *blockchain.Header, 1)
+	c.HeadersSubscribe(nil, func(header *blockchain.Header) { headers <- header })
+	require.Equal(t, 100, (<-headers).BlockHeight)
+	// The servers are assigned randomly. The second one is only used for the cross-checks.
+	second := server2
+	if c.rpc.ConnectedBackend() == "server2" {
+		second = server1
+	}
+
+	// Both servers agree. Unconfirmed transactions are not compared.
+	second.setHistory(blockchain.TxHistory{{Height: 10, TXHash: tx1}, {Height: 0, TXHash: tx2}})
+	require.Len(t, getHistory(), 1)
+	time.Sleep(200 * time.Millisecond)
+	require.Empty(t, c.Discrepancies())
+
+	// The answer of the first server is passed on, and the discrepancy is reported after the
+	// recheck.
+	second.setHistory(blockchain.TxHistory{})
+	require.Len(t, getHistory(), 1)
+	waitChanged()
+	discrepancies := c.Discrepancies()
+	require.Len(t, discrepancies, 1)
+	require.Equal(t, blockchain.DiscrepancyKindHistory, discrepancies[0].Kind)
+	require.Equal(t, blockchain.ScriptHashHex("scripthash"), discrepancies[0].ScriptHashHex)
+	require.ElementsMatch(t, []string{"server1", "server2"}, discrepancies[0].Servers)
+
+	// The discrepancy is resolved once the servers agree.
+	second.setHistory(blockchain.TxHistory{{Height: 10, TXHash: tx1}})
+	getHistory()
+	waitChanged()
+	require.Empty(t, c.Discrepancies())
+
+	// Fee estimates.
+	estimateFee := func() {
+		done := make(chan struct{})
+		c.EstimateFee(2,
+			func(fee *btcutil.Amount) {
+				require.Equal(t, btcutil.Amount(10000), *fee)
+				close(done)
+			},
+			func(err error) { require.NoError(t, err) })
+		<-done
+	}
+	second.lock.Lock()
+	second.fee = 0.0005
+	second.lock.Unlock()
+	estimateFee()
+	waitChanged()
+	require.Equal(t, blockchain.DiscrepancyKindFee, c.Discrepancies()[0].Kind)
+	second.lock.Lock()
+	second.fee = 0.00015
+	second.lock.Unlock()
+	estimateFee()
+	waitChanged()
+	require.Empty(t, c.Discrepancies())
+}
@@ -132,6 +132,13 @@ func newTCPConnection(address string, dialer proxy.Dialer) (net.Conn, error) {
 // NewElectrumConnection connects to an Electrum server and returns a ElectrumClient instance to
 // communicate with it.
 func NewElectrumConnection(servers []*config.ServerInfo, log *logrus.Entry, dialer proxy.Dialer) blockchain.Interface {
+	log = electrumLog(servers, log)
+	log.Debug("Connecting to Electrum server")
+	jsonrpcClient := jsonrpc.NewRPCClient(newBackends(servers, dialer), nil, log)
+	return client.NewElectrumClient(jsonrpcClient, log)
+}
+
+func electrumLog(servers []*config.ServerInfo, log *logrus.Entry) *logrus.Entry {
 	var serverList string
 	for _, serverInfo := range servers {
 		if serverList != "" {
@@ -139,9 +146,10 @@ func NewElectrumConnection(servers []*config.ServerInfo, log *logrus.Entry, dial
 		}
 		serverList += serverInfo.Server
 	}
-	log = log.WithFields(logrus.Fields{"group": "electrum", "server-type": "electrumx", "servers": serverList})
-	log.Debug("Connecting to Electrum server")
+	return log.WithFields(logrus.Fields{"group": "electrum", "server-type": "electrumx", "servers": serverList})
+}
 
+func newBackends(servers []*config.ServerInfo, dialer proxy.Dialer) []*jsonrpc.Backend {
 	var backends []*jsonrpc.Backend
 	for _, serverInfo := range servers {
 		serverInfo := serverInfo
@@ -152,8 +160,7 @@ func NewElectrumConnection(servers []*config.ServerInfo, log *logrus.Entry, dial
 			},
 		})
 	}
-	jsonrpcClient := jsonrpc.NewRPCClient(backends, nil, log)
-	return client.NewElectrumClient(jsonrpcClient, log)
+	return backends
 }
 
 // DownloadCert downloads the first element of the remote certificate chain.
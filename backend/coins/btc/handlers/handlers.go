@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +31,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip322"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/util"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
@@ -57,12 +59,30 @@ func NewHandlers(
 	handleFunc("/export", handlers.ensureAccountInitialized(handlers.postExportTransactions)).Methods("POST")
 	handleFunc("/info", handlers.ensureAccountInitialized(handlers.getAccountInfo)).Methods("GET")
 	handleFunc("/utxos", handlers.ensureAccountInitialized(handlers.getUTXOs)).Methods("GET")
+	handleFunc("/utxos/label", handlers.ensureAccountInitialized(handlers.postSetUTXOLabel)).Methods("POST")
+	handleFunc("/utxos/freeze", handlers.ensureAccountInitialized(handlers.postSetUTXOFrozen)).Methods("POST")
 	handleFunc("/balance", handlers.ensureAccountInitialized(handlers.getAccountBalance)).Methods("GET")
 	handleFunc("/sendtx", handlers.ensureAccountInitialized(handlers.postAccountSendTx)).Methods("POST")
 	handleFunc("/fee-targets", handlers.ensureAccountInitialized(handlers.getAccountFeeTargets)).Methods("GET")
 	handleFunc("/tx-proposal", handlers.ensureAccountInitialized(handlers.postAccountTxProposal)).Methods("POST")
+	handleFunc("/tx-proposal-psbt", handlers.ensureAccountInitialized(handlers.getTxProposalPSBT)).Methods("GET")
+	handleFunc("/broadcast-psbt", handlers.ensureAccountInitialized(handlers.postBroadcastPSBT)).Methods("POST")
+	handleFunc("/bump-fee", handlers.ensureAccountInitialized(handlers.postBumpFee)).Methods("POST")
+	handleFunc("/cpfp-proposal", handlers.ensureAccountInitialized(handlers.postCPFPTxProposal)).Methods("POST")
+	handleFunc("/speed-up-tx", handlers.ensureAccountInitialized(handlers.postReplaceETHTx(false))).Methods("POST")
+	handleFunc("/cancel-tx", handlers.ensureAccountInitialized(handlers.postReplaceETHTx(true))).Methods("POST")
+	handleFunc("/rebroadcast-tx", handlers.ensureAccountInitialized(handlers.postRebroadcastETHTx)).Methods("POST")
+	handleFunc("/fill-nonce-gap", handlers.ensureAccountInitialized(handlers.postFillNonceGap)).Methods("POST")
+	handleFunc("/ens-name", handlers.ensureAccountInitialized(handlers.postETHENSName)).Methods("POST")
+	handleFunc("/multisig/pending", handlers.ensureAccountInitialized(handlers.getMultisigPending)).Methods("GET")
+	handleFunc("/multisig/sign", handlers.ensureAccountInitialized(handlers.postMultisigSign)).Methods("POST")
+	handleFunc("/multisig/discard", handlers.ensureAccountInitialized(handlers.postMultisigDiscard)).Methods("POST")
 	handleFunc("/receive-addresses", handlers.ensureAccountInitialized(handlers.getReceiveAddresses)).Methods("GET")
 	handleFunc("/verify-address", handlers.ensureAccountInitialized(handlers.postVerifyAddress)).Methods("POST")
+	handleFunc("/can-sign-message", handlers.ensureAccountInitialized(handlers.getCanSignMessage)).Methods("GET")
+	handleFunc("/sign-message", handlers.ensureAccountInitialized(handlers.postSignMessage)).Methods("POST")
+	handleFunc("/eth-sign-typed-message", handlers.ensureAccountInitialized(handlers.postETHSignTypedMessage)).Methods("POST")
+	handleFunc("/verify-message", handlers.ensureAccountInitialized(handlers.postVerifyMessage)).Methods("POST")
 	handleFunc("/can-verify-extended-public-key", handlers.ensureAccountInitialized(handlers.getCanVerifyExtendedPublicKey)).Methods("GET")
 	handleFunc("/verify-extended-public-key", handlers.ensureAccountInitialized(handlers.postVerifyExtendedPublicKey)).Methods("POST")
 	handleFunc("/has-secure-output", handlers.ensureAccountInitialized(handlers.getHasSecureOutput)).Methods("GET")
@@ -118,6 +138,7 @@ type Transaction struct {
 	Fee                      FormattedAmount   `json:"fee"`
 	Time                     *string           `json:"time"`
 	Addresses                []string          `json:"addresses"`
+	AddressNames             []string          `json:"addressNames"`
 	Note                     string            `json:"note"`
 
 	// BTC specific fields.
@@ -157,8 +178,10 @@ func (handlers *Handlers) getAccountTransactions(_ *http.Request) (interface{},
 			formattedTime = &t
 		}
 		addresses := []string{}
+		addressNames := []string{}
 		for _, addressAndAmount := range txInfo.Addresses {
 			addresses = append(addresses, addressAndAmount.Address)
+			addressNames = append(addressNames, addressAndAmount.Name)
 		}
 		txInfoJSON := Transaction{
 			TxID:                     txInfo.TxID,
@@ -170,12 +193,13 @@ func (handlers *Handlers) getAccountTransactions(_ *http.Request) (interface{},
 				accounts.TxTypeSend:     "send",
 				accounts.TxTypeSendSelf: "send_to_self",
 			}[txInfo.Type],
-			Status:    txInfo.Status,
-			Amount:    handlers.formatAmountAsJSON(txInfo.Amount, false),
-			Fee:       feeString,
-			Time:      formattedTime,
-			Addresses: addresses,
-			Note:      handlers.account.TxNote(txInfo.InternalID),
+			Status:       txInfo.Status,
+			Amount:       handlers.formatAmountAsJSON(txInfo.Amount, false),
+			Fee:          feeString,
+			Time:         formattedTime,
+			Addresses:    addresses,
+			AddressNames: addressNames,
+			Note:         handlers.account.TxNote(txInfo.InternalID),
 		}
 		switch handlers.account.Coin().(type) {
 		case *btc.Coin:
@@ -237,17 +261,58 @@ func (handlers *Handlers) getUTXOs(_ *http.Request) (interface{}, error) {
 	}
 
 	for _, output := range t.SpendableOutputs() {
+		outPoint := output.OutPoint.String()
 		result = append(result,
 			map[string]interface{}{
-				"outPoint": output.OutPoint.String(),
+				"outPoint": outPoint,
 				"amount":   handlers.formatBTCAmountAsJSON(btcutil.Amount(output.TxOut.Value), false),
 				"address":  output.Address,
+				"label":    t.UTXOLabel(outPoint),
+				"frozen":   t.UTXOFrozen(outPoint),
 			})
 	}
 
 	return result, nil
 }
 
+func (handlers *Handlers) postSetUTXOLabel(r *http.Request) (interface{}, error) {
+	var args struct {
+		OutPoint string `json:"outPoint"`
+		Label    string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	t, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	outPoint, err := util.ParseOutPoint([]byte(args.OutPoint))
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.SetUTXOLabel(outPoint.String(), args.Label)
+}
+
+func (handlers *Handlers) postSetUTXOFrozen(r *http.Request) (interface{}, error) {
+	var args struct {
+		OutPoint string `json:"outPoint"`
+		Frozen   bool   `json:"frozen"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	t, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	outPoint, err := util.ParseOutPoint([]byte(args.OutPoint))
+	if err != nil {
+		return nil, err
+	}
+	return nil, t.SetUTXOFrozen(outPoint.String(), args.Frozen)
+}
+
 func (handlers *Handlers) getAccountBalance(_ *http.Request) (interface{}, error) {
 	balance, err := handlers.account.Balance()
 	if err != nil {
@@ -273,9 +338,16 @@ func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
 		CustomFee     string   `json:"customFee"`
 		Amount        string   `json:"amount"`
 		SelectedUTXOS []string `json:"selectedUTXOS"`
+		CoinSelection string   `json:"coinSelection"`
 		Data          string   `json:"data"`
 		Note          string   `json:"note"`
 		Counter       int      `json:"counter"`
+		// Recipients of a batch payment, used instead of Address, Amount and SendAll.
+		Recipients []struct {
+			Address string `json:"address"`
+			Amount  string `json:"amount"`
+			SendAll string `json:"sendAll"`
+		} `json:"recipients"`
 	}{}
 	if err := json.Unmarshal(jsonBytes, &jsonBody); err != nil {
 		return errp.WithStack(err)
@@ -294,6 +366,16 @@ func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
 	} else {
 		input.Amount = coin.NewSendAmount(jsonBody.Amount)
 	}
+	for _, recipient := range jsonBody.Recipients {
+		amount := coin.NewSendAmount(recipient.Amount)
+		if recipient.SendAll == "yes" {
+			amount = coin.NewSendAmountAll()
+		}
+		input.Recipients = append(input.Recipients, accounts.TxRecipient{
+			Address: recipient.Address,
+			Amount:  amount,
+		})
+	}
 	input.SelectedUTXOs = map[wire.OutPoint]struct{}{}
 	for _, outPointString := range jsonBody.SelectedUTXOS {
 		outPoint, err := util.ParseOutPoint([]byte(outPointString))
@@ -302,6 +384,10 @@ func (input *sendTxInput) UnmarshalJSON(jsonBytes []byte) error {
 		}
 		input.SelectedUTXOs[*outPoint] = struct{}{}
 	}
+	input.CoinSelection, err = accounts.NewCoinSelectionStrategy(jsonBody.CoinSelection)
+	if err != nil {
+		return err
+	}
 	input.Data, err = hex.DecodeString(strings.TrimPrefix(jsonBody.Data, "0x"))
 	if err != nil {
 		return errp.WithStack(errors.ErrInvalidData)
@@ -315,6 +401,9 @@ func (handlers *Handlers) postAccountSendTx(r *http.Request) (interface{}, error
 	if errp.Cause(err) == keystore.ErrSigningAborted {
 		return map[string]interface{}{"success": false, "aborted": true}, nil
 	}
+	if errp.Cause(err) == btc.ErrMultisigSignaturesMissing {
+		return map[string]interface{}{"success": false, "multisigPending": true}, nil
+	}
 	if err != nil {
 		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
 	}
@@ -340,6 +429,119 @@ func (handlers *Handlers) postAccountTxProposal(r *http.Request) (interface{}, e
 	if err != nil {
 		return txProposalError(err)
 	}
+	result := map[string]interface{}{
+		"success": true,
+		"amount":  handlers.formatAmountAsJSON(outputAmount, false),
+		"fee":     handlers.formatAmountAsJSON(fee, true),
+		"total":   handlers.formatAmountAsJSON(total, false),
+	}
+	if btcAccount, ok := handlers.account.(*btc.Account); ok {
+		outputAmounts, err := btcAccount.TxProposalOutputAmounts()
+		if err != nil {
+			return txProposalError(err)
+		}
+		outputs := make([]FormattedAmount, len(outputAmounts))
+		for i, outputAmount := range outputAmounts {
+			outputs[i] = handlers.formatAmountAsJSON(outputAmount, false)
+		}
+		result["outputs"] = outputs
+	}
+	if ethAccount, ok := handlers.account.(*eth.Account); ok {
+		recipientAddress, recipientName, err := ethAccount.TxProposalRecipient()
+		if err != nil {
+			return txProposalError(err)
+		}
+		result["recipientAddress"] = recipientAddress
+		result["recipientName"] = recipientName
+	}
+	return result, nil
+}
+
+func (handlers *Handlers) getTxProposalPSBT(_ *http.Request) (interface{}, error) {
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	encodedPSBT, err := btcAccount.TxProposalPSBT()
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "psbt": encodedPSBT}, nil
+}
+
+func (handlers *Handlers) postBroadcastPSBT(r *http.Request) (interface{}, error) {
+	var input struct {
+		PSBT string `json:"psbt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	txID, err := btcAccount.BroadcastPSBT(input.PSBT)
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "txID": txID}, nil
+}
+
+func (handlers *Handlers) postBumpFee(r *http.Request) (interface{}, error) {
+	var input struct {
+		TxID string `json:"txID"`
+		// FeeRate is the new fee rate in sat/vB.
+		FeeRate string `json:"feeRate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	feeRate, err := strconv.ParseFloat(input.FeeRate, 64)
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorCode": errors.ErrInvalidData.Error()}, nil
+	}
+	txID, err := btcAccount.BumpFee(input.TxID, btcutil.Amount(feeRate*1000))
+	if validationErr, ok := errp.Cause(err).(errors.TxValidationError); ok {
+		return map[string]interface{}{"success": false, "errorCode": validationErr.Error()}, nil
+	}
+	if errp.Cause(err) == keystore.ErrSigningAborted {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if errp.Cause(err) == btc.ErrMultisigSignaturesMissing {
+		return map[string]interface{}{"success": false, "multisigPending": true}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "txID": txID}, nil
+}
+
+func (handlers *Handlers) postCPFPTxProposal(r *http.Request) (interface{}, error) {
+	var input struct {
+		TxID      string `json:"txID"`
+		FeeTarget string `json:"feeTarget"`
+		// Provided in Sat/vByte.
+		CustomFee string `json:"customFee"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return txProposalError(errp.WithStack(err))
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	feeTargetCode, err := accounts.NewFeeTargetCode(input.FeeTarget)
+	if err != nil {
+		return txProposalError(errp.WithMessage(err, "Failed to retrieve fee target code"))
+	}
+	outputAmount, fee, total, err := btcAccount.CPFPTxProposal(input.TxID, feeTargetCode, input.CustomFee)
+	if err != nil {
+		return txProposalError(err)
+	}
 	return map[string]interface{}{
 		"success": true,
 		"amount":  handlers.formatAmountAsJSON(outputAmount, false),
@@ -348,6 +550,151 @@ func (handlers *Handlers) postAccountTxProposal(r *http.Request) (interface{}, e
 	}, nil
 }
 
+// postReplaceETHTx returns a handler replacing a pending outgoing Ethereum transaction, speeding it
+// up or cancelling it.
+func (handlers *Handlers) postReplaceETHTx(cancel bool) func(*http.Request) (interface{}, error) {
+	return func(r *http.Request) (interface{}, error) {
+		var input struct {
+			TxID      string `json:"txID"`
+			FeeTarget string `json:"feeTarget"`
+			// Provided in Gwei.
+			CustomFee string `json:"customFee"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		ethAccount, ok := handlers.account.(*eth.Account)
+		if !ok {
+			return nil, errp.New("Interface must be of type eth.Account")
+		}
+		feeTargetCode, err := accounts.NewFeeTargetCode(input.FeeTarget)
+		if err != nil {
+			return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+		}
+		replace := ethAccount.SpeedUpTx
+		if cancel {
+			replace = ethAccount.CancelTx
+		}
+		txID, err := replace(input.TxID, feeTargetCode, input.CustomFee)
+		if validationErr, ok := errp.Cause(err).(errors.TxValidationError); ok {
+			return map[string]interface{}{"success": false, "errorCode": validationErr.Error()}, nil
+		}
+		if errp.Cause(err) == keystore.ErrSigningAborted {
+			return map[string]interface{}{"success": false, "aborted": true}, nil
+		}
+		if err != nil {
+			return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+		}
+		return map[string]interface{}{"success": true, "txID": txID}, nil
+	}
+}
+
+func (handlers *Handlers) postRebroadcastETHTx(r *http.Request) (interface{}, error) {
+	var input struct {
+		TxID string `json:"txID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	ethAccount, ok := handlers.account.(*eth.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type eth.Account")
+	}
+	if err := ethAccount.RebroadcastTx(input.TxID); err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+// postFillNonceGap sends a transaction with the nonce of a nonce gap, see eth.NonceIssueGap.
+func (handlers *Handlers) postFillNonceGap(r *http.Request) (interface{}, error) {
+	var input struct {
+		Nonce     uint64 `json:"nonce"`
+		FeeTarget string `json:"feeTarget"`
+		// Provided in Gwei.
+		CustomFee string `json:"customFee"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	ethAccount, ok := handlers.account.(*eth.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type eth.Account")
+	}
+	feeTargetCode, err := accounts.NewFeeTargetCode(input.FeeTarget)
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	txID, err := ethAccount.FillNonceGap(input.Nonce, feeTargetCode, input.CustomFee)
+	if validationErr, ok := errp.Cause(err).(errors.TxValidationError); ok {
+		return map[string]interface{}{"success": false, "errorCode": validationErr.Error()}, nil
+	}
+	if errp.Cause(err) == keystore.ErrSigningAborted {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "txID": txID}, nil
+}
+
+// postETHENSName returns the verified ENS name of an address, to be shown when confirming a
+// transaction.
+func (handlers *Handlers) postETHENSName(r *http.Request) (interface{}, error) {
+	var input struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	ethAccount, ok := handlers.account.(*eth.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type eth.Account")
+	}
+	name, err := ethAccount.ENSName(input.Address)
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "name": name}, nil
+}
+
+func (handlers *Handlers) getMultisigPending(_ *http.Request) (interface{}, error) {
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	return btcAccount.PendingMultisigTx()
+}
+
+func (handlers *Handlers) postMultisigSign(_ *http.Request) (interface{}, error) {
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	err := btcAccount.SignPendingMultisigTx()
+	if errp.Cause(err) == keystore.ErrSigningAborted {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if errp.Cause(err) == btc.ErrMultisigSignaturesMissing {
+		return map[string]interface{}{"success": false, "multisigPending": true}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true}, nil
+}
+
+func (handlers *Handlers) postMultisigDiscard(_ *http.Request) (interface{}, error) {
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	if err := btcAccount.DiscardPendingMultisigTx(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 func (handlers *Handlers) getAccountFeeTargets(_ *http.Request) (interface{}, error) {
 	type jsonFeeTarget struct {
 		Code        accounts.FeeTargetCode `json:"code"`
@@ -385,6 +732,16 @@ type statusResponse struct {
 	// FatalError indicates that there was a fatal error in handling the account. When this happens,
 	// an error is shown to the user and the account is made unusable.
 	FatalError bool `json:"fatalError"`
+
+	// ETH specific fields.
+	// NonceIssues are problems with the nonces of the outgoing transactions, which can be resolved
+	// by rebroadcasting or replacing a transaction.
+	NonceIssues []eth.NonceIssue `json:"nonceIssues,omitempty"`
+
+	// BTC specific fields.
+	// BlockchainDiscrepancies are disagreements between the blockchain servers, which indicate that
+	// one of them is lying or omitting transactions.
+	BlockchainDiscrepancies []btc.BlockchainDiscrepancy `json:"blockchainDiscrepancies,omitempty"`
 }
 
 func (handlers *Handlers) getAccountStatus(_ *http.Request) (interface{}, error) {
@@ -397,11 +754,18 @@ func (handlers *Handlers) getAccountStatus(_ *http.Request) (interface{}, error)
 		s := offlineErr.Error()
 		offlineError = &s
 	}
-	return statusResponse{
+	response := statusResponse{
 		Synced:       handlers.account.Synced(),
 		OfflineError: offlineError,
 		FatalError:   handlers.account.FatalError(),
-	}, nil
+	}
+	if ethAccount, ok := handlers.account.(*eth.Account); ok {
+		response.NonceIssues = ethAccount.NonceIssues()
+	}
+	if btcAccount, ok := handlers.account.(*btc.Account); ok {
+		response.BlockchainDiscrepancies = btcAccount.BlockchainDiscrepancies()
+	}
+	return response, nil
 }
 
 type jsonAddress struct {
@@ -432,6 +796,90 @@ func (handlers *Handlers) postVerifyAddress(r *http.Request) (interface{}, error
 	return handlers.account.VerifyAddress(addressID)
 }
 
+func (handlers *Handlers) getCanSignMessage(_ *http.Request) (interface{}, error) {
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return false, nil
+	}
+	return btcAccount.CanSignMessageBIP322(), nil
+}
+
+// postSignMessage signs a message with a receive address of the account using BIP-322.
+func (handlers *Handlers) postSignMessage(r *http.Request) (interface{}, error) {
+	var input struct {
+		AddressID string `json:"addressID"`
+		Message   string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	signature, err := btcAccount.SignMessageBIP322(input.AddressID, []byte(input.Message))
+	if errp.Cause(err) == keystore.ErrSigningAborted {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "signature": signature}, nil
+}
+
+// postETHSignTypedMessage signs EIP-712 typed data with the key of an Ethereum account.
+func (handlers *Handlers) postETHSignTypedMessage(r *http.Request) (interface{}, error) {
+	var input struct {
+		// JSON encoded typed data.
+		TypedData string `json:"typedData"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	ethAccount, ok := handlers.account.(*eth.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type eth.Account")
+	}
+	signature, err := ethAccount.SignTypedMessage([]byte(input.TypedData))
+	if errp.Cause(err) == keystore.ErrSigningAborted {
+		return map[string]interface{}{"success": false, "aborted": true}, nil
+	}
+	if errp.Cause(err) == keystore.ErrUnsupported {
+		return map[string]interface{}{"success": false, "errorCode": keystore.ErrUnsupported.Error()}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "signature": signature}, nil
+}
+
+// postVerifyMessage checks a BIP-322 or legacy message signature of any address.
+func (handlers *Handlers) postVerifyMessage(r *http.Request) (interface{}, error) {
+	var input struct {
+		Address   string `json:"address"`
+		Message   string `json:"message"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	btcAccount, ok := handlers.account.(*btc.Account)
+	if !ok {
+		return nil, errp.New("Interface must be of type btc.Account")
+	}
+	err := btcAccount.VerifyMessageBIP322(input.Address, []byte(input.Message), input.Signature)
+	if validationErr, ok := errp.Cause(err).(errors.TxValidationError); ok {
+		return map[string]interface{}{"success": false, "errorCode": validationErr.Error()}, nil
+	}
+	if errp.Cause(err) == bip322.ErrInvalidSignature {
+		return map[string]interface{}{"success": true, "valid": false}, nil
+	}
+	if err != nil {
+		return map[string]interface{}{"success": false, "errorMessage": err.Error()}, nil
+	}
+	return map[string]interface{}{"success": true, "valid": true}, nil
+}
+
 func (handlers *Handlers) getCanVerifyExtendedPublicKey(_ *http.Request) (interface{}, error) {
 	switch specificAccount := handlers.account.(type) {
 	case *btc.Account:
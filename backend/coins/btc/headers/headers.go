@@ -35,6 +35,10 @@ import (
 
 const reorgLimit = 100
 
+// backfillWalkLimit is the maximum number of stored headers checked per backfill step, see
+// backfill().
+const backfillWalkLimit = 10000
+
 // Event instances are sent to the onEvent callback.
 type Event string
 
@@ -72,8 +76,12 @@ type Headers struct {
 	// tipAtInitTime is the tip at init time, i.e. the last tip known, loaded from the DB. It is
 	// used to show the sync progress since the last time (catch up).
 	tipAtInitTime int
-	kickChan      chan struct{}
-	quitChan      chan struct{}
+	// backfillHeight is the lowest height from which on the headers are known to connect to a
+	// loaded snapshot. The headers below are not verified yet, see backfill(). Zero if no snapshot
+	// starting above the genesis block was loaded.
+	backfillHeight int
+	kickChan       chan struct{}
+	quitChan       chan struct{}
 
 	eventCallbacks []func(Event)
 	events         chan Event
@@ -121,6 +129,11 @@ func NewHeaders(
 // checkpoint returns the latest checkpoint for the current chain. It panics if the network is
 // unknown.
 func (headers *Headers) checkpoint() chaincfg.Checkpoint {
+	return checkpoint(headers.net)
+}
+
+// checkpoint returns the latest checkpoint of a chain. It panics if the network is unknown.
+func checkpoint(net *chaincfg.Params) chaincfg.Checkpoint {
 	// We define our own checkpoints over using headers.net.Checkpoints, because they are defined in
 	// the vendored btcd dep, and we want to control it. Furthermore, the chaincfg.Params are evil
 	// globals registered in the lib's `init()`, so we can't replicate the instances ourselves.
@@ -132,7 +145,7 @@ func (headers *Headers) checkpoint() chaincfg.Checkpoint {
 		}
 		return hash
 	}
-	switch headers.net.Net {
+	switch net.Net {
 	case chaincfg.MainNetParams.Net: // BTC
 		return chaincfg.Checkpoint{
 			Height: 629350,
@@ -150,6 +163,11 @@ func (headers *Headers) checkpoint() chaincfg.Checkpoint {
 		return chaincfg.Checkpoint{
 			Height: 1464330,
 			Hash:   mustUnhex("4329edb4d3eb20baded30bc67f59ce7d951de176012688124a65fe55e60244b4")}
+	case chaincfg.SigNetParams.Net, chaincfg.RegressionNetParams.Net: // SBTC, RBTC
+		// Blocks on these networks are cheap to produce, so a checkpoint would not protect
+		// against much. The proof of work of signet headers is verified from the genesis block
+		// on.
+		return chaincfg.Checkpoint{Height: 0, Hash: net.GenesisHash}
 	default:
 		panic("unknown network")
 	}
@@ -218,9 +236,24 @@ func (headers *Headers) download() {
 				batchChan <- batchInfo{blockHeaders, max}
 			})
 		batch := <-batchChan
+		synced := len(batch.blockHeaders) < min(batch.max, headers.headersPerBatch)
 		if err := headers.processBatch(db, tip, batch.blockHeaders, batch.max); err != nil {
 			headers.log.WithError(err).Panic("processBatch")
 		}
+		if !synced || headers.backfillHeight == 0 {
+			return
+		}
+		more, err := headers.backfill(db)
+		if err != nil {
+			headers.log.WithError(err).Error("Could not download the headers below the snapshot")
+			return
+		}
+		if more {
+			headers.kick()
+		} else {
+			headers.log.Info("The headers below the snapshot are synced")
+			headers.notifyEvent(EventSynced)
+		}
 	}
 
 	for {
@@ -240,34 +273,64 @@ func (headers *Headers) download() {
 
 var errPrevHash = errors.New("header prevhash does not match")
 
-func (headers *Headers) getTarget(db DBInterface, index int) (*big.Int, error) {
-	targetTimespan := int64(headers.net.TargetTimespan / time.Second)
-	targetTimePerBlock := int64(headers.net.TargetTimePerBlock / time.Second)
+// checksDifficulty returns true if the difficulty and proof of work of the headers of the network
+// are verified. Testnets allow min-difficulty blocks, which we don't check. Signet retargets like
+// mainnet.
+func checksDifficulty(net *chaincfg.Params) bool {
+	return net.Net == chaincfg.MainNetParams.Net || net.Net == ltc.MainNetParams.Net ||
+		net.Net == chaincfg.SigNetParams.Net
+}
+
+// retargetWindow returns the heights of the first and last header of the previous difficulty
+// retarget window, which determine the target of the header at the given height. ok is false if
+// the height is in the first window, which uses the target of the genesis block.
+func retargetWindow(net *chaincfg.Params, index int) (firstIndex int, lastIndex int, ok bool) {
+	targetTimespan := int64(net.TargetTimespan / time.Second)
+	targetTimePerBlock := int64(net.TargetTimePerBlock / time.Second)
 	blocksPerRetarget := int(targetTimespan / targetTimePerBlock)
 	chunkIndex := (index / blocksPerRetarget) - 1
 	if chunkIndex == -1 {
-		return btcdBlockchain.CompactToBig(headers.net.GenesisBlock.Header.Bits), nil
+		return 0, 0, false
 	}
 
-	firstIndex := chunkIndex * blocksPerRetarget
-	if headers.net.Net == ltc.MainNetParams.Net && chunkIndex > 0 {
+	firstIndex = chunkIndex * blocksPerRetarget
+	if net.Net == ltc.MainNetParams.Net && chunkIndex > 0 {
 		// Litecoin includes the last block of the previous window to fix a time warp attack:
 		// https://litecoin.info/index.php/Time_warp_attack#cite_note-2
 		firstIndex--
 	}
-	first, err := db.HeaderByHeight(firstIndex)
+	return firstIndex, (chunkIndex+1)*blocksPerRetarget - 1, true
+}
+
+func (headers *Headers) getTarget(db DBInterface, index int) (*big.Int, error) {
+	return getTarget(headers.net, db.HeaderByHeight, index)
+}
+
+// getTarget returns the expected target of the header at the given height, using headerByHeight
+// to look up the headers of the previous difficulty retarget window.
+func getTarget(
+	net *chaincfg.Params,
+	headerByHeight func(int) (*wire.BlockHeader, error),
+	index int,
+) (*big.Int, error) {
+	targetTimespan := int64(net.TargetTimespan / time.Second)
+	firstIndex, lastIndex, ok := retargetWindow(net, index)
+	if !ok {
+		return btcdBlockchain.CompactToBig(net.GenesisBlock.Header.Bits), nil
+	}
+	first, err := headerByHeight(firstIndex)
 	if err != nil {
 		return nil, err
 	}
-	last, err := db.HeaderByHeight((chunkIndex+1)*blocksPerRetarget - 1)
+	last, err := headerByHeight(lastIndex)
 	if err != nil {
 		return nil, err
 	}
 	lastTarget := btcdBlockchain.CompactToBig(last.Bits)
 	timespan := last.Timestamp.Unix() - first.Timestamp.Unix()
 
-	minRetargetTimespan := targetTimespan / headers.net.RetargetAdjustmentFactor
-	maxRetargetTimespan := targetTimespan * headers.net.RetargetAdjustmentFactor
+	minRetargetTimespan := targetTimespan / net.RetargetAdjustmentFactor
+	maxRetargetTimespan := targetTimespan * net.RetargetAdjustmentFactor
 	if timespan < minRetargetTimespan {
 		timespan = minRetargetTimespan
 	} else if timespan > maxRetargetTimespan {
@@ -275,17 +338,23 @@ func (headers *Headers) getTarget(db DBInterface, index int) (*big.Int, error) {
 	}
 	newTarget := new(big.Int).Mul(lastTarget, big.NewInt(timespan))
 	newTarget.Div(newTarget, big.NewInt(targetTimespan))
-	if newTarget.Cmp(headers.net.PowLimit) > 0 {
-		newTarget.Set(headers.net.PowLimit)
+	if newTarget.Cmp(net.PowLimit) > 0 {
+		newTarget.Set(net.PowLimit)
 	}
 	return newTarget, nil
 }
 
 func (headers *Headers) powHash(msg []byte) chainhash.Hash {
-	switch headers.net.Net {
-	case chaincfg.MainNetParams.Net:
+	return powHash(headers.net, msg)
+}
+
+// powHash returns the hash of the serialized header which must meet the target.
+func powHash(net *chaincfg.Params, msg []byte) chainhash.Hash {
+	switch net.Net {
+	case chaincfg.MainNetParams.Net, chaincfg.TestNet3Params.Net, chaincfg.SigNetParams.Net,
+		chaincfg.RegressionNetParams.Net:
 		return chainhash.DoubleHashH(msg)
-	case ltc.MainNetParams.Net:
+	case ltc.MainNetParams.Net, ltc.TestNet4Params.Net:
 		const (
 			N = 1024
 			r = 1
@@ -332,7 +401,7 @@ func (headers *Headers) canConnect(db DBInterface, tip int, header *wire.BlockHe
 			headers.log.Infof("checkpoint at %d matches", tip)
 		}
 		// Check Difficulty, PoW.
-		if headers.net.Net == chaincfg.MainNetParams.Net || headers.net.Net == ltc.MainNetParams.Net {
+		if checksDifficulty(headers.net) {
 			newTarget, err := headers.getTarget(db, tip)
 			if err != nil {
 				return err
@@ -421,7 +490,8 @@ func (headers *Headers) processBatch(
 }
 
 // VerifiedHeaderByHeight returns the header at the given height. Returns nil if the headers are not synced
-// up to this height yet OR if the headers are not synced up to the latest checkpoint yet.
+// up to this height yet OR if the headers are not synced up to the latest checkpoint yet OR if the
+// header is below a loaded snapshot and not verified to connect to it yet.
 func (headers *Headers) VerifiedHeaderByHeight(height int) (*wire.BlockHeader, error) {
 	defer headers.lock.RLock()()
 
@@ -430,13 +500,96 @@ func (headers *Headers) VerifiedHeaderByHeight(height int) (*wire.BlockHeader, e
 		return nil, err
 	}
 
-	if tip < int(headers.checkpoint().Height) {
+	if tip < int(headers.checkpoint().Height) || height < headers.backfillHeight {
 		return nil, nil
 	}
 
 	return headers.db.HeaderByHeight(height)
 }
 
+// backfill verifies that the headers below a loaded snapshot (see LoadSnapshot()) connect to it,
+// going down from headers.backfillHeight. Stored headers which connect are kept. Missing headers
+// and headers which do not connect, e.g. of a fork synced before the snapshot was loaded, are
+// downloaded and verified by connecting them backwards to the snapshot. Returns true if there are
+// more headers to check. Requires headers.lock.
+func (headers *Headers) backfill(db DBInterface) (bool, error) {
+	if headers.backfillHeight == 0 {
+		return false, nil
+	}
+	tip, err := db.Tip()
+	if err != nil {
+		return false, err
+	}
+	if headers.backfillHeight > tip {
+		// The snapshot headers were reverted in a reorg, so the remaining headers can't be
+		// verified against them anymore.
+		headers.log.Info("The snapshot headers were reverted, syncing all headers again")
+		headers.backfillHeight = 0
+		if err := db.RevertTo(-1); err != nil {
+			return false, err
+		}
+		headers.kick()
+		return false, nil
+	}
+	current, err := db.HeaderByHeight(headers.backfillHeight)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; headers.backfillHeight > 0; i++ {
+		if i == backfillWalkLimit {
+			return true, nil
+		}
+		previous, err := db.HeaderByHeight(headers.backfillHeight - 1)
+		if err != nil {
+			return false, err
+		}
+		if previous == nil || previous.BlockHash() != current.PrevBlock {
+			break
+		}
+		headers.backfillHeight--
+		current = previous
+	}
+	if headers.backfillHeight == 0 {
+		return false, nil
+	}
+
+	startHeight := headers.backfillHeight - headers.headersPerBatch
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	count := headers.backfillHeight - startHeight
+	batchChan := make(chan batchInfo)
+	headers.blockchain.Headers(
+		startHeight, count,
+		func(blockHeaders []*wire.BlockHeader, max int) {
+			batchChan <- batchInfo{blockHeaders, max}
+		})
+	batch := <-batchChan
+	if len(batch.blockHeaders) != count {
+		return false, errp.Newf("expected %d headers from height %d, got %d",
+			count, startHeight, len(batch.blockHeaders))
+	}
+	prevBlock := current.PrevBlock
+	for i := count - 1; i >= 0; i-- {
+		if batch.blockHeaders[i].BlockHash() != prevBlock {
+			return false, errp.Newf("header %d does not connect to the snapshot", startHeight+i)
+		}
+		prevBlock = batch.blockHeaders[i].PrevBlock
+	}
+	for i, blockHeader := range batch.blockHeaders {
+		if err := db.PutHeader(startHeight+i, blockHeader); err != nil {
+			return false, err
+		}
+	}
+	if err := db.Flush(); err != nil {
+		// Ignore error, not critical.
+		headers.log.WithError(err).Error("Failed to flush")
+	}
+	headers.backfillHeight = startHeight
+	headers.log.Debugf("Syncing headers below the snapshot; height: %d", startHeight)
+	return startHeight > 0, nil
+}
+
 func (headers *Headers) kick() {
 	select {
 	case headers.kickChan <- struct{}{}:
@@ -45,3 +45,16 @@ func TestClose(t *testing.T) {
 	}
 
 }
+
+func TestCheckpointSignetRegtest(t *testing.T) {
+	signetCheckpoint := checkpoint(&chaincfg.SigNetParams)
+	require.Equal(t, int32(0), signetCheckpoint.Height)
+	require.Equal(t,
+		"00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6",
+		signetCheckpoint.Hash.String())
+	require.Equal(t, *signetCheckpoint.Hash, chaincfg.SigNetParams.GenesisBlock.Header.BlockHash())
+
+	regtestCheckpoint := checkpoint(&chaincfg.RegressionNetParams)
+	require.Equal(t, int32(0), regtestCheckpoint.Height)
+	require.Equal(t, *chaincfg.RegressionNetParams.GenesisHash, *regtestCheckpoint.Hash)
+}
@@ -0,0 +1,277 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// A snapshot is a signed range of headers with a trusted tip, which is loaded into the headers
+// database so that only the headers after the tip need to be downloaded and validated. It is
+// serialized as:
+//
+//   snapshotHeader | count * 80 bytes serialized headers | 65 bytes compact signature
+//
+// The signature is over the double SHA256 hash of everything before it. The integers in the
+// snapshotHeader are little endian.
+
+const (
+	snapshotVersion = 1
+	// maxSnapshotHeaders limits the memory used when reading a snapshot.
+	maxSnapshotHeaders = 10000000
+	signatureSize      = 65
+)
+
+var snapshotMagic = [4]byte{'B', 'B', 'H', 'S'}
+
+type snapshotHeader struct {
+	Magic       [4]byte
+	Version     uint8
+	Net         wire.BitcoinNet
+	StartHeight uint32
+	Count       uint32
+}
+
+// validateSnapshot checks that the headers starting at startHeight form a chain which can be
+// continued by the headers package: the headers of the difficulty retarget window preceding any
+// header after the tip must be included, and the checkpoint must be included and match if the
+// snapshot reaches it. The difficulty and proof of work are verified the same way as when syncing
+// the headers, i.e. the proof of work only after the checkpoint.
+func validateSnapshot(net *chaincfg.Params, startHeight int, blockHeaders []*wire.BlockHeader) error {
+	if len(blockHeaders) == 0 {
+		return errp.New("The snapshot contains no headers")
+	}
+	tip := startHeight + len(blockHeaders) - 1
+	if maxStartHeight := MaxSnapshotStartHeight(net, tip); startHeight > maxStartHeight {
+		return errp.Newf("The snapshot must start at or before height %d", maxStartHeight)
+	}
+	if startHeight == 0 && blockHeaders[0].BlockHash() != *net.GenesisHash {
+		return errp.New("The snapshot does not start with the genesis block")
+	}
+	for i := 1; i < len(blockHeaders); i++ {
+		if blockHeaders[i].PrevBlock != blockHeaders[i-1].BlockHash() {
+			return errp.Newf("The snapshot headers do not connect at height %d", startHeight+i)
+		}
+	}
+	lastCheckpoint := checkpoint(net)
+	checkpointIndex := int(lastCheckpoint.Height) - startHeight
+	if checkpointIndex >= 0 && checkpointIndex < len(blockHeaders) &&
+		blockHeaders[checkpointIndex].BlockHash() != *lastCheckpoint.Hash {
+		return errp.Newf("The snapshot does not match the checkpoint at height %d", lastCheckpoint.Height)
+	}
+
+	headerByHeight := func(height int) (*wire.BlockHeader, error) {
+		index := height - startHeight
+		if index < 0 || index >= len(blockHeaders) {
+			return nil, errp.Newf("The snapshot has no header at height %d", height)
+		}
+		return blockHeaders[index], nil
+	}
+	for i, blockHeader := range blockHeaders {
+		height := startHeight + i
+		if height == 0 {
+			continue
+		}
+		target := btcdBlockchain.CompactToBig(blockHeader.Bits)
+		if checksDifficulty(net) {
+			// The targets of headers whose previous retarget window is not part of the snapshot
+			// can't be checked here, but their hashes are covered by the checkpoint.
+			firstIndex, _, ok := retargetWindow(net, height)
+			if !ok || firstIndex >= startHeight {
+				expectedTarget, err := getTarget(net, headerByHeight, height)
+				if err != nil {
+					return err
+				}
+				if blockHeader.Bits != btcdBlockchain.BigToCompact(expectedTarget) {
+					return errp.Newf("The snapshot header %d has an unexpected difficulty", height)
+				}
+			}
+		}
+		if height <= int(lastCheckpoint.Height) {
+			continue
+		}
+		if target.Sign() <= 0 || target.Cmp(net.PowLimit) > 0 {
+			return errp.Newf("The snapshot header %d has an invalid target", height)
+		}
+		headerSerialized := &bytes.Buffer{}
+		if err := blockHeader.BtcEncode(headerSerialized, 0, wire.BaseEncoding); err != nil {
+			return errp.WithStack(err)
+		}
+		hash := powHash(net, headerSerialized.Bytes())
+		if btcdBlockchain.HashToBig(&hash).Cmp(target) > 0 {
+			return errp.Newf("The snapshot header %d has insufficient proof of work", height)
+		}
+	}
+	return nil
+}
+
+// WriteSnapshot serializes and signs a snapshot of the headers starting at startHeight.
+func WriteSnapshot(
+	writer io.Writer,
+	net *chaincfg.Params,
+	startHeight int,
+	blockHeaders []*wire.BlockHeader,
+	key *btcec.PrivateKey,
+) error {
+	if err := validateSnapshot(net, startHeight, blockHeaders); err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	bufferedWriter := bufio.NewWriter(writer)
+	hashingWriter := io.MultiWriter(bufferedWriter, hasher)
+	header := snapshotHeader{
+		Magic:       snapshotMagic,
+		Version:     snapshotVersion,
+		Net:         net.Net,
+		StartHeight: uint32(startHeight),
+		Count:       uint32(len(blockHeaders)),
+	}
+	if err := binary.Write(hashingWriter, binary.LittleEndian, header); err != nil {
+		return errp.WithStack(err)
+	}
+	for _, blockHeader := range blockHeaders {
+		if err := blockHeader.Serialize(hashingWriter); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	signature, err := btcec.SignCompact(btcec.S256(), key, chainhash.HashB(hasher.Sum(nil)), true)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if _, err := bufferedWriter.Write(signature); err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(bufferedWriter.Flush())
+}
+
+// LoadSnapshot stores the headers of a snapshot (see WriteSnapshot()) in the database, so that only
+// the headers after the snapshot tip need to be downloaded. The snapshot is skipped if the database
+// already reaches its tip, in which case only the beginning of the snapshot is read. Headers in the
+// database which do not connect to the snapshot are discarded. isTrustedSigner is called with the
+// public key which signed the snapshot. Returns true if the snapshot was loaded. Must be called
+// before Initialize().
+func (headers *Headers) LoadSnapshot(
+	reader io.Reader, isTrustedSigner func(*btcec.PublicKey) bool) (bool, error) {
+	reader = bufio.NewReader(reader)
+	hasher := sha256.New()
+	hashingReader := io.TeeReader(reader, hasher)
+	var header snapshotHeader
+	if err := binary.Read(hashingReader, binary.LittleEndian, &header); err != nil {
+		return false, errp.WithStack(err)
+	}
+	if header.Magic != snapshotMagic || header.Version != snapshotVersion {
+		return false, errp.New("Not a headers snapshot")
+	}
+	if header.Net != headers.net.Net {
+		return false, errp.Newf("The snapshot is for network %s, expected %s", header.Net, headers.net.Net)
+	}
+	if header.Count == 0 || header.Count > maxSnapshotHeaders {
+		return false, errp.Newf("Invalid number of headers in the snapshot: %d", header.Count)
+	}
+	startHeight := int(header.StartHeight)
+	tip := startHeight + int(header.Count) - 1
+
+	defer headers.lock.Lock()()
+	dbTip, err := headers.db.Tip()
+	if err != nil {
+		return false, err
+	}
+	if dbTip >= tip {
+		// The snapshot was loaded before. The headers below it might not be verified yet.
+		headers.setBackfillHeight(startHeight)
+		return false, nil
+	}
+
+	blockHeaders := make([]*wire.BlockHeader, header.Count)
+	for i := range blockHeaders {
+		blockHeaders[i] = &wire.BlockHeader{}
+		if err := blockHeaders[i].Deserialize(hashingReader); err != nil {
+			return false, errp.WithStack(err)
+		}
+	}
+	signature := make([]byte, signatureSize)
+	if _, err := io.ReadFull(reader, signature); err != nil {
+		return false, errp.WithStack(err)
+	}
+	signer, _, err := btcec.RecoverCompact(btcec.S256(), signature, chainhash.HashB(hasher.Sum(nil)))
+	if err != nil {
+		return false, errp.Wrap(err, "Invalid snapshot signature")
+	}
+	if !isTrustedSigner(signer) {
+		return false, errp.Newf("The snapshot is signed by an untrusted key %x", signer.SerializeCompressed())
+	}
+	if err := validateSnapshot(headers.net, startHeight, blockHeaders); err != nil {
+		return false, err
+	}
+
+	// The headers in the database below the snapshot are kept. They are verified to connect to the
+	// snapshot, or replaced if they don't, in backfill().
+	for i, blockHeader := range blockHeaders {
+		if err := headers.db.PutHeader(startHeight+i, blockHeader); err != nil {
+			return false, err
+		}
+	}
+	if err := headers.db.Flush(); err != nil {
+		return false, err
+	}
+	headers.setBackfillHeight(startHeight)
+	headers.log.Infof("Loaded headers snapshot from height %d to %d", startHeight, tip)
+	return true, nil
+}
+
+// setBackfillHeight marks the headers below height as not verified until backfill() connects them
+// to the snapshot starting at height. Requires headers.lock.
+func (headers *Headers) setBackfillHeight(height int) {
+	if height > headers.backfillHeight {
+		headers.backfillHeight = height
+	}
+}
+
+// TrustedSigners returns a function for LoadSnapshot() which trusts the given compressed public keys.
+func TrustedSigners(trustedKeys [][]byte) func(*btcec.PublicKey) bool {
+	return func(signer *btcec.PublicKey) bool {
+		for _, key := range trustedKeys {
+			if bytes.Equal(key, signer.SerializeCompressed()) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MaxSnapshotStartHeight returns the highest height a snapshot with the given tip can start at, see
+// validateSnapshot().
+func MaxSnapshotStartHeight(net *chaincfg.Params, tip int) int {
+	maxStartHeight := 0
+	if firstIndex, _, ok := retargetWindow(net, tip+1); ok {
+		maxStartHeight = firstIndex
+	}
+	if checkpointHeight := int(checkpoint(net).Height); tip >= checkpointHeight &&
+		checkpointHeight < maxStartHeight {
+		maxStartHeight = checkpointHeight
+	}
+	return maxStartHeight
+}
@@ -0,0 +1,292 @@
+// Copyright 2018 Shift Devices AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	btcdBlockchain "github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testChain(count int) []*wire.BlockHeader {
+	return testChainFrom(&chaincfg.TestNet3Params, count)
+}
+
+func testChainFrom(net *chaincfg.Params, count int) []*wire.BlockHeader {
+	blockHeaders := []*wire.BlockHeader{&net.GenesisBlock.Header}
+	for len(blockHeaders) < count {
+		previous := blockHeaders[len(blockHeaders)-1]
+		blockHeaders = append(blockHeaders, &wire.BlockHeader{
+			Version:   previous.Version,
+			PrevBlock: previous.BlockHash(),
+			Timestamp: previous.Timestamp.Add(10 * time.Minute),
+			Bits:      previous.Bits,
+		})
+	}
+	return blockHeaders
+}
+
+func newSnapshotTestHeaders(db map[int]*wire.BlockHeader) *Headers {
+	return newSnapshotTestHeadersWithBlockchain(
+		&chaincfg.TestNet3Params, db, &mocks.BlockchainMock{})
+}
+
+func newSnapshotTestHeadersWithBlockchain(
+	net *chaincfg.Params, db map[int]*wire.BlockHeader, blockchain *mocks.BlockchainMock) *Headers {
+	return NewHeaders(
+		net,
+		&dbMock{
+			putHeader: func(height int, header *wire.BlockHeader) error {
+				db[height] = header
+				return nil
+			},
+			headerByHeight: func(height int) (*wire.BlockHeader, error) {
+				return db[height], nil
+			},
+			revertTo: func(tip int) error {
+				for height := range db {
+					if height > tip {
+						delete(db, height)
+					}
+				}
+				return nil
+			},
+			tip: func() (int, error) {
+				tip := -1
+				for height := range db {
+					if height > tip {
+						tip = height
+					}
+				}
+				return tip, nil
+			},
+		},
+		blockchain,
+		(&logrus.Logger{}).WithField("group", "headers_test"),
+	)
+}
+
+func TestSnapshot(t *testing.T) {
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	trusted := TrustedSigners([][]byte{key.PubKey().SerializeCompressed()})
+	blockHeaders := testChain(20)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, WriteSnapshot(&snapshot, &chaincfg.TestNet3Params, 0, blockHeaders, key))
+
+	// Untrusted signer.
+	db := map[int]*wire.BlockHeader{}
+	_, err = newSnapshotTestHeaders(db).LoadSnapshot(
+		bytes.NewReader(snapshot.Bytes()), TrustedSigners(nil))
+	require.Error(t, err)
+	require.Empty(t, db)
+
+	// Wrong network.
+	_, err = NewHeaders(
+		&chaincfg.MainNetParams,
+		&dbMock{},
+		&mocks.BlockchainMock{},
+		(&logrus.Logger{}).WithField("group", "headers_test"),
+	).LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+	require.Error(t, err)
+
+	// Tampered header.
+	tampered := append([]byte{}, snapshot.Bytes()...)
+	tampered[17+80*5] ^= 1
+	_, err = newSnapshotTestHeaders(db).LoadSnapshot(bytes.NewReader(tampered), trusted)
+	require.Error(t, err)
+	require.Empty(t, db)
+
+	// Headers in the database below the snapshot are overwritten.
+	db[0] = blockHeaders[0]
+	db[1] = &wire.BlockHeader{Nonce: 1}
+	loaded, err := newSnapshotTestHeaders(db).LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+	require.NoError(t, err)
+	require.True(t, loaded)
+	require.Len(t, db, len(blockHeaders))
+	for height, blockHeader := range blockHeaders {
+		require.Equal(t, blockHeader.BlockHash(), db[height].BlockHash())
+	}
+
+	// The database already reaches the snapshot tip.
+	loaded, err = newSnapshotTestHeaders(db).LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+	require.NoError(t, err)
+	require.False(t, loaded)
+}
+
+func TestValidateSnapshot(t *testing.T) {
+	blockHeaders := testChain(5)
+	require.NoError(t, validateSnapshot(&chaincfg.TestNet3Params, 0, blockHeaders))
+	require.Error(t, validateSnapshot(&chaincfg.TestNet3Params, 0, nil))
+	require.Error(t, validateSnapshot(&chaincfg.TestNet3Params, 0, blockHeaders[1:]))
+	require.Error(t, validateSnapshot(&chaincfg.TestNet3Params, 0,
+		[]*wire.BlockHeader{blockHeaders[0], blockHeaders[2]}))
+	// The difficulty retarget window preceding the header after the tip must be included.
+	require.Error(t, validateSnapshot(&chaincfg.TestNet3Params, 2016, testChain(2016)[1:]))
+	require.Equal(t, 2016, MaxSnapshotStartHeight(&chaincfg.TestNet3Params, 4031))
+	require.Equal(t, 0, MaxSnapshotStartHeight(&chaincfg.TestNet3Params, 4030))
+}
+
+func TestValidateSnapshotWork(t *testing.T) {
+	// Regtest headers are verified from the genesis block on, and are cheap to mine.
+	net := &chaincfg.RegressionNetParams
+	blockHeaders := testChainFrom(net, 5)
+	target := btcdBlockchain.CompactToBig(net.GenesisBlock.Header.Bits)
+	mine := func(blockHeader *wire.BlockHeader, valid bool) {
+		for {
+			hash := blockHeader.BlockHash()
+			if (btcdBlockchain.HashToBig(&hash).Cmp(target) <= 0) == valid {
+				return
+			}
+			blockHeader.Nonce++
+		}
+	}
+	for i := 1; i < len(blockHeaders); i++ {
+		blockHeaders[i].PrevBlock = blockHeaders[i-1].BlockHash()
+		mine(blockHeaders[i], true)
+	}
+	require.NoError(t, validateSnapshot(net, 0, blockHeaders))
+	mine(blockHeaders[4], false)
+	require.Error(t, validateSnapshot(net, 0, blockHeaders))
+
+	// The difficulty is checked on mainnet, the proof of work only after the checkpoint.
+	mainnetHeaders := testChainFrom(&chaincfg.MainNetParams, 5)
+	require.NoError(t, validateSnapshot(&chaincfg.MainNetParams, 0, mainnetHeaders))
+	mainnetHeaders[4].Bits = 0x1c00ffff
+	require.Error(t, validateSnapshot(&chaincfg.MainNetParams, 0, mainnetHeaders))
+
+	// Snapshots reaching the checkpoint must include it.
+	require.Equal(t, 629350, MaxSnapshotStartHeight(&chaincfg.MainNetParams, 700000))
+}
+
+func TestSnapshotBackfill(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.NoError(t, err)
+	trusted := TrustedSigners([][]byte{key.PubKey().SerializeCompressed()})
+	chain := testChain(4032)
+	const startHeight = 2016
+	var snapshot bytes.Buffer
+	require.NoError(t, WriteSnapshot(&snapshot, net, startHeight, chain[startHeight:], key))
+
+	// A fork synced before the snapshot was loaded, which does not connect to it.
+	fork := append([]*wire.BlockHeader{}, chain[:startHeight]...)
+	for i := 2000; i < startHeight; i++ {
+		forkHeader := *chain[i]
+		forkHeader.PrevBlock = fork[i-1].BlockHash()
+		forkHeader.Timestamp = forkHeader.Timestamp.Add(time.Second)
+		fork[i] = &forkHeader
+	}
+
+	for _, test := range []struct {
+		name      string
+		dbHeaders []*wire.BlockHeader
+		// fetchedFrom is the lowest height expected to be downloaded.
+		fetchedFrom int
+	}{
+		{name: "empty", dbHeaders: nil, fetchedFrom: 0},
+		{name: "fork", dbHeaders: fork, fetchedFrom: 2000 - 500 + 16},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			db := map[int]*wire.BlockHeader{}
+			for height, blockHeader := range test.dbHeaders {
+				db[height] = blockHeader
+			}
+			fetchedFrom := startHeight
+			blockchain := &mocks.BlockchainMock{
+				MockHeaders: func(startHeight int, count int, success func([]*wire.BlockHeader, int)) {
+					if startHeight < fetchedFrom {
+						fetchedFrom = startHeight
+					}
+					go success(chain[startHeight:startHeight+count], count)
+				},
+			}
+			headers := newSnapshotTestHeadersWithBlockchain(net, db, blockchain)
+			headers.headersPerBatch = 500
+			loaded, err := headers.LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+			require.NoError(t, err)
+			require.True(t, loaded)
+			// Pretend that the headers are synced up to the checkpoint.
+			tip := headers.db.(*dbMock).tip
+			headers.db.(*dbMock).tip = func() (int, error) {
+				if _, err := tip(); err != nil {
+					return 0, err
+				}
+				return int(checkpoint(net).Height), nil
+			}
+
+			// The headers below the snapshot are not verified yet.
+			header, err := headers.VerifiedHeaderByHeight(1500)
+			require.NoError(t, err)
+			require.Nil(t, header)
+			header, err = headers.VerifiedHeaderByHeight(3000)
+			require.NoError(t, err)
+			require.Equal(t, chain[3000].BlockHash(), header.BlockHash())
+
+			for {
+				more, err := headers.backfill(headers.db)
+				require.NoError(t, err)
+				if !more {
+					break
+				}
+			}
+			require.Equal(t, test.fetchedFrom, fetchedFrom)
+			require.Equal(t, 0, headers.backfillHeight)
+
+			// A transaction below the snapshot can be verified.
+			for _, height := range []int{0, 1500, 2005, startHeight - 1} {
+				header, err := headers.VerifiedHeaderByHeight(height)
+				require.NoError(t, err)
+				require.Equal(t, chain[height].BlockHash(), header.BlockHash())
+			}
+
+			// Loading the snapshot again does not mark the verified headers as unverified.
+			headers.backfillHeight = 0
+			loaded, err = headers.LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+			require.NoError(t, err)
+			require.False(t, loaded)
+			more, err := headers.backfill(headers.db)
+			require.NoError(t, err)
+			require.False(t, more)
+			require.Equal(t, 0, headers.backfillHeight)
+		})
+	}
+
+	// Headers which do not connect to the snapshot are rejected.
+	db := map[int]*wire.BlockHeader{}
+	headers := newSnapshotTestHeadersWithBlockchain(net, db, &mocks.BlockchainMock{
+		MockHeaders: func(startHeight int, count int, success func([]*wire.BlockHeader, int)) {
+			go success(fork[startHeight:startHeight+count], count)
+		},
+	})
+	headers.headersPerBatch = 500
+	_, err = headers.LoadSnapshot(bytes.NewReader(snapshot.Bytes()), trusted)
+	require.NoError(t, err)
+	_, err = headers.backfill(headers.db)
+	require.Error(t, err)
+	require.Equal(t, startHeight, headers.backfillHeight)
+	header, err := headers.VerifiedHeaderByHeight(1500)
+	require.NoError(t, err)
+	require.Nil(t, header)
+}
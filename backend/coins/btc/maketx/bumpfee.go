@@ -0,0 +1,174 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/txsort"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+// SignalsRBF returns true if the transaction signals replaceability (BIP-125), i.e. if one of its
+// inputs has a sequence number below 0xfffffffe.
+func SignalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTxBumpFee creates a replacement for the transaction tx paying the fee rate feePerKb
+// (BIP-125 replace-by-fee). All inputs and all outputs except for the change output of the original
+// transaction are kept. The fee increase is deducted from the change output. If that is not
+// enough, more inputs are added from spendableOutputs, which must contain only confirmed outputs,
+// as a replacement can't add new unconfirmed inputs.
+//
+// previousOutputs contains the outputs spent by tx. changeAddress is the address of the change
+// output of tx, or nil if there is none, in which case newChangeAddress is used if a change output
+// needs to be added. incrementalFeePerKb is the minimum fee rate the fee increase has to pay for the
+// size of the replacement.
+func NewTxBumpFee(
+	coin coinpkg.Coin,
+	tx *wire.MsgTx,
+	previousOutputs map[wire.OutPoint]UTXO,
+	changeAddress *addresses.AccountAddress,
+	spendableOutputs map[wire.OutPoint]UTXO,
+	newChangeAddress *addresses.AccountAddress,
+	feePerKb btcutil.Amount,
+	incrementalFeePerKb btcutil.Amount,
+	log *logrus.Entry,
+) (*TxProposal, error) {
+	if !SupportsRBF(coin) {
+		return nil, errp.Newf("Replace-by-fee is not supported for %s", coin.Code())
+	}
+	if !SignalsRBF(tx) {
+		return nil, errp.New("The transaction does not signal replaceability (BIP-125)")
+	}
+
+	inputs := make([]*wire.TxIn, len(tx.TxIn))
+	inputConfigurations := make([]*signing.Configuration, len(tx.TxIn))
+	inputsSum := btcutil.Amount(0)
+	for i, txIn := range tx.TxIn {
+		utxo, ok := previousOutputs[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, errp.New("There needs to be exactly one output being spent per input!")
+		}
+		outPoint := txIn.PreviousOutPoint
+		inputs[i] = wire.NewTxIn(&outPoint, nil, nil)
+		inputConfigurations[i] = utxo.Configuration
+		inputsSum += btcutil.Amount(utxo.TxOut.Value)
+	}
+	outputs := []*wire.TxOut{}
+	outputsSum := btcutil.Amount(0)
+	recipientsSum := btcutil.Amount(0)
+	for _, txOut := range tx.TxOut {
+		outputsSum += btcutil.Amount(txOut.Value)
+		if changeAddress != nil && bytes.Equal(txOut.PkScript, changeAddress.PubkeyScript()) {
+			continue
+		}
+		outputs = append(outputs, wire.NewTxOut(txOut.Value, txOut.PkScript))
+		recipientsSum += btcutil.Amount(txOut.Value)
+	}
+	if len(outputs) == 0 {
+		return nil, errp.New("The transaction has no outputs besides the change")
+	}
+	payments := append([]*wire.TxOut{}, outputs...)
+	oldFee := inputsSum - outputsSum
+	oldFeePerKb := oldFee * 1000 / btcutil.Amount(mempool.GetTxVirtualSize(btcutil.NewTx(tx)))
+	if feePerKb <= oldFeePerKb {
+		return nil, errp.WithStack(errors.ErrFeeTooLow)
+	}
+	if changeAddress == nil {
+		changeAddress = newChangeAddress
+	}
+	changePKScript := changeAddress.PubkeyScript()
+
+	// Additional inputs are added starting with the largest one.
+	candidates := []wire.OutPoint{}
+	for outPoint := range spendableOutputs {
+		if _, ok := previousOutputs[outPoint]; !ok {
+			candidates = append(candidates, outPoint)
+		}
+	}
+	sort.Sort(sort.Reverse(&byValue{candidates, spendableOutputs}))
+
+	outputPkScriptSizes := []int{len(changePKScript)}
+	for _, output := range outputs {
+		outputPkScriptSizes = append(outputPkScriptSizes, len(output.PkScript))
+	}
+	for {
+		txSize := estimateTxSizeOutputs(inputConfigurations, outputPkScriptSizes)
+		requiredFee := feeForSerializeSize(feePerKb, txSize, log)
+		// BIP-125 rule 4: the replacement must pay for its own bandwidth.
+		if minFee := oldFee + feeForSerializeSize(incrementalFeePerKb, txSize, log); requiredFee < minFee {
+			requiredFee = minFee
+		}
+		if inputsSum-recipientsSum < requiredFee {
+			if len(candidates) == 0 {
+				return nil, errp.WithStack(errors.ErrInsufficientFunds)
+			}
+			outPoint := candidates[0]
+			candidates = candidates[1:]
+			inputs = append(inputs, wire.NewTxIn(&outPoint, nil, nil))
+			inputConfigurations = append(inputConfigurations, spendableOutputs[outPoint].Configuration)
+			inputsSum += btcutil.Amount(spendableOutputs[outPoint].TxOut.Value)
+			continue
+		}
+
+		changeAmount := inputsSum - recipientsSum - requiredFee
+		changeIsDust := isDustAmount(
+			changeAmount, len(changePKScript), changeAddress.Configuration, feePerKb)
+		finalFee := requiredFee
+		if changeIsDust {
+			log.Info("change is dust")
+			finalFee = inputsSum - recipientsSum
+		}
+		if changeAmount != 0 && !changeIsDust {
+			outputs = append(outputs, wire.NewTxOut(int64(changeAmount), changePKScript))
+		} else {
+			changeAddress = nil
+		}
+		unsignedTransaction := &wire.MsgTx{
+			Version:  tx.Version,
+			TxIn:     inputs,
+			TxOut:    outputs,
+			LockTime: tx.LockTime,
+		}
+		txsort.InPlaceSort(unsignedTransaction)
+		log.WithField("fee", finalFee).WithField("oldFee", oldFee).Debug("Preparing replacement transaction")
+
+		setRBF(coin, unsignedTransaction)
+		return &TxProposal{
+			Coin:          coin,
+			Amount:        recipientsSum,
+			Fee:           finalFee,
+			Transaction:   unsignedTransaction,
+			Outputs:       payments,
+			ChangeAddress: changeAddress,
+		}, nil
+	}
+}
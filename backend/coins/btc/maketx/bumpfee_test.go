@@ -0,0 +1,135 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTxBumpFee(t *testing.T) {
+	log := logging.Get().WithGroup("bumpFeeTest")
+	inputConfiguration, addressChain := addressesTest.NewAddressChain()
+	someAddresses := addressChain.EnsureAddresses()
+	recipientPkScript := someAddresses[1].PubkeyScript()
+	changeAddress := someAddresses[0]
+	newChangeAddress := someAddresses[2]
+
+	utxo := func(index uint32, satoshi int64) (wire.OutPoint, maketx.UTXO) {
+		return wire.OutPoint{Hash: chainhash.HashH([]byte(`some-tx`)), Index: index},
+			maketx.UTXO{
+				TxOut:         wire.NewTxOut(satoshi, someAddresses[3].PubkeyScript()),
+				Configuration: inputConfiguration,
+			}
+	}
+	outPointA, utxoA := utxo(0, 100000)
+	outPointB, utxoB := utxo(1, 200000)
+	outPointC, utxoC := utxo(2, 20000)
+	previousOutputs := map[wire.OutPoint]maketx.UTXO{outPointA: utxoA}
+	spendableOutputs := map[wire.OutPoint]maketx.UTXO{outPointB: utxoB, outPointC: utxoC}
+
+	original, err := maketx.NewTx(tbtc, previousOutputs, []*wire.TxOut{wire.NewTxOut(60000, recipientPkScript)},
+		1000, changeAddress, maketx.LargestFirst{}, log)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(txSizeOneInput), original.Fee)
+	tx := original.Transaction
+
+	bumpFee := func(feePerKb btcutil.Amount) (*maketx.TxProposal, error) {
+		return maketx.NewTxBumpFee(tbtc, tx, previousOutputs, changeAddress,
+			spendableOutputs, newChangeAddress, feePerKb, 1000, log)
+	}
+	checkOutputs := func(txProposal *maketx.TxProposal, expectedChange int64) {
+		require.Equal(t, btcutil.Amount(60000), txProposal.Amount)
+		require.Len(t, txProposal.Transaction.TxOut, 2)
+		for _, txOut := range txProposal.Transaction.TxOut {
+			if txOut.Value == 60000 {
+				require.Equal(t, recipientPkScript, txOut.PkScript)
+			} else {
+				require.Equal(t, changeAddress.PubkeyScript(), txOut.PkScript)
+				require.Equal(t, expectedChange, txOut.Value)
+			}
+		}
+		for _, txIn := range txProposal.Transaction.TxIn {
+			require.Equal(t, wire.MaxTxInSequenceNum-2, txIn.Sequence)
+		}
+	}
+
+	// The fee increase is taken from the change output.
+	txProposal, err := bumpFee(5000)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5*txSizeOneInput), txProposal.Fee)
+	require.Equal(t, changeAddress, txProposal.ChangeAddress)
+	require.Len(t, txProposal.Transaction.TxIn, 1)
+	require.Equal(t, outPointA, txProposal.Transaction.TxIn[0].PreviousOutPoint)
+	checkOutputs(txProposal, 100000-60000-5*txSizeOneInput)
+
+	// The change does not suffice, the largest additional coin is added.
+	txProposal, err = bumpFee(200000)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(200*txSizeTwoInputs), txProposal.Fee)
+	require.Len(t, txProposal.Transaction.TxIn, 2)
+	inputs := map[wire.OutPoint]bool{}
+	for _, txIn := range txProposal.Transaction.TxIn {
+		inputs[txIn.PreviousOutPoint] = true
+	}
+	require.Equal(t, map[wire.OutPoint]bool{outPointA: true, outPointB: true}, inputs)
+	checkOutputs(txProposal, 300000-60000-200*txSizeTwoInputs)
+
+	// The fee rate must increase.
+	_, err = bumpFee(1000)
+	require.Equal(t, errors.ErrFeeTooLow, errp.Cause(err))
+
+	_, err = bumpFee(100000000)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+
+	// The fee increase must pay at least the incremental relay fee for the replacement.
+	txProposal, err = maketx.NewTxBumpFee(tbtc, tx, previousOutputs, changeAddress,
+		spendableOutputs, newChangeAddress, 2000, 5000, log)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(txSizeOneInput+5*txSizeOneInput), txProposal.Fee)
+
+	// Without a change output, one is added if more coins are needed.
+	noChange, err := maketx.NewTxSpendAll(tbtc, previousOutputs, nil, recipientPkScript, 1000, log)
+	require.NoError(t, err)
+	txProposal, err = maketx.NewTxBumpFee(tbtc, noChange.Transaction, previousOutputs, nil,
+		spendableOutputs, newChangeAddress, 5000, 1000, log)
+	require.NoError(t, err)
+	require.Len(t, txProposal.Transaction.TxIn, 2)
+	require.Equal(t, newChangeAddress, txProposal.ChangeAddress)
+	require.Equal(t, noChange.Amount, txProposal.Amount)
+
+	// Not replaceable.
+	_, err = maketx.NewTxBumpFee(tltc, tx, previousOutputs, changeAddress,
+		spendableOutputs, newChangeAddress, 5000, 1000, log)
+	require.Error(t, err)
+	finalTx := tx.Copy()
+	for _, txIn := range finalTx.TxIn {
+		txIn.Sequence = wire.MaxTxInSequenceNum
+	}
+	require.False(t, maketx.SignalsRBF(finalTx))
+	_, err = maketx.NewTxBumpFee(tbtc, finalTx, previousOutputs, changeAddress,
+		spendableOutputs, newChangeAddress, 5000, 1000, log)
+	require.Error(t, err)
+	require.True(t, maketx.SignalsRBF(tx))
+}
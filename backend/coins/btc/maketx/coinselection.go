@@ -0,0 +1,306 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// CoinSelection is a strategy to select the coins spent in a new transaction.
+type CoinSelection interface {
+	// Select returns outpoints whose values sum up to at least minAmount, and the sum.
+	// errors.ErrInsufficientFunds is returned if the coins do not suffice.
+	Select(minAmount btcutil.Amount, outputs map[wire.OutPoint]UTXO) (
+		btcutil.Amount, []wire.OutPoint, error)
+}
+
+// ChangelessParams contains what is needed to select coins for a transaction without change output.
+type ChangelessParams struct {
+	// Amount is the amount to be sent, excluding the fee.
+	Amount btcutil.Amount
+	// InputFee returns the fee it costs to spend the coin in the transaction.
+	InputFee func(UTXO) btcutil.Amount
+	// Fee returns the fee of the transaction spending the given coins without a change output.
+	Fee func([]wire.OutPoint) btcutil.Amount
+	// CostOfChange is the fee it costs to add a change output. The selected coins may exceed the
+	// amount and fee by at most this much, the excess being added to the fee.
+	CostOfChange btcutil.Amount
+}
+
+// ChangelessCoinSelection is a CoinSelection which can also look for coins covering the amount and
+// fee closely enough to not need a change output.
+type ChangelessCoinSelection interface {
+	CoinSelection
+	// SelectChangeless returns the selected outpoints and the sum of their values, or nil if there
+	// is no suitable selection.
+	SelectChangeless(params *ChangelessParams, outputs map[wire.OutPoint]UTXO) (
+		btcutil.Amount, []wire.OutPoint)
+}
+
+// NewCoinSelection returns the coin selection implementing the given strategy.
+func NewCoinSelection(strategy accounts.CoinSelectionStrategy) (CoinSelection, error) {
+	switch strategy {
+	case "", accounts.CoinSelectionStrategyLargestFirst:
+		return LargestFirst{}, nil
+	case accounts.CoinSelectionStrategyBranchAndBound:
+		return BranchAndBound{}, nil
+	case accounts.CoinSelectionStrategyKnapsack:
+		return Knapsack{}, nil
+	case accounts.CoinSelectionStrategyOldestFirst:
+		return OldestFirst{}, nil
+	default:
+		return nil, errp.Newf("Unrecognized coin selection strategy %s", strategy)
+	}
+}
+
+func outPointsOf(outputs map[wire.OutPoint]UTXO) []wire.OutPoint {
+	outPoints := make([]wire.OutPoint, 0, len(outputs))
+	for outPoint := range outputs {
+		outPoints = append(outPoints, outPoint)
+	}
+	return outPoints
+}
+
+// selectInOrder selects the outpoints in the given order until minAmount is reached.
+func selectInOrder(
+	minAmount btcutil.Amount,
+	outPoints []wire.OutPoint,
+	outputs map[wire.OutPoint]UTXO,
+) (btcutil.Amount, []wire.OutPoint, error) {
+	selectedOutPoints := []wire.OutPoint{}
+	outputsSum := btcutil.Amount(0)
+
+	for _, outPoint := range outPoints {
+		if outputsSum >= minAmount {
+			break
+		}
+		selectedOutPoints = append(selectedOutPoints, outPoint)
+		outputsSum += btcutil.Amount(outputs[outPoint].TxOut.Value)
+	}
+	if outputsSum < minAmount {
+		return 0, nil, errp.WithStack(errors.ErrInsufficientFunds)
+	}
+	return outputsSum, selectedOutPoints, nil
+}
+
+// LargestFirst selects the largest coins first, resulting in few inputs.
+type LargestFirst struct{}
+
+// Select implements CoinSelection.
+func (LargestFirst) Select(minAmount btcutil.Amount, outputs map[wire.OutPoint]UTXO) (
+	btcutil.Amount, []wire.OutPoint, error) {
+	outPoints := outPointsOf(outputs)
+	sort.Sort(sort.Reverse(&byValue{outPoints, outputs}))
+	return selectInOrder(minAmount, outPoints, outputs)
+}
+
+// OldestFirst selects the coins with the most confirmations first, unconfirmed coins last. Coins
+// of the same age are selected largest first.
+type OldestFirst struct{}
+
+// Select implements CoinSelection.
+func (OldestFirst) Select(minAmount btcutil.Amount, outputs map[wire.OutPoint]UTXO) (
+	btcutil.Amount, []wire.OutPoint, error) {
+	outPoints := outPointsOf(outputs)
+	sort.Sort(sort.Reverse(&byValue{outPoints, outputs}))
+	sort.SliceStable(outPoints, func(i, j int) bool {
+		heightI, heightJ := outputs[outPoints[i]].Height, outputs[outPoints[j]].Height
+		if heightI == 0 || heightJ == 0 {
+			return heightJ == 0 && heightI != 0
+		}
+		return heightI < heightJ
+	})
+	return selectInOrder(minAmount, outPoints, outputs)
+}
+
+// knapsackIterations is the number of random subsets tried by the knapsack coin selection.
+const knapsackIterations = 1000
+
+// Knapsack selects the set of coins whose sum is closest to the needed amount, like the knapsack
+// solver of Bitcoin Core. It uses a pseudo random number generator seeded by the amount, so the
+// result is deterministic.
+type Knapsack struct{}
+
+// Select implements CoinSelection.
+func (Knapsack) Select(minAmount btcutil.Amount, outputs map[wire.OutPoint]UTXO) (
+	btcutil.Amount, []wire.OutPoint, error) {
+	target := minAmount
+	value := func(outPoint wire.OutPoint) btcutil.Amount {
+		return btcutil.Amount(outputs[outPoint].TxOut.Value)
+	}
+	outPoints := outPointsOf(outputs)
+	sort.Sort(&byValue{outPoints, outputs})
+
+	var lowestLarger *wire.OutPoint
+	smaller := []wire.OutPoint{}
+	smallerSum := btcutil.Amount(0)
+	for i, outPoint := range outPoints {
+		switch {
+		case value(outPoint) == target:
+			return target, []wire.OutPoint{outPoint}, nil
+		case value(outPoint) < target:
+			smaller = append(smaller, outPoint)
+			smallerSum += value(outPoint)
+		case lowestLarger == nil:
+			lowestLarger = &outPoints[i]
+		}
+	}
+	if smallerSum == target {
+		return smallerSum, smaller, nil
+	}
+	if smallerSum < target {
+		if lowestLarger == nil {
+			return 0, nil, errp.WithStack(errors.ErrInsufficientFunds)
+		}
+		return value(*lowestLarger), []wire.OutPoint{*lowestLarger}, nil
+	}
+
+	// Find the subset of the smaller coins with the lowest sum reaching the target by trying
+	// random subsets, largest coins first.
+	sort.Sort(sort.Reverse(&byValue{smaller, outputs}))
+	random := rand.New(rand.NewSource(int64(target)))
+	best := make([]bool, len(smaller))
+	for i := range best {
+		best[i] = true
+	}
+	bestSum := smallerSum
+	included := make([]bool, len(smaller))
+	for iteration := 0; iteration < knapsackIterations && bestSum != target; iteration++ {
+		for i := range included {
+			included[i] = false
+		}
+		sum := btcutil.Amount(0)
+		reachedTarget := false
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i, outPoint := range smaller {
+				// The first pass includes coins randomly, the second pass all remaining ones.
+				include := !included[i]
+				if pass == 0 {
+					include = random.Intn(2) == 1
+				}
+				if !include {
+					continue
+				}
+				sum += value(outPoint)
+				included[i] = true
+				if sum >= target {
+					reachedTarget = true
+					if sum < bestSum {
+						bestSum = sum
+						copy(best, included)
+					}
+					sum -= value(outPoint)
+					included[i] = false
+				}
+			}
+		}
+	}
+	if lowestLarger != nil && bestSum != target && value(*lowestLarger) <= bestSum {
+		return value(*lowestLarger), []wire.OutPoint{*lowestLarger}, nil
+	}
+	selected := []wire.OutPoint{}
+	for i, outPoint := range smaller {
+		if best[i] {
+			selected = append(selected, outPoint)
+		}
+	}
+	return bestSum, selected, nil
+}
+
+// branchAndBoundMaxTries limits the number of combinations explored by BranchAndBound.
+const branchAndBoundMaxTries = 100000
+
+// BranchAndBound searches for a set of coins covering the amount and the fee without the need for
+// a change output, which saves fees and does not reveal which output is the change. The search is a
+// depth-first search over the coins sorted by effective value (value minus the fee to spend it), as
+// in Bitcoin Core. If no such set is found, Knapsack is used.
+type BranchAndBound struct{}
+
+// Select implements CoinSelection. It is used if SelectChangeless does not find a selection.
+func (BranchAndBound) Select(minAmount btcutil.Amount, outputs map[wire.OutPoint]UTXO) (
+	btcutil.Amount, []wire.OutPoint, error) {
+	return Knapsack{}.Select(minAmount, outputs)
+}
+
+// SelectChangeless implements ChangelessCoinSelection. Of the selections found, the one with the
+// least excess is returned.
+func (BranchAndBound) SelectChangeless(params *ChangelessParams, outputs map[wire.OutPoint]UTXO) (
+	btcutil.Amount, []wire.OutPoint) {
+	candidates := []wire.OutPoint{}
+	effectiveValues := map[wire.OutPoint]btcutil.Amount{}
+	for outPoint, output := range outputs {
+		effectiveValue := btcutil.Amount(output.TxOut.Value) - params.InputFee(output)
+		if effectiveValue > 0 {
+			candidates = append(candidates, outPoint)
+			effectiveValues[outPoint] = effectiveValue
+		}
+	}
+	sort.Sort(sort.Reverse(&byValue{candidates, outputs}))
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return effectiveValues[candidates[i]] > effectiveValues[candidates[j]]
+	})
+	// remaining[i] is the sum of the effective values of candidates[i:].
+	remaining := make([]btcutil.Amount, len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effectiveValues[candidates[i]]
+	}
+
+	target := params.Amount + params.Fee(nil)
+	upperBound := target + params.CostOfChange
+	var best []wire.OutPoint
+	var bestSum btcutil.Amount
+	bestExcess := btcutil.Amount(-1)
+	tries := 0
+	selected := []wire.OutPoint{}
+
+	var search func(index int, effectiveSum btcutil.Amount, sum btcutil.Amount)
+	search = func(index int, effectiveSum btcutil.Amount, sum btcutil.Amount) {
+		tries++
+		if tries > branchAndBoundMaxTries || bestExcess == 0 ||
+			effectiveSum > upperBound || effectiveSum+remaining[index] < target {
+			return
+		}
+		if effectiveSum >= target {
+			// The effective values are an estimate, the fee is checked for the actual selection.
+			excess := sum - params.Amount - params.Fee(selected)
+			if excess >= 0 && excess <= params.CostOfChange && (bestExcess < 0 || excess < bestExcess) {
+				best = append([]wire.OutPoint{}, selected...)
+				bestSum = sum
+				bestExcess = excess
+			}
+			// Adding more coins only increases the excess.
+			return
+		}
+		if index == len(candidates) {
+			return
+		}
+		outPoint := candidates[index]
+		selected = append(selected, outPoint)
+		search(index+1,
+			effectiveSum+effectiveValues[outPoint],
+			sum+btcutil.Amount(outputs[outPoint].TxOut.Value))
+		selected = selected[:len(selected)-1]
+		search(index+1, effectiveSum, sum)
+	}
+	search(0, 0, 0)
+	return bestSum, best
+}
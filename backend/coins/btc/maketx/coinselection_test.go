@@ -0,0 +1,223 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+type testCoin struct {
+	satoshi int64
+	height  int
+}
+
+// buildCoins builds an utxo set from the given coins. The outpoint index of a coin is its index in
+// the arguments.
+func buildCoins(coins ...testCoin) map[wire.OutPoint]maketx.UTXO {
+	configuration, addressChain := addressesTest.NewAddressChain()
+	pkScript := addressChain.EnsureAddresses()[0].PubkeyScript()
+	utxos := map[wire.OutPoint]maketx.UTXO{}
+	for i, coin := range coins {
+		utxos[wire.OutPoint{Hash: chainhash.HashH([]byte(`coins`)), Index: uint32(i)}] = maketx.UTXO{
+			TxOut:         wire.NewTxOut(coin.satoshi, pkScript),
+			Configuration: configuration,
+			Height:        coin.height,
+		}
+	}
+	return utxos
+}
+
+// indices returns the outpoint indices of the selected coins.
+func indices(outPoints []wire.OutPoint) []uint32 {
+	result := make([]uint32, len(outPoints))
+	for i, outPoint := range outPoints {
+		result[i] = outPoint.Index
+	}
+	return result
+}
+
+func TestNewCoinSelection(t *testing.T) {
+	for strategy, expected := range map[accounts.CoinSelectionStrategy]maketx.CoinSelection{
+		"": maketx.LargestFirst{},
+		accounts.CoinSelectionStrategyLargestFirst:   maketx.LargestFirst{},
+		accounts.CoinSelectionStrategyBranchAndBound: maketx.BranchAndBound{},
+		accounts.CoinSelectionStrategyKnapsack:       maketx.Knapsack{},
+		accounts.CoinSelectionStrategyOldestFirst:    maketx.OldestFirst{},
+	} {
+		coinSelection, err := maketx.NewCoinSelection(strategy)
+		require.NoError(t, err)
+		require.Equal(t, expected, coinSelection)
+	}
+	_, err := maketx.NewCoinSelection("unknown")
+	require.Error(t, err)
+}
+
+func TestLargestFirst(t *testing.T) {
+	utxos := buildCoins(testCoin{1000, 1}, testCoin{5000, 2}, testCoin{3000, 3}, testCoin{10000, 4})
+	sum, selected, err := maketx.LargestFirst{}.Select(12000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(15000), sum)
+	require.Equal(t, []uint32{3, 1}, indices(selected))
+
+	_, _, err = maketx.LargestFirst{}.Select(19001, utxos)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+}
+
+func TestOldestFirst(t *testing.T) {
+	utxos := buildCoins(
+		testCoin{1000, 5},
+		testCoin{5000, 0},
+		testCoin{3000, 2},
+		testCoin{10000, 9},
+		testCoin{2000, 5},
+	)
+	sum, selected, err := maketx.OldestFirst{}.Select(4000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5000), sum)
+	// Coins of the same height are selected largest first.
+	require.Equal(t, []uint32{2, 4}, indices(selected))
+
+	// Unconfirmed coins are selected last.
+	sum, selected, err = maketx.OldestFirst{}.Select(17000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(21000), sum)
+	require.Equal(t, []uint32{2, 4, 0, 3, 1}, indices(selected))
+
+	_, _, err = maketx.OldestFirst{}.Select(21001, utxos)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+}
+
+func TestKnapsack(t *testing.T) {
+	utxos := buildCoins(testCoin{1000, 1}, testCoin{2000, 1}, testCoin{3000, 1}, testCoin{50000, 1})
+	knapsack := maketx.Knapsack{}
+
+	// A single coin matching exactly.
+	sum, selected, err := knapsack.Select(3000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(3000), sum)
+	require.Equal(t, []uint32{2}, indices(selected))
+
+	// The smaller coins combined match exactly.
+	sum, selected, err = knapsack.Select(6000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(6000), sum)
+	require.ElementsMatch(t, []uint32{0, 1, 2}, indices(selected))
+
+	// A subset of the smaller coins matches exactly, the large coin is not used.
+	sum, selected, err = knapsack.Select(5000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5000), sum)
+	require.ElementsMatch(t, []uint32{1, 2}, indices(selected))
+
+	// The closest subset of the smaller coins.
+	sum, selected, err = knapsack.Select(4500, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5000), sum)
+	require.ElementsMatch(t, []uint32{1, 2}, indices(selected))
+
+	// The smaller coins do not suffice, the smallest larger coin is used.
+	sum, selected, err = knapsack.Select(7000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(50000), sum)
+	require.Equal(t, []uint32{3}, indices(selected))
+
+	// The smallest larger coin is closer than any combination of smaller coins.
+	utxos = buildCoins(testCoin{4000, 1}, testCoin{4000, 1}, testCoin{5500, 1})
+	sum, selected, err = knapsack.Select(5000, utxos)
+	require.NoError(t, err)
+	require.Equal(t, btcutil.Amount(5500), sum)
+	require.Equal(t, []uint32{2}, indices(selected))
+
+	_, _, err = knapsack.Select(13501, utxos)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+}
+
+func TestBranchAndBound(t *testing.T) {
+	utxos := buildCoins(testCoin{1000, 1}, testCoin{2000, 1}, testCoin{3000, 1}, testCoin{5000, 1})
+	params := func(amount btcutil.Amount) *maketx.ChangelessParams {
+		return &maketx.ChangelessParams{
+			Amount:       amount,
+			InputFee:     func(maketx.UTXO) btcutil.Amount { return 10 },
+			Fee:          func(outPoints []wire.OutPoint) btcutil.Amount { return 100 + 10*btcutil.Amount(len(outPoints)) },
+			CostOfChange: 50,
+		}
+	}
+	bnb := maketx.BranchAndBound{}
+
+	// 1000 + 3000 covers the amount and the fee for two inputs exactly.
+	sum, selected := bnb.SelectChangeless(params(3880), utxos)
+	require.Equal(t, btcutil.Amount(4000), sum)
+	require.ElementsMatch(t, []uint32{0, 2}, indices(selected))
+
+	// The selection with the least excess is chosen: 2000 + 3000 exceeds by 30, 5000 by 40.
+	sum, selected = bnb.SelectChangeless(params(4850), utxos)
+	require.Equal(t, btcutil.Amount(5000), sum)
+	require.ElementsMatch(t, []uint32{1, 2}, indices(selected))
+
+	// No selection within the cost of change.
+	_, selected = bnb.SelectChangeless(params(9700), utxos)
+	require.Nil(t, selected)
+}
+
+func TestNewTxBranchAndBound(t *testing.T) {
+	log := logging.Get().WithGroup("coinSelectionTest")
+	_, addressChain := addressesTest.NewAddressChain()
+	someAddresses := addressChain.EnsureAddresses()
+	recipientPkScript := someAddresses[1].PubkeyScript()
+	changeAddress := someAddresses[0]
+
+	// At 1 sat/vB, the fee of a tx spending one coin without change equals its size.
+	changelessFee := func() btcutil.Amount {
+		spendAll, err := maketx.NewTxSpendAll(tbtc, buildCoins(testCoin{100000, 1}), nil, recipientPkScript, 1000, log)
+		require.NoError(t, err)
+		return spendAll.Fee
+	}()
+	utxos := buildCoins(testCoin{100000, 1}, testCoin{50000 + int64(changelessFee), 1})
+
+	txProposal, err := maketx.NewTx(tbtc, utxos, []*wire.TxOut{wire.NewTxOut(50000, recipientPkScript)}, 1000,
+		changeAddress, maketx.BranchAndBound{}, log)
+	require.NoError(t, err)
+	require.Equal(t, changelessFee, txProposal.Fee)
+	require.Nil(t, txProposal.ChangeAddress)
+	require.Len(t, txProposal.Transaction.TxOut, 1)
+	require.Equal(t, []uint32{1}, indices([]wire.OutPoint{txProposal.Transaction.TxIn[0].PreviousOutPoint}))
+
+	// The largest coin is spent with largest first, creating change.
+	txProposal, err = maketx.NewTx(tbtc, utxos, []*wire.TxOut{wire.NewTxOut(50000, recipientPkScript)}, 1000,
+		changeAddress, maketx.LargestFirst{}, log)
+	require.NoError(t, err)
+	require.Len(t, txProposal.Transaction.TxOut, 2)
+	require.Equal(t, uint32(0), txProposal.Transaction.TxIn[0].PreviousOutPoint.Index)
+
+	// No changeless selection, knapsack picks the smallest coin which suffices.
+	txProposal, err = maketx.NewTx(tbtc, utxos, []*wire.TxOut{wire.NewTxOut(30000, recipientPkScript)}, 1000,
+		changeAddress, maketx.BranchAndBound{}, log)
+	require.NoError(t, err)
+	require.Len(t, txProposal.Transaction.TxOut, 2)
+	require.Len(t, txProposal.Transaction.TxIn, 1)
+	require.Equal(t, uint32(1), txProposal.Transaction.TxIn[0].PreviousOutPoint.Index)
+	require.Equal(t, btcutil.Amount(txSizeOneInput), txProposal.Fee)
+}
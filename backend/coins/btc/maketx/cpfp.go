@@ -0,0 +1,94 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx
+
+import (
+	"sort"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/txsort"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+// NewTxCPFP creates a child transaction accelerating an unconfirmed parent transaction
+// (child-pays-for-parent). The child spends parentOutputs, our outputs of the parent, to
+// changeAddress. Its fee is chosen so that parent and child together pay the fee rate feePerKb.
+//
+// parentVSize is the virtual size of the parent and parentFeePerKb the fee rate the parent pays.
+func NewTxCPFP(
+	coin coinpkg.Coin,
+	parentOutputs map[wire.OutPoint]UTXO,
+	parentVSize int64,
+	parentFeePerKb btcutil.Amount,
+	changeAddress *addresses.AccountAddress,
+	feePerKb btcutil.Amount,
+	log *logrus.Entry,
+) (*TxProposal, error) {
+	if len(parentOutputs) == 0 {
+		return nil, errp.New("The transaction has no outputs that can be spent")
+	}
+	if feePerKb <= parentFeePerKb {
+		return nil, errp.WithStack(errors.ErrFeeTooLow)
+	}
+	outPoints := make([]wire.OutPoint, 0, len(parentOutputs))
+	for outPoint := range parentOutputs {
+		outPoints = append(outPoints, outPoint)
+	}
+	sort.Sort(&byValue{outPoints, parentOutputs})
+	inputs := make([]*wire.TxIn, len(outPoints))
+	inputConfigurations := make([]*signing.Configuration, len(outPoints))
+	inputsSum := btcutil.Amount(0)
+	for i, outPoint := range outPoints {
+		outPoint := outPoint
+		inputs[i] = wire.NewTxIn(&outPoint, nil, nil)
+		inputConfigurations[i] = parentOutputs[outPoint].Configuration
+		inputsSum += btcutil.Amount(parentOutputs[outPoint].TxOut.Value)
+	}
+	changePKScript := changeAddress.PubkeyScript()
+	childSize := estimateTxSizeOutputs(inputConfigurations, []int{len(changePKScript)})
+
+	// The fee of the package is shared by parent and child, the parent covering its part at its own
+	// fee rate.
+	parentFee := parentFeePerKb * btcutil.Amount(parentVSize) / 1000
+	packageFee := feeForSerializeSize(feePerKb, int(parentVSize)+childSize, log)
+	fee := packageFee - parentFee
+	outputAmount := inputsSum - fee
+	if outputAmount <= 0 || isDustAmount(
+		outputAmount, len(changePKScript), changeAddress.Configuration, feePerKb) {
+		return nil, errp.WithStack(errors.ErrInsufficientFunds)
+	}
+	unsignedTransaction := &wire.MsgTx{
+		Version:  wire.TxVersion,
+		TxIn:     inputs,
+		TxOut:    []*wire.TxOut{wire.NewTxOut(int64(outputAmount), changePKScript)},
+		LockTime: 0,
+	}
+	txsort.InPlaceSort(unsignedTransaction)
+	log.WithField("fee", fee).WithField("parentFee", parentFee).Debug("Preparing CPFP transaction")
+	setRBF(coin, unsignedTransaction)
+	return &TxProposal{
+		Coin:          coin,
+		Amount:        outputAmount,
+		Fee:           fee,
+		Transaction:   unsignedTransaction,
+		ChangeAddress: changeAddress,
+	}, nil
+}
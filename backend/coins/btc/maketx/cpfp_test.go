@@ -0,0 +1,74 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maketx_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTxCPFP(t *testing.T) {
+	log := logging.Get().WithGroup("cpfpTest")
+	inputConfiguration, addressChain := addressesTest.NewAddressChain()
+	someAddresses := addressChain.EnsureAddresses()
+	changeAddress := someAddresses[0]
+
+	parentOutPoint := wire.OutPoint{Hash: chainhash.HashH([]byte(`parent-tx`)), Index: 1}
+	parentOutputs := map[wire.OutPoint]maketx.UTXO{
+		parentOutPoint: {
+			TxOut:         wire.NewTxOut(50000, someAddresses[1].PubkeyScript()),
+			Configuration: inputConfiguration,
+		},
+	}
+	// At 1 sat/vB, the fee of a tx spending all coins equals the size of the child.
+	spendAll, err := maketx.NewTxSpendAll(tbtc, parentOutputs, nil, changeAddress.PubkeyScript(), 1000, log)
+	require.NoError(t, err)
+	childSize := int64(spendAll.Fee)
+
+	const parentVSize = 200
+	// The parent pays 1 sat/vB, the package needs to pay 10 sat/vB.
+	txProposal, err := maketx.NewTxCPFP(tbtc, parentOutputs, parentVSize, 1000, changeAddress, 10000, log)
+	require.NoError(t, err)
+	expectedFee := btcutil.Amount(10*(parentVSize+childSize) - parentVSize)
+	require.Equal(t, expectedFee, txProposal.Fee)
+	require.Equal(t, 50000-expectedFee, txProposal.Amount)
+	require.Equal(t, changeAddress, txProposal.ChangeAddress)
+	tx := txProposal.Transaction
+	require.Len(t, tx.TxIn, 1)
+	require.Equal(t, parentOutPoint, tx.TxIn[0].PreviousOutPoint)
+	require.Len(t, tx.TxOut, 1)
+	require.Equal(t, changeAddress.PubkeyScript(), tx.TxOut[0].PkScript)
+	require.Equal(t, int64(50000-expectedFee), tx.TxOut[0].Value)
+
+	// The package fee rate must be higher than the one of the parent.
+	_, err = maketx.NewTxCPFP(tbtc, parentOutputs, parentVSize, 10000, changeAddress, 10000, log)
+	require.Equal(t, errors.ErrFeeTooLow, errp.Cause(err))
+
+	// The output can't pay for the package.
+	_, err = maketx.NewTxCPFP(tbtc, parentOutputs, parentVSize, 1000, changeAddress, 200000, log)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+
+	_, err = maketx.NewTxCPFP(tbtc, nil, parentVSize, 1000, changeAddress, 10000, log)
+	require.Error(t, err)
+}
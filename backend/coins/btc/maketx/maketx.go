@@ -15,8 +15,6 @@
 package maketx
 
 import (
-	"sort"
-
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -38,6 +36,10 @@ type TxProposal struct {
 	// Fee is the mining fee used.
 	Fee         btcutil.Amount
 	Transaction *wire.MsgTx
+	// Outputs are the payment outputs of the transaction (all outputs except for the change), in
+	// the order in which they were requested, with the output receiving the remaining funds last in
+	// case of NewTxSpendAll(). They are also contained in Transaction.TxOut.
+	Outputs []*wire.TxOut
 	// ChangeAddress is the address of the wallet to which the change of the transaction is sent.
 	ChangeAddress *addresses.AccountAddress
 }
@@ -51,6 +53,8 @@ func (txProposal *TxProposal) Total() btcutil.Amount {
 type UTXO struct {
 	TxOut         *wire.TxOut
 	Configuration *signing.Configuration
+	// Height is the height of the block containing the output, or 0 if it is unconfirmed.
+	Height int
 }
 
 type byValue struct {
@@ -62,37 +66,17 @@ func (p *byValue) Len() int { return len(p.outPoints) }
 func (p *byValue) Less(i, j int) bool {
 	if p.outputs[p.outPoints[i]].TxOut.Value == p.outputs[p.outPoints[j]].TxOut.Value {
 		// Secondary sort to make coin selection deterministic.
-		return chainhash.HashH(p.outputs[p.outPoints[i]].TxOut.PkScript).String() < chainhash.HashH(p.outputs[p.outPoints[j]].TxOut.PkScript).String()
+		hashI := chainhash.HashH(p.outputs[p.outPoints[i]].TxOut.PkScript).String()
+		hashJ := chainhash.HashH(p.outputs[p.outPoints[j]].TxOut.PkScript).String()
+		if hashI == hashJ {
+			return p.outPoints[i].String() < p.outPoints[j].String()
+		}
+		return hashI < hashJ
 	}
 	return p.outputs[p.outPoints[i]].TxOut.Value < p.outputs[p.outPoints[j]].TxOut.Value
 }
 func (p *byValue) Swap(i, j int) { p.outPoints[i], p.outPoints[j] = p.outPoints[j], p.outPoints[i] }
 
-func coinSelection(
-	minAmount btcutil.Amount,
-	outputs map[wire.OutPoint]UTXO,
-) (btcutil.Amount, []wire.OutPoint, error) {
-	outPoints := []wire.OutPoint{}
-	for outPoint := range outputs {
-		outPoints = append(outPoints, outPoint)
-	}
-	sort.Sort(sort.Reverse(&byValue{outPoints, outputs}))
-	selectedOutPoints := []wire.OutPoint{}
-	outputsSum := btcutil.Amount(0)
-
-	for _, outPoint := range outPoints {
-		if outputsSum >= minAmount {
-			break
-		}
-		selectedOutPoints = append(selectedOutPoints, outPoint)
-		outputsSum += btcutil.Amount(outputs[outPoint].TxOut.Value)
-	}
-	if outputsSum < minAmount {
-		return 0, nil, errp.WithStack(errors.ErrInsufficientFunds)
-	}
-	return outputsSum, selectedOutPoints, nil
-}
-
 // toInputConfigurations converts selected inputs to input configurations.
 // Currently, it just repeats one inputConfiguration, as all inputs are of the same type.
 // When mixing input types in a transaction, this function needs to be extended.
@@ -107,12 +91,19 @@ func toInputConfigurations(
 	return inputConfigurations
 }
 
+// SupportsRBF returns true if transactions of the coin can be replaced (BIP-125 replace-by-fee).
+// Litecoin does not have RBF.
+func SupportsRBF(coin coinpkg.Coin) bool {
+	return coin.Code() == coinpkg.CodeBTC ||
+		coin.Code() == coinpkg.CodeTBTC ||
+		coin.Code() == coinpkg.CodeRBTC ||
+		coin.Code() == coinpkg.CodeSBTC
+}
+
 // Enable RBF (Replace-by-fee) for Bitcoin. Litecoin does not have RBF.
 func setRBF(coin coinpkg.Coin, tx *wire.MsgTx) {
 	for _, txIn := range tx.TxIn {
-		if coin.Code() == coinpkg.CodeBTC ||
-			coin.Code() == coinpkg.CodeTBTC ||
-			coin.Code() == coinpkg.CodeRBTC {
+		if SupportsRBF(coin) {
 			// Enable RBF
 			// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki#summary
 			// Locktime is also enabled by this (https://en.bitcoin.it/wiki/NLockTime), but we keep
@@ -122,10 +113,13 @@ func setRBF(coin coinpkg.Coin, tx *wire.MsgTx) {
 	}
 }
 
-// NewTxSpendAll creates a transaction which spends all available unspent outputs.
+// NewTxSpendAll creates a transaction which spends all available unspent outputs. outputs are
+// payments of fixed amounts and can be empty. The remaining value after paying those and the fee is
+// sent to outputPkScript.
 func NewTxSpendAll(
 	coin coinpkg.Coin,
 	spendableOutputs map[wire.OutPoint]UTXO,
+	outputs []*wire.TxOut,
 	outputPkScript []byte,
 	feePerKb btcutil.Amount,
 	log *logrus.Entry,
@@ -139,19 +133,26 @@ func NewTxSpendAll(
 		outputsSum += btcutil.Amount(output.TxOut.Value)
 		inputs = append(inputs, wire.NewTxIn(&outPoint, nil, nil))
 	}
-	txSize := estimateTxSize(
+	fixedAmount := btcutil.Amount(0)
+	outputPkScriptSizes := []int{}
+	for _, output := range outputs {
+		fixedAmount += btcutil.Amount(output.Value)
+		outputPkScriptSizes = append(outputPkScriptSizes, len(output.PkScript))
+	}
+	outputPkScriptSizes = append(outputPkScriptSizes, len(outputPkScript))
+	txSize := estimateTxSizeOutputs(
 		toInputConfigurations(spendableOutputs, selectedOutPoints),
-		len(outputPkScript),
-		0)
+		outputPkScriptSizes)
 	maxRequiredFee := feeForSerializeSize(feePerKb, txSize, log)
-	if outputsSum < maxRequiredFee {
+	if outputsSum < fixedAmount+maxRequiredFee {
 		return nil, errp.WithStack(errors.ErrInsufficientFunds)
 	}
-	output := wire.NewTxOut(int64(outputsSum-maxRequiredFee), outputPkScript)
+	output := wire.NewTxOut(int64(outputsSum-fixedAmount-maxRequiredFee), outputPkScript)
+	allOutputs := append(append([]*wire.TxOut{}, outputs...), output)
 	unsignedTransaction := &wire.MsgTx{
 		Version:  wire.TxVersion,
 		TxIn:     inputs,
-		TxOut:    []*wire.TxOut{output},
+		TxOut:    append([]*wire.TxOut{}, allOutputs...),
 		LockTime: 0,
 	}
 	txsort.InPlaceSort(unsignedTransaction)
@@ -160,47 +161,89 @@ func NewTxSpendAll(
 	setRBF(coin, unsignedTransaction)
 	return &TxProposal{
 		Coin:        coin,
-		Amount:      btcutil.Amount(output.Value),
+		Amount:      outputsSum - maxRequiredFee,
 		Fee:         maxRequiredFee,
 		Transaction: unsignedTransaction,
+		Outputs:     allOutputs,
 	}, nil
 }
 
-// NewTx creates a transaction from a set of unspent outputs, targeting an output value. A subset of
-// the unspent outputs is selected to cover the needed amount.
+// NewTx creates a transaction from a set of unspent outputs, paying the given outputs. A subset of
+// the unspent outputs is selected by coinSelection to cover the needed amount.
 //
 // changeAddress: a change output to this address is added if needed.
 func NewTx(
 	coin coinpkg.Coin,
 	spendableOutputs map[wire.OutPoint]UTXO,
-	output *wire.TxOut,
+	outputs []*wire.TxOut,
 	feePerKb btcutil.Amount,
 	changeAddress *addresses.AccountAddress,
+	coinSelection CoinSelection,
 	log *logrus.Entry,
 ) (*TxProposal, error) {
-	targetAmount := btcutil.Amount(output.Value)
-	if targetAmount <= 0 {
-		panic("amount must be positive")
+	if len(outputs) == 0 {
+		panic("there must be at least one output")
+	}
+	targetAmount := btcutil.Amount(0)
+	outputPkScriptSizes := make([]int, len(outputs))
+	for i, output := range outputs {
+		if output.Value <= 0 {
+			panic("amount must be positive")
+		}
+		targetAmount += btcutil.Amount(output.Value)
+		outputPkScriptSizes[i] = len(output.PkScript)
 	}
-	outputs := []*wire.TxOut{output}
 	changePKScript := changeAddress.PubkeyScript()
+	estimateSize := func(selectedOutPoints []wire.OutPoint, withChange bool) int {
+		pkScriptSizes := outputPkScriptSizes
+		if withChange {
+			pkScriptSizes = append(append([]int{}, outputPkScriptSizes...), len(changePKScript))
+		}
+		return estimateTxSizeOutputs(
+			toInputConfigurations(spendableOutputs, selectedOutPoints), pkScriptSizes)
+	}
 
-	targetFee := btcutil.Amount(0)
-	for {
-		selectedOutputsSum, selectedOutPoints, err := coinSelection(
-			targetAmount+targetFee,
+	// A transaction without change output is preferred if the coin selection supports it.
+	var selectedOutputsSum btcutil.Amount
+	var selectedOutPoints []wire.OutPoint
+	if changelessCoinSelection, ok := coinSelection.(ChangelessCoinSelection); ok {
+		selectedOutputsSum, selectedOutPoints = changelessCoinSelection.SelectChangeless(
+			&ChangelessParams{
+				Amount: targetAmount,
+				InputFee: func(utxo UTXO) btcutil.Amount {
+					inputSize := estimateTxSize([]*signing.Configuration{utxo.Configuration}, 0, 0) -
+						estimateTxSize(nil, 0, 0)
+					return feePerKb * btcutil.Amount(inputSize) / 1000
+				},
+				Fee: func(outPoints []wire.OutPoint) btcutil.Amount {
+					return feeForSerializeSize(feePerKb, estimateSize(outPoints, false), log)
+				},
+				CostOfChange: feePerKb * btcutil.Amount(outputSize(len(changePKScript))) / 1000,
+			},
 			spendableOutputs,
 		)
-		if err != nil {
-			return nil, err
+	}
+	changeless := selectedOutPoints != nil
+
+	targetFee := btcutil.Amount(0)
+	for {
+		if !changeless {
+			var err error
+			selectedOutputsSum, selectedOutPoints, err = coinSelection.Select(
+				targetAmount+targetFee,
+				spendableOutputs,
+			)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		txSize := estimateTxSize(
-			toInputConfigurations(spendableOutputs, selectedOutPoints),
-			len(output.PkScript),
-			len(changePKScript))
-		maxRequiredFee := feeForSerializeSize(feePerKb, txSize, log)
-		if selectedOutputsSum-targetAmount < maxRequiredFee {
+		maxRequiredFee := feeForSerializeSize(feePerKb, estimateSize(selectedOutPoints, true), log)
+		if changeless {
+			// The excess over the amount and fee is at most the cost of a change output and is
+			// added to the fee.
+			maxRequiredFee = selectedOutputsSum - targetAmount
+		} else if selectedOutputsSum-targetAmount < maxRequiredFee {
 			targetFee = maxRequiredFee
 			continue
 		}
@@ -213,7 +256,7 @@ func NewTx(
 		unsignedTransaction := &wire.MsgTx{
 			Version:  wire.TxVersion,
 			TxIn:     inputs,
-			TxOut:    outputs,
+			TxOut:    append([]*wire.TxOut{}, outputs...),
 			LockTime: 0,
 		}
 		changeAmount := selectedOutputsSum - targetAmount - maxRequiredFee
@@ -239,6 +282,7 @@ func NewTx(
 			Amount:        targetAmount,
 			Fee:           finalFee,
 			Transaction:   unsignedTransaction,
+			Outputs:       outputs,
 			ChangeAddress: changeAddress,
 		}, nil
 	}
@@ -100,9 +100,10 @@ func (s *newTxSuite) newTx(
 	return maketx.NewTx(
 		s.coin,
 		utxo,
-		s.output(amount),
+		[]*wire.TxOut{s.output(amount)},
 		feePerKb,
 		s.changeAddress,
+		maketx.LargestFirst{},
 		s.log,
 	)
 }
@@ -307,3 +308,54 @@ func (s *newTxSuite) TestNewTxCoinSelection() {
 	// coins: .5, .3, .1, .1, .9, .8, .6. select .5+.3+.1+.1 to get 1BTC, take .9 to cover the fees.
 	s.check(amount, feePerKb, s.buildUTXO(500*mBTC, 300*mBTC, 100*mBTC, 100*mBTC, 90*mBTC, 80*mBTC, 70*mBTC), s.change(90*mBTC-txSizeFiveInputs), noDust, s.selectCoins(0, 1, 2, 3, 4))
 }
+
+func (s *newTxSuite) TestNewTxMultipleOutputs() {
+	feePerKb := btcutil.Amount(1000) // 1 sat / vbyte
+	// A third output of 34 bytes is added to the size of a tx with one input.
+	const txSize = txSizeOneInput + 34
+	outputs := []*wire.TxOut{
+		s.output(30000),
+		wire.NewTxOut(20000, s.someAddresses[1].PubkeyScript()),
+	}
+	txProposal, err := maketx.NewTx(
+		s.coin, s.buildUTXO(100000), outputs, feePerKb, s.changeAddress, maketx.LargestFirst{}, s.log)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), btcutil.Amount(50000), txProposal.Amount)
+	require.Equal(s.T(), btcutil.Amount(txSize), txProposal.Fee)
+	require.Equal(s.T(), outputs, txProposal.Outputs)
+	require.Equal(s.T(), s.changeAddress, txProposal.ChangeAddress)
+	tx := txProposal.Transaction
+	require.Len(s.T(), tx.TxOut, 3)
+	for _, output := range outputs {
+		require.Contains(s.T(), tx.TxOut, output)
+	}
+	for _, txOut := range tx.TxOut {
+		if bytes.Equal(txOut.PkScript, s.changeAddress.PubkeyScript()) {
+			require.Equal(s.T(), int64(100000-50000-txSize), txOut.Value)
+		}
+	}
+
+	_, err = maketx.NewTx(
+		s.coin, s.buildUTXO(50000+txSize-1), outputs, feePerKb, s.changeAddress, maketx.LargestFirst{}, s.log)
+	require.Equal(s.T(), errors.ErrInsufficientFunds, errp.Cause(err))
+}
+
+func (s *newTxSuite) TestNewTxSpendAllRemainder() {
+	feePerKb := btcutil.Amount(1000) // 1 sat / vbyte
+	fixedOutput := wire.NewTxOut(20000, s.someAddresses[1].PubkeyScript())
+	txProposal, err := maketx.NewTxSpendAll(
+		s.coin, s.buildUTXO(60000, 40000), []*wire.TxOut{fixedOutput}, s.outputPkScript, feePerKb, s.log)
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), btcutil.Amount(txSizeTwoInputs), txProposal.Fee)
+	require.Equal(s.T(), btcutil.Amount(100000-txSizeTwoInputs), txProposal.Amount)
+	require.Nil(s.T(), txProposal.ChangeAddress)
+	require.Len(s.T(), txProposal.Outputs, 2)
+	require.Equal(s.T(), fixedOutput, txProposal.Outputs[0])
+	require.Equal(s.T(), s.output(100000-20000-txSizeTwoInputs), txProposal.Outputs[1])
+	require.Len(s.T(), txProposal.Transaction.TxIn, 2)
+	require.Len(s.T(), txProposal.Transaction.TxOut, 2)
+
+	_, err = maketx.NewTxSpendAll(
+		s.coin, s.buildUTXO(20000), []*wire.TxOut{fixedOutput}, s.outputPkScript, feePerKb, s.log)
+	require.Equal(s.T(), errors.ErrInsufficientFunds, errp.Cause(err))
+}
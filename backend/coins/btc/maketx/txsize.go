@@ -17,6 +17,7 @@ package maketx
 import (
 	"github.com/btcsuite/btcd/wire"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 )
 
@@ -38,6 +39,10 @@ func outputSize(pkScriptSize int) int {
 //
 // Witnesses, if present, are assumed to have the following format:
 // <serialized sig> <serialized compressed pubkey>
+// or, for taproot inputs:
+// <serialized schnorr sig>
+// or, for m-of-n multisig inputs:
+// <empty> <serialized sig 1> ... <serialized sig m> <witness script>
 //
 // inputConfigurations defines the number of inputs and the input configurations in the tx.
 // outputPkScriptSize is the size of the output pkScript. One output is assumed (apart from change).
@@ -47,11 +52,18 @@ func estimateTxSize(
 	inputConfigurations []*signing.Configuration,
 	outputPkScriptSize int,
 	changePkScriptSize int) int {
-	outputCount := 2 // 1 output + 1 change output
-	if changePkScriptSize == 0 {
-		outputCount = 1
+	outputPkScriptSizes := []int{outputPkScriptSize}
+	if changePkScriptSize != 0 {
+		outputPkScriptSizes = append(outputPkScriptSizes, changePkScriptSize)
 	}
+	return estimateTxSizeOutputs(inputConfigurations, outputPkScriptSizes)
+}
 
+// estimateTxSizeOutputs is like estimateTxSize, for a tx with any number of outputs.
+// outputPkScriptSizes contains the pkScript size of each output, including the change output.
+func estimateTxSizeOutputs(
+	inputConfigurations []*signing.Configuration,
+	outputPkScriptSizes []int) int {
 	const (
 		versionSize  = 4
 		lockTimeSize = 4
@@ -60,9 +72,10 @@ func estimateTxSize(
 	)
 
 	txWeight := nonWitness * (versionSize + lockTimeSize + wire.VarIntSerializeSize(uint64(len(inputConfigurations))) +
-		wire.VarIntSerializeSize(uint64(outputCount)) +
-		outputSize(outputPkScriptSize) +
-		outputSize(changePkScriptSize))
+		wire.VarIntSerializeSize(uint64(len(outputPkScriptSizes))))
+	for _, outputPkScriptSize := range outputPkScriptSizes {
+		txWeight += nonWitness * outputSize(outputPkScriptSize)
+	}
 
 	isSegwitTx := false
 	for _, inputConfiguration := range inputConfigurations {
@@ -83,13 +96,27 @@ func estimateTxSize(
 				signatureSize = 72
 				pubkeySize    = 33
 			)
-			if hasWitness {
-				// For now, every input has a witness serialization of this format:
+			switch {
+			case hasWitness && inputConfiguration.ScriptType() == signing.ScriptTypeP2TR:
+				// Taproot key path spends have a witness of this format:
+				// <serialized schnorr sig>
+				txWeight += wire.VarIntSerializeSize(1) +
+					wire.VarIntSerializeSize(taproot.SignatureSize) + taproot.SignatureSize
+			case hasWitness && inputConfiguration.IsMultisig():
+				threshold := int(inputConfiguration.BitcoinMultisig.Threshold)
+				// OP_m <OP_DATA_33 pubkey>*n OP_n OP_CHECKMULTISIG
+				witnessScriptSize := 1 + len(inputConfiguration.BitcoinMultisig.KeyInfos)*(1+pubkeySize) + 1 + 1
+				txWeight += wire.VarIntSerializeSize(uint64(threshold+2)) +
+					wire.VarIntSerializeSize(0) +
+					threshold*(wire.VarIntSerializeSize(signatureSize)+signatureSize) +
+					wire.VarIntSerializeSize(uint64(witnessScriptSize)) + witnessScriptSize
+			case hasWitness:
+				// Every other input has a witness serialization of this format:
 				// <serialized sig> <serialized compressed pubkey>
 				txWeight += wire.VarIntSerializeSize(2) +
 					wire.VarIntSerializeSize(signatureSize) + signatureSize +
 					wire.VarIntSerializeSize(pubkeySize) + pubkeySize
-			} else {
+			default:
 				// "Empty script witnesses are encoded as a zero byte"
 				// https://github.com/bitcoin/bips/blob/d8a56c9f2b521bf4af5d588f217e7618cc44952c/bip-0144.mediawiki
 				txWeight += wire.VarIntSerializeSize(0)
@@ -24,6 +24,7 @@ import (
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	addressesTest "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses/test"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/stretchr/testify/require"
 )
@@ -42,6 +43,8 @@ func testEstimateTxSize(
 		signing.ScriptTypeP2PKH,
 		signing.ScriptTypeP2WPKHP2SH,
 		signing.ScriptTypeP2WPKH,
+		signing.ScriptTypeP2TR,
+		signing.ScriptTypeP2WSH,
 	}
 	if !useSegwit {
 		inputScriptTypes = []signing.ScriptType{signing.ScriptTypeP2PKH}
@@ -66,7 +69,21 @@ func testEstimateTxSize(
 	for counter := 0; counter < 10; counter++ {
 		for _, inputScriptType := range inputScriptTypes {
 			inputAddress := addressesTest.GetAddress(inputScriptType)
-			sigScript, witness := inputAddress.SignatureScript(*sig)
+			var sigScript []byte
+			var witness wire.TxWitness
+			switch inputScriptType {
+			case signing.ScriptTypeP2TR:
+				witness = inputAddress.TaprootWitness(make([]byte, taproot.SignatureSize))
+			case signing.ScriptTypeP2WSH:
+				signatures := map[string]*btcec.Signature{}
+				for _, publicKey := range inputAddress.MultisigPublicKeys() {
+					signatures[string(publicKey)] = sig
+				}
+				witness, err = inputAddress.MultisigWitness(signatures)
+				require.NoError(t, err)
+			default:
+				sigScript, witness = inputAddress.SignatureScript(*sig)
+			}
 			tx.TxIn = append(tx.TxIn, &wire.TxIn{
 				SignatureScript: sigScript,
 				Witness:         witness,
@@ -98,6 +115,8 @@ func TestEstimateTxSize(t *testing.T) {
 		signing.ScriptTypeP2PKH,
 		signing.ScriptTypeP2WPKHP2SH,
 		signing.ScriptTypeP2WPKH,
+		signing.ScriptTypeP2TR,
+		signing.ScriptTypeP2WSH,
 	}
 
 	for _, useSegwit := range []bool{false, true} {
@@ -0,0 +1,296 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ErrMultisigSignaturesMissing is returned when a multisig transaction was signed by the connected
+// keystore, but more cosigners need to sign before it can be broadcast. The partially signed
+// transaction is kept as the pending multisig transaction of the account.
+var ErrMultisigSignaturesMissing = errors.New("more cosigner signatures are needed")
+
+// pendingMultisigTxFilename is the name of the file in the account folder holding the partially
+// signed transaction of a multisig account, as a base64 encoded PSBT.
+const pendingMultisigTxFilename = "multisig-pending.psbt"
+
+// MultisigPendingTx describes the partially signed transaction of a multisig account.
+type MultisigPendingTx struct {
+	// PSBT is the base64 encoded PSBT, which can be passed to other cosigners.
+	PSBT string `json:"psbt"`
+	TxID string `json:"txID"`
+	// Signatures is the number of cosigners who signed all inputs.
+	Signatures int `json:"signatures"`
+	Threshold  int `json:"threshold"`
+}
+
+// IsMultisig returns true if this is a multisig account.
+func (account *Account) IsMultisig() bool {
+	return account.subaccounts[0].signingConfiguration.IsMultisig()
+}
+
+func (account *Account) pendingMultisigTxFile() string {
+	return path.Join(account.FilesFolder(), pendingMultisigTxFilename)
+}
+
+// loadPendingMultisigTx returns the pending multisig transaction, or nil if there is none.
+func (account *Account) loadPendingMultisigTx() (*psbt.Packet, error) {
+	encoded, err := ioutil.ReadFile(account.pendingMultisigTxFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return psbt.NewFromBase64(strings.TrimSpace(string(encoded)))
+}
+
+func (account *Account) storePendingMultisigTx(packet *psbt.Packet) error {
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return err
+	}
+	return errp.WithStack(ioutil.WriteFile(account.pendingMultisigTxFile(), []byte(encoded), 0600))
+}
+
+// multisigSignatureCount returns the number of cosigners who signed all inputs of the PSBT.
+func (account *Account) multisigSignatureCount(packet *psbt.Packet) (int, error) {
+	count := -1
+	for index, input := range packet.Inputs {
+		prevOut, err := packet.PrevOut(index)
+		if err != nil {
+			return 0, err
+		}
+		address := account.lookupAddress(blockchain.NewScriptHashHex(prevOut.PkScript))
+		if address == nil {
+			return 0, errp.Newf("Input %d does not belong to this account", index)
+		}
+		signatures, err := psbtMultisigSignatures(address, input)
+		if err != nil {
+			return 0, err
+		}
+		if count == -1 || len(signatures) < count {
+			count = len(signatures)
+		}
+	}
+	if count == -1 {
+		return 0, nil
+	}
+	return count, nil
+}
+
+// PendingMultisigTx returns the partially signed transaction of this multisig account, or nil if
+// there is none.
+func (account *Account) PendingMultisigTx() (*MultisigPendingTx, error) {
+	defer account.pendingMultisigTxLock.RLock()()
+	packet, err := account.loadPendingMultisigTx()
+	if err != nil || packet == nil {
+		return nil, err
+	}
+	signatures, err := account.multisigSignatureCount(packet)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return nil, err
+	}
+	return &MultisigPendingTx{
+		PSBT:       encoded,
+		TxID:       packet.UnsignedTx.TxHash().String(),
+		Signatures: signatures,
+		Threshold:  int(account.subaccounts[0].signingConfiguration.BitcoinMultisig.Threshold),
+	}, nil
+}
+
+// DiscardPendingMultisigTx deletes the partially signed transaction of this multisig account.
+func (account *Account) DiscardPendingMultisigTx() error {
+	defer account.pendingMultisigTxLock.Lock()()
+	err := os.Remove(account.pendingMultisigTxFile())
+	if err != nil && !os.IsNotExist(err) {
+		return errp.WithStack(err)
+	}
+	return nil
+}
+
+// SignPendingMultisigTx adds the signatures of the connected keystore to the pending multisig
+// transaction. If enough cosigners signed, the transaction is broadcast. Otherwise,
+// ErrMultisigSignaturesMissing is returned.
+func (account *Account) SignPendingMultisigTx() error {
+	defer account.pendingMultisigTxLock.Lock()()
+	packet, err := account.loadPendingMultisigTx()
+	if err != nil {
+		return err
+	}
+	if packet == nil {
+		return errp.New("No pending multisig transaction")
+	}
+	return account.signMultisigPSBT(packet)
+}
+
+// sendMultisigTx starts a new multisig transaction from the tx proposal. It replaces a previously
+// pending multisig transaction. previousOutputs must contain all outputs which are spent by the
+// transaction.
+func (account *Account) sendMultisigTx(
+	txProposal *maketx.TxProposal,
+	previousOutputs map[wire.OutPoint]*transactions.SpendableOutput,
+	note string,
+) error {
+	defer account.pendingMultisigTxLock.Lock()()
+	packet, err := account.newPSBT(txProposal, previousOutputs)
+	if err != nil {
+		return err
+	}
+	// The txid does not depend on the (segwit) signatures, so the note can be stored already.
+	if err := account.SetTxNote(packet.UnsignedTx.TxHash().String(), note); err != nil {
+		// Not critical.
+		account.log.WithError(err).Error("Failed to save transaction note when sending a tx")
+	}
+	return account.signMultisigPSBT(packet)
+}
+
+// signMultisigPSBT signs all inputs of the PSBT with the connected keystore and adds the
+// signatures to it. If the threshold is reached, the transaction is finalized and broadcast, and
+// the pending multisig transaction is deleted. Otherwise, the PSBT is stored as the pending
+// multisig transaction and ErrMultisigSignaturesMissing is returned.
+func (account *Account) signMultisigPSBT(packet *psbt.Packet) error {
+	keystore := account.Config().Keystore
+	rootFingerprint, err := keystore.RootFingerprint()
+	if err != nil {
+		return err
+	}
+	transaction := packet.UnsignedTx.Copy()
+	previousOutputs := make(map[wire.OutPoint]*transactions.SpendableOutput, len(transaction.TxIn))
+	for index, txIn := range transaction.TxIn {
+		prevOut, err := packet.PrevOut(index)
+		if err != nil {
+			return err
+		}
+		if account.lookupAddress(blockchain.NewScriptHashHex(prevOut.PkScript)) == nil {
+			return errp.Newf("Input %d does not belong to this account", index)
+		}
+		previousOutputs[txIn.PreviousOutPoint] = &transactions.SpendableOutput{TxOut: prevOut}
+	}
+	var changeAddress *addresses.AccountAddress
+	for _, txOut := range transaction.TxOut {
+		if address := account.lookupChangeAddress(blockchain.NewScriptHashHex(txOut.PkScript)); address != nil {
+			changeAddress = address
+			break
+		}
+	}
+
+	signingConfigs := make([]*signing.Configuration, len(account.subaccounts))
+	for i, subacc := range account.subaccounts {
+		signingConfigs[i] = subacc.signingConfiguration
+	}
+	sigHashes := txscript.NewTxSigHashes(transaction)
+	proposedTransaction := &ProposedTransaction{
+		TXProposal: &maketx.TxProposal{
+			Coin:          account.coin,
+			Transaction:   transaction,
+			ChangeAddress: changeAddress,
+		},
+		AccountSigningConfigurations: signingConfigs,
+		PreviousOutputs:              previousOutputs,
+		GetAddress:                   account.getAddress,
+		GetPrevTx:                    account.getPrevTx,
+		Signatures:                   make([]*btcec.Signature, len(transaction.TxIn)),
+		SchnorrSignatures:            make([][]byte, len(transaction.TxIn)),
+		SigHashes:                    sigHashes,
+	}
+	account.log.Info("Signing multisig transaction")
+	if err := keystore.SignTransaction(proposedTransaction); err != nil {
+		return err
+	}
+
+	for index, txIn := range transaction.TxIn {
+		signature := proposedTransaction.Signatures[index]
+		if signature == nil {
+			continue
+		}
+		spentOutput := previousOutputs[txIn.PreviousOutPoint]
+		address := account.getAddress(spentOutput.ScriptHashHex())
+		keyInfo := address.Configuration.KeyInfo(rootFingerprint)
+		if keyInfo == nil {
+			return errp.Newf("Input %d: the keystore is not a cosigner", index)
+		}
+		publicKey, err := keyInfo.ExtendedPublicKey.ECPubKey()
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		signatureHash, err := txscript.CalcWitnessSigHash(address.WitnessScript(), sigHashes,
+			txscript.SigHashAll, transaction, index, spentOutput.Value)
+		if err != nil {
+			return errp.WithStack(err)
+		}
+		if !signature.Verify(signatureHash, publicKey) {
+			return errp.Newf("Input %d: invalid signature", index)
+		}
+		serializedPublicKey := publicKey.SerializeCompressed()
+		input := packet.Inputs[index]
+		partialSigs := []*psbt.PartialSig{}
+		for _, partialSig := range input.PartialSigs {
+			if !bytes.Equal(partialSig.PubKey, serializedPublicKey) {
+				partialSigs = append(partialSigs, partialSig)
+			}
+		}
+		input.PartialSigs = append(partialSigs, &psbt.PartialSig{
+			PubKey:    serializedPublicKey,
+			Signature: append(signature.Serialize(), byte(txscript.SigHashAll)),
+		})
+	}
+
+	signatures, err := account.multisigSignatureCount(packet)
+	if err != nil {
+		return err
+	}
+	threshold := int(account.subaccounts[0].signingConfiguration.BitcoinMultisig.Threshold)
+	if signatures < threshold {
+		account.log.Infof("Multisig transaction has %d of %d signatures", signatures, threshold)
+		if err := account.storePendingMultisigTx(packet); err != nil {
+			return err
+		}
+		return errp.WithStack(ErrMultisigSignaturesMissing)
+	}
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return err
+	}
+	if _, err := account.BroadcastPSBT(encoded); err != nil {
+		return err
+	}
+	err = os.Remove(account.pendingMultisigTxFile())
+	if err != nil && !os.IsNotExist(err) {
+		return errp.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystoreMock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultisigSigning(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	dbFolder := test.TstTempDir("btc-dbfolder")
+	defer func() { _ = os.RemoveAll(dbFolder) }()
+
+	coin := btc.NewCoin(
+		coin.CodeTBTC, "Bitcoin Testnet", "TBTC", net, dbFolder, nil, explorer, socksproxy.NewSocksProxy(false, ""))
+	var broadcastTx *wire.MsgTx
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	blockchainMock.MockTransactionBroadcast = func(tx *wire.MsgTx) error {
+		broadcastTx = tx
+		return nil
+	}
+	coin.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
+
+	keypath, err := signing.NewAbsoluteKeypath("m/48'/1'/0'/2'")
+	require.NoError(t, err)
+	keystores := make([]*software.Keystore, 3)
+	keyInfos := make([]signing.KeyInfo, len(keystores))
+	for i := range keystores {
+		seed := make([]byte, 32)
+		seed[0] = byte(i)
+		master, err := hdkeychain.NewMaster(seed, net)
+		require.NoError(t, err)
+		keystores[i] = software.NewKeystore(master)
+		rootFingerprint, err := keystores[i].RootFingerprint()
+		require.NoError(t, err)
+		xpub, err := keystores[i].ExtendedPublicKey(nil, keypath)
+		require.NoError(t, err)
+		keyInfos[i] = signing.KeyInfo{
+			RootFingerprint:   rootFingerprint,
+			AbsoluteKeypath:   keypath,
+			ExtendedPublicKey: xpub,
+		}
+	}
+	accountConfig := &accounts.AccountConfig{
+		Code:     "accountcode",
+		Name:     "accountname",
+		DBFolder: dbFolder,
+		Keystore: keystores[0],
+		OnEvent:  func(accounts.Event) {},
+		SigningConfigurations: signing.Configurations{
+			signing.NewBitcoinMultisigConfiguration(2, signing.ScriptTypeP2WSH, keyInfos),
+		},
+		GetNotifier: func(signing.Configurations) accounts.Notifier { return nil },
+	}
+	account := btc.NewAccount(accountConfig, coin, nil, logging.Get().WithGroup("multisig_test"))
+	require.NoError(t, account.Initialize())
+	require.True(t, account.IsMultisig())
+
+	receiveAddress, err := coin.DecodeAddress(account.GetUnusedReceiveAddresses()[0][0].EncodeForHumans())
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(receiveAddress)
+	require.NoError(t, err)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, []byte{txscript.OP_0, txscript.OP_DATA_20,
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	packet, err := psbt.New(tx)
+	require.NoError(t, err)
+	packet.Inputs[0].WitnessUtxo = wire.NewTxOut(100000, pkScript)
+
+	pending, err := account.PendingMultisigTx()
+	require.NoError(t, err)
+	require.Nil(t, pending)
+
+	// The first cosigner signs.
+	err = account.TstSignMultisigPSBT(packet)
+	require.Equal(t, btc.ErrMultisigSignaturesMissing, errp.Cause(err))
+	require.Nil(t, broadcastTx)
+	pending, err = account.PendingMultisigTx()
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	require.Equal(t, tx.TxHash().String(), pending.TxID)
+	require.Equal(t, 1, pending.Signatures)
+	require.Equal(t, 2, pending.Threshold)
+
+	// Signing again with the same cosigner does not add a signature.
+	require.Equal(t, btc.ErrMultisigSignaturesMissing, errp.Cause(account.SignPendingMultisigTx()))
+	pending, err = account.PendingMultisigTx()
+	require.NoError(t, err)
+	require.Equal(t, 1, pending.Signatures)
+
+	// The third cosigner signs, reaching the threshold.
+	accountConfig.Keystore = keystores[2]
+	require.NoError(t, account.SignPendingMultisigTx())
+	require.NotNil(t, broadcastTx)
+	require.Equal(t, tx.TxHash(), broadcastTx.TxHash())
+	require.Len(t, broadcastTx.TxIn[0].Witness, 4)
+	pending, err = account.PendingMultisigTx()
+	require.NoError(t, err)
+	require.Nil(t, pending)
+
+	require.Error(t, account.SignPendingMultisigTx())
+
+	// Paying to a receive address of the account is not treated as change.
+	var proposedTx *btc.ProposedTransaction
+	accountConfig.Keystore = &keystoreMock.KeystoreMock{
+		RootFingerprintFunc: keystores[0].RootFingerprint,
+		SignTransactionFunc: func(tx interface{}) error {
+			proposedTx = tx.(*btc.ProposedTransaction)
+			return nil
+		},
+	}
+	tx = wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+	packet, err = psbt.New(tx)
+	require.NoError(t, err)
+	packet.Inputs[0].WitnessUtxo = wire.NewTxOut(100000, pkScript)
+	require.Equal(t, btc.ErrMultisigSignaturesMissing, errp.Cause(account.TstSignMultisigPSBT(packet)))
+	require.NotNil(t, proposedTx)
+	require.Nil(t, proposedTx.TXProposal.ChangeAddress)
+}
@@ -0,0 +1,308 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// hasKeyOrigin returns true if the root fingerprint and the keypath of the key are known. This is
+// not the case for watch-only accounts of extended public keys without key origin, see
+// watchonly.NewConfiguration().
+func hasKeyOrigin(keyInfo signing.KeyInfo) bool {
+	return len(keyInfo.AbsoluteKeypath.ToUInt32()) == int(keyInfo.ExtendedPublicKey.Depth())
+}
+
+// psbtDerivations returns the BIP32 derivation of the key of a single sig address, or nil if the
+// origin of the key is unknown.
+func psbtDerivations(address *addresses.AccountAddress, pubKey []byte) []*psbt.Bip32Derivation {
+	keyInfo := address.Configuration.KeyInfos()[0]
+	if !hasKeyOrigin(keyInfo) {
+		return nil
+	}
+	return []*psbt.Bip32Derivation{{
+		PubKey:               pubKey,
+		MasterKeyFingerprint: keyInfo.RootFingerprint,
+		Path:                 keyInfo.AbsoluteKeypath.ToUInt32(),
+	}}
+}
+
+// psbtMultisigDerivations returns the BIP32 derivations of all cosigner keys of a multisig address
+// with a known origin.
+func psbtMultisigDerivations(address *addresses.AccountAddress) []*psbt.Bip32Derivation {
+	keyInfos := address.Configuration.KeyInfos()
+	publicKeys := address.Configuration.PublicKeys()
+	var derivations []*psbt.Bip32Derivation
+	for i, keyInfo := range keyInfos {
+		if !hasKeyOrigin(keyInfo) {
+			continue
+		}
+		derivations = append(derivations, &psbt.Bip32Derivation{
+			PubKey:               publicKeys[i].SerializeCompressed(),
+			MasterKeyFingerprint: keyInfo.RootFingerprint,
+			Path:                 keyInfo.AbsoluteKeypath.ToUInt32(),
+		})
+	}
+	return derivations
+}
+
+// newPSBT creates a PSBT for the unsigned transaction of the tx proposal. The spent outputs, the
+// BIP32 derivations of the inputs and of the change output are filled in, so that any signer
+// holding the keys can sign it.
+func (account *Account) newPSBT(
+	txProposal *maketx.TxProposal,
+	previousOutputs map[wire.OutPoint]*transactions.SpendableOutput,
+) (*psbt.Packet, error) {
+	packet, err := psbt.New(txProposal.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	for index, txIn := range packet.UnsignedTx.TxIn {
+		spentOutput, ok := previousOutputs[txIn.PreviousOutPoint]
+		if !ok {
+			return nil, errp.New("There needs to be exactly one output being spent per input!")
+		}
+		address := account.getAddress(spentOutput.ScriptHashHex())
+		input := packet.Inputs[index]
+		if address.Configuration.IsMultisig() {
+			sighashType := uint32(txscript.SigHashAll)
+			input.WitnessUtxo = spentOutput.TxOut
+			input.WitnessScript = address.WitnessScript()
+			input.SighashType = &sighashType
+			input.Bip32Derivation = psbtMultisigDerivations(address)
+			continue
+		}
+		publicKey := address.Configuration.PublicKey()
+		switch address.Configuration.ScriptType() {
+		case signing.ScriptTypeP2PKH:
+			prevTx, err := account.fetchPrevTx(txIn.PreviousOutPoint.Hash)
+			if err != nil {
+				return nil, err
+			}
+			input.NonWitnessUtxo = prevTx
+		case signing.ScriptTypeP2WPKHP2SH:
+			input.WitnessUtxo = spentOutput.TxOut
+			_, input.RedeemScript = address.ScriptForHashToSign()
+		default:
+			input.WitnessUtxo = spentOutput.TxOut
+		}
+		if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
+			internalKey := taproot.SerializePubKey(publicKey)
+			input.TaprootInternalKey = internalKey
+			input.TaprootBip32Derivation = psbtDerivations(address, internalKey)
+			continue
+		}
+		sighashType := uint32(txscript.SigHashAll)
+		input.SighashType = &sighashType
+		input.Bip32Derivation = psbtDerivations(address, publicKey.SerializeCompressed())
+	}
+
+	changeAddress := txProposal.ChangeAddress
+	for index, txOut := range packet.UnsignedTx.TxOut {
+		if changeAddress == nil || !bytes.Equal(changeAddress.PubkeyScript(), txOut.PkScript) {
+			continue
+		}
+		output := packet.Outputs[index]
+		if changeAddress.Configuration.IsMultisig() {
+			output.WitnessScript = changeAddress.WitnessScript()
+			output.Bip32Derivation = psbtMultisigDerivations(changeAddress)
+			continue
+		}
+		publicKey := changeAddress.Configuration.PublicKey()
+		switch changeAddress.Configuration.ScriptType() {
+		case signing.ScriptTypeP2TR:
+			internalKey := taproot.SerializePubKey(publicKey)
+			output.TaprootInternalKey = internalKey
+			output.TaprootBip32Derivation = psbtDerivations(changeAddress, internalKey)
+		case signing.ScriptTypeP2WPKHP2SH:
+			_, output.RedeemScript = changeAddress.ScriptForHashToSign()
+			fallthrough
+		default:
+			output.Bip32Derivation = psbtDerivations(changeAddress, publicKey.SerializeCompressed())
+		}
+	}
+	return packet, nil
+}
+
+// TxProposalPSBT returns the unsigned transaction of the active tx proposal (see TxProposal()) as
+// a base64 encoded PSBT (BIP174), so it can be reviewed and signed by another party.
+func (account *Account) TxProposalPSBT() (string, error) {
+	unlock := account.activeTxProposalLock.RLock()
+	txProposal := account.activeTxProposal
+	prevOutputs := account.activeTxProposalPrevOutputs
+	unlock()
+	if txProposal == nil {
+		return "", errp.New("No active tx proposal")
+	}
+	packet, err := account.newPSBT(txProposal, prevOutputs)
+	if err != nil {
+		return "", err
+	}
+	return packet.B64Encode()
+}
+
+// psbtPartialSignature parses a partial signature of a PSBT input. Only SIGHASH_ALL is supported.
+func psbtPartialSignature(partialSig *psbt.PartialSig) (*btcec.Signature, error) {
+	if len(partialSig.Signature) == 0 {
+		return nil, errp.New("Empty signature")
+	}
+	derSignature := partialSig.Signature[:len(partialSig.Signature)-1]
+	sighashType := partialSig.Signature[len(partialSig.Signature)-1]
+	if txscript.SigHashType(sighashType) != txscript.SigHashAll {
+		return nil, errp.Newf("Unsupported sighash type %d", sighashType)
+	}
+	signature, err := btcec.ParseDERSignature(derSignature, btcec.S256())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return signature, nil
+}
+
+// psbtMultisigSignatures returns the valid signatures of the cosigners of a multisig address
+// contained in the partial signatures of a PSBT input, keyed by compressed public key.
+func psbtMultisigSignatures(address *addresses.AccountAddress, input *psbt.Input) (
+	map[string]*btcec.Signature, error) {
+	signatures := map[string]*btcec.Signature{}
+	for _, publicKey := range address.Configuration.PublicKeys() {
+		serializedPublicKey := publicKey.SerializeCompressed()
+		for _, partialSig := range input.PartialSigs {
+			if !bytes.Equal(partialSig.PubKey, serializedPublicKey) {
+				continue
+			}
+			signature, err := psbtPartialSignature(partialSig)
+			if err != nil {
+				return nil, err
+			}
+			signatures[string(serializedPublicKey)] = signature
+			break
+		}
+	}
+	return signatures, nil
+}
+
+// finalizePSBTInput builds the final scriptSig and witness of an input spending from one of our
+// addresses out of the signature(s) contained in the PSBT.
+func (account *Account) finalizePSBTInput(packet *psbt.Packet, index int) error {
+	input := packet.Inputs[index]
+	prevOut, err := packet.PrevOut(index)
+	if err != nil {
+		return err
+	}
+	address := account.lookupAddress(blockchain.NewScriptHashHex(prevOut.PkScript))
+	if address == nil {
+		return errp.Newf("Input %d is not signed and does not belong to this account", index)
+	}
+	switch {
+	case address.Configuration.IsMultisig():
+		signatures, err := psbtMultisigSignatures(address, input)
+		if err != nil {
+			return errp.WithMessage(err, fmt.Sprintf("Input %d", index))
+		}
+		witness, err := address.MultisigWitness(signatures)
+		if err != nil {
+			return errp.WithMessage(err, fmt.Sprintf("Input %d", index))
+		}
+		input.FinalScriptWitness = witness
+	case address.Configuration.ScriptType() == signing.ScriptTypeP2TR:
+		if _, _, err := taproot.ParseSignature(input.TaprootKeySig); err != nil {
+			return errp.Newf("Input %d is missing a valid taproot signature", index)
+		}
+		input.FinalScriptWitness = address.TaprootWitness(input.TaprootKeySig)
+	default:
+		publicKey := address.Configuration.PublicKey().SerializeCompressed()
+		var signature *btcec.Signature
+		for _, partialSig := range input.PartialSigs {
+			if !bytes.Equal(partialSig.PubKey, publicKey) || len(partialSig.Signature) == 0 {
+				continue
+			}
+			signature, err = psbtPartialSignature(partialSig)
+			if err != nil {
+				return errp.WithMessage(err, fmt.Sprintf("Input %d", index))
+			}
+			break
+		}
+		if signature == nil {
+			return errp.Newf("Input %d is missing a signature", index)
+		}
+		signatureScript, witness := address.SignatureScript(*signature)
+		if len(signatureScript) != 0 {
+			input.FinalScriptSig = signatureScript
+		}
+		input.FinalScriptWitness = witness
+	}
+	// Clear the fields which are not needed anymore, as required by BIP174.
+	input.PartialSigs = nil
+	input.SighashType = nil
+	input.RedeemScript = nil
+	input.WitnessScript = nil
+	input.Bip32Derivation = nil
+	input.TaprootKeySig = nil
+	input.TaprootBip32Derivation = nil
+	input.TaprootInternalKey = nil
+	return nil
+}
+
+// BroadcastPSBT finalizes a signed PSBT (BIP174), checks that all inputs are validly signed and
+// broadcasts the resulting transaction. Inputs can be already finalized by another party; all
+// other inputs must spend from this account. Returns the transaction ID.
+func (account *Account) BroadcastPSBT(encodedPSBT string) (string, error) {
+	packet, err := psbt.NewFromBase64(encodedPSBT)
+	if err != nil {
+		return "", errp.WithMessage(err, "Invalid PSBT")
+	}
+	for index, input := range packet.Inputs {
+		if input.IsFinalized() {
+			continue
+		}
+		if err := account.finalizePSBTInput(packet, index); err != nil {
+			return "", err
+		}
+	}
+	transaction, err := packet.Extract()
+	if err != nil {
+		return "", err
+	}
+	previousOutputs := make(map[wire.OutPoint]*transactions.SpendableOutput, len(transaction.TxIn))
+	for index, txIn := range transaction.TxIn {
+		prevOut, err := packet.PrevOut(index)
+		if err != nil {
+			return "", err
+		}
+		previousOutputs[txIn.PreviousOutPoint] = &transactions.SpendableOutput{TxOut: prevOut}
+	}
+	if err := verifyInputScripts(
+		transaction, previousOutputs, txscript.NewTxSigHashes(transaction)); err != nil {
+		return "", errp.WithMessage(err, "PSBT is not validly signed")
+	}
+
+	account.log.Info("Signed PSBT transaction is broadcasted")
+	if err := account.coin.Blockchain().TransactionBroadcast(transaction); err != nil {
+		return "", err
+	}
+	return transaction.TxHash().String(), nil
+}
@@ -0,0 +1,649 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package psbt implements the serialization format of Partially Signed Bitcoin Transactions
+// (version 0), see https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki, including the
+// taproot fields of BIP371.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// magic is the "psbt" magic followed by the 0xff separator.
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// maxPSBTSize limits the size of PSBTs we are willing to parse.
+const maxPSBTSize = 10_000_000
+
+// Key types, see BIP174 and BIP371.
+const (
+	globalUnsignedTx = 0x00
+
+	inputNonWitnessUtxo         = 0x00
+	inputWitnessUtxo            = 0x01
+	inputPartialSig             = 0x02
+	inputSighashType            = 0x03
+	inputRedeemScript           = 0x04
+	inputWitnessScript          = 0x05
+	inputBip32Derivation        = 0x06
+	inputFinalScriptSig         = 0x07
+	inputFinalScriptWitness     = 0x08
+	inputTaprootKeySig          = 0x13
+	inputTaprootBip32Derivation = 0x16
+	inputTaprootInternalKey     = 0x17
+
+	outputRedeemScript           = 0x00
+	outputWitnessScript          = 0x01
+	outputBip32Derivation        = 0x02
+	outputTaprootInternalKey     = 0x05
+	outputTaprootBip32Derivation = 0x06
+)
+
+// Unknown is a key-value pair we don't interpret, but keep so it survives a roundtrip.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// Bip32Derivation describes where a public key comes from. For taproot derivations, PubKey is the
+// 32 byte x-only public key.
+type Bip32Derivation struct {
+	PubKey               []byte
+	MasterKeyFingerprint []byte
+	Path                 []uint32
+}
+
+// PartialSig is an ECDSA signature, including the sighash byte, for a public key.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Input contains the per-input fields of a PSBT.
+type Input struct {
+	NonWitnessUtxo *wire.MsgTx
+	WitnessUtxo    *wire.TxOut
+	PartialSigs    []*PartialSig
+	// SighashType is nil if not present.
+	SighashType            *uint32
+	RedeemScript           []byte
+	WitnessScript          []byte
+	Bip32Derivation        []*Bip32Derivation
+	FinalScriptSig         []byte
+	FinalScriptWitness     wire.TxWitness
+	TaprootKeySig          []byte
+	TaprootBip32Derivation []*Bip32Derivation
+	TaprootInternalKey     []byte
+	Unknowns               []*Unknown
+}
+
+// IsFinalized returns true if the input has its final scriptSig or witness.
+func (input *Input) IsFinalized() bool {
+	return input.FinalScriptSig != nil || input.FinalScriptWitness != nil
+}
+
+// Output contains the per-output fields of a PSBT.
+type Output struct {
+	RedeemScript           []byte
+	WitnessScript          []byte
+	Bip32Derivation        []*Bip32Derivation
+	TaprootInternalKey     []byte
+	TaprootBip32Derivation []*Bip32Derivation
+	Unknowns               []*Unknown
+}
+
+// Packet is a PSBT.
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	Inputs     []*Input
+	Outputs    []*Output
+	Unknowns   []*Unknown
+}
+
+// New creates a PSBT for the given transaction, with empty inputs and outputs. The transaction
+// must not contain any signatures.
+func New(tx *wire.MsgTx) (*Packet, error) {
+	for _, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			return nil, errp.New("the unsigned transaction must not contain signatures")
+		}
+	}
+	packet := &Packet{
+		UnsignedTx: tx.Copy(),
+		Inputs:     make([]*Input, len(tx.TxIn)),
+		Outputs:    make([]*Output, len(tx.TxOut)),
+	}
+	for i := range packet.Inputs {
+		packet.Inputs[i] = &Input{}
+	}
+	for i := range packet.Outputs {
+		packet.Outputs[i] = &Output{}
+	}
+	return packet, nil
+}
+
+// PrevOut returns the output spent by the input at the given index, if known.
+func (packet *Packet) PrevOut(index int) (*wire.TxOut, error) {
+	input := packet.Inputs[index]
+	outPoint := packet.UnsignedTx.TxIn[index].PreviousOutPoint
+	if input.NonWitnessUtxo != nil {
+		if input.NonWitnessUtxo.TxHash() != outPoint.Hash {
+			return nil, errp.New("non-witness utxo does not match the spent outpoint")
+		}
+		if int(outPoint.Index) >= len(input.NonWitnessUtxo.TxOut) {
+			return nil, errp.New("spent outpoint index out of range")
+		}
+		return input.NonWitnessUtxo.TxOut[outPoint.Index], nil
+	}
+	if input.WitnessUtxo != nil {
+		return input.WitnessUtxo, nil
+	}
+	return nil, errp.Newf("previous output of input %d unknown", index)
+}
+
+// IsComplete returns true if all inputs are finalized.
+func (packet *Packet) IsComplete() bool {
+	for _, input := range packet.Inputs {
+		if !input.IsFinalized() {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the final network transaction. All inputs must be finalized.
+func (packet *Packet) Extract() (*wire.MsgTx, error) {
+	if !packet.IsComplete() {
+		return nil, errp.New("not all inputs are finalized")
+	}
+	tx := packet.UnsignedTx.Copy()
+	for index, txIn := range tx.TxIn {
+		input := packet.Inputs[index]
+		txIn.SignatureScript = input.FinalScriptSig
+		txIn.Witness = input.FinalScriptWitness
+	}
+	return tx, nil
+}
+
+func writeKeyValue(w io.Writer, keyType byte, keyData []byte, value []byte) error {
+	if err := wire.WriteVarBytes(w, 0, append([]byte{keyType}, keyData...)); err != nil {
+		return errp.WithStack(err)
+	}
+	return errp.WithStack(wire.WriteVarBytes(w, 0, value))
+}
+
+func writeSeparator(w io.Writer) error {
+	_, err := w.Write([]byte{0x00})
+	return errp.WithStack(err)
+}
+
+func serializeDerivation(derivation *Bip32Derivation) []byte {
+	var buf bytes.Buffer
+	buf.Write(derivation.MasterKeyFingerprint)
+	for _, index := range derivation.Path {
+		_ = binary.Write(&buf, binary.LittleEndian, index)
+	}
+	return buf.Bytes()
+}
+
+func serializeTaprootDerivation(derivation *Bip32Derivation) []byte {
+	var buf bytes.Buffer
+	// No leaf hashes, we only use key path spends.
+	_ = wire.WriteVarInt(&buf, 0, 0)
+	buf.Write(serializeDerivation(derivation))
+	return buf.Bytes()
+}
+
+func serializeWitness(witness wire.TxWitness) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(witness))); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&buf, 0, item); err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeUnknowns(w io.Writer, unknowns []*Unknown) error {
+	for _, unknown := range unknowns {
+		if err := wire.WriteVarBytes(w, 0, unknown.Key); err != nil {
+			return errp.WithStack(err)
+		}
+		if err := wire.WriteVarBytes(w, 0, unknown.Value); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (input *Input) serialize(w io.Writer) error {
+	if input.NonWitnessUtxo != nil {
+		var buf bytes.Buffer
+		if err := input.NonWitnessUtxo.Serialize(&buf); err != nil {
+			return errp.WithStack(err)
+		}
+		if err := writeKeyValue(w, inputNonWitnessUtxo, nil, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if input.WitnessUtxo != nil {
+		var buf bytes.Buffer
+		if err := wire.WriteTxOut(&buf, 0, 0, input.WitnessUtxo); err != nil {
+			return errp.WithStack(err)
+		}
+		if err := writeKeyValue(w, inputWitnessUtxo, nil, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, partialSig := range input.PartialSigs {
+		if err := writeKeyValue(w, inputPartialSig, partialSig.PubKey, partialSig.Signature); err != nil {
+			return err
+		}
+	}
+	if input.SighashType != nil {
+		value := make([]byte, 4)
+		binary.LittleEndian.PutUint32(value, *input.SighashType)
+		if err := writeKeyValue(w, inputSighashType, nil, value); err != nil {
+			return err
+		}
+	}
+	if input.RedeemScript != nil {
+		if err := writeKeyValue(w, inputRedeemScript, nil, input.RedeemScript); err != nil {
+			return err
+		}
+	}
+	if input.WitnessScript != nil {
+		if err := writeKeyValue(w, inputWitnessScript, nil, input.WitnessScript); err != nil {
+			return err
+		}
+	}
+	for _, derivation := range input.Bip32Derivation {
+		if err := writeKeyValue(w, inputBip32Derivation, derivation.PubKey, serializeDerivation(derivation)); err != nil {
+			return err
+		}
+	}
+	if input.FinalScriptSig != nil {
+		if err := writeKeyValue(w, inputFinalScriptSig, nil, input.FinalScriptSig); err != nil {
+			return err
+		}
+	}
+	if input.FinalScriptWitness != nil {
+		witness, err := serializeWitness(input.FinalScriptWitness)
+		if err != nil {
+			return err
+		}
+		if err := writeKeyValue(w, inputFinalScriptWitness, nil, witness); err != nil {
+			return err
+		}
+	}
+	if input.TaprootKeySig != nil {
+		if err := writeKeyValue(w, inputTaprootKeySig, nil, input.TaprootKeySig); err != nil {
+			return err
+		}
+	}
+	for _, derivation := range input.TaprootBip32Derivation {
+		if err := writeKeyValue(w, inputTaprootBip32Derivation, derivation.PubKey, serializeTaprootDerivation(derivation)); err != nil {
+			return err
+		}
+	}
+	if input.TaprootInternalKey != nil {
+		if err := writeKeyValue(w, inputTaprootInternalKey, nil, input.TaprootInternalKey); err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, input.Unknowns); err != nil {
+		return err
+	}
+	return writeSeparator(w)
+}
+
+func (output *Output) serialize(w io.Writer) error {
+	if output.RedeemScript != nil {
+		if err := writeKeyValue(w, outputRedeemScript, nil, output.RedeemScript); err != nil {
+			return err
+		}
+	}
+	if output.WitnessScript != nil {
+		if err := writeKeyValue(w, outputWitnessScript, nil, output.WitnessScript); err != nil {
+			return err
+		}
+	}
+	for _, derivation := range output.Bip32Derivation {
+		if err := writeKeyValue(w, outputBip32Derivation, derivation.PubKey, serializeDerivation(derivation)); err != nil {
+			return err
+		}
+	}
+	if output.TaprootInternalKey != nil {
+		if err := writeKeyValue(w, outputTaprootInternalKey, nil, output.TaprootInternalKey); err != nil {
+			return err
+		}
+	}
+	for _, derivation := range output.TaprootBip32Derivation {
+		if err := writeKeyValue(w, outputTaprootBip32Derivation, derivation.PubKey, serializeTaprootDerivation(derivation)); err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, output.Unknowns); err != nil {
+		return err
+	}
+	return writeSeparator(w)
+}
+
+// Serialize writes the binary PSBT.
+func (packet *Packet) Serialize(w io.Writer) error {
+	if _, err := w.Write(magic); err != nil {
+		return errp.WithStack(err)
+	}
+	var txBuf bytes.Buffer
+	if err := packet.UnsignedTx.SerializeNoWitness(&txBuf); err != nil {
+		return errp.WithStack(err)
+	}
+	if err := writeKeyValue(w, globalUnsignedTx, nil, txBuf.Bytes()); err != nil {
+		return err
+	}
+	if err := writeUnknowns(w, packet.Unknowns); err != nil {
+		return err
+	}
+	if err := writeSeparator(w); err != nil {
+		return err
+	}
+	for _, input := range packet.Inputs {
+		if err := input.serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, output := range packet.Outputs {
+		if err := output.serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// B64Encode returns the base64 encoding of the PSBT, which is the usual way to exchange PSBTs.
+func (packet *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// readKeyValue reads the next key-value pair. A nil key means the separator was read.
+// readKeyValue reads the next key-value pair of a map. The key is nil at the end of the map. seen
+// collects the keys of the map read so far, as keys must be unique within a map.
+func readKeyValue(r io.Reader, seen map[string]struct{}) ([]byte, []byte, error) {
+	key, err := wire.ReadVarBytes(r, 0, maxPSBTSize, "key")
+	if err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	if len(key) == 0 {
+		return nil, nil, nil
+	}
+	if _, ok := seen[string(key)]; ok {
+		return nil, nil, errp.Newf("duplicate key %x", key)
+	}
+	seen[string(key)] = struct{}{}
+	value, err := wire.ReadVarBytes(r, 0, maxPSBTSize, "value")
+	if err != nil {
+		return nil, nil, errp.WithStack(err)
+	}
+	return key, value, nil
+}
+
+func parseDerivation(pubKey []byte, value []byte) (*Bip32Derivation, error) {
+	if len(value) < 4 || len(value)%4 != 0 {
+		return nil, errp.New("invalid bip32 derivation")
+	}
+	derivation := &Bip32Derivation{
+		PubKey:               pubKey,
+		MasterKeyFingerprint: value[:4],
+	}
+	for i := 4; i < len(value); i += 4 {
+		derivation.Path = append(derivation.Path, binary.LittleEndian.Uint32(value[i:i+4]))
+	}
+	return derivation, nil
+}
+
+func parseTaprootDerivation(pubKey []byte, value []byte) (*Bip32Derivation, error) {
+	if len(pubKey) != 32 {
+		return nil, errp.New("invalid taproot bip32 derivation key")
+	}
+	r := bytes.NewReader(value)
+	numLeafHashes, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if numLeafHashes > uint64(r.Len()/32) {
+		return nil, errp.New("invalid taproot bip32 derivation")
+	}
+	// We only do key path spends, so we skip the leaf hashes.
+	if _, err := r.Seek(int64(numLeafHashes*32), io.SeekCurrent); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return parseDerivation(pubKey, rest)
+}
+
+func parseWitness(value []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(value)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if count > uint64(len(value)) {
+		return nil, errp.New("invalid witness")
+	}
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, maxPSBTSize, "witness item")
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+	return witness, nil
+}
+
+func parseTxOut(value []byte) (*wire.TxOut, error) {
+	r := bytes.NewReader(value)
+	var amount int64
+	if err := binary.Read(r, binary.LittleEndian, &amount); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	pkScript, err := wire.ReadVarBytes(r, 0, maxPSBTSize, "pkScript")
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return wire.NewTxOut(amount, pkScript), nil
+}
+
+func parseInput(r io.Reader) (*Input, error) {
+	input := &Input{}
+	seen := map[string]struct{}{}
+	for {
+		key, value, err := readKeyValue(r, seen)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return input, nil
+		}
+		keyData := key[1:]
+		switch key[0] {
+		case inputNonWitnessUtxo:
+			tx := &wire.MsgTx{}
+			if err := tx.Deserialize(bytes.NewReader(value)); err != nil {
+				return nil, errp.WithStack(err)
+			}
+			input.NonWitnessUtxo = tx
+		case inputWitnessUtxo:
+			txOut, err := parseTxOut(value)
+			if err != nil {
+				return nil, err
+			}
+			input.WitnessUtxo = txOut
+		case inputPartialSig:
+			input.PartialSigs = append(input.PartialSigs, &PartialSig{PubKey: keyData, Signature: value})
+		case inputSighashType:
+			if len(value) != 4 {
+				return nil, errp.New("invalid sighash type")
+			}
+			sighashType := binary.LittleEndian.Uint32(value)
+			input.SighashType = &sighashType
+		case inputRedeemScript:
+			input.RedeemScript = value
+		case inputWitnessScript:
+			input.WitnessScript = value
+		case inputBip32Derivation:
+			derivation, err := parseDerivation(keyData, value)
+			if err != nil {
+				return nil, err
+			}
+			input.Bip32Derivation = append(input.Bip32Derivation, derivation)
+		case inputFinalScriptSig:
+			input.FinalScriptSig = value
+		case inputFinalScriptWitness:
+			witness, err := parseWitness(value)
+			if err != nil {
+				return nil, err
+			}
+			input.FinalScriptWitness = witness
+		case inputTaprootKeySig:
+			input.TaprootKeySig = value
+		case inputTaprootBip32Derivation:
+			derivation, err := parseTaprootDerivation(keyData, value)
+			if err != nil {
+				return nil, err
+			}
+			input.TaprootBip32Derivation = append(input.TaprootBip32Derivation, derivation)
+		case inputTaprootInternalKey:
+			input.TaprootInternalKey = value
+		default:
+			input.Unknowns = append(input.Unknowns, &Unknown{Key: key, Value: value})
+		}
+	}
+}
+
+func parseOutput(r io.Reader) (*Output, error) {
+	output := &Output{}
+	seen := map[string]struct{}{}
+	for {
+		key, value, err := readKeyValue(r, seen)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			return output, nil
+		}
+		keyData := key[1:]
+		switch key[0] {
+		case outputRedeemScript:
+			output.RedeemScript = value
+		case outputWitnessScript:
+			output.WitnessScript = value
+		case outputBip32Derivation:
+			derivation, err := parseDerivation(keyData, value)
+			if err != nil {
+				return nil, err
+			}
+			output.Bip32Derivation = append(output.Bip32Derivation, derivation)
+		case outputTaprootInternalKey:
+			output.TaprootInternalKey = value
+		case outputTaprootBip32Derivation:
+			derivation, err := parseTaprootDerivation(keyData, value)
+			if err != nil {
+				return nil, err
+			}
+			output.TaprootBip32Derivation = append(output.TaprootBip32Derivation, derivation)
+		default:
+			output.Unknowns = append(output.Unknowns, &Unknown{Key: key, Value: value})
+		}
+	}
+}
+
+// Parse reads a binary PSBT.
+func Parse(r io.Reader) (*Packet, error) {
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if !bytes.Equal(header, magic) {
+		return nil, errp.New("invalid PSBT magic")
+	}
+	packet := &Packet{}
+	seen := map[string]struct{}{}
+	for {
+		key, value, err := readKeyValue(r, seen)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			break
+		}
+		if key[0] == globalUnsignedTx && len(key) == 1 {
+			tx := &wire.MsgTx{}
+			if err := tx.DeserializeNoWitness(bytes.NewReader(value)); err != nil {
+				return nil, errp.WithStack(err)
+			}
+			packet.UnsignedTx = tx
+			continue
+		}
+		packet.Unknowns = append(packet.Unknowns, &Unknown{Key: key, Value: value})
+	}
+	if packet.UnsignedTx == nil {
+		return nil, errp.New("PSBT is missing the unsigned transaction")
+	}
+	for _, txIn := range packet.UnsignedTx.TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			return nil, errp.New("the unsigned transaction must not contain signatures")
+		}
+	}
+	for range packet.UnsignedTx.TxIn {
+		input, err := parseInput(r)
+		if err != nil {
+			return nil, err
+		}
+		packet.Inputs = append(packet.Inputs, input)
+	}
+	for range packet.UnsignedTx.TxOut {
+		output, err := parseOutput(r)
+		if err != nil {
+			return nil, err
+		}
+		packet.Outputs = append(packet.Outputs, output)
+	}
+	return packet, nil
+}
+
+// NewFromBase64 parses a base64 encoded PSBT.
+func NewFromBase64(encoded string) (*Packet, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return Parse(bytes.NewReader(decoded))
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psbt_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/psbt"
+	"github.com/stretchr/testify/require"
+)
+
+// Valid PSBT with one P2PKH input with a non-witness utxo, from the BIP174 test vectors.
+const bip174Vector = "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+
+func TestParseBIP174Vector(t *testing.T) {
+	packet, err := psbt.NewFromBase64(bip174Vector)
+	require.NoError(t, err)
+	require.Len(t, packet.Inputs, 1)
+	require.Len(t, packet.Outputs, 2)
+	require.NotNil(t, packet.Inputs[0].NonWitnessUtxo)
+	prevOut, err := packet.PrevOut(0)
+	require.NoError(t, err)
+	require.Equal(t, int64(200000000), prevOut.Value)
+	require.False(t, packet.IsComplete())
+
+	encoded, err := packet.B64Encode()
+	require.NoError(t, err)
+	require.Equal(t, bip174Vector, encoded)
+}
+
+func TestRoundtrip(t *testing.T) {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 2}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x00, 0x14, 1, 2, 3}))
+
+	packet, err := psbt.New(tx)
+	require.NoError(t, err)
+	sighashAll := uint32(1)
+	packet.Inputs[0] = &psbt.Input{
+		WitnessUtxo: wire.NewTxOut(2000, []byte{0x00, 0x14, 4, 5, 6}),
+		SighashType: &sighashAll,
+		Bip32Derivation: []*psbt.Bip32Derivation{{
+			PubKey:               make([]byte, 33),
+			MasterKeyFingerprint: []byte{1, 2, 3, 4},
+			Path:                 []uint32{84 + 0x80000000, 0x80000000, 0x80000000, 0, 5},
+		}},
+		PartialSigs: []*psbt.PartialSig{{PubKey: make([]byte, 33), Signature: []byte{0x30, 0x01}}},
+	}
+	packet.Inputs[1] = &psbt.Input{
+		WitnessUtxo:        wire.NewTxOut(3000, []byte{0x51, 0x20, 7, 8, 9}),
+		TaprootInternalKey: make([]byte, 32),
+		TaprootBip32Derivation: []*psbt.Bip32Derivation{{
+			PubKey:               make([]byte, 32),
+			MasterKeyFingerprint: []byte{1, 2, 3, 4},
+			Path:                 []uint32{86 + 0x80000000, 0x80000000, 0x80000000, 1, 0},
+		}},
+		TaprootKeySig: make([]byte, 64),
+		Unknowns:      []*psbt.Unknown{{Key: []byte{0xfc, 1}, Value: []byte{2}}},
+	}
+	packet.Outputs[0].Bip32Derivation = []*psbt.Bip32Derivation{{
+		PubKey:               make([]byte, 33),
+		MasterKeyFingerprint: []byte{1, 2, 3, 4},
+		Path:                 []uint32{1, 2},
+	}}
+
+	encoded, err := packet.B64Encode()
+	require.NoError(t, err)
+	decoded, err := psbt.NewFromBase64(encoded)
+	require.NoError(t, err)
+	require.Equal(t, packet.Inputs, decoded.Inputs)
+	require.Equal(t, packet.Outputs, decoded.Outputs)
+	require.Equal(t, tx.TxHash(), decoded.UnsignedTx.TxHash())
+
+	_, err = decoded.Extract()
+	require.Error(t, err)
+	decoded.Inputs[0].FinalScriptWitness = wire.TxWitness{{1}, {2}}
+	decoded.Inputs[1].FinalScriptWitness = wire.TxWitness{make([]byte, 64)}
+	require.True(t, decoded.IsComplete())
+	finalTx, err := decoded.Extract()
+	require.NoError(t, err)
+	require.Equal(t, wire.TxWitness{{1}, {2}}, finalTx.TxIn[0].Witness)
+	require.Equal(t, tx.TxHash(), finalTx.TxHash())
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := psbt.NewFromBase64("not base64")
+	require.Error(t, err)
+	_, err = psbt.NewFromBase64("cHNidP8=")
+	require.Error(t, err)
+}
+
+func TestParseDuplicateKey(t *testing.T) {
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x00, 0x14, 1, 2, 3}))
+
+	packet, err := psbt.New(tx)
+	require.NoError(t, err)
+	packet.Inputs[0].Unknowns = []*psbt.Unknown{{Key: []byte{0xfc, 1}, Value: []byte{1}}}
+	encoded, err := packet.B64Encode()
+	require.NoError(t, err)
+	_, err = psbt.NewFromBase64(encoded)
+	require.NoError(t, err)
+
+	// BIP174 requires keys to be unique within a map.
+	packet.Inputs[0].Unknowns = append(packet.Inputs[0].Unknowns,
+		&psbt.Unknown{Key: []byte{0xfc, 1}, Value: []byte{2}})
+	encoded, err = packet.B64Encode()
+	require.NoError(t, err)
+	_, err = psbt.NewFromBase64(encoded)
+	require.Error(t, err)
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPSBTDerivations(t *testing.T) {
+	log := logging.Get().WithGroup("psbt_test")
+	root, err := hdkeychain.NewKeyFromString(testXpub)
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/0'/0'")
+	require.NoError(t, err)
+	// A non-hardened child, as the xpub has no private key.
+	xpub, err := signing.NewEmptyRelativeKeypath().Child(1, signing.NonHardened).Derive(root)
+	require.NoError(t, err)
+	relativeKeypath := signing.NewEmptyRelativeKeypath().
+		Child(0, signing.NonHardened).
+		Child(5, signing.NonHardened)
+	fingerprint := []byte{1, 2, 3, 4}
+
+	// The keypath does not match the depth of the key, so its origin is unknown.
+	configuration := signing.NewBitcoinConfiguration(
+		signing.ScriptTypeP2WPKH, fingerprint, keypath, xpub)
+	address := addresses.NewAccountAddress(configuration, relativeKeypath, &chaincfg.MainNetParams, log)
+	require.Nil(t, psbtDerivations(address, []byte{2}))
+
+	// Root key.
+	configuration = signing.NewBitcoinConfiguration(
+		signing.ScriptTypeP2WPKH, fingerprint, signing.NewEmptyAbsoluteKeypath(), root)
+	address = addresses.NewAccountAddress(configuration, relativeKeypath, &chaincfg.MainNetParams, log)
+	derivations := psbtDerivations(address, []byte{2})
+	require.Len(t, derivations, 1)
+	require.Equal(t, fingerprint, derivations[0].MasterKeyFingerprint)
+	require.Equal(t, []uint32{0, 5}, derivations[0].Path)
+	require.Equal(t, []byte{2}, derivations[0].PubKey)
+
+	// Only cosigners with a known key origin are included.
+	multisig := signing.NewBitcoinMultisigConfiguration(1, signing.ScriptTypeP2WSH, []signing.KeyInfo{
+		{RootFingerprint: fingerprint, AbsoluteKeypath: signing.NewEmptyAbsoluteKeypath(), ExtendedPublicKey: root},
+		{RootFingerprint: fingerprint, AbsoluteKeypath: keypath, ExtendedPublicKey: xpub},
+	})
+	address = addresses.NewAccountAddress(multisig, relativeKeypath, &chaincfg.MainNetParams, log)
+	derivations = psbtMultisigDerivations(address)
+	require.Len(t, derivations, 1)
+	require.Equal(t, []uint32{0, 5}, derivations[0].Path)
+}
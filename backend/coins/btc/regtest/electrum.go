@@ -0,0 +1,552 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	electrumPollInterval = 100 * time.Millisecond
+	// maxHeadersPerBatch is the maximum number of headers returned by blockchain.block.headers, the
+	// same as for ElectrumX.
+	maxHeadersPerBatch = 2016
+)
+
+// chainIndex is the state of the node served by ElectrumServer.
+type chainIndex struct {
+	bestBlockHash chainhash.Hash
+	// mempool contains the sorted IDs of the transactions in the mempool.
+	mempool []string
+	headers []*wire.BlockHeader
+	// blockTxs contains the transaction hashes of each block, to compute merkle proofs.
+	blockTxs  [][]chainhash.Hash
+	histories map[blockchain.ScriptHashHex]blockchain.TxHistory
+}
+
+func (index *chainIndex) tip() map[string]interface{} {
+	height := len(index.headers) - 1
+	return map[string]interface{}{
+		"height": height,
+		"hex":    serializeHeaders(index.headers[height:]),
+	}
+}
+
+func serializeHeaders(headers []*wire.BlockHeader) string {
+	var buf bytes.Buffer
+	for _, header := range headers {
+		if err := header.Serialize(&buf); err != nil {
+			panic(errp.WithStack(err))
+		}
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// statusResult is the response of blockchain.scripthash.subscribe for the given status, which is
+// null if the history is empty.
+func statusResult(status string) interface{} {
+	if status == "" {
+		return nil
+	}
+	return status
+}
+
+type electrumConnection struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+
+	// The fields below are accessed with the lock of the server.
+	headersSubscribed bool
+	// statuses contains the last status sent for each subscribed script hash.
+	statuses map[blockchain.ScriptHashHex]string
+}
+
+func (connection *electrumConnection) write(message interface{}) error {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	connection.writeLock.Lock()
+	defer connection.writeLock.Unlock()
+	_, err = connection.conn.Write(append(messageBytes, '\n'))
+	return errp.WithStack(err)
+}
+
+func (connection *electrumConnection) notify(method string, params ...interface{}) error {
+	return connection.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+// ElectrumServer is a minimal Electrum server (protocol version 1.4) for the chain and mempool of a
+// Node, standing in for ElectrumX or electrs in tests. The node is polled for changes, in which case
+// the whole chain is indexed again, which is fine for the small chains of tests. Subscribers are
+// notified of new tips and of changes of the history of their script hashes, including reorgs.
+type ElectrumServer struct {
+	node     *Node
+	listener net.Listener
+	// blocks caches the blocks fetched from the node. Only accessed by update().
+	blocks map[chainhash.Hash]*wire.MsgBlock
+
+	lock        locker.Locker
+	index       *chainIndex
+	connections map[*electrumConnection]struct{}
+	closed      bool
+
+	quitChan chan struct{}
+
+	log *logrus.Entry
+}
+
+// NewElectrumServer indexes the chain of the node and starts serving it on a free local port, see
+// Address().
+func NewElectrumServer(node *Node, log *logrus.Entry) (*ElectrumServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	server := &ElectrumServer{
+		node:        node,
+		listener:    listener,
+		blocks:      map[chainhash.Hash]*wire.MsgBlock{},
+		connections: map[*electrumConnection]struct{}{},
+		quitChan:    make(chan struct{}),
+		log:         log.WithField("group", "regtest-electrum"),
+	}
+	if err := server.update(); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	go server.accept()
+	go server.poll()
+	return server, nil
+}
+
+// Address returns the host:port the server is listening on, without TLS.
+func (server *ElectrumServer) Address() string {
+	return server.listener.Addr().String()
+}
+
+// Close stops the server and closes all connections.
+func (server *ElectrumServer) Close() {
+	defer server.lock.Lock()()
+	if server.closed {
+		return
+	}
+	server.closed = true
+	close(server.quitChan)
+	_ = server.listener.Close()
+	for connection := range server.connections {
+		_ = connection.conn.Close()
+	}
+}
+
+func (server *ElectrumServer) poll() {
+	ticker := time.NewTicker(electrumPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-server.quitChan:
+			return
+		case <-ticker.C:
+			if err := server.update(); err != nil {
+				server.log.WithError(err).Error("Could not update the index")
+			}
+		}
+	}
+}
+
+func (server *ElectrumServer) block(blockHash chainhash.Hash) (*wire.MsgBlock, error) {
+	if block, ok := server.blocks[blockHash]; ok {
+		return block, nil
+	}
+	var blockHex string
+	if err := server.node.Call(&blockHex, "getblock", blockHash.String(), 0); err != nil {
+		return nil, err
+	}
+	blockBytes, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	block := &wire.MsgBlock{}
+	if err := block.Deserialize(bytes.NewReader(blockBytes)); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	server.blocks[blockHash] = block
+	return block, nil
+}
+
+func (server *ElectrumServer) transaction(txID string) (*wire.MsgTx, error) {
+	var txHex string
+	if err := server.node.Call(&txHex, "getrawtransaction", txID); err != nil {
+		return nil, err
+	}
+	txBytes, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	tx := &wire.MsgTx{}
+	if err := tx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return tx, nil
+}
+
+// buildIndex indexes the chain ending in the given best block and the given mempool transactions.
+func (server *ElectrumServer) buildIndex(bestBlockHash chainhash.Hash, mempool []string) (*chainIndex, error) {
+	var blocks []*wire.MsgBlock
+	for blockHash := bestBlockHash; ; {
+		block, err := server.block(blockHash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+		if block.Header.PrevBlock == (chainhash.Hash{}) {
+			break
+		}
+		blockHash = block.Header.PrevBlock
+	}
+	mempoolTxs := make([]*wire.MsgTx, len(mempool))
+	mempoolTxHashes := map[chainhash.Hash]struct{}{}
+	for i, txID := range mempool {
+		tx, err := server.transaction(txID)
+		if err != nil {
+			return nil, err
+		}
+		mempoolTxs[i] = tx
+		mempoolTxHashes[tx.TxHash()] = struct{}{}
+	}
+
+	index := &chainIndex{
+		bestBlockHash: bestBlockHash,
+		mempool:       mempool,
+		headers:       make([]*wire.BlockHeader, len(blocks)),
+		blockTxs:      make([][]chainhash.Hash, len(blocks)),
+		histories:     map[blockchain.ScriptHashHex]blockchain.TxHistory{},
+	}
+	// outputs contains all outputs by outpoint, to look up the scripts spent by inputs.
+	outputs := map[wire.OutPoint]*wire.TxOut{}
+	addOutputs := func(tx *wire.MsgTx) {
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			outputs[*wire.NewOutPoint(&txHash, uint32(i))] = txOut
+		}
+	}
+	addHistory := func(tx *wire.MsgTx, height int) {
+		scriptHashes := map[blockchain.ScriptHashHex]struct{}{}
+		for _, txOut := range tx.TxOut {
+			scriptHashes[blockchain.NewScriptHashHex(txOut.PkScript)] = struct{}{}
+		}
+		for _, txIn := range tx.TxIn {
+			if spent, ok := outputs[txIn.PreviousOutPoint]; ok {
+				scriptHashes[blockchain.NewScriptHashHex(spent.PkScript)] = struct{}{}
+			}
+		}
+		txInfo := &blockchain.TxInfo{Height: height, TXHash: blockchain.TXHash(tx.TxHash())}
+		for scriptHash := range scriptHashes {
+			index.histories[scriptHash] = append(index.histories[scriptHash], txInfo)
+		}
+	}
+	for height := range blocks {
+		block := blocks[len(blocks)-1-height]
+		index.headers[height] = &block.Header
+		txHashes := make([]chainhash.Hash, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txHashes[i] = tx.TxHash()
+			addOutputs(tx)
+			addHistory(tx, height)
+		}
+		index.blockTxs[height] = txHashes
+	}
+	for _, tx := range mempoolTxs {
+		addOutputs(tx)
+	}
+	for _, tx := range mempoolTxs {
+		height := 0
+		for _, txIn := range tx.TxIn {
+			if _, ok := mempoolTxHashes[txIn.PreviousOutPoint.Hash]; ok {
+				// Unconfirmed parent.
+				height = -1
+			}
+		}
+		addHistory(tx, height)
+	}
+	for _, history := range index.histories {
+		history.Sort()
+	}
+	return index, nil
+}
+
+// update indexes the chain again if the best block or the mempool of the node changed, and
+// notifies the subscribers.
+func (server *ElectrumServer) update() error {
+	bestBlockHashStr, err := server.node.BestBlockHash()
+	if err != nil {
+		return err
+	}
+	bestBlockHash, err := chainhash.NewHashFromStr(bestBlockHashStr)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	mempool, err := server.node.Mempool()
+	if err != nil {
+		return err
+	}
+	sort.Strings(mempool)
+	unlock := server.lock.RLock()
+	previous := server.index
+	unlock()
+	if previous != nil && previous.bestBlockHash == *bestBlockHash &&
+		strings.Join(previous.mempool, ",") == strings.Join(mempool, ",") {
+		return nil
+	}
+	index, err := server.buildIndex(*bestBlockHash, mempool)
+	if err != nil {
+		return err
+	}
+
+	defer server.lock.Lock()()
+	server.index = index
+	tipChanged := previous == nil || previous.bestBlockHash != index.bestBlockHash
+	for connection := range server.connections {
+		if tipChanged && connection.headersSubscribed {
+			if err := connection.notify("blockchain.headers.subscribe", index.tip()); err != nil {
+				server.log.WithError(err).Error("Could not notify a new tip")
+			}
+		}
+		for scriptHash, status := range connection.statuses {
+			newStatus := index.histories[scriptHash].Status()
+			if newStatus == status {
+				continue
+			}
+			connection.statuses[scriptHash] = newStatus
+			if err := connection.notify(
+				"blockchain.scripthash.subscribe", scriptHash, statusResult(newStatus)); err != nil {
+				server.log.WithError(err).Error("Could not notify a script hash status")
+			}
+		}
+	}
+	return nil
+}
+
+func (server *ElectrumServer) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			select {
+			case <-server.quitChan:
+			default:
+				server.log.WithError(err).Error("Could not accept a connection")
+			}
+			return
+		}
+		connection := &electrumConnection{
+			conn:     conn,
+			statuses: map[blockchain.ScriptHashHex]string{},
+		}
+		unlock := server.lock.Lock()
+		server.connections[connection] = struct{}{}
+		unlock()
+		go server.serve(connection)
+	}
+}
+
+func (server *ElectrumServer) serve(connection *electrumConnection) {
+	defer func() {
+		defer server.lock.Lock()()
+		delete(server.connections, connection)
+		_ = connection.conn.Close()
+	}()
+	reader := bufio.NewReader(connection.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var request struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(line, &request); err != nil {
+			server.log.WithError(err).Error("Invalid request")
+			return
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		result, err := server.handle(connection, request.Method, request.Params)
+		if err != nil {
+			response["error"] = map[string]interface{}{"code": 1, "message": err.Error()}
+		} else {
+			response["result"] = result
+		}
+		if err := connection.write(response); err != nil {
+			return
+		}
+	}
+}
+
+func parseParams(params []json.RawMessage, targets ...interface{}) error {
+	if len(params) < len(targets) {
+		return errp.Newf("expected %d params, got %d", len(targets), len(params))
+	}
+	for i, target := range targets {
+		if err := json.Unmarshal(params[i], target); err != nil {
+			return errp.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (server *ElectrumServer) handle(
+	connection *electrumConnection, method string, params []json.RawMessage) (interface{}, error) {
+	switch method {
+	case "server.version":
+		return []string{"regtest-electrum", "1.4"}, nil
+	case "server.ping":
+		return nil, nil
+	case "blockchain.headers.subscribe":
+		defer server.lock.Lock()()
+		connection.headersSubscribed = true
+		return server.index.tip(), nil
+	case "blockchain.block.headers":
+		var startHeight, count int
+		if err := parseParams(params, &startHeight, &count); err != nil {
+			return nil, err
+		}
+		defer server.lock.RLock()()
+		headers := server.index.headers
+		if startHeight < 0 || startHeight > len(headers) {
+			return nil, errp.Newf("invalid start height %d", startHeight)
+		}
+		if count > maxHeadersPerBatch {
+			count = maxHeadersPerBatch
+		}
+		if count > len(headers)-startHeight {
+			count = len(headers) - startHeight
+		}
+		return map[string]interface{}{
+			"count": count,
+			"hex":   serializeHeaders(headers[startHeight : startHeight+count]),
+			"max":   maxHeadersPerBatch,
+		}, nil
+	case "blockchain.scripthash.subscribe":
+		var scriptHash blockchain.ScriptHashHex
+		if err := parseParams(params, &scriptHash); err != nil {
+			return nil, err
+		}
+		defer server.lock.Lock()()
+		status := server.index.histories[scriptHash].Status()
+		connection.statuses[scriptHash] = status
+		return statusResult(status), nil
+	case "blockchain.scripthash.get_history":
+		var scriptHash blockchain.ScriptHashHex
+		if err := parseParams(params, &scriptHash); err != nil {
+			return nil, err
+		}
+		defer server.lock.RLock()()
+		history := server.index.histories[scriptHash]
+		if history == nil {
+			history = blockchain.TxHistory{}
+		}
+		return history, nil
+	case "blockchain.transaction.get":
+		var txID string
+		if err := parseParams(params, &txID); err != nil {
+			return nil, err
+		}
+		var txHex string
+		if err := server.node.Call(&txHex, "getrawtransaction", txID); err != nil {
+			return nil, err
+		}
+		return txHex, nil
+	case "blockchain.transaction.get_merkle":
+		var txID string
+		var height int
+		if err := parseParams(params, &txID, &height); err != nil {
+			return nil, err
+		}
+		txHash, err := chainhash.NewHashFromStr(txID)
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		defer server.lock.RLock()()
+		if height < 0 || height >= len(server.index.blockTxs) {
+			return nil, errp.Newf("invalid height %d", height)
+		}
+		txHashes := server.index.blockTxs[height]
+		for pos := range txHashes {
+			if txHashes[pos] == *txHash {
+				return map[string]interface{}{
+					"block_height": height,
+					"merkle":       blockchain.MerkleBranch(txHashes, pos),
+					"pos":          pos,
+				}, nil
+			}
+		}
+		return nil, errp.Newf("transaction %s not found in block %d", txID, height)
+	case "blockchain.transaction.broadcast":
+		var txHex string
+		if err := parseParams(params, &txHex); err != nil {
+			return nil, err
+		}
+		var txID string
+		if err := server.node.Call(&txID, "sendrawtransaction", txHex); err != nil {
+			return nil, err
+		}
+		return txID, nil
+	case "blockchain.relayfee":
+		var networkInfo struct {
+			RelayFee float64 `json:"relayfee"`
+		}
+		if err := server.node.Call(&networkInfo, "getnetworkinfo"); err != nil {
+			return nil, err
+		}
+		return networkInfo.RelayFee, nil
+	case "blockchain.estimatefee":
+		var blocks int
+		if err := parseParams(params, &blocks); err != nil {
+			return nil, err
+		}
+		var estimate struct {
+			FeeRate *float64 `json:"feerate"`
+		}
+		if err := server.node.Call(&estimate, "estimatesmartfee", blocks); err != nil {
+			return nil, err
+		}
+		if estimate.FeeRate == nil {
+			return -1, nil
+		}
+		return *estimate.FeeRate, nil
+	default:
+		return nil, errp.Newf("unsupported method %s", method)
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode answers the RPC calls made by ElectrumServer from an in-memory chain.
+type fakeNode struct {
+	lock    sync.Mutex
+	chain   []*wire.MsgBlock
+	mempool []*wire.MsgTx
+}
+
+func (node *fakeNode) result(method string, params []json.RawMessage) (interface{}, bool) {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	serialize := func(serialize func(*bytes.Buffer) error) string {
+		var buf bytes.Buffer
+		if err := serialize(&buf); err != nil {
+			panic(err)
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+	switch method {
+	case "getbestblockhash":
+		return node.chain[len(node.chain)-1].BlockHash().String(), true
+	case "getrawmempool":
+		txIDs := []string{}
+		for _, tx := range node.mempool {
+			txIDs = append(txIDs, tx.TxHash().String())
+		}
+		return txIDs, true
+	case "getblock":
+		var blockHash string
+		if err := json.Unmarshal(params[0], &blockHash); err != nil {
+			panic(err)
+		}
+		for _, block := range node.chain {
+			if block.BlockHash().String() == blockHash {
+				return serialize(func(buf *bytes.Buffer) error { return block.Serialize(buf) }), true
+			}
+		}
+	case "getrawtransaction":
+		var txID string
+		if err := json.Unmarshal(params[0], &txID); err != nil {
+			panic(err)
+		}
+		txs := append([]*wire.MsgTx{}, node.mempool...)
+		for _, block := range node.chain {
+			txs = append(txs, block.Transactions...)
+		}
+		for _, tx := range txs {
+			if tx.TxHash().String() == txID {
+				return serialize(func(buf *bytes.Buffer) error { return tx.Serialize(buf) }), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (node *fakeNode) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	var rpcRequest struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&rpcRequest); err != nil {
+		panic(err)
+	}
+	response := map[string]interface{}{}
+	if result, ok := node.result(rpcRequest.Method, rpcRequest.Params); ok {
+		response["result"] = result
+	} else {
+		response["error"] = map[string]interface{}{"code": -5, "message": "not found"}
+	}
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+func (node *fakeNode) addBlock(txs ...*wire.MsgTx) *wire.MsgBlock {
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	block := wire.NewMsgBlock(&wire.BlockHeader{
+		PrevBlock: node.chain[len(node.chain)-1].BlockHash(),
+		Timestamp: time.Unix(int64(1600000000+len(node.chain)), 0),
+		Nonce:     uint32(len(node.chain)),
+	})
+	for _, tx := range txs {
+		if err := block.AddTransaction(tx); err != nil {
+			panic(err)
+		}
+	}
+	node.chain = append(node.chain, block)
+	return block
+}
+
+func newTx(prevOut wire.OutPoint, pkScript []byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+	return tx
+}
+
+// electrumTestClient sends requests to the server and collects the responses and notifications.
+type electrumTestClient struct {
+	t             *testing.T
+	conn          net.Conn
+	nextID        int
+	responses     chan json.RawMessage
+	notifications chan json.RawMessage
+}
+
+func newElectrumTestClient(t *testing.T, address string) *electrumTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	client := &electrumTestClient{
+		t:             t,
+		conn:          conn,
+		responses:     make(chan json.RawMessage, 10),
+		notifications: make(chan json.RawMessage, 10),
+	}
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var message struct {
+				Method string `json:"method"`
+			}
+			if err := json.Unmarshal(line, &message); err != nil {
+				panic(err)
+			}
+			if message.Method != "" {
+				client.notifications <- line
+			} else {
+				client.responses <- line
+			}
+		}
+	}()
+	return client
+}
+
+func (client *electrumTestClient) call(result interface{}, method string, params ...interface{}) error {
+	client.t.Helper()
+	if params == nil {
+		params = []interface{}{}
+	}
+	request, err := json.Marshal(map[string]interface{}{
+		"id": client.nextID, "method": method, "params": params})
+	require.NoError(client.t, err)
+	client.nextID++
+	_, err = client.conn.Write(append(request, '\n'))
+	require.NoError(client.t, err)
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	select {
+	case line := <-client.responses:
+		require.NoError(client.t, json.Unmarshal(line, &response))
+	case <-time.After(5 * time.Second):
+		require.FailNow(client.t, "no response")
+	}
+	if response.Error != nil {
+		return &rpcCallError{response.Error.Message}
+	}
+	if result != nil {
+		require.NoError(client.t, json.Unmarshal(response.Result, result))
+	}
+	return nil
+}
+
+func (client *electrumTestClient) notification(method string, params interface{}) {
+	client.t.Helper()
+	var notification struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	select {
+	case line := <-client.notifications:
+		require.NoError(client.t, json.Unmarshal(line, &notification))
+	case <-time.After(5 * time.Second):
+		require.FailNow(client.t, "no notification")
+	}
+	require.Equal(client.t, method, notification.Method)
+	require.NoError(client.t, json.Unmarshal(notification.Params, params))
+}
+
+type rpcCallError struct{ message string }
+
+func (err *rpcCallError) Error() string { return err.message }
+
+func TestElectrumServer(t *testing.T) {
+	scriptA := []byte{0x51}
+	scriptB := []byte{0x52}
+	genesis := chaincfg.RegressionNetParams.GenesisBlock
+	node := &fakeNode{chain: []*wire.MsgBlock{genesis}}
+	coinbase := newTx(*wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), scriptA)
+	block1 := node.addBlock(coinbase)
+	coinbaseHash := coinbase.TxHash()
+	tx1 := newTx(*wire.NewOutPoint(&coinbaseHash, 0), scriptB)
+	tx1Hash := tx1.TxHash()
+	tx2 := newTx(*wire.NewOutPoint(&tx1Hash, 0), scriptB)
+	node.mempool = []*wire.MsgTx{tx1, tx2}
+
+	httpServer := httptest.NewServer(node)
+	defer httpServer.Close()
+	log := logging.Get().WithGroup("electrum_test")
+	server, err := NewElectrumServer(
+		&Node{rpcURL: httpServer.URL, httpClient: httpServer.Client(), log: log}, log)
+	require.NoError(t, err)
+	defer server.Close()
+	client := newElectrumTestClient(t, server.Address())
+
+	var version []string
+	require.NoError(t, client.call(&version, "server.version", "test", "1.4"))
+	require.Equal(t, "1.4", version[1])
+	require.NoError(t, client.call(nil, "server.ping"))
+	require.Error(t, client.call(nil, "blockchain.scripthash.get_balance", "00"))
+
+	type tip struct {
+		Height int    `json:"height"`
+		Hex    string `json:"hex"`
+	}
+	var header tip
+	require.NoError(t, client.call(&header, "blockchain.headers.subscribe"))
+	require.Equal(t, tip{Height: 1, Hex: serializeHeaders([]*wire.BlockHeader{&block1.Header})}, header)
+
+	var headers struct {
+		Count int    `json:"count"`
+		Hex   string `json:"hex"`
+		Max   int    `json:"max"`
+	}
+	require.NoError(t, client.call(&headers, "blockchain.block.headers", 0, 10))
+	require.Equal(t, 2, headers.Count)
+	require.Equal(t, serializeHeaders([]*wire.BlockHeader{&genesis.Header, &block1.Header}), headers.Hex)
+	require.Equal(t, maxHeadersPerBatch, headers.Max)
+
+	// scriptA received the coinbase and spent it in tx1.
+	scriptHashA := blockchain.NewScriptHashHex(scriptA)
+	historyA := blockchain.TxHistory{
+		{Height: 1, TXHash: blockchain.TXHash(coinbaseHash)},
+		{Height: 0, TXHash: blockchain.TXHash(tx1Hash)},
+	}
+	var status *string
+	require.NoError(t, client.call(&status, "blockchain.scripthash.subscribe", scriptHashA))
+	require.Equal(t, historyA.Status(), *status)
+	var history blockchain.TxHistory
+	require.NoError(t, client.call(&history, "blockchain.scripthash.get_history", scriptHashA))
+	require.Equal(t, historyA, history)
+
+	// tx2 has an unconfirmed parent.
+	scriptHashB := blockchain.NewScriptHashHex(scriptB)
+	require.NoError(t, client.call(&history, "blockchain.scripthash.get_history", scriptHashB))
+	require.Equal(t, blockchain.TxHistory{
+		{Height: 0, TXHash: blockchain.TXHash(tx1Hash)},
+		{Height: -1, TXHash: blockchain.TXHash(tx2.TxHash())},
+	}, history)
+
+	require.NoError(t, client.call(&status, "blockchain.scripthash.subscribe", "00"))
+	require.Nil(t, status)
+
+	var txHex string
+	require.NoError(t, client.call(&txHex, "blockchain.transaction.get", tx1Hash.String()))
+	var txBuf bytes.Buffer
+	require.NoError(t, tx1.Serialize(&txBuf))
+	require.Equal(t, hex.EncodeToString(txBuf.Bytes()), txHex)
+
+	// Mining tx1 notifies the new tip and the new status of scriptA.
+	block2 := node.addBlock(newTx(*wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), scriptB), tx1)
+	node.lock.Lock()
+	node.mempool = []*wire.MsgTx{tx2}
+	node.lock.Unlock()
+	var tips []tip
+	client.notification("blockchain.headers.subscribe", &tips)
+	require.Equal(t, []tip{{Height: 2, Hex: serializeHeaders([]*wire.BlockHeader{&block2.Header})}}, tips)
+	var statusNotification []string
+	client.notification("blockchain.scripthash.subscribe", &statusNotification)
+	historyA[1].Height = 2
+	require.Equal(t, []string{string(scriptHashA), historyA.Status()}, statusNotification)
+
+	var merkle struct {
+		BlockHeight int                 `json:"block_height"`
+		Merkle      []blockchain.TXHash `json:"merkle"`
+		Pos         int                 `json:"pos"`
+	}
+	require.NoError(t, client.call(&merkle, "blockchain.transaction.get_merkle", tx1Hash.String(), 2))
+	require.Equal(t, 2, merkle.BlockHeight)
+	require.Equal(t, 1, merkle.Pos)
+	require.Equal(t, []blockchain.TXHash{blockchain.TXHash(block2.Transactions[0].TxHash())}, merkle.Merkle)
+	require.Error(t, client.call(nil, "blockchain.transaction.get_merkle", tx1Hash.String(), 1))
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regtest is a harness for integration tests against a local Bitcoin Core node in regtest
+// mode. Node runs and controls bitcoind, and ElectrumServer serves the chain of the node using the
+// Electrum protocol, so that coins and accounts can be exercised end-to-end without any external
+// servers.
+//
+// The integration tests in this package are skipped if bitcoind can't be found. To run them:
+//
+//	BITCOIND=/path/to/bitcoind go test ./backend/coins/btc/regtest/
+package regtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// BitcoindEnv is the environment variable containing the path to the bitcoind binary. If it is
+	// not set, bitcoind is looked up in the PATH.
+	BitcoindEnv = "BITCOIND"
+
+	rpcUser      = "regtest"
+	rpcPassword  = "regtest"
+	minerWallet  = "miner"
+	startTimeout = 30 * time.Second
+	stopTimeout  = 30 * time.Second
+)
+
+// ErrBitcoindNotFound is returned by FindBitcoind() if there is no bitcoind binary.
+var ErrBitcoindNotFound = errors.New("bitcoind not found")
+
+// FindBitcoind returns the path to the bitcoind binary, see BitcoindEnv.
+func FindBitcoind() (string, error) {
+	if bitcoind := os.Getenv(BitcoindEnv); bitcoind != "" {
+		return bitcoind, nil
+	}
+	bitcoind, err := exec.LookPath("bitcoind")
+	if err != nil {
+		return "", ErrBitcoindNotFound
+	}
+	return bitcoind, nil
+}
+
+// Node is a bitcoind process running in regtest mode. The node runs with -txindex and has a wallet,
+// which is used to mine blocks and to send coins.
+type Node struct {
+	cmd        *exec.Cmd
+	exited     chan struct{}
+	rpcURL     string
+	httpClient *http.Client
+
+	log *logrus.Entry
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errp.WithStack(err)
+	}
+	defer func() { _ = listener.Close() }()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// StartNode starts bitcoind in regtest mode using the given data directory, which is usually empty,
+// and waits until the node accepts RPC calls.
+func StartNode(bitcoind string, dataDir string, log *logrus.Entry) (*Node, error) {
+	rpcPort, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bitcoind,
+		"-regtest",
+		"-datadir="+dataDir,
+		"-server",
+		"-listen=0",
+		"-txindex",
+		"-rpcbind=127.0.0.1",
+		"-rpcallowip=127.0.0.1",
+		fmt.Sprintf("-rpcport=%d", rpcPort),
+		"-rpcuser="+rpcUser,
+		"-rpcpassword="+rpcPassword,
+		// Fee estimation needs more blocks with transactions than tests usually create.
+		"-fallbackfee=0.0002",
+		"-printtoconsole=0",
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	node := &Node{
+		cmd:        cmd,
+		exited:     make(chan struct{}),
+		rpcURL:     fmt.Sprintf("http://127.0.0.1:%d", rpcPort),
+		httpClient: &http.Client{Timeout: time.Minute},
+		log:        log.WithField("group", "regtest"),
+	}
+	go func() {
+		err := cmd.Wait()
+		node.log.WithError(err).Info("bitcoind exited")
+		close(node.exited)
+	}()
+	if err := node.waitReady(); err != nil {
+		_ = node.Close()
+		return nil, err
+	}
+	if err := node.Call(nil, "createwallet", minerWallet); err != nil {
+		_ = node.Close()
+		return nil, err
+	}
+	node.log.WithField("rpc-url", node.rpcURL).Info("bitcoind started")
+	return node, nil
+}
+
+func (node *Node) waitReady() error {
+	deadline := time.Now().Add(startTimeout)
+	for {
+		err := node.Call(nil, "getblockchaininfo")
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-node.exited:
+			return errp.New("bitcoind exited during startup")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return errp.WithMessage(err, "bitcoind did not start")
+		}
+	}
+}
+
+// Call performs a JSON-RPC call. The result is json-deserialized into result, which can be nil if
+// the result is not needed.
+func (node *Node) Call(result interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      0,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	request, err := http.NewRequest(http.MethodPost, node.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	request.SetBasicAuth(rpcUser, rpcPassword)
+	response, err := node.httpClient.Do(request)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	var rpcResponse struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	// The node responds with an error status and a JSON body if the call failed.
+	if err := json.NewDecoder(response.Body).Decode(&rpcResponse); err != nil {
+		return errp.Newf("%s: unexpected response, status %s", method, response.Status)
+	}
+	if rpcResponse.Error != nil {
+		return errp.Newf("%s: bitcoind error %d: %s",
+			method, rpcResponse.Error.Code, rpcResponse.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return errp.WithStack(json.Unmarshal(rpcResponse.Result, result))
+}
+
+// NewAddress returns a new address of the node's wallet.
+func (node *Node) NewAddress() (string, error) {
+	var address string
+	if err := node.Call(&address, "getnewaddress"); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// Mine mines the given number of blocks, including the transactions in the mempool, and returns
+// their hashes. The coinbase outputs are paid to the node's wallet; they can be spent after 100
+// more blocks.
+func (node *Node) Mine(count int) ([]string, error) {
+	address, err := node.NewAddress()
+	if err != nil {
+		return nil, err
+	}
+	var blockHashes []string
+	if err := node.Call(&blockHashes, "generatetoaddress", count, address); err != nil {
+		return nil, err
+	}
+	return blockHashes, nil
+}
+
+// MineEmpty mines the given number of blocks without any transactions from the mempool and returns
+// their hashes.
+func (node *Node) MineEmpty(count int) ([]string, error) {
+	address, err := node.NewAddress()
+	if err != nil {
+		return nil, err
+	}
+	blockHashes := make([]string, count)
+	for i := range blockHashes {
+		var response struct {
+			Hash string `json:"hash"`
+		}
+		if err := node.Call(&response, "generateblock", address, []string{}); err != nil {
+			return nil, err
+		}
+		blockHashes[i] = response.Hash
+	}
+	return blockHashes, nil
+}
+
+// SendToAddress pays the given amount to the address from the node's wallet and returns the
+// transaction ID.
+func (node *Node) SendToAddress(address string, amount btcutil.Amount) (string, error) {
+	var txID string
+	if err := node.Call(&txID, "sendtoaddress", address, amount.ToBTC()); err != nil {
+		return "", err
+	}
+	return txID, nil
+}
+
+// InvalidateBlock marks the block with the given hash and all its descendants as invalid, reverting
+// the chain to the block before it. Their transactions are returned to the mempool.
+func (node *Node) InvalidateBlock(blockHash string) error {
+	return node.Call(nil, "invalidateblock", blockHash)
+}
+
+// BestBlockHash returns the hash of the tip of the chain.
+func (node *Node) BestBlockHash() (string, error) {
+	var blockHash string
+	if err := node.Call(&blockHash, "getbestblockhash"); err != nil {
+		return "", err
+	}
+	return blockHash, nil
+}
+
+// Mempool returns the IDs of the transactions in the mempool.
+func (node *Node) Mempool() ([]string, error) {
+	var txIDs []string
+	if err := node.Call(&txIDs, "getrawmempool"); err != nil {
+		return nil, err
+	}
+	return txIDs, nil
+}
+
+// Close stops the node, killing it if it does not shut down in time.
+func (node *Node) Close() error {
+	select {
+	case <-node.exited:
+		return nil
+	default:
+	}
+	if err := node.Call(nil, "stop"); err != nil {
+		node.log.WithError(err).Error("Could not stop bitcoind")
+	}
+	select {
+	case <-node.exited:
+		return nil
+	case <-time.After(stopTimeout):
+		return errp.WithStack(node.cmd.Process.Kill())
+	}
+}
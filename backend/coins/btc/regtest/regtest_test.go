@@ -0,0 +1,207 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/regtest"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/stretchr/testify/require"
+)
+
+const waitTimeout = 30 * time.Second
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "timed out waiting for "+what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func findTx(t *testing.T, account *btc.Account, txID string) *accounts.TransactionData {
+	t.Helper()
+	transactions, err := account.Transactions()
+	require.NoError(t, err)
+	for _, tx := range transactions {
+		if tx.TxID == txID {
+			return tx
+		}
+	}
+	return nil
+}
+
+func inMempool(t *testing.T, node *regtest.Node, txID string) bool {
+	t.Helper()
+	mempool, err := node.Mempool()
+	require.NoError(t, err)
+	for _, mempoolTxID := range mempool {
+		if mempoolTxID == txID {
+			return true
+		}
+	}
+	return false
+}
+
+// TestAccount drives an account through a local regtest node: receiving, sending, bumping the fee
+// of the sent transaction and a reorg unconfirming it. It is skipped if bitcoind is not installed,
+// see regtest.BitcoindEnv.
+func TestAccount(t *testing.T) {
+	bitcoind, err := regtest.FindBitcoind()
+	if err != nil {
+		t.Skipf("%v, set %s to run the regtest integration tests", err, regtest.BitcoindEnv)
+	}
+	log := logging.Get().WithGroup("regtest_test")
+	node, err := regtest.StartNode(bitcoind, t.TempDir(), log)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, node.Close()) }()
+	// Let the coinbase outputs of the node's wallet mature.
+	_, err = node.Mine(101)
+	require.NoError(t, err)
+
+	server, err := regtest.NewElectrumServer(node, log)
+	require.NoError(t, err)
+	defer server.Close()
+
+	net := &chaincfg.RegressionNetParams
+	dbFolder := t.TempDir()
+	coin := btc.NewCoin(coinpkg.CodeRBTC, "Bitcoin Regtest", "RBTC", net, dbFolder,
+		[]*config.ServerInfo{{Server: server.Address(), TLS: false}},
+		"", socksproxy.NewSocksProxy(false, ""))
+	defer func() { require.NoError(t, coin.Close()) }()
+
+	master, err := hdkeychain.NewMaster(make([]byte, 32), net)
+	require.NoError(t, err)
+	keystore := software.NewKeystore(master)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	xpub, err := keystore.ExtendedPublicKey(coin, keypath)
+	require.NoError(t, err)
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Code:     "regtest",
+			Name:     "Regtest",
+			DBFolder: dbFolder,
+			Keystore: keystore,
+			OnEvent:  func(accounts.Event) {},
+			SigningConfigurations: signing.Configurations{signing.NewBitcoinConfiguration(
+				signing.ScriptTypeP2WPKH, rootFingerprint, keypath, xpub)},
+			GetNotifier: func(signing.Configurations) accounts.Notifier { return nil },
+		},
+		coin, nil, log,
+	)
+	require.NoError(t, account.Initialize())
+	defer account.Close()
+	waitFor(t, "the initial sync", account.Synced)
+
+	balance := func() (int64, int64) {
+		balance, err := account.Balance()
+		require.NoError(t, err)
+		return balance.Available().BigInt().Int64(), balance.Incoming().BigInt().Int64()
+	}
+
+	// Receive.
+	receiveAddress := account.GetUnusedReceiveAddresses()[0][0].EncodeForHumans()
+	receiveTxID, err := node.SendToAddress(receiveAddress, btcutil.SatoshiPerBitcoin)
+	require.NoError(t, err)
+	waitFor(t, "the incoming transaction", func() bool {
+		_, incoming := balance()
+		return findTx(t, account, receiveTxID) != nil && incoming == btcutil.SatoshiPerBitcoin
+	})
+	_, err = node.Mine(1)
+	require.NoError(t, err)
+	waitFor(t, "the received transaction to confirm", func() bool {
+		available, _ := balance()
+		tx := findTx(t, account, receiveTxID)
+		return tx != nil && tx.Height == 102 && available == btcutil.SatoshiPerBitcoin
+	})
+
+	// Send.
+	recipient, err := node.NewAddress()
+	require.NoError(t, err)
+	amount, fee, _, err := account.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: recipient,
+		Amount:           coinpkg.NewSendAmount("0.3"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "2",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(30000000), amount.BigInt().Int64())
+	require.NoError(t, account.SendTx())
+	var sendTxID string
+	waitFor(t, "the sent transaction", func() bool {
+		transactions, err := account.Transactions()
+		require.NoError(t, err)
+		for _, tx := range transactions {
+			if tx.Type == accounts.TxTypeSend {
+				sendTxID = tx.TxID
+				return true
+			}
+		}
+		return false
+	})
+	require.True(t, inMempool(t, node, sendTxID))
+	require.Equal(t, fee.BigInt(), findTx(t, account, sendTxID).Fee.BigInt())
+
+	// Replace-by-fee.
+	bumpedTxID, err := account.BumpFee(sendTxID, 10000)
+	require.NoError(t, err)
+	require.NotEqual(t, sendTxID, bumpedTxID)
+	require.True(t, inMempool(t, node, bumpedTxID))
+	require.False(t, inMempool(t, node, sendTxID))
+	waitFor(t, "the replacement transaction", func() bool {
+		return findTx(t, account, bumpedTxID) != nil && findTx(t, account, sendTxID) == nil
+	})
+
+	// Confirm the replacement, then reorg it out of the chain.
+	blockHashes, err := node.Mine(1)
+	require.NoError(t, err)
+	waitFor(t, "the replacement transaction to confirm", func() bool {
+		tx := findTx(t, account, bumpedTxID)
+		return tx != nil && tx.Height == 103
+	})
+	require.NoError(t, node.InvalidateBlock(blockHashes[0]))
+	_, err = node.MineEmpty(2)
+	require.NoError(t, err)
+	require.True(t, inMempool(t, node, bumpedTxID))
+	bestBlockHash, err := node.BestBlockHash()
+	require.NoError(t, err)
+	waitFor(t, "the reorg", func() bool {
+		tx := findTx(t, account, bumpedTxID)
+		if tx == nil || tx.Height != 0 {
+			return false
+		}
+		header, err := coin.Headers().VerifiedHeaderByHeight(104)
+		require.NoError(t, err)
+		return header != nil && header.BlockHash().String() == bestBlockHash
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -38,7 +39,21 @@ type ProposedTransaction struct {
 	GetPrevTx                    func(chainhash.Hash) *wire.MsgTx
 	// Signatures collects the signatures, one per transaction input.
 	Signatures []*btcec.Signature
-	SigHashes  *txscript.TxSigHashes
+	// SchnorrSignatures collects the BIP340 signatures, one per transaction input. Only taproot
+	// inputs are signed this way, the entries of all other inputs are nil.
+	SchnorrSignatures [][]byte
+	SigHashes         *txscript.TxSigHashes
+}
+
+// PreviousTxOuts returns the outputs spent by the transaction, one per input in the order of the
+// inputs. This is needed to compute taproot signature hashes.
+func (proposedTransaction *ProposedTransaction) PreviousTxOuts() []*wire.TxOut {
+	txIns := proposedTransaction.TXProposal.Transaction.TxIn
+	prevOuts := make([]*wire.TxOut, len(txIns))
+	for index, txIn := range txIns {
+		prevOuts[index] = proposedTransaction.PreviousOutputs[txIn.PreviousOutPoint].TxOut
+	}
+	return prevOuts
 }
 
 // signTransaction signs all inputs. It assumes all outputs spent belong to this
@@ -59,6 +74,7 @@ func (account *Account) signTransaction(
 		GetAddress:                   account.getAddress,
 		GetPrevTx:                    getPrevTx,
 		Signatures:                   make([]*btcec.Signature, len(txProposal.Transaction.TxIn)),
+		SchnorrSignatures:            make([][]byte, len(txProposal.Transaction.TxIn)),
 		SigHashes:                    txscript.NewTxSigHashes(txProposal.Transaction),
 	}
 
@@ -69,6 +85,14 @@ func (account *Account) signTransaction(
 	for index, input := range txProposal.Transaction.TxIn {
 		spentOutput := previousOutputs[input.PreviousOutPoint]
 		address := proposedTransaction.GetAddress(spentOutput.ScriptHashHex())
+		if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
+			signature := proposedTransaction.SchnorrSignatures[index]
+			if signature == nil {
+				return errp.New("Signature missing")
+			}
+			input.SignatureScript, input.Witness = []byte{}, address.TaprootWitness(signature)
+			continue
+		}
 		signature := proposedTransaction.Signatures[index]
 		if signature == nil {
 			return errp.New("Signature missing")
@@ -90,11 +114,29 @@ func txValidityCheck(transaction *wire.MsgTx, previousOutputs map[wire.OutPoint]
 	if !txsort.IsSorted(transaction) {
 		return errp.New("tx not bip69 conformant")
 	}
+	return verifyInputScripts(transaction, previousOutputs, sigHashes)
+}
+
+// verifyInputScripts checks that all inputs of the transaction are validly signed.
+func verifyInputScripts(transaction *wire.MsgTx, previousOutputs map[wire.OutPoint]*transactions.SpendableOutput,
+	sigHashes *txscript.TxSigHashes) error {
+	prevOuts := make([]*wire.TxOut, len(transaction.TxIn))
 	for index, txIn := range transaction.TxIn {
 		spentOutput, ok := previousOutputs[txIn.PreviousOutPoint]
 		if !ok {
 			return errp.New("There needs to be exactly one output being spent per input!")
 		}
+		prevOuts[index] = spentOutput.TxOut
+	}
+	for index, txIn := range transaction.TxIn {
+		spentOutput := previousOutputs[txIn.PreviousOutPoint]
+		if taproot.IsPayToTaproot(spentOutput.PkScript) {
+			// The script engine of our btcd version does not support taproot yet.
+			if err := taproot.VerifyKeySpend(transaction, index, spentOutput.PkScript, prevOuts); err != nil {
+				return err
+			}
+			continue
+		}
 		engine, err := txscript.NewEngine(spentOutput.PkScript, transaction, index,
 			txscript.StandardVerifyFlags, nil, sigHashes, spentOutput.Value)
 		if err != nil {
@@ -0,0 +1,84 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip322"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// CanSignMessageBIP322 returns true if messages can be signed using SignMessageBIP322().
+func (account *Account) CanSignMessageBIP322() bool {
+	return !account.IsMultisig() &&
+		account.Config().Keystore.CanSignBIP322Message(account.coin.Code())
+}
+
+// SignMessageBIP322 signs the message with the key of the receive address with the given ID, as
+// defined in BIP-322. The signature is returned base64 encoded in the "simple" format, or in the
+// "full" format for wrapped segwit addresses.
+func (account *Account) SignMessageBIP322(addressID string, message []byte) (string, error) {
+	if !account.initialized {
+		return "", errp.New("account must be initialized")
+	}
+	if !account.CanSignMessageBIP322() {
+		return "", errp.New("The keystore can't sign BIP-322 messages for this account")
+	}
+	account.Synchronizer.WaitSynchronized()
+	unlock := account.RLock()
+	address := account.lookupAddress(blockchain.ScriptHashHex(addressID))
+	unlock()
+	if address == nil {
+		return "", errp.New("unknown address not found")
+	}
+
+	toSpend := bip322.ToSpend(address.PubkeyScript(), message)
+	toSign := bip322.ToSign(toSpend)
+	previousOutputs := map[wire.OutPoint]*transactions.SpendableOutput{
+		toSign.TxIn[0].PreviousOutPoint: {
+			TxOut:   toSpend.TxOut[0],
+			Address: address.EncodeForHumans(),
+		},
+	}
+	txProposal := &maketx.TxProposal{
+		Coin:        account.coin,
+		Amount:      0,
+		Fee:         0,
+		Transaction: toSign,
+		Outputs:     toSign.TxOut,
+	}
+	getPrevTx := func(chainhash.Hash) *wire.MsgTx { return toSpend }
+	if err := account.signTransaction(txProposal, previousOutputs, getPrevTx); err != nil {
+		return "", err
+	}
+	return bip322.Encode(toSign)
+}
+
+// VerifyMessageBIP322 checks that the signature is a valid signature of the message by the
+// address, which does not need to belong to this account. See bip322.Verify() for the supported
+// signature formats. Returns bip322.ErrInvalidSignature if the signature is invalid.
+func (account *Account) VerifyMessageBIP322(address string, message []byte, signature string) error {
+	decodedAddress, err := btcutil.DecodeAddress(address, account.coin.Net())
+	if err != nil || !decodedAddress.IsForNet(account.coin.Net()) {
+		return errp.WithStack(errors.ErrInvalidAddress)
+	}
+	return bip322.Verify(decodedAddress, message, signature, account.coin.Net())
+}
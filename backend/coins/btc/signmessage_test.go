@@ -0,0 +1,101 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/bip322"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignMessageBIP322(t *testing.T) {
+	net := &chaincfg.TestNet3Params
+	dbFolder := test.TstTempDir("btc-dbfolder")
+	defer func() { _ = os.RemoveAll(dbFolder) }()
+
+	coin := btc.NewCoin(
+		coin.CodeTBTC, "Bitcoin Testnet", "TBTC", net, dbFolder, nil, explorer, socksproxy.NewSocksProxy(false, ""))
+	blockchainMock := &blockchainMock.BlockchainMock{}
+	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	coin.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
+
+	master, err := hdkeychain.NewMaster(make([]byte, 32), net)
+	require.NoError(t, err)
+	keystore := software.NewKeystore(master)
+	rootFingerprint, err := keystore.RootFingerprint()
+	require.NoError(t, err)
+
+	var signingConfigurations signing.Configurations
+	for _, scriptType := range []signing.ScriptType{
+		signing.ScriptTypeP2WPKH, signing.ScriptTypeP2WPKHP2SH, signing.ScriptTypeP2TR} {
+		keypath, err := signing.NewAbsoluteKeypath(map[signing.ScriptType]string{
+			signing.ScriptTypeP2WPKH:     "m/84'/1'/0'",
+			signing.ScriptTypeP2WPKHP2SH: "m/49'/1'/0'",
+			signing.ScriptTypeP2TR:       "m/86'/1'/0'",
+		}[scriptType])
+		require.NoError(t, err)
+		xpub, err := keystore.ExtendedPublicKey(nil, keypath)
+		require.NoError(t, err)
+		signingConfigurations = append(signingConfigurations,
+			signing.NewBitcoinConfiguration(scriptType, rootFingerprint, keypath, xpub))
+	}
+
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Code:                  "accountcode",
+			Name:                  "accountname",
+			DBFolder:              dbFolder,
+			Keystore:              keystore,
+			OnEvent:               func(accounts.Event) {},
+			SigningConfigurations: signingConfigurations,
+			GetNotifier:           func(signing.Configurations) accounts.Notifier { return nil },
+		},
+		coin, nil,
+		logging.Get().WithGroup("signmessage_test"),
+	)
+	require.NoError(t, account.Initialize())
+	require.True(t, account.CanSignMessageBIP322())
+
+	message := []byte("I own this address")
+	for _, addressList := range account.GetUnusedReceiveAddresses() {
+		address := addressList[0]
+		signature, err := account.SignMessageBIP322(address.ID(), message)
+		require.NoError(t, err)
+		require.NoError(t, account.VerifyMessageBIP322(address.EncodeForHumans(), message, signature))
+		err = account.VerifyMessageBIP322(address.EncodeForHumans(), []byte("other message"), signature)
+		require.Equal(t, bip322.ErrInvalidSignature, errp.Cause(err))
+	}
+
+	_, err = account.SignMessageBIP322("unknown", message)
+	require.Error(t, err)
+	err = account.VerifyMessageBIP322("invalid address", message, "")
+	require.Equal(t, errors.ErrInvalidAddress, errp.Cause(err))
+}
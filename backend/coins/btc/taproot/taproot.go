@@ -0,0 +1,329 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package taproot implements the parts of BIP340 (Schnorr signatures), BIP341 (Taproot) and BIP86
+// (key-path-only single-sig outputs) that are needed to receive to and spend from P2TR outputs.
+// The btcd version we depend on does not support Taproot yet.
+package taproot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// SignatureSize is the size of a BIP340 signature using SIGHASH_DEFAULT, which is the only sighash
+// type we use. Other sighash types append one byte.
+const SignatureSize = 64
+
+// sigHashDefault is SIGHASH_DEFAULT, which is implied by a signature without a sighash type byte.
+// Apart from that, only SIGHASH_ALL is supported, which commits to the same data.
+const sigHashDefault = 0x00
+
+// PubKeySize is the size of an x-only public key.
+const PubKeySize = 32
+
+const (
+	tagTapTweak   = "TapTweak"
+	tagTapSighash = "TapSighash"
+	tagAux        = "BIP0340/aux"
+	tagNonce      = "BIP0340/nonce"
+	tagChallenge  = "BIP0340/challenge"
+)
+
+var curve = btcec.S256()
+
+// TaggedHash computes SHA256(SHA256(tag) || SHA256(tag) || msg), as defined in BIP340.
+func TaggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	_, _ = h.Write(tagHash[:])
+	_, _ = h.Write(tagHash[:])
+	for _, msg := range msgs {
+		_, _ = h.Write(msg)
+	}
+	return h.Sum(nil)
+}
+
+// bytes32 serializes a non-negative integer smaller than 2^256 as 32 bytes big endian.
+func bytes32(i *big.Int) []byte {
+	result := make([]byte, 32)
+	i.FillBytes(result)
+	return result
+}
+
+func hasEvenY(y *big.Int) bool {
+	return y.Bit(0) == 0
+}
+
+// SerializePubKey returns the 32 byte x-only encoding of the public key.
+func SerializePubKey(publicKey *btcec.PublicKey) []byte {
+	return bytes32(publicKey.X)
+}
+
+// ParsePubKey parses a 32 byte x-only public key. The point with the even Y coordinate is returned.
+func ParsePubKey(xOnly []byte) (*btcec.PublicKey, error) {
+	if len(xOnly) != PubKeySize {
+		return nil, errp.New("x-only public key must be 32 bytes")
+	}
+	publicKey, err := btcec.ParsePubKey(append([]byte{0x02}, xOnly...), curve)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return publicKey, nil
+}
+
+// tweak returns the BIP86 tweak for the given internal key, which commits to no script path.
+func tweak(internalKey *btcec.PublicKey) *big.Int {
+	t := new(big.Int).SetBytes(TaggedHash(tagTapTweak, SerializePubKey(internalKey)))
+	if t.Cmp(curve.N) >= 0 {
+		// Happens with negligible probability.
+		panic("taproot tweak out of range")
+	}
+	return t
+}
+
+// OutputKey computes the taproot output key Q = P + tG, where P is the internal key with even Y
+// and t the BIP86 tweak (no script path).
+func OutputKey(internalKey *btcec.PublicKey) *btcec.PublicKey {
+	// Normalize to the point with even Y.
+	p, err := ParsePubKey(SerializePubKey(internalKey))
+	if err != nil {
+		panic(err)
+	}
+	tx, ty := curve.ScalarBaseMult(tweak(p).Bytes())
+	qx, qy := curve.Add(p.X, p.Y, tx, ty)
+	return &btcec.PublicKey{Curve: curve, X: qx, Y: qy}
+}
+
+// TweakPrivateKey returns the private key corresponding to OutputKey(privateKey.PubKey()).
+func TweakPrivateKey(privateKey *btcec.PrivateKey) *btcec.PrivateKey {
+	d := new(big.Int).Set(privateKey.D)
+	if !hasEvenY(privateKey.PubKey().Y) {
+		d.Sub(curve.N, d)
+	}
+	d.Add(d, tweak(privateKey.PubKey()))
+	d.Mod(d, curve.N)
+	tweaked, _ := btcec.PrivKeyFromBytes(curve, bytes32(d))
+	return tweaked
+}
+
+// PayToTaprootScript returns the segwit v1 pkScript paying to the given x-only output key:
+// OP_1 OP_DATA_32 <output key>.
+func PayToTaprootScript(xOnlyOutputKey []byte) ([]byte, error) {
+	if len(xOnlyOutputKey) != PubKeySize {
+		return nil, errp.New("taproot output key must be 32 bytes")
+	}
+	return txscript.NewScriptBuilder().
+		AddOp(txscript.OP_1).
+		AddData(xOnlyOutputKey).
+		Script()
+}
+
+// PayToAddrScript is like txscript.PayToAddrScript, but also supports taproot addresses.
+func PayToAddrScript(address btcutil.Address) ([]byte, error) {
+	if taprootAddress, ok := address.(*btcutil.AddressTaproot); ok {
+		return PayToTaprootScript(taprootAddress.ScriptAddress())
+	}
+	return txscript.PayToAddrScript(address)
+}
+
+// IsPayToTaproot returns true if the pkScript is a segwit v1 output with a 32 byte program.
+func IsPayToTaproot(pkScript []byte) bool {
+	return len(pkScript) == 2+PubKeySize &&
+		pkScript[0] == txscript.OP_1 &&
+		pkScript[1] == txscript.OP_DATA_32
+}
+
+// Sign creates a BIP340 signature of the 32 byte hash. auxRand is 32 bytes of auxiliary randomness
+// (can be all zeroes, but should be random to protect against side channel attacks).
+func Sign(privateKey *btcec.PrivateKey, hash []byte, auxRand []byte) ([]byte, error) {
+	if len(hash) != 32 || len(auxRand) != 32 {
+		return nil, errp.New("hash and auxiliary randomness must be 32 bytes")
+	}
+	d := new(big.Int).Set(privateKey.D)
+	if d.Sign() == 0 || d.Cmp(curve.N) >= 0 {
+		return nil, errp.New("invalid private key")
+	}
+	publicKey := privateKey.PubKey()
+	if !hasEvenY(publicKey.Y) {
+		d.Sub(curve.N, d)
+	}
+	pubKeyBytes := SerializePubKey(publicKey)
+
+	t := bytes32(d)
+	auxHash := TaggedHash(tagAux, auxRand)
+	for i := range t {
+		t[i] ^= auxHash[i]
+	}
+	k := new(big.Int).SetBytes(TaggedHash(tagNonce, t, pubKeyBytes, hash))
+	k.Mod(k, curve.N)
+	if k.Sign() == 0 {
+		return nil, errp.New("nonce is zero")
+	}
+	rx, ry := curve.ScalarBaseMult(bytes32(k))
+	if !hasEvenY(ry) {
+		k.Sub(curve.N, k)
+	}
+	rBytes := bytes32(rx)
+	e := new(big.Int).SetBytes(TaggedHash(tagChallenge, rBytes, pubKeyBytes, hash))
+	e.Mod(e, curve.N)
+
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, curve.N)
+	signature := append(rBytes, bytes32(s)...)
+
+	if !Verify(pubKeyBytes, hash, signature) {
+		return nil, errp.New("created an invalid signature")
+	}
+	return signature, nil
+}
+
+// Verify verifies a BIP340 signature of the 32 byte hash against the x-only public key.
+func Verify(xOnlyPublicKey []byte, hash []byte, signature []byte) bool {
+	if len(hash) != 32 || len(signature) != SignatureSize {
+		return false
+	}
+	publicKey, err := ParsePubKey(xOnlyPublicKey)
+	if err != nil {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:32])
+	if r.Cmp(curve.P) >= 0 {
+		return false
+	}
+	s := new(big.Int).SetBytes(signature[32:])
+	if s.Cmp(curve.N) >= 0 {
+		return false
+	}
+	e := new(big.Int).SetBytes(TaggedHash(tagChallenge, signature[:32], xOnlyPublicKey, hash))
+	e.Mod(e, curve.N)
+
+	// R = sG - eP
+	sgx, sgy := curve.ScalarBaseMult(bytes32(s))
+	epx, epy := curve.ScalarMult(publicKey.X, publicKey.Y, bytes32(e))
+	epy.Sub(curve.P, epy)
+	rx, ry := curve.Add(sgx, sgy, epx, epy)
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return hasEvenY(ry) && rx.Cmp(r) == 0
+}
+
+// CalcSigHash computes the BIP341 signature hash of a key path spend of the input at inputIndex,
+// using SIGHASH_DEFAULT. prevOuts must contain the outputs spent by the transaction inputs, in the
+// same order as the inputs.
+func CalcSigHash(tx *wire.MsgTx, inputIndex int, prevOuts []*wire.TxOut) ([]byte, error) {
+	return calcSigHash(tx, inputIndex, prevOuts, sigHashDefault)
+}
+
+// calcSigHash is CalcSigHash for SIGHASH_DEFAULT or SIGHASH_ALL.
+func calcSigHash(
+	tx *wire.MsgTx, inputIndex int, prevOuts []*wire.TxOut, hashType txscript.SigHashType,
+) ([]byte, error) {
+	if hashType != sigHashDefault && hashType != txscript.SigHashAll {
+		return nil, errp.Newf("unsupported sighash type %d", hashType)
+	}
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, errp.New("one previous output per input is required")
+	}
+	if inputIndex < 0 || inputIndex >= len(tx.TxIn) {
+		return nil, errp.New("input index out of range")
+	}
+	shaPrevouts := sha256.New()
+	shaAmounts := sha256.New()
+	shaScriptPubKeys := sha256.New()
+	shaSequences := sha256.New()
+	for index, txIn := range tx.TxIn {
+		_, _ = shaPrevouts.Write(txIn.PreviousOutPoint.Hash[:])
+		_ = binary.Write(shaPrevouts, binary.LittleEndian, txIn.PreviousOutPoint.Index)
+		_ = binary.Write(shaAmounts, binary.LittleEndian, prevOuts[index].Value)
+		if err := wire.WriteVarBytes(shaScriptPubKeys, 0, prevOuts[index].PkScript); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		_ = binary.Write(shaSequences, binary.LittleEndian, txIn.Sequence)
+	}
+	shaOutputs := sha256.New()
+	for _, txOut := range tx.TxOut {
+		if err := wire.WriteTxOut(shaOutputs, 0, 0, txOut); err != nil {
+			return nil, errp.WithStack(err)
+		}
+	}
+
+	var sigMsg bytes.Buffer
+	// Epoch.
+	sigMsg.WriteByte(0x00)
+	sigMsg.WriteByte(byte(hashType))
+	_ = binary.Write(&sigMsg, binary.LittleEndian, tx.Version)
+	_ = binary.Write(&sigMsg, binary.LittleEndian, tx.LockTime)
+	sigMsg.Write(shaPrevouts.Sum(nil))
+	sigMsg.Write(shaAmounts.Sum(nil))
+	sigMsg.Write(shaScriptPubKeys.Sum(nil))
+	sigMsg.Write(shaSequences.Sum(nil))
+	sigMsg.Write(shaOutputs.Sum(nil))
+	// spend_type: key path spend, no annex.
+	sigMsg.WriteByte(0x00)
+	_ = binary.Write(&sigMsg, binary.LittleEndian, uint32(inputIndex))
+	return TaggedHash(tagTapSighash, sigMsg.Bytes()), nil
+}
+
+// ParseSignature splits a key path spend signature into the BIP340 signature and the sighash type.
+// Only SIGHASH_DEFAULT (64 byte signatures) and SIGHASH_ALL (65 byte signatures ending in 0x01) are
+// supported.
+func ParseSignature(signature []byte) ([]byte, txscript.SigHashType, error) {
+	switch {
+	case len(signature) == SignatureSize:
+		return signature, sigHashDefault, nil
+	case len(signature) == SignatureSize+1 &&
+		txscript.SigHashType(signature[SignatureSize]) == txscript.SigHashAll:
+		return signature[:SignatureSize], txscript.SigHashAll, nil
+	default:
+		return nil, 0, errp.New("invalid taproot signature encoding")
+	}
+}
+
+// VerifyKeySpend checks that the witness of the input at inputIndex is a valid key path spend of
+// the taproot output pkScript.
+func VerifyKeySpend(tx *wire.MsgTx, inputIndex int, pkScript []byte, prevOuts []*wire.TxOut) error {
+	if !IsPayToTaproot(pkScript) {
+		return errp.New("not a taproot output")
+	}
+	txIn := tx.TxIn[inputIndex]
+	if len(txIn.SignatureScript) != 0 {
+		return errp.New("taproot inputs must have an empty signature script")
+	}
+	if len(txIn.Witness) != 1 {
+		return errp.New("unexpected taproot witness")
+	}
+	signature, hashType, err := ParseSignature(txIn.Witness[0])
+	if err != nil {
+		return err
+	}
+	sigHash, err := calcSigHash(tx, inputIndex, prevOuts, hashType)
+	if err != nil {
+		return err
+	}
+	if !Verify(pkScript[2:], sigHash, signature) {
+		return errp.New("invalid taproot signature")
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taproot_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from https://github.com/bitcoin/bips/blob/master/bip-0340/test-vectors.csv.
+func TestSignVerify(t *testing.T) {
+	vectors := []struct {
+		privateKey string
+		publicKey  string
+		auxRand    string
+		message    string
+		signature  string
+	}{
+		{
+			privateKey: "0000000000000000000000000000000000000000000000000000000000000003",
+			publicKey:  "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+			auxRand:    "0000000000000000000000000000000000000000000000000000000000000000",
+			message:    "0000000000000000000000000000000000000000000000000000000000000000",
+			signature:  "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0",
+		},
+		{
+			privateKey: "B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF",
+			publicKey:  "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+			auxRand:    "0000000000000000000000000000000000000000000000000000000000000001",
+			message:    "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89",
+			signature:  "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A",
+		},
+	}
+	for _, vector := range vectors {
+		privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), unhex(vector.privateKey))
+		require.Equal(t, unhex(vector.publicKey), taproot.SerializePubKey(privateKey.PubKey()))
+		signature, err := taproot.Sign(privateKey, unhex(vector.message), unhex(vector.auxRand))
+		require.NoError(t, err)
+		require.Equal(t, unhex(vector.signature), signature)
+		require.True(t, taproot.Verify(unhex(vector.publicKey), unhex(vector.message), signature))
+
+		// Tampered message.
+		message := unhex(vector.message)
+		message[0] ^= 1
+		require.False(t, taproot.Verify(unhex(vector.publicKey), message, signature))
+	}
+}
+
+func TestTweakPrivateKey(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), unhex(
+		"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF"))
+	require.Equal(t,
+		taproot.SerializePubKey(taproot.OutputKey(privateKey.PubKey())),
+		taproot.SerializePubKey(taproot.TweakPrivateKey(privateKey).PubKey()),
+	)
+}
+
+// Test vector from https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors.
+func TestOutputKey(t *testing.T) {
+	xpub, err := hdkeychain.NewKeyFromString(
+		"xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ")
+	require.NoError(t, err)
+	derived, err := signing.NewEmptyRelativeKeypath().Child(0, false).Child(0, false).Derive(xpub)
+	require.NoError(t, err)
+	publicKey, err := derived.ECPubKey()
+	require.NoError(t, err)
+	outputKey := taproot.SerializePubKey(taproot.OutputKey(publicKey))
+	address, err := btcutil.NewAddressTaproot(outputKey, &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr", address.EncodeAddress())
+
+	pkScript, err := taproot.PayToTaprootScript(outputKey)
+	require.NoError(t, err)
+	require.True(t, taproot.IsPayToTaproot(pkScript))
+}
+
+func TestVerifyKeySpend(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), unhex(
+		"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF"))
+	pkScript, err := taproot.PayToTaprootScript(
+		taproot.SerializePubKey(taproot.OutputKey(privateKey.PubKey())))
+	require.NoError(t, err)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 2}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, pkScript))
+	prevOuts := []*wire.TxOut{
+		wire.NewTxOut(2000, pkScript),
+		wire.NewTxOut(3000, pkScript),
+	}
+	for index := range tx.TxIn {
+		sigHash, err := taproot.CalcSigHash(tx, index, prevOuts)
+		require.NoError(t, err)
+		signature, err := taproot.Sign(taproot.TweakPrivateKey(privateKey), sigHash, make([]byte, 32))
+		require.NoError(t, err)
+		tx.TxIn[index].Witness = wire.TxWitness{signature}
+	}
+	for index := range tx.TxIn {
+		require.NoError(t, taproot.VerifyKeySpend(tx, index, pkScript, prevOuts))
+	}
+
+	// Signatures with an explicit SIGHASH_ALL byte are valid too.
+	sigHash, err := taproot.TstCalcSigHashAll(tx, 1, prevOuts)
+	require.NoError(t, err)
+	signature, err := taproot.Sign(taproot.TweakPrivateKey(privateKey), sigHash, make([]byte, 32))
+	require.NoError(t, err)
+	tx.TxIn[1].Witness = wire.TxWitness{append(signature, byte(txscript.SigHashAll))}
+	require.NoError(t, taproot.VerifyKeySpend(tx, 1, pkScript, prevOuts))
+	// An explicit SIGHASH_DEFAULT byte is invalid.
+	tx.TxIn[1].Witness = wire.TxWitness{append(signature, 0x00)}
+	require.Error(t, taproot.VerifyKeySpend(tx, 1, pkScript, prevOuts))
+
+	// The signature commits to the amounts of all spent outputs.
+	prevOuts[1].Value++
+	require.Error(t, taproot.VerifyKeySpend(tx, 0, pkScript, prevOuts))
+}
+
+// Test vector from the keyPathSpending section of
+// https://github.com/bitcoin/bips/blob/master/bip-0341/wallet-test-vectors.json. Input 4 is signed
+// with SIGHASH_DEFAULT and input 3 with SIGHASH_ALL. The other inputs use sighash types we don't
+// support.
+func TestCalcSigHash(t *testing.T) {
+	rawTx := unhex("02000000097de20cbff686da83a54981d2b9bab3586f4ca7e48f57f5b55963115f3b334e9c0100000000" +
+		"00000000d7b7cab57b1393ace2d064f4d4a2cb8af6def61273e127517d44759b6dafdd990000000000ffffffff" +
+		"f8e1f583384333689228c5d28eac13366be082dc57441760d957275419a418420000000000ffffffff" +
+		"f0689180aa63b30cb162a73c6d2a38b7eeda2a83ece74310fda0843ad604853b0100000000feffffff" +
+		"aa5202bdf6d8ccd2ee0f0202afbbb7461d9264a25e5bfd3c5a52ee1239e0ba6c0000000000feffffff" +
+		"956149bdc66faa968eb2be2d2faa29718acbfe3941215893a2a3446d32acd050000000000000000000" +
+		"e664b9773b88c09c32cb70a2a3e4da0ced63b7ba3b22f848531bbb1d5d5f4c94010000000000000000" +
+		"e9aa6b8e6c9de67619e6a3924ae25696bb7b694bb677a632a74ef7eadfd4eabf0000000000ffffffff" +
+		"a778eb6a263dc090464cd125c466b5a99667720b1c110468831d058aa1b82af10100000000ffffffff" +
+		"0200ca9a3b000000001976a91406afd46bcdfd22ef94ac122aa11f241244a37ecc88ac807840cb00000000" +
+		"20ac9a87f5594be208f8532db38cff670c450ed2fea8fcdefcc9a663f78bab962b0065cd1d")
+	tx := wire.NewMsgTx(wire.TxVersion)
+	require.NoError(t, tx.Deserialize(bytes.NewReader(rawTx)))
+
+	prevOuts := []*wire.TxOut{
+		wire.NewTxOut(420000000, unhex("512053a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343")),
+		wire.NewTxOut(462000000, unhex("5120147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3")),
+		wire.NewTxOut(294000000, unhex("76a914751e76e8199196d454941c45d1b3a323f1433bd688ac")),
+		wire.NewTxOut(504000000, unhex("5120e4d810fd50586274face62b8a807eb9719cef49c04177cc6b76a9a4251d5450e")),
+		wire.NewTxOut(630000000, unhex("512091b64d5324723a985170e4dc5a0f84c041804f2cd12660fa5dec09fc21783605")),
+		wire.NewTxOut(378000000, unhex("00147dd65592d0ab2fe0d0257d571abf032cd9db93dc")),
+		wire.NewTxOut(672000000, unhex("512075169f4001aa68f15bbed28b218df1d0a62cbbcf1188c6665110c293c907b831")),
+		wire.NewTxOut(546000000, unhex("5120712447206d7a5238acc7ff53fbe94a3b64539ad291c7cdbc490b7577e4b17df5")),
+		wire.NewTxOut(588000000, unhex("512077e30a5522dd9f894c3f8b8bd4c4b2cf82ca7da8a3ea6a239655c39c050ab220")),
+	}
+
+	sigHash, err := taproot.CalcSigHash(tx, 4, prevOuts)
+	require.NoError(t, err)
+	require.Equal(t,
+		"4f900a0bae3f1446fd48490c2958b5a023228f01661cda3496a11da502a7f7ef",
+		hex.EncodeToString(sigHash))
+
+	sigHash, err = taproot.TstCalcSigHashAll(tx, 3, prevOuts)
+	require.NoError(t, err)
+	require.Equal(t,
+		"bf013ea93474aa67815b1b6cc441d23b64fa310911d991e713cd34c7f5d46669",
+		hex.EncodeToString(sigHash))
+
+	_, err = taproot.CalcSigHash(tx, 9, prevOuts)
+	require.Error(t, err)
+	_, err = taproot.CalcSigHash(tx, 4, prevOuts[1:])
+	require.Error(t, err)
+}
@@ -20,7 +20,6 @@ import (
 	"strconv"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
@@ -28,6 +27,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/addresses"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/maketx"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/transactions"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
@@ -67,7 +67,16 @@ func (account *Account) getFeePerKb(args *accounts.TxProposalArgs) (btcutil.Amou
 	return *feeTarget.feeRatePerKb, nil
 }
 
-// newTx creates a new tx to the given recipient address. It also returns a set of used account
+// recipients returns the recipients of the new tx, which are args.Recipients, or the single
+// recipient given by args.RecipientAddress and args.Amount.
+func recipients(args *accounts.TxProposalArgs) []accounts.TxRecipient {
+	if len(args.Recipients) != 0 {
+		return args.Recipients
+	}
+	return []accounts.TxRecipient{{Address: args.RecipientAddress, Amount: args.Amount}}
+}
+
+// newTx creates a new tx to the given recipients. It also returns a set of used account
 // outputs, which contains all outputs that spent in the tx. Those are needed to be able to sign the
 // transaction. selectedUTXOs restricts the available coins; if empty, no restriction is applied and
 // all unspent coins can be used.
@@ -76,27 +85,62 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (
 
 	account.log.Debug("Prepare new transaction")
 
-	address, err := account.coin.DecodeAddress(args.RecipientAddress)
-	if err != nil {
-		return nil, nil, err
-	}
-	pkScript, err := txscript.PayToAddrScript(address)
-	if err != nil {
-		return nil, nil, errp.WithStack(err)
+	// The outputs with a fixed amount, and the pkScript of the output receiving the remaining
+	// funds, if any.
+	outputs := []*wire.TxOut{}
+	var sendAllPkScript []byte
+	sendAllIndex := 0
+	for index, recipient := range recipients(args) {
+		address, err := account.coin.DecodeAddress(recipient.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := address.(*btcutil.AddressTaproot); ok {
+			keystore := account.Config().Keystore
+			if keystore != nil && !keystore.SupportsPaymentsToTaproot() {
+				return nil, nil, errp.WithStack(errors.ErrInvalidAddress)
+			}
+		}
+		pkScript, err := taproot.PayToAddrScript(address)
+		if err != nil {
+			return nil, nil, errp.WithStack(err)
+		}
+		if recipient.Amount.SendAll() {
+			if sendAllPkScript != nil {
+				// Only one recipient can receive the remaining funds.
+				return nil, nil, errp.WithStack(errors.ErrInvalidAmount)
+			}
+			sendAllPkScript = pkScript
+			sendAllIndex = index
+			continue
+		}
+		allowZero := false
+		parsedAmount, err := recipient.Amount.Amount(big.NewInt(unitSatoshi), allowZero)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsedAmountInt64, err := parsedAmount.Int64()
+		if err != nil {
+			return nil, nil, errp.WithStack(errors.ErrInvalidAmount)
+		}
+		outputs = append(outputs, wire.NewTxOut(parsedAmountInt64, pkScript))
 	}
 	utxo := account.transactions.SpendableOutputs()
 	wireUTXO := make(map[wire.OutPoint]maketx.UTXO, len(utxo))
 	for outPoint, txOut := range utxo {
-		// Apply coin control.
+		// Apply coin control. Frozen coins are only spent if they are selected explicitly.
 		if len(args.SelectedUTXOs) != 0 {
 			if _, ok := args.SelectedUTXOs[outPoint]; !ok {
 				continue
 			}
+		} else if account.isUTXOFrozen(outPoint) {
+			continue
 		}
 		wireUTXO[outPoint] = maketx.UTXO{
 			TxOut: txOut.TxOut,
 			Configuration: account.getAddress(
 				blockchain.NewScriptHashHex(txOut.TxOut.PkScript)).Configuration,
+			Height: txOut.Height,
 		}
 	}
 	feeRatePerKb, err := account.getFeePerKb(args)
@@ -105,34 +149,35 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (
 	}
 
 	var txProposal *maketx.TxProposal
-	if args.Amount.SendAll() {
+	if sendAllPkScript != nil {
 		txProposal, err = maketx.NewTxSpendAll(
 			account.coin,
 			wireUTXO,
-			pkScript,
+			outputs,
+			sendAllPkScript,
 			feeRatePerKb,
 			account.log,
 		)
 		if err != nil {
 			return nil, nil, err
 		}
+		// Move the output receiving the remaining funds to the position of its recipient.
+		remainderOutput := txProposal.Outputs[len(txProposal.Outputs)-1]
+		copy(txProposal.Outputs[sendAllIndex+1:], txProposal.Outputs[sendAllIndex:])
+		txProposal.Outputs[sendAllIndex] = remainderOutput
 	} else {
-		allowZero := false
-		parsedAmount, err := args.Amount.Amount(big.NewInt(unitSatoshi), allowZero)
+		coinSelection, err := maketx.NewCoinSelection(args.CoinSelection)
 		if err != nil {
 			return nil, nil, err
 		}
-		parsedAmountInt64, err := parsedAmount.Int64()
-		if err != nil {
-			return nil, nil, errp.WithStack(errors.ErrInvalidAmount)
-		}
 		txProposal, err = maketx.NewTx(
 			account.coin,
 			wireUTXO,
-			wire.NewTxOut(parsedAmountInt64, pkScript),
+			outputs,
 			feeRatePerKb,
 			// Change address is of the first subaccount, always.
 			account.subaccounts[0].changeAddresses.GetUnused()[0],
+			coinSelection,
 			account.log,
 		)
 		if err != nil {
@@ -144,7 +189,9 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (
 	return utxo, txProposal, nil
 }
 
-func (account *Account) getAddress(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+// lookupAddress returns the account address with the given script hash, or nil if the address does
+// not belong to this account.
+func (account *Account) lookupAddress(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
 	for _, subacc := range account.subaccounts {
 		if address := subacc.receiveAddresses.LookupByScriptHashHex(scriptHashHex); address != nil {
 			return address
@@ -153,13 +200,55 @@ func (account *Account) getAddress(scriptHashHex blockchain.ScriptHashHex) *addr
 			return address
 		}
 	}
+	return nil
+}
+
+func (account *Account) getAddress(scriptHashHex blockchain.ScriptHashHex) *addresses.AccountAddress {
+	if address := account.lookupAddress(scriptHashHex); address != nil {
+		return address
+	}
 	panic("address must be present")
 }
 
+// fetchPrevTx fetches the transaction with the given hash from the blockchain backend.
+func (account *Account) fetchPrevTx(txHash chainhash.Hash) (*wire.MsgTx, error) {
+	txChan := make(chan *wire.MsgTx, 1)
+	errChan := make(chan error, 1)
+	account.coin.Blockchain().TransactionGet(txHash,
+		func(tx *wire.MsgTx) {
+			txChan <- tx
+		},
+		func(err error) {
+			if err != nil {
+				select {
+				case errChan <- err:
+				default:
+				}
+			}
+		},
+	)
+	select {
+	case tx := <-txChan:
+		return tx, nil
+	case err := <-errChan:
+		return nil, errp.WithMessage(err, "Failed to fetch the previous transaction")
+	}
+}
+
+// getPrevTx is like fetchPrevTx, but panics on error. It is used by the keystores during signing.
+func (account *Account) getPrevTx(txHash chainhash.Hash) *wire.MsgTx {
+	tx, err := account.fetchPrevTx(txHash)
+	if err != nil {
+		panic(err)
+	}
+	return tx
+}
+
 // SendTx implements accounts.Interface.
 func (account *Account) SendTx() error {
 	unlock := account.activeTxProposalLock.RLock()
 	txProposal := account.activeTxProposal
+	utxos := account.activeTxProposalPrevOutputs
 	unlock()
 	if txProposal == nil {
 		return errp.New("No active tx proposal")
@@ -167,23 +256,12 @@ func (account *Account) SendTx() error {
 
 	note := account.BaseAccount.GetAndClearProposedTxNote()
 
-	account.log.Info("Signing and sending transaction")
-	utxos := account.transactions.SpendableOutputs()
-	getPrevTx := func(txHash chainhash.Hash) *wire.MsgTx {
-		txChan := make(chan *wire.MsgTx)
-		account.coin.Blockchain().TransactionGet(txHash,
-			func(tx *wire.MsgTx) {
-				txChan <- tx
-			},
-			func(err error) {
-				if err != nil {
-					panic(err)
-				}
-			},
-		)
-		return <-txChan
+	if account.IsMultisig() {
+		return account.sendMultisigTx(txProposal, utxos, note)
 	}
-	if err := account.signTransaction(txProposal, utxos, getPrevTx); err != nil {
+
+	account.log.Info("Signing and sending transaction")
+	if err := account.signTransaction(txProposal, utxos, account.getPrevTx); err != nil {
 		return errp.WithMessage(err, "Failed to sign transaction")
 	}
 
@@ -208,15 +286,30 @@ func (account *Account) TxProposal(
 	defer account.activeTxProposalLock.Lock()()
 
 	account.log.Debug("Proposing transaction")
-	_, txProposal, err := account.newTx(args)
+	utxos, txProposal, err := account.newTx(args)
 	if err != nil {
 		return coin.Amount{}, coin.Amount{}, coin.Amount{}, err
 	}
 
 	account.activeTxProposal = txProposal
+	account.activeTxProposalPrevOutputs = utxos
 
 	account.log.WithField("fee", txProposal.Fee).Debug("Returning fee")
 	return coin.NewAmountFromInt64(int64(txProposal.Amount)),
 		coin.NewAmountFromInt64(int64(txProposal.Fee)),
 		coin.NewAmountFromInt64(int64(txProposal.Total())), nil
 }
+
+// TxProposalOutputAmounts returns the amounts paid to the recipients of the active tx proposal (see
+// TxProposal()), in the order of the recipients.
+func (account *Account) TxProposalOutputAmounts() ([]coin.Amount, error) {
+	defer account.activeTxProposalLock.RLock()()
+	if account.activeTxProposal == nil {
+		return nil, errp.New("No active tx proposal")
+	}
+	amounts := make([]coin.Amount, len(account.activeTxProposal.Outputs))
+	for i, output := range account.activeTxProposal.Outputs {
+		amounts[i] = coin.NewAmountFromInt64(output.Value)
+	}
+	return amounts, nil
+}
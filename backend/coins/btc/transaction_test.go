@@ -0,0 +1,112 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btc_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	accountsMock "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
+	blockchainMock "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	keystoreMock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/socksproxy"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAccount creates and initializes a testnet P2WPKH account using the given blockchain backend
+// and keystore. The returned function closes the account and removes its database.
+func newTestAccount(
+	t *testing.T, blockchainMock *blockchainMock.BlockchainMock, keystore keystore.Keystore,
+) (*btc.Account, func()) {
+	t.Helper()
+	net := &chaincfg.TestNet3Params
+	dbFolder := test.TstTempDir("btc-dbfolder")
+
+	btcCoin := btc.NewCoin(
+		coin.CodeTBTC, "Bitcoin Testnet", "TBTC", net, dbFolder, nil, explorer, socksproxy.NewSocksProxy(false, ""))
+	blockchainMock.MockRegisterOnConnectionErrorChangedEvent = func(f func(error)) {}
+	blockchainMock.MockRelayFee = func(success func(btcutil.Amount), _ func(error)) {
+		go success(btcutil.Amount(1000))
+	}
+	btcCoin.TstSetMakeBlockchain(func() blockchain.Interface { return blockchainMock })
+
+	keypath, err := signing.NewAbsoluteKeypath("m/84'/1'/0'")
+	require.NoError(t, err)
+	xpub, err := hdkeychain.NewMaster(make([]byte, 32), net)
+	require.NoError(t, err)
+	xpub, err = xpub.Neuter()
+	require.NoError(t, err)
+	notifier := &accountsMock.Notifier{}
+	notifier.On("Put", mock.Anything).Return(nil)
+
+	account := btc.NewAccount(
+		&accounts.AccountConfig{
+			Code:        "accountcode",
+			Name:        "accountname",
+			DBFolder:    dbFolder,
+			NotesFolder: dbFolder,
+			Keystore:    keystore,
+			OnEvent:     func(accounts.Event) {},
+			SigningConfigurations: signing.Configurations{signing.NewBitcoinConfiguration(
+				signing.ScriptTypeP2WPKH, []byte{1, 2, 3, 4}, keypath, xpub)},
+			GetNotifier: func(signing.Configurations) accounts.Notifier { return notifier },
+		},
+		btcCoin, nil,
+		logging.Get().WithGroup("transaction_test"),
+	)
+	require.NoError(t, account.Initialize())
+	return account, func() {
+		account.Close()
+		_ = os.RemoveAll(dbFolder)
+	}
+}
+
+func TestTxProposalTaprootRecipient(t *testing.T) {
+	supportsTaproot := false
+	keystore := &keystoreMock.KeystoreMock{
+		SupportsPaymentsToTaprootFunc: func() bool { return supportsTaproot },
+	}
+	account, cleanup := newTestAccount(t, &blockchainMock.BlockchainMock{}, keystore)
+	defer cleanup()
+
+	args := &accounts.TxProposalArgs{
+		RecipientAddress: "tb1pjztz7uh0yla5f4ts7pq3en7k8xa98wnfnxt25tl6mpc33jl5av8sjrfnpf",
+		Amount:           coin.NewSendAmount("0.1"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "1",
+	}
+	_, _, _, err := account.TxProposal(args)
+	require.Equal(t, errors.ErrInvalidAddress, errp.Cause(err))
+
+	// With a keystore which can sign payments to taproot, the address is accepted and the
+	// proposal fails only because the account has no funds.
+	supportsTaproot = true
+	_, _, _, err = account.TxProposal(args)
+	require.Equal(t, errors.ErrInsufficientFunds, errp.Cause(err))
+}
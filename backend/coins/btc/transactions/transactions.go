@@ -26,7 +26,9 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/blockchain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/synchronizer"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
 	"github.com/sirupsen/logrus"
 )
@@ -35,6 +37,8 @@ import (
 type SpendableOutput struct {
 	*wire.TxOut
 	Address string
+	// Height is the height of the block containing the output, or 0 if it is unconfirmed.
+	Height int
 }
 
 // ScriptHashHex returns the hash of the PkScript of the output, in hex format.
@@ -64,7 +68,9 @@ type Transactions struct {
 	synchronizer *synchronizer.Synchronizer
 	blockchain   blockchain.Interface
 	notifier     accounts.Notifier
-	log          *logrus.Entry
+	// isFrozen returns true if the user froze the output, excluding it from the available balance.
+	isFrozen func(wire.OutPoint) bool
+	log      *logrus.Entry
 
 	closed     bool
 	closedLock locker.Locker
@@ -78,6 +84,7 @@ func NewTransactions(
 	synchronizer *synchronizer.Synchronizer,
 	blockchain blockchain.Interface,
 	notifier accounts.Notifier,
+	isFrozen func(wire.OutPoint) bool,
 	log *logrus.Entry,
 ) *Transactions {
 	transactions := &Transactions{
@@ -90,6 +97,7 @@ func NewTransactions(
 		synchronizer: synchronizer,
 		blockchain:   blockchain,
 		notifier:     notifier,
+		isFrozen:     isFrozen,
 		log:          log.WithFields(logrus.Fields{"group": "transactions", "net": net.Name}),
 	}
 	transactions.unsubscribeHeadersEvent = headers.SubscribeEvent(transactions.onHeadersEvent)
@@ -196,6 +204,16 @@ func (transactions *Transactions) allInputsOurs(dbTx DBTxInterface, transaction
 // include all unspent outputs of confirmed transactions, and unconfirmed outputs that we created
 // ourselves.
 func (transactions *Transactions) SpendableOutputs() map[wire.OutPoint]*SpendableOutput {
+	return transactions.spendableOutputs(false)
+}
+
+// ConfirmedSpendableOutputs is like SpendableOutputs(), but only returns outputs of confirmed
+// transactions.
+func (transactions *Transactions) ConfirmedSpendableOutputs() map[wire.OutPoint]*SpendableOutput {
+	return transactions.spendableOutputs(true)
+}
+
+func (transactions *Transactions) spendableOutputs(onlyConfirmed bool) map[wire.OutPoint]*SpendableOutput {
 	transactions.synchronizer.WaitSynchronized()
 	defer transactions.RLock()()
 
@@ -218,16 +236,131 @@ func (transactions *Transactions) SpendableOutputs() map[wire.OutPoint]*Spendabl
 		confirmed := txInfo.Height > 0
 
 		spent := transactions.isInputSpent(dbTx, outPoint)
-		if !spent && (confirmed || transactions.allInputsOurs(dbTx, txInfo.Tx)) {
+		if !spent && (confirmed || (!onlyConfirmed && transactions.allInputsOurs(dbTx, txInfo.Tx))) {
 			result[outPoint] = &SpendableOutput{
 				TxOut:   txOut,
 				Address: transactions.outputToAddress(txOut.PkScript),
+				Height:  txInfo.Height,
 			}
 		}
 	}
 	return result
 }
 
+// ReplaceableTx returns the unconfirmed transaction with the given hash along with the outputs it
+// spends, if all of them belong to the wallet. Only such transactions can be replaced by us with a
+// transaction paying a higher fee (BIP-125 replace-by-fee).
+//
+// An error is returned if our outputs of the transaction are spent, as the replacement would also
+// have to pay for the fees of the spending transactions (BIP-125 rule 3).
+func (transactions *Transactions) ReplaceableTx(txHash chainhash.Hash) (
+	*wire.MsgTx, map[wire.OutPoint]*SpendableOutput, error) {
+	transactions.synchronizer.WaitSynchronized()
+	defer transactions.RLock()()
+
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dbTx.Rollback()
+
+	txInfo, err := dbTx.TxInfo(txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if txInfo == nil || txInfo.Tx == nil {
+		return nil, nil, errp.New("Transaction not found")
+	}
+	if txInfo.Height > 0 {
+		return nil, nil, errp.New("Transaction is already confirmed")
+	}
+	spentOutputs := make(map[wire.OutPoint]*SpendableOutput, len(txInfo.Tx.TxIn))
+	for _, txIn := range txInfo.Tx.TxIn {
+		txOut, err := dbTx.Output(txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		if txOut == nil {
+			return nil, nil, errp.New("Only transactions spending from this account can be replaced")
+		}
+		spentOutputs[txIn.PreviousOutPoint] = &SpendableOutput{
+			TxOut:   txOut,
+			Address: transactions.outputToAddress(txOut.PkScript),
+		}
+	}
+	for index := range txInfo.Tx.TxOut {
+		if transactions.isInputSpent(dbTx, wire.OutPoint{Hash: txHash, Index: uint32(index)}) {
+			return nil, nil, errp.New("The transaction can't be replaced, its outputs are spent")
+		}
+	}
+	return txInfo.Tx, spentOutputs, nil
+}
+
+// AcceleratableTx returns the unconfirmed transaction with the given hash together with its
+// details and our unspent outputs of it, which can be spent by a child transaction to accelerate
+// the confirmation of the transaction (child-pays-for-parent). An error is returned if the
+// transaction is unknown, already confirmed or has no unspent outputs belonging to us.
+//
+// An error is also returned if the transaction spends unconfirmed outputs, as the fee of the child
+// would then have to pay for the unconfirmed ancestors too, which are not known in general.
+func (transactions *Transactions) AcceleratableTx(txHash chainhash.Hash) (
+	*wire.MsgTx, *accounts.TransactionData, map[wire.OutPoint]*SpendableOutput, error) {
+	transactions.synchronizer.WaitSynchronized()
+	defer transactions.RLock()()
+
+	dbTx, err := transactions.db.Begin()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer dbTx.Rollback()
+
+	txInfo, err := dbTx.TxInfo(txHash)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if txInfo == nil || txInfo.Tx == nil {
+		return nil, nil, nil, errp.New("Transaction not found")
+	}
+	if txInfo.Height > 0 {
+		return nil, nil, nil, errp.New("Transaction is already confirmed")
+	}
+	// A negative height means that the transaction has unconfirmed inputs, see blockchain.TxInfo.
+	// The backend might not know it if the inputs are not ours, so our inputs are checked too.
+	hasUnconfirmedInputs := txInfo.Height < 0
+	for _, txIn := range txInfo.Tx.TxIn {
+		prevTxInfo, err := dbTx.TxInfo(txIn.PreviousOutPoint.Hash)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if prevTxInfo != nil && prevTxInfo.Tx != nil && prevTxInfo.Height <= 0 {
+			hasUnconfirmedInputs = true
+		}
+	}
+	if hasUnconfirmedInputs {
+		return nil, nil, nil, errp.New("The transaction spends unconfirmed outputs and can't be accelerated")
+	}
+	outputs := map[wire.OutPoint]*SpendableOutput{}
+	for index := range txInfo.Tx.TxOut {
+		outPoint := wire.OutPoint{Hash: txHash, Index: uint32(index)}
+		txOut, err := dbTx.Output(outPoint)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if txOut == nil || transactions.isInputSpent(dbTx, outPoint) {
+			continue
+		}
+		outputs[outPoint] = &SpendableOutput{
+			TxOut:   txOut,
+			Address: transactions.outputToAddress(txOut.PkScript),
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, nil, nil, errp.New("The transaction has no unspent outputs belonging to this account")
+	}
+	txData := transactions.txInfo(dbTx, txInfo, func(blockchain.ScriptHashHex) bool { return false })
+	return txInfo.Tx, txData, outputs, nil
+}
+
 func (transactions *Transactions) isInputSpent(dbTx DBTxInterface, outPoint wire.OutPoint) bool {
 	input, err := dbTx.Input(outPoint)
 	if err != nil {
@@ -382,6 +515,10 @@ func (transactions *Transactions) Balance() *accounts.Balance {
 		}
 		confirmed := txInfo.Height > 0
 		if confirmed || transactions.allInputsOurs(dbTx, txInfo.Tx) {
+			// Frozen outputs are not spendable.
+			if transactions.isFrozen(outPoint) {
+				continue
+			}
 			available += txOut.Value
 		} else {
 			incoming += txOut.Value
@@ -391,6 +528,13 @@ func (transactions *Transactions) Balance() *accounts.Balance {
 }
 
 func (transactions *Transactions) outputToAddress(pkScript []byte) string {
+	if taproot.IsPayToTaproot(pkScript) {
+		address, err := btcutil.NewAddressTaproot(pkScript[2:], transactions.net)
+		if err != nil {
+			return "<unknown address>"
+		}
+		return address.String()
+	}
 	_, extractedAddresses, _, err := txscript.ExtractPkScriptAddrs(pkScript, transactions.net)
 	// unknown addresses and multisig scripts ignored.
 	if err != nil || len(extractedAddresses) != 1 {
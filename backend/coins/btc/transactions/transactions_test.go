@@ -91,6 +91,7 @@ type transactionsSuite struct {
 	headersMock    *headersMock.Interface
 	notifierMock   *accountsMock.Notifier
 	transactions   *transactions.Transactions
+	frozen         map[wire.OutPoint]bool
 
 	log *logrus.Entry
 }
@@ -110,6 +111,7 @@ func (s *transactionsSuite) SetupTest() {
 	s.headersMock.On("SubscribeEvent", mock.AnythingOfType("func(headers.Event)")).Return(func() {})
 	s.headersMock.On("TipHeight").Return(15).Once()
 	s.notifierMock = &accountsMock.Notifier{}
+	s.frozen = map[wire.OutPoint]bool{}
 	s.transactions = transactions.NewTransactions(
 		s.net,
 		db,
@@ -117,6 +119,7 @@ func (s *transactionsSuite) SetupTest() {
 		s.synchronizer,
 		s.blockchainMock,
 		s.notifierMock,
+		func(outPoint wire.OutPoint) bool { return s.frozen[outPoint] },
 		s.log,
 	)
 }
@@ -175,6 +178,7 @@ func (s *transactionsSuite) TestUpdateAddressHistorySingleTxReceive() {
 	utxo := &transactions.SpendableOutput{
 		TxOut:   wire.NewTxOut(int64(expectedAmount), address.PubkeyScript()),
 		Address: "n4PBA1ARca4UcMBnssfFpkF7LraS58SZ4y",
+		Height:  expectedHeight,
 	}
 	require.Equal(s.T(),
 		map[wire.OutPoint]*transactions.SpendableOutput{
@@ -249,6 +253,134 @@ func (s *transactionsSuite) TestSpendableOutputs() {
 	require.Contains(s.T(), spendableOutputs, wire.OutPoint{Hash: tx22Spend.TxHash(), Index: 0})
 }
 
+// TestReplaceableTx checks that only unconfirmed txs spending our own outputs can be replaced, and
+// that unconfirmed outputs are not available to add to a replacement.
+func (s *transactionsSuite) TestReplaceableTx() {
+	addresses := s.addressChain.EnsureAddresses()
+	address1 := addresses[0]
+	address2 := addresses[1]
+	address3 := addresses[2]
+	tx1 := newTx(chainhash.HashH(nil), 0, address1, 1000)
+	tx2 := newTx(chainhash.HashH(nil), 1, address2, 2000)
+	s.blockchainMock.RegisterTxs(tx1, tx2)
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(nil, nil).Once()
+	s.updateAddressHistory(address1, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1.TxHash()), Height: 10},
+	})
+	s.updateAddressHistory(address2, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx2.TxHash()), Height: 0},
+	})
+	require.Equal(s.T(), s.transactions.SpendableOutputs(), s.transactions.ConfirmedSpendableOutputs())
+
+	// Confirmed.
+	_, _, err := s.transactions.ReplaceableTx(tx1.TxHash())
+	require.Error(s.T(), err)
+	// Incoming, the input is not ours.
+	_, _, err = s.transactions.ReplaceableTx(tx2.TxHash())
+	require.Error(s.T(), err)
+	// Unknown.
+	_, _, err = s.transactions.ReplaceableTx(chainhash.HashH([]byte("unknown")))
+	require.Error(s.T(), err)
+
+	// Unconfirmed spend to ourselves.
+	tx1Spend := newTx(tx1.TxHash(), 0, address3, 900)
+	s.blockchainMock.RegisterTxs(tx1Spend)
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(nil, nil).Once()
+	s.updateAddressHistory(address1, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchainpkg.TXHash(tx1Spend.TxHash()), Height: 0},
+	})
+	s.updateAddressHistory(address3, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1Spend.TxHash()), Height: 0},
+	})
+	require.Contains(s.T(), s.transactions.SpendableOutputs(), wire.OutPoint{Hash: tx1Spend.TxHash(), Index: 0})
+	tx, spentOutputs, err := s.transactions.ReplaceableTx(tx1Spend.TxHash())
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), tx1Spend.TxHash(), tx.TxHash())
+	require.Equal(s.T(),
+		map[wire.OutPoint]*transactions.SpendableOutput{
+			{Hash: tx1.TxHash(), Index: 0}: {
+				TxOut:   wire.NewTxOut(1000, address1.PubkeyScript()),
+				Address: address1.EncodeForHumans(),
+			},
+		},
+		spentOutputs,
+	)
+	require.Empty(s.T(), s.transactions.ConfirmedSpendableOutputs())
+
+	// Our output of it is spent by another unconfirmed tx.
+	tx1SpendSpend := newTx(tx1Spend.TxHash(), 0, address3, 800)
+	s.blockchainMock.RegisterTxs(tx1SpendSpend)
+	s.updateAddressHistory(address3, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1Spend.TxHash()), Height: 0},
+		{TXHash: blockchainpkg.TXHash(tx1SpendSpend.TxHash()), Height: -1},
+	})
+	_, _, err = s.transactions.ReplaceableTx(tx1Spend.TxHash())
+	require.Error(s.T(), err)
+}
+
+// TestAcceleratableTx checks that our unspent outputs of unconfirmed txs are returned to be spent by
+// a child tx.
+func (s *transactionsSuite) TestAcceleratableTx() {
+	addresses := s.addressChain.EnsureAddresses()
+	address1 := addresses[0]
+	address2 := addresses[1]
+	tx1 := newTx(chainhash.HashH(nil), 0, address1, 1000)
+	tx2 := newTx(chainhash.HashH(nil), 1, address2, 2000)
+	s.blockchainMock.RegisterTxs(tx1, tx2)
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(nil, nil).Once()
+	s.updateAddressHistory(address1, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1.TxHash()), Height: 10},
+	})
+	s.updateAddressHistory(address2, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx2.TxHash()), Height: 0},
+	})
+
+	// Confirmed.
+	_, _, _, err := s.transactions.AcceleratableTx(tx1.TxHash())
+	require.Error(s.T(), err)
+	// Unknown.
+	_, _, _, err = s.transactions.AcceleratableTx(chainhash.HashH([]byte("unknown")))
+	require.Error(s.T(), err)
+
+	tx, txData, outputs, err := s.transactions.AcceleratableTx(tx2.TxHash())
+	require.NoError(s.T(), err)
+	require.Equal(s.T(), tx2.TxHash(), tx.TxHash())
+	require.Equal(s.T(), accounts.TxTypeReceive, txData.Type)
+	require.Nil(s.T(), txData.FeeRatePerKb)
+	require.NotZero(s.T(), txData.VSize)
+	require.Equal(s.T(),
+		map[wire.OutPoint]*transactions.SpendableOutput{
+			{Hash: tx2.TxHash(), Index: 0}: {
+				TxOut:   wire.NewTxOut(2000, address2.PubkeyScript()),
+				Address: address2.EncodeForHumans(),
+			},
+		},
+		outputs,
+	)
+
+	// The parent has unconfirmed inputs, reported by the backend.
+	tx3 := newTx(chainhash.HashH([]byte("unconfirmed")), 0, address2, 3000)
+	s.blockchainMock.RegisterTxs(tx3)
+	s.updateAddressHistory(address2, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx2.TxHash()), Height: 0},
+		{TXHash: blockchainpkg.TXHash(tx3.TxHash()), Height: -1},
+	})
+	_, _, _, err = s.transactions.AcceleratableTx(tx3.TxHash())
+	require.Error(s.T(), err)
+
+	// The parent spends one of our unconfirmed outputs.
+	tx2Spend := newTx(tx2.TxHash(), 0, address1, 1900)
+	s.blockchainMock.RegisterTxs(tx2Spend)
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(nil, nil).Once()
+	s.updateAddressHistory(address1, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchainpkg.TXHash(tx2Spend.TxHash()), Height: 0},
+	})
+	_, _, _, err = s.transactions.AcceleratableTx(tx2Spend.TxHash())
+	require.Error(s.T(), err)
+}
+
 func (s *transactionsSuite) TestBalance() {
 	require.Equal(s.T(), newBalance(0, 0), s.transactions.Balance())
 	addresses := s.addressChain.EnsureAddresses()
@@ -309,6 +441,26 @@ func (s *transactionsSuite) TestBalance() {
 		s.transactions.Balance())
 }
 
+// TestBalanceFrozen checks that frozen outputs do not count towards the available balance.
+func (s *transactionsSuite) TestBalanceFrozen() {
+	addresses := s.addressChain.EnsureAddresses()
+	address := addresses[0]
+	tx1 := newTx(chainhash.HashH(nil), 0, address, 123)
+	tx2 := newTx(chainhash.HashH(nil), 1, address, 456)
+	s.blockchainMock.RegisterTxs(tx1, tx2)
+	s.headersMock.On("VerifiedHeaderByHeight", 10).Return(nil, nil)
+	s.updateAddressHistory(address, []*blockchainpkg.TxInfo{
+		{TXHash: blockchainpkg.TXHash(tx1.TxHash()), Height: 10},
+		{TXHash: blockchainpkg.TXHash(tx2.TxHash()), Height: 10},
+	})
+	require.Equal(s.T(), newBalance(579, 0), s.transactions.Balance())
+
+	s.frozen[wire.OutPoint{Hash: tx1.TxHash(), Index: 0}] = true
+	require.Equal(s.T(), newBalance(456, 0), s.transactions.Balance())
+	// Frozen outputs are still listed as spendable, so they can be selected manually.
+	require.Len(s.T(), s.transactions.SpendableOutputs(), 2)
+}
+
 func (s *transactionsSuite) TestRemoveTransaction() {
 	addresses := s.addressChain.EnsureAddresses()
 	address1 := addresses[0]
@@ -24,6 +24,8 @@ const (
 	CodeTBTC Code = "tbtc"
 	// CodeRBTC is Bitcoin Regtest.
 	CodeRBTC Code = "rbtc"
+	// CodeSBTC is Bitcoin Signet.
+	CodeSBTC Code = "sbtc"
 	// CodeLTC is Litecoin.
 	CodeLTC Code = "ltc"
 	// CodeTLTC is Litecoin Testnet.
@@ -43,6 +45,7 @@ const (
 // TestnetCoins is the subset of all coins which are available in testnet mode.
 var TestnetCoins = map[Code]struct{}{
 	CodeTBTC:      {},
+	CodeSBTC:      {},
 	CodeTLTC:      {},
 	CodeTETH:      {},
 	CodeRETH:      {},
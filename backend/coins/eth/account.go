@@ -17,12 +17,12 @@ package eth
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math/big"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"time"
 
@@ -30,6 +30,8 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/db"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/eip712"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/ens"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
@@ -39,6 +41,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sirupsen/logrus"
@@ -46,9 +49,17 @@ import (
 
 var pollInterval = 60 * time.Second
 
-// ethGasStationAPIKey is used to access the API of https://ethgasstation.info.
-// See https://docs.ethgasstation.info/.
-const ethGasStationAPIKey = "3a61bee56f554cc14db4f49e2ace053b3086d3c323aefec83e5ff25ca485"
+// ensNameCacheTTL is how long the result of a reverse ENS lookup is cached, also if the address
+// has no name or the lookup failed, so the same address is not looked up again on every update.
+const ensNameCacheTTL = 10 * time.Minute
+
+// ensNameTimeout limits the duration of a reverse ENS lookup.
+const ensNameTimeout = 10 * time.Second
+
+type ensNameCacheEntry struct {
+	name    string
+	expires time.Time
+}
 
 func isMixedCase(s string) bool {
 	return strings.ToLower(s) != s && strings.ToUpper(s) != s
@@ -78,12 +89,24 @@ type Account struct {
 	balance     coin.Amount
 	blockNumber *big.Int
 
+	// feeTargetsCache are the fee targets computed at the block feeTargetsCacheHeight, so that the
+	// fee history is fetched at most once per block.
+	feeTargetsCache       []*feeTarget
+	feeTargetsCacheHeight uint64
+	feeTargetsCacheLock   locker.Locker
+
 	// if not nil, SendTx() will sign and send this transaction. Set by TxProposal().
 	activeTxProposal     *TxProposal
 	activeTxProposalLock locker.Locker
 
 	nextNonce    uint64
 	transactions []*accounts.TransactionData
+	// nonceIssues are the problems found when reconciling the nonces, see reconcileNonces().
+	nonceIssues []NonceIssue
+
+	// ensNames caches the results of ENSName(), see ensNameCacheTTL.
+	ensNames     map[ethcommon.Address]ensNameCacheEntry
+	ensNamesLock locker.Locker
 
 	quitChan chan struct{}
 
@@ -112,6 +135,8 @@ func NewAccount(
 		enqueueUpdateCh: make(chan struct{}),
 		quitChan:        make(chan struct{}),
 
+		ensNames: map[ethcommon.Address]ensNameCacheEntry{},
+
 		log: log,
 	}
 
@@ -237,6 +262,10 @@ func (account *Account) updateOutgoingTransactions(tipHeight uint64) {
 	for idx, tx := range outgoingTransactions {
 		txLog := account.log.WithField("idx", idx)
 		remoteTx, err := account.coin.client.TransactionReceiptWithBlockNumber(context.TODO(), tx.Transaction.Hash())
+		if (remoteTx == nil || err != nil) && tx.ReplacedBy != nil {
+			// Replaced transactions are not rebroadcast.
+			continue
+		}
 		if remoteTx == nil || err != nil {
 			// Transaction not found. This usually happens for pending transactions.
 			// In this case, check if the node actually knows about the transaction, and if not, re-broadcast.
@@ -249,7 +278,7 @@ func (account *Account) updateOutgoingTransactions(tipHeight uint64) {
 					txLog.WithError(err).Error("could not update outgoing tx")
 					// Do not abort here, we want to attempt broadcastng the tx in any case.
 				}
-				if err := account.coin.client.SendTransaction(context.TODO(), tx.Transaction); err != nil {
+				if err := account.broadcast(tx.Transaction); err != nil {
 					txLog.WithError(err).Error("failed to broadcast")
 					continue
 				}
@@ -258,16 +287,43 @@ func (account *Account) updateOutgoingTransactions(tipHeight uint64) {
 			continue
 		}
 		success := remoteTx.Status == types.ReceiptStatusSuccessful
+		if tx.ReplacedBy != nil {
+			// The replaced transaction was mined before its replacement.
+			txLog.Info("replaced transaction was confirmed")
+			tx.ReplacedBy = nil
+		}
 		if tx.Height == 0 || (tipHeight-remoteTx.BlockNumber) < ethtypes.NumConfirmationsComplete || tx.Success != success {
 			tx.Height = remoteTx.BlockNumber
 			tx.GasUsed = remoteTx.GasUsed
 			tx.Success = success
+			tx.EffectiveGasPrice = remoteTx.EffectiveGasPrice
+			if legacyTx, ok := tx.Transaction.(*types.Transaction); ok && tx.EffectiveGasPrice == nil {
+				tx.EffectiveGasPrice = legacyTx.GasPrice()
+			}
 			if err := dbTx.PutOutgoingTransaction(tx); err != nil {
 				txLog.WithError(err).Error("could not update outgoing tx")
 				continue
 			}
 		}
 	}
+	// Pending transactions with the nonce of a confirmed transaction can never be confirmed. This
+	// happens if a transaction was mined before its replacement.
+	confirmedByNonce := map[uint64]*ethtypes.TransactionWithMetadata{}
+	for _, tx := range outgoingTransactions {
+		if tx.Height > 0 {
+			confirmedByNonce[tx.Transaction.Nonce()] = tx
+		}
+	}
+	for _, tx := range outgoingTransactions {
+		confirmedTx, ok := confirmedByNonce[tx.Transaction.Nonce()]
+		if !ok || tx.Height > 0 || tx.ReplacedBy != nil {
+			continue
+		}
+		if err := dbTx.MarkOutgoingTransactionReplaced(
+			tx.Transaction.Hash(), confirmedTx.Transaction.Hash()); err != nil {
+			account.log.WithError(err).Error("could not mark outgoing tx as replaced")
+		}
+	}
 	if err := dbTx.Commit(); err != nil {
 		account.log.WithError(err).Error("could not commit db tx")
 		return
@@ -299,6 +355,10 @@ func (account *Account) outgoingTransactions(allTxs []*accounts.TransactionData)
 		if _, ok := allTxHashes[tx.TxID()]; ok {
 			continue
 		}
+		// Skip replaced txs, they will never be confirmed.
+		if tx.ReplacedBy != nil {
+			continue
+		}
 		transactions = append(transactions, tx)
 	}
 	return transactions, nil
@@ -336,21 +396,31 @@ func (account *Account) update() error {
 		return err
 	}
 
-	// Nonce to be used for the next tx, fetched from the ETH node. It might be out of date due to
-	// latency, which is addressed below by using the locally stored nonce.
-	nodeNonce, err := account.coin.client.PendingNonceAt(context.TODO(), account.address.Address)
+	// The node's nonces might be out of date due to latency, or miss transactions dropped from the
+	// mempool, which is addressed by reconciling them with our stored outgoing transactions.
+	confirmedNonce, err := account.coin.client.NonceAt(context.TODO(), account.address.Address, nil)
 	if err != nil {
 		return err
 	}
-	account.nextNonce = nodeNonce
-
-	// In case the nodeNonce is not up to date, we fall back to our stored last nonce to compute the
-	// next nonce.
-	if len(outgoingTransactions) > 0 {
-		localNonce := outgoingTransactions[len(outgoingTransactions)-1].Transaction.Nonce() + 1
-		if localNonce > account.nextNonce {
-			account.nextNonce = localNonce
+	pendingNonce, err := account.coin.client.PendingNonceAt(context.TODO(), account.address.Address)
+	if err != nil {
+		return err
+	}
+	accountsOutgoingTransactions.set(account, outgoingTransactions)
+	nonces := reconcileNonces(
+		outgoingTransactions,
+		accountsOutgoingTransactions.others(account),
+		confirmedNonce,
+		pendingNonce)
+	account.nextNonce = nonces.nextNonce
+	if !reflect.DeepEqual(nonces.issues, account.nonceIssues) {
+		if len(nonces.issues) > 0 {
+			account.log.Warningf("nonce issues: %+v", nonces.issues)
 		}
+		unlock := account.Lock()
+		account.nonceIssues = nonces.issues
+		unlock()
+		account.Config().OnEvent(accounts.EventStatusChanged)
 	}
 	outgoingTransactionsData := make([]*accounts.TransactionData, len(outgoingTransactions))
 	for i, tx := range outgoingTransactions {
@@ -359,7 +429,9 @@ func (account *Account) update() error {
 			account.coin.erc20Token,
 		)
 	}
-	account.transactions = append(outgoingTransactionsData, confirmedTansactions...)
+	transactions := append(outgoingTransactionsData, confirmedTansactions...)
+	account.addENSNames(transactions)
+	account.transactions = transactions
 	for _, transaction := range account.transactions {
 		if err := account.notifier.Put([]byte(transaction.TxID)); err != nil {
 			return err
@@ -388,6 +460,23 @@ func (account *Account) update() error {
 	return nil
 }
 
+// addENSNames sets the verified ENS name of the addresses in the transactions, if available. The
+// names are cached, see ENSName().
+func (account *Account) addENSNames(transactions []*accounts.TransactionData) {
+	for _, transaction := range transactions {
+		for i, addressAndAmount := range transaction.Addresses {
+			if !ethcommon.IsHexAddress(addressAndAmount.Address) {
+				continue
+			}
+			name, err := account.ENSName(addressAndAmount.Address)
+			if err != nil {
+				continue
+			}
+			transaction.Addresses[i].Name = name
+		}
+	}
+}
+
 // FatalError implements accounts.Interface.
 func (account *Account) FatalError() bool {
 	return false
@@ -406,6 +495,7 @@ func (account *Account) Close() {
 		account.log.Info("Closed DB")
 	}
 	close(account.quitChan)
+	accountsOutgoingTransactions.remove(account)
 	account.Config().OnEvent(accounts.EventStatusChanged)
 }
 
@@ -429,28 +519,67 @@ func (account *Account) Balance() (*accounts.Balance, error) {
 // TxProposal holds all info needed to create and sign a transacstion.
 type TxProposal struct {
 	Coin coin.Coin
-	Tx   *types.Transaction
-	Fee  *big.Int
+	// Tx is either a legacy *types.Transaction or an EIP-1559 *ethtypes.DynamicFeeTx.
+	Tx  ethtypes.Transaction
+	Fee *big.Int
 	// Value can be the same as Tx.Value(), but in case of e.g. ERC20, tx.Value() is zero, while the
 	// Token value is encoded in the contract input data.
 	Value *big.Int
-	// Signer contains the sighash algo, which depends on the block number.
+	// Signer contains the sighash algo, which depends on the block number. Only used for legacy
+	// transactions.
 	Signer types.Signer
 	// KeyPath is the location of this account's address/pubkey/privkey.
 	Keypath signing.AbsoluteKeypath
+	// RecipientAddress is the address receiving the funds. For ERC20 transfers, this is the token
+	// recipient, not the contract address.
+	RecipientAddress ethcommon.Address
+	// RecipientName is the ENS name the recipient address was resolved from, if the user entered
+	// one. Empty otherwise.
+	RecipientName string
 }
 
-func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error) {
-	if !ethcommon.IsHexAddress(args.RecipientAddress) {
-		return nil, errp.WithStack(errors.ErrInvalidAddress)
+// recipientAddress parses the recipient, which is either a hex address or an ENS name. In the
+// latter case, the resolved address and the normalized name are returned.
+func (account *Account) recipientAddress(recipient string) (ethcommon.Address, string, error) {
+	if ens.IsName(recipient) {
+		resolver := account.coin.ENSResolver()
+		if resolver == nil {
+			return ethcommon.Address{}, "", errp.WithStack(errors.ErrInvalidAddress)
+		}
+		address, err := resolver.Resolve(context.TODO(), recipient)
+		if errp.Cause(err) == ens.ErrNotFound {
+			return ethcommon.Address{}, "", errp.WithStack(errors.ErrENSNameNotFound)
+		}
+		if err != nil {
+			return ethcommon.Address{}, "", err
+		}
+		return address, ens.Normalize(recipient), nil
+	}
+	if !ethcommon.IsHexAddress(recipient) {
+		return ethcommon.Address{}, "", errp.WithStack(errors.ErrInvalidAddress)
 	}
-	address := ethcommon.HexToAddress(args.RecipientAddress)
+	address := ethcommon.HexToAddress(recipient)
 	// Validate checksum if the address is mixed case, see https://github.com/ethereum/EIPs/blob/master/EIPS/eip-55.md
-	if isMixedCase(args.RecipientAddress) && args.RecipientAddress != address.Hex() {
-		return nil, errp.WithStack(errors.ErrInvalidAddress)
+	if isMixedCase(recipient) && recipient != address.Hex() {
+		return ethcommon.Address{}, "", errp.WithStack(errors.ErrInvalidAddress)
+	}
+	return address, "", nil
+}
+
+func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error) {
+	if len(args.Recipients) > 1 {
+		return nil, errp.New("Ethereum transactions can only have one recipient")
+	}
+	if len(args.Recipients) == 1 {
+		args.RecipientAddress = args.Recipients[0].Address
+		args.Amount = args.Recipients[0].Amount
+	}
+	address, recipientName, err := account.recipientAddress(args.RecipientAddress)
+	if err != nil {
+		return nil, err
 	}
 
-	suggestedGasPrice, err := account.gasPrice(args)
+	selectedFeeTarget, err := account.selectedFeeTarget(args)
 	if err != nil {
 		if _, ok := errp.Cause(err).(errors.TxValidationError); ok {
 			return nil, err
@@ -524,7 +653,14 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error
 		return nil, errp.WithStack(errors.TxValidationError(err.Error()))
 	}
 
-	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), suggestedGasPrice)
+	// For EIP-1559 transactions, the fee shown is the expected fee given the current base fee. The
+	// max fee per gas is higher so the transaction can still be included if the base fee rises.
+	dynamicFee := selectedFeeTarget.gasFeeCap != nil && account.supportsEIP1559()
+	var gasFeeCap *big.Int
+	if dynamicFee {
+		gasFeeCap = selectedFeeTarget.gasFeeCap
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), selectedFeeTarget.gasPrice)
 
 	// Adjust amount with fee
 	if account.coin.erc20Token != nil {
@@ -542,17 +678,43 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error
 			if message.Value.Sign() < 0 {
 				return nil, errp.WithStack(errors.ErrInsufficientFunds)
 			}
+			if dynamicFee {
+				// The node requires the balance to cover value + gas * maxFeePerGas, so there is
+				// no room for a base fee increase when sending everything.
+				gasFeeCap = selectedFeeTarget.gasPrice
+			}
 		} else {
 			// Check that the entered value and the estimated fee are not greater than the balance.
 			total := new(big.Int).Add(message.Value, fee)
 			if total.Cmp(account.balance.BigInt()) == 1 {
 				return nil, errp.WithStack(errors.ErrInsufficientFunds)
 			}
+			if dynamicFee {
+				// Lower the max fee per gas if the balance can't cover it.
+				maxGasFeeCap := new(big.Int).Sub(account.balance.BigInt(), message.Value)
+				maxGasFeeCap.Div(maxGasFeeCap, new(big.Int).SetUint64(gasLimit))
+				if gasFeeCap.Cmp(maxGasFeeCap) > 0 {
+					gasFeeCap = maxGasFeeCap
+				}
+			}
 		}
 	}
-	tx := types.NewTransaction(account.nextNonce,
-		*message.To,
-		message.Value, gasLimit, suggestedGasPrice, message.Data)
+	var tx ethtypes.Transaction
+	if dynamicFee {
+		tx = ethtypes.NewDynamicFeeTx(
+			account.coin.Net().ChainID,
+			account.nextNonce,
+			*message.To,
+			message.Value,
+			gasLimit,
+			selectedFeeTarget.gasTipCap,
+			gasFeeCap,
+			message.Data)
+	} else {
+		tx = types.NewTransaction(account.nextNonce,
+			*message.To,
+			message.Value, gasLimit, selectedFeeTarget.gasPrice, message.Data)
+	}
 	return &TxProposal{
 		Coin:    account.coin,
 		Tx:      tx,
@@ -560,11 +722,14 @@ func (account *Account) newTx(args *accounts.TxProposalArgs) (*TxProposal, error
 		Value:   value,
 		Signer:  types.MakeSigner(account.coin.Net(), account.blockNumber),
 		Keypath: account.signingConfiguration.AbsoluteKeypath(),
+
+		RecipientAddress: address,
+		RecipientName:    recipientName,
 	}, nil
 }
 
 // storePendingOutgoingTransaction puts an outgoing tx into the db with height 0 (pending).
-func (account *Account) storePendingOutgoingTransaction(transaction *types.Transaction) error {
+func (account *Account) storePendingOutgoingTransaction(transaction ethtypes.Transaction) error {
 	dbTx, err := account.db.Begin()
 	if err != nil {
 		return err
@@ -594,82 +759,91 @@ func (account *Account) SendTx() error {
 	}
 
 	note := account.BaseAccount.GetAndClearProposedTxNote()
+	_, err := account.signAndSend(txProposal, note)
+	return err
+}
 
+// ProposeAndSendTx creates a transaction like TxProposal(), and signs and broadcasts it right away.
+// The active tx proposal of SendTx() is not changed, so a transaction requested by a dapp can't
+// interfere with one the user is preparing. Returns the ID (hash) of the sent transaction.
+func (account *Account) ProposeAndSendTx(args *accounts.TxProposalArgs) (string, error) {
+	txProposal, err := account.newTx(args)
+	if err != nil {
+		return "", err
+	}
+	return account.signAndSend(txProposal, "")
+}
+
+// signAndSend signs and broadcasts the tx proposal, stores it as a pending outgoing transaction and
+// sets its note. Returns the ID (hash) of the sent transaction.
+func (account *Account) signAndSend(txProposal *TxProposal, note string) (string, error) {
 	account.log.Info("Signing and sending transaction")
 	if err := account.Config().Keystore.SignTransaction(txProposal); err != nil {
-		return err
+		return "", err
 	}
 	// By experience, at least with the Etherscan backend, this can succeed and still the
 	// transaction will be lost (not in any block explorer, the node does not know about it, etc.).
 	// We do an attempt here and more attempts if needed in `updateOutgoingTransactions()`.
-	if err := account.coin.client.SendTransaction(context.TODO(), txProposal.Tx); err != nil {
-		return errp.WithStack(err)
+	if err := account.broadcast(txProposal.Tx); err != nil {
+		return "", err
 	}
 	if err := account.storePendingOutgoingTransaction(txProposal.Tx); err != nil {
-		return err
+		return "", err
 	}
 	if err := account.SetTxNote(txProposal.Tx.Hash().Hex(), note); err != nil {
 		// Not critical.
 		account.log.WithError(err).Error("Failed to save transaction note when sending a tx")
 	}
 	account.enqueueUpdateCh <- struct{}{}
-	return nil
+	return txProposal.Tx.Hash().Hex(), nil
 }
 
-// ethGasStationFeeTargets returns four priorities with fee targets estimated by
-// https://ethgasstation.info/.
-func (account *Account) ethGasStationFeeTargets() ([]*feeTarget, error) {
-	// TODO: Use timeout.
-	// Docs: https://docs.ethgasstation.info/gas-price#gas-price
-	response, err := account.httpClient.Get("https://ethgasstation.info/api/ethgasAPI.json?api-key=" + ethGasStationAPIKey)
+// broadcast sends a signed legacy or EIP-1559 transaction to the network.
+func (account *Account) broadcast(tx ethtypes.Transaction) error {
+	rawTx, err := ethtypes.EncodeTransaction(tx)
 	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close() //nolint:errcheck
-	if response.StatusCode != http.StatusOK {
-		return nil, errp.Newf("ethgasstation returned status code %d", response.StatusCode)
+		return err
 	}
-	var responseDecoded struct {
-		// Values are in Gwei*10
-		Average int64 `json:"average"`
-		Fast    int64 `json:"fast"`
-		Fastest int64 `json:"fastest"`
-		SafeLow int64 `json:"safeLow"`
+	return errp.WithStack(account.coin.client.SendRawTransaction(context.TODO(), rawTx))
+}
+
+// supportsEIP1559 returns true if the keystore can sign EIP-1559 transactions.
+func (account *Account) supportsEIP1559() bool {
+	keystore := account.Config().Keystore
+	return keystore != nil && keystore.SupportsEIP1559()
+}
+
+// feeTargets returns four priorities with fee targets derived from the base fee and the priority
+// fees paid in recent blocks (EIP-1559). If the fee history is not available, e.g. on networks
+// without EIP-1559, we fallback to only one priority, estimated by the ETH RPC eth_gasPrice
+// endpoint. The fee targets are cached until the next block is seen by update().
+func (account *Account) feeTargets() []*feeTarget {
+	defer account.feeTargetsCacheLock.Lock()()
+	blockNumber := account.blockNumber
+	if blockNumber != nil && account.feeTargetsCache != nil &&
+		blockNumber.Uint64() == account.feeTargetsCacheHeight {
+		return account.feeTargetsCache
 	}
-	if err := json.NewDecoder(response.Body).Decode(&responseDecoded); err != nil {
-		return nil, err
+	targets := account.fetchFeeTargets()
+	if blockNumber != nil && targets != nil {
+		account.feeTargetsCache = targets
+		account.feeTargetsCacheHeight = blockNumber.Uint64()
 	}
-	// Conversion from 10x Gwei to Wei.
-	factor := big.NewInt(1e8)
-	return []*feeTarget{
-		{
-			code:     accounts.FeeTargetCodeHigh,
-			gasPrice: new(big.Int).Mul(big.NewInt(responseDecoded.Fastest), factor),
-		},
-		{
-			code:     accounts.FeeTargetCodeNormal,
-			gasPrice: new(big.Int).Mul(big.NewInt(responseDecoded.Fast), factor),
-		},
-		{
-			code:     accounts.FeeTargetCodeLow,
-			gasPrice: new(big.Int).Mul(big.NewInt(responseDecoded.Average), factor),
-		},
-		{
-			code:     accounts.FeeTargetCodeEconomy,
-			gasPrice: new(big.Int).Mul(big.NewInt(responseDecoded.SafeLow), factor),
-		},
-	}, nil
+	return targets
 }
 
-// feeTargets returns four priorities with fee targets estimated by https://ethgasstation.info/.  If
-// the ethgasstation service should not reachable, we fallback to only one priority, estimated by
-// the ETH RPC eth_gasPrice endpoint.
-func (account *Account) feeTargets() []*feeTarget {
-	ethGasStationTargets, err := account.ethGasStationFeeTargets()
+// fetchFeeTargets fetches the fee history to compute the fee targets. See feeTargets().
+func (account *Account) fetchFeeTargets() []*feeTarget {
+	feeHistory, err := account.coin.client.FeeHistory(
+		context.TODO(), feeHistoryBlocks, feeHistoryPercentiles)
 	if err == nil {
-		return ethGasStationTargets
+		var targets []*feeTarget
+		targets, err = feeTargetsFromHistory(feeHistory)
+		if err == nil {
+			return targets
+		}
 	}
-	account.log.WithError(err).Error("Could not get fee targets from eth gas station, falling back to RPC eth_gasPrice")
+	account.log.WithError(err).Error("Could not get fee targets from the fee history, falling back to RPC eth_gasPrice")
 	suggestedGasPrice, err := account.coin.client.SuggestGasPrice(context.TODO())
 	if err != nil {
 		account.log.WithError(err).Error("Fallback to RPC eth_gasPrice failed")
@@ -692,9 +866,10 @@ func (account *Account) FeeTargets() ([]accounts.FeeTarget, accounts.FeeTargetCo
 	return feeTargets, accounts.DefaultFeeTarget
 }
 
-// gasPrice returns the currently suggested gas price for the given fee target, or a custom gas
-// price if the fee target is `FeeTargetCodeCustom`.
-func (account *Account) gasPrice(args *accounts.TxProposalArgs) (*big.Int, error) {
+// selectedFeeTarget returns the currently suggested fee target for the given fee target code, or a
+// custom fee target if the code is `FeeTargetCodeCustom`. The custom fee is the gas price of legacy
+// transactions and the max fee per gas of EIP-1559 transactions.
+func (account *Account) selectedFeeTarget(args *accounts.TxProposalArgs) (*feeTarget, error) {
 	if args.FeeTargetCode == accounts.FeeTargetCodeCustom {
 		// Convert from Gwei to Wei.
 		amount, err := coin.NewAmountFromString(args.CustomFee, big.NewInt(1e9))
@@ -705,14 +880,30 @@ func (account *Account) gasPrice(args *accounts.TxProposalArgs) (*big.Int, error
 		if gasPrice.Cmp(big.NewInt(0)) <= 0 {
 			return nil, errors.ErrFeeTooLow
 		}
-		return gasPrice, nil
+		target := &feeTarget{code: accounts.FeeTargetCodeCustom, gasPrice: gasPrice}
+		if !account.supportsEIP1559() {
+			return target, nil
+		}
+		for _, t := range account.feeTargets() {
+			if t.gasFeeCap == nil {
+				continue
+			}
+			baseFee := new(big.Int).Sub(t.gasPrice, t.gasTipCap)
+			if gasPrice.Cmp(baseFee) < 0 {
+				return nil, errors.ErrFeeTooLow
+			}
+			target.gasTipCap = new(big.Int).Sub(gasPrice, baseFee)
+			target.gasFeeCap = gasPrice
+			break
+		}
+		return target, nil
 	}
 	for _, t := range account.feeTargets() {
 		if t.code == args.FeeTargetCode {
 			if t.gasPrice.Cmp(big.NewInt(0)) <= 0 {
 				return nil, errors.ErrFeeTooLow
 			}
-			return t.gasPrice, nil
+			return t, nil
 		}
 	}
 	return nil, errp.Newf("Could not find fee target %s", args.FeeTargetCode)
@@ -738,6 +929,48 @@ func (account *Account) TxProposal(
 	return coin.NewAmount(txProposal.Value), coin.NewAmount(txProposal.Fee), coin.NewAmount(total), nil
 }
 
+// TxProposalRecipient returns the checksummed address the active tx proposal (see TxProposal())
+// pays to, and the ENS name it was resolved from (empty if the recipient was entered as an
+// address). The resolved address should be shown to the user before signing.
+func (account *Account) TxProposalRecipient() (string, string, error) {
+	unlock := account.activeTxProposalLock.RLock()
+	txProposal := account.activeTxProposal
+	unlock()
+	if txProposal == nil {
+		return "", "", errp.New("No active tx proposal")
+	}
+	return txProposal.RecipientAddress.Hex(), txProposal.RecipientName, nil
+}
+
+// ENSName returns the verified ENS name of the address, or an empty string if it has none or the
+// lookup failed. The results are cached, see ensNameCacheTTL.
+func (account *Account) ENSName(address string) (string, error) {
+	if !ethcommon.IsHexAddress(address) {
+		return "", errp.WithStack(errors.ErrInvalidAddress)
+	}
+	resolver := account.coin.ENSResolver()
+	if resolver == nil {
+		return "", nil
+	}
+	ethAddress := ethcommon.HexToAddress(address)
+	unlock := account.ensNamesLock.RLock()
+	entry, ok := account.ensNames[ethAddress]
+	unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.name, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ensNameTimeout)
+	defer cancel()
+	name, err := resolver.ReverseResolve(ctx, ethAddress)
+	if err != nil {
+		account.log.WithError(err).Warning("Could not reverse resolve ENS name")
+		name = ""
+	}
+	defer account.ensNamesLock.Lock()()
+	account.ensNames[ethAddress] = ensNameCacheEntry{name: name, expires: time.Now().Add(ensNameCacheTTL)}
+	return name, nil
+}
+
 // GetUnusedReceiveAddresses implements accounts.Interface.
 func (account *Account) GetUnusedReceiveAddresses() []accounts.AddressList {
 	return []accounts.AddressList{
@@ -769,3 +1002,46 @@ func (account *Account) CanVerifyAddresses() (bool, bool, error) {
 	}
 	return account.Config().Keystore.CanVerifyAddress(account.Coin())
 }
+
+// SignMessage signs the message with the account's key, as requested by dapps via
+// `personal_sign`. The returned signature has the same format as the one of SignTypedMessage.
+func (account *Account) SignMessage(message []byte) (string, error) {
+	if account.signingConfiguration == nil {
+		return "", errp.New("account must be initialized")
+	}
+	signature, err := account.Config().Keystore.SignETHMessage(
+		message, account.signingConfiguration.AbsoluteKeypath())
+	if err != nil {
+		return "", err
+	}
+	return encodeSignature(signature)
+}
+
+// SignTypedMessage signs the JSON encoded EIP-712 typed data, as requested by dapps via
+// `eth_signTypedData_v4`. The domain chainId must match the chain of the account. The returned
+// signature is 0x-prefixed hex, with the recovery value `v` (27 or 28) as the last byte.
+func (account *Account) SignTypedMessage(data []byte) (string, error) {
+	if account.signingConfiguration == nil {
+		return "", errp.New("account must be initialized")
+	}
+	chainID := account.coin.Net().ChainID.Uint64()
+	if _, err := eip712.Parse(data, chainID); err != nil {
+		return "", err
+	}
+	signature, err := account.Config().Keystore.SignETHTypedMessage(
+		chainID, data, account.signingConfiguration.AbsoluteKeypath())
+	if err != nil {
+		return "", err
+	}
+	return encodeSignature(signature)
+}
+
+// encodeSignature converts a 65 byte signature returned by the keystore into the format expected
+// by dapps: 0x-prefixed hex, with the recovery value `v` (27 or 28) as the last byte.
+func encodeSignature(signature []byte) (string, error) {
+	if len(signature) != 65 {
+		return "", errp.Newf("unexpected signature length: %d", len(signature))
+	}
+	signature[64] += 27
+	return hexutil.Encode(signature), nil
+}
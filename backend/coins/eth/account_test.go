@@ -16,25 +16,36 @@ package eth
 
 import (
 	"context"
+	"fmt"
 	"math/big"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	accountsMock "github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/ens"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient/mocks"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
 	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -43,6 +54,43 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+var (
+	ensResolverAddress = common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	ensRecipient       = common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+)
+
+// callENS serves eth_call requests to the ENS registry and resolver. "vitalik.eth" resolves to
+// ensRecipient, which has "vitalik.eth" as its reverse record. All other names are unregistered.
+func callENS(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	registry, _ := ens.RegistryAddress(3)
+	parsed, err := abi.JSON(strings.NewReader(`[
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"}]`))
+	if err != nil {
+		return nil, err
+	}
+	method, err := parsed.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	node := common.BytesToHash(msg.Data[4:])
+	node1 := ens.NameHash("vitalik.eth")
+	reverseNode := ens.NameHash(strings.ToLower(ensRecipient.Hex()[2:]) + ".addr.reverse")
+	switch {
+	case *msg.To == registry && method.Name == "resolver":
+		if node == node1 || node == reverseNode {
+			return method.Outputs.Pack(ensResolverAddress)
+		}
+		return method.Outputs.Pack(common.Address{})
+	case *msg.To == ensResolverAddress && method.Name == "addr" && node == node1:
+		return method.Outputs.Pack(ensRecipient)
+	case *msg.To == ensResolverAddress && method.Name == "name" && node == reverseNode:
+		return method.Outputs.Pack("vitalik.eth")
+	}
+	return nil, nil
+}
+
 func newAccount(t *testing.T) *Account {
 	t.Helper()
 	log := logging.Get().WithGroup("account_test")
@@ -74,10 +122,17 @@ func newAccount(t *testing.T) *Account {
 		BalanceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
 			return big.NewInt(1e18), nil
 		},
+		NonceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+			return 0, nil
+		},
 		PendingNonceAtFunc: func(ctx context.Context, account common.Address) (uint64, error) {
 			return 0, nil
 		},
+		CallContractFunc: callENS,
 	}
+	notifier := &accountsMock.Notifier{}
+	notifier.On("Put", mock.Anything).Return(nil)
+
 	coin := NewCoin(client, coin.CodeTETH, "Ropsten", "TETH", "TETH", params.TestnetChainConfig, "", nil, nil)
 	acct := NewAccount(
 		&accounts.AccountConfig{
@@ -88,7 +143,7 @@ func newAccount(t *testing.T) *Account {
 			OnEvent:               func(accounts.Event) {},
 			RateUpdater:           nil,
 			SigningConfigurations: signingConfigurations,
-			GetNotifier:           func(signing.Configurations) accounts.Notifier { return nil },
+			GetNotifier:           func(signing.Configurations) accounts.Notifier { return notifier },
 		},
 		coin,
 		&http.Client{},
@@ -113,6 +168,34 @@ func TestTxProposal(t *testing.T) {
 		require.Equal(t, coin.NewAmountFromInt64(100000000000000000), value)
 		require.Equal(t, coin.NewAmountFromInt64(420000000000000), fee)
 		require.Equal(t, coin.NewAmountFromInt64(100420000000000000), total)
+
+		recipientAddress, recipientName, err := acct.TxProposalRecipient()
+		require.NoError(t, err)
+		require.Equal(t, "0xa29163852021BF4C139D03Dff59ae763AC73e84e", recipientAddress)
+		require.Equal(t, "", recipientName)
+	})
+	t.Run("ens-name", func(t *testing.T) {
+		_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "Vitalik.eth",
+			Amount:           coin.NewSendAmount("0.1"),
+			FeeTargetCode:    accounts.FeeTargetCodeCustom,
+			CustomFee:        "20",
+		})
+		require.NoError(t, err)
+		recipientAddress, recipientName, err := acct.TxProposalRecipient()
+		require.NoError(t, err)
+		require.Equal(t, ensRecipient.Hex(), recipientAddress)
+		require.Equal(t, "vitalik.eth", recipientName)
+		require.Equal(t, &ensRecipient, acct.activeTxProposal.Tx.To())
+	})
+	t.Run("ens-name-not-found", func(t *testing.T) {
+		_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "unknown.eth",
+			Amount:           coin.NewSendAmount("0.1"),
+			FeeTargetCode:    accounts.FeeTargetCodeCustom,
+			CustomFee:        "20",
+		})
+		require.Equal(t, errors.ErrENSNameNotFound, errp.Cause(err))
 	})
 	t.Run("valid-address-lowercase", func(t *testing.T) {
 		_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
@@ -153,3 +236,359 @@ func TestTxProposal(t *testing.T) {
 		require.Equal(t, errors.ErrInvalidAddress, errp.Cause(err))
 	})
 }
+
+func TestENSName(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+	client := acct.coin.client.(*mocks.InterfaceMock)
+
+	name, err := acct.ENSName(ensRecipient.Hex())
+	require.NoError(t, err)
+	require.Equal(t, "vitalik.eth", name)
+	numCalls := len(client.CallContractCalls())
+	require.NotZero(t, numCalls)
+
+	// Cached.
+	name, err = acct.ENSName(ensRecipient.Hex())
+	require.NoError(t, err)
+	require.Equal(t, "vitalik.eth", name)
+	require.Len(t, client.CallContractCalls(), numCalls)
+
+	// Addresses without a name are cached too.
+	const unnamed = "0xa29163852021BF4C139D03Dff59ae763AC73e84e"
+	name, err = acct.ENSName(unnamed)
+	require.NoError(t, err)
+	require.Equal(t, "", name)
+	numCalls = len(client.CallContractCalls())
+	name, err = acct.ENSName(unnamed)
+	require.NoError(t, err)
+	require.Equal(t, "", name)
+	require.Len(t, client.CallContractCalls(), numCalls)
+
+	// Expired entries are looked up again.
+	acct.ensNames[ensRecipient] = ensNameCacheEntry{name: "stale.eth", expires: time.Now()}
+	name, err = acct.ENSName(ensRecipient.Hex())
+	require.NoError(t, err)
+	require.Equal(t, "vitalik.eth", name)
+	require.Greater(t, len(client.CallContractCalls()), numCalls)
+
+	_, err = acct.ENSName("invalid")
+	require.Equal(t, errors.ErrInvalidAddress, errp.Cause(err))
+}
+
+func TestAddENSNames(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+	client := acct.coin.client.(*mocks.InterfaceMock)
+
+	newTransactions := func() []*accounts.TransactionData {
+		return []*accounts.TransactionData{
+			{Addresses: []accounts.AddressAndAmount{{Address: ensRecipient.Hex()}}},
+			{Addresses: []accounts.AddressAndAmount{{Address: "0xa29163852021BF4C139D03Dff59ae763AC73e84e"}}},
+		}
+	}
+	transactions := newTransactions()
+	acct.addENSNames(transactions)
+	require.Equal(t, "vitalik.eth", transactions[0].Addresses[0].Name)
+	require.Equal(t, "", transactions[1].Addresses[0].Name)
+
+	// The names are cached across updates.
+	numCalls := len(client.CallContractCalls())
+	transactions = newTransactions()
+	acct.addENSNames(transactions)
+	require.Equal(t, "vitalik.eth", transactions[0].Addresses[0].Name)
+	require.Len(t, client.CallContractCalls(), numCalls)
+}
+
+func TestTxProposalDynamicFee(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	acct.Config().Keystore = &keystoremock.KeystoreMock{
+		SupportsEIP1559Func: func() bool { return true },
+	}
+	client := acct.coin.client.(*mocks.InterfaceMock)
+	client.FeeHistoryFunc = func(
+		ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error) {
+		return &rpcclient.FeeHistory{
+			OldestBlock: big.NewInt(99),
+			BaseFee:     []*big.Int{big.NewInt(10e9), big.NewInt(10e9)},
+			Reward:      [][]*big.Int{{big.NewInt(4e9), big.NewInt(2e9), big.NewInt(1e9), big.NewInt(1e9)}},
+		}, nil
+	}
+
+	t.Run("fee-target", func(t *testing.T) {
+		_, fee, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "0xa29163852021BF4C139D03Dff59ae763AC73e84e",
+			Amount:           coin.NewSendAmount("0.1"),
+			FeeTargetCode:    accounts.FeeTargetCodeNormal,
+		})
+		require.NoError(t, err)
+		// 21000 * (10 Gwei base fee + 2 Gwei tip).
+		require.Equal(t, coin.NewAmountFromInt64(252000000000000), fee)
+		tx, ok := acct.activeTxProposal.Tx.(*ethtypes.DynamicFeeTx)
+		require.True(t, ok)
+		require.Equal(t, big.NewInt(2e9), tx.GasTipCap())
+		require.Equal(t, big.NewInt(22e9), tx.GasFeeCap())
+		require.Equal(t, params.TestnetChainConfig.ChainID, tx.ChainID())
+	})
+	t.Run("custom", func(t *testing.T) {
+		_, fee, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "0xa29163852021BF4C139D03Dff59ae763AC73e84e",
+			Amount:           coin.NewSendAmount("0.1"),
+			FeeTargetCode:    accounts.FeeTargetCodeCustom,
+			CustomFee:        "20",
+		})
+		require.NoError(t, err)
+		require.Equal(t, coin.NewAmountFromInt64(420000000000000), fee)
+		tx, ok := acct.activeTxProposal.Tx.(*ethtypes.DynamicFeeTx)
+		require.True(t, ok)
+		require.Equal(t, big.NewInt(10e9), tx.GasTipCap())
+		require.Equal(t, big.NewInt(20e9), tx.GasFeeCap())
+	})
+	t.Run("custom-below-base-fee", func(t *testing.T) {
+		_, _, _, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "0xa29163852021BF4C139D03Dff59ae763AC73e84e",
+			Amount:           coin.NewSendAmount("0.1"),
+			FeeTargetCode:    accounts.FeeTargetCodeCustom,
+			CustomFee:        "5",
+		})
+		require.Equal(t, errors.ErrFeeTooLow, errp.Cause(err))
+	})
+	t.Run("send-all", func(t *testing.T) {
+		value, fee, total, err := acct.TxProposal(&accounts.TxProposalArgs{
+			RecipientAddress: "0xa29163852021BF4C139D03Dff59ae763AC73e84e",
+			Amount:           coin.NewSendAmountAll(),
+			FeeTargetCode:    accounts.FeeTargetCodeNormal,
+		})
+		require.NoError(t, err)
+		require.Equal(t, coin.NewAmountFromInt64(1e18), total)
+		require.Equal(t, coin.NewAmountFromInt64(252000000000000), fee)
+		tx, ok := acct.activeTxProposal.Tx.(*ethtypes.DynamicFeeTx)
+		require.True(t, ok)
+		// The max fee must be covered by the balance.
+		require.Equal(t, big.NewInt(12e9), tx.GasFeeCap())
+		require.Equal(t, value.BigInt(), tx.Value())
+	})
+}
+
+func TestFeeTargetsCache(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	client := acct.coin.client.(*mocks.InterfaceMock)
+	client.FeeHistoryFunc = func(
+		ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error) {
+		return &rpcclient.FeeHistory{
+			OldestBlock: big.NewInt(99),
+			BaseFee:     []*big.Int{big.NewInt(10e9), big.NewInt(10e9)},
+			Reward:      [][]*big.Int{{big.NewInt(4e9), big.NewInt(2e9), big.NewInt(1e9), big.NewInt(1e9)}},
+		}, nil
+	}
+	acct.blockNumber = big.NewInt(100)
+	targets := acct.feeTargets()
+	require.Len(t, targets, 4)
+	require.Equal(t, targets, acct.feeTargets())
+	require.Len(t, client.FeeHistoryCalls(), 1)
+
+	// The fee history is fetched again in the next block.
+	acct.blockNumber = big.NewInt(101)
+	require.Equal(t, targets, acct.feeTargets())
+	require.Len(t, client.FeeHistoryCalls(), 2)
+}
+
+func TestProposeAndSendTx(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	acct.Config().Keystore = &keystoremock.KeystoreMock{
+		SupportsEIP1559Func: func() bool { return false },
+		SignTransactionFunc: func(proposal interface{}) error {
+			txProposal := proposal.(*TxProposal)
+			signedTx, err := types.SignTx(
+				txProposal.Tx.(*types.Transaction), txProposal.Signer, privateKey)
+			if err != nil {
+				return err
+			}
+			txProposal.Tx = signedTx
+			return nil
+		},
+	}
+	var broadcasted []ethtypes.Transaction
+	client := acct.coin.client.(*mocks.InterfaceMock)
+	client.SendRawTransactionFunc = func(ctx context.Context, rawTx []byte) error {
+		tx, err := ethtypes.DecodeTransaction(rawTx)
+		require.NoError(t, err)
+		broadcasted = append(broadcasted, tx)
+		return nil
+	}
+	client.TransactionReceiptWithBlockNumberFunc = func(
+		ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
+		return nil, nil
+	}
+	client.TransactionByHashFunc = func(
+		ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
+		return nil, true, nil
+	}
+
+	// The transaction the user is preparing in the send view.
+	_, _, _, err = acct.TxProposal(&accounts.TxProposalArgs{
+		RecipientAddress: "0xa29163852021BF4C139D03Dff59ae763AC73e84e",
+		Amount:           coin.NewSendAmount("0.1"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "20",
+	})
+	require.NoError(t, err)
+	activeTxProposal := acct.activeTxProposal
+
+	txID, err := acct.ProposeAndSendTx(&accounts.TxProposalArgs{
+		RecipientAddress: ensRecipient.Hex(),
+		Amount:           coin.NewSendAmount("0.2"),
+		FeeTargetCode:    accounts.FeeTargetCodeCustom,
+		CustomFee:        "30",
+		Data:             []byte{1, 2, 3},
+	})
+	require.NoError(t, err)
+	require.Len(t, broadcasted, 1)
+	require.Equal(t, txID, broadcasted[0].Hash().Hex())
+	require.Equal(t, ensRecipient, *broadcasted[0].To())
+	require.Equal(t, []byte{1, 2, 3}, broadcasted[0].Data())
+	require.Same(t, activeTxProposal, acct.activeTxProposal)
+
+	require.NoError(t, acct.SendTx())
+	require.Len(t, broadcasted, 2)
+	require.Equal(t, common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e"), *broadcasted[1].To())
+}
+
+func TestReplaceTx(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	acct.Config().Keystore = &keystoremock.KeystoreMock{
+		SupportsEIP1559Func: func() bool { return false },
+		SignTransactionFunc: func(proposal interface{}) error {
+			txProposal := proposal.(*TxProposal)
+			signedTx, err := types.SignTx(
+				txProposal.Tx.(*types.Transaction), txProposal.Signer, privateKey)
+			if err != nil {
+				return err
+			}
+			txProposal.Tx = signedTx
+			return nil
+		},
+	}
+	var broadcasted []ethtypes.Transaction
+	client := acct.coin.client.(*mocks.InterfaceMock)
+	client.SendRawTransactionFunc = func(ctx context.Context, rawTx []byte) error {
+		tx, err := ethtypes.DecodeTransaction(rawTx)
+		require.NoError(t, err)
+		broadcasted = append(broadcasted, tx)
+		return nil
+	}
+	client.TransactionReceiptWithBlockNumberFunc = func(
+		ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
+		return nil, nil
+	}
+	client.TransactionByHashFunc = func(
+		ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
+		// Known to the node, no rebroadcast.
+		return nil, true, nil
+	}
+
+	recipient := common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e")
+	originalTx := types.NewTransaction(5, recipient, big.NewInt(1e17), 21000, big.NewInt(20e9), nil)
+	require.NoError(t, acct.storePendingOutgoingTransaction(originalTx))
+
+	// The custom fee is too low for a replacement and is raised by the minimum price bump.
+	speedUpTxID, err := acct.SpeedUpTx(originalTx.Hash().Hex(), accounts.FeeTargetCodeCustom, "1")
+	require.NoError(t, err)
+	require.Len(t, broadcasted, 1)
+	speedUpTx := broadcasted[0]
+	require.Equal(t, speedUpTxID, speedUpTx.Hash().Hex())
+	require.Equal(t, uint64(5), speedUpTx.Nonce())
+	require.Equal(t, big.NewInt(22e9), speedUpTx.GasPrice())
+	require.Equal(t, recipient, *speedUpTx.To())
+	require.Equal(t, big.NewInt(1e17), speedUpTx.Value())
+
+	// Replaced transactions can't be replaced again.
+	_, err = acct.SpeedUpTx(originalTx.Hash().Hex(), accounts.FeeTargetCodeCustom, "50")
+	require.Error(t, err)
+
+	cancelTxID, err := acct.CancelTx(speedUpTxID, accounts.FeeTargetCodeCustom, "30")
+	require.NoError(t, err)
+	require.Len(t, broadcasted, 2)
+	cancelTx := broadcasted[1]
+	require.Equal(t, cancelTxID, cancelTx.Hash().Hex())
+	require.Equal(t, uint64(5), cancelTx.Nonce())
+	require.Equal(t, big.NewInt(30e9), cancelTx.GasPrice())
+	require.Equal(t, acct.address.Address, *cancelTx.To())
+	require.Equal(t, big.NewInt(0), cancelTx.Value())
+
+	_, err = acct.CancelTx(common.Hash{}.Hex(), accounts.FeeTargetCodeCustom, "30")
+	require.Error(t, err)
+
+	// Only the last replacement shows up in the history.
+	outgoingTransactions, err := acct.outgoingTransactions(nil)
+	require.NoError(t, err)
+	require.Len(t, outgoingTransactions, 1)
+	require.Equal(t, cancelTxID, outgoingTransactions[0].TxID())
+
+	dbTx, err := acct.db.Begin()
+	require.NoError(t, err)
+	defer dbTx.Rollback()
+	allOutgoingTransactions, err := dbTx.OutgoingTransactions()
+	require.NoError(t, err)
+	require.Len(t, allOutgoingTransactions, 3)
+	for _, tx := range allOutgoingTransactions {
+		switch tx.TxID() {
+		case originalTx.Hash().Hex():
+			require.Equal(t, speedUpTx.Hash(), *tx.ReplacedBy)
+		case speedUpTxID:
+			require.Equal(t, cancelTx.Hash(), *tx.ReplacedBy)
+		default:
+			require.Nil(t, tx.ReplacedBy)
+		}
+	}
+}
+
+func TestSignTypedMessage(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	typedData := func(chainID int) []byte {
+		return []byte(fmt.Sprintf(`{
+  "types": {
+    "EIP712Domain": [{"name": "name", "type": "string"}, {"name": "chainId", "type": "uint256"}],
+    "Message": [{"name": "contents", "type": "string"}]
+  },
+  "primaryType": "Message",
+  "domain": {"name": "Test", "chainId": %d},
+  "message": {"contents": "Hello"}
+}`, chainID))
+	}
+
+	keystoreMock := &keystoremock.KeystoreMock{
+		SignETHTypedMessageFunc: func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+			require.Equal(t, uint64(3), chainID)
+			require.Equal(t, "m/60'/1'/0'/0", keypath.Encode())
+			signature := make([]byte, 65)
+			signature[64] = 1
+			return signature, nil
+		},
+	}
+	acct.Config().Keystore = keystoreMock
+
+	// The domain is for mainnet, the account is on Ropsten.
+	_, err := acct.SignTypedMessage(typedData(1))
+	require.Error(t, err)
+	require.Len(t, keystoreMock.SignETHTypedMessageCalls(), 0)
+
+	signature, err := acct.SignTypedMessage(typedData(3))
+	require.NoError(t, err)
+	require.Equal(t, "0x"+strings.Repeat("00", 64)+"1c", signature)
+	require.Len(t, keystoreMock.SignETHTypedMessageCalls(), 1)
+}
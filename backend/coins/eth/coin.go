@@ -16,13 +16,16 @@
 package eth
 
 import (
+	"context"
 	"math/big"
 	"strings"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/ens"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
 	"github.com/ethereum/go-ethereum/common"
@@ -53,6 +56,9 @@ type Coin struct {
 
 	transactionsSource TransactionsSource
 
+	// ensResolver is nil if ENS is not available on this network.
+	ensResolver *ens.Resolver
+
 	log *logrus.Entry
 }
 
@@ -72,6 +78,12 @@ func NewCoin(
 	transactionsSource TransactionsSource,
 	erc20Token *erc20.Token,
 ) *Coin {
+	var ensResolver *ens.Resolver
+	if client != nil {
+		if registry, ok := ens.RegistryAddress(net.ChainID.Uint64()); ok {
+			ensResolver = ens.NewResolver(client, registry)
+		}
+	}
 	return &Coin{
 		client:                client,
 		code:                  code,
@@ -85,6 +97,8 @@ func NewCoin(
 
 		erc20Token: erc20Token,
 
+		ensResolver: ensResolver,
+
 		log: logging.Get().WithGroup("coin").WithField("code", code),
 	}
 }
@@ -167,6 +181,36 @@ func (coin *Coin) ERC20Token() *erc20.Token {
 	return coin.erc20Token
 }
 
+// ERC20TokenInfo fetches the name, symbol and decimals of the ERC20 token deployed at
+// contractAddress.
+func (coin *Coin) ERC20TokenInfo(contractAddress common.Address) (*erc20.TokenInfo, error) {
+	return erc20.FetchTokenInfo(context.TODO(), coin.client, contractAddress)
+}
+
+// AddressHasHistory returns true if the address has sent a transaction or holds a balance at the
+// latest block. It is used to discover accounts which were used before, e.g. when restoring a
+// wallet from a seed. An address which received Ether and never sent a transaction still holds it,
+// so this covers all addresses with an Ether transaction, no matter how old.
+func (coin *Coin) AddressHasHistory(ctx context.Context, address common.Address) (bool, error) {
+	nonce, err := coin.client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return false, errp.WithStack(err)
+	}
+	if nonce > 0 {
+		return true, nil
+	}
+	balance, err := coin.client.BalanceAt(ctx, address, nil)
+	if err != nil {
+		return false, errp.WithStack(err)
+	}
+	return balance.Sign() > 0, nil
+}
+
+// ENSResolver returns the resolver for ENS names, or nil if ENS is not available on this network.
+func (coin *Coin) ENSResolver() *ens.Resolver {
+	return coin.ensResolver
+}
+
 // Close implements coin.Coin.
 func (coin *Coin) Close() error {
 	// TODO: shut down rpc connection.
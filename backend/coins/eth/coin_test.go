@@ -15,10 +15,13 @@
 package eth
 
 import (
+	"context"
 	"math/big"
 	"testing"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient/mocks"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/stretchr/testify/require"
 )
@@ -57,3 +60,35 @@ func TestCoin(t *testing.T) {
 		c.FormatAmount(coin.NewAmountFromInt64(1.234e18), false),
 	)
 }
+
+func TestAddressHasHistory(t *testing.T) {
+	var nonce uint64
+	balance := big.NewInt(0)
+	client := &mocks.InterfaceMock{
+		NonceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+			require.Nil(t, blockNumber)
+			return nonce, nil
+		},
+		BalanceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+			require.Nil(t, blockNumber)
+			return balance, nil
+		},
+	}
+	c := NewCoin(client, coin.CodeETH, "Ethereum", "ETH", "ETH", params.MainnetChainConfig, "", nil, nil)
+	address := common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e")
+
+	used, err := c.AddressHasHistory(context.Background(), address)
+	require.NoError(t, err)
+	require.False(t, used)
+
+	balance = big.NewInt(1)
+	used, err = c.AddressHasHistory(context.Background(), address)
+	require.NoError(t, err)
+	require.True(t, used)
+
+	balance = big.NewInt(0)
+	nonce = 1
+	used, err = c.AddressHasHistory(context.Background(), address)
+	require.NoError(t, err)
+	require.True(t, used)
+}
@@ -16,6 +16,7 @@ package db
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"sort"
 
@@ -23,10 +24,13 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonp"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 const (
 	bucketOutgoingTransactions = "pendingTransactions"
+	bucketIndexedTransactions  = "indexedTransactions"
+	bucketIndexedHeights       = "indexedHeights"
 )
 
 // DB is a bbolt key/value database.
@@ -53,9 +57,19 @@ func (db *DB) Begin() (TxInterface, error) {
 	if err != nil {
 		return nil, err
 	}
+	bucketIndexedTransactions, err := tx.CreateBucketIfNotExists([]byte(bucketIndexedTransactions))
+	if err != nil {
+		return nil, err
+	}
+	bucketIndexedHeights, err := tx.CreateBucketIfNotExists([]byte(bucketIndexedHeights))
+	if err != nil {
+		return nil, err
+	}
 	return &Tx{
 		tx:                         tx,
 		bucketOutgoingTransactions: bucketOutgoingTransactions,
+		bucketIndexedTransactions:  bucketIndexedTransactions,
+		bucketIndexedHeights:       bucketIndexedHeights,
 	}, nil
 }
 
@@ -69,6 +83,8 @@ type Tx struct {
 	tx *bbolt.Tx
 
 	bucketOutgoingTransactions *bbolt.Bucket
+	bucketIndexedTransactions  *bbolt.Bucket
+	bucketIndexedHeights       *bbolt.Bucket
 }
 
 // Rollback implements DBTxInterface.
@@ -114,3 +130,66 @@ func (tx *Tx) OutgoingTransactions() ([]*types.TransactionWithMetadata, error) {
 	sort.Sort(sort.Reverse(byNonce(transactions)))
 	return transactions, nil
 }
+
+// MarkOutgoingTransactionReplaced implements DBTxInterface.
+func (tx *Tx) MarkOutgoingTransactionReplaced(txHash common.Hash, replacedBy common.Hash) error {
+	txSerialized := tx.bucketOutgoingTransactions.Get(txHash.Bytes())
+	if txSerialized == nil {
+		return errp.Newf("outgoing transaction %s not found", txHash.Hex())
+	}
+	transaction := new(types.TransactionWithMetadata)
+	if err := json.Unmarshal(txSerialized, transaction); err != nil {
+		return errp.WithStack(err)
+	}
+	transaction.ReplacedBy = &replacedBy
+	return tx.PutOutgoingTransaction(transaction)
+}
+
+// indexKeyPrefix is the key prefix of all indexed transactions of an index.
+func indexKeyPrefix(indexID string) []byte {
+	return []byte(indexID + "/")
+}
+
+// PutIndexedTransaction implements DBTxInterface.
+func (tx *Tx) PutIndexedTransaction(indexID string, transaction *types.IndexedTransaction) error {
+	return tx.bucketIndexedTransactions.Put(
+		append(indexKeyPrefix(indexID), transaction.Hash.Bytes()...),
+		jsonp.MustMarshal(transaction))
+}
+
+// IndexedTransactions implements DBTxInterface.
+func (tx *Tx) IndexedTransactions(indexID string) ([]*types.IndexedTransaction, error) {
+	transactions := []*types.IndexedTransaction{}
+	prefix := indexKeyPrefix(indexID)
+	cursor := tx.bucketIndexedTransactions.Cursor()
+	for key, txSerialized := cursor.Seek(prefix); bytes.HasPrefix(key, prefix); key, txSerialized = cursor.Next() {
+		transaction := new(types.IndexedTransaction)
+		if err := json.Unmarshal(txSerialized, transaction); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].BlockNumber > transactions[j].BlockNumber
+	})
+	return transactions, nil
+}
+
+// IndexedHeight implements DBTxInterface.
+func (tx *Tx) IndexedHeight(indexID string) (uint64, error) {
+	value := tx.bucketIndexedHeights.Get([]byte(indexID))
+	if value == nil {
+		return 0, nil
+	}
+	if len(value) != 8 {
+		return 0, errp.Newf("invalid indexed height of %s", indexID)
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// PutIndexedHeight implements DBTxInterface.
+func (tx *Tx) PutIndexedHeight(indexID string, height uint64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, height)
+	return tx.bucketIndexedHeights.Put([]byte(indexID), value)
+}
@@ -14,7 +14,10 @@
 
 package db
 
-import "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+import (
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	"github.com/ethereum/go-ethereum/common"
+)
 
 // TxInterface needs to be implemented to persist all wallet/transaction related data.
 type TxInterface interface {
@@ -30,6 +33,26 @@ type TxInterface interface {
 	// OutgoingTransactions returns the stored list of outgoing transactions, sorted descending by
 	// the transaction nonce.
 	OutgoingTransactions() ([]*types.TransactionWithMetadata, error)
+
+	// MarkOutgoingTransactionReplaced marks the stored outgoing transaction with the given hash as
+	// replaced by the transaction with the hash replacedBy.
+	MarkOutgoingTransactionReplaced(txHash common.Hash, replacedBy common.Hash) error
+
+	// PutIndexedTransaction stores a transaction found by scanning a node in the index with the
+	// given ID. A transaction with the same hash in the same index is overwritten.
+	PutIndexedTransaction(indexID string, transaction *types.IndexedTransaction) error
+
+	// IndexedTransactions returns the transactions of the index with the given ID, sorted
+	// descending by block number.
+	IndexedTransactions(indexID string) ([]*types.IndexedTransaction, error)
+
+	// IndexedHeight returns the block number up to which (excluding) the index with the given ID
+	// has been scanned. Returns 0 if it has not been scanned yet.
+	IndexedHeight(indexID string) (uint64, error)
+
+	// PutIndexedHeight stores the block number up to which (excluding) the index with the given ID
+	// has been scanned.
+	PutIndexedHeight(indexID string, height uint64) error
 }
 
 // Interface can be implemented by database backends to open database transactions.
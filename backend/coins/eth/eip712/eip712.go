@@ -0,0 +1,132 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eip712 parses, validates and hashes EIP-712 typed structured data, as requested by dapps
+// via `eth_signTypedData_v4`. See https://eips.ethereum.org/EIPS/eip-712.
+package eip712
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+const domainType = "EIP712Domain"
+
+// hexOrDecimal is an integer which can be provided as a JSON number or as a decimal or 0x-prefixed
+// hex string. Dapps commonly use a JSON number for the domain chainId, which
+// math.HexOrDecimal256 does not accept.
+type hexOrDecimal math.HexOrDecimal256
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *hexOrDecimal) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+	return (*math.HexOrDecimal256)(h).UnmarshalText([]byte(text))
+}
+
+// numbersToStrings replaces all JSON numbers in the decoded value by their string representation,
+// so that big integers are not truncated by a conversion to float64.
+func numbersToStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = numbersToStrings(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = numbersToStrings(elem)
+		}
+	}
+	return value
+}
+
+// Parse decodes the JSON encoded typed data and validates it for signing on the chain with the
+// given chain ID. The domain must specify the chain ID, so that a signature can't be replayed on a
+// different network.
+func Parse(data []byte, chainID uint64) (*core.TypedData, error) {
+	var input struct {
+		Types       core.Types `json:"types"`
+		PrimaryType string     `json:"primaryType"`
+		Domain      struct {
+			Name              string        `json:"name"`
+			Version           string        `json:"version"`
+			ChainID           *hexOrDecimal `json:"chainId"`
+			VerifyingContract string        `json:"verifyingContract"`
+			Salt              string        `json:"salt"`
+		} `json:"domain"`
+		Message core.TypedDataMessage `json:"message"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&input); err != nil {
+		return nil, errp.Wrap(err, "invalid typed data")
+	}
+	typedData := core.TypedData{
+		Types:       input.Types,
+		PrimaryType: input.PrimaryType,
+		Domain: core.TypedDataDomain{
+			Name:              input.Domain.Name,
+			Version:           input.Domain.Version,
+			ChainId:           (*math.HexOrDecimal256)(input.Domain.ChainID),
+			VerifyingContract: input.Domain.VerifyingContract,
+			Salt:              input.Domain.Salt,
+		},
+		Message: numbersToStrings(input.Message).(core.TypedDataMessage),
+	}
+	if _, ok := typedData.Types[domainType]; !ok {
+		return nil, errp.Newf("typed data is missing the %s type", domainType)
+	}
+	if typedData.PrimaryType == "" || typedData.PrimaryType == domainType {
+		return nil, errp.Newf("invalid primary type: %q", typedData.PrimaryType)
+	}
+	if _, ok := typedData.Types[typedData.PrimaryType]; !ok {
+		return nil, errp.Newf("primary type %s is not defined", typedData.PrimaryType)
+	}
+	domain := typedData.Domain
+	if domain.ChainId == nil {
+		return nil, errp.New("the domain must specify the chainId")
+	}
+	if (*big.Int)(domain.ChainId).Cmp(new(big.Int).SetUint64(chainID)) != 0 {
+		return nil, errp.Newf("domain chainId %s does not match the network chainId %d",
+			(*big.Int)(domain.ChainId), chainID)
+	}
+	if domain.Name == "" && domain.Version == "" && domain.VerifyingContract == "" && domain.Salt == "" {
+		return nil, errp.New("the domain is undefined")
+	}
+	return &typedData, nil
+}
+
+// SigHash computes the hash to be signed:
+// `keccak256("\x19\x01" ‖ hashStruct(domain) ‖ hashStruct(message))`.
+func SigHash(typedData *core.TypedData) ([]byte, error) {
+	domainSeparator, err := typedData.HashStruct(domainType, typedData.Domain.Map())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	messageHash, err := typedData.HashStruct(typedData.PrimaryType, typedData.Message)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return crypto.Keccak256([]byte{0x19, 0x01}, domainSeparator, messageHash), nil
+}
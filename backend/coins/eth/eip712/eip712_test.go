@@ -0,0 +1,86 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eip712
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mailTypedData is the example from the EIP-712 specification.
+const mailTypedData = `{
+  "types": {
+    "EIP712Domain": [
+      {"name": "name", "type": "string"},
+      {"name": "version", "type": "string"},
+      {"name": "chainId", "type": "uint256"},
+      {"name": "verifyingContract", "type": "address"}
+    ],
+    "Person": [
+      {"name": "name", "type": "string"},
+      {"name": "wallet", "type": "address"}
+    ],
+    "Mail": [
+      {"name": "from", "type": "Person"},
+      {"name": "to", "type": "Person"},
+      {"name": "contents", "type": "string"}
+    ]
+  },
+  "primaryType": "Mail",
+  "domain": {
+    "name": "Ether Mail",
+    "version": "1",
+    "chainId": 1,
+    "verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+  },
+  "message": {
+    "from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+    "to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+    "contents": "Hello, Bob!"
+  }
+}`
+
+func TestSigHash(t *testing.T) {
+	typedData, err := Parse([]byte(mailTypedData), 1)
+	require.NoError(t, err)
+	sigHash, err := SigHash(typedData)
+	require.NoError(t, err)
+	require.Equal(t,
+		"be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2",
+		hex.EncodeToString(sigHash),
+	)
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse([]byte(mailTypedData), 3)
+	require.Error(t, err)
+
+	_, err = Parse([]byte("{"), 1)
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`{"types": {"Mail": []}, "primaryType": "Mail", "domain": {"chainId": 1, "name": "x"}}`), 1)
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`{"types": {"EIP712Domain": [], "Mail": []}, "primaryType": "Other", "domain": {"chainId": 1, "name": "x"}}`), 1)
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`{"types": {"EIP712Domain": [], "Mail": []}, "primaryType": "Mail", "domain": {"name": "x"}}`), 1)
+	require.Error(t, err)
+
+	_, err = Parse([]byte(`{"types": {"EIP712Domain": [], "Mail": []}, "primaryType": "Mail", "domain": {"chainId": 1}}`), 1)
+	require.Error(t, err)
+}
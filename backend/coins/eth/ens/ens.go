@@ -0,0 +1,221 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ens resolves Ethereum Name Service (ENS) names to addresses and back, using the ENS
+// registry and resolver contracts. See https://eips.ethereum.org/EIPS/eip-137 and
+// https://eips.ethereum.org/EIPS/eip-181.
+package ens
+
+import (
+	"context"
+	"strings"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// registryAddress is the address of the ENS registry, deployed at the same address on mainnet and
+// the Ropsten, Rinkeby and Goerli testnets.
+var registryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+const registryABI = `[{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+const resolverABI = `[{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"name","outputs":[{"name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// reverseSuffix is the name under which reverse records are registered, see EIP-181.
+const reverseSuffix = "addr.reverse"
+
+var (
+	parsedRegistryABI = mustParseABI(registryABI)
+	parsedResolverABI = mustParseABI(resolverABI)
+)
+
+// ErrNotFound is returned if a name has no resolver or does not resolve to an address.
+var ErrNotFound = errp.New("ENS name not found")
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(errp.WithStack(err))
+	}
+	return parsed
+}
+
+// RegistryAddress returns the address of the ENS registry for the given chain ID. The second
+// return value is false if ENS is not deployed on this chain.
+func RegistryAddress(chainID uint64) (common.Address, bool) {
+	switch chainID {
+	case 1, 3, 4, 5:
+		return registryAddress, true
+	default:
+		return common.Address{}, false
+	}
+}
+
+// IsName returns true if s looks like an ENS name, e.g. "vitalik.eth". Only names consisting of
+// ASCII letters, digits and hyphens are accepted, as full Unicode (UTS-46) normalization is not
+// supported and would allow lookalike names.
+func IsName(s string) bool {
+	if common.IsHexAddress(s) {
+		return false
+	}
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+		for _, r := range label {
+			isAllowed := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+				(r >= '0' && r <= '9') || r == '-'
+			if !isAllowed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Normalize returns the normalized form of the name. Since only ASCII names are accepted (see
+// IsName()), this amounts to lowercasing the name.
+func Normalize(name string) string {
+	return strings.ToLower(name)
+}
+
+// NameHash computes the namehash of the normalized name as specified in EIP-137.
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(Normalize(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		labelHash := crypto.Keccak256([]byte(labels[i]))
+		node = crypto.Keccak256Hash(node[:], labelHash)
+	}
+	return node
+}
+
+// Resolver resolves ENS names using the registry and resolver contracts via eth_call.
+type Resolver struct {
+	client   ethereum.ContractCaller
+	registry common.Address
+}
+
+// NewResolver creates a new resolver querying the ENS registry at the given address.
+func NewResolver(client ethereum.ContractCaller, registry common.Address) *Resolver {
+	return &Resolver{client: client, registry: registry}
+}
+
+// call calls a constant method of a contract and unpacks the result into result.
+func (resolver *Resolver) call(
+	ctx context.Context,
+	contract common.Address,
+	contractABI abi.ABI,
+	result interface{},
+	method string,
+	args ...interface{}) error {
+	input, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	output, err := resolver.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: input}, nil)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if len(output) == 0 {
+		// No contract deployed at this address.
+		return errp.WithStack(ErrNotFound)
+	}
+	if err := contractABI.Unpack(result, method, output); err != nil {
+		return errp.WithStack(err)
+	}
+	return nil
+}
+
+// resolverOf returns the address of the resolver contract responsible for the given node.
+func (resolver *Resolver) resolverOf(ctx context.Context, node common.Hash) (common.Address, error) {
+	var resolverAddress common.Address
+	if err := resolver.call(
+		ctx, resolver.registry, parsedRegistryABI, &resolverAddress, "resolver", node); err != nil {
+		return common.Address{}, err
+	}
+	if resolverAddress == (common.Address{}) {
+		return common.Address{}, errp.WithStack(ErrNotFound)
+	}
+	return resolverAddress, nil
+}
+
+// Resolve returns the address the name points to. ErrNotFound is returned if the name has no
+// resolver or no address record.
+func (resolver *Resolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	if !IsName(name) {
+		return common.Address{}, errp.Newf("invalid ENS name: %s", name)
+	}
+	node := NameHash(name)
+	resolverAddress, err := resolver.resolverOf(ctx, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var address common.Address
+	if err := resolver.call(ctx, resolverAddress, parsedResolverABI, &address, "addr", node); err != nil {
+		return common.Address{}, err
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, errp.WithStack(ErrNotFound)
+	}
+	return address, nil
+}
+
+// ReverseResolve returns the primary name of the address. The name is only returned if it resolves
+// back to the same address, as anyone can set a reverse record pointing to any name. An empty
+// string is returned if the address has no verified name.
+func (resolver *Resolver) ReverseResolve(ctx context.Context, address common.Address) (string, error) {
+	reverseName := strings.ToLower(address.Hex()[2:]) + "." + reverseSuffix
+	node := NameHash(reverseName)
+	resolverAddress, err := resolver.resolverOf(ctx, node)
+	if errp.Cause(err) == ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var name string
+	err = resolver.call(ctx, resolverAddress, parsedResolverABI, &name, "name", node)
+	if errp.Cause(err) == ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !IsName(name) {
+		return "", nil
+	}
+	forwardAddress, err := resolver.Resolve(ctx, name)
+	if errp.Cause(err) == ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if forwardAddress != address {
+		return "", nil
+	}
+	return Normalize(name), nil
+}
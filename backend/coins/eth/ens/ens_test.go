@@ -0,0 +1,172 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ens_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/ens"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	registry        = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+	publicResolver  = common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	reverseResolver = common.HexToAddress("0xA2C122BE93b0074270ebeE7f6b7292C7deB45047")
+	vitalik         = common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+)
+
+var testABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(`[
+{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"type":"function"},
+{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"type":"function"},
+{"constant":true,"inputs":[{"name":"node","type":"bytes32"}],"name":"name","outputs":[{"name":"","type":"string"}],"type":"function"}]`))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// fakeENS implements ethereum.ContractCaller, answering calls to the registry and resolvers from
+// in-memory records.
+type fakeENS struct {
+	resolvers map[common.Hash]common.Address
+	addrs     map[common.Hash]common.Address
+	names     map[common.Hash]string
+}
+
+func newFakeENS() *fakeENS {
+	return &fakeENS{
+		resolvers: map[common.Hash]common.Address{},
+		addrs:     map[common.Hash]common.Address{},
+		names:     map[common.Hash]string{},
+	}
+}
+
+func (f *fakeENS) CallContract(
+	ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	method, err := testABI.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	var node common.Hash
+	copy(node[:], msg.Data[4:])
+	switch {
+	case *msg.To == registry && method.Name == "resolver":
+		return method.Outputs.Pack(f.resolvers[node])
+	case *msg.To == publicResolver && method.Name == "addr":
+		return method.Outputs.Pack(f.addrs[node])
+	case *msg.To == reverseResolver && method.Name == "name":
+		return method.Outputs.Pack(f.names[node])
+	}
+	// Not a contract.
+	return nil, nil
+}
+
+func TestRegistryAddress(t *testing.T) {
+	address, ok := ens.RegistryAddress(1)
+	require.True(t, ok)
+	require.Equal(t, registry, address)
+	_, ok = ens.RegistryAddress(1337)
+	require.False(t, ok)
+}
+
+func TestIsName(t *testing.T) {
+	require.True(t, ens.IsName("vitalik.eth"))
+	require.True(t, ens.IsName("Sub.My-Name.eth"))
+	require.False(t, ens.IsName("eth"))
+	require.False(t, ens.IsName("vitalik..eth"))
+	require.False(t, ens.IsName("vitalik.eth."))
+	require.False(t, ens.IsName("vitаlik.eth")) // Cyrillic a
+	require.False(t, ens.IsName(vitalik.Hex()))
+	require.False(t, ens.IsName(""))
+}
+
+func TestNameHash(t *testing.T) {
+	// Test vectors from EIP-137.
+	require.Equal(t,
+		common.Hash{},
+		ens.NameHash(""))
+	require.Equal(t,
+		common.HexToHash("0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"),
+		ens.NameHash("eth"))
+	require.Equal(t,
+		common.HexToHash("0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"),
+		ens.NameHash("foo.eth"))
+	require.Equal(t, ens.NameHash("foo.eth"), ens.NameHash("FOO.eth"))
+}
+
+func TestResolve(t *testing.T) {
+	fake := newFakeENS()
+	resolver := ens.NewResolver(fake, registry)
+
+	_, err := resolver.Resolve(context.Background(), "vitalik.eth")
+	require.Equal(t, ens.ErrNotFound, errp.Cause(err))
+
+	node := ens.NameHash("vitalik.eth")
+	fake.resolvers[node] = publicResolver
+	_, err = resolver.Resolve(context.Background(), "vitalik.eth")
+	require.Equal(t, ens.ErrNotFound, errp.Cause(err))
+
+	fake.addrs[node] = vitalik
+	address, err := resolver.Resolve(context.Background(), "Vitalik.eth")
+	require.NoError(t, err)
+	require.Equal(t, vitalik, address)
+
+	_, err = resolver.Resolve(context.Background(), "invalid")
+	require.Error(t, err)
+
+	// Resolver which is not a contract.
+	fake.resolvers[node] = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	_, err = resolver.Resolve(context.Background(), "vitalik.eth")
+	require.Equal(t, ens.ErrNotFound, errp.Cause(err))
+}
+
+func TestReverseResolve(t *testing.T) {
+	fake := newFakeENS()
+	resolver := ens.NewResolver(fake, registry)
+
+	name, err := resolver.ReverseResolve(context.Background(), vitalik)
+	require.NoError(t, err)
+	require.Equal(t, "", name)
+
+	reverseNode := ens.NameHash(strings.ToLower(vitalik.Hex()[2:]) + ".addr.reverse")
+	fake.resolvers[reverseNode] = reverseResolver
+	fake.names[reverseNode] = "Vitalik.eth"
+
+	// The forward resolution does not match yet.
+	name, err = resolver.ReverseResolve(context.Background(), vitalik)
+	require.NoError(t, err)
+	require.Equal(t, "", name)
+
+	node := ens.NameHash("vitalik.eth")
+	fake.resolvers[node] = publicResolver
+	fake.addrs[node] = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	name, err = resolver.ReverseResolve(context.Background(), vitalik)
+	require.NoError(t, err)
+	require.Equal(t, "", name)
+
+	fake.addrs[node] = vitalik
+	name, err = resolver.ReverseResolve(context.Background(), vitalik)
+	require.NoError(t, err)
+	require.Equal(t, "vitalik.eth", name)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erc20
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The optional ERC20 functions returning the token metadata. They are not part of IERC20.
+// Some older tokens (e.g. MKR) return bytes32 instead of string for name() and symbol().
+var (
+	selectorName     = []byte{0x06, 0xfd, 0xde, 0x03}
+	selectorSymbol   = []byte{0x95, 0xd8, 0x9b, 0x41}
+	selectorDecimals = []byte{0x31, 0x3c, 0xe5, 0x67}
+)
+
+const stringABI = `[{"name":"f","type":"function","constant":true,"inputs":[],"outputs":[{"name":"","type":"string"}]}]`
+
+// maxDecimals is the maximum number of decimals accepted for a token.
+const maxDecimals = 77
+
+// The maximum number of characters of the token name and symbol. The metadata is chosen by whoever
+// deployed the contract, so it is limited to what can be displayed without breaking the layout.
+const (
+	maxNameLength   = 50
+	maxSymbolLength = 11
+)
+
+// TokenInfo holds the metadata of an ERC20 token, as returned by the token contract.
+type TokenInfo struct {
+	Name     string
+	Symbol   string
+	Decimals uint
+}
+
+func call(
+	ctx context.Context,
+	caller bind.ContractCaller,
+	contractAddress common.Address,
+	selector []byte,
+) ([]byte, error) {
+	result, err := caller.CallContract(ctx, ethereum.CallMsg{
+		To:   &contractAddress,
+		Data: selector,
+	}, nil)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if len(result) == 0 {
+		return nil, errp.Newf("%s is not an ERC20 token contract", contractAddress.Hex())
+	}
+	return result, nil
+}
+
+// decodeString decodes the result of name() or symbol(), which is either an ABI encoded string or
+// a bytes32 value padded with zeroes. Strings longer than maxLength characters or containing
+// non-printable characters are rejected.
+func decodeString(result []byte, maxLength int) (string, error) {
+	var decoded string
+	if len(result) == 32 {
+		decoded = string(bytes.TrimRight(result, "\x00"))
+	} else {
+		parsed, err := abi.JSON(strings.NewReader(stringABI))
+		if err != nil {
+			panic(errp.WithStack(err))
+		}
+		if err := parsed.Unpack(&decoded, "f", result); err != nil {
+			return "", errp.WithStack(err)
+		}
+	}
+	decoded = strings.TrimSpace(decoded)
+	if decoded == "" || !utf8.ValidString(decoded) || utf8.RuneCountInString(decoded) > maxLength {
+		return "", errp.New("invalid token metadata")
+	}
+	for _, r := range decoded {
+		if !unicode.IsPrint(r) {
+			return "", errp.New("invalid token metadata")
+		}
+	}
+	return decoded, nil
+}
+
+// FetchTokenInfo fetches the name, symbol and decimals of the ERC20 token deployed at
+// contractAddress.
+func FetchTokenInfo(
+	ctx context.Context,
+	caller bind.ContractCaller,
+	contractAddress common.Address,
+) (*TokenInfo, error) {
+	nameResult, err := call(ctx, caller, contractAddress, selectorName)
+	if err != nil {
+		return nil, err
+	}
+	name, err := decodeString(nameResult, maxNameLength)
+	if err != nil {
+		return nil, err
+	}
+	symbolResult, err := call(ctx, caller, contractAddress, selectorSymbol)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := decodeString(symbolResult, maxSymbolLength)
+	if err != nil {
+		return nil, err
+	}
+	decimalsResult, err := call(ctx, caller, contractAddress, selectorDecimals)
+	if err != nil {
+		return nil, err
+	}
+	if len(decimalsResult) != 32 {
+		return nil, errp.New("invalid token decimals")
+	}
+	decimals := new(big.Int).SetBytes(decimalsResult)
+	if !decimals.IsUint64() || decimals.Uint64() > maxDecimals {
+		return nil, errp.Newf("invalid token decimals: %s", decimals)
+	}
+	return &TokenInfo{
+		Name:     name,
+		Symbol:   symbol,
+		Decimals: uint(decimals.Uint64()),
+	}, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erc20
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/stretchr/testify/require"
+)
+
+type contractCallerMock struct {
+	results map[string][]byte
+}
+
+func (caller *contractCallerMock) CodeAt(
+	ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	panic("not implemented")
+}
+
+func (caller *contractCallerMock) CallContract(
+	ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return caller.results[string(call.Data)], nil
+}
+
+func abiString(s string) []byte {
+	result := math.PaddedBigBytes(big.NewInt(32), 32)
+	result = append(result, math.PaddedBigBytes(big.NewInt(int64(len(s))), 32)...)
+	padded := make([]byte, (len(s)+31)/32*32)
+	copy(padded, s)
+	return append(result, padded...)
+}
+
+func bytes32(s string) []byte {
+	result := make([]byte, 32)
+	copy(result, s)
+	return result
+}
+
+func TestFetchTokenInfo(t *testing.T) {
+	contractAddress := common.HexToAddress("0x9f8f72aa9304c8b593d555f12ef6589cc3a579a2")
+
+	caller := &contractCallerMock{results: map[string][]byte{
+		string(selectorName):     abiString("Tether USD"),
+		string(selectorSymbol):   abiString("USDT"),
+		string(selectorDecimals): math.PaddedBigBytes(big.NewInt(6), 32),
+	}}
+	info, err := FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.NoError(t, err)
+	require.Equal(t, &TokenInfo{Name: "Tether USD", Symbol: "USDT", Decimals: 6}, info)
+
+	// bytes32 name and symbol.
+	caller.results[string(selectorName)] = bytes32("Maker")
+	caller.results[string(selectorSymbol)] = bytes32("MKR")
+	caller.results[string(selectorDecimals)] = math.PaddedBigBytes(big.NewInt(18), 32)
+	info, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.NoError(t, err)
+	require.Equal(t, &TokenInfo{Name: "Maker", Symbol: "MKR", Decimals: 18}, info)
+
+	// Invalid decimals.
+	caller.results[string(selectorDecimals)] = math.PaddedBigBytes(big.NewInt(100), 32)
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+	caller.results[string(selectorDecimals)] = bytes.Repeat([]byte{0xff}, 32)
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+
+	// Empty symbol.
+	caller.results[string(selectorDecimals)] = math.PaddedBigBytes(big.NewInt(18), 32)
+	caller.results[string(selectorSymbol)] = bytes32("")
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+
+	// Too long or non-printable symbol.
+	caller.results[string(selectorSymbol)] = abiString("MKRMKRMKRMKR")
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+	caller.results[string(selectorSymbol)] = abiString("MKR\u202e")
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+
+	// Too long name.
+	caller.results[string(selectorSymbol)] = bytes32("MKR")
+	caller.results[string(selectorName)] = abiString(strings.Repeat("Maker", 11))
+	_, err = FetchTokenInfo(context.Background(), caller, contractAddress)
+	require.Error(t, err)
+
+	// Not a contract.
+	_, err = FetchTokenInfo(context.Background(), &contractCallerMock{}, contractAddress)
+	require.Error(t, err)
+}
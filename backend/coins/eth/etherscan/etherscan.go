@@ -22,6 +22,7 @@ import (
 	"math/big"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"time"
 
@@ -394,7 +395,7 @@ func (etherScan *EtherScan) TransactionReceiptWithBlockNumber(
 
 // TransactionByHash implements rpc.Interface.
 func (etherScan *EtherScan) TransactionByHash(
-	ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
 	params := url.Values{}
 	params.Set("action", "eth_getTransactionByHash")
 	params.Set("txhash", hash.Hex())
@@ -402,7 +403,7 @@ func (etherScan *EtherScan) TransactionByHash(
 	if err := etherScan.rpcCall(params, &result); err != nil {
 		return nil, false, err
 	}
-	return &result.Transaction, result.BlockNumber == nil, nil
+	return result.Transaction, result.BlockNumber == nil, nil
 }
 
 // HeaderByNumber implements rpc.Interface.
@@ -514,6 +515,23 @@ func (etherScan *EtherScan) PendingCodeAt(ctx context.Context, account common.Ad
 	panic("not implemented")
 }
 
+// NonceAt implements rpc.Interface.
+func (etherScan *EtherScan) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	params := url.Values{}
+	params.Set("action", "eth_getTransactionCount")
+	params.Set("address", account.Hex())
+	if blockNumber == nil {
+		params.Set("tag", "latest")
+	} else {
+		params.Set("tag", hexutil.EncodeBig(blockNumber))
+	}
+	var result hexutil.Uint64
+	if err := etherScan.rpcCall(params, &result); err != nil {
+		return 0, err
+	}
+	return uint64(result), nil
+}
+
 // PendingNonceAt implements rpc.Interface.
 func (etherScan *EtherScan) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
 	params := url.Values{}
@@ -533,13 +551,181 @@ func (etherScan *EtherScan) SendTransaction(ctx context.Context, tx *types.Trans
 	if err != nil {
 		return errp.WithStack(err)
 	}
+	return etherScan.SendRawTransaction(ctx, encodedTx)
+}
 
+// SendRawTransaction implements rpc.Interface.
+func (etherScan *EtherScan) SendRawTransaction(ctx context.Context, rawTx []byte) error {
 	params := url.Values{}
 	params.Set("action", "eth_sendRawTransaction")
-	params.Set("hex", hexutil.Encode(encodedTx))
+	params.Set("hex", hexutil.Encode(rawTx))
 	return etherScan.rpcCall(params, nil)
 }
 
+// maxFeeHistoryBlocks limits the number of blocks fetched in FeeHistory, as each block is one
+// rate-limited request.
+const maxFeeHistoryBlocks = 4
+
+type jsonBlock struct {
+	Number       hexutil.Uint64 `json:"number"`
+	BaseFee      *hexutil.Big   `json:"baseFeePerGas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	GasLimit     hexutil.Uint64 `json:"gasLimit"`
+	Transactions []struct {
+		// For mined EIP-1559 transactions, this is the effective gas price.
+		GasPrice *hexutil.Big `json:"gasPrice"`
+	} `json:"transactions"`
+}
+
+func (etherScan *EtherScan) blockByNumber(number *big.Int) (*jsonBlock, error) {
+	params := url.Values{}
+	params.Set("action", "eth_getBlockByNumber")
+	if number == nil {
+		params.Set("tag", "latest")
+	} else {
+		params.Set("tag", hexutil.EncodeBig(number))
+	}
+	params.Set("boolean", "true")
+	var result *jsonBlock
+	if err := etherScan.rpcCall(params, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errp.New("block not found")
+	}
+	return result, nil
+}
+
+// BlockWithTransactions implements rpc.Interface.
+func (etherScan *EtherScan) BlockWithTransactions(
+	ctx context.Context, number *big.Int) (*rpcclient.RPCBlock, error) {
+	params := url.Values{}
+	params.Set("action", "eth_getBlockByNumber")
+	if number == nil {
+		params.Set("tag", "latest")
+	} else {
+		params.Set("tag", hexutil.EncodeBig(number))
+	}
+	params.Set("boolean", "true")
+	var result *rpcclient.RPCBlock
+	if err := etherScan.rpcCall(params, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errp.New("block not found")
+	}
+	return result, nil
+}
+
+// FeeHistory implements rpc.Interface. Etherscan does not proxy `eth_feeHistory`, so the history
+// is computed from the latest blocks (at most maxFeeHistoryBlocks). Unlike `eth_feeHistory`, the
+// reward percentiles are not weighted by the gas used of each transaction.
+func (etherScan *EtherScan) FeeHistory(
+	ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error) {
+	if blockCount == 0 {
+		return nil, errp.New("blockCount must be positive")
+	}
+	if blockCount > maxFeeHistoryBlocks {
+		blockCount = maxFeeHistoryBlocks
+	}
+	latest, err := etherScan.blockByNumber(nil)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(latest.Number)+1 < blockCount {
+		blockCount = uint64(latest.Number) + 1
+	}
+	blocks := make([]*jsonBlock, blockCount)
+	blocks[blockCount-1] = latest
+	for i := int(blockCount) - 2; i >= 0; i-- {
+		number := new(big.Int).SetUint64(uint64(latest.Number) - (blockCount - 1 - uint64(i)))
+		block, err := etherScan.blockByNumber(number)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = block
+	}
+	result := &rpcclient.FeeHistory{
+		OldestBlock: new(big.Int).SetUint64(uint64(blocks[0].Number)),
+	}
+	for _, block := range blocks {
+		baseFee := new(big.Int)
+		if block.BaseFee != nil {
+			baseFee = (*big.Int)(block.BaseFee)
+		}
+		result.BaseFee = append(result.BaseFee, baseFee)
+		gasUsedRatio := 0.0
+		if block.GasLimit > 0 {
+			gasUsedRatio = float64(block.GasUsed) / float64(block.GasLimit)
+		}
+		result.GasUsedRatio = append(result.GasUsedRatio, gasUsedRatio)
+		tips := []*big.Int{}
+		for _, tx := range block.Transactions {
+			if tx.GasPrice == nil {
+				continue
+			}
+			tip := new(big.Int).Sub((*big.Int)(tx.GasPrice), baseFee)
+			if tip.Sign() < 0 {
+				tip.SetInt64(0)
+			}
+			tips = append(tips, tip)
+		}
+		result.Reward = append(result.Reward, percentiles(tips, rewardPercentiles))
+	}
+	result.BaseFee = append(result.BaseFee, nextBaseFee(latest))
+	return result, nil
+}
+
+// percentiles returns the values at the given percentiles (0-100). Zero is returned for all
+// percentiles if values is empty.
+func percentiles(values []*big.Int, percentiles []float64) []*big.Int {
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	result := make([]*big.Int, len(percentiles))
+	for i, p := range percentiles {
+		if len(values) == 0 {
+			result[i] = new(big.Int)
+			continue
+		}
+		idx := int(p / 100 * float64(len(values)-1))
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(values) {
+			idx = len(values) - 1
+		}
+		result[i] = new(big.Int).Set(values[idx])
+	}
+	return result
+}
+
+// nextBaseFee computes the base fee of the block following the given block according to EIP-1559.
+func nextBaseFee(block *jsonBlock) *big.Int {
+	if block.BaseFee == nil {
+		return new(big.Int)
+	}
+	baseFee := (*big.Int)(block.BaseFee)
+	gasTarget := uint64(block.GasLimit) / 2
+	gasUsed := uint64(block.GasUsed)
+	const baseFeeChangeDenominator = 8
+	switch {
+	case gasTarget == 0 || gasUsed == gasTarget:
+		return new(big.Int).Set(baseFee)
+	case gasUsed > gasTarget:
+		delta := new(big.Int).Mul(baseFee, new(big.Int).SetUint64(gasUsed-gasTarget))
+		delta.Div(delta, new(big.Int).SetUint64(gasTarget))
+		delta.Div(delta, big.NewInt(baseFeeChangeDenominator))
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return delta.Add(delta, baseFee)
+	default:
+		delta := new(big.Int).Mul(baseFee, new(big.Int).SetUint64(gasTarget-gasUsed))
+		delta.Div(delta, new(big.Int).SetUint64(gasTarget))
+		delta.Div(delta, big.NewInt(baseFeeChangeDenominator))
+		return delta.Sub(baseFee, delta)
+	}
+}
+
 // SubscribeFilterLogs implements rpc.Interface.
 func (etherScan *EtherScan) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
 	panic("not implemented")
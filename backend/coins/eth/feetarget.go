@@ -17,17 +17,42 @@ package eth
 
 import (
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 )
 
+// feeHistoryBlocks is the number of recent blocks used to estimate the priority fees.
+const feeHistoryBlocks = 20
+
+// feeHistoryPercentiles are the priority fee percentiles queried for the fee targets, ordered as
+// in feeHistoryTargetCodes.
+var feeHistoryPercentiles = []float64{90, 50, 25, 10}
+
+var feeHistoryTargetCodes = []accounts.FeeTargetCode{
+	accounts.FeeTargetCodeHigh,
+	accounts.FeeTargetCodeNormal,
+	accounts.FeeTargetCodeLow,
+	accounts.FeeTargetCodeEconomy,
+}
+
 // feeTarget contains the gas price for a specific fee target.
 type feeTarget struct {
 	// Code is the identifier for the UI.
 	code accounts.FeeTargetCode
-	// gasPrice is the estimated gas price to be used in the fee calculation, in Wei.
+	// gasPrice is the estimated gas price to be used in the fee calculation, in Wei. For EIP-1559
+	// targets, this is the expected effective gas price: base fee of the next block plus the
+	// priority fee.
 	gasPrice *big.Int
+	// gasTipCap is the max priority fee per gas of EIP-1559 transactions, in Wei. nil for legacy
+	// fee targets.
+	gasTipCap *big.Int
+	// gasFeeCap is the max fee per gas of EIP-1559 transactions, in Wei. nil for legacy fee
+	// targets.
+	gasFeeCap *big.Int
 }
 
 // Code returns the btc fee target.
@@ -44,3 +69,38 @@ func (f *feeTarget) FormattedFeeRate() string {
 	s := new(big.Rat).SetFrac(f.gasPrice, factor).FloatString(9)
 	return strings.TrimRight(strings.TrimRight(s, "0"), ".") + " Gwei"
 }
+
+// feeTargetsFromHistory returns EIP-1559 fee targets derived from the given fee history, which must
+// contain rewards at feeHistoryPercentiles. The priority fee of each target is the median of the
+// per-block rewards at the target's percentile. The max fee per gas leaves room for the base fee to
+// double before the transaction can't be included anymore.
+func feeTargetsFromHistory(history *rpcclient.FeeHistory) ([]*feeTarget, error) {
+	if len(history.BaseFee) == 0 || len(history.Reward) == 0 {
+		return nil, errp.New("empty fee history")
+	}
+	baseFee := history.BaseFee[len(history.BaseFee)-1]
+	if baseFee == nil || baseFee.Sign() <= 0 {
+		return nil, errp.New("no base fee; EIP-1559 is not active")
+	}
+	result := make([]*feeTarget, len(feeHistoryTargetCodes))
+	for i, code := range feeHistoryTargetCodes {
+		tips := make([]*big.Int, 0, len(history.Reward))
+		for _, rewards := range history.Reward {
+			if len(rewards) != len(feeHistoryPercentiles) {
+				return nil, errp.New("unexpected number of rewards in fee history")
+			}
+			tips = append(tips, rewards[i])
+		}
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		tip := new(big.Int).Set(tips[len(tips)/2])
+		gasFeeCap := new(big.Int).Mul(baseFee, big.NewInt(2))
+		gasFeeCap.Add(gasFeeCap, tip)
+		result[i] = &feeTarget{
+			code:      code,
+			gasPrice:  new(big.Int).Add(baseFee, tip),
+			gasTipCap: tip,
+			gasFeeCap: gasFeeCap,
+		}
+	}
+	return result, nil
+}
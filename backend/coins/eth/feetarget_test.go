@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,3 +46,40 @@ func TestFeeTarget(t *testing.T) {
 		(&feeTarget{code: accounts.FeeTargetCodeLow, gasPrice: big.NewInt(0.123e9)}).FormattedFeeRate(),
 	)
 }
+
+func TestFeeTargetsFromHistory(t *testing.T) {
+	gwei := func(v int64) *big.Int { return big.NewInt(v * 1e9) }
+	history := &rpcclient.FeeHistory{
+		OldestBlock: big.NewInt(100),
+		BaseFee:     []*big.Int{gwei(20), gwei(22), gwei(30)},
+		Reward: [][]*big.Int{
+			{gwei(10), gwei(3), gwei(2), gwei(1)},
+			{gwei(5), gwei(2), gwei(1), gwei(1)},
+		},
+	}
+	targets, err := feeTargetsFromHistory(history)
+	require.NoError(t, err)
+	require.Len(t, targets, 4)
+
+	require.Equal(t, accounts.FeeTargetCodeHigh, targets[0].code)
+	require.Equal(t, gwei(10), targets[0].gasTipCap)
+	require.Equal(t, gwei(40), targets[0].gasPrice)
+	require.Equal(t, gwei(70), targets[0].gasFeeCap)
+	require.Equal(t, "40 Gwei", targets[0].FormattedFeeRate())
+
+	require.Equal(t, accounts.FeeTargetCodeNormal, targets[1].code)
+	require.Equal(t, gwei(3), targets[1].gasTipCap)
+
+	require.Equal(t, accounts.FeeTargetCodeEconomy, targets[3].code)
+	require.Equal(t, gwei(1), targets[3].gasTipCap)
+	require.Equal(t, gwei(31), targets[3].gasPrice)
+	require.Equal(t, gwei(61), targets[3].gasFeeCap)
+
+	// No base fee: EIP-1559 not active.
+	history.BaseFee = []*big.Int{big.NewInt(0), big.NewInt(0), big.NewInt(0)}
+	_, err = feeTargetsFromHistory(history)
+	require.Error(t, err)
+
+	_, err = feeTargetsFromHistory(&rpcclient.FeeHistory{})
+	require.Error(t, err)
+}
@@ -0,0 +1,315 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nodesource finds the transactions of an address using a plain Ethereum JSON-RPC node.
+package nodesource
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/db"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// maxBlocksPerScan is the maximum number of blocks fetched in one call to Transactions() when
+	// looking for ETH transactions, so that an account update does not take too long. The
+	// remaining blocks are scanned in the next updates.
+	maxBlocksPerScan = 1000
+	// maxLogBlocksPerScan is the same as maxBlocksPerScan for ERC20 transfers, which are queried
+	// with `eth_getLogs` instead of fetching every block.
+	maxLogBlocksPerScan = 1000000
+	// logsRangeSize is the number of blocks queried at once with `eth_getLogs`. Nodes limit the
+	// size of the response, so the range can't be arbitrarily large.
+	logsRangeSize = 10000
+	// minConfirmations is the number of confirmations a block needs before it is scanned, so that
+	// chain reorganizations do not leave orphaned transactions in the index.
+	minConfirmations = 3
+)
+
+// transferEventTopic is the topic of the ERC20 `Transfer(address,address,uint256)` event.
+var transferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// NodeSource implements eth.TransactionsSource without a third party service like EtherScan. The
+// transactions are cached in the database, so every block is only scanned once per address.
+//
+// ETH transactions are found by walking all blocks from the start block, checking the sender and
+// recipient of each transaction. Internal transactions (ETH sent by a contract) can't be found this
+// way. ERC20 transfers are found by filtering the Transfer event logs of the token contract.
+type NodeSource struct {
+	client     rpcclient.Interface
+	db         db.Interface
+	startBlock uint64
+}
+
+// NewNodeSource creates a new instance. startBlock is the first block to scan, which should be
+// before the first transaction of the wallet.
+func NewNodeSource(client rpcclient.Interface, db db.Interface, startBlock uint64) *NodeSource {
+	return &NodeSource{
+		client:     client,
+		db:         db,
+		startBlock: startBlock,
+	}
+}
+
+// indexID identifies the cached transactions of an address for ETH or an ERC20 token.
+func indexID(address common.Address, erc20Token *erc20.Token) string {
+	if erc20Token == nil {
+		return address.Hex()
+	}
+	return address.Hex() + "-" + erc20Token.ContractAddress().Hex()
+}
+
+// Transactions implements eth.TransactionsSource. It scans the blocks not yet scanned up to
+// endBlock and returns all transactions found so far.
+func (source *NodeSource) Transactions(
+	blockTipHeight *big.Int,
+	address common.Address, endBlock *big.Int, erc20Token *erc20.Token) (
+	[]*accounts.TransactionData, error) {
+	id := indexID(address, erc20Token)
+	if err := source.scan(id, address, endBlock.Uint64(), erc20Token); err != nil {
+		return nil, err
+	}
+	dbTx, err := source.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+	indexedTransactions, err := dbTx.IndexedTransactions(id)
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]*accounts.TransactionData, len(indexedTransactions))
+	for i, transaction := range indexedTransactions {
+		transactions[i] = transaction.TransactionData(blockTipHeight.Uint64(), address, erc20Token != nil)
+	}
+	return transactions, nil
+}
+
+// scan indexes the transactions of the blocks following the last scanned block, up to endBlock
+// minus the blocks which are not sufficiently confirmed yet.
+func (source *NodeSource) scan(
+	id string, address common.Address, endBlock uint64, erc20Token *erc20.Token) error {
+	dbTx, err := source.db.Begin()
+	if err != nil {
+		return err
+	}
+	from, err := dbTx.IndexedHeight(id)
+	dbTx.Rollback()
+	if err != nil {
+		return err
+	}
+	if from < source.startBlock {
+		from = source.startBlock
+	}
+	if endBlock+1 < minConfirmations {
+		return nil
+	}
+	to := endBlock + 1 - minConfirmations
+	if from > to {
+		return nil
+	}
+
+	var transactions []*ethtypes.IndexedTransaction
+	if erc20Token != nil {
+		if to-from >= maxLogBlocksPerScan {
+			to = from + maxLogBlocksPerScan - 1
+		}
+		transactions, err = source.scanLogs(address, erc20Token, from, to)
+	} else {
+		if to-from >= maxBlocksPerScan {
+			to = from + maxBlocksPerScan - 1
+		}
+		transactions, err = source.scanBlocks(address, from, to)
+	}
+	if err != nil {
+		return err
+	}
+
+	dbTx, err = source.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	for _, transaction := range transactions {
+		if err := dbTx.PutIndexedTransaction(id, transaction); err != nil {
+			return err
+		}
+	}
+	if err := dbTx.PutIndexedHeight(id, to+1); err != nil {
+		return err
+	}
+	return dbTx.Commit()
+}
+
+// scanBlocks returns the ETH transactions sent from or to the address in the blocks from..to
+// (inclusive).
+func (source *NodeSource) scanBlocks(
+	address common.Address, from, to uint64) ([]*ethtypes.IndexedTransaction, error) {
+	transactions := []*ethtypes.IndexedTransaction{}
+	for number := from; number <= to; number++ {
+		block, err := source.client.BlockWithTransactions(context.TODO(), new(big.Int).SetUint64(number))
+		if err != nil {
+			return nil, err
+		}
+		for _, blockTx := range block.Transactions {
+			isOurs := blockTx.From == address || (blockTx.To != nil && *blockTx.To == address)
+			if !isOurs {
+				continue
+			}
+			nonce := uint64(blockTx.Nonce)
+			transaction := &ethtypes.IndexedTransaction{
+				Hash:        blockTx.Hash,
+				BlockNumber: number,
+				Timestamp:   uint64(block.Timestamp),
+				From:        blockTx.From,
+				Value:       blockTx.Value.ToInt(),
+				Nonce:       &nonce,
+			}
+			if blockTx.To != nil {
+				transaction.To = *blockTx.To
+			}
+			if err := source.addReceipt(transaction, address, blockTx.GasPrice.ToInt()); err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, nil
+}
+
+// scanLogs returns the ERC20 transfers sent from or to the address in the blocks from..to
+// (inclusive). Multiple transfers in the same direction within one transaction are summed up.
+func (source *NodeSource) scanLogs(
+	address common.Address, erc20Token *erc20.Token, from, to uint64) (
+	[]*ethtypes.IndexedTransaction, error) {
+	addressTopic := common.BytesToHash(address.Bytes())
+	queries := [][][]common.Hash{
+		{{transferEventTopic}, {addressTopic}},
+		{{transferEventTopic}, nil, {addressTopic}},
+	}
+	type logID struct {
+		txHash common.Hash
+		index  uint
+	}
+	seen := map[logID]struct{}{}
+	transactions := []*ethtypes.IndexedTransaction{}
+	byHash := map[common.Hash]*ethtypes.IndexedTransaction{}
+	for rangeStart := from; rangeStart <= to; rangeStart += logsRangeSize {
+		rangeEnd := rangeStart + logsRangeSize - 1
+		if rangeEnd > to {
+			rangeEnd = to
+		}
+		for _, topics := range queries {
+			logs, err := source.client.FilterLogs(context.TODO(), ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(rangeStart),
+				ToBlock:   new(big.Int).SetUint64(rangeEnd),
+				Addresses: []common.Address{erc20Token.ContractAddress()},
+				Topics:    topics,
+			})
+			if err != nil {
+				return nil, errp.WithStack(err)
+			}
+			for i := range logs {
+				log := &logs[i]
+				// Skip non-standard events, e.g. ERC721 transfers, which index the third argument.
+				if log.Removed || len(log.Topics) != 3 || len(log.Data) != 32 {
+					continue
+				}
+				if _, ok := seen[logID{log.TxHash, log.Index}]; ok {
+					continue
+				}
+				seen[logID{log.TxHash, log.Index}] = struct{}{}
+				sender := common.BytesToAddress(log.Topics[1].Bytes())
+				recipient := common.BytesToAddress(log.Topics[2].Bytes())
+				value := new(big.Int).SetBytes(log.Data)
+				if transaction, ok := byHash[log.TxHash]; ok &&
+					transaction.From == sender && transaction.To == recipient {
+					transaction.Value.Add(transaction.Value, value)
+					continue
+				}
+				transaction := &ethtypes.IndexedTransaction{
+					Hash:        log.TxHash,
+					BlockNumber: log.BlockNumber,
+					From:        sender,
+					To:          recipient,
+					Value:       value,
+				}
+				byHash[log.TxHash] = transaction
+				transactions = append(transactions, transaction)
+			}
+		}
+	}
+
+	timestamps := map[uint64]uint64{}
+	for _, transaction := range transactions {
+		timestamp, ok := timestamps[transaction.BlockNumber]
+		if !ok {
+			header, err := source.client.HeaderByNumber(
+				context.TODO(), new(big.Int).SetUint64(transaction.BlockNumber))
+			if err != nil {
+				return nil, errp.WithStack(err)
+			}
+			timestamp = header.Time
+			timestamps[transaction.BlockNumber] = timestamp
+		}
+		transaction.Timestamp = timestamp
+		if transaction.From == address {
+			if err := source.addReceipt(transaction, address, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return transactions, nil
+}
+
+// addReceipt sets the status of the transaction and, if it was sent from the address, the gas used
+// and fee. gasPrice is used if the receipt does not contain the effective gas price (pre EIP-1559
+// nodes). If nil, it is fetched from the node.
+func (source *NodeSource) addReceipt(
+	transaction *ethtypes.IndexedTransaction, address common.Address, gasPrice *big.Int) error {
+	receipt, err := source.client.TransactionReceiptWithBlockNumber(context.TODO(), transaction.Hash)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if receipt == nil {
+		return errp.Newf("receipt of %s not found", transaction.Hash.Hex())
+	}
+	transaction.Failed = receipt.Status == types.ReceiptStatusFailed
+	if transaction.From != address {
+		return nil
+	}
+	if receipt.EffectiveGasPrice != nil {
+		gasPrice = receipt.EffectiveGasPrice
+	}
+	if gasPrice == nil {
+		tx, _, err := source.client.TransactionByHash(context.TODO(), transaction.Hash)
+		if err != nil {
+			return err
+		}
+		gasPrice = tx.GasPrice()
+	}
+	transaction.GasUsed = receipt.GasUsed
+	transaction.Fee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), gasPrice)
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodesource
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/db"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/test"
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ourAddress   = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	otherAddress = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	tokenAddress = common.HexToAddress("0x3333333333333333333333333333333333333333")
+)
+
+func newNodeSource(t *testing.T, client rpcclient.Interface, startBlock uint64) *NodeSource {
+	t.Helper()
+	dbFilename := test.TstTempFile("nodesource-db")
+	indexDB, err := db.NewDB(dbFilename)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, indexDB.Close())
+		_ = os.Remove(dbFilename)
+	})
+	return NewNodeSource(client, indexDB, startBlock)
+}
+
+func TestTransactionsETH(t *testing.T) {
+	send := &rpcclient.RPCBlockTransaction{
+		Hash:     common.HexToHash("0x01"),
+		From:     ourAddress,
+		To:       &otherAddress,
+		Value:    (*hexutil.Big)(big.NewInt(100)),
+		Nonce:    5,
+		GasPrice: (*hexutil.Big)(big.NewInt(10)),
+	}
+	receive := &rpcclient.RPCBlockTransaction{
+		Hash:     common.HexToHash("0x02"),
+		From:     otherAddress,
+		To:       &ourAddress,
+		Value:    (*hexutil.Big)(big.NewInt(200)),
+		GasPrice: (*hexutil.Big)(big.NewInt(10)),
+	}
+	unrelated := &rpcclient.RPCBlockTransaction{
+		Hash:     common.HexToHash("0x03"),
+		From:     otherAddress,
+		To:       &otherAddress,
+		Value:    (*hexutil.Big)(big.NewInt(300)),
+		GasPrice: (*hexutil.Big)(big.NewInt(10)),
+	}
+	blocks := map[uint64][]*rpcclient.RPCBlockTransaction{
+		101: {send, unrelated},
+		103: {receive},
+	}
+	var fetchedBlocks []uint64
+	client := &mocks.InterfaceMock{
+		BlockWithTransactionsFunc: func(ctx context.Context, number *big.Int) (*rpcclient.RPCBlock, error) {
+			fetchedBlocks = append(fetchedBlocks, number.Uint64())
+			return &rpcclient.RPCBlock{
+				Number:       hexutil.Uint64(number.Uint64()),
+				Timestamp:    hexutil.Uint64(1600000000 + number.Uint64()),
+				Transactions: blocks[number.Uint64()],
+			}, nil
+		},
+		TransactionReceiptWithBlockNumberFunc: func(
+			ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
+			receipt := &rpcclient.RPCTransactionReceipt{
+				Receipt: types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 21000},
+			}
+			if hash == send.Hash {
+				receipt.Status = types.ReceiptStatusFailed
+			}
+			return receipt, nil
+		},
+	}
+	source := newNodeSource(t, client, 100)
+
+	// Blocks 104 and 105 are not sufficiently confirmed yet.
+	transactions, err := source.Transactions(big.NewInt(105), ourAddress, big.NewInt(105), nil)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100, 101, 102, 103}, fetchedBlocks)
+	require.Len(t, transactions, 2)
+
+	require.Equal(t, receive.Hash.Hex(), transactions[0].TxID)
+	require.Equal(t, accounts.TxTypeReceive, transactions[0].Type)
+	require.Equal(t, coin.NewAmountFromInt64(200), transactions[0].Amount)
+	require.Nil(t, transactions[0].Fee)
+	require.Equal(t, 103, transactions[0].Height)
+	require.Equal(t, 3, transactions[0].NumConfirmations)
+	require.Equal(t, int64(1600000103), transactions[0].Timestamp.Unix())
+
+	require.Equal(t, send.Hash.Hex(), transactions[1].TxID)
+	require.Equal(t, accounts.TxTypeSend, transactions[1].Type)
+	require.Equal(t, accounts.TxStatusFailed, transactions[1].Status)
+	require.Equal(t, otherAddress.Hex(), transactions[1].Addresses[0].Address)
+	fee := coin.NewAmountFromInt64(210000)
+	require.Equal(t, &fee, transactions[1].Fee)
+	require.Equal(t, uint64(5), *transactions[1].Nonce)
+
+	// Already scanned blocks are not fetched again.
+	fetchedBlocks = nil
+	transactions, err = source.Transactions(big.NewInt(106), ourAddress, big.NewInt(106), nil)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{104}, fetchedBlocks)
+	require.Len(t, transactions, 2)
+
+	// Other addresses are indexed separately.
+	fetchedBlocks = nil
+	transactions, err = source.Transactions(big.NewInt(106), otherAddress, big.NewInt(106), nil)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100, 101, 102, 103, 104}, fetchedBlocks)
+	require.Len(t, transactions, 3)
+}
+
+func TestTransactionsERC20(t *testing.T) {
+	token := erc20.NewToken(tokenAddress.Hex(), 18)
+	transferLog := func(txHash common.Hash, index uint, blockNumber uint64,
+		from, to common.Address, value int64) types.Log {
+		return types.Log{
+			Address: tokenAddress,
+			Topics: []common.Hash{
+				transferEventTopic,
+				common.BytesToHash(from.Bytes()),
+				common.BytesToHash(to.Bytes()),
+			},
+			Data:        common.BigToHash(big.NewInt(value)).Bytes(),
+			BlockNumber: blockNumber,
+			TxHash:      txHash,
+			Index:       index,
+		}
+	}
+	logs := []types.Log{
+		transferLog(common.HexToHash("0x01"), 0, 150, otherAddress, ourAddress, 10),
+		// Two transfers to us in the same transaction.
+		transferLog(common.HexToHash("0x02"), 0, 20000, otherAddress, ourAddress, 20),
+		transferLog(common.HexToHash("0x02"), 1, 20000, otherAddress, ourAddress, 30),
+		transferLog(common.HexToHash("0x03"), 0, 25000, ourAddress, otherAddress, 40),
+		// Sent to self, returned by both queries.
+		transferLog(common.HexToHash("0x04"), 0, 25001, ourAddress, ourAddress, 50),
+	}
+	var queries []ethereum.FilterQuery
+	client := &mocks.InterfaceMock{
+		FilterLogsFunc: func(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+			queries = append(queries, query)
+			require.Equal(t, []common.Address{tokenAddress}, query.Addresses)
+			require.Equal(t, []common.Hash{transferEventTopic}, query.Topics[0])
+			var result []types.Log
+			for _, log := range logs {
+				if log.BlockNumber < query.FromBlock.Uint64() || log.BlockNumber > query.ToBlock.Uint64() {
+					continue
+				}
+				if len(query.Topics) == 2 && log.Topics[1] == query.Topics[1][0] ||
+					len(query.Topics) == 3 && log.Topics[2] == query.Topics[2][0] {
+					result = append(result, log)
+				}
+			}
+			return result, nil
+		},
+		HeaderByNumberFunc: func(ctx context.Context, number *big.Int) (*types.Header, error) {
+			return &types.Header{Number: number, Time: 1600000000 + number.Uint64()}, nil
+		},
+		TransactionReceiptWithBlockNumberFunc: func(
+			ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
+			return &rpcclient.RPCTransactionReceipt{
+				Receipt:           types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: 50000},
+				EffectiveGasPrice: big.NewInt(3),
+			}, nil
+		},
+	}
+	source := newNodeSource(t, client, 100)
+
+	transactions, err := source.Transactions(big.NewInt(30000), ourAddress, big.NewInt(30000), token)
+	require.NoError(t, err)
+	// Blocks 100..29998 in ranges of logsRangeSize, two queries per range.
+	require.Len(t, queries, 6)
+	require.Equal(t, uint64(29998), queries[5].ToBlock.Uint64())
+	require.Len(t, transactions, 4)
+
+	require.Equal(t, common.HexToHash("0x04").Hex(), transactions[0].TxID)
+	require.Equal(t, accounts.TxTypeSendSelf, transactions[0].Type)
+	require.Equal(t, coin.NewAmountFromInt64(50), transactions[0].Amount)
+
+	require.Equal(t, common.HexToHash("0x03").Hex(), transactions[1].TxID)
+	require.Equal(t, accounts.TxTypeSend, transactions[1].Type)
+	require.True(t, transactions[1].FeeIsDifferentUnit)
+	fee := coin.NewAmountFromInt64(150000)
+	require.Equal(t, &fee, transactions[1].Fee)
+
+	require.Equal(t, common.HexToHash("0x02").Hex(), transactions[2].TxID)
+	require.Equal(t, accounts.TxTypeReceive, transactions[2].Type)
+	require.Equal(t, coin.NewAmountFromInt64(50), transactions[2].Amount)
+	require.Nil(t, transactions[2].Fee)
+
+	require.Equal(t, common.HexToHash("0x01").Hex(), transactions[3].TxID)
+	require.Equal(t, int64(1600000150), transactions[3].Timestamp.Unix())
+}
@@ -0,0 +1,274 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// droppedBroadcastAttempts is the number of broadcast attempts after which a pending outgoing
+// transaction unknown to the node is considered dropped. Transactions are rebroadcast in every
+// update if the node does not know them, see updateOutgoingTransactions().
+const droppedBroadcastAttempts = 3
+
+// NonceIssueKind is the kind of a nonce issue.
+type NonceIssueKind string
+
+const (
+	// NonceIssueGap means that no transaction with this nonce is known, neither locally nor by the
+	// node. All transactions with a higher nonce are stuck until a transaction with this nonce is
+	// mined. This happens e.g. if a transaction sent from another wallet was dropped. It can be
+	// resolved with FillNonceGap().
+	NonceIssueGap NonceIssueKind = "gap"
+	// NonceIssueDropped means that one of our pending transactions is not known by the node anymore
+	// despite being rebroadcast. It can be resolved with RebroadcastTx(), or by replacing it with
+	// SpeedUpTx() or CancelTx().
+	NonceIssueDropped NonceIssueKind = "dropped"
+)
+
+// NonceIssue is a problem with the nonces of the outgoing transactions which prevents transactions
+// from being mined.
+type NonceIssue struct {
+	Kind  NonceIssueKind `json:"kind"`
+	Nonce uint64         `json:"nonce"`
+	// TxID is the ID of the dropped transaction. Empty for gaps.
+	TxID string `json:"txID,omitempty"`
+}
+
+// nonceState is the result of reconcileNonces().
+type nonceState struct {
+	// nextNonce is the nonce to be used for the next transaction.
+	nextNonce uint64
+	// issues are sorted by nonce.
+	issues []NonceIssue
+}
+
+// reconcileNonces reconciles the nonces of the locally stored outgoing transactions with the nonces
+// reported by the node. otherOutgoingTransactions are the outgoing transactions of the other
+// accounts with the same address, e.g. of the ERC20 token accounts of an Ethereum account, which
+// use the same nonces. confirmedNonce is the nonce of the next transaction to be mined (the number
+// of mined transactions), and pendingNonce additionally counts the transactions in the node's
+// mempool.
+//
+// The next nonce follows all pending transactions. Gaps are only reported, see NonceIssueGap, as
+// using a missing nonce for the next transaction could replace a transaction the node does not
+// know yet.
+func reconcileNonces(
+	outgoingTransactions []*ethtypes.TransactionWithMetadata,
+	otherOutgoingTransactions []*ethtypes.TransactionWithMetadata,
+	confirmedNonce uint64,
+	pendingNonce uint64,
+) nonceState {
+	if pendingNonce < confirmedNonce {
+		// The node can lag behind in the pending state.
+		pendingNonce = confirmedNonce
+	}
+	isPending := func(tx *ethtypes.TransactionWithMetadata) bool {
+		return tx.Height == 0 && tx.ReplacedBy == nil && tx.Transaction.Nonce() >= confirmedNonce
+	}
+	// Transactions of all accounts of the address which could still be mined.
+	pendingNonces := map[uint64]struct{}{}
+	for _, tx := range otherOutgoingTransactions {
+		if isPending(tx) {
+			pendingNonces[tx.Transaction.Nonce()] = struct{}{}
+		}
+	}
+
+	state := nonceState{nextNonce: pendingNonce}
+	for _, tx := range outgoingTransactions {
+		if !isPending(tx) {
+			continue
+		}
+		nonce := tx.Transaction.Nonce()
+		pendingNonces[nonce] = struct{}{}
+		// The node counts all pending transactions with contiguous nonces, so if it knew this
+		// transaction, the pending nonce would be higher.
+		if nonce >= pendingNonce && tx.BroadcastAttempts >= droppedBroadcastAttempts {
+			state.issues = append(state.issues, NonceIssue{
+				Kind:  NonceIssueDropped,
+				Nonce: nonce,
+				TxID:  tx.TxID(),
+			})
+		}
+	}
+	for nonce := range pendingNonces {
+		if nonce+1 > state.nextNonce {
+			state.nextNonce = nonce + 1
+		}
+	}
+	// Nonces below the pending nonce are known by the node, so gaps can only appear above.
+	for nonce := pendingNonce; nonce < state.nextNonce; nonce++ {
+		if _, ok := pendingNonces[nonce]; !ok {
+			state.issues = append(state.issues, NonceIssue{Kind: NonceIssueGap, Nonce: nonce})
+		}
+	}
+	sort.Slice(state.issues, func(i, j int) bool {
+		return state.issues[i].Nonce < state.issues[j].Nonce
+	})
+	return state
+}
+
+// outgoingTransactionsRegistry holds the outgoing transactions of all accounts, found in their
+// last update. Accounts with the same address, e.g. an Ethereum account and its ERC20 token
+// accounts, store their transactions in separate databases, but share the nonces.
+type outgoingTransactionsRegistry struct {
+	transactions map[*Account][]*ethtypes.TransactionWithMetadata
+	lock         locker.Locker
+}
+
+var accountsOutgoingTransactions = &outgoingTransactionsRegistry{
+	transactions: map[*Account][]*ethtypes.TransactionWithMetadata{},
+}
+
+// set stores the outgoing transactions of the account.
+func (registry *outgoingTransactionsRegistry) set(
+	account *Account, transactions []*ethtypes.TransactionWithMetadata) {
+	defer registry.lock.Lock()()
+	registry.transactions[account] = transactions
+}
+
+// remove removes the account, e.g. when it is closed.
+func (registry *outgoingTransactionsRegistry) remove(account *Account) {
+	defer registry.lock.Lock()()
+	delete(registry.transactions, account)
+}
+
+// others returns the outgoing transactions of all other accounts with the same address on the
+// same chain as the given account.
+func (registry *outgoingTransactionsRegistry) others(
+	account *Account) []*ethtypes.TransactionWithMetadata {
+	defer registry.lock.RLock()()
+	var result []*ethtypes.TransactionWithMetadata
+	for other, transactions := range registry.transactions {
+		if other == account ||
+			other.address.Address != account.address.Address ||
+			other.coin.Net().ChainID.Cmp(account.coin.Net().ChainID) != 0 {
+			continue
+		}
+		result = append(result, transactions...)
+	}
+	return result
+}
+
+// NonceIssues returns the nonce issues found in the last update, see NonceIssue.
+func (account *Account) NonceIssues() []NonceIssue {
+	defer account.RLock()()
+	return append([]NonceIssue{}, account.nonceIssues...)
+}
+
+// RebroadcastTx broadcasts the pending outgoing transaction with the given ID again, e.g. after it
+// was dropped by the node, see NonceIssueDropped.
+func (account *Account) RebroadcastTx(txID string) error {
+	tx, err := account.pendingOutgoingTransaction(txID)
+	if err != nil {
+		return err
+	}
+	if err := account.broadcast(tx.Transaction); err != nil {
+		return err
+	}
+	dbTx, err := account.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	// Give the node a chance to pick up the transaction again before flagging it as dropped.
+	tx.BroadcastAttempts = 1
+	if err := dbTx.PutOutgoingTransaction(tx); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return err
+	}
+	account.enqueueUpdateCh <- struct{}{}
+	return nil
+}
+
+// FillNonceGap sends a zero value transaction to our own address with the given nonce, which must
+// be a gap (see NonceIssueGap), so the transactions with a higher nonce can be mined. Returns the ID
+// of the new transaction. Only possible with Ethereum accounts, not with ERC20 token accounts.
+func (account *Account) FillNonceGap(
+	nonce uint64, feeTargetCode accounts.FeeTargetCode, customFee string) (string, error) {
+	if account.coin.erc20Token != nil {
+		return "", errp.New("Nonce gaps can only be filled using the Ethereum account")
+	}
+	isGap := false
+	for _, issue := range account.NonceIssues() {
+		if issue.Kind == NonceIssueGap && issue.Nonce == nonce {
+			isGap = true
+			break
+		}
+	}
+	if !isGap {
+		return "", errp.Newf("Nonce %d is not a gap", nonce)
+	}
+	selectedFeeTarget, err := account.selectedFeeTarget(&accounts.TxProposalArgs{
+		FeeTargetCode: feeTargetCode,
+		CustomFee:     customFee,
+	})
+	if err != nil {
+		if _, ok := errp.Cause(err).(errors.TxValidationError); ok {
+			return "", err
+		}
+		account.log.WithError(err).Error("error getting the gas price")
+		return "", errp.WithStack(errors.ErrFeesNotAvailable)
+	}
+
+	var tx ethtypes.Transaction
+	gasFeeCap := selectedFeeTarget.gasPrice
+	if selectedFeeTarget.gasFeeCap != nil && account.supportsEIP1559() {
+		gasFeeCap = selectedFeeTarget.gasFeeCap
+		tx = ethtypes.NewDynamicFeeTx(
+			account.coin.Net().ChainID, nonce, account.address.Address, big.NewInt(0),
+			cancelTxGasLimit, selectedFeeTarget.gasTipCap, gasFeeCap, nil)
+	} else {
+		tx = types.NewTransaction(
+			nonce, account.address.Address, big.NewInt(0), cancelTxGasLimit, gasFeeCap, nil)
+	}
+	maxFee := new(big.Int).Mul(big.NewInt(cancelTxGasLimit), gasFeeCap)
+	// Make sure account.balance is up to date.
+	account.Synchronizer.WaitSynchronized()
+	if maxFee.Cmp(account.balance.BigInt()) > 0 {
+		return "", errp.WithStack(errors.ErrInsufficientFunds)
+	}
+	txProposal := &TxProposal{
+		Coin:    account.coin,
+		Tx:      tx,
+		Fee:     maxFee,
+		Value:   big.NewInt(0),
+		Signer:  types.MakeSigner(account.coin.Net(), account.blockNumber),
+		Keypath: account.signingConfiguration.AbsoluteKeypath(),
+
+		RecipientAddress: account.address.Address,
+	}
+	if err := account.Config().Keystore.SignTransaction(txProposal); err != nil {
+		return "", err
+	}
+	if err := account.broadcast(txProposal.Tx); err != nil {
+		return "", err
+	}
+	if err := account.storePendingOutgoingTransaction(txProposal.Tx); err != nil {
+		return "", err
+	}
+	account.enqueueUpdateCh <- struct{}{}
+	return txProposal.Tx.Hash().Hex(), nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient/mocks"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func outgoingTx(nonce uint64, height uint64, broadcastAttempts uint16) *ethtypes.TransactionWithMetadata {
+	return &ethtypes.TransactionWithMetadata{
+		Transaction: types.NewTransaction(
+			nonce, common.Address{}, big.NewInt(1), 21000, big.NewInt(1), nil),
+		Height:            height,
+		BroadcastAttempts: broadcastAttempts,
+	}
+}
+
+func TestReconcileNonces(t *testing.T) {
+	replaced := outgoingTx(4, 0, droppedBroadcastAttempts)
+	replacedBy := common.Hash{}
+	replaced.ReplacedBy = &replacedBy
+	dropped := outgoingTx(5, 0, droppedBroadcastAttempts)
+
+	tests := []struct {
+		name           string
+		outgoing       []*ethtypes.TransactionWithMetadata
+		otherOutgoing  []*ethtypes.TransactionWithMetadata
+		confirmedNonce uint64
+		pendingNonce   uint64
+		expected       nonceState
+	}{
+		{
+			name:           "no transactions",
+			confirmedNonce: 3,
+			pendingNonce:   3,
+			expected:       nonceState{nextNonce: 3},
+		},
+		{
+			name:           "node knows pending transactions",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(4, 0, 1), outgoingTx(3, 0, 1), outgoingTx(2, 10, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   5,
+			expected:       nonceState{nextNonce: 5},
+		},
+		{
+			name:           "node lags behind",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(4, 0, 1), outgoingTx(3, 0, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   3,
+			expected:       nonceState{nextNonce: 5},
+		},
+		{
+			name:           "pending nonce below confirmed nonce",
+			confirmedNonce: 3,
+			pendingNonce:   2,
+			expected:       nonceState{nextNonce: 3},
+		},
+		{
+			name:           "transactions from another wallet in the mempool",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(6, 0, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   7,
+			expected:       nonceState{nextNonce: 7},
+		},
+		{
+			name:           "gap",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(7, 0, 1), outgoingTx(5, 0, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   3,
+			expected: nonceState{
+				nextNonce: 8,
+				issues: []NonceIssue{
+					{Kind: NonceIssueGap, Nonce: 3},
+					{Kind: NonceIssueGap, Nonce: 4},
+					{Kind: NonceIssueGap, Nonce: 6},
+				},
+			},
+		},
+		{
+			name:           "transactions of other accounts of the address",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(3, 0, 1)},
+			otherOutgoing:  []*ethtypes.TransactionWithMetadata{outgoingTx(4, 0, 1), outgoingTx(2, 10, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   3,
+			expected:       nonceState{nextNonce: 5},
+		},
+		{
+			name:           "gap filled by another account",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(5, 0, 1)},
+			otherOutgoing:  []*ethtypes.TransactionWithMetadata{outgoingTx(3, 0, 1)},
+			confirmedNonce: 3,
+			pendingNonce:   3,
+			expected: nonceState{
+				nextNonce: 6,
+				issues:    []NonceIssue{{Kind: NonceIssueGap, Nonce: 4}},
+			},
+		},
+		{
+			name:           "dropped transactions of other accounts are reported there",
+			otherOutgoing:  []*ethtypes.TransactionWithMetadata{dropped},
+			confirmedNonce: 4,
+			pendingNonce:   5,
+			expected:       nonceState{nextNonce: 6},
+		},
+		{
+			name:           "dropped",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(6, 0, 1), dropped, replaced},
+			confirmedNonce: 4,
+			pendingNonce:   5,
+			expected: nonceState{
+				nextNonce: 7,
+				issues: []NonceIssue{
+					{Kind: NonceIssueDropped, Nonce: 5, TxID: dropped.TxID()},
+				},
+			},
+		},
+		{
+			name:           "rebroadcast but known to the node",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(5, 0, droppedBroadcastAttempts)},
+			confirmedNonce: 4,
+			pendingNonce:   6,
+			expected:       nonceState{nextNonce: 6},
+		},
+		{
+			name:           "outdated pending transaction",
+			outgoing:       []*ethtypes.TransactionWithMetadata{outgoingTx(2, 0, droppedBroadcastAttempts)},
+			confirmedNonce: 4,
+			pendingNonce:   4,
+			expected:       nonceState{nextNonce: 4},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t,
+				test.expected,
+				reconcileNonces(
+					test.outgoing, test.otherOutgoing, test.confirmedNonce, test.pendingNonce))
+		})
+	}
+}
+
+func TestOutgoingTransactionsRegistry(t *testing.T) {
+	registry := &outgoingTransactionsRegistry{
+		transactions: map[*Account][]*ethtypes.TransactionWithMetadata{},
+	}
+	ethAccount := newAccount(t)
+	defer ethAccount.Close()
+	tokenAccount := newAccount(t)
+	defer tokenAccount.Close()
+	otherAccount := newAccount(t)
+	defer otherAccount.Close()
+	otherAccount.address.Address = common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+	ethTx := outgoingTx(3, 0, 1)
+	tokenTx := outgoingTx(4, 0, 1)
+	registry.set(ethAccount, []*ethtypes.TransactionWithMetadata{ethTx})
+	registry.set(tokenAccount, []*ethtypes.TransactionWithMetadata{tokenTx})
+	registry.set(otherAccount, []*ethtypes.TransactionWithMetadata{outgoingTx(5, 0, 1)})
+
+	require.Equal(t, []*ethtypes.TransactionWithMetadata{tokenTx}, registry.others(ethAccount))
+	require.Equal(t, []*ethtypes.TransactionWithMetadata{ethTx}, registry.others(tokenAccount))
+	registry.remove(tokenAccount)
+	require.Empty(t, registry.others(ethAccount))
+}
+
+func TestFillNonceGap(t *testing.T) {
+	acct := newAccount(t)
+	defer acct.Close()
+
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	acct.Config().Keystore = &keystoremock.KeystoreMock{
+		SupportsEIP1559Func: func() bool { return false },
+		SignTransactionFunc: func(proposal interface{}) error {
+			txProposal := proposal.(*TxProposal)
+			signedTx, err := types.SignTx(
+				txProposal.Tx.(*types.Transaction), txProposal.Signer, privateKey)
+			if err != nil {
+				return err
+			}
+			txProposal.Tx = signedTx
+			return nil
+		},
+	}
+	var broadcasted []ethtypes.Transaction
+	client := acct.coin.client.(*mocks.InterfaceMock)
+	client.SendRawTransactionFunc = func(ctx context.Context, rawTx []byte) error {
+		tx, err := ethtypes.DecodeTransaction(rawTx)
+		require.NoError(t, err)
+		broadcasted = append(broadcasted, tx)
+		return nil
+	}
+	client.TransactionReceiptWithBlockNumberFunc = func(
+		ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
+		return nil, nil
+	}
+	client.TransactionByHashFunc = func(
+		ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
+		// Known to the node, no automatic rebroadcast.
+		return nil, true, nil
+	}
+
+	unlock := acct.Lock()
+	acct.nonceIssues = []NonceIssue{{Kind: NonceIssueGap, Nonce: 3}}
+	unlock()
+
+	_, err = acct.FillNonceGap(4, accounts.FeeTargetCodeCustom, "20")
+	require.Error(t, err)
+	require.Empty(t, broadcasted)
+
+	txID, err := acct.FillNonceGap(3, accounts.FeeTargetCodeCustom, "20")
+	require.NoError(t, err)
+	require.Len(t, broadcasted, 1)
+	require.Equal(t, txID, broadcasted[0].Hash().Hex())
+	require.Equal(t, uint64(3), broadcasted[0].Nonce())
+	require.Equal(t, acct.address.Address, *broadcasted[0].To())
+	require.Equal(t, big.NewInt(0), broadcasted[0].Value())
+	require.Equal(t, big.NewInt(20e9), broadcasted[0].GasPrice())
+
+	// The transaction is stored, so it can be rebroadcast.
+	require.NoError(t, acct.RebroadcastTx(txID))
+	require.Len(t, broadcasted, 2)
+	require.Equal(t, txID, broadcasted[1].Hash().Hex())
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts/errors"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// cancelTxGasLimit is the gas limit of a plain ether transfer, used for cancellations.
+const cancelTxGasLimit = 21000
+
+// Nodes only accept a replacement transaction if both the fee cap and the tip are raised by at
+// least 10% (geth's default price bump).
+const replacementPriceBumpPercent = 10
+
+// minReplacementPrice returns the minimum price accepted for a replacement of a transaction paying
+// price.
+func minReplacementPrice(price *big.Int) *big.Int {
+	minPrice := new(big.Int).Mul(price, big.NewInt(100+replacementPriceBumpPercent))
+	minPrice.Add(minPrice, big.NewInt(99))
+	return minPrice.Div(minPrice, big.NewInt(100))
+}
+
+func maxBigInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// pendingOutgoingTransaction returns the stored outgoing transaction with the given ID if it can be
+// replaced.
+func (account *Account) pendingOutgoingTransaction(txID string) (*ethtypes.TransactionWithMetadata, error) {
+	dbTx, err := account.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
+	outgoingTransactions, err := dbTx.OutgoingTransactions()
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range outgoingTransactions {
+		if tx.TxID() != txID {
+			continue
+		}
+		if tx.Height > 0 {
+			return nil, errp.New("Transaction is already confirmed")
+		}
+		if tx.ReplacedBy != nil {
+			return nil, errp.New("Transaction was already replaced")
+		}
+		return tx, nil
+	}
+	return nil, errp.New("Transaction not found")
+}
+
+// replaceTx replaces the pending outgoing transaction with the given ID by a new transaction with
+// the same nonce paying a higher fee. If cancel is true, the replacement is a zero value
+// transaction to our own address, otherwise it has the same recipient, value and data. The fee is
+// the one of the given fee target, raised to the minimum accepted for replacements if needed. The
+// replacement is signed by the keystore and broadcast, and its transaction ID is returned.
+func (account *Account) replaceTx(
+	txID string, cancel bool, feeTargetCode accounts.FeeTargetCode, customFee string) (string, error) {
+	oldTx, err := account.pendingOutgoingTransaction(txID)
+	if err != nil {
+		return "", err
+	}
+	selectedFeeTarget, err := account.selectedFeeTarget(&accounts.TxProposalArgs{
+		FeeTargetCode: feeTargetCode,
+		CustomFee:     customFee,
+	})
+	if err != nil {
+		if _, ok := errp.Cause(err).(errors.TxValidationError); ok {
+			return "", err
+		}
+		account.log.WithError(err).Error("error getting the gas price")
+		return "", errp.WithStack(errors.ErrFeesNotAvailable)
+	}
+
+	nonce := oldTx.Transaction.Nonce()
+	recipient := oldTx.Transaction.To()
+	if recipient == nil {
+		return "", errp.New("contract creation not supported")
+	}
+	value := oldTx.Transaction.Value()
+	data := oldTx.Transaction.Data()
+	gasLimit := oldTx.Transaction.Gas()
+	if cancel {
+		recipient = &account.address.Address
+		value = big.NewInt(0)
+		data = nil
+		gasLimit = cancelTxGasLimit
+	}
+
+	// The tip of legacy transactions is their gas price.
+	oldGasTipCap := oldTx.Transaction.GasPrice()
+	if dynamicTx, ok := oldTx.Transaction.(*ethtypes.DynamicFeeTx); ok {
+		oldGasTipCap = dynamicTx.GasTipCap()
+	}
+	minGasFeeCap := minReplacementPrice(oldTx.Transaction.GasPrice())
+	minGasTipCap := minReplacementPrice(oldGasTipCap)
+
+	var tx ethtypes.Transaction
+	var gasFeeCap *big.Int
+	if selectedFeeTarget.gasFeeCap != nil && account.supportsEIP1559() {
+		gasTipCap := maxBigInt(selectedFeeTarget.gasTipCap, minGasTipCap)
+		gasFeeCap = maxBigInt(maxBigInt(selectedFeeTarget.gasFeeCap, minGasFeeCap), gasTipCap)
+		tx = ethtypes.NewDynamicFeeTx(
+			account.coin.Net().ChainID, nonce, *recipient, value, gasLimit, gasTipCap, gasFeeCap, data)
+	} else {
+		gasFeeCap = maxBigInt(maxBigInt(selectedFeeTarget.gasPrice, minGasFeeCap), minGasTipCap)
+		tx = types.NewTransaction(nonce, *recipient, value, gasLimit, gasFeeCap, data)
+	}
+	maxFee := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasFeeCap)
+
+	// For ERC20 tokens, the balance is the token balance, while the fee is paid in ether, so we
+	// can't check it here.
+	if account.coin.erc20Token == nil {
+		// Make sure account.balance is up to date for the check below.
+		account.Synchronizer.WaitSynchronized()
+		total := new(big.Int).Add(value, maxFee)
+		if total.Cmp(account.balance.BigInt()) > 0 {
+			return "", errp.WithStack(errors.ErrInsufficientFunds)
+		}
+	}
+
+	txProposal := &TxProposal{
+		Coin:    account.coin,
+		Tx:      tx,
+		Fee:     maxFee,
+		Value:   value,
+		Signer:  types.MakeSigner(account.coin.Net(), account.blockNumber),
+		Keypath: account.signingConfiguration.AbsoluteKeypath(),
+	}
+	if err := account.Config().Keystore.SignTransaction(txProposal); err != nil {
+		return "", err
+	}
+	if err := account.broadcast(txProposal.Tx); err != nil {
+		return "", err
+	}
+	if err := account.storeReplacementTransaction(oldTx.Transaction.Hash(), txProposal.Tx); err != nil {
+		return "", err
+	}
+	newTxID := txProposal.Tx.Hash().Hex()
+	if note := account.TxNote(txID); note != "" && !cancel {
+		if err := account.SetTxNote(newTxID, note); err != nil {
+			// Not critical.
+			account.log.WithError(err).Error("Failed to copy the transaction note to the replacement")
+		}
+	}
+	account.enqueueUpdateCh <- struct{}{}
+	return newTxID, nil
+}
+
+// storeReplacementTransaction stores the replacement as a pending outgoing transaction and marks
+// the replaced transaction.
+func (account *Account) storeReplacementTransaction(
+	replacedTxHash ethcommon.Hash, transaction ethtypes.Transaction) error {
+	dbTx, err := account.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+	if err := dbTx.PutOutgoingTransaction(
+		&ethtypes.TransactionWithMetadata{
+			Transaction:       transaction,
+			BroadcastAttempts: 1,
+		}); err != nil {
+		return err
+	}
+	if err := dbTx.MarkOutgoingTransactionReplaced(replacedTxHash, transaction.Hash()); err != nil {
+		return err
+	}
+	if err := dbTx.Commit(); err != nil {
+		return err
+	}
+	account.log.Infof("stored replacement tx with nonce: %d", transaction.Nonce())
+	return nil
+}
+
+// SpeedUpTx replaces the pending outgoing transaction with the given ID by the same transaction
+// paying a higher fee, so it is confirmed faster. Returns the ID of the replacement.
+func (account *Account) SpeedUpTx(
+	txID string, feeTargetCode accounts.FeeTargetCode, customFee string) (string, error) {
+	return account.replaceTx(txID, false, feeTargetCode, customFee)
+}
+
+// CancelTx replaces the pending outgoing transaction with the given ID by a zero value transaction
+// to our own address with the same nonce, paying a higher fee. If the replacement is confirmed
+// first, the original transaction becomes invalid. Returns the ID of the replacement.
+func (account *Account) CancelTx(
+	txID string, feeTargetCode accounts.FeeTargetCode, customFee string) (string, error) {
+	return account.replaceTx(txID, true, feeTargetCode, customFee)
+}
@@ -6,6 +6,7 @@ package mocks
 import (
 	"context"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/rpcclient"
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -15,13 +16,17 @@ import (
 
 var (
 	lockInterfaceMockBalanceAt                         sync.RWMutex
+	lockInterfaceMockBlockWithTransactions             sync.RWMutex
 	lockInterfaceMockCallContract                      sync.RWMutex
 	lockInterfaceMockCodeAt                            sync.RWMutex
 	lockInterfaceMockEstimateGas                       sync.RWMutex
+	lockInterfaceMockFeeHistory                        sync.RWMutex
 	lockInterfaceMockFilterLogs                        sync.RWMutex
 	lockInterfaceMockHeaderByNumber                    sync.RWMutex
+	lockInterfaceMockNonceAt                           sync.RWMutex
 	lockInterfaceMockPendingCodeAt                     sync.RWMutex
 	lockInterfaceMockPendingNonceAt                    sync.RWMutex
+	lockInterfaceMockSendRawTransaction                sync.RWMutex
 	lockInterfaceMockSendTransaction                   sync.RWMutex
 	lockInterfaceMockSubscribeFilterLogs               sync.RWMutex
 	lockInterfaceMockSuggestGasPrice                   sync.RWMutex
@@ -42,6 +47,9 @@ var _ rpcclient.Interface = &InterfaceMock{}
 //             BalanceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
 // 	               panic("mock out the BalanceAt method")
 //             },
+//             BlockWithTransactionsFunc: func(ctx context.Context, number *big.Int) (*rpcclient.RPCBlock, error) {
+// 	               panic("mock out the BlockWithTransactions method")
+//             },
 //             CallContractFunc: func(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
 // 	               panic("mock out the CallContract method")
 //             },
@@ -51,18 +59,27 @@ var _ rpcclient.Interface = &InterfaceMock{}
 //             EstimateGasFunc: func(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
 // 	               panic("mock out the EstimateGas method")
 //             },
+//             FeeHistoryFunc: func(ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error) {
+// 	               panic("mock out the FeeHistory method")
+//             },
 //             FilterLogsFunc: func(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
 // 	               panic("mock out the FilterLogs method")
 //             },
 //             HeaderByNumberFunc: func(ctx context.Context, number *big.Int) (*types.Header, error) {
 // 	               panic("mock out the HeaderByNumber method")
 //             },
+//             NonceAtFunc: func(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+// 	               panic("mock out the NonceAt method")
+//             },
 //             PendingCodeAtFunc: func(ctx context.Context, account common.Address) ([]byte, error) {
 // 	               panic("mock out the PendingCodeAt method")
 //             },
 //             PendingNonceAtFunc: func(ctx context.Context, account common.Address) (uint64, error) {
 // 	               panic("mock out the PendingNonceAt method")
 //             },
+//             SendRawTransactionFunc: func(ctx context.Context, rawTx []byte) error {
+// 	               panic("mock out the SendRawTransaction method")
+//             },
 //             SendTransactionFunc: func(ctx context.Context, tx *types.Transaction) error {
 // 	               panic("mock out the SendTransaction method")
 //             },
@@ -72,7 +89,7 @@ var _ rpcclient.Interface = &InterfaceMock{}
 //             SuggestGasPriceFunc: func(ctx context.Context) (*big.Int, error) {
 // 	               panic("mock out the SuggestGasPrice method")
 //             },
-//             TransactionByHashFunc: func(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+//             TransactionByHashFunc: func(ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
 // 	               panic("mock out the TransactionByHash method")
 //             },
 //             TransactionReceiptWithBlockNumberFunc: func(ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error) {
@@ -88,6 +105,9 @@ type InterfaceMock struct {
 	// BalanceAtFunc mocks the BalanceAt method.
 	BalanceAtFunc func(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
 
+	// BlockWithTransactionsFunc mocks the BlockWithTransactions method.
+	BlockWithTransactionsFunc func(ctx context.Context, number *big.Int) (*rpcclient.RPCBlock, error)
+
 	// CallContractFunc mocks the CallContract method.
 	CallContractFunc func(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
 
@@ -97,18 +117,27 @@ type InterfaceMock struct {
 	// EstimateGasFunc mocks the EstimateGas method.
 	EstimateGasFunc func(ctx context.Context, call ethereum.CallMsg) (uint64, error)
 
+	// FeeHistoryFunc mocks the FeeHistory method.
+	FeeHistoryFunc func(ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error)
+
 	// FilterLogsFunc mocks the FilterLogs method.
 	FilterLogsFunc func(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error)
 
 	// HeaderByNumberFunc mocks the HeaderByNumber method.
 	HeaderByNumberFunc func(ctx context.Context, number *big.Int) (*types.Header, error)
 
+	// NonceAtFunc mocks the NonceAt method.
+	NonceAtFunc func(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+
 	// PendingCodeAtFunc mocks the PendingCodeAt method.
 	PendingCodeAtFunc func(ctx context.Context, account common.Address) ([]byte, error)
 
 	// PendingNonceAtFunc mocks the PendingNonceAt method.
 	PendingNonceAtFunc func(ctx context.Context, account common.Address) (uint64, error)
 
+	// SendRawTransactionFunc mocks the SendRawTransaction method.
+	SendRawTransactionFunc func(ctx context.Context, rawTx []byte) error
+
 	// SendTransactionFunc mocks the SendTransaction method.
 	SendTransactionFunc func(ctx context.Context, tx *types.Transaction) error
 
@@ -119,7 +148,7 @@ type InterfaceMock struct {
 	SuggestGasPriceFunc func(ctx context.Context) (*big.Int, error)
 
 	// TransactionByHashFunc mocks the TransactionByHash method.
-	TransactionByHashFunc func(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	TransactionByHashFunc func(ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error)
 
 	// TransactionReceiptWithBlockNumberFunc mocks the TransactionReceiptWithBlockNumber method.
 	TransactionReceiptWithBlockNumberFunc func(ctx context.Context, hash common.Hash) (*rpcclient.RPCTransactionReceipt, error)
@@ -135,6 +164,13 @@ type InterfaceMock struct {
 			// BlockNumber is the blockNumber argument value.
 			BlockNumber *big.Int
 		}
+		// BlockWithTransactions holds details about calls to the BlockWithTransactions method.
+		BlockWithTransactions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Number is the number argument value.
+			Number *big.Int
+		}
 		// CallContract holds details about calls to the CallContract method.
 		CallContract []struct {
 			// Ctx is the ctx argument value.
@@ -160,6 +196,15 @@ type InterfaceMock struct {
 			// Call is the call argument value.
 			Call ethereum.CallMsg
 		}
+		// FeeHistory holds details about calls to the FeeHistory method.
+		FeeHistory []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// BlockCount is the blockCount argument value.
+			BlockCount uint64
+			// RewardPercentiles is the rewardPercentiles argument value.
+			RewardPercentiles []float64
+		}
 		// FilterLogs holds details about calls to the FilterLogs method.
 		FilterLogs []struct {
 			// Ctx is the ctx argument value.
@@ -174,6 +219,15 @@ type InterfaceMock struct {
 			// Number is the number argument value.
 			Number *big.Int
 		}
+		// NonceAt holds details about calls to the NonceAt method.
+		NonceAt []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Account is the account argument value.
+			Account common.Address
+			// BlockNumber is the blockNumber argument value.
+			BlockNumber *big.Int
+		}
 		// PendingCodeAt holds details about calls to the PendingCodeAt method.
 		PendingCodeAt []struct {
 			// Ctx is the ctx argument value.
@@ -188,6 +242,13 @@ type InterfaceMock struct {
 			// Account is the account argument value.
 			Account common.Address
 		}
+		// SendRawTransaction holds details about calls to the SendRawTransaction method.
+		SendRawTransaction []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// RawTx is the rawTx argument value.
+			RawTx []byte
+		}
 		// SendTransaction holds details about calls to the SendTransaction method.
 		SendTransaction []struct {
 			// Ctx is the ctx argument value.
@@ -265,6 +326,41 @@ func (mock *InterfaceMock) BalanceAtCalls() []struct {
 	return calls
 }
 
+// BlockWithTransactions calls BlockWithTransactionsFunc.
+func (mock *InterfaceMock) BlockWithTransactions(ctx context.Context, number *big.Int) (*rpcclient.RPCBlock, error) {
+	if mock.BlockWithTransactionsFunc == nil {
+		panic("InterfaceMock.BlockWithTransactionsFunc: method is nil but Interface.BlockWithTransactions was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Number *big.Int
+	}{
+		Ctx:    ctx,
+		Number: number,
+	}
+	lockInterfaceMockBlockWithTransactions.Lock()
+	mock.calls.BlockWithTransactions = append(mock.calls.BlockWithTransactions, callInfo)
+	lockInterfaceMockBlockWithTransactions.Unlock()
+	return mock.BlockWithTransactionsFunc(ctx, number)
+}
+
+// BlockWithTransactionsCalls gets all the calls that were made to BlockWithTransactions.
+// Check the length with:
+//     len(mockedInterface.BlockWithTransactionsCalls())
+func (mock *InterfaceMock) BlockWithTransactionsCalls() []struct {
+	Ctx    context.Context
+	Number *big.Int
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Number *big.Int
+	}
+	lockInterfaceMockBlockWithTransactions.RLock()
+	calls = mock.calls.BlockWithTransactions
+	lockInterfaceMockBlockWithTransactions.RUnlock()
+	return calls
+}
+
 // CallContract calls CallContractFunc.
 func (mock *InterfaceMock) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
 	if mock.CallContractFunc == nil {
@@ -378,6 +474,45 @@ func (mock *InterfaceMock) EstimateGasCalls() []struct {
 	return calls
 }
 
+// FeeHistory calls FeeHistoryFunc.
+func (mock *InterfaceMock) FeeHistory(ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*rpcclient.FeeHistory, error) {
+	if mock.FeeHistoryFunc == nil {
+		panic("InterfaceMock.FeeHistoryFunc: method is nil but Interface.FeeHistory was just called")
+	}
+	callInfo := struct {
+		Ctx               context.Context
+		BlockCount        uint64
+		RewardPercentiles []float64
+	}{
+		Ctx:               ctx,
+		BlockCount:        blockCount,
+		RewardPercentiles: rewardPercentiles,
+	}
+	lockInterfaceMockFeeHistory.Lock()
+	mock.calls.FeeHistory = append(mock.calls.FeeHistory, callInfo)
+	lockInterfaceMockFeeHistory.Unlock()
+	return mock.FeeHistoryFunc(ctx, blockCount, rewardPercentiles)
+}
+
+// FeeHistoryCalls gets all the calls that were made to FeeHistory.
+// Check the length with:
+//     len(mockedInterface.FeeHistoryCalls())
+func (mock *InterfaceMock) FeeHistoryCalls() []struct {
+	Ctx               context.Context
+	BlockCount        uint64
+	RewardPercentiles []float64
+} {
+	var calls []struct {
+		Ctx               context.Context
+		BlockCount        uint64
+		RewardPercentiles []float64
+	}
+	lockInterfaceMockFeeHistory.RLock()
+	calls = mock.calls.FeeHistory
+	lockInterfaceMockFeeHistory.RUnlock()
+	return calls
+}
+
 // FilterLogs calls FilterLogsFunc.
 func (mock *InterfaceMock) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
 	if mock.FilterLogsFunc == nil {
@@ -448,6 +583,45 @@ func (mock *InterfaceMock) HeaderByNumberCalls() []struct {
 	return calls
 }
 
+// NonceAt calls NonceAtFunc.
+func (mock *InterfaceMock) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	if mock.NonceAtFunc == nil {
+		panic("InterfaceMock.NonceAtFunc: method is nil but Interface.NonceAt was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		Account     common.Address
+		BlockNumber *big.Int
+	}{
+		Ctx:         ctx,
+		Account:     account,
+		BlockNumber: blockNumber,
+	}
+	lockInterfaceMockNonceAt.Lock()
+	mock.calls.NonceAt = append(mock.calls.NonceAt, callInfo)
+	lockInterfaceMockNonceAt.Unlock()
+	return mock.NonceAtFunc(ctx, account, blockNumber)
+}
+
+// NonceAtCalls gets all the calls that were made to NonceAt.
+// Check the length with:
+//     len(mockedInterface.NonceAtCalls())
+func (mock *InterfaceMock) NonceAtCalls() []struct {
+	Ctx         context.Context
+	Account     common.Address
+	BlockNumber *big.Int
+} {
+	var calls []struct {
+		Ctx         context.Context
+		Account     common.Address
+		BlockNumber *big.Int
+	}
+	lockInterfaceMockNonceAt.RLock()
+	calls = mock.calls.NonceAt
+	lockInterfaceMockNonceAt.RUnlock()
+	return calls
+}
+
 // PendingCodeAt calls PendingCodeAtFunc.
 func (mock *InterfaceMock) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
 	if mock.PendingCodeAtFunc == nil {
@@ -518,6 +692,41 @@ func (mock *InterfaceMock) PendingNonceAtCalls() []struct {
 	return calls
 }
 
+// SendRawTransaction calls SendRawTransactionFunc.
+func (mock *InterfaceMock) SendRawTransaction(ctx context.Context, rawTx []byte) error {
+	if mock.SendRawTransactionFunc == nil {
+		panic("InterfaceMock.SendRawTransactionFunc: method is nil but Interface.SendRawTransaction was just called")
+	}
+	callInfo := struct {
+		Ctx   context.Context
+		RawTx []byte
+	}{
+		Ctx:   ctx,
+		RawTx: rawTx,
+	}
+	lockInterfaceMockSendRawTransaction.Lock()
+	mock.calls.SendRawTransaction = append(mock.calls.SendRawTransaction, callInfo)
+	lockInterfaceMockSendRawTransaction.Unlock()
+	return mock.SendRawTransactionFunc(ctx, rawTx)
+}
+
+// SendRawTransactionCalls gets all the calls that were made to SendRawTransaction.
+// Check the length with:
+//     len(mockedInterface.SendRawTransactionCalls())
+func (mock *InterfaceMock) SendRawTransactionCalls() []struct {
+	Ctx   context.Context
+	RawTx []byte
+} {
+	var calls []struct {
+		Ctx   context.Context
+		RawTx []byte
+	}
+	lockInterfaceMockSendRawTransaction.RLock()
+	calls = mock.calls.SendRawTransaction
+	lockInterfaceMockSendRawTransaction.RUnlock()
+	return calls
+}
+
 // SendTransaction calls SendTransactionFunc.
 func (mock *InterfaceMock) SendTransaction(ctx context.Context, tx *types.Transaction) error {
 	if mock.SendTransactionFunc == nil {
@@ -624,7 +833,7 @@ func (mock *InterfaceMock) SuggestGasPriceCalls() []struct {
 }
 
 // TransactionByHash calls TransactionByHashFunc.
-func (mock *InterfaceMock) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+func (mock *InterfaceMock) TransactionByHash(ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
 	if mock.TransactionByHashFunc == nil {
 		panic("InterfaceMock.TransactionByHashFunc: method is nil but Interface.TransactionByHash was just called")
 	}
@@ -18,8 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"math/big"
+	"net/http"
 
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -34,8 +37,20 @@ type Interface interface {
 	TransactionReceiptWithBlockNumber(
 		ctx context.Context, hash common.Hash) (*RPCTransactionReceipt, error)
 	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
-	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx ethtypes.Transaction, isPending bool, err error)
 	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	// NonceAt returns the number of transactions sent from the account at the given block, i.e.
+	// the nonce of the next transaction to be mined. If blockNumber is nil, the latest block is
+	// used. Use PendingNonceAt() to include pending transactions.
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	// SendRawTransaction broadcasts a signed transaction encoded with ethtypes.EncodeTransaction().
+	SendRawTransaction(ctx context.Context, rawTx []byte) error
+	// FeeHistory returns the base fees and priority fees at the given percentiles of the latest
+	// blockCount blocks, see `eth_feeHistory` (EIP-1559).
+	FeeHistory(ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*FeeHistory, error)
+	// BlockWithTransactions returns the block with the given number including all transactions.
+	// If number is nil, the latest block is returned.
+	BlockWithTransactions(ctx context.Context, number *big.Int) (*RPCBlock, error)
 	bind.ContractBackend
 }
 
@@ -62,17 +77,110 @@ func RPCDial(url string) (*RPCClient, error) {
 	}, nil
 }
 
+// RPCDialHTTP connects to a backend over HTTP using the given client, e.g. to route the requests
+// through a proxy.
+func RPCDialHTTP(url string, httpClient *http.Client) (*RPCClient, error) {
+	c, err := rpc.DialHTTPWithClient(url, httpClient)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &RPCClient{
+		Client: ethclient.NewClient(c),
+		c:      c,
+	}, nil
+}
+
 // RPCTransactionReceipt is a receipt extended with the block number.
 type RPCTransactionReceipt struct {
 	types.Receipt
 	BlockNumber uint64
+	// EffectiveGasPrice is the price per gas paid by the transaction. Can be nil if the node does
+	// not provide it (pre EIP-1559 nodes).
+	EffectiveGasPrice *big.Int
 }
 
 // RPCTransaction is a transaction extended with additional fields populated by the
 // `eth_getTransactionByHash api` call.
 type RPCTransaction struct {
-	types.Transaction
-	BlockNumber *string `json:"blockNumber,omitempty"`
+	Transaction ethtypes.Transaction
+	BlockNumber *string
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (rpcTx *RPCTransaction) UnmarshalJSON(msg []byte) error {
+	tx, err := ethtypes.DecodeTransactionJSON(msg)
+	if err != nil {
+		return err
+	}
+	bn := struct {
+		BlockNumber *string `json:"blockNumber"`
+	}{}
+	if err := json.Unmarshal(msg, &bn); err != nil {
+		return err
+	}
+	rpcTx.Transaction = tx
+	rpcTx.BlockNumber = bn.BlockNumber
+	return nil
+}
+
+// RPCBlock is a block as returned by the `eth_getBlockByNumber` call with full transactions, reduced
+// to the fields needed to find the transactions of an address.
+type RPCBlock struct {
+	Number       hexutil.Uint64         `json:"number"`
+	Timestamp    hexutil.Uint64         `json:"timestamp"`
+	Transactions []*RPCBlockTransaction `json:"transactions"`
+}
+
+// RPCBlockTransaction is a transaction contained in an RPCBlock.
+type RPCBlockTransaction struct {
+	Hash common.Hash    `json:"hash"`
+	From common.Address `json:"from"`
+	// To is nil for contract creations.
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Nonce hexutil.Uint64  `json:"nonce"`
+	// GasPrice is the price per gas paid. For EIP-1559 transactions, nodes return the effective gas
+	// price.
+	GasPrice *hexutil.Big `json:"gasPrice"`
+}
+
+// FeeHistory is the result of the `eth_feeHistory` call.
+type FeeHistory struct {
+	OldestBlock *big.Int
+	// BaseFee contains the base fee per gas of each block, plus the base fee of the next block as
+	// the last element. The base fee is zero for blocks before EIP-1559 activation.
+	BaseFee      []*big.Int
+	GasUsedRatio []float64
+	// Reward contains one entry per block, each holding the priority fees per gas at the requested
+	// percentiles.
+	Reward [][]*big.Int
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (feeHistory *FeeHistory) UnmarshalJSON(msg []byte) error {
+	var dec struct {
+		OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+		BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+		GasUsedRatio []float64        `json:"gasUsedRatio"`
+		Reward       [][]*hexutil.Big `json:"reward"`
+	}
+	if err := json.Unmarshal(msg, &dec); err != nil {
+		return err
+	}
+	feeHistory.OldestBlock = (*big.Int)(dec.OldestBlock)
+	feeHistory.BaseFee = make([]*big.Int, len(dec.BaseFee))
+	for i, baseFee := range dec.BaseFee {
+		feeHistory.BaseFee[i] = (*big.Int)(baseFee)
+	}
+	feeHistory.GasUsedRatio = dec.GasUsedRatio
+	feeHistory.Reward = make([][]*big.Int, len(dec.Reward))
+	for i, rewards := range dec.Reward {
+		feeHistory.Reward[i] = make([]*big.Int, len(rewards))
+		for j, reward := range rewards {
+			feeHistory.Reward[i][j] = (*big.Int)(reward)
+		}
+	}
+	return nil
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
@@ -81,12 +189,14 @@ func (rpcTR *RPCTransactionReceipt) UnmarshalJSON(msg []byte) error {
 		return err
 	}
 	bn := struct {
-		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+		BlockNumber       hexutil.Uint64 `json:"blockNumber"`
+		EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
 	}{}
 	if err := json.Unmarshal(msg, &bn); err != nil {
 		return err
 	}
 	rpcTR.BlockNumber = uint64(bn.BlockNumber)
+	rpcTR.EffectiveGasPrice = (*big.Int)(bn.EffectiveGasPrice)
 	return nil
 }
 
@@ -98,3 +208,56 @@ func (rpc *RPCClient) TransactionReceiptWithBlockNumber(
 	err := rpc.c.CallContext(ctx, &r, "eth_getTransactionReceipt", hash)
 	return r, err
 }
+
+// TransactionByHash implements Interface. It overrides ethclient.Client.TransactionByHash, which
+// does not support EIP-1559 transactions.
+func (rpc *RPCClient) TransactionByHash(
+	ctx context.Context, hash common.Hash) (ethtypes.Transaction, bool, error) {
+	var result *RPCTransaction
+	if err := rpc.c.CallContext(ctx, &result, "eth_getTransactionByHash", hash); err != nil {
+		return nil, false, errp.WithStack(err)
+	}
+	if result == nil {
+		return nil, false, errp.WithStack(ethereum.NotFound)
+	}
+	return result.Transaction, result.BlockNumber == nil, nil
+}
+
+// SendRawTransaction implements Interface.
+func (rpc *RPCClient) SendRawTransaction(ctx context.Context, rawTx []byte) error {
+	return rpc.c.CallContext(ctx, nil, "eth_sendRawTransaction", hexutil.Encode(rawTx))
+}
+
+// FeeHistory implements Interface.
+func (rpc *RPCClient) FeeHistory(
+	ctx context.Context, blockCount uint64, rewardPercentiles []float64) (*FeeHistory, error) {
+	var result *FeeHistory
+	err := rpc.c.CallContext(
+		ctx, &result, "eth_feeHistory", hexutil.Uint64(blockCount), "latest", rewardPercentiles)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if result == nil {
+		return nil, errp.New("empty fee history")
+	}
+	return result, nil
+}
+
+// BlockWithTransactions implements Interface.
+func (rpc *RPCClient) BlockWithTransactions(ctx context.Context, number *big.Int) (*RPCBlock, error) {
+	var result *RPCBlock
+	if err := rpc.c.CallContext(ctx, &result, "eth_getBlockByNumber", toBlockNumArg(number), true); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if result == nil {
+		return nil, errp.WithStack(ethereum.NotFound)
+	}
+	return result, nil
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
@@ -0,0 +1,346 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DynamicFeeTxType is the EIP-2718 transaction type of EIP-1559 transactions.
+const DynamicFeeTxType = 0x02
+
+// Transaction is implemented by legacy transactions (*types.Transaction of go-ethereum) and by
+// EIP-1559 transactions (*DynamicFeeTx). The go-ethereum version we depend on does not support
+// typed transactions yet.
+type Transaction interface {
+	Hash() common.Hash
+	Nonce() uint64
+	Gas() uint64
+	// GasPrice is the gas price of legacy transactions and the max fee per gas of EIP-1559
+	// transactions, i.e. the highest price per gas the transaction can pay.
+	GasPrice() *big.Int
+	To() *common.Address
+	Value() *big.Int
+	Data() []byte
+}
+
+var _ Transaction = &types.Transaction{}
+var _ Transaction = &DynamicFeeTx{}
+
+// accessTuple is an entry of an EIP-2930 access list. We never create access lists, but they are
+// part of the transaction encoding.
+type accessTuple struct {
+	Address     common.Address
+	StorageKeys []common.Hash
+}
+
+// dynamicFeeTxData is the RLP payload of a dynamic fee transaction.
+type dynamicFeeTxData struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         *common.Address `rlp:"nil"`
+	Value      *big.Int
+	Data       []byte
+	AccessList []accessTuple
+
+	// Signature values. V is the y-parity of the signature, 0 or 1.
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+// DynamicFeeTx is an EIP-1559 transaction, paying a base fee that is burned plus a priority fee
+// (tip) to the miner, instead of a single gas price.
+type DynamicFeeTx struct {
+	data dynamicFeeTxData
+}
+
+// NewDynamicFeeTx creates a new unsigned EIP-1559 transaction. gasTipCap is the max priority fee
+// per gas and gasFeeCap the max fee per gas, in Wei.
+func NewDynamicFeeTx(
+	chainID *big.Int,
+	nonce uint64,
+	to common.Address,
+	value *big.Int,
+	gas uint64,
+	gasTipCap *big.Int,
+	gasFeeCap *big.Int,
+	data []byte,
+) *DynamicFeeTx {
+	return &DynamicFeeTx{data: dynamicFeeTxData{
+		ChainID:    new(big.Int).Set(chainID),
+		Nonce:      nonce,
+		GasTipCap:  new(big.Int).Set(gasTipCap),
+		GasFeeCap:  new(big.Int).Set(gasFeeCap),
+		Gas:        gas,
+		To:         &to,
+		Value:      new(big.Int).Set(value),
+		Data:       common.CopyBytes(data),
+		AccessList: []accessTuple{},
+		V:          new(big.Int),
+		R:          new(big.Int),
+		S:          new(big.Int),
+	}}
+}
+
+// ChainID returns the chain ID the transaction is valid for.
+func (tx *DynamicFeeTx) ChainID() *big.Int { return new(big.Int).Set(tx.data.ChainID) }
+
+// Nonce implements Transaction.
+func (tx *DynamicFeeTx) Nonce() uint64 { return tx.data.Nonce }
+
+// Gas implements Transaction.
+func (tx *DynamicFeeTx) Gas() uint64 { return tx.data.Gas }
+
+// GasPrice implements Transaction. It returns the max fee per gas.
+func (tx *DynamicFeeTx) GasPrice() *big.Int { return tx.GasFeeCap() }
+
+// GasTipCap returns the max priority fee per gas.
+func (tx *DynamicFeeTx) GasTipCap() *big.Int { return new(big.Int).Set(tx.data.GasTipCap) }
+
+// GasFeeCap returns the max fee per gas.
+func (tx *DynamicFeeTx) GasFeeCap() *big.Int { return new(big.Int).Set(tx.data.GasFeeCap) }
+
+// To implements Transaction.
+func (tx *DynamicFeeTx) To() *common.Address {
+	if tx.data.To == nil {
+		return nil
+	}
+	to := *tx.data.To
+	return &to
+}
+
+// Value implements Transaction.
+func (tx *DynamicFeeTx) Value() *big.Int { return new(big.Int).Set(tx.data.Value) }
+
+// Data implements Transaction.
+func (tx *DynamicFeeTx) Data() []byte { return common.CopyBytes(tx.data.Data) }
+
+// EffectiveGasPrice returns the price per gas paid if the transaction is included in a block with
+// the given base fee: min(max fee, base fee + max priority fee).
+func (tx *DynamicFeeTx) EffectiveGasPrice(baseFee *big.Int) *big.Int {
+	price := new(big.Int).Add(baseFee, tx.data.GasTipCap)
+	if price.Cmp(tx.data.GasFeeCap) > 0 {
+		return tx.GasFeeCap()
+	}
+	return price
+}
+
+func (tx *DynamicFeeTx) encode(withSignature bool) ([]byte, error) {
+	var payload interface{} = &tx.data
+	if !withSignature {
+		payload = []interface{}{
+			tx.data.ChainID,
+			tx.data.Nonce,
+			tx.data.GasTipCap,
+			tx.data.GasFeeCap,
+			tx.data.Gas,
+			tx.data.To,
+			tx.data.Value,
+			tx.data.Data,
+			tx.data.AccessList,
+		}
+	}
+	encoded, err := rlp.EncodeToBytes(payload)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return append([]byte{DynamicFeeTxType}, encoded...), nil
+}
+
+// SigningHash returns the hash to be signed by the sender: keccak256(0x02 || rlp([chainID, nonce,
+// maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList])).
+func (tx *DynamicFeeTx) SigningHash() common.Hash {
+	encoded, err := tx.encode(false)
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(encoded)
+}
+
+// WithSignature returns a copy of the transaction with the given 65 byte signature (R, S, and the
+// recovery ID as the last byte).
+func (tx *DynamicFeeTx) WithSignature(sig []byte) (*DynamicFeeTx, error) {
+	if len(sig) != crypto.SignatureLength {
+		return nil, errp.Newf("wrong size for signature: got %d, want %d", len(sig), crypto.SignatureLength)
+	}
+	if sig[64] > 1 {
+		return nil, errp.Newf("invalid recovery ID %d", sig[64])
+	}
+	cpy := &DynamicFeeTx{data: tx.data}
+	cpy.data.R = new(big.Int).SetBytes(sig[:32])
+	cpy.data.S = new(big.Int).SetBytes(sig[32:64])
+	cpy.data.V = big.NewInt(int64(sig[64]))
+	return cpy, nil
+}
+
+// Sender recovers the address that signed the transaction.
+func (tx *DynamicFeeTx) Sender() (common.Address, error) {
+	if tx.data.V.BitLen() > 1 {
+		return common.Address{}, errp.New("invalid signature")
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig[32-len(tx.data.R.Bytes()):32], tx.data.R.Bytes())
+	copy(sig[64-len(tx.data.S.Bytes()):64], tx.data.S.Bytes())
+	sig[64] = byte(tx.data.V.Uint64())
+	publicKey, err := crypto.SigToPub(tx.SigningHash().Bytes(), sig)
+	if err != nil {
+		return common.Address{}, errp.WithStack(err)
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// MarshalBinary returns the EIP-2718 encoding of the signed transaction: 0x02 || rlp(payload).
+func (tx *DynamicFeeTx) MarshalBinary() ([]byte, error) {
+	return tx.encode(true)
+}
+
+// UnmarshalBinary decodes an EIP-2718 encoded dynamic fee transaction.
+func (tx *DynamicFeeTx) UnmarshalBinary(encoded []byte) error {
+	if len(encoded) == 0 || encoded[0] != DynamicFeeTxType {
+		return errp.New("not a dynamic fee transaction")
+	}
+	var data dynamicFeeTxData
+	if err := rlp.DecodeBytes(encoded[1:], &data); err != nil {
+		return errp.WithStack(err)
+	}
+	tx.data = data
+	return nil
+}
+
+// Hash implements Transaction. It is the transaction ID, the hash of the EIP-2718 encoding.
+func (tx *DynamicFeeTx) Hash() common.Hash {
+	encoded, err := tx.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(encoded)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It decodes a transaction as returned by the
+// `eth_getTransactionByHash` RPC call.
+func (tx *DynamicFeeTx) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Type                 hexutil.Uint64  `json:"type"`
+		ChainID              *hexutil.Big    `json:"chainId"`
+		Nonce                hexutil.Uint64  `json:"nonce"`
+		MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+		MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+		Gas                  hexutil.Uint64  `json:"gas"`
+		To                   *common.Address `json:"to"`
+		Value                *hexutil.Big    `json:"value"`
+		Input                hexutil.Bytes   `json:"input"`
+		V                    *hexutil.Big    `json:"v"`
+		R                    *hexutil.Big    `json:"r"`
+		S                    *hexutil.Big    `json:"s"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return errp.WithStack(err)
+	}
+	if dec.Type != DynamicFeeTxType {
+		return errp.Newf("unexpected transaction type %d", dec.Type)
+	}
+	if dec.ChainID == nil || dec.MaxPriorityFeePerGas == nil || dec.MaxFeePerGas == nil ||
+		dec.Value == nil || dec.V == nil || dec.R == nil || dec.S == nil {
+		return errp.New("missing required field in dynamic fee transaction")
+	}
+	tx.data = dynamicFeeTxData{
+		ChainID:    (*big.Int)(dec.ChainID),
+		Nonce:      uint64(dec.Nonce),
+		GasTipCap:  (*big.Int)(dec.MaxPriorityFeePerGas),
+		GasFeeCap:  (*big.Int)(dec.MaxFeePerGas),
+		Gas:        uint64(dec.Gas),
+		To:         dec.To,
+		Value:      (*big.Int)(dec.Value),
+		Data:       dec.Input,
+		AccessList: []accessTuple{},
+		V:          (*big.Int)(dec.V),
+		R:          (*big.Int)(dec.R),
+		S:          (*big.Int)(dec.S),
+	}
+	return nil
+}
+
+// EncodeTransaction returns the network encoding of a signed transaction, as used by
+// `eth_sendRawTransaction`.
+func EncodeTransaction(tx Transaction) ([]byte, error) {
+	switch tx := tx.(type) {
+	case *types.Transaction:
+		encoded, err := rlp.EncodeToBytes(tx)
+		return encoded, errp.WithStack(err)
+	case *DynamicFeeTx:
+		return tx.MarshalBinary()
+	default:
+		return nil, errp.New("unknown transaction type")
+	}
+}
+
+// DecodeTransaction decodes a transaction encoded with EncodeTransaction(). Legacy transactions
+// start with an RLP list prefix (>= 0xc0), typed transactions with the type byte (EIP-2718).
+func DecodeTransaction(encoded []byte) (Transaction, error) {
+	if len(encoded) == 0 {
+		return nil, errp.New("empty transaction")
+	}
+	if encoded[0] >= 0xc0 {
+		tx := new(types.Transaction)
+		if err := rlp.Decode(bytes.NewReader(encoded), tx); err != nil {
+			return nil, errp.WithStack(err)
+		}
+		return tx, nil
+	}
+	tx := new(DynamicFeeTx)
+	if err := tx.UnmarshalBinary(encoded); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// DecodeTransactionJSON decodes a transaction as returned by `eth_getTransactionByHash`, either a
+// legacy or a dynamic fee transaction.
+func DecodeTransactionJSON(input []byte) (Transaction, error) {
+	var txType struct {
+		Type *hexutil.Uint64 `json:"type"`
+	}
+	if err := json.Unmarshal(input, &txType); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if txType.Type != nil && *txType.Type == DynamicFeeTxType {
+		tx := new(DynamicFeeTx)
+		if err := json.Unmarshal(input, tx); err != nil {
+			return nil, err
+		}
+		return tx, nil
+	}
+	if txType.Type != nil && *txType.Type != 0 {
+		return nil, errp.Newf("unsupported transaction type %d", *txType.Type)
+	}
+	tx := new(types.Transaction)
+	if err := json.Unmarshal(input, tx); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return tx, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	ethtypes "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func newDynamicFeeTx() *ethtypes.DynamicFeeTx {
+	return ethtypes.NewDynamicFeeTx(
+		big.NewInt(3),
+		7,
+		common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e"),
+		big.NewInt(1e18),
+		21000,
+		big.NewInt(2e9),
+		big.NewInt(100e9),
+		nil,
+	)
+}
+
+func TestDynamicFeeTxSign(t *testing.T) {
+	privateKey, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	require.NoError(t, err)
+
+	tx := newDynamicFeeTx()
+	sig, err := crypto.Sign(tx.SigningHash().Bytes(), privateKey)
+	require.NoError(t, err)
+	signedTx, err := tx.WithSignature(sig)
+	require.NoError(t, err)
+	// The sighash does not depend on the signature.
+	require.Equal(t, tx.SigningHash(), signedTx.SigningHash())
+	require.NotEqual(t, tx.Hash(), signedTx.Hash())
+
+	sender, err := signedTx.Sender()
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(privateKey.PublicKey), sender)
+
+	_, err = tx.WithSignature(sig[:64])
+	require.Error(t, err)
+}
+
+// TestDynamicFeeTxVector checks a signed transaction against a vector which was verified with an
+// independent implementation of EIP-1559. The key is the example key of the web3.js documentation.
+func TestDynamicFeeTxVector(t *testing.T) {
+	const rawTx = "02f8730307847735940085174876e80082520894a29163852021bf4c139d03dff59ae763ac73e84e880de0" +
+		"b6b3a764000080c001a01417fd8c48387b7ac36630ac9986d03cdb350d138c491588975a7092c633ed80a00a0854" +
+		"24db21d8b3d432dc4a901e3c1ba258563492f943c2a91a86a935fe1303"
+	encoded, err := hex.DecodeString(rawTx)
+	require.NoError(t, err)
+
+	decoded, err := ethtypes.DecodeTransaction(encoded)
+	require.NoError(t, err)
+	tx, ok := decoded.(*ethtypes.DynamicFeeTx)
+	require.True(t, ok)
+	require.Equal(t,
+		common.HexToHash("0xe0bea8b512a5a4474879b7331fc1d88f3b9308f8395391886d6ed29d1b42046b"),
+		tx.SigningHash())
+	require.Equal(t,
+		common.HexToHash("0x0cb1590d112a0234b6becbb5a5c6839f058cf801bedf51aff395cab50dd47f6e"),
+		tx.Hash())
+	sender, err := tx.Sender()
+	require.NoError(t, err)
+	require.Equal(t, common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"), sender)
+
+	// Signing is deterministic (RFC 6979), so signing the same transaction yields the same bytes.
+	privateKey, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	require.NoError(t, err)
+	unsignedTx := newDynamicFeeTx()
+	sig, err := crypto.Sign(unsignedTx.SigningHash().Bytes(), privateKey)
+	require.NoError(t, err)
+	signedTx, err := unsignedTx.WithSignature(sig)
+	require.NoError(t, err)
+	reencoded, err := ethtypes.EncodeTransaction(signedTx)
+	require.NoError(t, err)
+	require.Equal(t, rawTx, hex.EncodeToString(reencoded))
+}
+
+func TestDynamicFeeTxEncoding(t *testing.T) {
+	tx := newDynamicFeeTx()
+	encoded, err := ethtypes.EncodeTransaction(tx)
+	require.NoError(t, err)
+	require.Equal(t, byte(ethtypes.DynamicFeeTxType), encoded[0])
+
+	// rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList,
+	// yParity, r, s])
+	var fields []rlp.RawValue
+	require.NoError(t, rlp.DecodeBytes(encoded[1:], &fields))
+	require.Len(t, fields, 12)
+	var gasFeeCap big.Int
+	require.NoError(t, rlp.DecodeBytes(fields[3], &gasFeeCap))
+	require.Equal(t, big.NewInt(100e9), &gasFeeCap)
+
+	decoded, err := ethtypes.DecodeTransaction(encoded)
+	require.NoError(t, err)
+	decodedTx, ok := decoded.(*ethtypes.DynamicFeeTx)
+	require.True(t, ok)
+	require.Equal(t, tx.Hash(), decodedTx.Hash())
+	require.Equal(t, tx.Nonce(), decodedTx.Nonce())
+	require.Equal(t, tx.GasTipCap(), decodedTx.GasTipCap())
+	require.Equal(t, tx.GasFeeCap(), decodedTx.GasFeeCap())
+	require.Equal(t, tx.To(), decodedTx.To())
+	require.Equal(t, tx.Value(), decodedTx.Value())
+
+	legacyTx := types.NewTransaction(
+		1, common.HexToAddress("0xa29163852021BF4C139D03Dff59ae763AC73e84e"),
+		big.NewInt(1), 21000, big.NewInt(1e9), nil)
+	encoded, err = ethtypes.EncodeTransaction(legacyTx)
+	require.NoError(t, err)
+	decoded, err = ethtypes.DecodeTransaction(encoded)
+	require.NoError(t, err)
+	_, ok = decoded.(*types.Transaction)
+	require.True(t, ok)
+	require.Equal(t, legacyTx.Hash(), decoded.Hash())
+
+	_, err = ethtypes.DecodeTransaction(nil)
+	require.Error(t, err)
+}
+
+func TestDynamicFeeTxEffectiveGasPrice(t *testing.T) {
+	tx := newDynamicFeeTx()
+	// base fee + tip.
+	require.Equal(t, big.NewInt(32e9), tx.EffectiveGasPrice(big.NewInt(30e9)))
+	// capped by the max fee.
+	require.Equal(t, big.NewInt(100e9), tx.EffectiveGasPrice(big.NewInt(99e9)))
+}
+
+func TestDecodeTransactionJSON(t *testing.T) {
+	tx, err := ethtypes.DecodeTransactionJSON([]byte(`{
+  "type": "0x2",
+  "chainId": "0x3",
+  "nonce": "0x7",
+  "maxPriorityFeePerGas": "0x77359400",
+  "maxFeePerGas": "0x174876e800",
+  "gas": "0x5208",
+  "to": "0xa29163852021bf4c139d03dff59ae763ac73e84e",
+  "value": "0xde0b6b3a7640000",
+  "input": "0x",
+  "v": "0x0",
+  "r": "0x0",
+  "s": "0x0",
+  "blockNumber": null
+}`))
+	require.NoError(t, err)
+	require.Equal(t, newDynamicFeeTx().Hash(), tx.Hash())
+
+	_, err = ethtypes.DecodeTransactionJSON([]byte(`{"type": "0x1"}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// IndexedTransaction is a confirmed transaction of an address, found by scanning the blocks (ETH)
+// or the Transfer event logs (ERC20) of an Ethereum node.
+type IndexedTransaction struct {
+	Hash        common.Hash `json:"hash"`
+	BlockNumber uint64      `json:"blockNumber"`
+	// Timestamp is the unix timestamp of the block.
+	Timestamp uint64         `json:"timestamp"`
+	From      common.Address `json:"from"`
+	// To is the recipient. For ERC20 transfers, this is the token recipient, not the contract.
+	To common.Address `json:"to"`
+	// Value is the amount transferred. For ERC20 transfers, this is the token amount.
+	Value *big.Int `json:"value"`
+	// Nonce is only set for ETH transactions.
+	Nonce *uint64 `json:"nonce,omitempty"`
+	// GasUsed and Fee are only set for transactions sent from the indexed address.
+	GasUsed uint64   `json:"gasUsed"`
+	Fee     *big.Int `json:"fee,omitempty"`
+	Failed  bool     `json:"failed"`
+}
+
+// TransactionData returns the tx data to be shown to the user. `address` is the indexed address
+// the transaction belongs to.
+func (tx *IndexedTransaction) TransactionData(
+	tipHeight uint64, address common.Address, isERC20 bool) *accounts.TransactionData {
+	var txType accounts.TxType
+	switch {
+	case tx.From == address && tx.To == address:
+		txType = accounts.TxTypeSendSelf
+	case tx.From == address:
+		txType = accounts.TxTypeSend
+	default:
+		txType = accounts.TxTypeReceive
+	}
+	var fee *coin.Amount
+	if tx.Fee != nil {
+		amount := coin.NewAmount(tx.Fee)
+		fee = &amount
+	}
+	numConfirmations := 0
+	if tipHeight >= tx.BlockNumber {
+		numConfirmations = int(tipHeight - tx.BlockNumber + 1)
+	}
+	status := accounts.TxStatusPending
+	switch {
+	case tx.Failed:
+		status = accounts.TxStatusFailed
+	case numConfirmations >= NumConfirmationsComplete:
+		status = accounts.TxStatusComplete
+	}
+	timestamp := time.Unix(int64(tx.Timestamp), 0)
+	amount := coin.NewAmount(tx.Value)
+	return &accounts.TransactionData{
+		Fee:                      fee,
+		FeeIsDifferentUnit:       isERC20,
+		Timestamp:                &timestamp,
+		TxID:                     tx.Hash.Hex(),
+		InternalID:               tx.Hash.Hex(),
+		Height:                   int(tx.BlockNumber),
+		NumConfirmations:         numConfirmations,
+		NumConfirmationsComplete: NumConfirmationsComplete,
+		Status:                   status,
+		Type:                     txType,
+		Amount:                   amount,
+		Addresses: []accounts.AddressAndAmount{{
+			Address: tx.To.Hex(),
+			Amount:  amount,
+		}},
+		Gas:   tx.GasUsed,
+		Nonce: tx.Nonce,
+	}
+}
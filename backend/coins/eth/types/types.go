@@ -24,8 +24,6 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // NumConfirmationsComplete indicates after how many confs the tx is considered complete.
@@ -33,21 +31,29 @@ const NumConfirmationsComplete = 12
 
 // TransactionWithMetadata wraps an outgoing transaction and implements accounts.Transaction.
 type TransactionWithMetadata struct {
-	Transaction *types.Transaction
+	// Transaction is either a legacy or an EIP-1559 transaction.
+	Transaction Transaction
 	// Height is 0 for pending tx.
 	Height uint64
 	// Only applies if Height > 0
 	GasUsed uint64
+	// Only applies if Height > 0. The price per gas actually paid. For EIP-1559 transactions, this
+	// depends on the base fee of the block the tx was included in. Can be nil if unknown.
+	EffectiveGasPrice *big.Int
 	// Only applies if Height > 0.
 	// false if contract execution failed, otherwise true.
 	Success bool
 	// Number of broadcast attempts.
 	BroadcastAttempts uint16
+	// ReplacedBy is the hash of the transaction replacing this one (same nonce, e.g. a speed up or
+	// a cancellation). nil if the transaction was not replaced. Replaced transactions are not shown
+	// in the transaction history.
+	ReplacedBy *common.Hash
 }
 
 // MarshalJSON implements json.Marshaler. Used for DB serialization.
 func (txh *TransactionWithMetadata) MarshalJSON() ([]byte, error) {
-	txSerialized, err := rlp.EncodeToBytes(txh.Transaction)
+	txSerialized, err := EncodeTransaction(txh.Transaction)
 	if err != nil {
 		return nil, err
 	}
@@ -55,8 +61,10 @@ func (txh *TransactionWithMetadata) MarshalJSON() ([]byte, error) {
 		"tx":                txSerialized,
 		"height":            txh.Height,
 		"gasUsed":           hexutil.Uint64(txh.GasUsed),
+		"effectiveGasPrice": (*hexutil.Big)(txh.EffectiveGasPrice),
 		"success":           txh.Success,
 		"broadcastAttempts": txh.BroadcastAttempts,
+		"replacedBy":        txh.ReplacedBy,
 	})
 }
 
@@ -66,36 +74,39 @@ func (txh *TransactionWithMetadata) UnmarshalJSON(input []byte) error {
 		TransactionRLP    []byte         `json:"tx"`
 		Height            uint64         `json:"height"`
 		GasUsed           hexutil.Uint64 `json:"gasUsed"`
+		EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
 		Success           bool           `json:"success"`
 		BroadcastAttempts uint16         `json:"broadcastAttempts"`
+		ReplacedBy        *common.Hash   `json:"replacedBy"`
 	}{}
 	if err := json.Unmarshal(input, &m); err != nil {
 		return err
 	}
-	txh.Transaction = new(types.Transaction)
-	if err := rlp.DecodeBytes(m.TransactionRLP, txh.Transaction); err != nil {
+	tx, err := DecodeTransaction(m.TransactionRLP)
+	if err != nil {
 		return err
 	}
+	txh.Transaction = tx
 	txh.Height = m.Height
 	txh.GasUsed = uint64(m.GasUsed)
+	txh.EffectiveGasPrice = (*big.Int)(m.EffectiveGasPrice)
 	txh.Success = m.Success
 	txh.BroadcastAttempts = m.BroadcastAttempts
+	txh.ReplacedBy = m.ReplacedBy
 	return nil
 }
 
 // TransactionData returns the tx data to be shown to the user.
 func (txh *TransactionWithMetadata) TransactionData(
 	tipHeight uint64, erc20Token *erc20.Token) *accounts.TransactionData {
-	data := txh.Transaction.Data()
-	if erc20Token == nil && len(data) > 0 {
-		panic("invalid config")
-	}
-
+	// Contract calls of ETH accounts, e.g. requested by dapps, are shown as a payment of the tx
+	// value to the contract.
 	amount := coin.NewAmount(txh.Transaction.Value())
 	address := txh.Transaction.To().Hex()
 
 	if erc20Token != nil {
 		// ERC20 transfer.
+		data := txh.Transaction.Data()
 
 		// An ERC20-Token transfer looks like this:
 		// - Data is <0xa9059cbb><32 bytes address><32 bytes big endian amount>
@@ -106,7 +117,6 @@ func (txh *TransactionWithMetadata) TransactionData(
 			txh.Transaction.Value().Cmp(big.NewInt(0)) != 0 {
 			panic("invalid erc20 tx")
 		}
-		data := txh.Transaction.Data()
 		amount = coin.NewAmount(new(big.Int).SetBytes(data[len(data)-32:]))
 		address = common.BytesToAddress(data[4+32-common.AddressLength : 4+32]).Hex()
 	}
@@ -135,8 +145,14 @@ func (txh *TransactionWithMetadata) TransactionData(
 	}
 }
 
+// fee returns the fee paid by a confirmed transaction, or the maximum fee a pending transaction can
+// pay.
 func (txh *TransactionWithMetadata) fee() *coin.Amount {
-	fee := new(big.Int).Mul(big.NewInt(int64(txh.Transaction.Gas())), txh.Transaction.GasPrice())
+	gasPrice := txh.Transaction.GasPrice()
+	if txh.Height > 0 && txh.EffectiveGasPrice != nil {
+		gasPrice = txh.EffectiveGasPrice
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(txh.gas()), gasPrice)
 	amount := coin.NewAmount(fee)
 	return &amount
 }
@@ -35,3 +35,45 @@ func TestTransactionWithHeightJSON(t *testing.T) {
 	require.Equal(t, tx.Transaction.Hash(), tx2.Transaction.Hash())
 	require.Equal(t, tx.BroadcastAttempts, tx2.BroadcastAttempts)
 }
+
+func TestTransactionWithMetadataDynamicFee(t *testing.T) {
+	tx := &ethtypes.TransactionWithMetadata{
+		Transaction: ethtypes.NewDynamicFeeTx(
+			big.NewInt(1),
+			123,
+			common.BytesToAddress([]byte("12345678901234567890")),
+			big.NewInt(123456),
+			45678,
+			big.NewInt(2e9),
+			big.NewInt(100e9),
+			nil,
+		),
+		Height:            352,
+		GasUsed:           21000,
+		EffectiveGasPrice: big.NewInt(32e9),
+		Success:           true,
+	}
+	tx2 := new(ethtypes.TransactionWithMetadata)
+	require.NoError(t, json.Unmarshal(jsonp.MustMarshal(tx), tx2))
+	require.Equal(t, tx.Transaction.Hash(), tx2.Transaction.Hash())
+	require.Equal(t, tx.EffectiveGasPrice, tx2.EffectiveGasPrice)
+
+	// The fee of a confirmed tx is the gas used times the effective gas price.
+	require.Equal(t, "672000000000000", tx2.TransactionData(400, nil).Fee.BigInt().String())
+
+	// The fee of a pending tx is the maximum fee.
+	tx2.Height = 0
+	require.Equal(t, "4567800000000000", tx2.TransactionData(400, nil).Fee.BigInt().String())
+}
+
+func TestTransactionDataContractCall(t *testing.T) {
+	contractAddress := common.BytesToAddress([]byte("12345678901234567890"))
+	tx := &ethtypes.TransactionWithMetadata{
+		Transaction: types.NewTransaction(
+			123, contractAddress, big.NewInt(123456), 45678, big.NewInt(123456543), []byte("contract data")),
+	}
+	// Shown as a payment of the value to the contract.
+	txData := tx.TransactionData(400, nil)
+	require.Equal(t, "123456", txData.Amount.BigInt().String())
+	require.Equal(t, contractAddress.Hex(), txData.Addresses[0].Address)
+}
@@ -35,6 +35,12 @@ type Account struct {
 	// only applies to ETH, and the elements are ERC20 token codes (e.g. "eth-erc20-usdt",
 	// "eth-erc20-bat", etc).
 	ActiveTokens []string `json:"activeTokens,omitempty"`
+	// CustomTokens lists the ERC20 tokens added by the user by contract address. Currently, this
+	// only applies to ETH. They are loaded if their code is in ActiveTokens.
+	CustomTokens []CustomToken `json:"customTokens,omitempty"`
+	// WatchOnly is true if the account was added from an extended public key supplied by the user
+	// instead of a keystore. Watch-only accounts are loaded even if no keystore is connected.
+	WatchOnly bool `json:"watchOnly,omitempty"`
 }
 
 // SetTokenActive activates/deactivates an token on an account. `tokenCode` must be an ERC20 token
@@ -56,6 +62,43 @@ func (acct *Account) SetTokenActive(tokenCode string, active bool) error {
 	return nil
 }
 
+// CustomToken is an ERC20 token added by the user. The metadata is fetched from the token contract
+// when the token is added.
+type CustomToken struct {
+	// Code is the token code, e.g. "eth-erc20-0x2260fac5e5542a773aa44fbcfedf7c193bc2c599".
+	Code            string `json:"code"`
+	ContractAddress string `json:"contractAddress"`
+	Name            string `json:"name"`
+	Symbol          string `json:"symbol"`
+	Decimals        uint   `json:"decimals"`
+}
+
+// AddCustomToken adds a user-defined ERC20 token to the account and activates it. If a token with
+// the same code was already added, it is replaced.
+func (acct *Account) AddCustomToken(token CustomToken) error {
+	if acct.CoinCode != coin.CodeETH {
+		return errp.New("tokens are only enabled for ETH")
+	}
+	customTokens := []CustomToken{}
+	for _, customToken := range acct.CustomTokens {
+		if customToken.Code != token.Code {
+			customTokens = append(customTokens, customToken)
+		}
+	}
+	acct.CustomTokens = append(customTokens, token)
+	return acct.SetTokenActive(token.Code, true)
+}
+
+// CustomToken returns the user-defined ERC20 token with the given code, or nil if there is none.
+func (acct *Account) CustomToken(tokenCode string) *CustomToken {
+	for i := range acct.CustomTokens {
+		if acct.CustomTokens[i].Code == tokenCode {
+			return &acct.CustomTokens[i]
+		}
+	}
+	return nil
+}
+
 // AccountsConfig persists the list of accounts added to the app.
 type AccountsConfig struct {
 	Accounts []Account `json:"accounts"`
@@ -59,3 +59,31 @@ func TestSetTokenActive(t *testing.T) {
 	require.NoError(t, acct.SetTokenActive("TOKEN-1", false))
 	require.Equal(t, []string{"TOKEN-2"}, acct.ActiveTokens)
 }
+
+func TestAddCustomToken(t *testing.T) {
+	token := CustomToken{
+		Code:            "eth-erc20-0x2260fac5e5542a773aa44fbcfedf7c193bc2c599",
+		ContractAddress: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599",
+		Name:            "Wrapped BTC",
+		Symbol:          "WBTC",
+		Decimals:        8,
+	}
+	// not an ETH account.
+	require.Error(t, (&Account{CoinCode: coin.CodeTETH}).AddCustomToken(token))
+
+	acct := &Account{
+		CoinCode:     coin.CodeETH,
+		ActiveTokens: []string{"TOKEN-1"},
+	}
+	require.Nil(t, acct.CustomToken(token.Code))
+	require.NoError(t, acct.AddCustomToken(token))
+	require.Equal(t, []CustomToken{token}, acct.CustomTokens)
+	require.Equal(t, []string{"TOKEN-1", token.Code}, acct.ActiveTokens)
+	require.Equal(t, &token, acct.CustomToken(token.Code))
+
+	// Adding it again replaces it.
+	token.Name = "Wrapped Bitcoin"
+	require.NoError(t, acct.AddCustomToken(token))
+	require.Equal(t, []CustomToken{token}, acct.CustomTokens)
+	require.Equal(t, []string{"TOKEN-1", token.Code}, acct.ActiveTokens)
+}
@@ -31,9 +31,73 @@ type ServerInfo struct {
 	PEMCert string `json:"pemCert"`
 }
 
+// BTCBlockchainSource is where a Bitcoin based coin gets its blockchain data from. See the list of
+// consts below.
+type BTCBlockchainSource string
+
+const (
+	// BTCBlockchainSourceElectrum configures to connect to the servers in ElectrumServers.
+	BTCBlockchainSourceElectrum BTCBlockchainSource = "electrum"
+	// BTCBlockchainSourceBitcoinCore configures to connect to the node configured in BitcoinCore.
+	BTCBlockchainSourceBitcoinCore BTCBlockchainSource = "bitcoinCore"
+	// BTCBlockchainSourceCompactFilters configures to find the transactions of the accounts using
+	// compact block filters downloaded from the peers configured in CompactFilters, so the addresses
+	// are not revealed to the Electrum servers. The servers in ElectrumServers are still used for the
+	// headers, fee estimates and broadcasting transactions.
+	BTCBlockchainSourceCompactFilters BTCBlockchainSource = "compactFilters"
+)
+
+// BitcoinCoreConfig configures the connection to a Bitcoin Core node, or a node of a Bitcoin Core
+// fork like Litecoin Core.
+type BitcoinCoreConfig struct {
+	// RPCURL is the JSON-RPC endpoint of the node, e.g. "http://127.0.0.1:8332".
+	RPCURL      string `json:"rpcURL"`
+	RPCUser     string `json:"rpcUser"`
+	RPCPassword string `json:"rpcPassword"`
+	// Wallet is the name of the watch-only wallet which is created on the node to track the
+	// addresses of the accounts. "bitboxapp" is used if empty.
+	Wallet string `json:"wallet,omitempty"`
+	// RescanTimestamp is the unix time from which the node rescans the blockchain for the
+	// transactions of newly added accounts and addresses. It should be before the first
+	// transaction of the wallet. The whole blockchain is rescanned if zero.
+	RescanTimestamp int64 `json:"rescanTimestamp,omitempty"`
+	// PollIntervalSeconds is how often the node is polled for new blocks and transactions. 10
+	// seconds are used if zero.
+	PollIntervalSeconds int `json:"pollIntervalSeconds,omitempty"`
+}
+
+// CompactFiltersConfig configures finding transactions using BIP-158 compact block filters.
+type CompactFiltersConfig struct {
+	// Peers are the addresses (host:port) of P2P nodes serving compact block filters (BIP-157),
+	// e.g. Bitcoin Core nodes running with -peerblockfilters. The filter headers of all reachable
+	// peers are cross-checked.
+	Peers []string `json:"peers"`
+	// StartHeight is the height of the first block which is scanned. It should be before the first
+	// transaction of the wallet.
+	StartHeight int `json:"startHeight,omitempty"`
+}
+
+// HeadersSnapshotConfig configures a headers snapshot file, which is loaded before syncing the
+// remaining headers from the blockchain backend.
+type HeadersSnapshotConfig struct {
+	// File is the path of a snapshot created with the headerssnapshot tool.
+	File string `json:"file"`
+	// TrustedKeys are the hex encoded compressed public keys whose snapshots are trusted.
+	TrustedKeys []string `json:"trustedKeys"`
+}
+
 // btcCoinConfig holds configurations specific to a btc-based coin.
 type btcCoinConfig struct {
-	ElectrumServers []*ServerInfo `json:"electrumServers"`
+	// BlockchainSource is where to get the blockchain data from. Electrum is used if empty.
+	BlockchainSource BTCBlockchainSource  `json:"blockchainSource,omitempty"`
+	ElectrumServers  []*ServerInfo        `json:"electrumServers"`
+	BitcoinCore      BitcoinCoreConfig    `json:"bitcoinCore"`
+	CompactFilters   CompactFiltersConfig `json:"compactFilters"`
+	// CrossCheckElectrumServers enables verifying the histories and fee estimates of the Electrum
+	// server against a second one of the configured servers.
+	CrossCheckElectrumServers bool `json:"crossCheckElectrumServers,omitempty"`
+	// HeadersSnapshot is loaded before syncing the headers if File is set.
+	HeadersSnapshot HeadersSnapshotConfig `json:"headersSnapshot"`
 }
 
 // ETHTransactionsSource  where to get Ethereum transactions from. See the list of consts
@@ -46,11 +110,51 @@ const (
 	ETHTransactionsSourceNone ETHTransactionsSource = "none"
 	// ETHTransactionsSourceEtherScan configures to get transactions from EtherScan.
 	ETHTransactionsSourceEtherScan ETHTransactionsSource = "etherScan"
+	// ETHTransactionsSourceNode configures to find the transactions by scanning the blocks and logs
+	// of the node configured in NodeURL.
+	ETHTransactionsSourceNode ETHTransactionsSource = "node"
 )
 
+// ETHNodeConfig configures where an Ethereum based coin gets its data from.
+type ETHNodeConfig struct {
+	// TransactionsSource is where to get the transactions from. EtherScan is used if empty.
+	TransactionsSource ETHTransactionsSource `json:"transactionsSource,omitempty"`
+	// NodeURL is the JSON-RPC endpoint of an Ethereum node. If set, it is used instead of EtherScan
+	// for all requests except for fetching transactions, see TransactionsSource.
+	NodeURL string `json:"nodeURL,omitempty"`
+	// NodeStartBlock is the first block scanned with ETHTransactionsSourceNode, and required with
+	// it. It should be before the first transaction of the wallet, as earlier transactions are not
+	// found. Every block from there on is fetched once, so it should not be set lower than needed.
+	NodeStartBlock uint64 `json:"nodeStartBlock,omitempty"`
+}
+
 // ethCoinConfig holds configurations for ethereum coins.
 type ethCoinConfig struct {
 	DeprecatedActiveERC20Tokens []string `json:"activeERC20Tokens"`
+	ETHNodeConfig
+}
+
+// EVMNetwork is an additional EVM compatible network like Polygon or Arbitrum. Each network is a
+// coin of its own, with accounts derived from the keystore in the same way as for Ethereum. EVM
+// networks are only available in mainnet mode.
+type EVMNetwork struct {
+	// Code is the coin code, e.g. "matic". Networks with the code of a builtin coin are ignored.
+	Code coin.Code `json:"code"`
+	// Name is the name shown to the user, e.g. "Polygon".
+	Name string `json:"name"`
+	// Unit is the unit of the native currency, e.g. "MATIC".
+	Unit string `json:"unit"`
+	// ChainID is the EIP-155 chain ID, e.g. 137 for Polygon. Transactions are only signed for this
+	// chain.
+	ChainID uint64 `json:"chainID"`
+	// BlockExplorerTxPrefix is prepended to a transaction ID to link to the transaction, e.g.
+	// "https://polygonscan.com/tx/".
+	BlockExplorerTxPrefix string `json:"blockExplorerTxPrefix"`
+	// EtherScanURL is the API endpoint of an EtherScan compatible block explorer, e.g.
+	// "https://api.polygonscan.com/api". Not needed if the network is configured to use a node
+	// only.
+	EtherScanURL string `json:"etherScanURL"`
+	ETHNodeConfig
 }
 
 type proxyConfig struct {
@@ -69,12 +173,16 @@ type Backend struct {
 	BTC  btcCoinConfig `json:"btc"`
 	TBTC btcCoinConfig `json:"tbtc"`
 	RBTC btcCoinConfig `json:"rbtc"`
+	SBTC btcCoinConfig `json:"sbtc"`
 	LTC  btcCoinConfig `json:"ltc"`
 	TLTC btcCoinConfig `json:"tltc"`
 	ETH  ethCoinConfig `json:"eth"`
 	TETH ethCoinConfig `json:"teth"`
 	RETH ethCoinConfig `json:"reth"`
 
+	// EVMNetworks are additional EVM compatible networks configured by the user.
+	EVMNetworks []EVMNetwork `json:"evmNetworks"`
+
 	// FiatList contains all enabled fiat currencies.
 	// These are used in the UI as well as by RateUpdater to fetch historical exchange rates.
 	FiatList []string `json:"fiatList"`
@@ -94,7 +202,7 @@ type Backend struct {
 // kept in the accounts config.
 func (backend Backend) DeprecatedCoinActive(code coin.Code) bool {
 	switch code {
-	case coin.CodeBTC, coin.CodeTBTC, coin.CodeRBTC:
+	case coin.CodeBTC, coin.CodeTBTC, coin.CodeRBTC, coin.CodeSBTC:
 		return backend.DeprecatedBitcoinActive
 	case coin.CodeLTC, coin.CodeTLTC:
 		return backend.DeprecatedLitecoinActive
@@ -105,6 +213,72 @@ func (backend Backend) DeprecatedCoinActive(code coin.Code) bool {
 	}
 }
 
+// EVMNetwork returns the configured EVM network with the given coin code, or nil if there is none.
+func (backend Backend) EVMNetwork(code coin.Code) *EVMNetwork {
+	for i := range backend.EVMNetworks {
+		if backend.EVMNetworks[i].Code == code {
+			return &backend.EVMNetworks[i]
+		}
+	}
+	return nil
+}
+
+func (backend Backend) btcCoinConfig(code coin.Code) (btcCoinConfig, bool) {
+	switch code {
+	case coin.CodeBTC:
+		return backend.BTC, true
+	case coin.CodeTBTC:
+		return backend.TBTC, true
+	case coin.CodeRBTC:
+		return backend.RBTC, true
+	case coin.CodeSBTC:
+		return backend.SBTC, true
+	case coin.CodeLTC:
+		return backend.LTC, true
+	case coin.CodeTLTC:
+		return backend.TLTC, true
+	default:
+		return btcCoinConfig{}, false
+	}
+}
+
+// BitcoinCore returns the Bitcoin Core node configuration of a Bitcoin based coin by code, or nil if
+// the coin is not configured to use a Bitcoin Core node.
+func (backend Backend) BitcoinCore(code coin.Code) *BitcoinCoreConfig {
+	conf, ok := backend.btcCoinConfig(code)
+	if !ok || conf.BlockchainSource != BTCBlockchainSourceBitcoinCore {
+		return nil
+	}
+	return &conf.BitcoinCore
+}
+
+// CompactFilters returns the compact block filters configuration of a Bitcoin based coin by code,
+// or nil if the coin is not configured to use compact block filters.
+func (backend Backend) CompactFilters(code coin.Code) *CompactFiltersConfig {
+	conf, ok := backend.btcCoinConfig(code)
+	if !ok || conf.BlockchainSource != BTCBlockchainSourceCompactFilters {
+		return nil
+	}
+	return &conf.CompactFilters
+}
+
+// CrossCheckElectrumServers returns true if the answers of the Electrum servers of the given coin
+// should be cross-checked.
+func (backend Backend) CrossCheckElectrumServers(code coin.Code) bool {
+	conf, ok := backend.btcCoinConfig(code)
+	return ok && conf.CrossCheckElectrumServers
+}
+
+// HeadersSnapshot returns the headers snapshot configuration of a Bitcoin based coin by code, or
+// nil if no snapshot file is configured.
+func (backend Backend) HeadersSnapshot(code coin.Code) *HeadersSnapshotConfig {
+	conf, ok := backend.btcCoinConfig(code)
+	if !ok || conf.HeadersSnapshot.File == "" {
+		return nil
+	}
+	return &conf.HeadersSnapshot
+}
+
 // AppConfig holds the whole app configuration.
 type AppConfig struct {
 	Backend  Backend     `json:"backend"`
@@ -176,6 +350,17 @@ func NewDefaultAppConfig() AppConfig {
 					},
 				},
 			},
+			SBTC: btcCoinConfig{
+				// There are no public signet servers we could rely on. This is the default
+				// Electrum port of electrs on signet.
+				ElectrumServers: []*ServerInfo{
+					{
+						Server:  "127.0.0.1:60601",
+						TLS:     false,
+						PEMCert: "",
+					},
+				},
+			},
 			LTC: btcCoinConfig{
 				ElectrumServers: []*ServerInfo{
 					{
@@ -213,6 +398,7 @@ func NewDefaultAppConfig() AppConfig {
 			RETH: ethCoinConfig{
 				DeprecatedActiveERC20Tokens: []string{},
 			},
+			EVMNetworks: []EVMNetwork{},
 			// Copied from frontend/web/src/components/rates/rates.tsx.
 			FiatList: []string{"USD", "EUR", "CHF"},
 			MainFiat: "USD",
@@ -29,6 +29,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
 )
 
@@ -77,7 +78,13 @@ func (keystore *keystore) SupportsCoin(coin coin.Coin) bool {
 
 // SupportsAccount implements keystore.Keystore.
 func (keystore *keystore) SupportsAccount(coin coin.Coin, meta interface{}) bool {
-	return keystore.SupportsCoin(coin)
+	if !keystore.SupportsCoin(coin) {
+		return false
+	}
+	// The BitBox01 can only create ECDSA signatures, so it can't spend from taproot outputs. It
+	// does not support multisig either.
+	scriptType := meta.(signing.ScriptType)
+	return scriptType != signing.ScriptTypeP2TR && scriptType != signing.ScriptTypeP2WSH
 }
 
 // SupportsUnifiedAccounts implements keystore.Keystore.
@@ -90,6 +97,19 @@ func (keystore *keystore) SupportsMultipleAccounts() bool {
 	return false
 }
 
+// SupportsEIP1559 implements keystore.Keystore.
+func (keystore *keystore) SupportsEIP1559() bool {
+	// The BitBox01 does not support Ethereum accounts.
+	return false
+}
+
+// SupportsPaymentsToTaproot implements keystore.Keystore.
+func (keystore *keystore) SupportsPaymentsToTaproot() bool {
+	// The transaction is passed to the paired mobile app for verification, which cannot
+	// display witness v1 outputs.
+	return false
+}
+
 // CanVerifyAddress implements keystore.Keystore.
 func (keystore *keystore) CanVerifyAddress(coin coin.Coin) (bool, bool, error) {
 	deviceInfo, err := keystore.dbb.DeviceInfo()
@@ -187,8 +207,12 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 }
 
 func (keystore *keystore) signETHTransaction(txProposal *eth.TxProposal) error {
+	tx, ok := txProposal.Tx.(*types.Transaction)
+	if !ok {
+		return errp.New("the BitBox01 only supports signing legacy Ethereum transactions")
+	}
 	signatureHashes := [][]byte{
-		txProposal.Signer.Hash(txProposal.Tx).Bytes(),
+		txProposal.Signer.Hash(tx).Bytes(),
 	}
 	signatures, err := keystore.dbb.Sign(nil, signatureHashes, []string{txProposal.Keypath.Encode()})
 	if isErrorAbort(err) {
@@ -208,7 +232,7 @@ func (keystore *keystore) signETHTransaction(txProposal *eth.TxProposal) error {
 	copy(sig[:32], math.PaddedBigBytes(signature.R, 32))
 	copy(sig[32:64], math.PaddedBigBytes(signature.S, 32))
 	sig[64] = byte(signature.RecID)
-	signedTx, err := txProposal.Tx.WithSignature(txProposal.Signer, sig)
+	signedTx, err := tx.WithSignature(txProposal.Signer, sig)
 	if err != nil {
 		return err
 	}
@@ -233,6 +257,12 @@ func (keystore *keystore) CanSignMessage(coin.Code) bool {
 	return false
 }
 
+// CanSignBIP322Message implements keystore.Keystore. The BitBox01 signs the sighashes of the
+// virtual to_sign transaction like any other transaction.
+func (keystore *keystore) CanSignBIP322Message(code coin.Code) bool {
+	return code == coin.CodeBTC || code == coin.CodeTBTC || code == coin.CodeRBTC || code == coin.CodeSBTC
+}
+
 // SignBTCMessage implements keystore.Keystore.
 func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
 	return nil, errp.New("unsupported")
@@ -242,3 +272,8 @@ func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.Absolut
 func (keystore *keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 	return nil, errp.New("unsupported")
 }
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.New("unsupported")
+}
@@ -28,12 +28,14 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/eip712"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
 	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
 	"github.com/digitalbitbox/bitbox02-api-go/api/firmware/messages"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
 )
 
@@ -77,7 +79,13 @@ func (keystore *keystore) SupportsCoin(coin coin.Coin) bool {
 		if specificCoin.ERC20Token() != nil {
 			return keystore.device.SupportsERC20(specificCoin.ERC20Token().ContractAddress().String())
 		}
-		return keystore.device.SupportsETH(ethMsgCoinMap[coin.Code()])
+		// Other EVM networks are not supported, as the BitBox02 can only sign for the chains it
+		// knows.
+		msgCoin, ok := ethMsgCoinMap[coin.Code()]
+		if !ok {
+			return false
+		}
+		return keystore.device.SupportsETH(msgCoin)
 	default:
 		return false
 	}
@@ -91,7 +99,12 @@ func (keystore *keystore) SupportsAccount(coin coin.Coin, meta interface{}) bool
 	switch coin.(type) {
 	case *btc.Coin:
 		scriptType := meta.(signing.ScriptType)
-		return scriptType != signing.ScriptTypeP2PKH
+		if scriptType == signing.ScriptTypeP2WSH {
+			// Multisig is only supported for Bitcoin.
+			return coin.Code() == coinpkg.CodeBTC || coin.Code() == coinpkg.CodeTBTC
+		}
+		// Taproot is not supported by the firmware API yet.
+		return scriptType != signing.ScriptTypeP2PKH && scriptType != signing.ScriptTypeP2TR
 	default:
 		return true
 	}
@@ -107,6 +120,20 @@ func (keystore *keystore) SupportsMultipleAccounts() bool {
 	return true
 }
 
+// SupportsEIP1559 implements keystore.Keystore.
+func (keystore *keystore) SupportsEIP1559() bool {
+	// The BitBox02 ETH signing API only supports legacy transactions so far. Dynamic fee
+	// transactions can be enabled once the firmware and bitbox02-api-go support them.
+	return false
+}
+
+// SupportsPaymentsToTaproot implements keystore.Keystore.
+func (keystore *keystore) SupportsPaymentsToTaproot() bool {
+	// bitbox02-api-go has no P2TR output type yet, so taproot outputs can't be passed to the
+	// device.
+	return false
+}
+
 // CanVerifyAddress implements keystore.Keystore.
 func (keystore *keystore) CanVerifyAddress(coin coinpkg.Coin) (bool, bool, error) {
 	const optional = false
@@ -133,14 +160,26 @@ func (keystore *keystore) VerifyAddress(
 	}
 	switch specificCoin := coin.(type) {
 	case *btc.Coin:
-		msgScriptType, ok := btcMsgScriptTypeMap[configuration.ScriptType()]
-		if !ok {
-			panic("unsupported scripttype")
+		var scriptConfig *messages.BTCScriptConfig
+		keypath := configuration.AbsoluteKeypath()
+		if configuration.IsMultisig() {
+			var ourKeyInfo *signing.KeyInfo
+			scriptConfig, ourKeyInfo, err = keystore.multisigScriptConfig(configuration)
+			if err != nil {
+				return err
+			}
+			keypath = ourKeyInfo.AbsoluteKeypath
+		} else {
+			msgScriptType, ok := btcMsgScriptTypeMap[configuration.ScriptType()]
+			if !ok {
+				panic("unsupported scripttype")
+			}
+			scriptConfig = firmware.NewBTCScriptConfigSimple(msgScriptType)
 		}
 		_, err = keystore.device.BTCAddress(
 			btcMsgCoinMap[coin.Code()],
-			configuration.AbsoluteKeypath().ToUInt32(),
-			firmware.NewBTCScriptConfigSimple(msgScriptType),
+			keypath.ToUInt32(),
+			scriptConfig,
 			true,
 		)
 		if firmware.IsErrorAbort(err) {
@@ -204,7 +243,7 @@ func (keystore *keystore) VerifyExtendedPublicKey(
 			if !ok {
 				msgXPubType = messages.BTCPubRequest_XPUB
 			}
-		case chaincfg.TestNet3Params.Net, ltc.TestNet4Params.Net:
+		case chaincfg.TestNet3Params.Net, chaincfg.SigNetParams.Net, ltc.TestNet4Params.Net:
 			msgXPubType = messages.BTCPubRequest_TPUB
 		default:
 			msgXPubType = messages.BTCPubRequest_XPUB
@@ -278,11 +317,99 @@ func (keystore *keystore) ExtendedPublicKey(
 	}
 }
 
+// multisigScriptConfig returns the BitBox02 script config of a multisig signing configuration and
+// the key info of this keystore among the cosigners. The configuration must be account-level.
+func (keystore *keystore) multisigScriptConfig(
+	configuration *signing.Configuration) (*messages.BTCScriptConfig, *signing.KeyInfo, error) {
+	if configuration.ScriptType() != signing.ScriptTypeP2WSH {
+		return nil, nil, errp.Newf("Unsupported script type %s", configuration.ScriptType())
+	}
+	rootFingerprint, err := keystore.RootFingerprint()
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfos := configuration.KeyInfos()
+	xpubs := make([]string, len(keyInfos))
+	ourXPubIndex := -1
+	for i, keyInfo := range keyInfos {
+		xpubs[i] = keyInfo.ExtendedPublicKey.String()
+		if bytes.Equal(keyInfo.RootFingerprint, rootFingerprint) {
+			ourXPubIndex = i
+		}
+	}
+	if ourXPubIndex < 0 {
+		return nil, nil, errp.New("The BitBox02 is not a cosigner of this multisig account")
+	}
+	scriptConfig, err := firmware.NewBTCScriptConfigMultisig(
+		configuration.BitcoinMultisig.Threshold, xpubs, uint32(ourXPubIndex))
+	if err != nil {
+		return nil, nil, err
+	}
+	scriptConfig.GetMultisig().ScriptType = messages.BTCScriptConfig_Multisig_P2WSH
+	return scriptConfig, &keyInfos[ourXPubIndex], nil
+}
+
+// registerMultisig registers the multisig account on the device if needed. The user is asked to
+// confirm the cosigners and to name the account on the device.
+func (keystore *keystore) registerMultisig(
+	msgCoin messages.BTCCoin, scriptConfig *messages.BTCScriptConfig, keypath []uint32) error {
+	registered, err := keystore.device.BTCIsScriptConfigRegistered(msgCoin, scriptConfig, keypath)
+	if err != nil {
+		return err
+	}
+	if registered {
+		return nil
+	}
+	err = keystore.device.BTCRegisterScriptConfig(msgCoin, scriptConfig, keypath, "")
+	if firmware.IsErrorAbort(err) {
+		return errp.WithStack(keystorePkg.ErrSigningAborted)
+	}
+	return err
+}
+
+// ourKeypath returns the keypath of this keystore's key in the configuration. For single-sig
+// configurations, this is simply the keypath of the configuration.
+func ourKeypath(configuration *signing.Configuration, rootFingerprint []byte) ([]uint32, error) {
+	if !configuration.IsMultisig() {
+		return configuration.AbsoluteKeypath().ToUInt32(), nil
+	}
+	keyInfo := configuration.KeyInfo(rootFingerprint)
+	if keyInfo == nil {
+		return nil, errp.New("The BitBox02 is not a cosigner of this multisig account")
+	}
+	return keyInfo.AbsoluteKeypath.ToUInt32(), nil
+}
+
 func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransaction) error {
 	tx := btcProposedTx.TXProposal.Transaction
 
+	coin := btcProposedTx.TXProposal.Coin.(*btc.Coin)
+	msgCoin, ok := btcMsgCoinMap[coin.Code()]
+	if !ok {
+		return errp.Newf("coin not supported: %s", coin.Code())
+	}
+	rootFingerprint, err := keystore.RootFingerprint()
+	if err != nil {
+		return err
+	}
+
 	scriptConfigs := make([]*messages.BTCScriptConfigWithKeypath, len(btcProposedTx.AccountSigningConfigurations))
 	for i, cfg := range btcProposedTx.AccountSigningConfigurations {
+		if cfg.IsMultisig() {
+			scriptConfig, ourKeyInfo, err := keystore.multisigScriptConfig(cfg)
+			if err != nil {
+				return err
+			}
+			keypath := ourKeyInfo.AbsoluteKeypath.ToUInt32()
+			if err := keystore.registerMultisig(msgCoin, scriptConfig, keypath); err != nil {
+				return err
+			}
+			scriptConfigs[i] = &messages.BTCScriptConfigWithKeypath{
+				ScriptConfig: scriptConfig,
+				Keypath:      keypath,
+			}
+			continue
+		}
 		msgScriptType, ok := btcMsgScriptTypeMap[cfg.ScriptType()]
 		if !ok {
 			return errp.Newf("Unsupported script type %s", cfg.ScriptType())
@@ -292,11 +419,6 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 			Keypath:      cfg.AbsoluteKeypath().ToUInt32(),
 		}
 	}
-	coin := btcProposedTx.TXProposal.Coin.(*btc.Coin)
-	msgCoin, ok := btcMsgCoinMap[coin.Code()]
-	if !ok {
-		return errp.Newf("coin not supported: %s", coin.Code())
-	}
 
 	inputs := make([]*firmware.BTCTxInput, len(tx.TxIn))
 	for inputIndex, txIn := range tx.TxIn {
@@ -332,13 +454,17 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 			}
 		}
 
+		inputKeypath, err := ourKeypath(inputAddress.Configuration, rootFingerprint)
+		if err != nil {
+			return err
+		}
 		inputs[inputIndex] = &firmware.BTCTxInput{
 			Input: &messages.BTCSignInputRequest{
 				PrevOutHash:       txIn.PreviousOutPoint.Hash[:],
 				PrevOutIndex:      txIn.PreviousOutPoint.Index,
 				PrevOutValue:      uint64(prevOut.Value),
 				Sequence:          txIn.Sequence,
-				Keypath:           inputAddress.Configuration.AbsoluteKeypath().ToUInt32(),
+				Keypath:           inputKeypath,
 				ScriptConfigIndex: scriptConfigIndex,
 			},
 			PrevTx: &firmware.BTCPrevTx{
@@ -349,6 +475,8 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 			},
 		}
 	}
+	// Every output except for the change is confirmed by the user on the device, so all recipients
+	// of a batch payment are shown one after another.
 	outputs := make([]*messages.BTCSignOutputRequest, len(tx.TxOut))
 	for index, txOut := range tx.TxOut {
 		scriptClass, addresses, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, coin.Net())
@@ -369,7 +497,10 @@ func (keystore *keystore) signBTCTransaction(btcProposedTx *btc.ProposedTransact
 		)
 		var keypath []uint32
 		if isChange {
-			keypath = changeAddress.Configuration.AbsoluteKeypath().ToUInt32()
+			keypath, err = ourKeypath(changeAddress.Configuration, rootFingerprint)
+			if err != nil {
+				return err
+			}
 		}
 		outputs[index] = &messages.BTCSignOutputRequest{
 			Ours:    isChange,
@@ -410,7 +541,14 @@ func (keystore *keystore) signETHTransaction(txProposal *eth.TxProposal) error {
 	if !ok {
 		return errp.New("unsupported coin")
 	}
-	tx := txProposal.Tx
+	// The signature is only valid if the transaction is signed for the chain the BitBox02 signs for.
+	if !txProposal.Signer.Equal(types.NewEIP155Signer(big.NewInt(ethMsgCoinChainIDs[msgCoin]))) {
+		return errp.New("chain ID not supported")
+	}
+	tx, ok := txProposal.Tx.(*types.Transaction)
+	if !ok {
+		return errp.New("the BitBox02 only supports signing legacy Ethereum transactions")
+	}
 	recipient := tx.To()
 	if recipient == nil {
 		return errp.New("contract creation not supported")
@@ -431,7 +569,7 @@ func (keystore *keystore) signETHTransaction(txProposal *eth.TxProposal) error {
 	if err != nil {
 		return err
 	}
-	signedTx, err := txProposal.Tx.WithSignature(txProposal.Signer, signature)
+	signedTx, err := tx.WithSignature(txProposal.Signer, signature)
 	if err != nil {
 		return err
 	}
@@ -456,6 +594,14 @@ func (keystore *keystore) CanSignMessage(code coin.Code) bool {
 	return code == coin.CodeBTC || code == coin.CodeETH
 }
 
+// CanSignBIP322Message implements keystore.Keystore. The firmware only signs transactions with
+// version 1 or 2 and outputs paying to an address, so it can't sign the virtual to_sign transaction,
+// which has version 0 and an OP_RETURN output. This needs support in the firmware and in
+// bitbox02-api-go.
+func (keystore *keystore) CanSignBIP322Message(coin.Code) bool {
+	return false
+}
+
 // SignBTCMessage implements keystore.Keystore.
 func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
 	sc, ok := btcMsgScriptTypeMap[scriptType]
@@ -477,3 +623,13 @@ func (keystore *keystore) SignBTCMessage(message []byte, keypath signing.Absolut
 func (keystore *keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 	return keystore.device.ETHSignMessage(messages.ETHCoin_ETH, keypath.ToUInt32(), message)
 }
+
+// SignETHTypedMessage implements keystore.Keystore. The typed data is validated, but it can't be
+// signed yet: the device must parse and display the typed data, and bitbox02-api-go has no API for
+// it. Returns keystorePkg.ErrUnsupported for valid typed data.
+func (keystore *keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	if _, err := eip712.Parse(data, chainID); err != nil {
+		return nil, err
+	}
+	return nil, errp.WithStack(keystorePkg.ErrUnsupported)
+}
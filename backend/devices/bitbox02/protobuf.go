@@ -27,6 +27,8 @@ import (
 var btcMsgCoinMap = map[coin.Code]messages.BTCCoin{
 	coin.CodeBTC:  messages.BTCCoin_BTC,
 	coin.CodeTBTC: messages.BTCCoin_TBTC,
+	// Signet uses the same address formats and keypaths as testnet.
+	coin.CodeSBTC: messages.BTCCoin_TBTC,
 	coin.CodeLTC:  messages.BTCCoin_LTC,
 	coin.CodeTLTC: messages.BTCCoin_TLTC,
 }
@@ -59,3 +61,10 @@ var ethMsgCoinMap = map[coin.Code]messages.ETHCoin{
 	coin.CodeRETH:         messages.ETHCoin_RinkebyETH,
 	coin.CodeERC20TEST:    messages.ETHCoin_RopstenETH,
 }
+
+// ethMsgCoinChainIDs are the EIP-155 chain IDs the BitBox02 signs transactions for.
+var ethMsgCoinChainIDs = map[messages.ETHCoin]int64{
+	messages.ETHCoin_ETH:        1,
+	messages.ETHCoin_RopstenETH: 3,
+	messages.ETHCoin_RinkebyETH: 4,
+}
@@ -16,8 +16,12 @@
 package backend
 
 import (
+	"strings"
+
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/erc20"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 type erc20Token struct {
@@ -103,3 +107,54 @@ func erc20TokenByCode(code coin.Code) *erc20Token {
 	}
 	return nil
 }
+
+// erc20TokenByContractAddress returns the builtin token with the given contract address, or nil if
+// there is none.
+func erc20TokenByContractAddress(contractAddress common.Address) *erc20Token {
+	for _, token := range erc20Tokens {
+		if contractAddress == token.token.ContractAddress() {
+			token := token
+			return &token
+		}
+	}
+	return nil
+}
+
+// erc20TokenByUnit returns the builtin token with the given unit, ignoring the case, or nil if
+// there is none.
+func erc20TokenByUnit(unit string) *erc20Token {
+	for _, token := range erc20Tokens {
+		if strings.EqualFold(unit, token.unit) {
+			token := token
+			return &token
+		}
+	}
+	return nil
+}
+
+// customERC20TokenCode returns the coin code of a user-defined token, e.g.
+// "eth-erc20-0x6b175474e89094c44da98b954eedeac495271d0f".
+func customERC20TokenCode(contractAddress common.Address) coin.Code {
+	return coin.Code("eth-erc20-" + strings.ToLower(contractAddress.Hex()))
+}
+
+// loadCustomERC20Tokens makes the user-defined tokens of all persisted accounts available in
+// `Coin()`.
+func (backend *Backend) loadCustomERC20Tokens(persistedAccounts *config.AccountsConfig) {
+	defer backend.coinsLock.Lock()()
+	backend.customERC20Tokens = map[coin.Code]*erc20Token{}
+	for _, account := range persistedAccounts.Accounts {
+		for _, customToken := range account.CustomTokens {
+			if !common.IsHexAddress(customToken.ContractAddress) {
+				backend.log.WithField("code", customToken.Code).Error("invalid ERC20 contract address")
+				continue
+			}
+			backend.customERC20Tokens[coin.Code(customToken.Code)] = &erc20Token{
+				code:  coin.Code(customToken.Code),
+				name:  customToken.Name,
+				unit:  customToken.Symbol,
+				token: erc20.NewToken(customToken.ContractAddress, customToken.Decimals),
+			}
+		}
+	}
+}
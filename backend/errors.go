@@ -48,4 +48,23 @@ const (
 	errAOPPSigningAborted ErrorCode = "aoppSigningAborted"
 	// errAOPPCallback is returned when there was an error calling the callback in the AOPP request.
 	errAOPPCallback ErrorCode = "aoppCallback"
+
+	// errWalletConnectInvalidURI is returned when a WalletConnect pairing URI can't be parsed.
+	errWalletConnectInvalidURI ErrorCode = "walletConnectInvalidURI"
+	// errWalletConnectConnection is returned when the relay can't be reached or the connection to
+	// the dapp was lost.
+	errWalletConnectConnection ErrorCode = "walletConnectConnection"
+	// errWalletConnectNoAccounts is returned when there is no Ethereum account to connect to a dapp.
+	errWalletConnectNoAccounts ErrorCode = "walletConnectNoAccounts"
+	// errWalletConnectSigningAborted is returned when the user aborts signing a dapp request on
+	// the device.
+	errWalletConnectSigningAborted ErrorCode = "walletConnectSigningAborted"
+	// errWalletConnectRequestFailed is returned when a dapp request could not be processed, e.g.
+	// because the transaction is invalid.
+	errWalletConnectRequestFailed ErrorCode = "walletConnectRequestFailed"
+	// errWalletConnectUnsupported is returned when the keystore can't sign a dapp request, e.g.
+	// EIP-712 typed data with the BitBox02.
+	errWalletConnectUnsupported ErrorCode = "walletConnectUnsupported"
+	// errWalletConnectUnknown is returned on unexpected errors that in theory should never happen.
+	errWalletConnectUnknown ErrorCode = "walletConnectUnknown"
 )
@@ -0,0 +1,57 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"math/big"
+
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// evmChainConfig returns the chain config of a user-defined EVM network. All forks are active from
+// the genesis block, so transactions are always signed with replay protection for the chain ID
+// (EIP-155).
+func evmChainConfig(chainID uint64) *params.ChainConfig {
+	return &params.ChainConfig{
+		ChainID:             new(big.Int).SetUint64(chainID),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+	}
+}
+
+// evmNetworkCodes returns the coin codes of the user-defined EVM networks, skipping the ones which
+// collide with the given builtin coin codes.
+func (backend *Backend) evmNetworkCodes(builtinCodes []coinpkg.Code) []coinpkg.Code {
+	builtin := map[coinpkg.Code]struct{}{}
+	for _, code := range builtinCodes {
+		builtin[code] = struct{}{}
+	}
+	var codes []coinpkg.Code
+	for _, network := range backend.config.AppConfig().Backend.EVMNetworks {
+		if _, ok := builtin[network.Code]; ok {
+			backend.log.WithField("code", network.Code).Error("EVM network collides with a builtin coin")
+			continue
+		}
+		codes = append(codes, network.Code)
+	}
+	return codes
+}
@@ -47,6 +47,7 @@ import (
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/exchanges"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/rates"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	utilConfig "github.com/digitalbitbox/bitbox-wallet-app/util/config"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/jsonp"
@@ -93,13 +94,25 @@ type Backend interface {
 	SupportedCoins(keystore.Keystore) []coinpkg.Code
 	CanAddAccount(coinpkg.Code, keystore.Keystore) (string, bool)
 	CreateAndPersistAccountConfig(coinCode coinpkg.Code, name string, keystore keystore.Keystore) (accounts.Code, error)
+	AddWatchOnlyAccount(coinCode coinpkg.Code, name string, extendedPublicKey string, scriptType signing.ScriptType) (accounts.Code, error)
+	CreateAndPersistMultisigAccountConfig(coinCode coinpkg.Code, name string, threshold uint32, cosigners []string, keystore keystore.Keystore) (accounts.Code, error)
 	SetAccountActive(accountCode accounts.Code, active bool) error
 	SetTokenActive(accountCode accounts.Code, tokenCode string, active bool) error
+	AddCustomERC20Token(accountCode accounts.Code, contractAddress string) (string, error)
 	RenameAccount(accountCode accounts.Code, name string) error
 	AOPP() backend.AOPP
 	AOPPCancel()
 	AOPPApprove()
 	AOPPChooseAccount(code accounts.Code)
+	WalletConnect() backend.WalletConnect
+	WalletConnectSessions() []backend.WalletConnectSession
+	WalletConnectCancel()
+	WalletConnectApproveSession(code accounts.Code)
+	WalletConnectApproveRequest()
+	WalletConnectDisconnect(clientID string) error
+	AccountDiscovery() backend.AccountDiscovery
+	AddDiscoveredAccounts() error
+	DismissDiscoveredAccounts()
 }
 
 // Handlers provides a web api to the backend.
@@ -177,10 +190,13 @@ func NewHandlers(
 	getAPIRouter(apiRouter)("/version", handlers.getVersionHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/testing", handlers.getTestingHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/account-add", handlers.postAddAccountHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/account-add-watchonly", handlers.postAddWatchOnlyAccountHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/account-add-multisig", handlers.postAddMultisigAccountHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/keystores", handlers.getKeystoresHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/accounts", handlers.getAccountsHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/set-account-active", handlers.postSetAccountActiveHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/set-token-active", handlers.postSetTokenActiveHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/add-custom-erc20-token", handlers.postAddCustomERC20TokenHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/rename-account", handlers.postRenameAccountHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/accounts/reinitialize", handlers.postAccountsReinitializeHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/export-account-summary", handlers.postExportAccountSummary).Methods("POST")
@@ -193,6 +209,7 @@ func NewHandlers(
 	getAPIRouter(apiRouter)("/coins/convertFromFiat", handlers.getConvertFromFiatHandler).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/tltc/headers/status", handlers.getHeadersStatus(coinpkg.CodeTLTC)).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/tbtc/headers/status", handlers.getHeadersStatus(coinpkg.CodeTBTC)).Methods("GET")
+	getAPIRouter(apiRouter)("/coins/sbtc/headers/status", handlers.getHeadersStatus(coinpkg.CodeSBTC)).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/ltc/headers/status", handlers.getHeadersStatus(coinpkg.CodeLTC)).Methods("GET")
 	getAPIRouter(apiRouter)("/coins/btc/headers/status", handlers.getHeadersStatus(coinpkg.CodeBTC)).Methods("GET")
 	getAPIRouter(apiRouter)("/certs/download", handlers.postCertsDownloadHandler).Methods("POST")
@@ -204,6 +221,15 @@ func NewHandlers(
 	getAPIRouter(apiRouter)("/aopp/cancel", handlers.postAOPPCancelHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/aopp/approve", handlers.postAOPPApproveHandler).Methods("POST")
 	getAPIRouter(apiRouter)("/aopp/choose-account", handlers.postAOPPChooseAccountHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/walletconnect", handlers.getWalletConnectHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/walletconnect/sessions", handlers.getWalletConnectSessionsHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/walletconnect/cancel", handlers.postWalletConnectCancelHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/walletconnect/approve-session", handlers.postWalletConnectApproveSessionHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/walletconnect/approve-request", handlers.postWalletConnectApproveRequestHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/walletconnect/disconnect", handlers.postWalletConnectDisconnectHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/account-discovery", handlers.getAccountDiscoveryHandler).Methods("GET")
+	getAPIRouter(apiRouter)("/account-discovery/add", handlers.postAccountDiscoveryAddHandler).Methods("POST")
+	getAPIRouter(apiRouter)("/account-discovery/dismiss", handlers.postAccountDiscoveryDismissHandler).Methods("POST")
 
 	devicesRouter := getAPIRouter(apiRouter.PathPrefix("/devices").Subrouter())
 	devicesRouter("/registered", handlers.getDevicesRegisteredHandler).Methods("GET")
@@ -324,11 +350,14 @@ type accountJSON struct {
 	IsToken               bool          `json:"isToken"`
 	ActiveTokens          []activeToken `json:"activeTokens,omitempty"`
 	BlockExplorerTxPrefix string        `json:"blockExplorerTxPrefix"`
+	WatchOnly             bool          `json:"watchOnly"`
 }
 
 func newAccountJSON(account accounts.Interface, activeTokens []activeToken) *accountJSON {
 	eth, ok := account.Coin().(*eth.Coin)
 	isToken := ok && eth.ERC20Token() != nil
+	accountKeystore := account.Config().Keystore
+	watchOnly := accountKeystore != nil && accountKeystore.Type() == keystore.TypeWatchOnly
 	return &accountJSON{
 		Active:                account.Config().Active,
 		CoinCode:              account.Coin().Code(),
@@ -339,6 +368,7 @@ func newAccountJSON(account accounts.Interface, activeTokens []activeToken) *acc
 		IsToken:               isToken,
 		ActiveTokens:          activeTokens,
 		BlockExplorerTxPrefix: account.Coin().BlockExplorerTransactionURLPrefix(),
+		WatchOnly:             watchOnly,
 	}
 }
 
@@ -450,6 +480,74 @@ func (handlers *Handlers) postAddAccountHandler(r *http.Request) (interface{}, e
 	return response{Success: true, AccountCode: accountCode}, nil
 }
 
+func (handlers *Handlers) postAddMultisigAccountHandler(r *http.Request) (interface{}, error) {
+	var jsonBody struct {
+		CoinCode  coinpkg.Code `json:"coinCode"`
+		Name      string       `json:"name"`
+		Threshold uint32       `json:"threshold"`
+		// Extended public keys of the other cosigners.
+		Cosigners []string `json:"cosigners"`
+	}
+
+	type response struct {
+		Success      bool          `json:"success"`
+		AccountCode  accounts.Code `json:"accountCode,omitempty"`
+		ErrorMessage string        `json:"errorMessage,omitempty"`
+		ErrorCode    string        `json:"errorCode,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+
+	keystore := handlers.backend.Keystore()
+	if keystore == nil {
+		return response{Success: false, ErrorMessage: "Keystore not found"}, nil
+	}
+
+	accountCode, err := handlers.backend.CreateAndPersistMultisigAccountConfig(
+		jsonBody.CoinCode, jsonBody.Name, jsonBody.Threshold, jsonBody.Cosigners, keystore)
+	if err != nil {
+		handlers.log.WithError(err).Error("Could not add multisig account")
+		if errCode, ok := errp.Cause(err).(backend.ErrorCode); ok {
+			return response{Success: false, ErrorCode: string(errCode)}, nil
+		}
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	return response{Success: true, AccountCode: accountCode}, nil
+}
+
+func (handlers *Handlers) postAddWatchOnlyAccountHandler(r *http.Request) (interface{}, error) {
+	var jsonBody struct {
+		CoinCode          coinpkg.Code       `json:"coinCode"`
+		Name              string             `json:"name"`
+		ExtendedPublicKey string             `json:"extendedPublicKey"`
+		ScriptType        signing.ScriptType `json:"scriptType"`
+	}
+
+	type response struct {
+		Success      bool          `json:"success"`
+		AccountCode  accounts.Code `json:"accountCode,omitempty"`
+		ErrorMessage string        `json:"errorMessage,omitempty"`
+		ErrorCode    string        `json:"errorCode,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+
+	accountCode, err := handlers.backend.AddWatchOnlyAccount(
+		jsonBody.CoinCode, jsonBody.Name, jsonBody.ExtendedPublicKey, jsonBody.ScriptType)
+	if err != nil {
+		handlers.log.WithError(err).Error("Could not add watch-only account")
+		if errCode, ok := errp.Cause(err).(backend.ErrorCode); ok {
+			return response{Success: false, ErrorCode: string(errCode)}, nil
+		}
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	return response{Success: true, AccountCode: accountCode}, nil
+}
+
 func (handlers *Handlers) getKeystoresHandler(_ *http.Request) (interface{}, error) {
 	type json struct {
 		Type keystore.Type `json:"type"`
@@ -529,6 +627,28 @@ func (handlers *Handlers) postSetTokenActiveHandler(r *http.Request) (interface{
 	return response{Success: true}, nil
 }
 
+func (handlers *Handlers) postAddCustomERC20TokenHandler(r *http.Request) (interface{}, error) {
+	var jsonBody struct {
+		AccountCode     accounts.Code `json:"accountCode"`
+		ContractAddress string        `json:"contractAddress"`
+	}
+
+	type response struct {
+		Success      bool   `json:"success"`
+		TokenCode    string `json:"tokenCode,omitempty"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jsonBody); err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	tokenCode, err := handlers.backend.AddCustomERC20Token(jsonBody.AccountCode, jsonBody.ContractAddress)
+	if err != nil {
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	return response{Success: true, TokenCode: tokenCode}, nil
+}
+
 func (handlers *Handlers) postRenameAccountHandler(r *http.Request) (interface{}, error) {
 	var jsonBody struct {
 		AccountCode accounts.Code `json:"accountCode"`
@@ -628,7 +748,7 @@ func (handlers *Handlers) getConvertFromFiatHandler(r *http.Request) (interface{
 	}
 	unit := coin.Unit(isFee)
 	switch unit { // HACK: fake rates for testnet coins
-	case "TBTC", "TLTC", "TETH", "RETH":
+	case "TBTC", "SBTC", "TLTC", "TETH", "RETH":
 		unit = unit[1:]
 	}
 	rate := handlers.backend.RatesUpdater().LatestPrice()[unit][from]
@@ -984,3 +1104,63 @@ func (handlers *Handlers) postAOPPApproveHandler(r *http.Request) (interface{},
 	handlers.backend.AOPPApprove()
 	return nil, nil
 }
+
+func (handlers *Handlers) getWalletConnectHandler(r *http.Request) (interface{}, error) {
+	return handlers.backend.WalletConnect(), nil
+}
+
+func (handlers *Handlers) getWalletConnectSessionsHandler(r *http.Request) (interface{}, error) {
+	return handlers.backend.WalletConnectSessions(), nil
+}
+
+func (handlers *Handlers) postWalletConnectCancelHandler(r *http.Request) (interface{}, error) {
+	handlers.backend.WalletConnectCancel()
+	return nil, nil
+}
+
+func (handlers *Handlers) postWalletConnectApproveSessionHandler(r *http.Request) (interface{}, error) {
+	var request struct {
+		AccountCode accounts.Code `json:"accountCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	handlers.backend.WalletConnectApproveSession(request.AccountCode)
+	return nil, nil
+}
+
+func (handlers *Handlers) postWalletConnectApproveRequestHandler(r *http.Request) (interface{}, error) {
+	handlers.backend.WalletConnectApproveRequest()
+	return nil, nil
+}
+
+func (handlers *Handlers) postWalletConnectDisconnectHandler(r *http.Request) (interface{}, error) {
+	var request struct {
+		ClientID string `json:"clientID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return nil, handlers.backend.WalletConnectDisconnect(request.ClientID)
+}
+
+func (handlers *Handlers) getAccountDiscoveryHandler(r *http.Request) (interface{}, error) {
+	return handlers.backend.AccountDiscovery(), nil
+}
+
+func (handlers *Handlers) postAccountDiscoveryAddHandler(r *http.Request) (interface{}, error) {
+	type response struct {
+		Success      bool   `json:"success"`
+		ErrorMessage string `json:"errorMessage,omitempty"`
+	}
+	if err := handlers.backend.AddDiscoveredAccounts(); err != nil {
+		handlers.log.WithError(err).Error("Could not add the discovered accounts")
+		return response{Success: false, ErrorMessage: err.Error()}, nil
+	}
+	return response{Success: true}, nil
+}
+
+func (handlers *Handlers) postAccountDiscoveryDismissHandler(r *http.Request) (interface{}, error) {
+	handlers.backend.DismissDiscoveredAccounts()
+	return nil, nil
+}
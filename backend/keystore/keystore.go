@@ -32,11 +32,18 @@ const (
 	// TypeSoftware mans the keystore is provided by a software (hot) wallet. Currently only used in
 	// devmode for testing.
 	TypeSoftware Type = "software"
+	// TypeWatchOnly means the keystore only holds an extended public key supplied by the user. It
+	// can't sign.
+	TypeWatchOnly Type = "watchonly"
 )
 
 // ErrSigningAborted is used when the user aborts a signing in process (e.g. abort on HW wallet).
 var ErrSigningAborted = errors.New("signing aborted by user")
 
+// ErrUnsupported is used when the keystore can't perform an operation, e.g. signing EIP-712 typed
+// messages with the BitBox02. The message is used as an error code by the frontend.
+var ErrUnsupported = errors.New("keystoreUnsupported")
+
 // Keystore supports hardened key derivation according to BIP32 and signing of transactions.
 //go:generate moq -pkg mocks -out mocks/keystore.go . Keystore
 type Keystore interface {
@@ -65,6 +72,14 @@ type Keystore interface {
 	// coin.
 	SupportsMultipleAccounts() bool
 
+	// SupportsEIP1559 returns true if the keystore can sign Ethereum EIP-1559 (dynamic fee)
+	// transactions. If false, legacy transactions with a single gas price are created.
+	SupportsEIP1559() bool
+
+	// SupportsPaymentsToTaproot returns true if the keystore can sign Bitcoin transactions
+	// which pay to taproot (P2TR) outputs.
+	SupportsPaymentsToTaproot() bool
+
 	// CanVerifyAddress returns whether the keystore supports to output an address securely.
 	// This is typically done through a screen on the device or through a paired mobile phone.
 	// optional is true if the user can skip verification, and false if they should be forced to
@@ -86,6 +101,11 @@ type Keystore interface {
 
 	// CanSignMessage returns true if the keystore can sign a message for a coin.
 	CanSignMessage(coin.Code) bool
+	// CanSignBIP322Message returns true if the keystore can sign BIP-322 messages for a coin. A
+	// BIP-322 message signature is created by signing a virtual transaction using
+	// SignTransaction(), so the keystore must be able to sign a transaction with version 0 and a
+	// single OP_RETURN output.
+	CanSignBIP322Message(coin.Code) bool
 	// SignBTCMessage signs the message using the private key at the keypath. The scriptType is
 	// required to compute and verify the address. The returned signature is a 65 byte signature in
 	// Electrum format.
@@ -94,6 +114,10 @@ type Keystore interface {
 	// 65 byte signature. The first 64 bytes are the secp256k1 signature in / compact format (R and
 	// S values), and the last byte is the recoverable id (recid).
 	SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
+	// SignETHTypedMessage signs EIP-712 typed structured data using the private key at the
+	// keypath. The data is the JSON encoded typed data, which must be valid for the given chainID.
+	// The result has the same format as the signature returned by SignETHMessage.
+	SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
 
 	// SignTransaction signs the given transaction proposal. Returns ErrSigningAborted if the user
 	// aborts.
@@ -12,6 +12,7 @@ import (
 )
 
 var (
+	lockKeystoreMockCanSignBIP322Message       sync.RWMutex
 	lockKeystoreMockCanSignMessage             sync.RWMutex
 	lockKeystoreMockCanVerifyAddress           sync.RWMutex
 	lockKeystoreMockCanVerifyExtendedPublicKey sync.RWMutex
@@ -19,10 +20,13 @@ var (
 	lockKeystoreMockRootFingerprint            sync.RWMutex
 	lockKeystoreMockSignBTCMessage             sync.RWMutex
 	lockKeystoreMockSignETHMessage             sync.RWMutex
+	lockKeystoreMockSignETHTypedMessage        sync.RWMutex
 	lockKeystoreMockSignTransaction            sync.RWMutex
 	lockKeystoreMockSupportsAccount            sync.RWMutex
 	lockKeystoreMockSupportsCoin               sync.RWMutex
+	lockKeystoreMockSupportsEIP1559            sync.RWMutex
 	lockKeystoreMockSupportsMultipleAccounts   sync.RWMutex
+	lockKeystoreMockSupportsPaymentsToTaproot  sync.RWMutex
 	lockKeystoreMockSupportsUnifiedAccounts    sync.RWMutex
 	lockKeystoreMockType                       sync.RWMutex
 	lockKeystoreMockVerifyAddress              sync.RWMutex
@@ -39,6 +43,9 @@ var _ keystore.Keystore = &KeystoreMock{}
 //
 //         // make and configure a mocked keystore.Keystore
 //         mockedKeystore := &KeystoreMock{
+//             CanSignBIP322MessageFunc: func(in1 coin.Code) bool {
+// 	               panic("mock out the CanSignBIP322Message method")
+//             },
 //             CanSignMessageFunc: func(in1 coin.Code) bool {
 // 	               panic("mock out the CanSignMessage method")
 //             },
@@ -60,6 +67,9 @@ var _ keystore.Keystore = &KeystoreMock{}
 //             SignETHMessageFunc: func(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 // 	               panic("mock out the SignETHMessage method")
 //             },
+//             SignETHTypedMessageFunc: func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+// 	               panic("mock out the SignETHTypedMessage method")
+//             },
 //             SignTransactionFunc: func(in1 interface{}) error {
 // 	               panic("mock out the SignTransaction method")
 //             },
@@ -69,9 +79,15 @@ var _ keystore.Keystore = &KeystoreMock{}
 //             SupportsCoinFunc: func(coinInstance coin.Coin) bool {
 // 	               panic("mock out the SupportsCoin method")
 //             },
+//             SupportsEIP1559Func: func() bool {
+// 	               panic("mock out the SupportsEIP1559 method")
+//             },
 //             SupportsMultipleAccountsFunc: func() bool {
 // 	               panic("mock out the SupportsMultipleAccounts method")
 //             },
+//             SupportsPaymentsToTaprootFunc: func() bool {
+// 	               panic("mock out the SupportsPaymentsToTaproot method")
+//             },
 //             SupportsUnifiedAccountsFunc: func() bool {
 // 	               panic("mock out the SupportsUnifiedAccounts method")
 //             },
@@ -91,6 +107,9 @@ var _ keystore.Keystore = &KeystoreMock{}
 //
 //     }
 type KeystoreMock struct {
+	// CanSignBIP322MessageFunc mocks the CanSignBIP322Message method.
+	CanSignBIP322MessageFunc func(in1 coin.Code) bool
+
 	// CanSignMessageFunc mocks the CanSignMessage method.
 	CanSignMessageFunc func(in1 coin.Code) bool
 
@@ -112,6 +131,9 @@ type KeystoreMock struct {
 	// SignETHMessageFunc mocks the SignETHMessage method.
 	SignETHMessageFunc func(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
 
+	// SignETHTypedMessageFunc mocks the SignETHTypedMessage method.
+	SignETHTypedMessageFunc func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error)
+
 	// SignTransactionFunc mocks the SignTransaction method.
 	SignTransactionFunc func(in1 interface{}) error
 
@@ -121,9 +143,15 @@ type KeystoreMock struct {
 	// SupportsCoinFunc mocks the SupportsCoin method.
 	SupportsCoinFunc func(coinInstance coin.Coin) bool
 
+	// SupportsEIP1559Func mocks the SupportsEIP1559 method.
+	SupportsEIP1559Func func() bool
+
 	// SupportsMultipleAccountsFunc mocks the SupportsMultipleAccounts method.
 	SupportsMultipleAccountsFunc func() bool
 
+	// SupportsPaymentsToTaprootFunc mocks the SupportsPaymentsToTaproot method.
+	SupportsPaymentsToTaprootFunc func() bool
+
 	// SupportsUnifiedAccountsFunc mocks the SupportsUnifiedAccounts method.
 	SupportsUnifiedAccountsFunc func() bool
 
@@ -138,6 +166,11 @@ type KeystoreMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// CanSignBIP322Message holds details about calls to the CanSignBIP322Message method.
+		CanSignBIP322Message []struct {
+			// In1 is the in1 argument value.
+			In1 coin.Code
+		}
 		// CanSignMessage holds details about calls to the CanSignMessage method.
 		CanSignMessage []struct {
 			// In1 is the in1 argument value.
@@ -177,6 +210,15 @@ type KeystoreMock struct {
 			// Keypath is the keypath argument value.
 			Keypath signing.AbsoluteKeypath
 		}
+		// SignETHTypedMessage holds details about calls to the SignETHTypedMessage method.
+		SignETHTypedMessage []struct {
+			// ChainID is the chainID argument value.
+			ChainID uint64
+			// Data is the data argument value.
+			Data []byte
+			// Keypath is the keypath argument value.
+			Keypath signing.AbsoluteKeypath
+		}
 		// SignTransaction holds details about calls to the SignTransaction method.
 		SignTransaction []struct {
 			// In1 is the in1 argument value.
@@ -194,9 +236,15 @@ type KeystoreMock struct {
 			// CoinInstance is the coinInstance argument value.
 			CoinInstance coin.Coin
 		}
+		// SupportsEIP1559 holds details about calls to the SupportsEIP1559 method.
+		SupportsEIP1559 []struct {
+		}
 		// SupportsMultipleAccounts holds details about calls to the SupportsMultipleAccounts method.
 		SupportsMultipleAccounts []struct {
 		}
+		// SupportsPaymentsToTaproot holds details about calls to the SupportsPaymentsToTaproot method.
+		SupportsPaymentsToTaproot []struct {
+		}
 		// SupportsUnifiedAccounts holds details about calls to the SupportsUnifiedAccounts method.
 		SupportsUnifiedAccounts []struct {
 		}
@@ -220,6 +268,37 @@ type KeystoreMock struct {
 	}
 }
 
+// CanSignBIP322Message calls CanSignBIP322MessageFunc.
+func (mock *KeystoreMock) CanSignBIP322Message(in1 coin.Code) bool {
+	if mock.CanSignBIP322MessageFunc == nil {
+		panic("KeystoreMock.CanSignBIP322MessageFunc: method is nil but Keystore.CanSignBIP322Message was just called")
+	}
+	callInfo := struct {
+		In1 coin.Code
+	}{
+		In1: in1,
+	}
+	lockKeystoreMockCanSignBIP322Message.Lock()
+	mock.calls.CanSignBIP322Message = append(mock.calls.CanSignBIP322Message, callInfo)
+	lockKeystoreMockCanSignBIP322Message.Unlock()
+	return mock.CanSignBIP322MessageFunc(in1)
+}
+
+// CanSignBIP322MessageCalls gets all the calls that were made to CanSignBIP322Message.
+// Check the length with:
+//     len(mockedKeystore.CanSignBIP322MessageCalls())
+func (mock *KeystoreMock) CanSignBIP322MessageCalls() []struct {
+	In1 coin.Code
+} {
+	var calls []struct {
+		In1 coin.Code
+	}
+	lockKeystoreMockCanSignBIP322Message.RLock()
+	calls = mock.calls.CanSignBIP322Message
+	lockKeystoreMockCanSignBIP322Message.RUnlock()
+	return calls
+}
+
 // CanSignMessage calls CanSignMessageFunc.
 func (mock *KeystoreMock) CanSignMessage(in1 coin.Code) bool {
 	if mock.CanSignMessageFunc == nil {
@@ -443,6 +522,45 @@ func (mock *KeystoreMock) SignETHMessageCalls() []struct {
 	return calls
 }
 
+// SignETHTypedMessage calls SignETHTypedMessageFunc.
+func (mock *KeystoreMock) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	if mock.SignETHTypedMessageFunc == nil {
+		panic("KeystoreMock.SignETHTypedMessageFunc: method is nil but Keystore.SignETHTypedMessage was just called")
+	}
+	callInfo := struct {
+		ChainID uint64
+		Data    []byte
+		Keypath signing.AbsoluteKeypath
+	}{
+		ChainID: chainID,
+		Data:    data,
+		Keypath: keypath,
+	}
+	lockKeystoreMockSignETHTypedMessage.Lock()
+	mock.calls.SignETHTypedMessage = append(mock.calls.SignETHTypedMessage, callInfo)
+	lockKeystoreMockSignETHTypedMessage.Unlock()
+	return mock.SignETHTypedMessageFunc(chainID, data, keypath)
+}
+
+// SignETHTypedMessageCalls gets all the calls that were made to SignETHTypedMessage.
+// Check the length with:
+//     len(mockedKeystore.SignETHTypedMessageCalls())
+func (mock *KeystoreMock) SignETHTypedMessageCalls() []struct {
+	ChainID uint64
+	Data    []byte
+	Keypath signing.AbsoluteKeypath
+} {
+	var calls []struct {
+		ChainID uint64
+		Data    []byte
+		Keypath signing.AbsoluteKeypath
+	}
+	lockKeystoreMockSignETHTypedMessage.RLock()
+	calls = mock.calls.SignETHTypedMessage
+	lockKeystoreMockSignETHTypedMessage.RUnlock()
+	return calls
+}
+
 // SignTransaction calls SignTransactionFunc.
 func (mock *KeystoreMock) SignTransaction(in1 interface{}) error {
 	if mock.SignTransactionFunc == nil {
@@ -540,6 +658,32 @@ func (mock *KeystoreMock) SupportsCoinCalls() []struct {
 	return calls
 }
 
+// SupportsEIP1559 calls SupportsEIP1559Func.
+func (mock *KeystoreMock) SupportsEIP1559() bool {
+	if mock.SupportsEIP1559Func == nil {
+		panic("KeystoreMock.SupportsEIP1559Func: method is nil but Keystore.SupportsEIP1559 was just called")
+	}
+	callInfo := struct {
+	}{}
+	lockKeystoreMockSupportsEIP1559.Lock()
+	mock.calls.SupportsEIP1559 = append(mock.calls.SupportsEIP1559, callInfo)
+	lockKeystoreMockSupportsEIP1559.Unlock()
+	return mock.SupportsEIP1559Func()
+}
+
+// SupportsEIP1559Calls gets all the calls that were made to SupportsEIP1559.
+// Check the length with:
+//     len(mockedKeystore.SupportsEIP1559Calls())
+func (mock *KeystoreMock) SupportsEIP1559Calls() []struct {
+} {
+	var calls []struct {
+	}
+	lockKeystoreMockSupportsEIP1559.RLock()
+	calls = mock.calls.SupportsEIP1559
+	lockKeystoreMockSupportsEIP1559.RUnlock()
+	return calls
+}
+
 // SupportsMultipleAccounts calls SupportsMultipleAccountsFunc.
 func (mock *KeystoreMock) SupportsMultipleAccounts() bool {
 	if mock.SupportsMultipleAccountsFunc == nil {
@@ -566,6 +710,32 @@ func (mock *KeystoreMock) SupportsMultipleAccountsCalls() []struct {
 	return calls
 }
 
+// SupportsPaymentsToTaproot calls SupportsPaymentsToTaprootFunc.
+func (mock *KeystoreMock) SupportsPaymentsToTaproot() bool {
+	if mock.SupportsPaymentsToTaprootFunc == nil {
+		panic("KeystoreMock.SupportsPaymentsToTaprootFunc: method is nil but Keystore.SupportsPaymentsToTaproot was just called")
+	}
+	callInfo := struct {
+	}{}
+	lockKeystoreMockSupportsPaymentsToTaproot.Lock()
+	mock.calls.SupportsPaymentsToTaproot = append(mock.calls.SupportsPaymentsToTaproot, callInfo)
+	lockKeystoreMockSupportsPaymentsToTaproot.Unlock()
+	return mock.SupportsPaymentsToTaprootFunc()
+}
+
+// SupportsPaymentsToTaprootCalls gets all the calls that were made to SupportsPaymentsToTaproot.
+// Check the length with:
+//     len(mockedKeystore.SupportsPaymentsToTaprootCalls())
+func (mock *KeystoreMock) SupportsPaymentsToTaprootCalls() []struct {
+} {
+	var calls []struct {
+	}
+	lockKeystoreMockSupportsPaymentsToTaproot.RLock()
+	calls = mock.calls.SupportsPaymentsToTaproot
+	lockKeystoreMockSupportsPaymentsToTaproot.RUnlock()
+	return calls
+}
+
 // SupportsUnifiedAccounts calls SupportsUnifiedAccountsFunc.
 func (mock *KeystoreMock) SupportsUnifiedAccounts() bool {
 	if mock.SupportsUnifiedAccountsFunc == nil {
@@ -16,6 +16,7 @@
 package software
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -25,11 +26,14 @@ import (
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/taproot"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/eip712"
 	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
 	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
 	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -117,6 +121,17 @@ func (keystore *Keystore) SupportsMultipleAccounts() bool {
 	return true
 }
 
+// SupportsEIP1559 implements keystore.Keystore.
+func (keystore *Keystore) SupportsEIP1559() bool {
+	// Ethereum is not supported by the software keystore.
+	return false
+}
+
+// SupportsPaymentsToTaproot implements keystore.Keystore.
+func (keystore *Keystore) SupportsPaymentsToTaproot() bool {
+	return true
+}
+
 // Identifier implements keystore.Keystore.
 func (keystore *Keystore) Identifier() (string, error) {
 	return keystore.identifier, nil
@@ -179,6 +194,27 @@ func (keystore *Keystore) sign(
 	return signatures, nil
 }
 
+// signSchnorr creates a BIP340 signature for a taproot key path spend, using the BIP86 tweaked
+// private key at the given keypath.
+func (keystore *Keystore) signSchnorr(
+	signatureHash []byte,
+	keyPath signing.AbsoluteKeypath,
+) ([]byte, error) {
+	xprv, err := keyPath.Derive(keystore.master)
+	if err != nil {
+		return nil, err
+	}
+	prv, err := xprv.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	auxRand := make([]byte, 32)
+	if _, err := rand.Read(auxRand); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return taproot.Sign(taproot.TweakPrivateKey(prv), signatureHash, auxRand)
+}
+
 // SignTransaction implements keystore.Keystore.
 func (keystore *Keystore) SignTransaction(
 	proposedTransaction interface{},
@@ -190,6 +226,8 @@ func (keystore *Keystore) SignTransaction(
 	keystore.log.Info("Sign transaction.")
 	signatureHashes := [][]byte{}
 	keyPaths := []signing.AbsoluteKeypath{}
+	// Indices of the inputs signed with ECDSA.
+	ecdsaInputs := []int{}
 	transaction := btcProposedTx.TXProposal.Transaction
 	for index, txIn := range transaction.TxIn {
 		spentOutput, ok := btcProposedTx.PreviousOutputs[txIn.PreviousOutPoint]
@@ -197,6 +235,31 @@ func (keystore *Keystore) SignTransaction(
 			keystore.log.Panic("There needs to be exactly one output being spent per input!")
 		}
 		address := btcProposedTx.GetAddress(spentOutput.ScriptHashHex())
+		if address.Configuration.ScriptType() == signing.ScriptTypeP2TR {
+			signatureHash, err := taproot.CalcSigHash(transaction, index, btcProposedTx.PreviousTxOuts())
+			if err != nil {
+				return errp.Wrap(err, "Failed to calculate taproot signature hash")
+			}
+			signature, err := keystore.signSchnorr(signatureHash, address.Configuration.AbsoluteKeypath())
+			if err != nil {
+				return errp.WithMessage(err, "Failed to sign taproot signature hash")
+			}
+			btcProposedTx.SchnorrSignatures[index] = signature
+			continue
+		}
+		keyPath := address.Configuration.AbsoluteKeypath()
+		if address.Configuration.IsMultisig() {
+			rootFingerprint, err := keystore.RootFingerprint()
+			if err != nil {
+				return err
+			}
+			keyInfo := address.Configuration.KeyInfo(rootFingerprint)
+			if keyInfo == nil {
+				// Not a cosigner of this input, leave it to the other cosigners.
+				continue
+			}
+			keyPath = keyInfo.AbsoluteKeypath
+		}
 		isSegwit, subScript := address.ScriptForHashToSign()
 		var signatureHash []byte
 		if isSegwit {
@@ -218,19 +281,20 @@ func (keystore *Keystore) SignTransaction(
 		}
 
 		signatureHashes = append(signatureHashes, signatureHash)
-		keyPaths = append(keyPaths, address.Configuration.AbsoluteKeypath())
+		keyPaths = append(keyPaths, keyPath)
+		ecdsaInputs = append(ecdsaInputs, index)
 	}
 
 	signatures, err := keystore.sign(signatureHashes, keyPaths)
 	if err != nil {
 		return errp.WithMessage(err, "Failed to sign signature hash")
 	}
-	if len(signatures) != len(transaction.TxIn) {
+	if len(signatures) != len(ecdsaInputs) {
 		panic("number of signatures doesn't match number of inputs")
 	}
 	for i, signature := range signatures {
 		signature := signature
-		btcProposedTx.Signatures[i] = &signature
+		btcProposedTx.Signatures[ecdsaInputs[i]] = &signature
 	}
 	return nil
 }
@@ -240,6 +304,11 @@ func (keystore *Keystore) CanSignMessage(coin.Code) bool {
 	return false
 }
 
+// CanSignBIP322Message implements keystore.Keystore.
+func (keystore *Keystore) CanSignBIP322Message(code coin.Code) bool {
+	return code == coin.CodeBTC || code == coin.CodeTBTC || code == coin.CodeRBTC || code == coin.CodeSBTC
+}
+
 // SignBTCMessage implements keystore.Keystore.
 func (keystore *Keystore) SignBTCMessage(message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
 	return nil, errp.New("unsupported")
@@ -249,3 +318,29 @@ func (keystore *Keystore) SignBTCMessage(message []byte, keypath signing.Absolut
 func (keystore *Keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
 	return nil, errp.New("unsupported")
 }
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *Keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	typedData, err := eip712.Parse(data, chainID)
+	if err != nil {
+		return nil, err
+	}
+	sigHash, err := eip712.SigHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	xprv, err := keypath.Derive(keystore.master)
+	if err != nil {
+		return nil, err
+	}
+	prv, err := xprv.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	// The last byte of the signature is the recid.
+	signature, err := crypto.Sign(sigHash, prv.ToECDSA())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return signature, nil
+}
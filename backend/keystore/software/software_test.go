@@ -18,6 +18,9 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth/eip712"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,3 +35,42 @@ func TestRootFingerprint(t *testing.T) {
 	// Verified by comparing to the root fingerprint produced by the BitBox02 and Electrum.
 	require.Equal(t, []byte{0xfb, 0x70, 0x89, 0xbd}, rootFingerprint)
 }
+
+func TestSignETHTypedMessage(t *testing.T) {
+	rootXprv, err := hdkeychain.NewKeyFromString("xprv9s21ZrQH143K3uDh9hiNXB3a9GVzcCujEmCwmZA9g8m4i5nUDVdLHJjsLMPzV26vj8Q7ceGrUhX119Y3XzGhJqq5K6LWP1h6gjv2cbkMEH1")
+	require.NoError(t, err)
+	keystore := NewKeystore(rootXprv)
+	keypath, err := signing.NewAbsoluteKeypath("m/44'/60'/0'/0/0")
+	require.NoError(t, err)
+	data := []byte(`{
+  "types": {
+    "EIP712Domain": [{"name": "name", "type": "string"}, {"name": "chainId", "type": "uint256"}],
+    "Message": [{"name": "contents", "type": "string"}]
+  },
+  "primaryType": "Message",
+  "domain": {"name": "Test", "chainId": 1},
+  "message": {"contents": "Hello"}
+}`)
+
+	_, err = keystore.SignETHTypedMessage(3, data, keypath)
+	require.Error(t, err)
+
+	signature, err := keystore.SignETHTypedMessage(1, data, keypath)
+	require.NoError(t, err)
+	require.Len(t, signature, 65)
+
+	typedData, err := eip712.Parse(data, 1)
+	require.NoError(t, err)
+	sigHash, err := eip712.SigHash(typedData)
+	require.NoError(t, err)
+	recovered, err := crypto.SigToPub(sigHash, signature)
+	require.NoError(t, err)
+	xprv, err := keypath.Derive(rootXprv)
+	require.NoError(t, err)
+	publicKey, err := xprv.ECPubKey()
+	require.NoError(t, err)
+	require.Equal(t,
+		crypto.PubkeyToAddress(*publicKey.ToECDSA()),
+		crypto.PubkeyToAddress(*recovered),
+	)
+}
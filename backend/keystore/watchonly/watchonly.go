@@ -0,0 +1,271 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watchonly provides a keystore without private keys, built from a user-supplied extended
+// public key. It allows following the balance and transactions of an account without having the
+// device holding the keys connected.
+package watchonly
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	keystorePkg "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// ErrWatchOnly is returned when trying to sign with a watch-only keystore.
+var ErrWatchOnly = errors.New("this is a watch-only account, it can't sign")
+
+// xpubVersion describes the version bytes of an extended public key format.
+type xpubVersion struct {
+	// scriptType is the script type implied by the format, or empty if it can be used for any
+	// script type.
+	scriptType signing.ScriptType
+	testnet    bool
+}
+
+// xpubVersions contains the supported extended public key formats, see SLIP-0132.
+var xpubVersions = map[[4]byte]xpubVersion{
+	{0x04, 0x88, 0xb2, 0x1e}: {testnet: false},                                           // xpub
+	{0x04, 0x35, 0x87, 0xcf}: {testnet: true},                                            // tpub
+	{0x04, 0x9d, 0x7c, 0xb2}: {scriptType: signing.ScriptTypeP2WPKHP2SH, testnet: false}, // ypub
+	{0x04, 0x4a, 0x52, 0x62}: {scriptType: signing.ScriptTypeP2WPKHP2SH, testnet: true},  // upub
+	{0x04, 0xb2, 0x47, 0x46}: {scriptType: signing.ScriptTypeP2WPKH, testnet: false},     // zpub
+	{0x04, 0x5f, 0x1c, 0xf6}: {scriptType: signing.ScriptTypeP2WPKH, testnet: true},      // vpub
+}
+
+// parseKeyOrigin splits an extended public key with an optional key origin as in output
+// descriptors, e.g. "[d34db33f/84'/0'/0']xpub...", into the root fingerprint, the keypath and the
+// extended public key. The root fingerprint is nil if there is no key origin.
+func parseKeyOrigin(key string) ([]byte, signing.AbsoluteKeypath, string, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, "[") {
+		return nil, signing.NewEmptyAbsoluteKeypath(), key, nil
+	}
+	end := strings.Index(key, "]")
+	if end == -1 {
+		return nil, nil, "", errp.New("Invalid key origin")
+	}
+	origin := strings.SplitN(key[1:end], "/", 2)
+	rootFingerprint, err := hex.DecodeString(origin[0])
+	if err != nil || len(rootFingerprint) != 4 {
+		return nil, nil, "", errp.New("Invalid root fingerprint in the key origin")
+	}
+	keypath := signing.NewEmptyAbsoluteKeypath()
+	if len(origin) == 2 {
+		// Output descriptors also use "h" for hardened children.
+		keypath, err = signing.NewAbsoluteKeypath("m/" + strings.ReplaceAll(origin[1], "h", "'"))
+		if err != nil {
+			return nil, nil, "", errp.WithMessage(err, "Invalid keypath in the key origin")
+		}
+	}
+	return rootFingerprint, keypath, strings.TrimSpace(key[end+1:]), nil
+}
+
+// NewConfiguration parses an extended public key (xpub, ypub, zpub, tpub, upub, vpub) and returns
+// the signing configuration of a watch-only account for it. If scriptType is empty, it is inferred
+// from the ypub/zpub prefix. Keys of a different network than net are rejected.
+//
+// The key can be prefixed with its origin, e.g. "[d34db33f/84'/0'/0']xpub...", so that PSBTs of
+// the account contain the BIP32 derivations needed by the signer. Without key origin, the keypath
+// is empty and the fingerprint of the key itself serves as the root fingerprint. This is only the
+// actual derivation for root keys, so PSBTs of other keys contain no BIP32 derivations.
+func NewConfiguration(
+	extendedPublicKey string, scriptType signing.ScriptType, net *chaincfg.Params,
+) (*signing.Configuration, error) {
+	rootFingerprint, keypath, extendedPublicKey, err := parseKeyOrigin(extendedPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	xpub, err := hdkeychain.NewKeyFromString(extendedPublicKey)
+	if err != nil {
+		return nil, errp.WithMessage(err, "Invalid extended public key")
+	}
+	if xpub.IsPrivate() {
+		return nil, errp.New("An extended private key was provided, please provide the extended public key")
+	}
+	var versionBytes [4]byte
+	copy(versionBytes[:], xpub.Version())
+	version, ok := xpubVersions[versionBytes]
+	if !ok {
+		return nil, errp.New("Unsupported extended public key format")
+	}
+	// The mainnet parameters of all supported coins use the xpub version bytes.
+	testnet := net.HDPublicKeyID != chaincfg.MainNetParams.HDPublicKeyID
+	if version.testnet != testnet {
+		return nil, errp.Newf("The extended public key is not valid for %s", net.Name)
+	}
+	if version.scriptType != "" {
+		if scriptType == "" {
+			scriptType = version.scriptType
+		} else if scriptType != version.scriptType {
+			return nil, errp.Newf("The extended public key is not valid for script type %s", scriptType)
+		}
+	}
+	switch scriptType {
+	case signing.ScriptTypeP2PKH, signing.ScriptTypeP2WPKHP2SH, signing.ScriptTypeP2WPKH, signing.ScriptTypeP2TR:
+	case "":
+		return nil, errp.New("The script type of the extended public key is required")
+	default:
+		return nil, errp.Newf("Unsupported script type %s", scriptType)
+	}
+	// The internal extended key representation always uses the same version bytes (prefix xpub).
+	xpub.SetNet(&chaincfg.MainNetParams)
+
+	if rootFingerprint != nil {
+		depth := len(keypath.ToUInt32())
+		if depth != int(xpub.Depth()) {
+			return nil, errp.New("The keypath of the key origin does not match the depth of the extended public key")
+		}
+		if depth == 1 && binary.BigEndian.Uint32(rootFingerprint) != xpub.ParentFingerprint() {
+			return nil, errp.New("The root fingerprint of the key origin does not match the extended public key")
+		}
+	} else {
+		publicKey, err := xpub.ECPubKey()
+		if err != nil {
+			return nil, errp.WithStack(err)
+		}
+		rootFingerprint = btcutil.Hash160(publicKey.SerializeCompressed())[:4]
+	}
+	return signing.NewBitcoinConfiguration(
+		scriptType,
+		rootFingerprint,
+		keypath,
+		xpub,
+	), nil
+}
+
+// Keystore is a keystore without private keys. It is built from the signing configuration of a
+// watch-only account (see NewConfiguration()).
+type Keystore struct {
+	configuration *signing.Configuration
+}
+
+// NewKeystore creates a new watch-only keystore for the given account configuration.
+func NewKeystore(configuration *signing.Configuration) *Keystore {
+	return &Keystore{configuration: configuration}
+}
+
+// Type implements keystore.Keystore.
+func (keystore *Keystore) Type() keystorePkg.Type {
+	return keystorePkg.TypeWatchOnly
+}
+
+// RootFingerprint implements keystore.Keystore.
+func (keystore *Keystore) RootFingerprint() ([]byte, error) {
+	return keystore.configuration.BitcoinSimple.KeyInfo.RootFingerprint, nil
+}
+
+// SupportsCoin implements keystore.Keystore.
+func (keystore *Keystore) SupportsCoin(coin coin.Coin) bool {
+	_, ok := coin.(*btc.Coin)
+	return ok
+}
+
+// SupportsAccount implements keystore.Keystore.
+func (keystore *Keystore) SupportsAccount(coin coin.Coin, meta interface{}) bool {
+	if !keystore.SupportsCoin(coin) {
+		return false
+	}
+	return meta.(signing.ScriptType) == keystore.configuration.ScriptType()
+}
+
+// SupportsUnifiedAccounts implements keystore.Keystore.
+func (keystore *Keystore) SupportsUnifiedAccounts() bool {
+	return false
+}
+
+// SupportsMultipleAccounts implements keystore.Keystore.
+func (keystore *Keystore) SupportsMultipleAccounts() bool {
+	return false
+}
+
+// SupportsEIP1559 implements keystore.Keystore.
+func (keystore *Keystore) SupportsEIP1559() bool {
+	return false
+}
+
+// SupportsPaymentsToTaproot implements keystore.Keystore.
+func (keystore *Keystore) SupportsPaymentsToTaproot() bool {
+	// Transactions are exported as PSBTs and signed elsewhere.
+	return true
+}
+
+// CanVerifyAddress implements keystore.Keystore.
+func (keystore *Keystore) CanVerifyAddress(coin.Coin) (bool, bool, error) {
+	return false, false, nil
+}
+
+// VerifyAddress implements keystore.Keystore.
+func (keystore *Keystore) VerifyAddress(*signing.Configuration, coin.Coin) error {
+	return errp.WithStack(ErrWatchOnly)
+}
+
+// CanVerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *Keystore) CanVerifyExtendedPublicKey() bool {
+	return false
+}
+
+// VerifyExtendedPublicKey implements keystore.Keystore.
+func (keystore *Keystore) VerifyExtendedPublicKey(coin.Coin, *signing.Configuration) error {
+	return errp.WithStack(ErrWatchOnly)
+}
+
+// ExtendedPublicKey implements keystore.Keystore. Only non-hardened keypaths relative to the
+// watched extended public key can be derived.
+func (keystore *Keystore) ExtendedPublicKey(
+	coin coin.Coin, absoluteKeypath signing.AbsoluteKeypath,
+) (*hdkeychain.ExtendedKey, error) {
+	return absoluteKeypath.Derive(keystore.configuration.ExtendedPublicKey())
+}
+
+// CanSignMessage implements keystore.Keystore.
+func (keystore *Keystore) CanSignMessage(coin.Code) bool {
+	return false
+}
+
+// CanSignBIP322Message implements keystore.Keystore.
+func (keystore *Keystore) CanSignBIP322Message(coin.Code) bool {
+	return false
+}
+
+// SignBTCMessage implements keystore.Keystore.
+func (keystore *Keystore) SignBTCMessage(
+	message []byte, keypath signing.AbsoluteKeypath, scriptType signing.ScriptType) ([]byte, error) {
+	return nil, errp.WithStack(ErrWatchOnly)
+}
+
+// SignETHMessage implements keystore.Keystore.
+func (keystore *Keystore) SignETHMessage(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.WithStack(ErrWatchOnly)
+}
+
+// SignETHTypedMessage implements keystore.Keystore.
+func (keystore *Keystore) SignETHTypedMessage(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+	return nil, errp.WithStack(ErrWatchOnly)
+}
+
+// SignTransaction implements keystore.Keystore.
+func (keystore *Keystore) SignTransaction(interface{}) error {
+	return errp.WithStack(ErrWatchOnly)
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watchonly
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// BIP84 test vector account xpub, as zpub and as xpub.
+	testZpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	testXpub = "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+)
+
+func TestNewConfiguration(t *testing.T) {
+	// The script type is inferred from the zpub.
+	configuration, err := NewConfiguration(testZpub, "", &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t, signing.ScriptTypeP2WPKH, configuration.ScriptType())
+	require.Equal(t, testXpub, configuration.ExtendedPublicKey().String())
+	require.Equal(t, "m/", configuration.AbsoluteKeypath().Encode())
+
+	configuration2, err := NewConfiguration(" "+testZpub+"\n", signing.ScriptTypeP2WPKH, &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t, configuration.String(), configuration2.String())
+
+	// The zpub prefix does not match the script type.
+	_, err = NewConfiguration(testZpub, signing.ScriptTypeP2PKH, &chaincfg.MainNetParams)
+	require.Error(t, err)
+
+	// A plain xpub requires the script type.
+	_, err = NewConfiguration(testXpub, "", &chaincfg.MainNetParams)
+	require.Error(t, err)
+	configuration, err = NewConfiguration(testXpub, signing.ScriptTypeP2TR, &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t, signing.ScriptTypeP2TR, configuration.ScriptType())
+
+	// Keys of a different network are rejected.
+	_, err = NewConfiguration(testZpub, "", &chaincfg.TestNet3Params)
+	require.Error(t, err)
+	xpub, err := hdkeychain.NewKeyFromString(testXpub)
+	require.NoError(t, err)
+	xpub.SetNet(&chaincfg.TestNet3Params)
+	tpub := xpub.String()
+	_, err = NewConfiguration(tpub, signing.ScriptTypeP2WPKH, &chaincfg.MainNetParams)
+	require.Error(t, err)
+	configuration, err = NewConfiguration(tpub, signing.ScriptTypeP2WPKH, &chaincfg.TestNet3Params)
+	require.NoError(t, err)
+	require.Equal(t, testXpub, configuration.ExtendedPublicKey().String())
+
+	_, err = NewConfiguration("xpub123", signing.ScriptTypeP2WPKH, &chaincfg.MainNetParams)
+	require.Error(t, err)
+	// Private keys are rejected.
+	_, err = NewConfiguration(
+		"xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB",
+		signing.ScriptTypeP2WPKH, &chaincfg.MainNetParams)
+	require.Error(t, err)
+}
+
+func TestNewConfigurationKeyOrigin(t *testing.T) {
+	// Without key origin, the key is treated as the root key.
+	configuration, err := NewConfiguration(testZpub, "", &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	require.Equal(t, "m/", configuration.AbsoluteKeypath().Encode())
+
+	for _, key := range []string{
+		"[73c5da0a/84'/0'/0']" + testZpub,
+		"[73C5DA0A/84h/0h/0h]" + testZpub,
+		" [73c5da0a/84'/0'/0'] " + testZpub + "\n",
+	} {
+		configuration, err := NewConfiguration(key, "", &chaincfg.MainNetParams)
+		require.NoError(t, err, key)
+		require.Equal(t, "m/84'/0'/0'", configuration.AbsoluteKeypath().Encode())
+		require.Equal(t, []byte{0x73, 0xc5, 0xda, 0x0a}, configuration.BitcoinSimple.KeyInfo.RootFingerprint)
+		require.Equal(t, testXpub, configuration.ExtendedPublicKey().String())
+	}
+
+	for _, key := range []string{
+		// Missing closing bracket.
+		"[73c5da0a/84'/0'/0'" + testZpub,
+		// Invalid fingerprint.
+		"[73c5da/84'/0'/0']" + testZpub,
+		"[xyz5da0a/84'/0'/0']" + testZpub,
+		// Invalid keypath.
+		"[73c5da0a/84'/x/0']" + testZpub,
+		// The keypath does not match the depth of the key.
+		"[73c5da0a/84'/0']" + testZpub,
+		"[73c5da0a]" + testZpub,
+	} {
+		_, err := NewConfiguration(key, "", &chaincfg.MainNetParams)
+		require.Error(t, err, key)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	configuration, err := NewConfiguration(testZpub, "", &chaincfg.MainNetParams)
+	require.NoError(t, err)
+	watchOnly := NewKeystore(configuration)
+	require.Equal(t, keystore.TypeWatchOnly, watchOnly.Type())
+
+	keypath, err := signing.NewAbsoluteKeypath("m/0/1")
+	require.NoError(t, err)
+	xpub, err := watchOnly.ExtendedPublicKey(nil, keypath)
+	require.NoError(t, err)
+	expected, err := keypath.Derive(configuration.ExtendedPublicKey())
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), xpub.String())
+
+	// Hardened derivation is not possible from an xpub.
+	keypath, err = signing.NewAbsoluteKeypath("m/0'")
+	require.NoError(t, err)
+	_, err = watchOnly.ExtendedPublicKey(nil, keypath)
+	require.Error(t, err)
+
+	require.Equal(t, ErrWatchOnly, errp.Cause(watchOnly.SignTransaction(nil)))
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/config"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// multisigMaxCosigners is the maximum number of cosigners of a multisig account. This is the
+// limit of standard P2WSH multisig scripts.
+const multisigMaxCosigners = 15
+
+// parseMultisigCosigner parses the extended public key of a cosigner, prefixed by its key origin as
+// in output descriptors, e.g. "[d34db33f/48'/0'/0'/2']xpub...". The key origin is required, as the
+// cosigner's device needs the root fingerprint and keypath to sign. SLIP-0132 prefixes (Zpub,
+// Vpub, ...) are accepted.
+func parseMultisigCosigner(cosigner string) (*signing.KeyInfo, error) {
+	cosigner = strings.TrimSpace(cosigner)
+	end := strings.Index(cosigner, "]")
+	if !strings.HasPrefix(cosigner, "[") || end < 0 {
+		return nil, errp.Newf("Missing key origin ([fingerprint/keypath]): %s", cosigner)
+	}
+	keyOrigin := cosigner[1:end]
+	cosigner = cosigner[end+1:]
+	xpub, err := hdkeychain.NewKeyFromString(cosigner)
+	if err != nil {
+		return nil, errp.WithMessage(err, "Invalid extended public key")
+	}
+	if xpub.IsPrivate() {
+		return nil, errp.New("An extended private key was provided, please provide the extended public key")
+	}
+	// The internal extended key representation always uses the same version bytes (prefix xpub).
+	xpub.SetNet(&chaincfg.MainNetParams)
+
+	elements := strings.SplitN(keyOrigin, "/", 2)
+	rootFingerprint, err := hex.DecodeString(elements[0])
+	if err != nil || len(rootFingerprint) != 4 {
+		return nil, errp.Newf("Invalid root fingerprint in key origin: %s", keyOrigin)
+	}
+	keypath := "m/"
+	if len(elements) == 2 {
+		// Both h and ' are used to denote hardened elements.
+		keypath += strings.ReplaceAll(elements[1], "h", "'")
+	}
+	absoluteKeypath, err := signing.NewAbsoluteKeypath(keypath)
+	if err != nil {
+		return nil, err
+	}
+	return &signing.KeyInfo{
+		RootFingerprint:   rootFingerprint,
+		AbsoluteKeypath:   absoluteKeypath,
+		ExtendedPublicKey: xpub,
+	}, nil
+}
+
+// nextMultisigAccountNumber returns the next free BIP48 account number of the keystore among its
+// multisig accounts of the given coin.
+func nextMultisigAccountNumber(
+	coinCode coinpkg.Code, rootFingerprint []byte, accountsConfig *config.AccountsConfig) (uint16, error) {
+	nextAccountNumber := uint16(0)
+	for _, account := range accountsConfig.Accounts {
+		if coinCode != account.CoinCode || len(account.Configurations) == 0 {
+			continue
+		}
+		keyInfo := account.Configurations[0].KeyInfo(rootFingerprint)
+		if !account.Configurations[0].IsMultisig() || keyInfo == nil {
+			continue
+		}
+		keypath := keyInfo.AbsoluteKeypath.ToUInt32()
+		if len(keypath) != 4 || keypath[2] < hardenedKeystart {
+			continue
+		}
+		if accountNumber := uint16(keypath[2] - hardenedKeystart); accountNumber+1 > nextAccountNumber {
+			nextAccountNumber = accountNumber + 1
+		}
+	}
+	if nextAccountNumber >= accountsHardLimit {
+		return 0, errp.WithStack(ErrAccountLimitReached)
+	}
+	return nextAccountNumber, nil
+}
+
+// CreateAndPersistMultisigAccountConfig adds a threshold-of-n P2WSH multisig account to the
+// accounts database. The keystore contributes its BIP48 key (m/48'/coin'/account'/2'), the
+// cosigners are the extended public keys of the other n-1 cosigners (see
+// parseMultisigCosigner()). `name` is the account name, shown to the user. If empty, a default
+// name will be set.
+//
+// The account code of the newly created account is returned.
+func (backend *Backend) CreateAndPersistMultisigAccountConfig(
+	coinCode coinpkg.Code,
+	name string,
+	threshold uint32,
+	cosigners []string,
+	keystore keystore.Keystore,
+) (accounts.Code, error) {
+	coin, err := backend.Coin(coinCode)
+	if err != nil {
+		return "", err
+	}
+	var bip44Coin uint32
+	switch coinCode {
+	case coinpkg.CodeBTC:
+		bip44Coin = hardenedKeystart
+	case coinpkg.CodeTBTC, coinpkg.CodeRBTC, coinpkg.CodeSBTC:
+		bip44Coin = 1 + hardenedKeystart
+	default:
+		return "", errp.Newf("Multisig accounts are not supported for %s", coinCode)
+	}
+	if !keystore.SupportsAccount(coin, signing.ScriptTypeP2WSH) {
+		return "", errp.New("The keystore does not support multisig accounts")
+	}
+	numCosigners := len(cosigners) + 1
+	if threshold < 1 || int(threshold) > numCosigners || numCosigners > multisigMaxCosigners {
+		return "", errp.Newf("Invalid multisig: %d-of-%d", threshold, numCosigners)
+	}
+	rootFingerprint, err := keystore.RootFingerprint()
+	if err != nil {
+		return "", err
+	}
+	keyInfos := make([]signing.KeyInfo, 0, numCosigners)
+	for _, cosigner := range cosigners {
+		keyInfo, err := parseMultisigCosigner(cosigner)
+		if err != nil {
+			return "", err
+		}
+		for _, other := range keyInfos {
+			if other.ExtendedPublicKey.String() == keyInfo.ExtendedPublicKey.String() {
+				return "", errp.New("The same cosigner was added twice")
+			}
+		}
+		keyInfos = append(keyInfos, *keyInfo)
+	}
+
+	var accountCode accounts.Code
+	err = backend.config.ModifyAccountsConfig(func(accountsConfig *config.AccountsConfig) error {
+		accountNumber, err := nextMultisigAccountNumber(coinCode, rootFingerprint, accountsConfig)
+		if err != nil {
+			return err
+		}
+		keypath := signing.NewAbsoluteKeypathFromUint32(
+			48+hardenedKeystart, bip44Coin, uint32(accountNumber)+hardenedKeystart, 2+hardenedKeystart)
+		extendedPublicKey, err := keystore.ExtendedPublicKey(coin, keypath)
+		if err != nil {
+			return err
+		}
+		for _, other := range keyInfos {
+			if other.ExtendedPublicKey.String() == extendedPublicKey.String() {
+				return errp.New("The same cosigner was added twice")
+			}
+		}
+		ourKeyInfo := signing.KeyInfo{
+			RootFingerprint:   rootFingerprint,
+			AbsoluteKeypath:   keypath,
+			ExtendedPublicKey: extendedPublicKey,
+		}
+		if name == "" {
+			name = fmt.Sprintf("%s %d-of-%d multisig", coin.Name(), threshold, numCosigners)
+			if accountNumber > 0 {
+				name = fmt.Sprintf("%s %d", name, accountNumber+1)
+			}
+		}
+		accountCode = multisigAccountCode(rootFingerprint, coinCode, accountNumber)
+		backend.log.
+			WithField("accountCode", accountCode).
+			WithField("coinCode", coinCode).
+			WithField("multisig", fmt.Sprintf("%d-of-%d", threshold, numCosigners)).
+			Info("Persisting new multisig account config")
+		return backend.persistAccount(config.Account{
+			CoinCode: coinCode,
+			Name:     name,
+			Code:     accountCode,
+			Configurations: signing.Configurations{
+				signing.NewBitcoinMultisigConfiguration(
+					threshold, signing.ScriptTypeP2WSH, append([]signing.KeyInfo{ourKeyInfo}, keyInfos...)),
+			},
+		}, accountsConfig)
+	})
+	if err != nil {
+		return "", err
+	}
+	backend.ReinitializeAccounts()
+	return accountCode, nil
+}
@@ -44,6 +44,7 @@ var (
 		// Useful for testing with testnets.
 		"tbtc": "bitcoin",
 		"rbtc": "bitcoin",
+		"sbtc": "bitcoin",
 		"tltc": "litecoin",
 		"teth": "ethereum",
 		"reth": "ethereum",
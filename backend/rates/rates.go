@@ -286,7 +286,7 @@ func (updater *RateUpdater) updateLast(ctx context.Context) {
 	}
 
 	// Provide conversion rates for testnets as well, useful for testing.
-	for _, testnetUnit := range []string{"TBTC", "RBTC", "TLTC", "TETH", "RETH"} {
+	for _, testnetUnit := range []string{"TBTC", "RBTC", "SBTC", "TLTC", "TETH", "RETH"} {
 		rates[testnetUnit] = rates[testnetUnit[1:]]
 	}
 
@@ -20,6 +20,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil/hdkeychain"
@@ -80,6 +81,14 @@ type BitcoinSimple struct {
 	ScriptType ScriptType `json:"scriptType"`
 }
 
+// BitcoinMultisig represents a m-of-n multisig Bitcoin signing configuration. The cosigners are
+// identified by their account-level key infos.
+type BitcoinMultisig struct {
+	Threshold  uint32     `json:"threshold"`
+	ScriptType ScriptType `json:"scriptType"`
+	KeyInfos   []KeyInfo  `json:"keyInfos"`
+}
+
 // EthereumSimple represents a simple (standard single-sig, no exotic signing methods) Ethereum
 // signing configuration.
 type EthereumSimple struct {
@@ -90,8 +99,9 @@ type EthereumSimple struct {
 type Configuration struct {
 	// Poor man's union type: only one of the below can be non-nil.
 
-	BitcoinSimple  *BitcoinSimple  `json:"bitcoinSimple,omitempty"`
-	EthereumSimple *EthereumSimple `json:"ethereumSimple,omitempty"`
+	BitcoinSimple   *BitcoinSimple   `json:"bitcoinSimple,omitempty"`
+	BitcoinMultisig *BitcoinMultisig `json:"bitcoinMultisig,omitempty"`
+	EthereumSimple  *EthereumSimple  `json:"ethereumSimple,omitempty"`
 }
 
 // NewBitcoinConfiguration creates a new configuration.
@@ -116,6 +126,27 @@ func NewBitcoinConfiguration(
 	}
 }
 
+// NewBitcoinMultisigConfiguration creates a new multisig configuration. All key infos must
+// contain extended public keys.
+func NewBitcoinMultisigConfiguration(
+	threshold uint32,
+	scriptType ScriptType,
+	keyInfos []KeyInfo,
+) *Configuration {
+	for _, keyInfo := range keyInfos {
+		if keyInfo.ExtendedPublicKey.IsPrivate() {
+			panic("An extended key is private! Only extended public keys are accepted.")
+		}
+	}
+	return &Configuration{
+		BitcoinMultisig: &BitcoinMultisig{
+			Threshold:  threshold,
+			ScriptType: scriptType,
+			KeyInfos:   keyInfos,
+		},
+	}
+}
+
 // NewEthereumConfiguration creates a new configuration.
 func NewEthereumConfiguration(
 	rootFingerprint []byte,
@@ -138,31 +169,68 @@ func NewEthereumConfiguration(
 
 // ScriptType returns the configuration's keypath.
 func (configuration *Configuration) ScriptType() ScriptType {
+	if configuration.BitcoinMultisig != nil {
+		return configuration.BitcoinMultisig.ScriptType
+	}
 	return configuration.BitcoinSimple.ScriptType
 }
 
-// AbsoluteKeypath returns the configuration's keypath.
-func (configuration *Configuration) AbsoluteKeypath() AbsoluteKeypath {
-	if configuration.BitcoinSimple != nil {
-		return configuration.BitcoinSimple.KeyInfo.AbsoluteKeypath
+// IsMultisig returns true if this is a multisig configuration.
+func (configuration *Configuration) IsMultisig() bool {
+	return configuration.BitcoinMultisig != nil
+}
+
+// KeyInfos returns the key infos of all signers. For single-sig configurations, this contains
+// exactly one element.
+func (configuration *Configuration) KeyInfos() []KeyInfo {
+	switch {
+	case configuration.BitcoinSimple != nil:
+		return []KeyInfo{configuration.BitcoinSimple.KeyInfo}
+	case configuration.BitcoinMultisig != nil:
+		return configuration.BitcoinMultisig.KeyInfos
+	default:
+		return []KeyInfo{configuration.EthereumSimple.KeyInfo}
 	}
-	return configuration.EthereumSimple.KeyInfo.AbsoluteKeypath
 }
 
-// ExtendedPublicKey returns the configuration's extended public key.
-func (configuration *Configuration) ExtendedPublicKey() *hdkeychain.ExtendedKey {
-	if configuration.BitcoinSimple != nil {
-		return configuration.BitcoinSimple.KeyInfo.ExtendedPublicKey
+// KeyInfo returns the key info of the signer with the given root fingerprint, or nil if the
+// keystore with this root fingerprint is not a signer of this configuration.
+func (configuration *Configuration) KeyInfo(rootFingerprint []byte) *KeyInfo {
+	for _, keyInfo := range configuration.KeyInfos() {
+		if bytes.Equal(keyInfo.RootFingerprint, rootFingerprint) {
+			keyInfo := keyInfo
+			return &keyInfo
+		}
 	}
-	return configuration.EthereumSimple.KeyInfo.ExtendedPublicKey
+	return nil
+}
+
+// AbsoluteKeypath returns the configuration's keypath. For multisig configurations, the keypath
+// of the first cosigner is returned. Use KeyInfo() to get the keypath of a specific cosigner.
+func (configuration *Configuration) AbsoluteKeypath() AbsoluteKeypath {
+	return configuration.KeyInfos()[0].AbsoluteKeypath
+}
+
+// ExtendedPublicKey returns the configuration's extended public key. For multisig configurations,
+// the extended public key of the first cosigner is returned.
+func (configuration *Configuration) ExtendedPublicKey() *hdkeychain.ExtendedKey {
+	return configuration.KeyInfos()[0].ExtendedPublicKey
 }
 
 // AccountNumber returns the account number as present in the BIP44 keypath.
 // The configuration keypath must be a BIP44 keypath:
 // m/purpose'/coin'/account' for Bitcoin-based coins.
+// m/48'/coin'/account'/script_type' for Bitcoin multisig (BIP48), using the first cosigner.
 // m/44'/coin'/0'/0/account for Ethereum.
 // For invalid keypaths, zero is returned for the account number, along with an error.
 func (configuration *Configuration) AccountNumber() (uint16, error) {
+	if configuration.BitcoinMultisig != nil {
+		keypath := configuration.AbsoluteKeypath().ToUInt32()
+		if len(keypath) != 4 || keypath[2] < hdkeychain.HardenedKeyStart {
+			return 0, errp.Newf("unexpected bitcoin multisig keypath: %v", keypath)
+		}
+		return uint16(keypath[2] - hdkeychain.HardenedKeyStart), nil
+	}
 	if configuration.BitcoinSimple != nil {
 		keypath := configuration.BitcoinSimple.KeyInfo.AbsoluteKeypath.ToUInt32()
 		if len(keypath) != 3 || keypath[2] < hdkeychain.HardenedKeyStart {
@@ -189,8 +257,40 @@ func (configuration *Configuration) PublicKey() *btcec.PublicKey {
 	return publicKey
 }
 
+// PublicKeys returns the public keys of all signers, in the order of the key infos.
+func (configuration *Configuration) PublicKeys() []*btcec.PublicKey {
+	keyInfos := configuration.KeyInfos()
+	publicKeys := make([]*btcec.PublicKey, len(keyInfos))
+	for i, keyInfo := range keyInfos {
+		publicKey, err := keyInfo.ExtendedPublicKey.ECPubKey()
+		if err != nil {
+			panic("Failed to convert an extended public key to a normal public key.")
+		}
+		publicKeys[i] = publicKey
+	}
+	return publicKeys
+}
+
 // Derive derives a subkeypath from the configuration's base absolute keypath.
 func (configuration *Configuration) Derive(relativeKeypath RelativeKeypath) (*Configuration, error) {
+	if multisig := configuration.BitcoinMultisig; multisig != nil {
+		if relativeKeypath.Hardened() {
+			return nil, errp.New("A configuration can only be derived with a non-hardened relative keypath.")
+		}
+		keyInfos := make([]KeyInfo, len(multisig.KeyInfos))
+		for i, keyInfo := range multisig.KeyInfos {
+			derivedPublicKey, err := relativeKeypath.Derive(keyInfo.ExtendedPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			keyInfos[i] = KeyInfo{
+				RootFingerprint:   keyInfo.RootFingerprint,
+				AbsoluteKeypath:   keyInfo.AbsoluteKeypath.Append(relativeKeypath),
+				ExtendedPublicKey: derivedPublicKey,
+			}
+		}
+		return NewBitcoinMultisigConfiguration(multisig.Threshold, multisig.ScriptType, keyInfos), nil
+	}
 	btc := configuration.BitcoinSimple
 	if btc != nil {
 		if relativeKeypath.Hardened() {
@@ -214,6 +314,14 @@ func (configuration *Configuration) Derive(relativeKeypath RelativeKeypath) (*Co
 
 // String returns a short summary of the configuration to be used in logs, etc.
 func (configuration *Configuration) String() string {
+	if multisig := configuration.BitcoinMultisig; multisig != nil {
+		keyInfos := make([]string, len(multisig.KeyInfos))
+		for i, keyInfo := range multisig.KeyInfos {
+			keyInfos[i] = keyInfo.String()
+		}
+		return fmt.Sprintf("bitcoinMultisig;threshold=%d;scriptType=%s;%s",
+			multisig.Threshold, multisig.ScriptType, strings.Join(keyInfos, ";"))
+	}
 	if configuration.BitcoinSimple != nil {
 		return fmt.Sprintf("bitcoinSimple;scriptType=%s;%s",
 			configuration.BitcoinSimple.ScriptType, configuration.BitcoinSimple.KeyInfo)
@@ -227,15 +335,8 @@ type Configurations []*Configuration
 // ContainsRootFingerprint returns true if the rootFingerprint is present in one of the configurations.
 func (configs Configurations) ContainsRootFingerprint(rootFingerprint []byte) bool {
 	for _, config := range configs {
-		if config.BitcoinSimple != nil {
-			if bytes.Equal(config.BitcoinSimple.KeyInfo.RootFingerprint, rootFingerprint) {
-				return true
-			}
-		}
-		if config.EthereumSimple != nil {
-			if bytes.Equal(config.EthereumSimple.KeyInfo.RootFingerprint, rootFingerprint) {
-				return true
-			}
+		if config.KeyInfo(rootFingerprint) != nil {
+			return true
 		}
 	}
 	return false
@@ -148,3 +148,50 @@ func TestAccountNumber(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, uint16(0), num)
 }
+
+func TestBitcoinMultisig(t *testing.T) {
+	newXPub := func(seedByte byte) *hdkeychain.ExtendedKey {
+		seed := make([]byte, 32)
+		seed[0] = seedByte
+		xprv, err := hdkeychain.NewMaster(seed, &chaincfg.TestNet3Params)
+		require.NoError(t, err)
+		xpub, err := xprv.Neuter()
+		require.NoError(t, err)
+		return xpub
+	}
+	keyInfos := []KeyInfo{
+		{RootFingerprint: []byte{1, 1, 1, 1}, AbsoluteKeypath: mustKeypath("m/48'/1'/3'/2'"), ExtendedPublicKey: newXPub(1)},
+		{RootFingerprint: []byte{2, 2, 2, 2}, AbsoluteKeypath: mustKeypath("m/48'/1'/0'/2'"), ExtendedPublicKey: newXPub(2)},
+	}
+	cfg := NewBitcoinMultisigConfiguration(2, ScriptTypeP2WSH, keyInfos)
+	require.True(t, cfg.IsMultisig())
+	require.Equal(t, ScriptTypeP2WSH, cfg.ScriptType())
+	require.Len(t, cfg.KeyInfos(), 2)
+	require.Len(t, cfg.PublicKeys(), 2)
+	require.Nil(t, cfg.KeyInfo([]byte{3, 3, 3, 3}))
+	require.Equal(t, "m/48'/1'/0'/2'", cfg.KeyInfo([]byte{2, 2, 2, 2}).AbsoluteKeypath.Encode())
+	require.True(t, Configurations{cfg}.ContainsRootFingerprint([]byte{2, 2, 2, 2}))
+	require.Equal(t, -1, Configurations{cfg}.FindScriptType(ScriptTypeP2WSH))
+
+	num, err := cfg.AccountNumber()
+	require.NoError(t, err)
+	require.Equal(t, uint16(3), num)
+
+	// All cosigner keys are derived.
+	derived, err := cfg.Derive(NewEmptyRelativeKeypath().Child(0, NonHardened).Child(5, NonHardened))
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), derived.BitcoinMultisig.Threshold)
+	for i, keyInfo := range derived.KeyInfos() {
+		require.Equal(t, keyInfos[i].AbsoluteKeypath.Encode()+"/0/5", keyInfo.AbsoluteKeypath.Encode())
+		require.Equal(t, keyInfos[i].RootFingerprint, keyInfo.RootFingerprint)
+	}
+	_, err = cfg.Derive(NewEmptyRelativeKeypath().Child(0, Hardened))
+	require.Error(t, err)
+
+	jsonBytes, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	var cfgDecoded Configuration
+	require.NoError(t, json.Unmarshal(jsonBytes, &cfgDecoded))
+	require.Nil(t, cfgDecoded.BitcoinSimple)
+	require.Equal(t, cfg.String(), cfgDecoded.String())
+}
@@ -28,6 +28,13 @@ const (
 
 	// ScriptTypeP2WPKH is a segwit PayToPubKeyHash output.
 	ScriptTypeP2WPKH ScriptType = "p2wpkh"
+
+	// ScriptTypeP2TR is a taproot output, spendable by the key path only (BIP86).
+	ScriptTypeP2TR ScriptType = "p2tr"
+
+	// ScriptTypeP2WSH is a segwit multisig output. The witness script is a m-of-n
+	// OP_CHECKMULTISIG script with the public keys sorted lexicographically (BIP67).
+	ScriptTypeP2WSH ScriptType = "p2wsh"
 )
 
 // DecodeScriptType decodes the given script type or returns an error.
@@ -39,6 +46,10 @@ func DecodeScriptType(scriptType string) (ScriptType, error) {
 		return ScriptTypeP2WPKHP2SH, nil
 	case "p2wpkh":
 		return ScriptTypeP2WPKH, nil
+	case "p2tr":
+		return ScriptTypeP2TR, nil
+	case "p2wsh":
+		return ScriptTypeP2WSH, nil
 	default:
 		return "", errp.Newf("The given script type %s is unknown.", scriptType)
 	}
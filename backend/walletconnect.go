@@ -0,0 +1,680 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/eth"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/observable/action"
+	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gorilla/websocket"
+)
+
+// walletConnectPeerMeta describes the app to the dapps.
+var walletConnectPeerMeta = &walletconnect.PeerMeta{
+	Name:        "BitBoxApp",
+	Description: "BitBoxApp by Shift Crypto",
+	URL:         "https://shiftcrypto.ch/app",
+	Icons:       []string{},
+}
+
+// JSON-RPC error codes returned to dapps, see EIP-1193 and https://www.jsonrpc.org/specification.
+const (
+	walletConnectErrorUserRejected  = 4001
+	walletConnectErrorUnauthorized  = 4100
+	walletConnectErrorUnsupported   = 4200
+	walletConnectErrorInvalidParams = -32602
+	walletConnectErrorInternal      = -32603
+)
+
+// walletConnectState is the current state of the WalletConnect subsystem. See the values below.
+type walletConnectState string
+
+const (
+	// Something went wrong. The frontend is to display an error message based on the `ErrorCode`.
+	walletConnectStateError walletConnectState = "error"
+
+	// Nothing is happening. Connected dapps can send requests.
+	walletConnectStateInactive walletConnectState = "inactive"
+	// A pairing URI was handled, we are connecting to the relay and waiting for the session request
+	// of the dapp.
+	walletConnectStateConnecting walletConnectState = "connecting"
+	// The user is prompted to approve or reject the session request, choosing the account to
+	// connect to the dapp.
+	walletConnectStateSessionApproval walletConnectState = "session-approval"
+	// The user is prompted to approve or reject a request of a connected dapp.
+	walletConnectStateRequestApproval walletConnectState = "request-approval"
+	// The user is prompted to confirm the request on the device.
+	walletConnectStateSigning walletConnectState = "signing"
+	// The request was processed and the result was delivered to the dapp.
+	walletConnectStateSuccess walletConnectState = "success"
+)
+
+// WalletConnectRequest is a request of a connected dapp, decoded for display.
+type WalletConnectRequest struct {
+	// Method is the JSON-RPC method, e.g. "personal_sign".
+	Method string `json:"method"`
+	// Message is the message to sign for "personal_sign". Shown as hex if it is not valid UTF-8.
+	Message string `json:"message,omitempty"`
+	// TypedData is the JSON encoded EIP-712 typed data for "eth_signTypedData(_v4)".
+	TypedData string `json:"typedData,omitempty"`
+	// Recipient, Amount and Data describe the transaction of "eth_sendTransaction". The amount is
+	// formatted in the unit of the coin.
+	Recipient string `json:"recipient,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	session *walletConnectSession
+	id      uint64
+	message []byte
+	data    []byte
+}
+
+// WalletConnect is the state of the WalletConnect subsystem, i.e. the pairing or request the user
+// is asked to approve.
+type WalletConnect struct {
+	// State is the current state. See `walletConnectState*` for the possible values.
+	State walletConnectState `json:"state"`
+	// ErrorCode is a "walletConnect*" error code, see errors.go. Only applies if State ==
+	// walletConnectStateError.
+	ErrorCode ErrorCode `json:"errorCode"`
+	// Peer describes the dapp which requests the session or sent the request. Applies to the
+	// session and request states.
+	Peer *walletconnect.PeerMeta `json:"peer"`
+	// Accounts is the list of accounts the user can choose from. Only applies if State ==
+	// walletConnectStateSessionApproval.
+	Accounts []account `json:"accounts"`
+	// AccountCode is the account connected to the dapp which sent the request. Applies to the
+	// request states.
+	AccountCode accounts.Code `json:"accountCode"`
+	// Request is the request to approve. Applies to the request states.
+	Request *WalletConnectRequest `json:"request"`
+	// Result is the signature or transaction ID delivered to the dapp. Only applies if State ==
+	// walletConnectStateSuccess.
+	Result string `json:"result"`
+}
+
+// WalletConnectSession describes a connected dapp.
+type WalletConnectSession struct {
+	// ClientID uniquely identifies the session.
+	ClientID    string                  `json:"clientID"`
+	Peer        *walletconnect.PeerMeta `json:"peer"`
+	AccountCode accounts.Code           `json:"accountCode"`
+}
+
+type walletConnectSession struct {
+	session *walletconnect.Session
+	// sessionRequestID is the ID of the session request. Zero until the session request arrived.
+	sessionRequestID uint64
+	// accountCode is the account connected to the dapp. Empty until the session is approved.
+	accountCode accounts.Code
+}
+
+// walletConnect holds the state needed to process WalletConnect pairings and requests. Sessions
+// live in memory only, dapps have to pair again after a restart.
+type walletConnect struct {
+	state WalletConnect
+	// pairing is the session being paired. Only applies if state.State is
+	// walletConnectStateConnecting or walletConnectStateSessionApproval.
+	pairing *walletConnectSession
+	// sessions are the approved sessions by client ID.
+	sessions map[string]*walletConnectSession
+	// queue holds the requests waiting to be shown to the user, in the order they arrived.
+	queue []*WalletConnectRequest
+}
+
+func newWalletConnect() walletConnect {
+	return walletConnect{
+		state:    WalletConnect{State: walletConnectStateInactive},
+		sessions: map[string]*walletConnectSession{},
+	}
+}
+
+// WalletConnect returns the current WalletConnect state.
+func (backend *Backend) WalletConnect() WalletConnect {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	return backend.walletConnect.state
+}
+
+// WalletConnectSessions returns the connected dapps.
+func (backend *Backend) WalletConnectSessions() []WalletConnectSession {
+	defer backend.accountsAndKeystoreLock.RLock()()
+	sessions := []WalletConnectSession{}
+	for clientID, session := range backend.walletConnect.sessions {
+		sessions = append(sessions, WalletConnectSession{
+			ClientID:    clientID,
+			Peer:        session.session.PeerMeta(),
+			AccountCode: session.accountCode,
+		})
+	}
+	return sessions
+}
+
+// notifyWalletConnect sends the WalletConnect state to the frontend. `accountsAndKeystoreLock` must
+// be held when calling this function.
+func (backend *Backend) notifyWalletConnect() {
+	backend.Notify(observable.Event{
+		Subject: "walletconnect",
+		Action:  action.Replace,
+		Object:  backend.walletConnect.state,
+	})
+}
+
+// notifyWalletConnectSessions tells the frontend to reload the list of connected dapps.
+func (backend *Backend) notifyWalletConnectSessions() {
+	backend.Notify(observable.Event{
+		Subject: "walletconnect/sessions",
+		Action:  action.Reload,
+	})
+}
+
+// walletConnectSetError pushes an error to the frontend to display. `accountsAndKeystoreLock` must
+// be held when calling this function.
+func (backend *Backend) walletConnectSetError(err ErrorCode) {
+	backend.walletConnect.state = WalletConnect{State: walletConnectStateError, ErrorCode: err}
+	backend.notifyWalletConnect()
+}
+
+// walletConnectClosePairing rejects and closes the session being paired, if any.
+// `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) walletConnectClosePairing() {
+	pairing := backend.walletConnect.pairing
+	if pairing == nil {
+		return
+	}
+	backend.walletConnect.pairing = nil
+	if pairing.sessionRequestID != 0 {
+		if err := pairing.session.RespondError(
+			pairing.sessionRequestID, walletConnectErrorUserRejected, "Session rejected"); err != nil {
+			backend.log.WithError(err).Error("walletconnect: could not reject the session")
+		}
+	}
+	pairing.session.Close()
+}
+
+// walletConnectProcessQueue moves on to the next queued request if no other pairing or request is
+// in progress. The caller is responsible to notify the frontend. `accountsAndKeystoreLock` must be
+// held when calling this function.
+func (backend *Backend) walletConnectProcessQueue() {
+	wc := &backend.walletConnect
+	if wc.state.State != walletConnectStateInactive || len(wc.queue) == 0 {
+		return
+	}
+	request := wc.queue[0]
+	wc.queue = wc.queue[1:]
+	wc.state = WalletConnect{
+		State:       walletConnectStateRequestApproval,
+		Peer:        request.session.session.PeerMeta(),
+		AccountCode: request.session.accountCode,
+		Request:     request,
+	}
+}
+
+// handleWalletConnect handles a WalletConnect pairing URI, e.g. `wc:<topic>@1?bridge=...&key=...`.
+func (backend *Backend) handleWalletConnect(uri string) {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	wc := &backend.walletConnect
+
+	// A request shown to the user is shown again after the pairing.
+	if wc.state.State == walletConnectStateRequestApproval {
+		wc.queue = append([]*WalletConnectRequest{wc.state.Request}, wc.queue...)
+	}
+	backend.walletConnectClosePairing()
+
+	parsedURI, err := walletconnect.ParseURI(uri)
+	if err != nil {
+		// Not logging the URI, as it contains the key of the session.
+		backend.log.WithError(err).Error("walletconnect: invalid pairing URI")
+		backend.walletConnectSetError(errWalletConnectInvalidURI)
+		return
+	}
+	wc.state = WalletConnect{State: walletConnectStateConnecting}
+	backend.notifyWalletConnect()
+
+	dialer := &websocket.Dialer{
+		NetDial:          backend.socksProxy.GetTCPProxyDialer().Dial,
+		HandshakeTimeout: 30 * time.Second,
+	}
+	session, err := walletconnect.Dial(
+		parsedURI,
+		dialer,
+		backend.walletConnectOnRequest,
+		backend.walletConnectOnClose,
+		backend.log,
+	)
+	if err != nil {
+		backend.log.WithError(err).Error("walletconnect: could not connect to the relay")
+		backend.walletConnectSetError(errWalletConnectConnection)
+		return
+	}
+	wc.pairing = &walletConnectSession{session: session}
+}
+
+// walletConnectAccounts returns the accounts which can be connected to a dapp.
+// `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) walletConnectAccounts() []account {
+	result := []account{}
+	for _, acct := range backend.accounts {
+		if !acct.Config().Active {
+			continue
+		}
+		ethCoin, ok := acct.Coin().(*eth.Coin)
+		if !ok || ethCoin.ERC20Token() != nil {
+			continue
+		}
+		result = append(result, account{Name: acct.Config().Name, Code: acct.Config().Code})
+	}
+	return result
+}
+
+// walletConnectAccount returns the initialized account with the given code.
+// `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) walletConnectAccount(code accounts.Code) (*eth.Account, error) {
+	for _, acct := range backend.accounts {
+		if acct.Config().Code != code || !acct.Config().Active {
+			continue
+		}
+		ethAccount, ok := acct.(*eth.Account)
+		if !ok {
+			break
+		}
+		if err := ethAccount.Initialize(); err != nil {
+			return nil, err
+		}
+		return ethAccount, nil
+	}
+	return nil, errp.Newf("account %s not found", code)
+}
+
+// walletConnectOnRequest is called for all requests of the dapps, from the goroutine reading the
+// connection to the relay.
+func (backend *Backend) walletConnectOnRequest(session *walletconnect.Session, request *walletconnect.Request) {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	wc := &backend.walletConnect
+	log := backend.log.WithField("walletconnect-client-id", session.ClientID())
+
+	if request.Method == walletconnect.MethodSessionRequest {
+		if wc.pairing == nil || wc.pairing.session != session ||
+			wc.state.State != walletConnectStateConnecting {
+			log.Error("walletconnect: unexpected session request")
+			return
+		}
+		wc.pairing.sessionRequestID = request.ID
+		accounts := backend.walletConnectAccounts()
+		if len(accounts) == 0 {
+			backend.walletConnectClosePairing()
+			backend.walletConnectSetError(errWalletConnectNoAccounts)
+			return
+		}
+		wc.state = WalletConnect{
+			State:    walletConnectStateSessionApproval,
+			Peer:     session.PeerMeta(),
+			Accounts: accounts,
+		}
+		backend.notifyWalletConnect()
+		return
+	}
+
+	connected, ok := wc.sessions[session.ClientID()]
+	if !ok {
+		if err := session.RespondError(
+			request.ID, walletConnectErrorUnauthorized, "Session not approved"); err != nil {
+			log.WithError(err).Error("walletconnect: could not respond")
+		}
+		return
+	}
+	decoded, responseErr := backend.walletConnectDecodeRequest(connected, request)
+	if responseErr != nil {
+		log.WithField("method", request.Method).Errorf("walletconnect: %s", responseErr.Message)
+		if err := session.RespondError(request.ID, responseErr.Code, responseErr.Message); err != nil {
+			log.WithError(err).Error("walletconnect: could not respond")
+		}
+		return
+	}
+	wc.queue = append(wc.queue, decoded)
+	if wc.state.State == walletConnectStateInactive {
+		backend.walletConnectProcessQueue()
+		backend.notifyWalletConnect()
+	}
+}
+
+// walletConnectDecodeRequest validates and decodes a request of a connected dapp.
+// `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) walletConnectDecodeRequest(
+	session *walletConnectSession,
+	request *walletconnect.Request,
+) (*WalletConnectRequest, *walletconnect.ResponseError) {
+	invalidParams := func(message string) *walletconnect.ResponseError {
+		return &walletconnect.ResponseError{Code: walletConnectErrorInvalidParams, Message: message}
+	}
+	account, err := backend.walletConnectAccount(session.accountCode)
+	if err != nil {
+		return nil, &walletconnect.ResponseError{Code: walletConnectErrorInternal, Message: err.Error()}
+	}
+	address := account.GetUnusedReceiveAddresses()[0][0].EncodeForHumans()
+	isAccountAddress := func(addr string) bool {
+		return strings.EqualFold(addr, address)
+	}
+	var params []json.RawMessage
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		return nil, invalidParams("params must be an array")
+	}
+	decoded := &WalletConnectRequest{
+		Method:  request.Method,
+		session: session,
+		id:      request.ID,
+	}
+	switch request.Method {
+	case "personal_sign":
+		var message, addr string
+		if len(params) < 2 ||
+			json.Unmarshal(params[0], &message) != nil ||
+			json.Unmarshal(params[1], &addr) != nil {
+			return nil, invalidParams("expected the message and the address")
+		}
+		// Some dapps pass the params in the order of `eth_sign`.
+		if common.IsHexAddress(message) && !common.IsHexAddress(addr) {
+			message, addr = addr, message
+		}
+		if !isAccountAddress(addr) {
+			return nil, invalidParams("unknown address")
+		}
+		decoded.message, err = hexutil.Decode(message)
+		if err != nil {
+			decoded.message = []byte(message)
+		}
+		if utf8.Valid(decoded.message) {
+			decoded.Message = string(decoded.message)
+		} else {
+			decoded.Message = hexutil.Encode(decoded.message)
+		}
+	case "eth_signTypedData", "eth_signTypedData_v4":
+		var addr string
+		if len(params) < 2 || json.Unmarshal(params[0], &addr) != nil {
+			return nil, invalidParams("expected the address and the typed data")
+		}
+		if !isAccountAddress(addr) {
+			return nil, invalidParams("unknown address")
+		}
+		// The typed data is usually passed as a JSON string, but some dapps pass the object.
+		var typedData string
+		if json.Unmarshal(params[1], &typedData) != nil {
+			typedData = string(params[1])
+		}
+		decoded.data = []byte(typedData)
+		decoded.TypedData = typedData
+	case "eth_sendTransaction":
+		var tx struct {
+			From  string         `json:"from"`
+			To    *string        `json:"to"`
+			Value *hexutil.Big   `json:"value"`
+			Data  *hexutil.Bytes `json:"data"`
+		}
+		if len(params) < 1 || json.Unmarshal(params[0], &tx) != nil {
+			return nil, invalidParams("expected the transaction")
+		}
+		if !isAccountAddress(tx.From) {
+			return nil, invalidParams("unknown address")
+		}
+		if tx.To == nil || *tx.To == "" {
+			return nil, &walletconnect.ResponseError{
+				Code: walletConnectErrorUnsupported, Message: "Contract creation is not supported"}
+		}
+		value := new(big.Int)
+		if tx.Value != nil {
+			value = tx.Value.ToInt()
+		}
+		if tx.Data != nil {
+			decoded.data = *tx.Data
+			decoded.Data = hex.EncodeToString(decoded.data)
+		}
+		decoded.Recipient = *tx.To
+		decoded.Amount = account.Coin().FormatAmount(coinpkg.NewAmount(value), false)
+	default:
+		return nil, &walletconnect.ResponseError{
+			Code: walletConnectErrorUnsupported, Message: "Method not supported"}
+	}
+	return decoded, nil
+}
+
+// walletConnectOnClose is called when a session ended. It can be called with
+// `accountsAndKeystoreLock` held, so the state is updated in a new goroutine.
+func (backend *Backend) walletConnectOnClose(session *walletconnect.Session) {
+	go func() {
+		defer backend.accountsAndKeystoreLock.Lock()()
+		wc := &backend.walletConnect
+		if wc.pairing != nil && wc.pairing.session == session {
+			wc.pairing = nil
+			backend.walletConnectSetError(errWalletConnectConnection)
+			return
+		}
+		if _, ok := wc.sessions[session.ClientID()]; !ok {
+			return
+		}
+		backend.walletConnectRemoveSession(session.ClientID())
+		backend.notifyWalletConnect()
+	}()
+}
+
+// walletConnectRemoveSession forgets the session and drops its pending requests. The caller is
+// responsible to notify the frontend of the state. `accountsAndKeystoreLock` must be held when
+// calling this function.
+func (backend *Backend) walletConnectRemoveSession(clientID string) {
+	wc := &backend.walletConnect
+	delete(wc.sessions, clientID)
+	queue := []*WalletConnectRequest{}
+	for _, request := range wc.queue {
+		if request.session.session.ClientID() != clientID {
+			queue = append(queue, request)
+		}
+	}
+	wc.queue = queue
+	if wc.state.State == walletConnectStateRequestApproval &&
+		wc.state.Request.session.session.ClientID() == clientID {
+		wc.state = WalletConnect{State: walletConnectStateInactive}
+		backend.walletConnectProcessQueue()
+	}
+	backend.notifyWalletConnectSessions()
+}
+
+// WalletConnectCancel rejects the current pairing or request, or dismisses the success or error
+// state, and moves on to the next queued request.
+func (backend *Backend) WalletConnectCancel() {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	wc := &backend.walletConnect
+	switch wc.state.State {
+	case walletConnectStateConnecting, walletConnectStateSessionApproval:
+		backend.walletConnectClosePairing()
+	case walletConnectStateRequestApproval:
+		request := wc.state.Request
+		if err := request.session.session.RespondError(
+			request.id, walletConnectErrorUserRejected, "User rejected the request."); err != nil {
+			backend.log.WithError(err).Error("walletconnect: could not reject the request")
+		}
+	case walletConnectStateSigning:
+		// Can't be cancelled in the app, only on the device.
+		return
+	}
+	wc.state = WalletConnect{State: walletConnectStateInactive}
+	backend.walletConnectProcessQueue()
+	backend.notifyWalletConnect()
+}
+
+// WalletConnectApproveSession is called when the user approves the session request, connecting the
+// chosen account to the dapp.
+func (backend *Backend) WalletConnectApproveSession(code accounts.Code) {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	wc := &backend.walletConnect
+	if wc.state.State != walletConnectStateSessionApproval {
+		return
+	}
+	log := backend.log.WithField("accountCode", code)
+	found := false
+	for _, acct := range wc.state.Accounts {
+		if acct.Code == code {
+			found = true
+			break
+		}
+	}
+	account, err := backend.walletConnectAccount(code)
+	if !found || err != nil {
+		log.WithError(err).Error("walletconnect: could not find account")
+		backend.walletConnectClosePairing()
+		backend.walletConnectSetError(errWalletConnectUnknown)
+		return
+	}
+	pairing := wc.pairing
+	chainID := account.Coin().(*eth.Coin).Net().ChainID.Uint64()
+	err = pairing.session.Approve(
+		pairing.sessionRequestID,
+		walletconnect.SessionParams{
+			ChainID:   chainID,
+			NetworkID: chainID,
+			Accounts:  []string{account.GetUnusedReceiveAddresses()[0][0].EncodeForHumans()},
+		},
+		walletConnectPeerMeta,
+	)
+	if err != nil {
+		log.WithError(err).Error("walletconnect: could not approve the session")
+		backend.walletConnectClosePairing()
+		backend.walletConnectSetError(errWalletConnectConnection)
+		return
+	}
+	pairing.accountCode = code
+	wc.sessions[pairing.session.ClientID()] = pairing
+	wc.pairing = nil
+	wc.state = WalletConnect{State: walletConnectStateInactive}
+	backend.walletConnectProcessQueue()
+	backend.notifyWalletConnect()
+	backend.notifyWalletConnectSessions()
+}
+
+// WalletConnectApproveRequest is called when the user approves the current request. The request is
+// signed, and in case of a transaction broadcast, and the result is delivered to the dapp.
+func (backend *Backend) WalletConnectApproveRequest() {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	wc := &backend.walletConnect
+	if wc.state.State != walletConnectStateRequestApproval {
+		return
+	}
+	request := wc.state.Request
+	session := request.session.session
+	log := backend.log.
+		WithField("walletconnect-client-id", session.ClientID()).
+		WithField("method", request.Method)
+	wc.state.State = walletConnectStateSigning
+	backend.notifyWalletConnect()
+
+	result, err := backend.walletConnectProcessRequest(request)
+	if err != nil {
+		errorCode := errWalletConnectRequestFailed
+		responseErr := &walletconnect.ResponseError{Code: walletConnectErrorInternal, Message: err.Error()}
+		if errp.Cause(err) == keystore.ErrSigningAborted || firmware.IsErrorAbort(errp.Cause(err)) {
+			errorCode = errWalletConnectSigningAborted
+			responseErr = &walletconnect.ResponseError{
+				Code: walletConnectErrorUserRejected, Message: "User rejected the request."}
+		}
+		if errp.Cause(err) == keystore.ErrUnsupported {
+			errorCode = errWalletConnectUnsupported
+			responseErr = &walletconnect.ResponseError{
+				Code: walletConnectErrorUnsupported, Message: "The wallet does not support this request."}
+		}
+		log.WithError(err).Error("walletconnect: request failed")
+		if err := session.RespondError(request.id, responseErr.Code, responseErr.Message); err != nil {
+			log.WithError(err).Error("walletconnect: could not respond")
+		}
+		backend.walletConnectSetError(errorCode)
+		return
+	}
+	if err := session.Respond(request.id, result); err != nil {
+		log.WithError(err).Error("walletconnect: could not respond")
+		backend.walletConnectSetError(errWalletConnectConnection)
+		return
+	}
+	wc.state.State = walletConnectStateSuccess
+	wc.state.Result = result
+	backend.notifyWalletConnect()
+}
+
+// walletConnectProcessRequest signs the request, or signs and broadcasts the transaction. The
+// result is the signature or the transaction ID. `accountsAndKeystoreLock` must be held when
+// calling this function.
+func (backend *Backend) walletConnectProcessRequest(request *WalletConnectRequest) (string, error) {
+	account, err := backend.walletConnectAccount(request.session.accountCode)
+	if err != nil {
+		return "", err
+	}
+	switch request.Method {
+	case "personal_sign":
+		return account.SignMessage(request.message)
+	case "eth_signTypedData", "eth_signTypedData_v4":
+		return account.SignTypedMessage(request.data)
+	case "eth_sendTransaction":
+		return account.ProposeAndSendTx(&accounts.TxProposalArgs{
+			RecipientAddress: request.Recipient,
+			Amount:           coinpkg.NewSendAmount(request.Amount),
+			FeeTargetCode:    accounts.DefaultFeeTarget,
+			Data:             request.data,
+		})
+	default:
+		return "", errp.Newf("unsupported method %s", request.Method)
+	}
+}
+
+// WalletConnectDisconnect ends the session with the given client ID.
+func (backend *Backend) WalletConnectDisconnect(clientID string) error {
+	defer backend.accountsAndKeystoreLock.Lock()()
+	session, ok := backend.walletConnect.sessions[clientID]
+	if !ok {
+		return errp.Newf("unknown session %s", clientID)
+	}
+	backend.walletConnectRemoveSession(clientID)
+	backend.notifyWalletConnect()
+	if err := session.session.Disconnect(); err != nil {
+		backend.log.WithError(err).Error("walletconnect: could not notify the dapp")
+	}
+	return nil
+}
+
+// walletConnectDisconnectAll ends all sessions and resets the state, e.g. when the keystore is
+// gone. `accountsAndKeystoreLock` must be held when calling this function.
+func (backend *Backend) walletConnectDisconnectAll() {
+	wc := &backend.walletConnect
+	backend.walletConnectClosePairing()
+	for clientID, session := range wc.sessions {
+		if err := session.session.Disconnect(); err != nil {
+			backend.log.WithError(err).Error("walletconnect: could not notify the dapp")
+		}
+		delete(wc.sessions, clientID)
+	}
+	wc.queue = nil
+	wc.state = WalletConnect{State: walletConnectStateInactive}
+	backend.notifyWalletConnect()
+	backend.notifyWalletConnectSessions()
+}
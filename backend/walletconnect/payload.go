@@ -0,0 +1,103 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walletconnect
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// EncryptedPayload is the payload of a message published to the relay. The data is encrypted
+// using AES-256-CBC with PKCS#7 padding. The HMAC-SHA256 authenticates `data || iv`. All fields
+// are hex encoded.
+type EncryptedPayload struct {
+	Data string `json:"data"`
+	HMAC string `json:"hmac"`
+	IV   string `json:"iv"`
+}
+
+func computeHMAC(key []byte, data []byte, iv []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(data)
+	_, _ = mac.Write(iv)
+	return mac.Sum(nil)
+}
+
+// Encrypt encrypts and authenticates the JSON encoding of the message.
+func Encrypt(key []byte, message interface{}) (*EncryptedPayload, error) {
+	plaintext, err := json.Marshal(message)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	plaintext = append(plaintext, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	data := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, plaintext)
+	return &EncryptedPayload{
+		Data: hex.EncodeToString(data),
+		HMAC: hex.EncodeToString(computeHMAC(key, data, iv)),
+		IV:   hex.EncodeToString(iv),
+	}, nil
+}
+
+// Decrypt authenticates and decrypts the payload, and decodes the resulting JSON into message.
+func (payload *EncryptedPayload) Decrypt(key []byte, message interface{}) error {
+	data, err := hex.DecodeString(payload.Data)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	iv, err := hex.DecodeString(payload.IV)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	mac, err := hex.DecodeString(payload.HMAC)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	if !hmac.Equal(mac, computeHMAC(key, data, iv)) {
+		return errp.New("invalid HMAC")
+	}
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return errp.New("invalid ciphertext")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return errp.New("invalid padding")
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+	return errp.WithStack(json.Unmarshal(plaintext, message))
+}
@@ -0,0 +1,321 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relaytest provides a local stand-in for a WalletConnect relay and a fake dapp, to test
+// the wallet side of the protocol without network access.
+package relaytest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// socketMessage mirrors the envelope of the relay protocol.
+type socketMessage struct {
+	Topic   string `json:"topic"`
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+	Silent  bool   `json:"silent"`
+}
+
+// client is one websocket connection to the relay.
+type client struct {
+	conn      *websocket.Conn
+	writeLock locker.Locker
+}
+
+func (c *client) write(message *socketMessage) error {
+	defer c.writeLock.Lock()()
+	return c.conn.WriteJSON(message)
+}
+
+// Server is an in-memory relay. Like the real relay, it forwards published messages to all
+// subscribers of the topic, and holds messages for topics without subscribers until the first
+// subscription.
+type Server struct {
+	httpServer *httptest.Server
+
+	lock          locker.Locker
+	subscriptions map[string][]*client
+	pending       map[string][]*socketMessage
+}
+
+// NewServer starts a new relay. Close() must be called to shut it down.
+func NewServer() *Server {
+	server := &Server{
+		subscriptions: map[string][]*client{},
+		pending:       map[string][]*socketMessage{},
+	}
+	server.httpServer = httptest.NewServer(http.HandlerFunc(server.serveWebsocket))
+	return server
+}
+
+// URL is the bridge URL to put into pairing URIs.
+func (server *Server) URL() string {
+	return server.httpServer.URL
+}
+
+// Close shuts down the relay and all its connections.
+func (server *Server) Close() {
+	server.httpServer.CloseClientConnections()
+	server.httpServer.Close()
+}
+
+func (server *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close() //nolint:errcheck
+	c := &client{conn: conn}
+	for {
+		var message socketMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			server.unsubscribe(c)
+			return
+		}
+		switch message.Type {
+		case "sub":
+			server.subscribe(message.Topic, c)
+		case "pub":
+			server.publish(&message)
+		}
+	}
+}
+
+func (server *Server) subscribe(topic string, c *client) {
+	defer server.lock.Lock()()
+	server.subscriptions[topic] = append(server.subscriptions[topic], c)
+	for _, message := range server.pending[topic] {
+		_ = c.write(message)
+	}
+	delete(server.pending, topic)
+}
+
+func (server *Server) unsubscribe(c *client) {
+	defer server.lock.Lock()()
+	for topic, clients := range server.subscriptions {
+		for i, subscriber := range clients {
+			if subscriber == c {
+				server.subscriptions[topic] = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (server *Server) publish(message *socketMessage) {
+	defer server.lock.Lock()()
+	subscribers := server.subscriptions[message.Topic]
+	if len(subscribers) == 0 {
+		server.pending[message.Topic] = append(server.pending[message.Topic], message)
+		return
+	}
+	for _, subscriber := range subscribers {
+		_ = subscriber.write(message)
+	}
+}
+
+// Dapp is a fake dapp connecting to a relay.
+type Dapp struct {
+	key       []byte
+	topic     string
+	peerID    string
+	bridgeURL string
+	conn      *websocket.Conn
+	writeLock locker.Locker
+
+	// walletPeerID is the client ID of the wallet, known after the session was approved.
+	walletLock   locker.Locker
+	walletPeerID string
+
+	messages chan *json.RawMessage
+	closed   sync.Once
+}
+
+// NewDapp connects a new dapp to the relay.
+func NewDapp(server *Server) (*Dapp, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	bridgeURL, err := url.Parse(server.URL())
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	bridgeURL.Scheme = "ws"
+	conn, _, err := websocket.DefaultDialer.Dial(bridgeURL.String(), nil)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	dapp := &Dapp{
+		key:       key,
+		topic:     uuid.New().String(),
+		peerID:    uuid.New().String(),
+		bridgeURL: server.URL(),
+		conn:      conn,
+		messages:  make(chan *json.RawMessage, 100),
+	}
+	if err := dapp.write(&socketMessage{Topic: dapp.peerID, Type: "sub", Silent: true}); err != nil {
+		return nil, err
+	}
+	go dapp.readLoop()
+	return dapp, nil
+}
+
+func (dapp *Dapp) write(message *socketMessage) error {
+	defer dapp.writeLock.Lock()()
+	return errp.WithStack(dapp.conn.WriteJSON(message))
+}
+
+func (dapp *Dapp) readLoop() {
+	defer close(dapp.messages)
+	for {
+		var message socketMessage
+		if err := dapp.conn.ReadJSON(&message); err != nil {
+			return
+		}
+		var payload walletconnect.EncryptedPayload
+		if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+			continue
+		}
+		var decrypted json.RawMessage
+		if err := payload.Decrypt(dapp.key, &decrypted); err != nil {
+			continue
+		}
+		dapp.messages <- &decrypted
+	}
+}
+
+// URI returns the pairing URI to be handled by the wallet.
+func (dapp *Dapp) URI() string {
+	return "wc:" + dapp.topic + "@1?" + url.Values{
+		"bridge": {dapp.bridgeURL},
+		"key":    {hex.EncodeToString(dapp.key)},
+	}.Encode()
+}
+
+func (dapp *Dapp) publish(topic string, request *walletconnect.Request) error {
+	payload, err := walletconnect.Encrypt(dapp.key, request)
+	if err != nil {
+		return err
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return dapp.write(&socketMessage{Topic: topic, Type: "pub", Payload: string(jsonPayload)})
+}
+
+// RequestSession sends the session request to the pairing topic. Returns the ID of the request.
+func (dapp *Dapp) RequestSession(peerMeta *walletconnect.PeerMeta) (uint64, error) {
+	request, err := walletconnect.NewRequest(walletconnect.MethodSessionRequest,
+		walletconnect.SessionRequestParams{PeerID: dapp.peerID, PeerMeta: peerMeta})
+	if err != nil {
+		return 0, err
+	}
+	return request.ID, dapp.publish(dapp.topic, request)
+}
+
+// Call sends a request to the wallet. The session must have been approved. Returns the ID of the
+// request.
+func (dapp *Dapp) Call(method string, params ...interface{}) (uint64, error) {
+	unlock := dapp.walletLock.RLock()
+	walletPeerID := dapp.walletPeerID
+	unlock()
+	if walletPeerID == "" {
+		return 0, errp.New("session not approved")
+	}
+	request, err := walletconnect.NewRequest(method, params...)
+	if err != nil {
+		return 0, err
+	}
+	return request.ID, dapp.publish(walletPeerID, request)
+}
+
+// Disconnect ends the session.
+func (dapp *Dapp) Disconnect() error {
+	_, err := dapp.Call(walletconnect.MethodSessionUpdate, walletconnect.SessionParams{Approved: false})
+	return err
+}
+
+// next returns the next message sent by the wallet.
+func (dapp *Dapp) next(timeout time.Duration) (*json.RawMessage, error) {
+	select {
+	case message, ok := <-dapp.messages:
+		if !ok {
+			return nil, errp.New("connection closed")
+		}
+		return message, nil
+	case <-time.After(timeout):
+		return nil, errp.New("timeout")
+	}
+}
+
+// Response waits for the next message of the wallet, which must be a response. If it is the
+// approval of the session request, the wallet's peer ID is stored so that Call() can be used.
+func (dapp *Dapp) Response(timeout time.Duration) (*walletconnect.Response, error) {
+	message, err := dapp.next(timeout)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		walletconnect.Response
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(*message, &response); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if response.Error == nil {
+		var params walletconnect.SessionParams
+		if json.Unmarshal(response.Result, &params) == nil && params.Approved && params.PeerID != "" {
+			defer dapp.walletLock.Lock()()
+			dapp.walletPeerID = params.PeerID
+		}
+	}
+	response.Response.Result = response.Result
+	return &response.Response, nil
+}
+
+// Request waits for the next message of the wallet, which must be a request, e.g. a session
+// update.
+func (dapp *Dapp) Request(timeout time.Duration) (*walletconnect.Request, error) {
+	message, err := dapp.next(timeout)
+	if err != nil {
+		return nil, err
+	}
+	var request walletconnect.Request
+	if err := json.Unmarshal(*message, &request); err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &request, nil
+}
+
+// Close closes the connection to the relay.
+func (dapp *Dapp) Close() {
+	dapp.closed.Do(func() { _ = dapp.conn.Close() })
+}
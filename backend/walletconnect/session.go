@@ -0,0 +1,313 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walletconnect
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/locker"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MethodSessionRequest is sent by the dapp to the pairing topic to request a session.
+	MethodSessionRequest = "wc_sessionRequest"
+	// MethodSessionUpdate is sent by either peer to update or end (approved=false) a session.
+	MethodSessionUpdate = "wc_sessionUpdate"
+)
+
+// socketMessage is the envelope of all messages exchanged with the relay.
+type socketMessage struct {
+	Topic string `json:"topic"`
+	// Type is "sub" to subscribe to a topic, or "pub" to publish the payload to a topic.
+	Type string `json:"type"`
+	// Payload is the JSON encoded EncryptedPayload. Empty for subscriptions.
+	Payload string `json:"payload"`
+	Silent  bool   `json:"silent"`
+}
+
+// Request is a JSON-RPC request exchanged between the peers.
+type Request struct {
+	ID      uint64          `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// ResponseError is the error of a failed JSON-RPC request.
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response is the JSON-RPC response to a Request.
+type Response struct {
+	ID      uint64         `json:"id"`
+	JSONRPC string         `json:"jsonrpc"`
+	Result  interface{}    `json:"result,omitempty"`
+	Error   *ResponseError `json:"error,omitempty"`
+}
+
+// PeerMeta describes a peer, e.g. the name and URL of a dapp.
+type PeerMeta struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Icons       []string `json:"icons"`
+}
+
+// SessionRequestParams are the params of a MethodSessionRequest request.
+type SessionRequestParams struct {
+	PeerID   string    `json:"peerId"`
+	PeerMeta *PeerMeta `json:"peerMeta"`
+	ChainID  *uint64   `json:"chainId"`
+}
+
+// SessionParams are the result of an approved session request, and the params of a
+// MethodSessionUpdate request.
+type SessionParams struct {
+	Approved  bool      `json:"approved"`
+	ChainID   uint64    `json:"chainId"`
+	NetworkID uint64    `json:"networkId"`
+	Accounts  []string  `json:"accounts"`
+	RPCURL    string    `json:"rpcUrl,omitempty"`
+	PeerID    string    `json:"peerId,omitempty"`
+	PeerMeta  *PeerMeta `json:"peerMeta,omitempty"`
+}
+
+// NewRequest creates a new request with a fresh ID.
+func NewRequest(method string, params ...interface{}) (*Request, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	jsonParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	return &Request{
+		// Same as in the reference implementation: the current time in microseconds. Leaves
+		// enough room to be represented exactly as a JavaScript number.
+		ID:      uint64(time.Now().UnixNano() / 1000),
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  jsonParams,
+	}, nil
+}
+
+// Session is the connection to one dapp through the relay. It starts out in the pairing phase,
+// waiting for the dapp's session request on the topic of the pairing URI. After the session was
+// approved, the dapp sends its requests to the client ID of the session.
+type Session struct {
+	uri      *URI
+	clientID string
+
+	conn      *websocket.Conn
+	writeLock locker.Locker
+
+	// peerID and peerMeta are set when the session request arrives.
+	peerLock locker.Locker
+	peerID   string
+	peerMeta *PeerMeta
+
+	onRequest func(*Session, *Request)
+	onClose   func(*Session)
+	closeOnce sync.Once
+
+	log *logrus.Entry
+}
+
+// Dial connects to the relay of the pairing URI and waits for requests from the dapp. onRequest is
+// called for every request of the dapp, including the session request, from a goroutine reading
+// the connection. onClose is called once when the session ends, either because the connection was
+// lost, the dapp disconnected or Close() was called.
+func Dial(
+	uri *URI,
+	dialer *websocket.Dialer,
+	onRequest func(*Session, *Request),
+	onClose func(*Session),
+	log *logrus.Entry,
+) (*Session, error) {
+	conn, _, err := dialer.Dial(uri.websocketURL(), nil)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	session := &Session{
+		uri:       uri,
+		clientID:  uuid.New().String(),
+		conn:      conn,
+		onRequest: onRequest,
+		onClose:   onClose,
+	}
+	session.log = log.WithField("walletconnect-client-id", session.clientID)
+	for _, topic := range []string{uri.Topic, session.clientID} {
+		if err := session.write(&socketMessage{Topic: topic, Type: "sub", Silent: true}); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	go session.readLoop()
+	return session, nil
+}
+
+// ClientID is the ID of the wallet in this session, and the topic on which it receives requests.
+// It uniquely identifies the session.
+func (session *Session) ClientID() string {
+	return session.clientID
+}
+
+// PeerMeta returns the metadata of the dapp. Returns nil until the session request arrived.
+func (session *Session) PeerMeta() *PeerMeta {
+	defer session.peerLock.RLock()()
+	return session.peerMeta
+}
+
+func (session *Session) write(message *socketMessage) error {
+	defer session.writeLock.Lock()()
+	return errp.WithStack(session.conn.WriteJSON(message))
+}
+
+func (session *Session) readLoop() {
+	defer session.Close()
+	for {
+		var message socketMessage
+		if err := session.conn.ReadJSON(&message); err != nil {
+			session.log.WithError(err).Info("connection to the relay closed")
+			return
+		}
+		if message.Type != "pub" || (message.Topic != session.uri.Topic && message.Topic != session.clientID) {
+			continue
+		}
+		var payload EncryptedPayload
+		if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+			session.log.WithError(err).Error("invalid payload")
+			continue
+		}
+		var request Request
+		if err := payload.Decrypt(session.uri.Key, &request); err != nil {
+			session.log.WithError(err).Error("could not decrypt the payload")
+			continue
+		}
+		if request.Method == "" {
+			// A response. The wallet does not send requests that need a response.
+			continue
+		}
+		if !session.handleSessionRequest(&request) {
+			return
+		}
+	}
+}
+
+// handleSessionRequest processes the session management requests, forwarding all other requests
+// to onRequest. Returns false if the session ended.
+func (session *Session) handleSessionRequest(request *Request) bool {
+	switch request.Method {
+	case MethodSessionRequest:
+		var params []SessionRequestParams
+		if err := json.Unmarshal(request.Params, &params); err != nil || len(params) != 1 || params[0].PeerID == "" {
+			session.log.WithError(err).Error("invalid session request")
+			return true
+		}
+		unlock := session.peerLock.Lock()
+		session.peerID = params[0].PeerID
+		session.peerMeta = params[0].PeerMeta
+		if session.peerMeta == nil {
+			session.peerMeta = &PeerMeta{}
+		}
+		unlock()
+	case MethodSessionUpdate:
+		var params []SessionParams
+		if err := json.Unmarshal(request.Params, &params); err != nil || len(params) != 1 {
+			session.log.WithError(err).Error("invalid session update")
+			return true
+		}
+		if !params[0].Approved {
+			session.log.Info("dapp ended the session")
+			return false
+		}
+		return true
+	}
+	session.onRequest(session, request)
+	return true
+}
+
+// publish encrypts the message and sends it to the dapp.
+func (session *Session) publish(message interface{}) error {
+	unlock := session.peerLock.RLock()
+	peerID := session.peerID
+	unlock()
+	if peerID == "" {
+		return errp.New("no session request received yet")
+	}
+	payload, err := Encrypt(session.uri.Key, message)
+	if err != nil {
+		return err
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return errp.WithStack(err)
+	}
+	return session.write(&socketMessage{
+		Topic:   peerID,
+		Type:    "pub",
+		Payload: string(jsonPayload),
+		Silent:  true,
+	})
+}
+
+// Approve approves the session request with the given ID, exposing the accounts on the given chain
+// to the dapp.
+func (session *Session) Approve(requestID uint64, params SessionParams, peerMeta *PeerMeta) error {
+	params.Approved = true
+	params.PeerID = session.clientID
+	params.PeerMeta = peerMeta
+	return session.Respond(requestID, params)
+}
+
+// Respond sends the result of the request with the given ID to the dapp.
+func (session *Session) Respond(requestID uint64, result interface{}) error {
+	return session.publish(&Response{ID: requestID, JSONRPC: "2.0", Result: result})
+}
+
+// RespondError sends an error for the request with the given ID to the dapp.
+func (session *Session) RespondError(requestID uint64, code int, message string) error {
+	return session.publish(&Response{
+		ID:      requestID,
+		JSONRPC: "2.0",
+		Error:   &ResponseError{Code: code, Message: message},
+	})
+}
+
+// Disconnect notifies the dapp that the session ended and closes the session.
+func (session *Session) Disconnect() error {
+	defer session.Close()
+	request, err := NewRequest(MethodSessionUpdate, SessionParams{Approved: false})
+	if err != nil {
+		return err
+	}
+	return session.publish(request)
+}
+
+// Close closes the connection to the relay.
+func (session *Session) Close() {
+	session.closeOnce.Do(func() {
+		_ = session.conn.Close()
+		session.onClose(session)
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package walletconnect implements the wallet side of the WalletConnect (v1) protocol, connecting
+// the wallet to dapps through a relay (called bridge in the protocol). See
+// https://docs.walletconnect.org/v/1.0/tech-spec.
+package walletconnect
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+)
+
+// URI is a parsed pairing URI, e.g. `wc:<topic>@1?bridge=https%3A%2F%2Fbridge.example.com&key=<hex>`.
+type URI struct {
+	// Topic on which the dapp publishes the session request.
+	Topic string
+	// Version is the protocol version. Only version 1 is supported.
+	Version string
+	// Bridge is the URL of the relay.
+	Bridge string
+	// Key is the 32 byte symmetric key with which all messages of the session are encrypted.
+	Key []byte
+}
+
+// ParseURI parses and validates a pairing URI.
+func ParseURI(uri string) (*URI, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if u.Scheme != "wc" {
+		return nil, errp.Newf("unexpected URI scheme: %s", u.Scheme)
+	}
+	split := strings.SplitN(u.Opaque, "@", 2)
+	if len(split) != 2 || split[0] == "" {
+		return nil, errp.New("URI is missing the topic or version")
+	}
+	if split[1] != "1" {
+		return nil, errp.Newf("unsupported version: %s", split[1])
+	}
+	query := u.Query()
+	bridge, err := url.Parse(query.Get("bridge"))
+	if err != nil {
+		return nil, errp.WithStack(err)
+	}
+	if bridge.Scheme != "https" && bridge.Scheme != "http" {
+		return nil, errp.Newf("invalid bridge URL: %q", query.Get("bridge"))
+	}
+	key, err := hex.DecodeString(query.Get("key"))
+	if err != nil || len(key) != 32 {
+		return nil, errp.New("the key must be 32 bytes, hex encoded")
+	}
+	return &URI{
+		Topic:   split[0],
+		Version: split[1],
+		Bridge:  bridge.String(),
+		Key:     key,
+	}, nil
+}
+
+// websocketURL returns the URL of the websocket endpoint of the bridge.
+func (uri *URI) websocketURL() string {
+	if strings.HasPrefix(uri.Bridge, "http://") {
+		return "ws://" + strings.TrimPrefix(uri.Bridge, "http://")
+	}
+	return "wss://" + strings.TrimPrefix(uri.Bridge, "https://")
+}
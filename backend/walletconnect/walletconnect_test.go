@@ -0,0 +1,140 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walletconnect_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect/relaytest"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = 5 * time.Second
+
+func TestParseURI(t *testing.T) {
+	uri, err := walletconnect.ParseURI(
+		"wc:8a5e5bdc-a0e4-4702-ba63-8f1a5655744f@1?bridge=https%3A%2F%2Fbridge.walletconnect.org&key=41791102999c339c844880b23950704cc43aa840f3739e365323cda4dfa89e7a")
+	require.NoError(t, err)
+	require.Equal(t, "8a5e5bdc-a0e4-4702-ba63-8f1a5655744f", uri.Topic)
+	require.Equal(t, "1", uri.Version)
+	require.Equal(t, "https://bridge.walletconnect.org", uri.Bridge)
+	require.Len(t, uri.Key, 32)
+
+	for _, invalid := range []string{
+		"aopp:?v=0",
+		"wc:topic@2?bridge=https%3A%2F%2Fbridge.walletconnect.org&key=41791102999c339c844880b23950704cc43aa840f3739e365323cda4dfa89e7a",
+		"wc:@1?bridge=https%3A%2F%2Fbridge.walletconnect.org&key=41791102999c339c844880b23950704cc43aa840f3739e365323cda4dfa89e7a",
+		"wc:topic@1?bridge=ftp%3A%2F%2Fbridge.walletconnect.org&key=41791102999c339c844880b23950704cc43aa840f3739e365323cda4dfa89e7a",
+		"wc:topic@1?bridge=https%3A%2F%2Fbridge.walletconnect.org&key=4179",
+	} {
+		_, err := walletconnect.ParseURI(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestEncryptedPayload(t *testing.T) {
+	key := make([]byte, 32)
+	payload, err := walletconnect.Encrypt(key, map[string]string{"hello": "world"})
+	require.NoError(t, err)
+	var decrypted map[string]string
+	require.NoError(t, payload.Decrypt(key, &decrypted))
+	require.Equal(t, map[string]string{"hello": "world"}, decrypted)
+
+	// Wrong key.
+	require.Error(t, payload.Decrypt(make([]byte, 31), &decrypted))
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	require.Error(t, payload.Decrypt(otherKey, &decrypted))
+
+	// Tampered data.
+	payload.Data = "00" + payload.Data[2:]
+	require.Error(t, payload.Decrypt(key, &decrypted))
+}
+
+func TestSession(t *testing.T) {
+	relay := relaytest.NewServer()
+	defer relay.Close()
+	dapp, err := relaytest.NewDapp(relay)
+	require.NoError(t, err)
+	defer dapp.Close()
+
+	uri, err := walletconnect.ParseURI(dapp.URI())
+	require.NoError(t, err)
+
+	requests := make(chan *walletconnect.Request, 10)
+	closed := make(chan struct{})
+	session, err := walletconnect.Dial(
+		uri,
+		websocket.DefaultDialer,
+		func(_ *walletconnect.Session, request *walletconnect.Request) { requests <- request },
+		func(*walletconnect.Session) { close(closed) },
+		logging.Get().WithGroup("walletconnect_test"),
+	)
+	require.NoError(t, err)
+	require.Nil(t, session.PeerMeta())
+
+	sessionRequestID, err := dapp.RequestSession(&walletconnect.PeerMeta{Name: "Dapp", URL: "https://dapp.example"})
+	require.NoError(t, err)
+	select {
+	case request := <-requests:
+		require.Equal(t, walletconnect.MethodSessionRequest, request.Method)
+		require.Equal(t, sessionRequestID, request.ID)
+	case <-time.After(timeout):
+		require.Fail(t, "no session request")
+	}
+	require.Equal(t, "Dapp", session.PeerMeta().Name)
+
+	require.NoError(t, session.Approve(
+		sessionRequestID,
+		walletconnect.SessionParams{ChainID: 1, Accounts: []string{"0xAccount"}},
+		&walletconnect.PeerMeta{Name: "Wallet"},
+	))
+	response, err := dapp.Response(timeout)
+	require.NoError(t, err)
+	require.Equal(t, sessionRequestID, response.ID)
+	var approval walletconnect.SessionParams
+	require.NoError(t, json.Unmarshal(response.Result.(json.RawMessage), &approval))
+	require.True(t, approval.Approved)
+	require.Equal(t, session.ClientID(), approval.PeerID)
+	require.Equal(t, []string{"0xAccount"}, approval.Accounts)
+
+	callID, err := dapp.Call("personal_sign", "0x68656c6c6f", "0xAccount")
+	require.NoError(t, err)
+	select {
+	case request := <-requests:
+		require.Equal(t, "personal_sign", request.Method)
+		require.Equal(t, callID, request.ID)
+		require.JSONEq(t, `["0x68656c6c6f", "0xAccount"]`, string(request.Params))
+	case <-time.After(timeout):
+		require.Fail(t, "no call request")
+	}
+	require.NoError(t, session.RespondError(callID, 4001, "User rejected the request."))
+	response, err = dapp.Response(timeout)
+	require.NoError(t, err)
+	require.Equal(t, callID, response.ID)
+	require.Equal(t, 4001, response.Error.Code)
+
+	require.NoError(t, dapp.Disconnect())
+	select {
+	case <-closed:
+	case <-time.After(timeout):
+		require.Fail(t, "session not closed")
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/accounts"
+	coinpkg "github.com/digitalbitbox/bitbox-wallet-app/backend/coins/coin"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore"
+	keystoremock "github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/mocks"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/keystore/software"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/signing"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/walletconnect/relaytest"
+	"github.com/digitalbitbox/bitbox-wallet-app/util/errp"
+	"github.com/digitalbitbox/bitbox02-api-go/api/firmware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletConnect(t *testing.T) {
+	const timeout = 5 * time.Second
+	const address = "0xB7C853464BE7Ae39c366C9C2A9D4b95340a708c7"
+	const accountCode = "v0-55555555-eth-0"
+	const typedData = `{"types": {"EIP712Domain": [{"name": "name", "type": "string"}, {"name": "chainId", "type": "uint256"}], "Message": [{"name": "contents", "type": "string"}]}, "primaryType": "Message", "domain": {"name": "Test", "chainId": 1}, "message": {"contents": "Hello"}}`
+
+	// From mnemonic: wisdom minute home employ west tail liquid mad deal catalog narrow mistake
+	rootKey := mustXKey("xprv9s21ZrQH143K3gie3VFLgx8JcmqZNsBcBc6vAdJrsf4bPRhx69U8qZe3EYAyvRWyQdEfz7ZpyYtL8jW2d2Lfkfh6g2zivq8JdZPQqxoxLwB")
+	keystoreHelper := software.NewKeystore(rootKey)
+	signature := make([]byte, 65)
+	typedDataAborted := false
+	ks := &keystoremock.KeystoreMock{
+		RootFingerprintFunc: func() ([]byte, error) {
+			return []byte{0x55, 0x55, 0x55, 0x55}, nil
+		},
+		SupportsAccountFunc: func(coin coinpkg.Coin, meta interface{}) bool {
+			return true
+		},
+		SupportsUnifiedAccountsFunc: func() bool {
+			return true
+		},
+		SupportsMultipleAccountsFunc: func() bool {
+			return true
+		},
+		SignETHMessageFunc: func(message []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+			require.Equal(t, "hello", string(message))
+			require.Equal(t, "m/44'/60'/0'/0/0", keypath.Encode())
+			return append([]byte{}, signature...), nil
+		},
+		SignETHTypedMessageFunc: func(chainID uint64, data []byte, keypath signing.AbsoluteKeypath) ([]byte, error) {
+			if typedDataAborted {
+				return nil, errp.WithStack(keystore.ErrUnsupported)
+			}
+			typedDataAborted = true
+			return nil, firmware.NewError(firmware.ErrUserAbort, "aborted")
+		},
+		ExtendedPublicKeyFunc: keystoreHelper.ExtendedPublicKey,
+	}
+
+	relay := relaytest.NewServer()
+	defer relay.Close()
+
+	t.Run("invalid_uri", func(t *testing.T) {
+		b := newBackend(t, testnetDisabled, regtestDisabled)
+		defer b.Close()
+		b.HandleURI("wc:topic@1?bridge=https%3A%2F%2Fbridge.example.com&key=00")
+		require.Equal(t, walletConnectStateError, b.WalletConnect().State)
+		require.Equal(t, errWalletConnectInvalidURI, b.WalletConnect().ErrorCode)
+	})
+
+	t.Run("no_accounts", func(t *testing.T) {
+		b := newBackend(t, testnetDisabled, regtestDisabled)
+		defer b.Close()
+		dapp, err := relaytest.NewDapp(relay)
+		require.NoError(t, err)
+		defer dapp.Close()
+
+		b.HandleURI(dapp.URI())
+		require.Equal(t, walletConnectStateConnecting, b.WalletConnect().State)
+		_, err = dapp.RequestSession(&walletconnect.PeerMeta{Name: "Dapp"})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.WalletConnect().State == walletConnectStateError
+		}, timeout, 10*time.Millisecond)
+		require.Equal(t, errWalletConnectNoAccounts, b.WalletConnect().ErrorCode)
+		response, err := dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, walletConnectErrorUserRejected, response.Error.Code)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		b := newBackend(t, testnetDisabled, regtestDisabled)
+		defer b.Close()
+		b.registerKeystore(ks)
+		dapp, err := relaytest.NewDapp(relay)
+		require.NoError(t, err)
+		defer dapp.Close()
+
+		b.HandleURI(dapp.URI())
+		sessionRequestID, err := dapp.RequestSession(&walletconnect.PeerMeta{Name: "Dapp"})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.WalletConnect().State == walletConnectStateSessionApproval
+		}, timeout, 10*time.Millisecond)
+		require.Equal(t, "Dapp", b.WalletConnect().Peer.Name)
+		require.Equal(t,
+			[]account{{Name: "Ethereum", Code: accountCode}},
+			b.WalletConnect().Accounts,
+		)
+
+		b.WalletConnectApproveSession(accountCode)
+		require.Equal(t, walletConnectStateInactive, b.WalletConnect().State)
+		response, err := dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, sessionRequestID, response.ID)
+		var approval walletconnect.SessionParams
+		require.NoError(t, json.Unmarshal(response.Result.(json.RawMessage), &approval))
+		require.True(t, approval.Approved)
+		require.Equal(t, uint64(1), approval.ChainID)
+		require.Equal(t, []string{address}, approval.Accounts)
+		sessions := b.WalletConnectSessions()
+		require.Len(t, sessions, 1)
+		require.Equal(t, approval.PeerID, sessions[0].ClientID)
+
+		// Unsupported methods are rejected without asking the user.
+		unsupportedID, err := dapp.Call("eth_sign", address, "0x00")
+		require.NoError(t, err)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, unsupportedID, response.ID)
+		require.Equal(t, walletConnectErrorUnsupported, response.Error.Code)
+
+		// Requests for other addresses are rejected.
+		_, err = dapp.Call("personal_sign", "0x68656c6c6f", "0x0000000000000000000000000000000000000000")
+		require.NoError(t, err)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, walletConnectErrorInvalidParams, response.Error.Code)
+
+		// Two requests are queued and shown one after the other.
+		signID, err := dapp.Call("personal_sign", "0x68656c6c6f", strings.ToLower(address))
+		require.NoError(t, err)
+		typedDataID, err := dapp.Call("eth_signTypedData_v4", address, typedData)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			defer b.accountsAndKeystoreLock.RLock()()
+			return len(b.walletConnect.queue) == 1
+		}, timeout, 10*time.Millisecond)
+		state := b.WalletConnect()
+		require.Equal(t, walletConnectStateRequestApproval, state.State)
+		require.Equal(t, accounts.Code(accountCode), state.AccountCode)
+		require.Equal(t, "personal_sign", state.Request.Method)
+		require.Equal(t, "hello", state.Request.Message)
+
+		signature[64] = 1
+		b.WalletConnectApproveRequest()
+		state = b.WalletConnect()
+		require.Equal(t, walletConnectStateSuccess, state.State)
+		require.Equal(t, "0x"+strings.Repeat("00", 64)+"1c", state.Result)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, signID, response.ID)
+		require.Equal(t, `"0x`+strings.Repeat("00", 64)+`1c"`, string(response.Result.(json.RawMessage)))
+
+		// Dismissing the success shows the next request.
+		b.WalletConnectCancel()
+		state = b.WalletConnect()
+		require.Equal(t, walletConnectStateRequestApproval, state.State)
+		require.Equal(t, "eth_signTypedData_v4", state.Request.Method)
+		require.Equal(t, typedData, state.Request.TypedData)
+
+		// Aborted on the device.
+		b.WalletConnectApproveRequest()
+		require.Equal(t, walletConnectStateError, b.WalletConnect().State)
+		require.Equal(t, errWalletConnectSigningAborted, b.WalletConnect().ErrorCode)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, typedDataID, response.ID)
+		require.Equal(t, walletConnectErrorUserRejected, response.Error.Code)
+		b.WalletConnectCancel()
+		require.Equal(t, walletConnectStateInactive, b.WalletConnect().State)
+
+		// Not supported by the keystore.
+		unsupportedTypedDataID, err := dapp.Call("eth_signTypedData_v4", address, typedData)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.WalletConnect().State == walletConnectStateRequestApproval
+		}, timeout, 10*time.Millisecond)
+		b.WalletConnectApproveRequest()
+		require.Equal(t, walletConnectStateError, b.WalletConnect().State)
+		require.Equal(t, errWalletConnectUnsupported, b.WalletConnect().ErrorCode)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, unsupportedTypedDataID, response.ID)
+		require.Equal(t, walletConnectErrorUnsupported, response.Error.Code)
+		b.WalletConnectCancel()
+
+		// Rejected by the user.
+		rejectedID, err := dapp.Call("personal_sign", "0x68656c6c6f", address)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.WalletConnect().State == walletConnectStateRequestApproval
+		}, timeout, 10*time.Millisecond)
+		b.WalletConnectCancel()
+		require.Equal(t, walletConnectStateInactive, b.WalletConnect().State)
+		response, err = dapp.Response(timeout)
+		require.NoError(t, err)
+		require.Equal(t, rejectedID, response.ID)
+		require.Equal(t, walletConnectErrorUserRejected, response.Error.Code)
+
+		require.NoError(t, dapp.Disconnect())
+		require.Eventually(t, func() bool {
+			return len(b.WalletConnectSessions()) == 0
+		}, timeout, 10*time.Millisecond)
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		b := newBackend(t, testnetDisabled, regtestDisabled)
+		defer b.Close()
+		b.registerKeystore(ks)
+		dapp, err := relaytest.NewDapp(relay)
+		require.NoError(t, err)
+		defer dapp.Close()
+
+		b.HandleURI(dapp.URI())
+		_, err = dapp.RequestSession(&walletconnect.PeerMeta{Name: "Dapp"})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.WalletConnect().State == walletConnectStateSessionApproval
+		}, timeout, 10*time.Millisecond)
+		b.WalletConnectApproveSession(accountCode)
+		_, err = dapp.Response(timeout)
+		require.NoError(t, err)
+
+		sessions := b.WalletConnectSessions()
+		require.Len(t, sessions, 1)
+		require.Error(t, b.WalletConnectDisconnect("unknown"))
+		require.NoError(t, b.WalletConnectDisconnect(sessions[0].ClientID))
+		require.Len(t, b.WalletConnectSessions(), 0)
+		request, err := dapp.Request(timeout)
+		require.NoError(t, err)
+		require.Equal(t, walletconnect.MethodSessionUpdate, request.Method)
+		require.JSONEq(t, `[{"approved": false, "chainId": 0, "networkId": 0, "accounts": null}]`, string(request.Params))
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command headerssnapshot creates a signed headers snapshot from the synced headers database of a
+// Bitcoin based coin. The app loads it if it is configured in the headersSnapshot of the coin in
+// the app config and signed by one of the configured keys, to skip downloading the headers up to
+// the snapshot tip. Usage:
+//
+//	go run ./cmd/headerssnapshot -coin btc -db ~/.config/bitbox/cache/headers-btc.bin \
+//	    -key signing-key.hex -out headers-btc.snapshot
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/db/headersdb"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/btc/headers"
+	"github.com/digitalbitbox/bitbox-wallet-app/backend/coins/ltc"
+)
+
+var networks = map[string]*chaincfg.Params{
+	"btc":  &chaincfg.MainNetParams,
+	"tbtc": &chaincfg.TestNet3Params,
+	"sbtc": &chaincfg.SigNetParams,
+	"ltc":  &ltc.MainNetParams,
+	"tltc": &ltc.TestNet4Params,
+}
+
+func main() {
+	coinCode := flag.String("coin", "btc", "coin code: btc, tbtc, sbtc, ltc or tltc")
+	dbFilename := flag.String("db", "", "headers database of the app, e.g. ~/.config/bitbox/cache/headers-btc.bin")
+	startHeight := flag.Int("start", 0,
+		"first height of the snapshot; lowered if needed to include the last difficulty retarget window")
+	confirmations := flag.Int("confirmations", 100, "number of headers below the database tip to leave out")
+	keyFilename := flag.String("key", "", "file containing the hex encoded private key to sign the snapshot")
+	out := flag.String("out", "", "output file")
+	genKey := flag.Bool("genkey", false, "generate a new signing key and print it and its public key")
+	flag.Parse()
+
+	if *genKey {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("private key: %x\n", key.Serialize())
+		fmt.Printf("public key: %x\n", key.PubKey().SerializeCompressed())
+		return
+	}
+
+	net, ok := networks[*coinCode]
+	if !ok {
+		log.Fatalf("unknown coin %s", *coinCode)
+	}
+	if *dbFilename == "" || *keyFilename == "" || *out == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	keyHex, err := ioutil.ReadFile(*keyFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyBytes, err := hex.DecodeString(strings.TrimSpace(string(keyHex)))
+	if err != nil {
+		log.Fatalf("invalid key: %v", err)
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+
+	if _, err := os.Stat(*dbFilename); err != nil {
+		log.Fatal(err)
+	}
+	db, err := headersdb.NewDB(*dbFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	dbTip, err := db.Tip()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tip := dbTip - *confirmations
+	start := *startHeight
+	if maxStartHeight := headers.MaxSnapshotStartHeight(net, tip); start > maxStartHeight {
+		start = maxStartHeight
+	}
+	if tip < start {
+		log.Fatalf("the database tip %d is too low", dbTip)
+	}
+
+	blockHeaders := make([]*wire.BlockHeader, 0, tip-start+1)
+	for height := start; height <= tip; height++ {
+		header, err := db.HeaderByHeight(height)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if header == nil {
+			log.Fatalf("the database has no header at height %d", height)
+		}
+		blockHeaders = append(blockHeaders, header)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := headers.WriteSnapshot(file, net, start, blockHeaders, key); err != nil {
+		_ = file.Close()
+		log.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote the headers from height %d to %d to %s.\n", start, tip, *out)
+	fmt.Printf("Tip: height %d, hash %s\n", tip, blockHeaders[len(blockHeaders)-1].BlockHash())
+}
@@ -292,12 +292,12 @@ public class MainActivity extends AppCompatActivity {
             Util.log("usb: detached");
             this.updateDevice();
         }
-        // Handle 'aopp:' URIs. This is called when the app is launched and also if it is already
+        // Handle 'aopp:' and 'wc:' URIs. This is called when the app is launched and also if it is already
         // running and brought to the foreground.
         if (intent.getAction().equals(Intent.ACTION_VIEW)) {
             Uri uri = intent.getData();
             if (uri != null) {
-                if (uri.getScheme().equals("aopp")) {
+                if (uri.getScheme().equals("aopp") || uri.getScheme().equals("wc")) {
                     Goserver.handleURI(uri.toString());
                 }
             }
@@ -18,7 +18,7 @@ import { apiGet, apiPost } from '../utils/request';
 import { ChartData } from '../routes/account/summary/chart';
 
 
-export type CoinCode = 'btc' | 'tbtc' | 'ltc' | 'tltc' | 'eth' | 'teth' | 'reth';
+export type CoinCode = 'btc' | 'tbtc' | 'sbtc' | 'ltc' | 'tltc' | 'eth' | 'teth' | 'reth';
 
 export type AccountCode = string;
 
@@ -45,6 +45,7 @@ export interface IAccount {
     isToken: boolean;
     activeTokens?: IActiveToken[];
     blockExplorerTxPrefix: string;
+    watchOnly: boolean;
 }
 
 export const getAccounts = (): Promise<IAccount[]> => {
@@ -56,13 +57,27 @@ export interface IStatus {
     synced: boolean;
     fatalError: boolean;
     offlineError: string | null;
+    nonceIssues?: INonceIssue[];
+    blockchainDiscrepancies?: IBlockchainDiscrepancy[];
+}
+
+export interface INonceIssue {
+    kind: 'gap' | 'dropped';
+    nonce: number;
+    txID?: string;
+}
+
+export interface IBlockchainDiscrepancy {
+    kind: 'history' | 'fee';
+    address?: string;
+    servers: string[];
 }
 
 export const getStatus = (code: AccountCode): Promise<IStatus> => {
     return apiGet(`account/${code}/status`);
 };
 
-export type ScriptType = 'p2pkh' | 'p2wpkh-p2sh' | 'p2wpkh';
+export type ScriptType = 'p2pkh' | 'p2wpkh-p2sh' | 'p2wpkh' | 'p2tr' | 'p2wsh';
 
 export interface IKeyInfo {
     keypath: string;
@@ -75,15 +90,27 @@ export type TBitcoinSimple = {
     scriptType: ScriptType;
 }
 
+export type TBitcoinMultisig = {
+    threshold: number;
+    scriptType: ScriptType;
+    keyInfos: IKeyInfo[];
+}
+
 export type TEthereumSimple = {
     keyInfo: IKeyInfo;
 }
 
 export type TSigningConfiguration = {
     bitcoinSimple: TBitcoinSimple;
+    bitcoinMultisig?: never;
+    ethereumSimple?: never;
+} | {
+    bitcoinSimple?: never;
+    bitcoinMultisig: TBitcoinMultisig;
     ethereumSimple?: never;
 } | {
     bitcoinSimple?: never;
+    bitcoinMultisig?: never;
     ethereumSimple: TEthereumSimple;
 }
 
@@ -138,6 +165,9 @@ export const getBalance = (code: AccountCode): Promise<IBalance> => {
 
 export interface ITransaction {
     addresses: string[];
+    // addressNames has the same length as addresses. Entries are empty if there is no verified
+    // name (e.g. ENS name) for the address.
+    addressNames: string[];
     amount: IAmount;
     fee: IAmount;
     feeRatePerKb: IAmount;
@@ -168,6 +198,14 @@ export const postNotesTx = (code: AccountCode, {
     return apiPost(`account/${code}/notes/tx`, { internalTxID, note });
 };
 
+export const setUTXOLabel = (code: AccountCode, outPoint: string, label: string): Promise<null> => {
+    return apiPost(`account/${code}/utxos/label`, { outPoint, label });
+};
+
+export const setUTXOFrozen = (code: AccountCode, outPoint: string, frozen: boolean): Promise<null> => {
+    return apiPost(`account/${code}/utxos/freeze`, { outPoint, frozen });
+};
+
 export const getTransactionList = (code: AccountCode): Promise<ITransaction[]> => {
     return apiGet(`account/${code}/transactions`);
 };
@@ -202,14 +240,147 @@ export interface ISendTx {
     aborted?: boolean;
     success?: boolean;
     errorMessage?: string;
+    multisigPending?: boolean;
 }
 
 export const sendTx = (code: AccountCode): Promise<ISendTx> => {
     return apiPost(`account/${code}/sendtx`);
 };
 
+export interface ITxProposalPSBT {
+    success: boolean;
+    psbt?: string;
+    errorMessage?: string;
+}
+
+export const getTxProposalPSBT = (code: AccountCode): Promise<ITxProposalPSBT> => {
+    return apiGet(`account/${code}/tx-proposal-psbt`);
+};
+
+export interface IBroadcastPSBT {
+    success: boolean;
+    txID?: string;
+    errorMessage?: string;
+}
+
+export const broadcastPSBT = (code: AccountCode, psbt: string): Promise<IBroadcastPSBT> => {
+    return apiPost(`account/${code}/broadcast-psbt`, { psbt });
+};
+
+export interface IBumpFee {
+    success: boolean;
+    txID?: string;
+    errorCode?: string;
+    errorMessage?: string;
+    aborted?: boolean;
+    multisigPending?: boolean;
+}
+
+export const bumpFee = (code: AccountCode, txID: string, feeRate: string): Promise<IBumpFee> => {
+    return apiPost(`account/${code}/bump-fee`, { txID, feeRate });
+};
+
+export interface ICPFPTxProposal {
+    success: boolean;
+    amount?: IAmount;
+    fee?: IAmount;
+    total?: IAmount;
+    errorCode?: string;
+}
+
+export const proposeCPFPTx = (
+    code: AccountCode,
+    txID: string,
+    feeTarget: string,
+    customFee: string,
+): Promise<ICPFPTxProposal> => {
+    return apiPost(`account/${code}/cpfp-proposal`, { txID, feeTarget, customFee });
+};
+
+export interface IReplaceETHTx {
+    success: boolean;
+    txID?: string;
+    errorCode?: string;
+    errorMessage?: string;
+    aborted?: boolean;
+}
+
+export const speedUpETHTx = (
+    code: AccountCode,
+    txID: string,
+    feeTarget: string,
+    customFee: string,
+): Promise<IReplaceETHTx> => {
+    return apiPost(`account/${code}/speed-up-tx`, { txID, feeTarget, customFee });
+};
+
+export const cancelETHTx = (
+    code: AccountCode,
+    txID: string,
+    feeTarget: string,
+    customFee: string,
+): Promise<IReplaceETHTx> => {
+    return apiPost(`account/${code}/cancel-tx`, { txID, feeTarget, customFee });
+};
+
+export const rebroadcastETHTx = (
+    code: AccountCode,
+    txID: string,
+): Promise<IReplaceETHTx> => {
+    return apiPost(`account/${code}/rebroadcast-tx`, { txID });
+};
+
+export const fillNonceGap = (
+    code: AccountCode,
+    nonce: number,
+    feeTarget: string,
+    customFee: string,
+): Promise<IReplaceETHTx> => {
+    return apiPost(`account/${code}/fill-nonce-gap`, { nonce, feeTarget, customFee });
+};
+
+export interface IENSName {
+    success: boolean;
+    name?: string;
+    errorMessage?: string;
+}
+
+export const getENSName = (
+    code: AccountCode,
+    address: string,
+): Promise<IENSName> => {
+    return apiPost(`account/${code}/ens-name`, { address });
+};
+
+export interface IMultisigPendingTx {
+    psbt: string;
+    txID: string;
+    signatures: number;
+    threshold: number;
+}
+
+export const getMultisigPending = (code: AccountCode): Promise<IMultisigPendingTx | null> => {
+    return apiGet(`account/${code}/multisig/pending`);
+};
+
+export const signMultisigPending = (code: AccountCode): Promise<ISendTx> => {
+    return apiPost(`account/${code}/multisig/sign`);
+};
+
+export const discardMultisigPending = (code: AccountCode): Promise<null> => {
+    return apiPost(`account/${code}/multisig/discard`);
+};
+
 export type FeeTargetCode = 'custom' | 'low' | 'economy' | 'normal' | 'high';
 
+export interface IRecipient {
+    address: string;
+    amount?: string;
+    sendAll: 'yes' | 'no';
+}
+
+export type CoinSelectionStrategy = 'largestFirst' | 'branchAndBound' | 'knapsack' | 'oldestFirst';
+
 export interface IProposeTxData {
     address?: string;
     amount?: number;
@@ -217,6 +388,8 @@ export interface IProposeTxData {
     feePerByte: string;
     feeTarget: FeeTargetCode;
     selectedUTXOs: string[];
+    coinSelection?: CoinSelectionStrategy;
+    recipients?: IRecipient[];
     sendAll: 'yes' | 'no';
 }
 
@@ -224,6 +397,8 @@ export interface IProposeTx {
     aborted?: boolean;
     success?: boolean;
     errorMessage?: string;
+    // Amounts paid to the recipients, in the order of the recipients.
+    outputs?: IAmount[];
 }
 
 export interface IFeeTarget {
@@ -243,3 +418,39 @@ export const getFeeTargetList = (code: AccountCode): Promise<IFeeTargetList> =>
 export const verifyAddress = (code: AccountCode, addressID: string): Promise<boolean> => {
     return apiPost(`account/${code}/verify-address`, addressID);
 };
+
+export const getCanSignMessage = (code: AccountCode): Promise<boolean> => {
+    return apiGet(`account/${code}/can-sign-message`);
+};
+
+export interface ISignMessage {
+    success: boolean;
+    signature?: string;
+    aborted?: boolean;
+    errorCode?: 'keystoreUnsupported';
+    errorMessage?: string;
+}
+
+export const signMessage = (code: AccountCode, addressID: string, message: string): Promise<ISignMessage> => {
+    return apiPost(`account/${code}/sign-message`, { addressID, message });
+};
+
+export const ethSignTypedMessage = (code: AccountCode, typedData: string): Promise<ISignMessage> => {
+    return apiPost(`account/${code}/eth-sign-typed-message`, { typedData });
+};
+
+export interface IVerifyMessage {
+    success: boolean;
+    valid?: boolean;
+    errorCode?: string;
+    errorMessage?: string;
+}
+
+export const verifyMessage = (
+    code: AccountCode,
+    address: string,
+    message: string,
+    signature: string,
+): Promise<IVerifyMessage> => {
+    return apiPost(`account/${code}/verify-message`, { address, message, signature });
+};
@@ -0,0 +1,47 @@
+/**
+ * Copyright 2021 Shift Crypto AG
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+import { CoinCode } from './account';
+import { apiGet, apiPost } from '../utils/request';
+
+export interface DiscoveredAccount {
+    coinCode: CoinCode;
+    accountNumber: number;
+    name: string;
+}
+
+export interface AccountDiscovery {
+    running: boolean;
+    accounts: DiscoveredAccount[] | null;
+}
+
+export const getAccountDiscovery = (): Promise<AccountDiscovery> => {
+    return apiGet('account-discovery');
+};
+
+export interface IAddDiscoveredAccounts {
+    success: boolean;
+    errorMessage?: string;
+}
+
+export const addDiscoveredAccounts = (): Promise<IAddDiscoveredAccounts> => {
+    return apiPost('account-discovery/add');
+};
+
+export const dismissDiscoveredAccounts = (): Promise<null> => {
+    return apiPost('account-discovery/dismiss');
+};
@@ -14,7 +14,7 @@
  * limitations under the License.
  */
 
-import { AccountCode, CoinCode } from './account';
+import { AccountCode, CoinCode, ScriptType } from './account';
 import { apiGet, apiPost } from '../utils/request';
 
 export interface ICoin {
@@ -42,10 +42,40 @@ export const setTokenActive = (accountCode: AccountCode, tokenCode: string, acti
     return apiPost('set-token-active', { accountCode, tokenCode, active });
 };
 
+export interface IAddCustomERC20Token extends ISuccess {
+    tokenCode?: string;
+}
+
+export const addCustomERC20Token = (accountCode: AccountCode, contractAddress: string): Promise<IAddCustomERC20Token> => {
+    return apiPost('add-custom-erc20-token', { accountCode, contractAddress });
+};
+
 export const renameAccount = (accountCode: AccountCode, name: string): Promise<ISuccess> => {
     return apiPost('rename-account', { accountCode, name });
 };
 
+export interface IAddAccount extends ISuccess {
+    accountCode?: AccountCode;
+}
+
+export const addWatchOnlyAccount = (
+    coinCode: CoinCode,
+    name: string,
+    extendedPublicKey: string,
+    scriptType?: ScriptType,
+): Promise<IAddAccount> => {
+    return apiPost('account-add-watchonly', { coinCode, name, extendedPublicKey, scriptType });
+};
+
+export const addMultisigAccount = (
+    coinCode: CoinCode,
+    name: string,
+    threshold: number,
+    cosigners: string[],
+): Promise<IAddAccount> => {
+    return apiPost('account-add-multisig', { coinCode, name, threshold, cosigners });
+};
+
 export const reinitializeAccounts = (): Promise<null> => {
     return apiPost('accounts/reinitialize');
 };
@@ -0,0 +1,88 @@
+/**
+ * Copyright 2021 Shift Crypto AG
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+import { AccountCode } from './account';
+import { Account } from './aopp';
+import { apiGet, apiPost } from '../utils/request';
+
+export interface PeerMeta {
+    name: string;
+    description: string;
+    url: string;
+    icons: string[];
+}
+
+export interface Request {
+    method: 'personal_sign' | 'eth_signTypedData' | 'eth_signTypedData_v4' | 'eth_sendTransaction';
+    message?: string;
+    typedData?: string;
+    recipient?: string;
+    amount?: string;
+    data?: string;
+}
+
+export type WalletConnect = {
+    state: 'error';
+    errorCode: 'walletConnectInvalidURI' | 'walletConnectConnection' | 'walletConnectNoAccounts' | 'walletConnectSigningAborted' | 'walletConnectRequestFailed' | 'walletConnectUnknown';
+} | {
+    state: 'inactive' | 'connecting';
+} | {
+    state: 'session-approval';
+    peer: PeerMeta;
+    accounts: Account[];
+} | {
+    state: 'request-approval' | 'signing';
+    peer: PeerMeta;
+    accountCode: AccountCode;
+    request: Request;
+} | {
+    state: 'success';
+    peer: PeerMeta;
+    accountCode: AccountCode;
+    request: Request;
+    result: string;
+};
+
+export interface Session {
+    clientID: string;
+    peer: PeerMeta;
+    accountCode: AccountCode;
+}
+
+export const getWalletConnect = (): Promise<WalletConnect> => {
+    return apiGet('walletconnect');
+};
+
+export const getSessions = (): Promise<Session[]> => {
+    return apiGet('walletconnect/sessions');
+};
+
+export const cancel = (): Promise<null> => {
+    return apiPost('walletconnect/cancel');
+};
+
+export const approveSession = (accountCode: AccountCode): Promise<null> => {
+    return apiPost('walletconnect/approve-session', { accountCode });
+};
+
+export const approveRequest = (): Promise<null> => {
+    return apiPost('walletconnect/approve-request');
+};
+
+export const disconnect = (clientID: string): Promise<null> => {
+    return apiPost('walletconnect/disconnect', { clientID });
+};
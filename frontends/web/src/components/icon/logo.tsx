@@ -73,6 +73,7 @@ const logoMap = {
     'btc': [BTC, BTC_GREY],
     'tbtc': [BTC, BTC_GREY],
     'rbtc': [BTC, BTC_GREY],
+    'sbtc': [BTC, BTC_GREY],
     'ltc': [LTC, LTC_GREY],
     'tltc': [LTC, LTC_GREY],
     'eth': [ETH, ETH_GREY],
@@ -131,6 +131,7 @@ class Transaction extends Component<Props, State> {
         numConfirmationsComplete,
         time,
         addresses,
+        addressNames,
         status,
         note = '',
     }: RenderableProps<Props>,
@@ -178,7 +179,7 @@ class Transaction extends Component<Props, State> {
                                     {t(type === 'receive' ? 'transaction.tx.received' : 'transaction.tx.sent')}
                                 </span>
                                 <span className={style.address}>
-                                    {addresses[0]}
+                                    {addressNames[0] || addresses[0]}
                                     {addresses.length > 1 && (
                                         <span className={style.badge}>
                                             (+{addresses.length - 1})
@@ -317,14 +318,18 @@ class Transaction extends Component<Props, State> {
                             <div className={[style.detail, style.addresses].join(' ')}>
                                 <label>{t('transaction.details.address')}</label>
                                 <div className={style.detailAddresses}>
-                                    { addresses.map((address) => (
-                                        <CopyableInput
-                                            key={address}
-                                            alignRight
-                                            borderLess
-                                            flexibleHeight
-                                            className={style.detailAddress}
-                                            value={address} />
+                                    { addresses.map((address, index) => (
+                                        <div key={address}>
+                                            {addressNames[index] && (
+                                                <p>{addressNames[index]}</p>
+                                            )}
+                                            <CopyableInput
+                                                alignRight
+                                                borderLess
+                                                flexibleHeight
+                                                className={style.detailAddress}
+                                                value={address} />
+                                        </div>
                                     )) }
                                 </div>
                             </div>
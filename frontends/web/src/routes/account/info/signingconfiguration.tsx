@@ -63,6 +63,13 @@ class SigningConfiguration extends Component<Props, State> {
         if (info.bitcoinSimple !== undefined) {
             return info.bitcoinSimple;
         }
+        if (info.bitcoinMultisig !== undefined) {
+            // Show the first cosigner key.
+            return {
+                keyInfo: info.bitcoinMultisig.keyInfos[0],
+                scriptType: info.bitcoinMultisig.scriptType,
+            };
+        }
         return info.ethereumSimple;
     }
 
@@ -170,7 +170,7 @@ class Receive extends Component<Props, State> {
             return null;
         }
         let uriPrefix = '';
-        if (account.coinCode === 'btc' || account.coinCode === 'tbtc') {
+        if (account.coinCode === 'btc' || account.coinCode === 'tbtc' || account.coinCode === 'sbtc') {
             uriPrefix = 'bitcoin:';
         } else if (account.coinCode === 'ltc' || account.coinCode === 'tltc') {
             uriPrefix = 'litecoin:';
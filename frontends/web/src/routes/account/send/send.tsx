@@ -63,6 +63,10 @@ interface State {
     proposedFee?: accountApi.IAmount;
     proposedTotal?: accountApi.IAmount;
     recipientAddress?: string;
+    // proposedRecipientAddress is the address the tx pays to, e.g. resolved from an ENS name.
+    proposedRecipientAddress?: string;
+    // recipientENSName is the verified ENS name of the recipient address, shown when confirming.
+    recipientENSName?: string;
     proposedAmount?: accountApi.IAmount;
     valid: boolean;
     amount?: string;
@@ -219,7 +223,8 @@ class Send extends Component<Props, State> {
             alertUser(this.props.t('warning.sendPairing'));
             return;
         }
-        this.setState({ signProgress: undefined, isConfirming: true });
+        this.setState({ signProgress: undefined, isConfirming: true, recipientENSName: undefined });
+        this.lookupRecipientENSName();
         accountApi.sendTx(this.getAccount()!.code).then(result => {
             if (result.success) {
                 this.setState({
@@ -227,6 +232,8 @@ class Send extends Component<Props, State> {
                     isConfirming: false,
                     isSent: true,
                     recipientAddress: undefined,
+                    proposedRecipientAddress: undefined,
+                    recipientENSName: undefined,
                     proposedAmount: undefined,
                     proposedFee: undefined,
                     proposedTotal: undefined,
@@ -258,6 +265,23 @@ class Send extends Component<Props, State> {
         });
     }
 
+    // lookupRecipientENSName resolves the ENS name of the recipient if it was entered as an
+    // Ethereum address. Names are only looked up here so not all addresses are revealed to the node.
+    private lookupRecipientENSName = () => {
+        const account = this.getAccount();
+        const { recipientAddress } = this.state;
+        if (!account || isBitcoinBased(account.coinCode) || !recipientAddress || !/^0x[0-9a-fA-F]{40}$/.test(recipientAddress)) {
+            return;
+        }
+        accountApi.getENSName(account.code, recipientAddress)
+            .then(({ success, name }) => {
+                if (success && name && this.state.recipientAddress === recipientAddress) {
+                    this.setState({ recipientENSName: name });
+                }
+            })
+            .catch(console.error);
+    }
+
     private txInput = () => ({
         address: this.state.recipientAddress,
         amount: this.state.amount,
@@ -276,6 +300,7 @@ class Send extends Component<Props, State> {
     private validateAndDisplayFee = (updateFiat: boolean = true) => {
         this.setState({
             proposedTotal: undefined,
+            proposedRecipientAddress: undefined,
             addressError: undefined,
             amountError: undefined,
             dataError: undefined,
@@ -327,6 +352,7 @@ class Send extends Component<Props, State> {
                 proposedFee: result.fee,
                 proposedAmount: result.amount,
                 proposedTotal: result.total,
+                proposedRecipientAddress: result.recipientAddress,
                 isUpdatingProposal: false,
             });
             if (updateFiat) {
@@ -336,7 +362,8 @@ class Send extends Component<Props, State> {
             const errorCode = result.errorCode;
             switch (errorCode) {
                 case 'invalidAddress':
-                    this.setState({ addressError: this.props.t('send.error.invalidAddress') });
+                case 'ensNameNotFound':
+                    this.setState({ addressError: this.props.t(`send.error.${errorCode}`) });
                     break;
                 case 'invalidAmount':
                 case 'insufficientFunds':
@@ -547,6 +574,8 @@ class Send extends Component<Props, State> {
             proposedFee,
             proposedTotal,
             recipientAddress,
+            proposedRecipientAddress,
+            recipientENSName,
             proposedAmount,
             valid,
             amount,
@@ -758,6 +787,12 @@ class Send extends Component<Props, State> {
                                 <div className={style.confirmItem}>
                                     <label>{t('send.address.label')}</label>
                                     <p>{recipientAddress || 'N/A'}</p>
+                                    {(proposedRecipientAddress && proposedRecipientAddress !== recipientAddress) && (
+                                        <p>{proposedRecipientAddress}</p>
+                                    )}
+                                    {recipientENSName && (
+                                        <p>{recipientENSName}</p>
+                                    )}
                                 </div>
                                 <div className={style.confirmItem}>
                                     <label>{t('send.amount.label')}</label>
@@ -37,6 +37,8 @@ interface UTXO {
     outPoint: string;
     address: string;
     amount: UTXOAmount;
+    label: string;
+    frozen: boolean;
 }
 
 interface UTXOwithTX extends UTXO {
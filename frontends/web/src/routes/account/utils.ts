@@ -21,6 +21,7 @@ export function isBitcoinOnly(coinCode: CoinCode): boolean {
     switch (coinCode) {
     case 'btc':
     case 'tbtc':
+    case 'sbtc':
         return true;
     default:
         return false;
@@ -31,6 +32,7 @@ export function isBitcoinBased(coinCode: CoinCode): boolean {
     switch (coinCode) {
     case 'btc':
     case 'tbtc':
+    case 'sbtc':
     case 'ltc':
     case 'tltc':
         return true;
@@ -47,6 +49,7 @@ export function getCoinCode(coinCode: CoinCode): CoinCode | undefined {
     switch (coinCode) {
         case 'btc':
         case 'tbtc':
+        case 'sbtc':
             return 'btc';
         case 'ltc':
         case 'tltc':
@@ -67,6 +70,10 @@ export function getScriptName(scriptType: ScriptType): string {
             return 'Segwit';
         case 'p2wpkh':
             return 'Native segwit (bech32)';
+        case 'p2tr':
+            return 'Taproot (bech32m)';
+        case 'p2wsh':
+            return 'Multisig (bech32)';
     }
 }
 
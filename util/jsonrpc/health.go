@@ -0,0 +1,197 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// healthAlpha is the weight of a new sample in the moving averages of the backend health.
+	healthAlpha = 0.2
+	// errorRatePenalty is the score penalty of a backend with an error rate of 100%, in seconds of
+	// latency.
+	errorRatePenalty = 10.0
+	// tipLagPenalty is the score penalty per block a backend is behind, in seconds of latency.
+	tipLagPenalty = 2.0
+	// scoreTolerance is the score difference up to which backends are considered equally healthy.
+	// Equally healthy backends are chosen randomly to balance the load.
+	scoreTolerance = 1.0
+)
+
+// backendHealth tracks the health of a backend. Protected by Backend.healthLock.
+type backendHealth struct {
+	// latency is the moving average of the response times.
+	latency time.Duration
+	// errorRate is the moving average of failed connection attempts and connections, between 0
+	// and 1.
+	errorRate float64
+	// tipHeight is the last blockchain tip height reported by the backend, 0 if unknown.
+	tipHeight int
+}
+
+// BackendHealth is a snapshot of the health of a backend.
+type BackendHealth struct {
+	Name      string        `json:"name"`
+	Connected bool          `json:"connected"`
+	Latency   time.Duration `json:"latency"`
+	ErrorRate float64       `json:"errorRate"`
+	TipHeight int           `json:"tipHeight"`
+	// TipLag is the number of blocks the backend is behind the highest tip reported by any backend.
+	TipLag int `json:"tipLag"`
+	// Score ranks the backends, lower is better. It is the latency in seconds plus penalties for
+	// errors and the tip lag.
+	Score float64 `json:"score"`
+}
+
+func (backend *Backend) recordResponse(latency time.Duration) {
+	backend.healthLock.Lock()
+	defer backend.healthLock.Unlock()
+	if backend.health.latency == 0 {
+		backend.health.latency = latency
+	} else {
+		backend.health.latency = time.Duration(
+			(1-healthAlpha)*float64(backend.health.latency) + healthAlpha*float64(latency))
+	}
+	backend.health.errorRate *= 1 - healthAlpha
+}
+
+func (backend *Backend) recordError() {
+	backend.healthLock.Lock()
+	defer backend.healthLock.Unlock()
+	backend.health.errorRate = (1-healthAlpha)*backend.health.errorRate + healthAlpha
+}
+
+func (backend *Backend) getHealth() backendHealth {
+	backend.healthLock.Lock()
+	defer backend.healthLock.Unlock()
+	return backend.health
+}
+
+// setConnection sets the current connection, nil if disconnected.
+func (client *RPCClient) setConnection(conn *connection) {
+	client.connection = conn
+	client.backendLock.Lock()
+	defer client.backendLock.Unlock()
+	if conn == nil {
+		client.backend = nil
+	} else {
+		client.backend = conn.backend
+	}
+}
+
+// connectedBackend returns the backend of the current connection, or nil if not connected.
+func (client *RPCClient) connectedBackend() *Backend {
+	client.backendLock.RLock()
+	defer client.backendLock.RUnlock()
+	return client.backend
+}
+
+// ConnectedBackend returns the name of the backend the client is connected to, or "" if it is not
+// connected.
+func (client *RPCClient) ConnectedBackend() string {
+	if backend := client.connectedBackend(); backend != nil {
+		return backend.Name
+	}
+	return ""
+}
+
+// SetTipHeight records the blockchain tip height reported by the connected backend. Backends behind
+// the highest known tip are ranked lower.
+func (client *RPCClient) SetTipHeight(height int) {
+	backend := client.connectedBackend()
+	if backend == nil {
+		return
+	}
+	backend.healthLock.Lock()
+	defer backend.healthLock.Unlock()
+	backend.health.tipHeight = height
+}
+
+// AvoidBackendOf makes the client rank the backend other is connected to last, so that both clients
+// connect to different backends if possible, e.g. to cross-check their answers.
+func (client *RPCClient) AvoidBackendOf(other *RPCClient) {
+	client.avoidBackend = other.connectedBackend
+}
+
+// Health returns the health of all backends.
+func (client *RPCClient) Health() []BackendHealth {
+	connected := client.connectedBackend()
+	healths := make([]backendHealth, len(client.backends))
+	maxTipHeight := 0
+	for i, backend := range client.backends {
+		healths[i] = backend.getHealth()
+		if healths[i].tipHeight > maxTipHeight {
+			maxTipHeight = healths[i].tipHeight
+		}
+	}
+	result := make([]BackendHealth, len(client.backends))
+	for i, backend := range client.backends {
+		health := healths[i]
+		tipLag := 0
+		if health.tipHeight > 0 {
+			tipLag = maxTipHeight - health.tipHeight
+		}
+		result[i] = BackendHealth{
+			Name:      backend.Name,
+			Connected: backend == connected,
+			Latency:   health.latency,
+			ErrorRate: health.errorRate,
+			TipHeight: health.tipHeight,
+			TipLag:    tipLag,
+			Score: health.latency.Seconds() +
+				health.errorRate*errorRatePenalty +
+				float64(tipLag)*tipLagPenalty,
+		}
+	}
+	return result
+}
+
+// rankedBackends returns the backends in the order in which they should be connected to, the
+// healthiest first.
+func (client *RPCClient) rankedBackends() []*Backend {
+	health := client.Health()
+	var avoid *Backend
+	if client.avoidBackend != nil {
+		avoid = client.avoidBackend()
+	}
+	type rankedBackend struct {
+		backend *Backend
+		rank    int
+		avoid   bool
+	}
+	ranked := make([]rankedBackend, len(client.backends))
+	for i, index := range rand.Perm(len(client.backends)) {
+		backend := client.backends[index]
+		ranked[i] = rankedBackend{
+			backend: backend,
+			rank:    int(health[index].Score / scoreTolerance),
+			avoid:   backend == avoid,
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].avoid != ranked[j].avoid {
+			return !ranked[i].avoid
+		}
+		return ranked[i].rank < ranked[j].rank
+	})
+	result := make([]*Backend, len(ranked))
+	for i, backend := range ranked {
+		result[i] = backend.backend
+	}
+	return result
+}
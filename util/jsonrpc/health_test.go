@@ -0,0 +1,77 @@
+// Copyright 2021 Shift Crypto AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digitalbitbox/bitbox-wallet-app/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func names(backends []*Backend) []string {
+	result := make([]string, len(backends))
+	for i, backend := range backends {
+		result[i] = backend.Name
+	}
+	return result
+}
+
+func TestRankedBackends(t *testing.T) {
+	healthy := &Backend{Name: "healthy"}
+	healthy.recordResponse(100 * time.Millisecond)
+	failing := &Backend{Name: "failing"}
+	failing.recordResponse(100 * time.Millisecond)
+	failing.recordError()
+	failing.recordError()
+	lagging := &Backend{Name: "lagging"}
+	lagging.recordResponse(50 * time.Millisecond)
+	lagging.health.tipHeight = 98
+	healthy.health.tipHeight = 100
+
+	client := NewRPCClient(
+		[]*Backend{failing, lagging, healthy}, nil, logging.Get().WithGroup("jsonrpc_test"))
+
+	health := client.Health()
+	require.Len(t, health, 3)
+	require.Equal(t, "lagging", health[1].Name)
+	require.Equal(t, 2, health[1].TipLag)
+	require.Equal(t, 0, health[2].TipLag)
+	require.InDelta(t, 0.36, health[0].ErrorRate, 0.0001)
+	require.Less(t, health[2].Score, health[0].Score)
+	require.Less(t, health[0].Score, health[1].Score)
+
+	for i := 0; i < 10; i++ {
+		require.Equal(t, []string{"healthy", "failing", "lagging"}, names(client.rankedBackends()))
+	}
+
+	// Responses restore the health of a backend.
+	for i := 0; i < 20; i++ {
+		failing.recordResponse(100 * time.Millisecond)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		ranked := names(client.rankedBackends())
+		require.Equal(t, "lagging", ranked[2])
+		seen[ranked[0]] = true
+	}
+	// Equally healthy backends are chosen randomly.
+	require.Equal(t, map[string]bool{"healthy": true, "failing": true}, seen)
+
+	// The backend of the other client is ranked last.
+	client.avoidBackend = func() *Backend { return healthy }
+	require.Equal(t, []string{"failing", "lagging", "healthy"}, names(client.rankedBackends()))
+}
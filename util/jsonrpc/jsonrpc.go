@@ -48,6 +48,9 @@ type Backend struct {
 	// EstablishConnection connects to the backend and returns a connection object to
 	// read/write/close.
 	EstablishConnection func() (io.ReadWriteCloser, error)
+
+	healthLock sync.Mutex
+	health     backendHealth
 }
 
 type callbacks struct {
@@ -88,6 +91,7 @@ type request struct {
 	method            string
 	params            []interface{}
 	jsonText          []byte
+	sentAt            time.Time
 }
 
 type heartBeat struct {
@@ -131,6 +135,13 @@ type RPCClient struct {
 
 	onError func(error)
 
+	// backend is the backend of connection. It has its own lock so it can be read while connLock is
+	// held, see connectedBackend().
+	backend     *Backend
+	backendLock sync.RWMutex
+	// avoidBackend returns the backend which should be connected to last, see AvoidBackendOf().
+	avoidBackend func() *Backend
+
 	log *logrus.Entry
 }
 
@@ -215,8 +226,9 @@ func (client *RPCClient) resendPendingRequestsAndSubscriptions(failed *connectio
 	if alreadyHandled() {
 		return
 	}
-	client.connection = nil
+	client.setConnection(nil)
 	if failed != nil {
+		failed.backend.recordError()
 		client.log.Debugf("Backend %v failed. Trying to re-subscribe and send pending requests via another connection", failed.backend.Name)
 	} else {
 		// in case socket error does not have any information about the connection, for example
@@ -291,9 +303,9 @@ func (client *RPCClient) setConnectionError(err error) {
 
 // conn returns either the currently active connection or, if none was found, establishes a new connection
 // to any of the configured backends.
-// The selection process is randomized, to balance the load between multiple backends for multiple
-// desktop applications, but we store the active connection and ping it regularly to
-// keep it alive (see ping()).
+// The healthiest backend is preferred (see Health()). The selection among equally healthy backends
+// is randomized, to balance the load between multiple backends for multiple desktop applications,
+// but we store the active connection and ping it regularly to keep it alive (see ping()).
 func (client *RPCClient) conn() (*connection, error) {
 	client.connLock.RLock()
 	conn := client.connection
@@ -312,22 +324,18 @@ func (client *RPCClient) conn() (*connection, error) {
 				return nil
 			}
 
-			start := 0
-			if len(client.backends) > 0 {
-				start = rand.Intn(len(client.backends))
-			}
 			lastErr := errp.New("No full nodes configured.")
-			for i := 0; i < len(client.backends); i++ {
-				client.log.Debugf("Trying to connect to backend %v", client.backends[start].Name)
-				conn, err := client.establishConnection(client.backends[start])
+			for _, backend := range client.rankedBackends() {
+				client.log.Debugf("Trying to connect to backend %v", backend.Name)
+				conn, err := client.establishConnection(backend)
 				if err != nil {
 					client.log.WithError(err).Info("Failover: backend is down")
-					start = (start + 1) % len(client.backends)
+					backend.recordError()
 					lastErr = err
-					client.connection = nil
+					client.setConnection(nil)
 				} else {
 					client.log.Debug("Successfully connected to backend")
-					client.connection = conn
+					client.setConnection(conn)
 					lastErr = nil
 					break
 				}
@@ -351,7 +359,7 @@ func (client *RPCClient) conn() (*connection, error) {
 		client.log.WithError(err).Error("Error happened in connect callback")
 
 		client.connLock.Lock()
-		client.connection = nil
+		client.setConnection(nil)
 		client.connLock.Unlock()
 		return nil, err
 	}
@@ -421,6 +429,7 @@ func (client *RPCClient) handleResponse(conn *connection, responseBytes []byte)
 	if err := json.Unmarshal(responseBytes, response); err != nil {
 		// panic will be caught in read() and subscribed connections will be re-subscribed
 		client.log.WithError(err).Errorf("invalid json response: %s", string(responseBytes))
+		conn.backend.recordError()
 		if client.onError != nil {
 			client.onError(&ResponseError{err})
 		}
@@ -452,6 +461,9 @@ func (client *RPCClient) handleResponse(conn *connection, responseBytes []byte)
 		runlock()
 		var responseError error
 		if ok {
+			if latency := time.Since(pendingRequest.sentAt); latency < responseTimeout {
+				conn.backend.recordResponse(latency)
+			}
 			go func() {
 				responseCallbacks := pendingRequest.responseCallbacks
 				if response.Error != nil {
@@ -581,6 +593,7 @@ func (client *RPCClient) prepare(
 		method,
 		params,
 		jsonText,
+		time.Now(),
 	}
 	return jsonText
 }
@@ -628,6 +641,9 @@ func (client *RPCClient) MethodSync(response interface{}, method string, params
 			}
 		}
 	case <-time.After(responseTimeout):
+		if backend := client.connectedBackend(); backend != nil {
+			backend.recordError()
+		}
 		return &SocketError{errp.New("response timeout"), nil}
 	}
 	return nil